@@ -0,0 +1,135 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package acl provides the access control lists that decide which
+// clients can use the proxies, regardless of the sources they would
+// be assigned to.
+package acl
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Rules are the networks allowed to use the proxies and the ones
+// denied, either in CIDR notation or as single addresses.
+type Rules struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// List is an access control list. Its zero value allows every client.
+// It is safe for concurrent use.
+type List struct {
+	sync.RWMutex
+	rules Rules
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// New returns a list enforcing `r`.
+func New(r Rules) (*List, error) {
+	l := new(List)
+	if err := l.Set(r); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Set replaces the rules of the list.
+func (l *List) Set(r Rules) error {
+	allow, err := ParseNetworks(r.Allow)
+	if err != nil {
+		return err
+	}
+	deny, err := ParseNetworks(r.Deny)
+	if err != nil {
+		return err
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	l.rules = Rules{Allow: append([]string{}, r.Allow...), Deny: append([]string{}, r.Deny...)}
+	l.allow, l.deny = allow, deny
+	return nil
+}
+
+// Rules returns the rules of the list.
+func (l *List) Rules() Rules {
+	l.RLock()
+	defer l.RUnlock()
+	return Rules{Allow: append([]string{}, l.rules.Allow...), Deny: append([]string{}, l.rules.Deny...)}
+}
+
+// Allowed reports whether client `ip` can use the proxies: it must
+// not be denied and, if the allow list is not empty, it must be part
+// of it.
+func (l *List) Allowed(ip net.IP) bool {
+	l.RLock()
+	defer l.RUnlock()
+
+	if contains(l.deny, ip) {
+		return false
+	}
+	return len(l.allow) == 0 || contains(l.allow, ip)
+}
+
+// AllowedAddr is Allowed for the address of a client in host:port
+// form. Addresses that cannot be parsed are refused.
+func (l *List) AllowedAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && l.Allowed(ip)
+}
+
+func contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, v := range networks {
+		if v.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseNetworks parses the networks in CIDR notation, or the single
+// addresses, in `s`.
+func ParseNetworks(s []string) ([]*net.IPNet, error) {
+	acc := make([]*net.IPNet, 0, len(s))
+	for _, v := range s {
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("acl: invalid address %q", v)
+			}
+			bits := 128
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			acc = append(acc, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("acl: %v", err)
+		}
+		acc = append(acc, n)
+	}
+	return acc, nil
+}
@@ -0,0 +1,57 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package acl_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/booster-proj/booster/acl"
+)
+
+func TestList(t *testing.T) {
+	var l acl.List
+	if !l.Allowed(net.ParseIP("192.0.2.1")) {
+		t.Fatalf("The zero list should allow every client")
+	}
+
+	if err := l.Set(acl.Rules{Allow: []string{"192.168.0.0/16", "2001:db8::/32"}, Deny: []string{"192.168.1.13"}}); err != nil {
+		t.Fatal(err)
+	}
+	tt := []struct {
+		addr    string
+		allowed bool
+	}{
+		{addr: "192.168.1.12:50000", allowed: true},
+		{addr: "192.168.1.13:50000", allowed: false},
+		{addr: "10.0.0.1:50000", allowed: false},
+		{addr: "[2001:db8::1]:50000", allowed: true},
+		{addr: "192.168.1.12", allowed: true},
+		{addr: "client:50000", allowed: false},
+	}
+	for _, v := range tt {
+		if got := l.AllowedAddr(v.addr); got != v.allowed {
+			t.Fatalf("%v: wanted allowed %v, found %v", v.addr, v.allowed, got)
+		}
+	}
+
+	if err := l.Set(acl.Rules{Deny: []string{"10.0.0.0/33"}}); err == nil {
+		t.Fatalf("An invalid network was accepted")
+	}
+	if r := l.Rules(); len(r.Allow) != 2 || len(r.Deny) != 1 {
+		t.Fatalf("Invalid rules should not replace the current ones: %+v", r)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package booster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+
+	"github.com/booster-proj/booster/audit"
+	"github.com/booster-proj/booster/history"
+	"github.com/booster-proj/booster/metrics"
+	"github.com/booster-proj/booster/remote"
+	"github.com/booster-proj/booster/traceroute"
+	"golang.org/x/sync/errgroup"
+	"upspin.io/log"
+)
+
+// initAPI builds the router of the API, with its readiness checks,
+// and the server serving it.
+func (bst *Booster) initAPI(exp *metrics.Exporter, db *history.DB) error {
+	c := bst.conf
+	rs := bst.store
+	d := bst.dialer
+
+	router := remote.NewRouter()
+	router.Store = rs
+	router.Dialer = d
+	router.MetricsProvider = exp
+	router.Events = rs.Events
+	router.ConnEvents = d.ConnEvents
+	router.Probes = bst.prober
+	router.Speedtest = bst.tester
+	router.Traceroute = &traceroute.Tracer{Store: rs}
+	router.History = db
+	router.Journal = bst.journal
+	router.DNSCache = bst.dns
+	router.Watchdog = bst.watchdog
+	router.GeoIP = bst.geo
+	router.Blocklist = bst.blocks
+	router.ACL = bst.acl
+	router.Schedules = bst.sched
+	router.Logger = c.Logger
+	router.Tokens = c.APITokens
+	router.RateLimit = c.APIRateLimit
+	router.RateBurst = c.APIRateBurst
+	router.MaxBodySize = c.APIMaxBodySize
+	router.Dashboard = c.Dashboard
+	if c.APIDebug {
+		// Without tokens the API is open to anyone: the profiles
+		// and the command line would leak the secrets of booster.
+		admin := false
+		for _, v := range c.APITokens {
+			admin = admin || v.Role >= remote.RoleAdmin
+		}
+		if !admin {
+			return errors.New("the diagnostics of the API are served to the admin tokens only, add one with --api-token")
+		}
+	}
+	router.Debug = c.APIDebug
+	router.Audit = audit.New()
+	if c.AuditLog != "" {
+		var err error
+		if router.Audit, err = audit.Open(c.AuditLog); err != nil {
+			return err
+		}
+	}
+	router.Info = remote.BoosterInfo{
+		Version:      c.Version,
+		Commit:       c.Commit,
+		BuildTime:    c.BuildTime,
+		ProxyPort:    c.ProxyPort,
+		ProxyTLSPort: c.ProxyTLSPort,
+		TunnelPort:   c.TunnelPort,
+		GatewayPort:  c.GatewayPort,
+		TurboPort:    c.TurboPort,
+		TurboTLS:     c.TurboTLS,
+	}
+	for _, v := range c.Listeners {
+		router.Info.Listeners = append(router.Info.Listeners, remote.ListenerInfo{Name: v.Name, Port: v.Port, Strategy: v.Strategy, Policies: v.Policies})
+	}
+	router.Checks = make(map[string]remote.Check)
+	router.Checks["stopping"] = func(ctx context.Context) error {
+		if atomic.LoadInt32(&bst.stopping) != 0 {
+			return errors.New("booster is stopping")
+		}
+		return nil
+	}
+	if c.ProxyPort > 0 {
+		router.Checks["proxy"] = listening("tcp", fmt.Sprintf("127.0.0.1:%d", c.ProxyPort))
+	}
+	if c.TunnelPort > 0 {
+		router.Checks["tunnel"] = listening("tcp", fmt.Sprintf("127.0.0.1:%d", c.TunnelPort))
+	}
+	if c.GatewayPort > 0 {
+		router.Checks["gateway"] = listening("tcp", fmt.Sprintf("127.0.0.1:%d", c.GatewayPort))
+	}
+	if c.ProxyTLSPort > 0 {
+		router.Checks["proxy-tls"] = listening("tcp", fmt.Sprintf("127.0.0.1:%d", c.ProxyTLSPort))
+	}
+	for _, v := range c.Listeners {
+		router.Checks["proxy:"+v.Name] = listening("tcp", fmt.Sprintf("127.0.0.1:%d", v.Port))
+	}
+	if ln := c.TurboListener; ln != nil {
+		router.Checks["turbo"] = listening(ln.Addr().Network(), ln.Addr().String())
+	} else if c.TurboPort > 0 {
+		router.Checks["turbo"] = listening("tcp", fmt.Sprintf("127.0.0.1:%d", c.TurboPort))
+	}
+	router.SetupRoutes()
+	bst.router = router
+	bst.remote = remote.New(router)
+	bst.remote.TLS = c.APITLS
+	return nil
+}
+
+// serveAPI serves the API in `g`, if enabled.
+func (bst *Booster) serveAPI(ctx context.Context, g *errgroup.Group) {
+	c := bst.conf
+	if c.APIPort > 0 || c.APIListener != nil {
+		g.Go(labeled(ctx, "api", func() error {
+			scheme := "http"
+			if bst.remote.TLS != nil {
+				scheme = "https"
+			}
+			defer log.Info.Print("Booster API stopped.")
+			if ln := c.APIListener; ln != nil {
+				log.Info.Printf("Booster API listening on %v (%s)", ln.Addr(), scheme)
+				return bst.remote.Serve(ctx, ln)
+			}
+			log.Info.Printf("Booster API listening on :%d (%s)", c.APIPort, scheme)
+			return bst.remote.ListenAndServe(ctx, c.APIPort)
+		}))
+	}
+}
+
+// listening returns a readiness check that succeeds when a listener
+// accepts connections at `address`.
+func listening(network, address string) remote.Check {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, network, address)
+		if err != nil {
+			return fmt.Errorf("not listening on %v: %v", address, err)
+		}
+		return conn.Close()
+	}
+}
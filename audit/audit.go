@@ -0,0 +1,171 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package audit provides an append-only log of the management
+// operations performed on booster, recording who did what, when,
+// and the state before and after the operation.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// MemoryLimit is the maximum number of entries kept by an in memory
+// log. The oldest entries are discarded first.
+var MemoryLimit = 10000
+
+// Entry describes a management operation.
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Actor is who performed the operation, e.g. the name of the
+	// API token used.
+	Actor string `json:"actor"`
+	// Action identifies the operation, e.g. "POST /policies/block.json".
+	Action string      `json:"action"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// Filter selects the entries returned by Query. Zero fields match
+// every entry.
+type Filter struct {
+	Actor  string
+	Action string
+	From   time.Time
+	To     time.Time
+}
+
+func (f Filter) match(e *Entry) bool {
+	if f.Actor != "" && e.Actor != f.Actor {
+		return false
+	}
+	if f.Action != "" && e.Action != f.Action {
+		return false
+	}
+	if !f.From.IsZero() && e.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && e.Time.After(f.To) {
+		return false
+	}
+	return true
+}
+
+// Log is the audit log. Use New to create a log kept in memory,
+// or Open to persist it into a file.
+type Log struct {
+	mux     sync.Mutex
+	path    string
+	f       *os.File
+	entries []Entry
+}
+
+// New returns a Log kept in memory.
+func New() *Log {
+	return &Log{}
+}
+
+// Open returns a Log that appends its entries to the file at `path`.
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{path: path, f: f}, nil
+}
+
+// Record appends `e` to the log. If its time is not set, the current
+// time is used.
+func (l *Log) Record(e Entry) error {
+	if l == nil {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if l.f == nil {
+		l.entries = append(l.entries, e)
+		if n := len(l.entries) - MemoryLimit; n > 0 {
+			l.entries = append(l.entries[:0], l.entries[n:]...)
+		}
+		return nil
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := l.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return l.f.Sync()
+}
+
+// Query returns the entries that match `f`, oldest first.
+func (l *Log) Query(f Filter) ([]Entry, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	acc := []Entry{}
+	if l.f == nil {
+		for i := range l.entries {
+			if f.match(&l.entries[i]) {
+				acc = append(acc, l.entries[i])
+			}
+		}
+		return acc, nil
+	}
+
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	s := bufio.NewScanner(file)
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for s.Scan() {
+		var e Entry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			// Skip partially written lines.
+			continue
+		}
+		if f.match(&e) {
+			acc = append(acc, e)
+		}
+	}
+	return acc, s.Err()
+}
+
+// Close closes the underlying file, if any.
+func (l *Log) Close() error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
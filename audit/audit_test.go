@@ -0,0 +1,88 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package audit_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/audit"
+)
+
+func testLog(t *testing.T, l *audit.Log) {
+	now := time.Now()
+	entries := []audit.Entry{
+		{Time: now.Add(-time.Hour), Actor: "alice", Action: "POST /policies/block.json"},
+		{Time: now, Actor: "bob", Action: "DELETE /policies/block_en0.json", Before: json.RawMessage(`[{"id":"block_en0"}]`)},
+	}
+	for _, v := range entries {
+		if err := l.Record(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	acc, err := l.Query(audit.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(acc) != 2 || acc[0].Actor != "alice" {
+		t.Fatalf("Unexpected entries: %+v", acc)
+	}
+	acc, _ = l.Query(audit.Filter{Actor: "bob"})
+	if len(acc) != 1 || acc[0].Before == nil {
+		t.Fatalf("Unexpected entries: %+v", acc)
+	}
+	acc, _ = l.Query(audit.Filter{From: now.Add(-time.Minute)})
+	if len(acc) != 1 || acc[0].Actor != "bob" {
+		t.Fatalf("Unexpected entries: %+v", acc)
+	}
+}
+
+func TestLog_memory(t *testing.T) {
+	testLog(t, audit.New())
+}
+
+func TestLog_file(t *testing.T) {
+	dir, err := ioutil.TempDir("", "booster-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	l, err := audit.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testLog(t, l)
+	l.Close()
+
+	// Entries are appended to the existing ones.
+	l, err = audit.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	l.Record(audit.Entry{Actor: "carol", Action: "PUT /log/levels.json"})
+	acc, _ := l.Query(audit.Filter{})
+	if len(acc) != 3 {
+		t.Fatalf("Unexpected entries: %+v", acc)
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package blocklist refuses the connections to the destinations
+// listed in ad and tracker blocklists, either in hosts format, e.g.
+// "0.0.0.0 ads.example.com", or one domain per line. The lists are
+// loaded from files or URLs and refreshed periodically.
+package blocklist
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"upspin.io/log"
+)
+
+// DefaultRefreshInterval is how often the lists are loaded again.
+const DefaultRefreshInterval = time.Hour * 24
+
+// ErrNotFound is returned when a list does not exist.
+var ErrNotFound = errors.New("blocklist: list not found")
+
+// Source is a list to load.
+type Source struct {
+	Name string
+	// Location is either the path of a file or an http(s) URL.
+	Location string
+}
+
+// ParseSource parses a source in the form name=location.
+func ParseSource(s string) (Source, error) {
+	i := strings.Index(s, "=")
+	if i <= 0 || i == len(s)-1 {
+		return Source{}, fmt.Errorf("blocklist: invalid list %q, expected name=location", s)
+	}
+	return Source{Name: s[:i], Location: s[i+1:]}, nil
+}
+
+// Info describes a list.
+type Info struct {
+	Name     string    `json:"name"`
+	Location string    `json:"location"`
+	Enabled  bool      `json:"enabled"`
+	Hosts    int       `json:"hosts"`
+	Updated  time.Time `json:"updated,omitempty"`
+	// Error is the error encountered by the last refresh, if any.
+	Error string `json:"error,omitempty"`
+}
+
+type list struct {
+	Info
+	hosts   map[string]bool
+	domains map[string]bool
+}
+
+// Filter combines the lists. Create it with New, then call Run to
+// load them. It is safe for concurrent use.
+type Filter struct {
+	// RefreshInterval is how often the lists are loaded again. If
+	// zero, DefaultRefreshInterval is used.
+	RefreshInterval time.Duration
+	// Client is used to download the lists. If nil,
+	// http.DefaultClient is used.
+	Client *http.Client
+
+	mux   sync.RWMutex
+	lists []*list
+}
+
+// New returns a filter of the lists `sources`, which are enabled but
+// empty until they are loaded.
+func New(sources ...Source) (*Filter, error) {
+	f := &Filter{lists: make([]*list, 0, len(sources))}
+	seen := make(map[string]bool, len(sources))
+	for _, v := range sources {
+		if seen[v.Name] {
+			return nil, fmt.Errorf("blocklist: duplicate list %q", v.Name)
+		}
+		seen[v.Name] = true
+		f.lists = append(f.lists, &list{Info: Info{Name: v.Name, Location: v.Location, Enabled: true}})
+	}
+	return f, nil
+}
+
+func (f *Filter) refreshInterval() time.Duration {
+	if f.RefreshInterval <= 0 {
+		return DefaultRefreshInterval
+	}
+	return f.RefreshInterval
+}
+
+// Run loads the lists, then refreshes them every RefreshInterval,
+// until the context is canceled.
+func (f *Filter) Run(ctx context.Context) error {
+	t := time.NewTicker(f.refreshInterval())
+	defer t.Stop()
+	for {
+		f.Refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Refresh loads every list again. The lists that cannot be loaded keep
+// their previous content.
+func (f *Filter) Refresh(ctx context.Context) {
+	for _, v := range f.Lists() {
+		if err := f.RefreshList(ctx, v.Name); err != nil {
+			log.Error.Printf("Blocklist: %v", err)
+		}
+	}
+}
+
+// RefreshList loads list `name` again. If it cannot be loaded, it
+// keeps its previous content.
+func (f *Filter) RefreshList(ctx context.Context, name string) error {
+	f.mux.RLock()
+	l := f.lookup(name)
+	var location string
+	if l != nil {
+		location = l.Location
+	}
+	f.mux.RUnlock()
+	if l == nil {
+		return ErrNotFound
+	}
+
+	hosts, domains, err := f.load(ctx, location)
+
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if err != nil {
+		l.Error = err.Error()
+		return fmt.Errorf("unable to load list %v: %v", name, err)
+	}
+	l.hosts, l.domains = hosts, domains
+	l.Hosts = len(hosts) + len(domains)
+	l.Updated = time.Now()
+	l.Error = ""
+	log.Debug.Printf("Blocklist: loaded %d hosts from list %v", l.Hosts, name)
+	return nil
+}
+
+func (f *Filter) load(ctx context.Context, location string) (hosts, domains map[string]bool, err error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		file, err := os.Open(location)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer file.Close()
+		return Parse(file)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, location, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected status %v", resp.Status)
+	}
+	return Parse(resp.Body)
+}
+
+// lookup returns list `name`, or nil. Has to be called holding the
+// lock.
+func (f *Filter) lookup(name string) *list {
+	for _, v := range f.lists {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// SetEnabled enables or disables list `name`.
+func (f *Filter) SetEnabled(name string, enabled bool) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	l := f.lookup(name)
+	if l == nil {
+		return ErrNotFound
+	}
+	l.Enabled = enabled
+	return nil
+}
+
+// Lists describes the lists of the filter.
+func (f *Filter) Lists() []Info {
+	f.mux.RLock()
+	defer f.mux.RUnlock()
+
+	acc := make([]Info, 0, len(f.lists))
+	for _, v := range f.lists {
+		acc = append(acc, v.Info)
+	}
+	return acc
+}
+
+// Blocked reports whether `host` is listed in one of the enabled
+// lists, returning its name. The entries of the hosts format match
+// only the host listed, the domains also match their subdomains.
+func (f *Filter) Blocked(host string) (string, bool) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	f.mux.RLock()
+	defer f.mux.RUnlock()
+
+	for _, l := range f.lists {
+		if !l.Enabled {
+			continue
+		}
+		if l.hosts[host] {
+			return l.Name, true
+		}
+		if net.ParseIP(host) != nil {
+			continue
+		}
+		for h := host; ; {
+			if l.domains[h] {
+				return l.Name, true
+			}
+			i := strings.IndexByte(h, '.')
+			if i < 0 {
+				break
+			}
+			h = h[i+1:]
+		}
+	}
+	return "", false
+}
+
+// localHosts are the names that the hosts files map to the loopback
+// address, which are never blocked.
+var localHosts = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"local":                 true,
+	"broadcasthost":         true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+	"0.0.0.0":               true,
+}
+
+// Parse reads a list, returning the hosts listed in hosts format and
+// the domains listed one per line. Comments, starting with #, and the
+// adblock syntax for domains, i.e. "||example.com^", are supported.
+func Parse(r io.Reader) (hosts, domains map[string]bool, err error) {
+	hosts, domains = make(map[string]bool), make(map[string]bool)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.IndexAny(line, "#!"); i >= 0 {
+			line = line[:i]
+		}
+		f := strings.Fields(strings.ToLower(line))
+		switch {
+		case len(f) == 0:
+		case len(f) == 1:
+			if d := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(f[0], "||"), "^"), "."); d != "" && !localHosts[d] {
+				domains[d] = true
+			}
+		case net.ParseIP(f[0]) != nil:
+			for _, v := range f[1:] {
+				if v = strings.TrimSuffix(v, "."); !localHosts[v] {
+					hosts[v] = true
+				}
+			}
+		}
+	}
+	return hosts, domains, s.Err()
+}
@@ -0,0 +1,160 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package blocklist_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/booster-proj/booster/blocklist"
+)
+
+const hostsList = `# Ad servers
+127.0.0.1 localhost
+0.0.0.0 ads.example.com tracker.example.com # inline comment
+::1 ip6-localhost
+`
+
+const domainsList = `! adblock style
+||doubleclick.net^
+Metrics.Example.org.
+`
+
+func TestParse(t *testing.T) {
+	hosts, domains, err := blocklist.Parse(strings.NewReader(hostsList + domainsList))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 2 || !hosts["ads.example.com"] || !hosts["tracker.example.com"] {
+		t.Fatalf("Unexpected hosts: %v", hosts)
+	}
+	if len(domains) != 2 || !domains["doubleclick.net"] || !domains["metrics.example.org"] {
+		t.Fatalf("Unexpected domains: %v", domains)
+	}
+}
+
+func TestParseSource(t *testing.T) {
+	s, err := blocklist.ParseSource("ads=https://example.com/hosts?a=b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "ads" || s.Location != "https://example.com/hosts?a=b" {
+		t.Fatalf("Unexpected source: %+v", s)
+	}
+	for _, v := range []string{"ads", "=file", "ads="} {
+		if _, err := blocklist.ParseSource(v); err == nil {
+			t.Fatalf("ParseSource accepted %q", v)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "booster-blocklist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "hosts")
+	if err := ioutil.WriteFile(file, []byte(hostsList), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, domainsList)
+	}))
+	defer ts.Close()
+
+	f, err := blocklist.New(blocklist.Source{Name: "ads", Location: file}, blocklist.Source{Name: "trackers", Location: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.Blocked("ads.example.com"); ok {
+		t.Fatalf("The lists should be empty before they are loaded")
+	}
+	f.Refresh(context.Background())
+
+	tt := []struct {
+		host string
+		list string
+	}{
+		{host: "ads.example.com", list: "ads"},
+		{host: "ADS.example.com.", list: "ads"},
+		{host: "cdn.ads.example.com"},
+		{host: "example.com"},
+		{host: "doubleclick.net", list: "trackers"},
+		{host: "stats.g.doubleclick.net", list: "trackers"},
+		{host: "notdoubleclick.net"},
+		{host: "localhost"},
+	}
+	for _, v := range tt {
+		list, ok := f.Blocked(v.host)
+		if ok != (v.list != "") || list != v.list {
+			t.Fatalf("%v: wanted list %q, found %q (%v)", v.host, v.list, list, ok)
+		}
+	}
+
+	if err := f.SetEnabled("trackers", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.Blocked("doubleclick.net"); ok {
+		t.Fatalf("A disabled list is still blocking")
+	}
+	if err := f.SetEnabled("missing", false); !errors.Is(err, blocklist.ErrNotFound) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	lists := f.Lists()
+	if len(lists) != 2 || lists[0].Hosts != 2 || !lists[0].Enabled || lists[1].Enabled {
+		t.Fatalf("Unexpected lists: %+v", lists)
+	}
+}
+
+func TestRefreshList_error(t *testing.T) {
+	dir, err := ioutil.TempDir("", "booster-blocklist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "hosts")
+	if err := ioutil.WriteFile(file, []byte(hostsList), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, _ := blocklist.New(blocklist.Source{Name: "ads", Location: file})
+	if err := f.RefreshList(context.Background(), "ads"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A list that cannot be loaded keeps its previous content.
+	os.Remove(file)
+	if err := f.RefreshList(context.Background(), "ads"); err == nil {
+		t.Fatalf("RefreshList did not fail with a missing file")
+	}
+	if _, ok := f.Blocked("ads.example.com"); !ok {
+		t.Fatalf("The list lost its content")
+	}
+	if l := f.Lists()[0]; l.Error == "" {
+		t.Fatalf("The error was not recorded: %+v", l)
+	}
+}
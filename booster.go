@@ -0,0 +1,916 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package booster builds and runs the whole booster pipeline, i.e. the
+// source store and listener, the balancer, the proxies and the API,
+// from a Config. It is used by the booster command, and allows to
+// embed booster into other programs, such as desktop applications.
+//
+// A Booster does not depend on any global state, with the exception
+// of the logger and of the tracer, which are process wide and are
+// configured by the caller through the logging and trace packages.
+package booster
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/booster-proj/booster/acl"
+	"github.com/booster-proj/booster/blocklist"
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/crash"
+	"github.com/booster-proj/booster/ddns"
+	"github.com/booster-proj/booster/dialer"
+	"github.com/booster-proj/booster/dnscache"
+	"github.com/booster-proj/booster/events"
+	"github.com/booster-proj/booster/gateway"
+	"github.com/booster-proj/booster/geoip"
+	"github.com/booster-proj/booster/history"
+	"github.com/booster-proj/booster/influx"
+	"github.com/booster-proj/booster/logging"
+	"github.com/booster-proj/booster/metrics"
+	"github.com/booster-proj/booster/mqtt"
+	"github.com/booster-proj/booster/notify"
+	"github.com/booster-proj/booster/probe"
+	"github.com/booster-proj/booster/publicip"
+	"github.com/booster-proj/booster/relay"
+	"github.com/booster-proj/booster/remote"
+	"github.com/booster-proj/booster/schedule"
+	"github.com/booster-proj/booster/sockopt"
+	"github.com/booster-proj/booster/socks"
+	"github.com/booster-proj/booster/source"
+	"github.com/booster-proj/booster/speedtest"
+	"github.com/booster-proj/booster/store"
+	"github.com/booster-proj/booster/turbo"
+	"github.com/booster-proj/booster/watchdog"
+	"github.com/booster-proj/booster/websocket"
+	"golang.org/x/sync/errgroup"
+	"upspin.io/log"
+)
+
+// Config is the configuration of a Booster. Start from DefaultConfig
+// to obtain the same configuration of the booster command.
+type Config struct {
+	// Version, Commit and BuildTime are displayed by the API.
+	Version   string
+	Commit    string
+	BuildTime string
+
+	// ProxyPort is the listening port of the SOCKS5 proxy. If 0,
+	// the proxy is not started.
+	ProxyPort int
+	// Listeners are additional SOCKS5 proxies, each with its own
+	// policies and strategy, sharing the sources.
+	Listeners []ListenerConfig
+	// ProxyTLSPort, if not 0, is the listening port of the SOCKS5
+	// proxy over TLS, with the certificates of APITLS.
+	ProxyTLSPort int
+	// TunnelPort, if not 0, is the listening port of the WebSocket
+	// tunnel, e.g. 443, carrying the connections of the clients
+	// behind restrictive firewalls to the SOCKS5 proxy.
+	// Only the requests to TunnelPath are upgraded, the others are
+	// replied 404. If TunnelTLS is set, the tunnel is served over
+	// TLS with the certificates of APITLS.
+	TunnelPort int
+	TunnelPath string
+	TunnelTLS  bool
+	// GatewayPort, if not 0, is the listening port of the
+	// transparent proxy, dialing through the sources the connections
+	// redirected to it by the firewall rules of the gateway mode,
+	// see gateway.Rules. Linux only.
+	GatewayPort int
+
+	// APIPort is the listening port of the API, used when
+	// APIListener is nil. If both are not set, the API is not
+	// served, but it is still available through Booster.Handler.
+	APIPort     int
+	APIListener net.Listener
+	// APITokens are the API tokens accepted. If empty, the API does
+	// not require authentication.
+	APITokens []remote.Token
+	// APITLS, if not nil, makes the API be served over TLS.
+	APITLS *remote.TLS
+	// APIRateLimit is the number of requests per second each client
+	// of the API can perform, with bursts of up to APIRateBurst. If
+	// 0, the requests are not limited.
+	APIRateLimit float64
+	APIRateBurst int
+	// APIMaxBodySize is the maximum size in bytes of the bodies of
+	// the API requests. If 0, it is not limited.
+	APIMaxBodySize int64
+	// Dashboard, if set, makes the API serve a web dashboard at
+	// /ui/.
+	Dashboard bool
+	// APIDebug, if set, makes the API serve the pprof profiles and
+	// the runtime diagnostics at /debug/, to the admin tokens only.
+	APIDebug bool
+	// AuditLog is the file the management operations performed
+	// through the API are appended to. If empty, they are only kept
+	// in memory.
+	AuditLog string
+	// WatchdogInterval is the time between two counts of the
+	// goroutines and of the file descriptors, warning when they exceed
+	// WatchdogGoroutines, the threshold of each subsystem in
+	// WatchdogSubsystems, or WatchdogFDs, dumping the goroutines into
+	// WatchdogDumpDir, if set. If 0, the watchdog is disabled.
+	WatchdogInterval   time.Duration
+	WatchdogGoroutines int
+	WatchdogSubsystems map[string]int
+	WatchdogFDs        int
+	WatchdogDumpDir    string
+	// CrashDir, if set, is the directory the reports of the panics
+	// recovered while handling the connections are written to, one
+	// json file each.
+	CrashDir string
+	// Logger, if not nil, allows to inspect and change the log levels
+	// through the API.
+	Logger *logging.Logger
+
+	// TurboPort is the listening port of the turbo HTTP proxy, used
+	// when TurboListener is nil. If both are not set, the turbo proxy
+	// is not started.
+	TurboPort      int
+	TurboListener  net.Listener
+	TurboMinSize   int64
+	TurboSegments  int
+	MatchProcesses bool
+	// TurboTLS makes the turbo proxy be served over TLS, with the
+	// certificates of APITLS, as an HTTPS proxy.
+	TurboTLS bool
+	// ProxyProtocol are the addresses of the load balancers, in CIDR
+	// notation, allowed to send a PROXY protocol header to the turbo
+	// proxy, the SOCKS5 proxies and the tunnel.
+	ProxyProtocol []string
+	// AllowClients and DenyClients are the initial access control
+	// lists of the clients of the proxies, see the acl package.
+	AllowClients []string
+	DenyClients  []string
+	// SchedulesFile, if set, is where the time rules denying the
+	// clients the proxies are saved, see the schedule package.
+	SchedulesFile string
+	// BufferSize is the size of the buffers used to relay data
+	// between connections.
+	BufferSize int
+
+	// Sources configuration, see the flags of the booster command.
+	MultipathTCP     bool
+	EmptyWait        time.Duration
+	SniffPorts       []int
+	SniffTimeout     time.Duration
+	Classify         bool
+	DialTimeout      time.Duration
+	KeepAlive        time.Duration
+	IdleTimeout      time.Duration
+	RaceSources      bool
+	RaceDelay        time.Duration
+	PoolSize         int
+	PoolTTL          time.Duration
+	PoolDestinations int
+	Metered          []string
+	Unmetered        []string
+	PreferUnmetered  bool
+	SaturationConns  int
+	Secondary        []string
+	Backup           []string
+	SourceGroups     []core.SourceGroup
+	// WarmUp is the duration during which the share of the new
+	// connections of a source coming back after a failure grows
+	// gradually to the full one. If 0, it receives it immediately.
+	WarmUp time.Duration
+	// FailbackDelay keeps the new connections away from the sources
+	// coming back after a failure for a stabilization period and, if
+	// FailbackConns is set, until less than FailbackConns connections
+	// are open through the other sources, so that flapping links do
+	// not make the traffic ping-pong.
+	FailbackDelay time.Duration
+	FailbackConns int
+	// ResetOnFailure selects the connections reset as soon as their
+	// source fails, instead of hanging until they time out, so that
+	// the clients reconnect through a healthy source.
+	ResetOnFailure []dialer.ResetRule
+	// Standby enables the hot standby mode: all the traffic goes
+	// through the active source, and the others take over only when it
+	// goes down or, if ProbeInterval is set, fails its probes for
+	// longer than StandbyWindow.
+	Standby       bool
+	StandbyWindow time.Duration
+	// StaticSources are development sources that dial through the
+	// default route, see source.Static.
+	StaticSources []source.StaticConfig
+	// RemoteSources dial through remote SOCKS5 proxies, optionally
+	// announcing the original clients with the PROXY protocol, see
+	// source.Remote.
+	RemoteSources []source.RemoteConfig
+	// GatewaySources are identified by the router their connections
+	// leave through, see source.Gateway.
+	GatewaySources []source.GatewayConfig
+	// Container enables the container mode, which does not require
+	// the NET_RAW and NET_ADMIN capabilities: the interfaces are
+	// inspected through the sysfs mounted at SysFS, leaving out the
+	// virtual ones, and their connections are dialed from their
+	// addresses instead of being bound to their devices.
+	Container bool
+	SysFS     string
+	// Sidecar enables the egress sidecar mode, e.g. in a Kubernetes
+	// pod: each replica balances the egress of its own pod, with no
+	// state shared with the others nor persisted, so that they need
+	// no coordination. It implies the container mode, and rejects the
+	// options persisting state.
+	Sidecar bool
+	// SourceDNS maps the interfaces to the DNS servers that resolve
+	// the host names dialed through them. If DiscoverDNS is set, the
+	// servers of the other interfaces are discovered, e.g. the ones
+	// assigned by DHCP, so that the DNS queries do not leak through
+	// the other links.
+	SourceDNS   map[string][]string
+	DiscoverDNS bool
+	// SourceECS maps the interfaces to the handling of the EDNS
+	// Client Subnet option of their DNS queries, set to a subnet of
+	// their exit network or stripped, so that the answers of the
+	// CDNs suit the location the connections leave from.
+	SourceECS map[string]source.ECS
+	// SourceMarks maps the sources, or groups, to the firewall mark
+	// of their connections, see sockopt.Options.Mark. The fwmark
+	// policies override them.
+	SourceMarks map[string]uint32
+	// DNSCacheSize is the number of DNS answers cached in process,
+	// shared by the dialers of the sources and the bind history. If
+	// 0, the answers are not cached. Their TTLs are clamped to
+	// [DNSCacheMinTTL, DNSCacheMaxTTL].
+	DNSCacheSize   int
+	DNSCacheMinTTL time.Duration
+	DNSCacheMaxTTL time.Duration
+	// LabelsFile, if set, is where the display names and labels
+	// assigned to the sources are saved across restarts.
+	LabelsFile string
+	// DisabledFile, if set, is where the sources disabled through
+	// the API are saved across restarts.
+	DisabledFile string
+	// RecordDecisions is the number of the last source selections
+	// recorded, against which proposed policies can be simulated
+	// through the API. If 0, nothing is recorded.
+	RecordDecisions int
+	// DomainSets are named sets of domains, e.g. "banking", the
+	// sticky policy can be scoped to.
+	DomainSets map[string][]string
+	// BindHistorySize and BindHistoryMemory limit the number of
+	// entries, and their estimated size in bytes, of the bind history
+	// recorded for the sticky policy. If 0, they are not limited.
+	BindHistorySize   int
+	BindHistoryMemory int64
+
+	// GeoIPDBs are the database files used by the geo policies. If
+	// empty, the geo policies are not available.
+	GeoIPDBs    []string
+	GeoIPReload time.Duration
+
+	// Blocklists are the lists of the destinations refused. If
+	// empty, every destination is allowed.
+	Blocklists       []blocklist.Source
+	BlocklistRefresh time.Duration
+
+	// Strategy is either round-robin, weighted, latency, bandwidth,
+	// hash or plugin:<name>. If empty, round-robin is used.
+	Strategy string
+	// HashClient, if set, makes the hash strategy hash the address
+	// of the client, when known, together with the destination.
+	HashClient    bool
+	ProbeAnchor   string
+	ProbeInterval time.Duration
+	// ProtocolStrategies maps the protocols, see the protocol
+	// package, to the strategies used for their connections in place
+	// of Strategy, e.g. ssh to latency. If not empty, the connections
+	// are classified even if Classify is not set.
+	ProtocolStrategies map[string]string
+
+	// PluginsDir, if set, is the directory the WebAssembly plugins
+	// are loaded from.
+	PluginsDir string
+
+	SpeedtestURL      string
+	SpeedtestToken    string
+	SpeedtestDuration time.Duration
+	SpeedtestInterval time.Duration
+
+	// PublicIPInterval, if set, is the interval between the
+	// detections of the public address of each source, asking
+	// PublicIPServers, see the publicip package.
+	PublicIPInterval time.Duration
+	PublicIPServers  []string
+	// DDNS are the dynamic DNS records following the public IP of
+	// their source. If set, the public IPs are detected even if
+	// PublicIPInterval is not, every publicip.DefaultInterval.
+	DDNS []ddns.Record
+
+	// HistoryDir, if set, is the directory where the per source
+	// metrics history is stored.
+	HistoryDir       string
+	HistoryRetention time.Duration
+	HistoryInterval  time.Duration
+	// ReportPeriod, if set, is the period of the usage reports
+	// produced from the history, either daily or weekly. If
+	// ReportMail is set, they are sent by email as the
+	// notifications are.
+	ReportPeriod string
+	ReportMail   bool
+
+	// InfluxURL, if set, is where the per source metrics are pushed.
+	InfluxURL      string
+	InfluxToken    string
+	InfluxTags     map[string]string
+	InfluxInterval time.Duration
+
+	// The events are notified to the webhooks in NotifyWebhooks, by
+	// email to NotifyMailTo if NotifySMTP is set, and as desktop
+	// notifications if NotifyDesktop is set. If NotifyTopics is
+	// empty, every event is notified.
+	NotifyWebhooks     []string
+	NotifySMTP         string
+	NotifySMTPUser     string
+	NotifySMTPPassword string
+	NotifyMailFrom     string
+	NotifyMailTo       []string
+	NotifyDesktop      bool
+	NotifyTopics       []string
+	NotifyCooldown     time.Duration
+
+	// MQTTBroker, if set, is the broker the events are published to,
+	// under MQTTPrefix. If MQTTConnEvents is set, the events of each
+	// connection opened and closed are published as well.
+	MQTTBroker     string
+	MQTTClientID   string
+	MQTTUser       string
+	MQTTPassword   string
+	MQTTPrefix     string
+	MQTTConnEvents bool
+}
+
+// ListenerConfig describes an additional SOCKS5 proxy, e.g. one
+// forcing the VPN source next to the one balancing everything. Its
+// connections are subject to its Policies, in the language of the
+// expression policies, in place of the ones of the store, and are
+// assigned a source with its Strategy or, if empty, with the one of
+// the store. See store.Scope.
+type ListenerConfig struct {
+	Name     string   `json:"name"`
+	Port     int      `json:"port"`
+	Strategy string   `json:"strategy,omitempty"`
+	Policies []string `json:"policies,omitempty"`
+}
+
+// DefaultConfig is the configuration used by the booster command when
+// no flag is provided.
+var DefaultConfig = Config{
+	ProxyPort:         1080,
+	APIPort:           7764,
+	APIRateLimit:      remote.DefaultRateLimit,
+	APIRateBurst:      remote.DefaultRateBurst,
+	APIMaxBodySize:    remote.DefaultMaxBodySize,
+	Dashboard:         true,
+	SysFS:             source.DefaultSysFS,
+	WatchdogInterval:  watchdog.DefaultInterval,
+	BindHistorySize:   store.DefaultBindHistorySize,
+	BindHistoryMemory: store.DefaultBindHistoryMemory,
+	WarmUp:            store.DefaultWarmUp,
+	StandbyWindow:     store.DefaultStandbyWindow,
+	DiscoverDNS:       true,
+	DNSCacheSize:      dnscache.DefaultSize,
+	DNSCacheMinTTL:    dnscache.DefaultMinTTL,
+	DNSCacheMaxTTL:    dnscache.DefaultMaxTTL,
+	TurboMinSize:      turbo.DefaultMinSize,
+	TurboSegments:     turbo.DefaultSegments,
+	BufferSize:        relay.DefaultBufferSize,
+	SniffTimeout:      dialer.DefaultSniffTimeout,
+	RaceDelay:         dialer.DefaultRaceDelay,
+	PoolTTL:           dialer.DefaultPoolTTL,
+	PoolDestinations:  dialer.DefaultPoolDestinations,
+	GeoIPReload:       geoip.DefaultReloadInterval,
+	BlocklistRefresh:  blocklist.DefaultRefreshInterval,
+	Strategy:          "round-robin",
+	ProbeAnchor:       probe.DefaultAnchor,
+	ProbeInterval:     probe.DefaultInterval,
+	SpeedtestURL:      speedtest.DefaultURL,
+	SpeedtestDuration: speedtest.DefaultDuration,
+	PublicIPServers:   publicip.DefaultServers,
+	HistoryRetention:  history.DefaultRetention,
+	HistoryInterval:   history.DefaultInterval,
+	InfluxInterval:    influx.DefaultInterval,
+	NotifyCooldown:    notify.DefaultCooldown,
+	MQTTClientID:      "booster",
+	MQTTPrefix:        mqtt.DefaultPrefix,
+}
+
+// Booster is a booster instance, built with New.
+type Booster struct {
+	conf Config
+
+	proxy    *socks.Proxy
+	store    *store.SourceStore
+	listener *source.Listener
+	dialer   *dialer.Dialer
+	prober   *probe.Prober
+	tester   *speedtest.Tester
+	publicIP *publicip.Detector
+	ddns     *ddns.Updater
+	geo      *geoip.DB
+	blocks   *blocklist.Filter
+	recorder *history.Recorder
+	reporter *history.Reporter
+	journal  *history.Journal
+	dns      *dnscache.Cache
+	sink     *influx.Sink
+	notifier *notify.Dispatcher
+	mqtt     *mqtt.Publisher
+	router   *remote.Router
+	remote   *remote.Remote
+	turbo    *turbo.Proxy
+	acl      *acl.List
+	sched    *schedule.Schedules
+	watchdog *watchdog.Watchdog
+
+	// listeners are the proxies of Config.Listeners, in order.
+	listeners []*socks.Proxy
+	proxyTLS  *tls.Config
+	tunnel    *websocket.Server
+	gateway   *gateway.Proxy
+	// stopping is set by Stop.
+	stopping int32
+}
+
+// New builds a Booster from `c`. No connection is accepted and no
+// source is discovered until Run is called.
+func New(c Config) (*Booster, error) {
+	if c.Sidecar {
+		if err := c.stateless(); err != nil {
+			return nil, err
+		}
+		c.Container = true
+	}
+	bst := &Booster{conf: c}
+
+	bus := new(events.Bus)
+	b := new(core.Balancer)
+	rs := store.New(b)
+	rs.Events = bus
+	rs.PreferUnmetered = c.PreferUnmetered
+	rs.SaturationConns = c.SaturationConns
+	rs.WarmUp = c.WarmUp
+	rs.FailbackDelay = c.FailbackDelay
+	rs.FailbackConns = c.FailbackConns
+	rs.Standby = c.Standby
+	rs.StandbyWindow = c.StandbyWindow
+	var err error
+	if rs.Scopes, err = scopes(rs, c.Listeners); err != nil {
+		return nil, err
+	}
+	rs.LabelsFile = c.LabelsFile
+	rs.DisabledFile = c.DisabledFile
+	rs.RecordDecisions = c.RecordDecisions
+	rs.DomainSets = c.DomainSets
+	rs.BindHistorySize = c.BindHistorySize
+	rs.BindHistoryMemory = c.BindHistoryMemory
+	if err := rs.LoadDisabled(); err != nil {
+		return nil, err
+	}
+	for _, g := range c.SourceGroups {
+		if err := rs.PutGroup(g); err != nil {
+			return nil, err
+		}
+	}
+	for _, v := range c.Metered {
+		rs.SetMetered(v, true)
+	}
+	for _, v := range c.Unmetered {
+		rs.SetMetered(v, false)
+	}
+	for _, v := range c.Secondary {
+		rs.SetTier(v, store.TierSecondary)
+	}
+	for _, v := range c.Backup {
+		rs.SetTier(v, store.TierBackup)
+	}
+	for id, mark := range c.SourceMarks {
+		if err := rs.SetTCPOptions(id, sockopt.Options{Mark: mark}); err != nil {
+			return nil, fmt.Errorf("%v, use --source-fwmark", err)
+		}
+	}
+	bst.store = rs
+
+	// Record the metrics history and push them to InfluxDB, if
+	// required.
+	exp := metrics.New()
+	rs.LabelsExporter = exp
+	rs.StatusExporter = exp
+	if c.DNSCacheSize > 0 {
+		bst.dns = &dnscache.Cache{
+			MinTTL:          c.DNSCacheMinTTL,
+			MaxTTL:          c.DNSCacheMaxTTL,
+			Size:            c.DNSCacheSize,
+			MetricsExporter: exp,
+		}
+		rs.Resolver = bst.dns.Resolver("", nil)
+	}
+	if err := rs.LoadLabels(); err != nil {
+		return nil, err
+	}
+	var sexp history.Exporter = exp
+	var db *history.DB
+	if c.HistoryDir != "" {
+		if db, err = history.Open(c.HistoryDir, c.HistoryRetention); err != nil {
+			return nil, err
+		}
+		bst.recorder = &history.Recorder{DB: db, Next: sexp, Interval: c.HistoryInterval}
+		sexp = bst.recorder
+	}
+	// The outages of the sources are recorded together with the
+	// metrics history, if any, and in memory otherwise.
+	bst.journal = &history.Journal{Bus: bus, Retention: c.HistoryRetention}
+	if c.HistoryDir != "" {
+		bst.journal.File = filepath.Join(c.HistoryDir, "journal.jsonl")
+	}
+	if err := bst.journal.Load(time.Now()); err != nil {
+		return nil, err
+	}
+	if c.InfluxURL != "" {
+		bst.sink = &influx.Sink{URL: c.InfluxURL, Token: c.InfluxToken, Interval: c.InfluxInterval, Tags: c.InfluxTags, Next: sexp}
+		sexp = bst.sink
+	}
+
+	if c.ProbeInterval > 0 {
+		bst.prober = &probe.Prober{
+			Store:    rs,
+			Anchor:   c.ProbeAnchor,
+			Interval: c.ProbeInterval,
+			Exporter: sexp,
+		}
+		rs.Health = bst.prober
+	}
+	bst.tester = &speedtest.Tester{
+		Store:    rs,
+		URL:      c.SpeedtestURL,
+		Token:    c.SpeedtestToken,
+		Duration: c.SpeedtestDuration,
+		Interval: c.SpeedtestInterval,
+	}
+	if len(c.DDNS) > 0 && c.PublicIPInterval <= 0 {
+		c.PublicIPInterval = publicip.DefaultInterval
+	}
+	if c.PublicIPInterval > 0 {
+		bst.publicIP = &publicip.Detector{
+			Store:    rs,
+			Servers:  c.PublicIPServers,
+			Interval: c.PublicIPInterval,
+		}
+	}
+	if len(c.DDNS) > 0 {
+		bst.ddns = &ddns.Updater{Bus: bus, Store: rs, Records: c.DDNS}
+	}
+	if b.Strategy, err = bst.strategy(); err != nil {
+		return nil, err
+	}
+
+	if c.MultipathTCP && !source.MPTCPAvailable() {
+		log.Error.Printf("MultiPath TCP is not available on this system, falling back to plain TCP")
+	}
+	var sysfs string
+	if c.Container {
+		sysfs = c.SysFS
+	} else if source.InContainer() {
+		log.Info.Printf("Running in a container: consider the container mode, if the interfaces cannot be bound to")
+	}
+	bst.listener = source.NewListener(source.Config{
+		Store:           rs,
+		MetricsExporter: sexp,
+		DialErrExporter: exp,
+		MultipathTCP:    c.MultipathTCP,
+		BindAddress:     c.Container,
+		SysFS:           sysfs,
+		DNS:             c.SourceDNS,
+		DiscoverDNS:     c.DiscoverDNS,
+		DNSCache:        bst.dns,
+		ECS:             c.SourceECS,
+		Static:          c.StaticSources,
+		Remote:          c.RemoteSources,
+		Gateway:         c.GatewaySources,
+	})
+	crashes := &crash.Reporter{Dir: c.CrashDir, MetricsExporter: exp, Events: bus}
+	d := dialer.New(rs)
+	d.Crashes = crashes
+	d.EmptyWait = c.EmptyWait
+	d.SniffPorts = c.SniffPorts
+	d.SniffTimeout = c.SniffTimeout
+	d.Classify = c.Classify || len(c.ProtocolStrategies) > 0
+	d.DialTimeout = c.DialTimeout
+	d.KeepAlive = c.KeepAlive
+	d.IdleTimeout = c.IdleTimeout
+	d.Race = c.RaceSources
+	d.RaceDelay = c.RaceDelay
+	d.PoolSize = c.PoolSize
+	d.PoolTTL = c.PoolTTL
+	d.PoolDestinations = c.PoolDestinations
+	d.ResetOnFailure = c.ResetOnFailure
+	d.Events = bus
+	// The events of the connections are streamed by the API.
+	d.ConnEvents = new(events.Bus)
+	if bst.recorder != nil {
+		d.Usage = bst.recorder
+	}
+	d.SetMetricsExporter(exp)
+	bst.dialer = d
+
+	var notifiers []notify.Notifier
+	for _, v := range c.NotifyWebhooks {
+		notifiers = append(notifiers, &notify.Webhook{URL: v})
+	}
+	var mail *notify.Mail
+	if c.NotifySMTP != "" {
+		mail = &notify.Mail{
+			Addr:     c.NotifySMTP,
+			Username: c.NotifySMTPUser,
+			Password: c.NotifySMTPPassword,
+			From:     c.NotifyMailFrom,
+			To:       c.NotifyMailTo,
+		}
+		notifiers = append(notifiers, mail)
+	}
+	if c.NotifyDesktop {
+		notifiers = append(notifiers, notify.Desktop{})
+	}
+	if c.ReportPeriod != "" {
+		if db == nil {
+			return nil, fmt.Errorf("reports require the metrics history, use --history-dir")
+		}
+		if _, err := history.PeriodStart(c.ReportPeriod, time.Now()); err != nil {
+			return nil, err
+		}
+		bst.reporter = &history.Reporter{DB: db, Period: c.ReportPeriod}
+		if c.ReportMail {
+			if mail == nil {
+				return nil, fmt.Errorf("mailing the reports requires an SMTP server, use --notify-smtp")
+			}
+			bst.reporter.Mailer = mail
+		}
+	}
+	if c.MQTTBroker != "" {
+		bst.mqtt = &mqtt.Publisher{
+			Broker: c.MQTTBroker,
+			Options: mqtt.Options{
+				ClientID: c.MQTTClientID,
+				Username: c.MQTTUser,
+				Password: c.MQTTPassword,
+			},
+			Prefix: c.MQTTPrefix,
+			Buses:  []*events.Bus{bus},
+		}
+		if c.MQTTConnEvents {
+			bst.mqtt.Buses = append(bst.mqtt.Buses, d.ConnEvents)
+		}
+	}
+	if len(notifiers) > 0 {
+		bst.notifier = &notify.Dispatcher{
+			Bus:       bus,
+			Notifiers: notifiers,
+			Topics:    c.NotifyTopics,
+			Cooldown:  c.NotifyCooldown,
+		}
+	}
+
+	if c.WatchdogInterval > 0 {
+		bst.watchdog = &watchdog.Watchdog{
+			Interval:      c.WatchdogInterval,
+			MaxGoroutines: c.WatchdogGoroutines,
+			Subsystems:    c.WatchdogSubsystems,
+			MaxFDs:        c.WatchdogFDs,
+			DumpDir:       c.WatchdogDumpDir,
+			Events:        bus,
+		}
+	}
+	if len(c.GeoIPDBs) > 0 {
+		if bst.geo, err = geoip.Open(c.GeoIPDBs...); err != nil {
+			return nil, err
+		}
+		bst.geo.ReloadInterval = c.GeoIPReload
+	}
+	if len(c.Blocklists) > 0 {
+		if bst.blocks, err = blocklist.New(c.Blocklists...); err != nil {
+			return nil, fmt.Errorf("%v, use --blocklist", err)
+		}
+		bst.blocks.RefreshInterval = c.BlocklistRefresh
+		d.Blocker = bst.blocks
+	}
+
+	if err := bst.initClientRules(); err != nil {
+		return nil, err
+	}
+	if err := bst.initProxies(exp, crashes); err != nil {
+		return nil, err
+	}
+	if err := bst.initAPI(exp, db); err != nil {
+		return nil, err
+	}
+	return bst, nil
+}
+
+// stateless returns an error if `c` persists any state, which the
+// sidecar mode does not allow.
+func (c Config) stateless() error {
+	var opts []string
+	for name, v := range map[string]string{
+		"--history-dir":    c.HistoryDir,
+		"--labels-file":    c.LabelsFile,
+		"--disabled-file":  c.DisabledFile,
+		"--schedules-file": c.SchedulesFile,
+	} {
+		if v != "" {
+			opts = append(opts, name)
+		}
+	}
+	if len(opts) > 0 {
+		sort.Strings(opts)
+		return fmt.Errorf("the sidecar mode is stateless, remove %s", strings.Join(opts, ", "))
+	}
+	return nil
+}
+
+// Stop makes the readiness check fail, so that no new traffic is sent
+// to booster, which keeps serving the connections until Run returns.
+func (bst *Booster) Stop() {
+	atomic.StoreInt32(&bst.stopping, 1)
+}
+
+// handleFailures resets the connections of the sources that go down,
+// as selected by ResetOnFailure, and pools the ones pooled through them
+// again through the other sources, until `ctx` is canceled.
+func (bst *Booster) handleFailures(ctx context.Context) error {
+	c, cancel := bst.dialer.Events.Subscribe(64)
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e := <-c:
+			if e.Topic != events.TopicSourceDown {
+				continue
+			}
+			if src, ok := e.Data.(*store.DummySource); ok {
+				if n := bst.dialer.Reset(src.ID); n > 0 {
+					log.Info.Printf("Reset %d connections of source %v", n, src.ID)
+				}
+				if n := bst.dialer.Redial(src.ID); n > 0 {
+					log.Info.Printf("Pooling %d connections of source %v through the other sources", n, src.ID)
+				}
+			}
+		}
+	}
+}
+
+// Store returns the source store of the Booster, which allows to
+// inspect the sources and to manage the policies.
+func (bst *Booster) Store() *store.SourceStore {
+	return bst.store
+}
+
+// Dialer returns the dialer used by the proxies, which dials the
+// connections through the sources of the Booster.
+func (bst *Booster) Dialer() *dialer.Dialer {
+	return bst.dialer
+}
+
+// Handler returns the HTTP handler of the API, e.g. to serve it from
+// an existing HTTP server.
+func (bst *Booster) Handler() http.Handler {
+	return bst.router
+}
+
+// Run discovers the sources and serves the proxies and the API,
+// returning when `ctx` is canceled or any of them fails.
+func (bst *Booster) Run(ctx context.Context) error {
+	c := bst.conf
+	g, ctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		// Interrupt the transfers in progress as soon as booster
+		// is stopped, without waiting for them to time out.
+		<-ctx.Done()
+		return bst.dialer.Close()
+	})
+	g.Go(labeled(ctx, "listener", func() error {
+		log.Info.Printf("Listener started")
+		defer log.Info.Printf("Listener stopped.")
+		return bst.listener.Run(ctx)
+	}))
+	if prober := bst.prober; prober != nil {
+		g.Go(labeled(ctx, "prober", func() error {
+			log.Info.Printf("Prober started, anchor: %v", c.ProbeAnchor)
+			defer log.Info.Printf("Prober stopped.")
+			return prober.Run(ctx)
+		}))
+	}
+	if geo := bst.geo; geo != nil {
+		g.Go(func() error {
+			log.Info.Printf("GeoIP databases loaded: %v", c.GeoIPDBs)
+			return geo.Run(ctx)
+		})
+	}
+	if f := bst.blocks; f != nil {
+		g.Go(func() error {
+			log.Info.Printf("Blocklists loaded every %v", f.RefreshInterval)
+			return f.Run(ctx)
+		})
+	}
+	if rec := bst.recorder; rec != nil {
+		g.Go(func() error {
+			log.Info.Printf("Recording metrics history into %v", c.HistoryDir)
+			return rec.Run(ctx)
+		})
+	}
+	g.Go(func() error {
+		return bst.journal.Run(ctx)
+	})
+	if w := bst.watchdog; w != nil {
+		g.Go(func() error {
+			log.Info.Printf("Watchdog checking the goroutines and the file descriptors every %v", c.WatchdogInterval)
+			return w.Run(ctx)
+		})
+	}
+	if len(c.ResetOnFailure) > 0 || c.PoolSize > 0 {
+		g.Go(func() error {
+			return bst.handleFailures(ctx)
+		})
+	}
+	if rep := bst.reporter; rep != nil {
+		g.Go(func() error {
+			log.Info.Printf("Producing %v usage reports", c.ReportPeriod)
+			return rep.Run(ctx)
+		})
+	}
+	if sink := bst.sink; sink != nil {
+		g.Go(func() error {
+			log.Info.Printf("Pushing metrics to %v", c.InfluxURL)
+			return sink.Run(ctx)
+		})
+	}
+	if n := bst.notifier; n != nil {
+		g.Go(func() error {
+			log.Info.Printf("Notifying events, topics: %v", c.NotifyTopics)
+			return n.Run(ctx)
+		})
+	}
+	if p := bst.mqtt; p != nil {
+		g.Go(func() error {
+			log.Info.Printf("Publishing events to %v", c.MQTTBroker)
+			return p.Run(ctx)
+		})
+	}
+	if c.SpeedtestInterval > 0 {
+		g.Go(func() error {
+			log.Info.Printf("Running speed tests every %v", c.SpeedtestInterval)
+			return bst.tester.Run(ctx)
+		})
+	}
+	if d := bst.publicIP; d != nil {
+		g.Go(func() error {
+			log.Info.Printf("Detecting the public IP of the sources every %v", d.Interval)
+			return d.Run(ctx)
+		})
+	}
+	if u := bst.ddns; u != nil {
+		g.Go(func() error {
+			log.Info.Printf("Updating %d dynamic DNS records", len(u.Records))
+			return u.Run(ctx)
+		})
+	}
+	bst.serveProxies(ctx, g)
+	bst.serveAPI(ctx, g)
+
+	return g.Wait()
+}
+
+// labeled makes the watchdog count the goroutines started by `f` as
+// the ones of `subsystem`.
+func labeled(ctx context.Context, subsystem string, f func() error) func() error {
+	return func() error {
+		return watchdog.Do(ctx, subsystem, func(context.Context) error { return f() })
+	}
+}
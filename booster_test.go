@@ -0,0 +1,173 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package booster_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster"
+	"github.com/booster-proj/booster/remote"
+)
+
+func TestNew(t *testing.T) {
+	c := booster.DefaultConfig
+	c.ProxyPort, c.APIPort = 0, 0
+	c.ProbeInterval = 0
+	c.Version = "test"
+
+	// Instances do not share any state.
+	b0, err := booster.New(c)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	b1, err := booster.New(c)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if b0.Store() == b1.Store() {
+		t.Fatalf("Instances should not share the same store")
+	}
+
+	w := httptest.NewRecorder()
+	b0.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/health.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected health check status: %d", w.Code)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c0 := make(chan error, 1)
+	go func() {
+		c0 <- b0.Run(ctx)
+	}()
+	cancel()
+	select {
+	case <-c0:
+	case <-time.After(time.Second):
+		t.Fatalf("Run did not return after the context was canceled")
+	}
+}
+
+func TestNew_invalid(t *testing.T) {
+	c := booster.DefaultConfig
+	c.Strategy = "random"
+	if _, err := booster.New(c); err == nil {
+		t.Fatalf("Unknown strategies should be rejected")
+	}
+
+	c = booster.DefaultConfig
+	c.Strategy, c.ProbeInterval = "latency", 0
+	if _, err := booster.New(c); err == nil {
+		t.Fatalf("The latency strategy should require probing")
+	}
+
+	c = booster.DefaultConfig
+	c.APIPort, c.ProbeInterval, c.ProxyTLSPort = 0, 0, 1443
+	if _, err := booster.New(c); err == nil {
+		t.Fatalf("The proxies over TLS should require the TLS configuration of the API")
+	}
+
+	c = booster.DefaultConfig
+	c.APIPort, c.ProbeInterval, c.TunnelPort = 0, 0, 8443
+	if _, err := booster.New(c); err == nil {
+		t.Fatalf("The tunnel should require a path")
+	}
+
+	c = booster.DefaultConfig
+	c.APIPort, c.ProbeInterval, c.APIDebug = 0, 0, true
+	c.APITokens = []remote.Token{{Name: "viewer", Role: remote.RoleViewer, Secret: "s"}}
+	if _, err := booster.New(c); err == nil {
+		t.Fatalf("The diagnostics should require an admin token")
+	}
+	c.APITokens = append(c.APITokens, remote.Token{Name: "admin", Role: remote.RoleAdmin, Secret: "t"})
+	if _, err := booster.New(c); err != nil {
+		t.Fatalf("Unexpected error with an admin token: %v", err)
+	}
+}
+
+func TestNew_clientRules(t *testing.T) {
+	c := booster.DefaultConfig
+	c.APIPort, c.ProbeInterval = 0, 0
+	c.AllowClients, c.DenyClients = []string{"10.0.0.0/8"}, []string{"10.0.0.2"}
+	b, err := booster.New(c)
+	if err != nil {
+		t.Fatalf("Unexpected error with the client access lists: %v", err)
+	}
+	// The rules are managed through the API together with the
+	// SOCKS5 proxy.
+	for _, v := range []string{"/acl.json", "/schedules.json"} {
+		w := httptest.NewRecorder()
+		b.Handler().ServeHTTP(w, httptest.NewRequest("GET", v, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Unexpected status of %v: %d", v, w.Code)
+		}
+	}
+
+	c.DenyClients = []string{"10.0.0.300"}
+	if _, err := booster.New(c); err == nil {
+		t.Fatalf("Invalid access lists should be refused")
+	}
+}
+
+func TestNew_proxyProtocol(t *testing.T) {
+	c := booster.DefaultConfig
+	c.APIPort, c.ProbeInterval = 0, 0
+	c.ProxyProtocol = []string{"10.0.0.1"}
+	if _, err := booster.New(c); err != nil {
+		t.Fatalf("Unexpected error with the PROXY protocol: %v", err)
+	}
+	c.ProxyProtocol = []string{"10.0.0.0/33"}
+	if _, err := booster.New(c); err == nil {
+		t.Fatalf("Invalid load balancer networks should be refused")
+	}
+}
+
+func TestNew_sidecar(t *testing.T) {
+	c := booster.DefaultConfig
+	c.ProxyPort, c.APIPort = 0, 0
+	c.ProbeInterval = 0
+	c.Sidecar = true
+	c.LabelsFile = "labels.json"
+	if _, err := booster.New(c); err == nil {
+		t.Fatalf("The sidecar mode should reject the options persisting state")
+	}
+
+	c.LabelsFile = ""
+	b, err := booster.New(c)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	stopping := func() string {
+		w := httptest.NewRecorder()
+		b.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+		var report remote.HealthReport
+		if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		return report.Checks["stopping"].Status
+	}
+	if status := stopping(); status != remote.StatusOK {
+		t.Fatalf("Unexpected stopping check status before Stop: %q", status)
+	}
+	b.Stop()
+	if status := stopping(); status != remote.StatusFail {
+		t.Fatalf("Unexpected stopping check status after Stop: %q", status)
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package chaos injects faults into sources, making a fraction of
+// their dials and transfers fail, hang or slow down. Use it to verify
+// that failover, health checks and stickiness behave as expected when
+// sources misbehave.
+package chaos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+)
+
+// ErrInjected is returned by the operations that fail because of a
+// fault injected.
+var ErrInjected = errors.New("chaos: fault injected")
+
+// Faults describes the faults injected into a source. The ratios are
+// in the range [0, 1].
+type Faults struct {
+	// DialError is the ratio of dials that fail with ErrInjected.
+	DialError float64 `json:"dial_error,omitempty"`
+	// DialDrop is the ratio of dials that never complete, until the
+	// context is canceled.
+	DialDrop float64 `json:"dial_drop,omitempty"`
+	// DialDelay is added to every dial.
+	DialDelay time.Duration `json:"dial_delay,omitempty"`
+	// TransferError is the ratio of reads and writes that fail with
+	// ErrInjected, closing the connection.
+	TransferError float64 `json:"transfer_error,omitempty"`
+	// TransferDelay is added to every read.
+	TransferDelay time.Duration `json:"transfer_delay,omitempty"`
+}
+
+// ParseFaults parses faults in the form `key=value,key=value`, e.g.
+// `dial-error=0.2,transfer-delay=10ms`. The keys are dial-error,
+// dial-drop, dial-delay, transfer-error and transfer-delay.
+func ParseFaults(s string) (Faults, error) {
+	var f Faults
+	for _, v := range strings.Split(s, ",") {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 {
+			return f, fmt.Errorf("chaos: invalid fault %q, expected key=value", v)
+		}
+		var err error
+		switch k, val := kv[0], kv[1]; k {
+		case "dial-error":
+			f.DialError, err = parseRatio(val)
+		case "dial-drop":
+			f.DialDrop, err = parseRatio(val)
+		case "dial-delay":
+			f.DialDelay, err = time.ParseDuration(val)
+		case "transfer-error":
+			f.TransferError, err = parseRatio(val)
+		case "transfer-delay":
+			f.TransferDelay, err = time.ParseDuration(val)
+		default:
+			err = fmt.Errorf("unknown fault %q", k)
+		}
+		if err != nil {
+			return f, fmt.Errorf("chaos: %s: %v", v, err)
+		}
+	}
+	return f, nil
+}
+
+func parseRatio(s string) (float64, error) {
+	r, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if r < 0 || r > 1 {
+		return 0, fmt.Errorf("ratio %v out of range [0, 1]", r)
+	}
+	return r, nil
+}
+
+// Stats counts the faults injected by a Source.
+type Stats struct {
+	Dials          int `json:"dials"`
+	DialErrors     int `json:"dial_errors"`
+	DialDrops      int `json:"dial_drops"`
+	TransferErrors int `json:"transfer_errors"`
+}
+
+// Source is a core.Source that injects Faults into the source it
+// wraps. Create it with New.
+type Source struct {
+	core.Source
+	Faults Faults
+
+	mux   sync.Mutex
+	rnd   *rand.Rand
+	stats Stats
+}
+
+// New returns a Source that injects `f` into `src`. The faults are
+// chosen using a pseudo random generator initialized with `seed`, so
+// that runs with the same seed inject the same faults.
+func New(src core.Source, f Faults, seed int64) *Source {
+	return &Source{
+		Source: src,
+		Faults: f,
+		rnd:    rand.New(rand.NewSource(seed)),
+	}
+}
+
+// roll reports whether an event that happens with probability `p`
+// occurred.
+func (s *Source) roll(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.rnd.Float64() < p
+}
+
+func (s *Source) count(f func(*Stats)) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	f(&s.stats)
+}
+
+// Stats returns the faults injected so far.
+func (s *Source) Stats() Stats {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.stats
+}
+
+// DialContext implements core.Source.
+func (s *Source) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	s.count(func(st *Stats) { st.Dials++ })
+	if d := s.Faults.DialDelay; d > 0 {
+		if err := sleep(ctx, d); err != nil {
+			return nil, err
+		}
+	}
+	if s.roll(s.Faults.DialDrop) {
+		s.count(func(st *Stats) { st.DialDrops++ })
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if s.roll(s.Faults.DialError) {
+		s.count(func(st *Stats) { st.DialErrors++ })
+		return nil, ErrInjected
+	}
+
+	c, err := s.Source.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	if s.Faults.TransferError <= 0 && s.Faults.TransferDelay <= 0 {
+		return c, nil
+	}
+	return &conn{Conn: c, s: s}, nil
+}
+
+// String returns the identifier of the source, marking it as faulty.
+func (s *Source) String() string {
+	return fmt.Sprintf("%s (chaos)", s.ID())
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// conn injects the transfer faults of its source.
+type conn struct {
+	net.Conn
+	s *Source
+}
+
+func (c *conn) fail() error {
+	c.s.count(func(st *Stats) { st.TransferErrors++ })
+	c.Conn.Close()
+	return ErrInjected
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	if d := c.s.Faults.TransferDelay; d > 0 {
+		time.Sleep(d)
+	}
+	if c.s.roll(c.s.Faults.TransferError) {
+		return 0, c.fail()
+	}
+	return c.Conn.Read(p)
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	if c.s.roll(c.s.Faults.TransferError) {
+		return 0, c.fail()
+	}
+	return c.Conn.Write(p)
+}
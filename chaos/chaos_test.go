@@ -0,0 +1,116 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package chaos_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/chaos"
+)
+
+// source dials connections returning one end of a pipe.
+type source struct{}
+
+func (source) ID() string     { return "s0" }
+func (source) Close() error   { return nil }
+func (source) String() string { return "s0" }
+
+func (source) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	c, _ := net.Pipe()
+	return c, nil
+}
+
+func TestParseFaults(t *testing.T) {
+	f, err := chaos.ParseFaults("dial-error=0.2,dial-drop=0.1,dial-delay=5ms,transfer-error=1,transfer-delay=1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := chaos.Faults{
+		DialError:     0.2,
+		DialDrop:      0.1,
+		DialDelay:     time.Millisecond * 5,
+		TransferError: 1,
+		TransferDelay: time.Second,
+	}
+	if f != want {
+		t.Fatalf("Unexpected faults: wanted %+v, found %+v", want, f)
+	}
+
+	for _, v := range []string{"", "dial-error", "dial-error=2", "dial-delay=x", "foo=1"} {
+		if _, err := chaos.ParseFaults(v); err == nil {
+			t.Fatalf("ParseFaults(%q) did not fail", v)
+		}
+	}
+}
+
+func TestSource_dial(t *testing.T) {
+	s := chaos.New(source{}, chaos.Faults{DialError: 1}, 0)
+	if _, err := s.DialContext(context.Background(), "tcp", "host:80"); err != chaos.ErrInjected {
+		t.Fatalf("Unexpected error: wanted %v, found %v", chaos.ErrInjected, err)
+	}
+
+	s = chaos.New(source{}, chaos.Faults{DialDrop: 1}, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	if _, err := s.DialContext(ctx, "tcp", "host:80"); err != context.DeadlineExceeded {
+		t.Fatalf("Unexpected error: wanted %v, found %v", context.DeadlineExceeded, err)
+	}
+	if st := s.Stats(); st.Dials != 1 || st.DialDrops != 1 {
+		t.Fatalf("Unexpected stats: %+v", st)
+	}
+}
+
+func TestSource_transfer(t *testing.T) {
+	s := chaos.New(source{}, chaos.Faults{TransferError: 1}, 0)
+	conn, err := s.DialContext(context.Background(), "tcp", "host:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("hello")); err != chaos.ErrInjected {
+		t.Fatalf("Unexpected error: wanted %v, found %v", chaos.ErrInjected, err)
+	}
+	if st := s.Stats(); st.TransferErrors != 1 {
+		t.Fatalf("Unexpected stats: %+v", st)
+	}
+}
+
+func TestSource_seed(t *testing.T) {
+	dial := func() []bool {
+		s := chaos.New(source{}, chaos.Faults{DialError: 0.5}, 42)
+		acc := make([]bool, 100)
+		for i := range acc {
+			_, err := s.DialContext(context.Background(), "tcp", "host:80")
+			acc[i] = err == nil
+		}
+		return acc
+	}
+	a, b := dial(), dial()
+	var ok int
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("%d: Runs with the same seed injected different faults", i)
+		}
+		if a[i] {
+			ok++
+		}
+	}
+	if ok == 0 || ok == len(a) {
+		t.Fatalf("Unexpected successful dials: %d out of %d", ok, len(a))
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/booster-proj/booster/store/bench"
+	"github.com/spf13/cobra"
+	"upspin.io/log"
+)
+
+var (
+	benchConfig bench.Config
+	benchJSON   bool
+)
+
+// benchCmd represents the bench command
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Measure the performance of booster's source store",
+	Long: `Bench fills a source store with synthetic sources and policies, and measures
+how source retrieval, policy evaluation and source replacement perform under load.
+Use it to verify performance changes or to size a deployment.
+
+No baseline is published, as the results depend on the machine: run the same
+configurations before and after a change, on the same machine, and compare them.
+The reference configurations are:
+
+  booster bench --policies 0
+  booster bench
+  booster bench --sources 16 --policies 32 --targets 64 --concurrency 32 --iterations 5000
+  booster bench --churn`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		captureSignals(cancel)
+
+		res, err := bench.Run(ctx, benchConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if benchJSON {
+			json.NewEncoder(os.Stdout).Encode(res)
+			return
+		}
+		res.Fprint(os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(benchCmd)
+
+	d := bench.DefaultConfig
+	benchCmd.Flags().IntVar(&benchConfig.Sources, "sources", d.Sources, "Number of synthetic sources stored")
+	benchCmd.Flags().IntVar(&benchConfig.Policies, "policies", d.Policies, "Number of policies applied to the store")
+	benchCmd.Flags().IntVar(&benchConfig.Targets, "targets", d.Targets, "Number of distinct destinations requested")
+	benchCmd.Flags().IntVar(&benchConfig.Concurrency, "concurrency", d.Concurrency, "Number of concurrent callers")
+	benchCmd.Flags().IntVar(&benchConfig.Iterations, "iterations", d.Iterations, "Number of requests performed by each caller")
+	benchCmd.Flags().BoolVar(&benchConfig.Churn, "churn", false, "If set, sources are continuously removed and added back during the run")
+	benchCmd.Flags().BoolVar(&benchJSON, "json", false, "If set, prints the results in json format")
+}
@@ -0,0 +1,465 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/booster-proj/booster"
+	"github.com/booster-proj/booster/history"
+	"github.com/booster-proj/booster/remote"
+	"github.com/booster-proj/booster/store"
+	"github.com/spf13/cobra"
+	"upspin.io/log"
+)
+
+var (
+	ctlClient  remote.Client
+	ctlJSON    bool
+	ctlTimeout time.Duration
+
+	ctlPolicy remote.PolicyInput
+	ctlPorts  []string
+	ctlASNs   []int
+
+	ctlTopBy    string
+	ctlTopLimit int
+)
+
+// ctlCmd represents the ctl command
+var ctlCmd = &cobra.Command{
+	Use:   "ctl",
+	Short: "Control a running booster through its API",
+	Long: `Ctl inspects and changes the state of a running booster through its API, printing
+the results as tables, or in json format with --json. The token used is read
+from the BOOSTER_TOKEN environment variable, unless provided with --token.`,
+}
+
+var ctlSourcesCmd = &cobra.Command{
+	Use:   "sources",
+	Short: "Inspect, block and diagnose the sources",
+}
+
+var ctlSourcesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the sources",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := ctlContext()
+		defer cancel()
+
+		sources, err := ctlClient.Sources(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ctlPrint(sources, func(tw io.Writer) {
+			fmt.Fprintln(tw, "NAME\tDISPLAY NAME\tSTATE\tTIER\tMETERED\tPUBLIC IP\tCONNS\tSENT\tRECEIVED")
+			for _, v := range sources {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%v\t%v\t%s\t%d\t%s\t%s\n", v.ID, v.DisplayName, v.State, v.Tier, v.Metered, v.PublicIP, v.Conns, history.FormatBytes(v.Sent), history.FormatBytes(v.Received))
+			}
+		})
+	},
+}
+
+var ctlSourcesBlockCmd = &cobra.Command{
+	Use:   "block <source>",
+	Short: "Block a source, adding a block policy",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctlPolicy.Type = "block"
+		ctlPolicy.SourceID = args[0]
+		ctlAddPolicy()
+	},
+}
+
+var ctlSourcesTracerouteCmd = &cobra.Command{
+	Use:   "traceroute <source> <host>",
+	Short: "Trace the route to a host through a source (Linux only)",
+	Long: `Traceroute lists the routers on the path to the host through the source, telling
+the problems of the local link, where the first hops do not reply, from the ones
+of the upstream routing.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := ctlContext()
+		defer cancel()
+
+		res, err := ctlClient.Traceroute(ctx, args[0], args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		ctlPrint(res, func(tw io.Writer) {
+			fmt.Fprintf(tw, "Route to %s (%s) through %s\n", res.Host, res.Address, res.Source)
+			fmt.Fprintln(tw, "TTL\tADDRESS\tRTT\tERROR")
+			for _, v := range res.Hops {
+				addr, rtt := "*", "*"
+				if v.Address != "" {
+					addr, rtt = v.Address, v.RTT.Round(time.Microsecond*100).String()
+				}
+				fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", v.TTL, addr, rtt, v.Error)
+			}
+			if !res.Reached {
+				fmt.Fprintln(tw, "Destination not reached")
+			}
+		})
+	},
+}
+
+var ctlPoliciesCmd = &cobra.Command{
+	Use:   "policies",
+	Short: "Inspect, add and remove the policies",
+}
+
+var ctlPoliciesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the policies",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := ctlContext()
+		defer cancel()
+
+		policies, err := ctlClient.Policies(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ctlPrint(policies, func(tw io.Writer) {
+			fmt.Fprintln(tw, "ID\tISSUER\tDESCRIPTION")
+			for _, v := range policies {
+				fmt.Fprintf(tw, "%v\t%v\t%v\n", v["id"], v["issuer"], v["description"])
+			}
+		})
+	},
+}
+
+var ctlPoliciesAddCmd = &cobra.Command{
+	Use:   "add <type>",
+	Short: "Add a policy",
+	Long: `Add adds a policy of type block, sticky, reserve, avoid, metered, dscp, fwmark,
+process, protocol, expr, webhook or geo. The flags accepted by each type are the fields
+of the endpoint creating it, e.g.
+
+  booster ctl policies add reserve --source en0 --host example.com --port 443`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctlPolicy.Type = args[0]
+		ctlAddPolicy()
+	},
+}
+
+var ctlPoliciesDelCmd = &cobra.Command{
+	Use:   "del <id>",
+	Short: "Remove a policy",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := ctlContext()
+		defer cancel()
+
+		if err := ctlClient.DelPolicy(ctx, args[0]); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var ctlConnsCmd = &cobra.Command{
+	Use:   "conns",
+	Short: "Inspect and close the open connections",
+}
+
+var ctlConnsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the open connections",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := ctlContext()
+		defer cancel()
+
+		conns, err := ctlClient.Conns(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ctlPrint(conns, func(tw io.Writer) {
+			now := time.Now()
+			fmt.Fprintln(tw, "ID\tSOURCE\tTARGET\tPROTOCOL\tAGE\tIDLE")
+			for _, v := range conns {
+				age := now.Sub(v.Started).Round(time.Second)
+				idle := now.Sub(v.LastActive).Round(time.Second)
+				fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%v\t%v\n", v.ID, v.Source, v.Target, v.Protocol, age, idle)
+			}
+		})
+	},
+}
+
+var ctlConnsKillCmd = &cobra.Command{
+	Use:   "kill <id>",
+	Short: "Close a connection",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := ctlContext()
+		defer cancel()
+
+		id, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			log.Fatalf("invalid connection id %q", args[0])
+		}
+		if err := ctlClient.KillConn(ctx, id); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var ctlMetricsCmd = &cobra.Command{
+	Use:   "metrics",
+	Short: "Inspect the metrics",
+}
+
+var ctlMetricsTopCmd = &cobra.Command{
+	Use:   "top",
+	Short: "List the sources, or targets, that transferred the most data",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := ctlContext()
+		defer cancel()
+
+		if ctlTopBy != "source" && ctlTopBy != "target" {
+			log.Fatalf("invalid --by %q, expected source or target", ctlTopBy)
+		}
+		var buf bytes.Buffer
+		if err := ctlClient.Metrics(ctx, &buf); err != nil {
+			log.Fatal(err)
+		}
+		top, err := topUsage(&buf, ctlTopBy)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if ctlTopLimit > 0 && len(top) > ctlTopLimit {
+			top = top[:ctlTopLimit]
+		}
+		ctlPrint(top, func(tw io.Writer) {
+			fmt.Fprintf(tw, "%s\tSENT\tRECEIVED\tTOTAL\n", strings.ToUpper(ctlTopBy))
+			for _, v := range top {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", v.Name, history.FormatBytes(v.Sent), history.FormatBytes(v.Received), history.FormatBytes(v.Total()))
+			}
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(ctlCmd)
+	ctlCmd.AddCommand(ctlSourcesCmd, ctlPoliciesCmd, ctlConnsCmd, ctlMetricsCmd)
+	ctlSourcesCmd.AddCommand(ctlSourcesListCmd, ctlSourcesBlockCmd, ctlSourcesTracerouteCmd)
+	ctlPoliciesCmd.AddCommand(ctlPoliciesListCmd, ctlPoliciesAddCmd, ctlPoliciesDelCmd)
+	ctlConnsCmd.AddCommand(ctlConnsListCmd, ctlConnsKillCmd)
+	ctlMetricsCmd.AddCommand(ctlMetricsTopCmd)
+
+	d := booster.DefaultConfig
+	ctlCmd.PersistentFlags().StringVar(&ctlClient.URL, "api", fmt.Sprintf("http://localhost:%d", d.APIPort), "Address of the API of the running booster, or unix:// followed by the path of its socket")
+	ctlCmd.PersistentFlags().StringVar(&ctlClient.Token, "token", "", "Secret of the API token used. Defaults to the value of BOOSTER_TOKEN")
+	ctlCmd.PersistentFlags().BoolVar(&ctlJSON, "json", false, "If set, prints the results in json format")
+	ctlCmd.PersistentFlags().DurationVar(&ctlTimeout, "timeout", time.Second*10, "Maximum time the requests to the API can take")
+
+	for _, c := range []*cobra.Command{ctlSourcesBlockCmd, ctlPoliciesAddCmd} {
+		c.Flags().StringVar(&ctlPolicy.Reason, "reason", "", "Why the policy is added")
+		c.Flags().StringVar(&ctlPolicy.Issuer, "issuer", "ctl", "Who, or what, adds the policy")
+	}
+	f := ctlPoliciesAddCmd.Flags()
+	f.StringVar(&ctlPolicy.SourceID, "source", "", "Source, or group, the policy applies to")
+	f.StringVar(&ctlPolicy.Target, "target", "", "Destination avoided by the avoid policies")
+	f.StringSliceVar(&ctlPolicy.Hosts, "host", []string{}, "Destinations the policy applies to")
+	f.StringSliceVar(&ctlPorts, "port", []string{}, "Destination ports, or port ranges, the policy applies to, e.g. 443 or 6881-6889")
+	f.BoolVar(&ctlPolicy.Metered, "metered", false, "If set, the metered policy prefers the metered sources instead of avoiding them")
+	f.StringVar(&ctlPolicy.Name, "name", "", "Name of the dscp, fwmark, expr and webhook policies")
+	f.StringVar(&ctlPolicy.Expression, "expression", "", "Expression of the expr policies")
+	f.StringVar(&ctlPolicy.Process, "process", "", "Process name of the process policies")
+	f.StringVar(&ctlPolicy.Protocol, "protocol", "", "Protocol of the protocol policies: http, tls, ssh or bittorrent")
+	f.StringVar(&ctlPolicy.DSCP, "dscp", "", "DSCP value of the dscp policies, either a name, e.g. EF, or a number")
+	f.StringVar(&ctlPolicy.FWMark, "fwmark", "", "Firewall mark of the fwmark policies, e.g. 16 or 0x10 (Linux only)")
+	f.StringVar(&ctlPolicy.URL, "url", "", "URL of the webhook policies")
+	f.BoolVar(&ctlPolicy.FailOpen, "fail-open", false, "If set, the webhook policies accept the sources when the webhook fails")
+	f.StringVar(&ctlPolicy.CacheTTL, "cache-ttl", "", "Time the decisions of the webhook policies are cached")
+	f.StringSliceVar(&ctlPolicy.Countries, "country", []string{}, "Country codes of the geo policies")
+	f.StringSliceVar(&ctlPolicy.Continents, "continent", []string{}, "Continent codes of the geo policies")
+	f.IntSliceVar(&ctlASNs, "asn", []int{}, "Autonomous system numbers of the geo policies")
+	f.StringSliceVar(&ctlPolicy.Domains, "domain", []string{}, "Domains the sticky policy is restricted to, with their subdomains")
+	f.StringSliceVar(&ctlPolicy.DomainSets, "domain-set", []string{}, "Domain sets the sticky policy is restricted to")
+
+	ctlMetricsTopCmd.Flags().StringVar(&ctlTopBy, "by", "target", "What the data is grouped by, either source or target")
+	ctlMetricsTopCmd.Flags().IntVar(&ctlTopLimit, "limit", 10, "Maximum number of entries listed. If 0, they are all listed")
+}
+
+// ctlContext returns the context of the requests to the API, which
+// expires after the timeout configured. The token is read from the
+// environment here, so that it is not printed as the default value
+// of --token.
+func ctlContext() (context.Context, context.CancelFunc) {
+	if ctlClient.Token == "" {
+		ctlClient.Token = os.Getenv("BOOSTER_TOKEN")
+	}
+	return context.WithTimeout(context.Background(), ctlTimeout)
+}
+
+// ctlPrint prints `v` in json format, if requested, or as a table
+// otherwise, using `table` to write it.
+func ctlPrint(v interface{}, table func(tw io.Writer)) {
+	if ctlJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(v)
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	table(tw)
+	tw.Flush()
+}
+
+func ctlAddPolicy() {
+	ctx, cancel := ctlContext()
+	defer cancel()
+
+	ports, err := store.ParsePorts(ctlPorts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctlPolicy.Ports = ports
+	for _, v := range ctlASNs {
+		ctlPolicy.ASNs = append(ctlPolicy.ASNs, uint(v))
+	}
+
+	p, err := ctlClient.AddPolicy(ctx, ctlPolicy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctlPrint(p, func(tw io.Writer) {
+		fmt.Fprintf(tw, "Added policy %v: %v\n", p["id"], p["description"])
+		if warnings, ok := p["warnings"].([]interface{}); ok {
+			for _, v := range warnings {
+				b, _ := json.Marshal(v)
+				fmt.Fprintf(tw, "Warning: %s\n", b)
+			}
+		}
+	})
+}
+
+// topUsage returns the data transferred by source or by target,
+// according to `by`, read from the metrics in the Prometheus text
+// format contained in `r`, sorted by total, descending.
+func topUsage(r io.Reader, by string) ([]history.Usage, error) {
+	acc := make(map[string]*history.Usage)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, labels, value, err := parseSample(line)
+		if err != nil {
+			return nil, err
+		}
+		if name != "booster_network_send_bytes" && name != "booster_network_receive_bytes" {
+			continue
+		}
+		key := labels[by]
+		u, ok := acc[key]
+		if !ok {
+			u = &history.Usage{Name: key}
+			acc[key] = u
+		}
+		if name == "booster_network_send_bytes" {
+			u.Sent += int64(value)
+		} else {
+			u.Received += int64(value)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	top := make([]history.Usage, 0, len(acc))
+	for _, v := range acc {
+		top = append(top, *v)
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Total() != top[j].Total() {
+			return top[i].Total() > top[j].Total()
+		}
+		return top[i].Name < top[j].Name
+	})
+	return top, nil
+}
+
+// parseSample parses a sample in the Prometheus text format, e.g.
+// `name{label="value"} 42`.
+func parseSample(line string) (string, map[string]string, float64, error) {
+	labels := make(map[string]string)
+	name, rest := line, ""
+	if i := strings.IndexAny(line, "{ "); i >= 0 {
+		name, rest = line[:i], line[i:]
+	}
+	if strings.HasPrefix(rest, "{") {
+		rest = rest[1:]
+		for {
+			rest = strings.TrimLeft(rest, " ,")
+			if strings.HasPrefix(rest, "}") {
+				rest = rest[1:]
+				break
+			}
+			i := strings.Index(rest, `="`)
+			if i < 0 {
+				return "", nil, 0, fmt.Errorf("invalid metric sample %q", line)
+			}
+			key := rest[:i]
+			rest = rest[i+2:]
+
+			var value strings.Builder
+			for {
+				if rest == "" {
+					return "", nil, 0, fmt.Errorf("invalid metric sample %q", line)
+				}
+				c := rest[0]
+				rest = rest[1:]
+				if c == '"' {
+					break
+				}
+				if c == '\\' && rest != "" {
+					c, rest = rest[0], rest[1:]
+					if c == 'n' {
+						c = '\n'
+					}
+				}
+				value.WriteByte(c)
+			}
+			labels[key] = value.String()
+		}
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return "", nil, 0, fmt.Errorf("invalid metric sample %q", line)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return "", nil, 0, fmt.Errorf("invalid metric sample %q: %v", line, err)
+	}
+	return name, labels, value, nil
+}
@@ -0,0 +1,142 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/booster-proj/booster/dhcp"
+	"golang.org/x/sync/errgroup"
+	"upspin.io/log"
+)
+
+// dhcpServer is a DHCP server with the connection it answers on.
+type dhcpServer struct {
+	iface string
+	srv   *dhcp.Server
+	conn  net.PacketConn
+}
+
+// listenDHCP returns the DHCP servers of --dhcp-range, listening on
+// their interfaces, exiting if the configuration is invalid.
+func listenDHCP(ctx context.Context) []dhcpServer {
+	if len(dhcpRanges) == 0 {
+		return nil
+	}
+	dns, err := dhcpDNSServers()
+	if err != nil {
+		log.Fatalf("%v, use --dhcp-dns", err)
+	}
+	var acc []dhcpServer
+	for _, v := range dhcpRanges {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 {
+			log.Fatalf("invalid --dhcp-range %q, expected interface=start-end", v)
+		}
+		r, err := dhcp.ParseRange(kv[1])
+		if err != nil {
+			log.Fatalf("%v, use --dhcp-range", err)
+		}
+		n, err := localNetwork(kv[0], r.Start)
+		if err != nil {
+			log.Fatalf("%v, use --dhcp-range", err)
+		}
+		srv := &dhcp.Server{Range: r, Router: n.IP, Mask: n.Mask, DNS: dns, LeaseTime: dhcpLeaseTime}
+		if err := srv.Validate(); err != nil {
+			log.Fatalf("%v, use --dhcp-range", err)
+		}
+		conn, err := dhcp.Listen(ctx, kv[0])
+		if err != nil {
+			log.Fatalf("unable to serve DHCP on %s: %v", kv[0], err)
+		}
+		acc = append(acc, dhcpServer{iface: kv[0], srv: srv, conn: conn})
+	}
+	return acc
+}
+
+// serveDHCP runs `servers` in `g`.
+func serveDHCP(ctx context.Context, g *errgroup.Group, servers []dhcpServer) {
+	for _, v := range servers {
+		v := v
+		g.Go(func() error {
+			log.Info.Printf("DHCP: handing out %v on %s, router %v, DNS %v", v.srv.Range, v.iface, v.srv.Router, v.srv.DNS)
+			return v.srv.Serve(ctx, v.conn)
+		})
+	}
+}
+
+// localNetwork returns the address of interface `iface`, with its
+// mask, on the network of `ip`.
+func localNetwork(iface string, ip net.IP) (*net.IPNet, error) {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range addrs {
+		n, ok := v.(*net.IPNet)
+		if !ok || n.IP.To4() == nil || !n.Contains(ip) {
+			continue
+		}
+		ones, _ := n.Mask.Size()
+		return &net.IPNet{IP: n.IP.To4(), Mask: net.CIDRMask(ones, 32)}, nil
+	}
+	return nil, fmt.Errorf("interface %s has no address on the network of %v", iface, ip)
+}
+
+// dhcpDNSServers returns the DNS servers of --dhcp-dns or, if not set,
+// the ones of /etc/resolv.conf reachable by the clients, i.e. not on
+// the loopback.
+func dhcpDNSServers() ([]net.IP, error) {
+	var acc []net.IP
+	if len(dhcpDNS) > 0 {
+		for _, v := range dhcpDNS {
+			ip := net.ParseIP(v)
+			if ip == nil || ip.To4() == nil {
+				return nil, fmt.Errorf("%q is not an IPv4 address", v)
+			}
+			acc = append(acc, ip)
+		}
+		return acc, nil
+	}
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return nil, fmt.Errorf("unable to find the DNS servers: %v", err)
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		if ip := net.ParseIP(fields[1]); ip != nil && ip.To4() != nil && !ip.IsLoopback() {
+			acc = append(acc, ip)
+		}
+	}
+	if len(acc) == 0 {
+		return nil, fmt.Errorf("no DNS server in /etc/resolv.conf reachable from the local network")
+	}
+	return acc, nil
+}
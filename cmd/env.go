@@ -0,0 +1,89 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"upspin.io/log"
+)
+
+// EnvPrefix is the prefix of the environment variables setting the
+// flags, e.g. BOOSTER_REMOTE_SOURCE sets --remote-source.
+const EnvPrefix = "BOOSTER_"
+
+// flagsFromEnv sets the flags of `cmd` not passed on the command line
+// from the environment variables and, if `dir` is not empty, from the
+// files of `dir`, each named after a flag, e.g. a mounted Kubernetes
+// ConfigMap. The environment takes precedence over the files. The
+// flags that can be repeated take a value per line.
+func flagsFromEnv(cmd *cobra.Command, dir string) error {
+	values := make(map[string]string)
+	if dir != "" {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("unable to read the configuration: %v", err)
+		}
+		for _, v := range files {
+			// Skip the hidden files, e.g. the ..data link of the
+			// ConfigMap volumes.
+			if strings.HasPrefix(v.Name(), ".") || v.IsDir() {
+				continue
+			}
+			b, err := ioutil.ReadFile(filepath.Join(dir, v.Name()))
+			if err != nil {
+				return fmt.Errorf("unable to read the configuration: %v", err)
+			}
+			values[v.Name()] = string(b)
+		}
+	}
+	for _, v := range os.Environ() {
+		kv := strings.SplitN(v, "=", 2)
+		if !strings.HasPrefix(kv[0], EnvPrefix) {
+			continue
+		}
+		name := strings.ToLower(strings.Replace(strings.TrimPrefix(kv[0], EnvPrefix), "_", "-", -1))
+		values[name] = kv[1]
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := cmd.Flags().Lookup(name)
+		if f == nil {
+			log.Debug.Printf("Ignoring the configuration of unknown flag --%s", name)
+			continue
+		}
+		if f.Changed {
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimSpace(values[name]), "\n") {
+			if err := cmd.Flags().Set(name, strings.TrimSpace(line)); err != nil {
+				return fmt.Errorf("invalid --%s configuration: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"strings"
+
+	"github.com/booster-proj/booster/acl"
+	"github.com/booster-proj/booster/gateway"
+	"upspin.io/log"
+)
+
+// gatewayRules returns the firewall rules of the gateway mode,
+// redirecting to the transparent proxy on `port`, exiting if the
+// configuration is invalid.
+func gatewayRules(port int) *gateway.Rules {
+	exclude, err := acl.ParseNetworks(gatewayExclude)
+	if err != nil {
+		log.Fatalf("%v, use --gateway-exclude", err)
+	}
+	r := &gateway.Rules{
+		Port:       port,
+		Interfaces: gatewayInterfaces,
+		Exclude:    exclude,
+		Backend:    gatewayBackend,
+	}
+	if err := r.Validate(); err != nil {
+		log.Fatalf("gateway mode: %v, use --gateway-interface, --gateway-port and --gateway-backend", err)
+	}
+	return r
+}
+
+// installGateway installs `r`, exiting on failure, and returns the
+// function removing them.
+func installGateway(r *gateway.Rules) func() {
+	if err := r.Install(); err != nil {
+		log.Fatalf("gateway mode: unable to install the firewall rules: %v", err)
+	}
+	log.Info.Printf("Gateway: redirecting the TCP connections from %s to :%d", strings.Join(r.Interfaces, ", "), r.Port)
+	return func() {
+		if err := r.Remove(); err != nil {
+			log.Error.Printf("Gateway: unable to remove the firewall rules: %v", err)
+			return
+		}
+		log.Info.Printf("Gateway: firewall rules removed")
+	}
+}
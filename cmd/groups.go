@@ -0,0 +1,43 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/booster-proj/booster/core"
+)
+
+// parseSourceGroup parses a group in the form
+// `name[:weight]=pattern,pattern`.
+func parseSourceGroup(s string) (core.SourceGroup, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return core.SourceGroup{}, fmt.Errorf("invalid source group %q, expected name[:weight]=pattern,pattern", s)
+	}
+
+	g := core.SourceGroup{Name: parts[0], Patterns: strings.Split(parts[1], ",")}
+	if i := strings.LastIndex(g.Name, ":"); i >= 0 {
+		w, err := strconv.Atoi(g.Name[i+1:])
+		if err != nil {
+			return core.SourceGroup{}, fmt.Errorf("invalid weight of source group %q: %v", s, err)
+		}
+		g.Name, g.Weight = g.Name[:i], w
+	}
+	return g, nil
+}
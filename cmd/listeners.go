@@ -0,0 +1,71 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/booster-proj/booster"
+)
+
+// parseListeners parses the listeners in the form
+// `name:port=<port>[,strategy=<strategy>]` and their policies, in the
+// form `name=expression`.
+func parseListeners(listeners, policies []string) ([]booster.ListenerConfig, error) {
+	acc := make([]booster.ListenerConfig, 0, len(listeners))
+	index := make(map[string]int, len(listeners))
+	for _, s := range listeners {
+		parts := strings.SplitN(s, ":", 2)
+		l := booster.ListenerConfig{Name: parts[0]}
+		if l.Name == "" || len(parts) == 1 {
+			return nil, fmt.Errorf("invalid listener %q, expected name:port=port[,strategy=strategy]", s)
+		}
+		for _, v := range strings.Split(parts[1], ",") {
+			kv := strings.SplitN(v, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("listener %s: missing %s value", l.Name, kv[0])
+			}
+			switch kv[0] {
+			case "port":
+				port, err := strconv.Atoi(kv[1])
+				if err != nil {
+					return nil, fmt.Errorf("listener %s: invalid port: %v", l.Name, err)
+				}
+				l.Port = port
+			case "strategy":
+				l.Strategy = kv[1]
+			default:
+				return nil, fmt.Errorf("listener %s: unknown option %q", l.Name, kv[0])
+			}
+		}
+		index[l.Name] = len(acc)
+		acc = append(acc, l)
+	}
+	for _, s := range policies {
+		parts := strings.SplitN(s, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("invalid listener policy %q, expected name=expression", s)
+		}
+		i, ok := index[parts[0]]
+		if !ok {
+			return nil, fmt.Errorf("invalid listener policy %q: no listener %s", s, parts[0])
+		}
+		acc[i].Policies = append(acc[i].Policies, parts[1])
+	}
+	return acc, nil
+}
@@ -0,0 +1,60 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// tcpListen is the state of the listening sockets in /proc/net/tcp.
+const tcpListen = "0A"
+
+// listening reports whether a TCP socket is listening on `port`,
+// looking it up in the socket tables of the kernel, so that the
+// service is not disturbed by test connections.
+func listening(port int) (bool, error) {
+	for _, v := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		f, err := os.Open(v)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			// sl local_address rem_address st ...
+			fields := strings.Fields(s.Text())
+			if len(fields) < 4 || fields[3] != tcpListen {
+				continue
+			}
+			i := strings.LastIndexByte(fields[1], ':')
+			if p, err := strconv.ParseUint(fields[1][i+1:], 16, 16); err == nil && int(p) == port {
+				f.Close()
+				return true, nil
+			}
+		}
+		err = s.Err()
+		f.Close()
+		if err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,130 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+
+	"github.com/booster-proj/booster/chaos"
+	"github.com/booster-proj/booster/loadtest"
+	"github.com/booster-proj/booster/relay"
+	"github.com/spf13/cobra"
+	"upspin.io/log"
+)
+
+var (
+	loadConfig     loadtest.Config
+	loadJSON       bool
+	loadCPUProfile string
+	loadMemProfile string
+	loadFaults     []string
+)
+
+// loadCmd represents the bench load command
+var loadCmd = &cobra.Command{
+	Use:   "load",
+	Short: "Measure the performance of the full booster stack",
+	Long: `Load spins up synthetic sources and clients, and drives concurrent connections
+through the turbo proxy, the dialer and the source store. It reports connection
+setup and source selection latency, data throughput and memory allocations, and
+optionally writes CPU and allocation profiles.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		captureSignals(cancel)
+
+		for _, v := range loadFaults {
+			id, f, err := parseSourceFaults(v)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if loadConfig.Faults == nil {
+				loadConfig.Faults = make(map[string]chaos.Faults)
+			}
+			loadConfig.Faults[id] = f
+		}
+
+		if loadCPUProfile != "" {
+			f, err := os.Create(loadCPUProfile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			if err := pprof.StartCPUProfile(f); err != nil {
+				log.Fatal(err)
+			}
+			defer pprof.StopCPUProfile()
+		}
+
+		res, err := loadtest.Run(ctx, loadConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if loadMemProfile != "" {
+			f, err := os.Create(loadMemProfile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			runtime.GC()
+			if err := pprof.Lookup("allocs").WriteTo(f, 0); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if loadJSON {
+			json.NewEncoder(os.Stdout).Encode(res)
+			return
+		}
+		res.Fprint(os.Stdout)
+	},
+}
+
+func init() {
+	benchCmd.AddCommand(loadCmd)
+
+	d := loadtest.DefaultConfig
+	loadCmd.Flags().IntVar(&loadConfig.Sources, "sources", d.Sources, "Number of synthetic sources stored")
+	loadCmd.Flags().IntVar(&loadConfig.Conns, "conns", d.Conns, "Total number of connections opened")
+	loadCmd.Flags().IntVar(&loadConfig.Concurrency, "concurrency", d.Concurrency, "Number of clients opening connections concurrently")
+	loadCmd.Flags().IntVar(&loadConfig.Size, "size", d.Size, "Number of bytes sent, and received back, on each connection")
+	loadCmd.Flags().DurationVar(&loadConfig.Latency, "latency", 0, "Latency added by the synthetic sources to each dial")
+	loadCmd.Flags().IntVar(&loadConfig.BufferSize, "buffer-size", relay.DefaultBufferSize, "Size in bytes of the buffers used to relay data")
+	loadCmd.Flags().DurationVar(&loadConfig.Timeout, "timeout", d.Timeout, "Maximum duration of each connection, including the transfer")
+	loadCmd.Flags().StringArrayVar(&loadFaults, "faults", []string{}, "Faults injected into a synthetic source, in the form source:fault=value,fault=value, e.g. s0:dial-error=0.2,transfer-delay=10ms. The faults are dial-error, dial-drop, dial-delay, transfer-error and transfer-delay")
+	loadCmd.Flags().Int64Var(&loadConfig.Seed, "seed", 0, "Seed used to choose the faults injected")
+	loadCmd.Flags().BoolVar(&loadJSON, "json", false, "If set, prints the results in json format")
+	loadCmd.Flags().StringVar(&loadCPUProfile, "cpuprofile", "", "If set, writes a CPU profile of the run to this file")
+	loadCmd.Flags().StringVar(&loadMemProfile, "memprofile", "", "If set, writes an allocation profile of the run to this file")
+}
+
+// parseSourceFaults parses the faults of a source, in the form
+// `source:fault=value,fault=value`.
+func parseSourceFaults(s string) (string, chaos.Faults, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", chaos.Faults{}, fmt.Errorf("invalid faults %q, expected source:fault=value,fault=value", s)
+	}
+	f, err := chaos.ParseFaults(parts[1])
+	return parts[0], f, err
+}
@@ -0,0 +1,65 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/grandcat/zeroconf"
+	"upspin.io/log"
+)
+
+type mdnsService struct {
+	instance string
+	service  string
+	port     int
+}
+
+// advertise exposes booster's listeners as mDNS/DNS-SD services, so that
+// clients on the local network are able to discover them. The returned
+// function withdraws the services.
+func advertise(services ...mdnsService) func() {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	txt := []string{
+		"version=" + Version,
+		"commit=" + Commit,
+		"api_port=" + strconv.Itoa(serverConfig.APIPort),
+		"proxy_port=" + strconv.Itoa(serverConfig.ProxyPort),
+	}
+
+	servers := make([]*zeroconf.Server, 0, len(services))
+	for _, v := range services {
+		instance := fmt.Sprintf("%s on %s", v.instance, host)
+		s, err := zeroconf.Register(instance, v.service, "local.", v.port, txt, nil)
+		if err != nil {
+			log.Error.Printf("Unable to advertise %s (%s) via mDNS: %v", v.instance, v.service, err)
+			continue
+		}
+		log.Debug.Printf("Advertising %s as %s via mDNS", instance, v.service)
+		servers = append(servers, s)
+	}
+
+	return func() {
+		for _, s := range servers {
+			s.Shutdown()
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/booster-proj/booster"
+	"github.com/booster-proj/booster/nat"
+	"golang.org/x/sync/errgroup"
+	"upspin.io/log"
+)
+
+// natPorts returns the ports of the services configured by `c` that
+// can be exposed outside of the local network: only those that cannot
+// be used by anyone reaching them. The others are logged and skipped.
+func natPorts(c booster.Config, acmePort int) []int {
+	var ports []int
+	switch {
+	case c.APIPort == 0:
+		// Served on a Unix socket.
+	case len(c.APITokens) > 0 && c.APITLS != nil:
+		ports = append(ports, c.APIPort)
+		if acmePort > 0 && len(c.APITLS.ACMEHosts) > 0 {
+			ports = append(ports, acmePort)
+		}
+	default:
+		log.Error.Printf("NAT: not mapping the API port %d, which requires API tokens and TLS", c.APIPort)
+	}
+	if c.TurboPort > 0 {
+		if len(c.AllowClients) > 0 {
+			ports = append(ports, c.TurboPort)
+		} else {
+			log.Error.Printf("NAT: not mapping the turbo proxy port %d, which requires --allow-clients", c.TurboPort)
+		}
+	}
+	// The SOCKS5 proxy does not authenticate its clients.
+	log.Info.Printf("NAT: not mapping the SOCKS5 proxy port %d", c.ProxyPort)
+	return ports
+}
+
+// mapPorts maps `ports` on the local router, keeping the mappings alive
+// until the context is canceled. Failures are logged and never stop `g`,
+// as booster is still usable from the local network.
+func mapPorts(ctx context.Context, g *errgroup.Group, ports ...int) {
+	if len(ports) == 0 {
+		return
+	}
+	g.Go(func() error {
+		m, err := nat.Discover(ctx)
+		if err != nil {
+			log.Error.Printf("Unable to map ports on the router: %v", err)
+			return nil
+		}
+		if ip, err := m.ExternalIP(ctx); err == nil {
+			log.Info.Printf("NAT: router external address is %v", ip)
+		}
+
+		for _, v := range ports {
+			port := v
+			g.Go(func() error {
+				if err := nat.Keep(ctx, m, "tcp", port); err != nil && ctx.Err() == nil {
+					log.Error.Printf("Unable to map port %d on the router: %v", port, err)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+}
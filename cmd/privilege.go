@@ -0,0 +1,61 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"upspin.io/log"
+)
+
+// listen binds `port`, exiting on failure.
+func listen(port int) net.Listener {
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return ln
+}
+
+// waitProxy waits until the proxy, which binds its port on its own,
+// is listening on `port`, for at most 5 seconds. Only the privileged
+// ports have to be waited for, as the others can be bound after
+// dropping the privileges.
+func waitProxy(ctx context.Context, port int) error {
+	if port <= 0 || port >= 1024 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	for {
+		ok, err := listening(port)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("nothing is listening on port %d", port)
+		case <-time.After(time.Millisecond * 50):
+		}
+	}
+}
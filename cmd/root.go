@@ -17,17 +17,27 @@ package cmd
 
 import (
 	"fmt"
-	stdLog "log"
+	"io"
 	"os"
+	"time"
 
+	"github.com/booster-proj/booster/logging"
 	"github.com/spf13/cobra"
 	"upspin.io/log"
 )
 
 var (
 	// Log configuration
-	verbose  bool
-	cleanLog bool
+	verbose       bool
+	cleanLog      bool
+	logFormat     string
+	logFile       string
+	logMaxSize    int64
+	logMaxAge     time.Duration
+	logMaxBackups int
+
+	// logger is the logger installed by setupLogger.
+	logger *logging.Logger
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -38,7 +48,10 @@ var rootCmd = &cobra.Command{
 Use its SOCKS5 proxy to pipe your network traffic though booster's balancing techniques.`,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
 		// Setup logger
-		setupLogger(verbose, cleanLog)
+		if err := setupLogger(verbose, cleanLog); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 
 	},
 }
@@ -55,39 +68,37 @@ func Execute() {
 func init() {
 	rootCmd.PersistentFlags().BoolVar(&verbose, "verbose", false, "If set, makes the logger print also debug messages")
 	rootCmd.PersistentFlags().BoolVar(&cleanLog, "clean-log", false, "If set, assumes that the loggin is handled by a third party entity")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", logging.FormatText, "Format of the log messages, either text or json")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "If set, log messages are written to this file instead of stderr")
+	rootCmd.PersistentFlags().Int64Var(&logMaxSize, "log-max-size", 100, "Size in megabytes after which the log file is rotated. If 0, it is not rotated by size")
+	rootCmd.PersistentFlags().DurationVar(&logMaxAge, "log-max-age", 0, "Age after which the log file is rotated. If 0, it is not rotated by age")
+	rootCmd.PersistentFlags().IntVar(&logMaxBackups, "log-max-backups", 5, "Number of rotated log files kept. If 0, they are all kept")
 }
 
-func setupLogger(verbose bool, clean bool) {
+func setupLogger(verbose bool, clean bool) error {
 	level := log.InfoLevel
 	if verbose {
-		log.SetLevel("debug")
 		level = log.DebugLevel
 	}
-	if clean {
-		log.SetOutput(nil)             // disable "local" logging
-		log.Register(newLogger(level)) // enable "remote" (snapcraft's daemon handled logger usually) logging
-	}
-}
-
-type logger struct {
-	defaultLogger log.Logger
-	level         log.Level
-}
 
-func newLogger(level log.Level) *logger {
-	return &logger{
-		level:         level,
-		defaultLogger: stdLog.New(os.Stderr, "", 0), // Do not add date/time information
+	var w io.Writer = os.Stderr
+	if logFile != "" {
+		w = &logging.RotatingFile{
+			Path:       logFile,
+			MaxSize:    logMaxSize << 20,
+			MaxAge:     logMaxAge,
+			MaxBackups: logMaxBackups,
+		}
 	}
-}
 
-func (l *logger) Log(level log.Level, msg string) {
-	if level < l.level {
-		return
+	// When clean is set, assume that the logging is handled by a
+	// third party entity (the snapcraft's daemon usually) that
+	// adds the date/time information by itself.
+	l, err := logging.New(w, logFormat, level, !clean || logFile != "")
+	if err != nil {
+		return err
 	}
-
-	l.defaultLogger.Println(msg)
-}
-
-func (l *logger) Flush() {
+	logging.Install(l)
+	logger = l
+	return nil
 }
@@ -17,28 +17,109 @@ package cmd
 
 import (
 	"context"
+	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
-	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster"
+	"github.com/booster-proj/booster/blocklist"
+	"github.com/booster-proj/booster/ddns"
+	"github.com/booster-proj/booster/dhcp"
 	"github.com/booster-proj/booster/dialer"
-	"github.com/booster-proj/booster/metrics"
+	"github.com/booster-proj/booster/gateway"
+	"github.com/booster-proj/booster/privilege"
 	"github.com/booster-proj/booster/remote"
+	"github.com/booster-proj/booster/sockopt"
 	"github.com/booster-proj/booster/source"
-	"github.com/booster-proj/booster/store"
-	"github.com/booster-proj/proxy"
-	"github.com/grandcat/zeroconf"
+	"github.com/booster-proj/booster/systemd"
+	"github.com/booster-proj/booster/trace"
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/errgroup"
 	"upspin.io/log"
 )
 
 var (
-	// Proxy configuration
-	pPort int
+	// serverConfig is filled by the flags that map directly to the
+	// booster configuration.
+	serverConfig booster.Config
 
 	// API configuration
-	apiPort int
+	apiTokens     []string
+	apiTokensFile string
+
+	// API TLS configuration
+	apiTLSCert      string
+	apiTLSKey       string
+	apiACMEHosts    []string
+	apiACMECache    string
+	apiACMEEmail    string
+	apiACMEHTTPPort int
+
+	// Watchdog configuration
+	watchdogGoroutines []string
+
+	// Privileges configuration
+	runAsUser  string
+	runAsGroup string
+
+	// Discovery configuration
+	mdns   bool
+	natMap bool
+
+	// Sources configuration
+	sourceGroups   []string
+	staticSources  []string
+	remoteSources  []string
+	gatewaySources []string
+	ddnsRecords    []string
+	sourceDNS      []string
+	sourceMarks    []string
+	sourceECS      []string
+	resetRules     []string
+
+	// Blocklist configuration
+	blocklists []string
+
+	// Policies configuration
+	domainSets []string
+
+	// Balancer configuration
+	protocolStrategies []string
+
+	// Tracing configuration
+	otlpEndpoint string
+	traceRatio   float64
+
+	// Listeners configuration
+	listeners        []string
+	listenerPolicies []string
+
+	// Unix sockets configuration
+	apiSocket   string
+	turboSocket string
+	socketMode  string
+	socketGroup string
+
+	// Gateway configuration
+	gatewayMode       bool
+	gatewayPort       int
+	gatewayInterfaces []string
+	gatewayExclude    []string
+	gatewayBackend    string
+
+	// DHCP configuration
+	dhcpRanges    []string
+	dhcpDNS       []string
+	dhcpLeaseTime time.Duration
+
+	// Deployment configuration
+	configDir     string
+	shutdownDelay time.Duration
 )
 
 // serverCmd represents the server command
@@ -46,73 +127,351 @@ var serverCmd = &cobra.Command{
 	Use:   "server",
 	Short: "Start a booster server in the foreground",
 	Run: func(cmd *cobra.Command, args []string) {
-		p, err := proxy.NewSOCKS5()
+		if err := flagsFromEnv(cmd, configDir); err != nil {
+			log.Fatal(err)
+		}
+		conf := serverConfig
+		if conf.Sidecar {
+			// Each replica is on its own, and stays off the
+			// network of the cluster.
+			mdns, natMap = false, false
+		}
+		conf.Version, conf.Commit, conf.BuildTime = Version, Commit, BuildTime
+		conf.Logger = logger
+		ls, err := parseListeners(listeners, listenerPolicies)
 		if err != nil {
 			log.Fatal(err)
 		}
+		conf.Listeners = ls
+		for _, v := range sourceGroups {
+			g, err := parseSourceGroup(v)
+			if err != nil {
+				log.Fatal(err)
+			}
+			conf.SourceGroups = append(conf.SourceGroups, g)
+		}
+		for _, v := range protocolStrategies {
+			parts := strings.SplitN(v, "=", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				log.Fatalf("invalid protocol strategy %q, expected protocol=strategy", v)
+			}
+			if conf.ProtocolStrategies == nil {
+				conf.ProtocolStrategies = make(map[string]string)
+			}
+			conf.ProtocolStrategies[parts[0]] = parts[1]
+		}
+		for _, v := range domainSets {
+			parts := strings.SplitN(v, "=", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				log.Fatalf("invalid domain set %q, expected name=domain,domain", v)
+			}
+			if conf.DomainSets == nil {
+				conf.DomainSets = make(map[string][]string)
+			}
+			conf.DomainSets[parts[0]] = strings.Split(parts[1], ",")
+		}
+		for _, v := range blocklists {
+			s, err := blocklist.ParseSource(v)
+			if err != nil {
+				log.Fatal(err)
+			}
+			conf.Blocklists = append(conf.Blocklists, s)
+		}
+		for _, v := range staticSources {
+			c, err := source.ParseStatic(v)
+			if err != nil {
+				log.Fatal(err)
+			}
+			conf.StaticSources = append(conf.StaticSources, c)
+		}
+		for _, v := range resetRules {
+			r, err := dialer.ParseResetRule(v)
+			if err != nil {
+				log.Fatal(err)
+			}
+			conf.ResetOnFailure = append(conf.ResetOnFailure, r)
+		}
+		for _, v := range remoteSources {
+			c, err := source.ParseRemote(v)
+			if err != nil {
+				log.Fatal(err)
+			}
+			conf.RemoteSources = append(conf.RemoteSources, c)
+		}
+		for _, v := range gatewaySources {
+			c, err := source.ParseGateway(v)
+			if err != nil {
+				log.Fatal(err)
+			}
+			conf.GatewaySources = append(conf.GatewaySources, c)
+		}
+		for _, v := range ddnsRecords {
+			r, err := ddns.ParseRecord(v)
+			if err != nil {
+				log.Fatal(err)
+			}
+			conf.DDNS = append(conf.DDNS, r)
+		}
+		for _, v := range sourceDNS {
+			parts := strings.SplitN(v, "=", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				log.Fatalf("invalid source DNS %q, expected source=server,server", v)
+			}
+			for _, ip := range strings.Split(parts[1], ",") {
+				if net.ParseIP(ip) == nil {
+					log.Fatalf("invalid source DNS %q: %q is not an IP address", v, ip)
+				}
+			}
+			if conf.SourceDNS == nil {
+				conf.SourceDNS = make(map[string][]string)
+			}
+			conf.SourceDNS[parts[0]] = strings.Split(parts[1], ",")
+		}
+		for _, v := range sourceMarks {
+			parts := strings.SplitN(v, "=", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				log.Fatalf("invalid source fwmark %q, expected source=mark", v)
+			}
+			mark, err := sockopt.ParseMark(parts[1])
+			if err != nil {
+				log.Fatal(err)
+			}
+			if conf.SourceMarks == nil {
+				conf.SourceMarks = make(map[string]uint32)
+			}
+			conf.SourceMarks[parts[0]] = mark
+		}
+		for _, v := range sourceECS {
+			parts := strings.SplitN(v, "=", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				log.Fatalf("invalid source ECS %q, expected source=strip or source=subnet", v)
+			}
+			ecs, err := source.ParseECS(parts[1])
+			if err != nil {
+				log.Fatalf("invalid source ECS %q: %v", v, err)
+			}
+			if conf.SourceECS == nil {
+				conf.SourceECS = make(map[string]source.ECS)
+			}
+			conf.SourceECS[parts[0]] = ecs
+		}
+		if conf.InfluxURL != "" {
+			if host, err := os.Hostname(); err == nil {
+				conf.InfluxTags = map[string]string{"host": host}
+			}
+		}
+		for _, v := range watchdogGoroutines {
+			parts := strings.SplitN(v, "=", 2)
+			if len(parts) == 1 {
+				n, err := strconv.Atoi(v)
+				if err != nil || n <= 0 {
+					log.Fatalf("invalid watchdog threshold %q, expected a number of goroutines or subsystem=number", v)
+				}
+				conf.WatchdogGoroutines = n
+				continue
+			}
+			n, err := strconv.Atoi(parts[1])
+			if err != nil || n <= 0 || parts[0] == "" {
+				log.Fatalf("invalid watchdog threshold %q, expected a number of goroutines or subsystem=number", v)
+			}
+			if conf.WatchdogSubsystems == nil {
+				conf.WatchdogSubsystems = make(map[string]int)
+			}
+			conf.WatchdogSubsystems[parts[0]] = n
+		}
+		for _, v := range apiTokens {
+			t, err := remote.ParseToken(v)
+			if err != nil {
+				log.Fatal(err)
+			}
+			conf.APITokens = append(conf.APITokens, t)
+		}
+		if apiTokensFile != "" {
+			tokens, err := remote.ReadTokens(apiTokensFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			conf.APITokens = append(conf.APITokens, tokens...)
+		}
+		if (apiTLSCert == "") != (apiTLSKey == "") {
+			log.Fatal("both --api-tls-cert and --api-tls-key are required to serve the API over TLS")
+		}
+		if len(apiACMEHosts) > 0 || apiTLSCert != "" {
+			conf.APITLS = &remote.TLS{
+				CertFile:     apiTLSCert,
+				KeyFile:      apiTLSKey,
+				ACMEHosts:    apiACMEHosts,
+				ACMECache:    apiACMECache,
+				ACMEEmail:    apiACMEEmail,
+				ACMEHTTPPort: apiACMEHTTPPort,
+			}
+			if len(apiACMEHosts) > 0 && apiACMECache == "" {
+				if dir, err := os.UserCacheDir(); err == nil {
+					conf.APITLS.ACMECache = filepath.Join(dir, "booster", "acme")
+				}
+			}
+		}
 
-		b := new(core.Balancer)
-		rs := store.New(b)
-		exp := new(metrics.Exporter)
-		l := source.NewListener(source.Config{
-			Store:           rs,
-			MetricsExporter: exp,
-		})
-		d := dialer.New(rs)
-		d.SetMetricsExporter(exp)
+		// Use the sockets passed by systemd, if any.
+		activated, err := systemd.Listeners()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, ok := activated["proxy"]; ok {
+			log.Error.Printf("The proxy does not support socket activation, listening on :%d instead", conf.ProxyPort)
+		}
+		conf.APIListener = activatedListener(activated, "api")
+		conf.TurboListener = activatedListener(activated, "turbo")
 
-		router := remote.NewRouter()
-		router.Store = rs
-		router.MetricsProvider = exp
-		router.Info = remote.BoosterInfo{
-			Version:   Version,
-			Commit:    Commit,
-			BuildTime: BuildTime,
-			ProxyPort: pPort,
+		// Serve on the Unix sockets in place of the ports, so that
+		// only the local users allowed by their permissions reach
+		// them.
+		if apiSocket != "" || turboSocket != "" {
+			mode, err := strconv.ParseUint(socketMode, 8, 32)
+			if err != nil {
+				log.Fatalf("invalid socket mode %q, expected octal permissions, e.g. 0660", socketMode)
+			}
+			if apiSocket != "" && conf.APIListener == nil {
+				conf.APIListener = listenUnix(apiSocket, os.FileMode(mode), socketGroup)
+				conf.APIPort = 0
+			}
+			if turboSocket != "" && conf.TurboListener == nil {
+				conf.TurboListener = listenUnix(turboSocket, os.FileMode(mode), socketGroup)
+				conf.TurboPort = 0
+			}
 		}
 
-		router.SetupRoutes()
-		r := remote.New(router)
+		// The firewall rules of the gateway mode are removed on
+		// exit, which requires the privileges to be kept.
+		var rules *gateway.Rules
+		if gatewayMode {
+			if runAsUser != "" {
+				log.Fatal("the gateway mode removes its firewall rules on exit, it cannot be used with --user")
+			}
+			rules = gatewayRules(gatewayPort)
+			conf.GatewayPort = gatewayPort
+		}
+
+		// Bind the DHCP port while we're still allowed to.
+		dhcpServers := listenDHCP(context.Background())
 
-		// Make the proxy use booster as dialer
-		p.DialWith(d)
+		// Bind the listeners while we're still allowed to, if the
+		// privileges are going to be dropped.
+		var creds privilege.Credentials
+		if runAsUser != "" {
+			if creds, err = privilege.Lookup(runAsUser, runAsGroup); err != nil {
+				log.Fatal(err)
+			}
+			if conf.APIListener == nil {
+				conf.APIListener = listen(conf.APIPort)
+			}
+			if conf.TurboPort > 0 && conf.TurboListener == nil {
+				conf.TurboListener = listen(conf.TurboPort)
+			}
+			if conf.APITLS != nil && apiACMEHTTPPort > 0 {
+				conf.APITLS.ACMEHTTPListener = listen(apiACMEHTTPPort)
+			}
+		}
+
+		bst, err := booster.New(conf)
+		if err != nil {
+			log.Fatal(err)
+		}
 
 		g, ctx := errgroup.WithContext(context.Background())
 		ctx, cancel := context.WithCancel(ctx)
 		defer cancel()
 
-		captureSignals(cancel)
+		stop := cancel
+		if shutdownDelay > 0 {
+			// Keep serving, e.g. the other containers of the pod
+			// that are shutting down too, while the readiness check
+			// fails. A second signal stops booster immediately.
+			var stopping bool
+			stop = func() {
+				if stopping {
+					cancel()
+					return
+				}
+				stopping = true
+				bst.Stop()
+				log.Info.Printf("Stopping in %v", shutdownDelay)
+				time.AfterFunc(shutdownDelay, cancel)
+			}
+		}
+		captureSignals(stop)
 
-		// Expose out services as mDNS entries
-		s, err := zeroconf.Register("booster api", "_http._tcp", "local.", apiPort, []string{
-			"Version=" + Version,
-			"Commit=" + Commit,
-		}, nil)
-		defer s.Shutdown()
+		// Expose our services as mDNS entries
+		if mdns {
+			apiService := "_http._tcp"
+			if conf.APITLS != nil {
+				apiService = "_https._tcp"
+			}
+			services := []mdnsService{
+				{instance: "booster proxy", service: "_socks5._tcp", port: conf.ProxyPort},
+			}
+			if conf.APIPort > 0 {
+				services = append(services, mdnsService{instance: "booster api", service: apiService, port: conf.APIPort})
+			}
+			if conf.TurboPort > 0 {
+				services = append(services, mdnsService{instance: "booster turbo proxy", service: "_http-proxy._tcp", port: conf.TurboPort})
+			}
+			defer advertise(services...)()
+		}
 
-		s, err = zeroconf.Register("booster proxy", "_SOCKS5_tcp", "local.", pPort, []string{
-			"Version=" + Version,
-			"Commit=" + Commit,
-		}, nil)
-		defer s.Shutdown()
+		// Make our services reachable from outside the local network
+		if natMap {
+			mapPorts(ctx, g, natPorts(conf, apiACMEHTTPPort)...)
+		}
 
+		if otlpEndpoint != "" {
+			t := &trace.Tracer{Endpoint: otlpEndpoint, Ratio: traceRatio}
+			trace.SetTracer(t)
+			g.Go(func() error {
+				log.Info.Printf("Exporting traces to %v", otlpEndpoint)
+				return t.Run(ctx)
+			})
+		}
+		removeGateway := func() {}
+		if rules != nil {
+			removeGateway = installGateway(rules)
+		}
 		g.Go(func() error {
-			log.Info.Printf("Listener started")
-			defer log.Info.Printf("Listener stopped.")
-			return l.Run(ctx)
-		})
-		g.Go(func() error {
-			log.Info.Printf("Booster proxy (%v) listening on :%d", p.Protocol(), pPort)
-			defer log.Info.Print("Booster proxy stopped.")
-			return p.ListenAndServe(ctx, pPort)
-		})
-		g.Go(func() error {
-			log.Info.Printf("Booster API listening on :%d", apiPort)
-			defer log.Info.Print("Booster API stopped.")
-			return r.ListenAndServe(ctx, apiPort)
+			return bst.Run(ctx)
 		})
+		serveDHCP(ctx, g, dhcpServers)
 
-		if err := g.Wait(); err != nil {
+		if runAsUser != "" {
+			// The proxy binds its port on its own: wait for it before
+			// giving up the privileges.
+			if err := waitProxy(ctx, conf.ProxyPort); err != nil {
+				log.Fatal(err)
+			}
+			if err := privilege.Drop(creds); err != nil {
+				log.Fatal(err)
+			}
+			log.Info.Printf("Running as uid %d, gid %d", creds.UID, creds.GID)
+			if conf.MultipathTCP {
+				log.Error.Printf("Unprivileged booster cannot register new MPTCP subflow endpoints")
+			}
+		}
+
+		// Tell systemd that we're up and running.
+		if ok, err := systemd.Notify(systemd.Ready); err != nil {
+			log.Error.Printf("Unable to notify systemd: %v", err)
+		} else if ok {
+			g.Go(func() error {
+				return systemd.RunWatchdog(ctx)
+			})
+			go func() {
+				<-ctx.Done()
+				systemd.Notify(systemd.Stopping)
+			}()
+		}
+
+		err = g.Wait()
+		removeGateway()
+		if err != nil {
 			log.Fatal(err)
 		}
 	},
@@ -121,16 +480,196 @@ var serverCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(serverCmd)
 
+	d := booster.DefaultConfig
+
 	// Proxy configuration
-	serverCmd.Flags().IntVar(&pPort, "proxy-port", 1080, "Proxy server listening port")
+	serverCmd.Flags().IntVar(&serverConfig.ProxyPort, "proxy-port", d.ProxyPort, "Proxy server listening port")
+	serverCmd.Flags().IntVar(&serverConfig.ProxyTLSPort, "proxy-tls-port", 0, "If not 0, serves the SOCKS5 proxy over TLS on this port too, for the clients on untrusted networks, with the certificate of --api-tls-cert or --api-acme-host")
+	serverCmd.Flags().IntVar(&serverConfig.TunnelPort, "tunnel-port", 0, "If not 0, accepts on this port, e.g. 443, the SOCKS5 connections tunneled through WebSocket, for the clients behind firewalls letting only HTTPS through. Requires --tunnel-path")
+	serverCmd.Flags().StringVar(&serverConfig.TunnelPath, "tunnel-path", "", "Path of the WebSocket tunnel, the other requests are replied 404. Anyone knowing it can use the proxy: use a path hard to guess, e.g. /$(openssl rand -hex 16)")
+	serverCmd.Flags().BoolVar(&serverConfig.TunnelTLS, "tunnel-tls", false, "If set, the WebSocket tunnel is served over TLS, with the certificate of --api-tls-cert or --api-acme-host")
+	serverCmd.Flags().StringArrayVar(&listeners, "listener", []string{}, "Additional SOCKS5 proxy, sharing the sources, with its own policies and strategy, in the form name:port=port[,strategy=strategy], e.g. vpn:port=1081. If the strategy is not set, the one of --strategy is used")
+	serverCmd.Flags().StringArrayVar(&listenerPolicies, "listener-policy", []string{}, "Policy of an additional SOCKS5 proxy, in the form name=expression, in the language of the expression policies, e.g. vpn='source == \"wg0\"'. The connections of the proxy are subject to its policies only, in place of the ones of the store")
 
 	// API configuration
-	serverCmd.Flags().IntVar(&apiPort, "api-port", 7764, "API server listening port")
+	serverCmd.Flags().IntVar(&serverConfig.APIPort, "api-port", d.APIPort, "API server listening port")
+	serverCmd.Flags().StringSliceVar(&apiTokens, "api-token", []string{}, "API token, in the form name:role:secret, where role is either viewer, operator or admin. If no token is configured, the API does not require authentication")
+	serverCmd.Flags().StringVar(&apiTokensFile, "api-tokens-file", "", "File containing the API tokens, one per line, in the same form accepted by --api-token")
+	serverCmd.Flags().StringVar(&apiTLSCert, "api-tls-cert", "", "Certificate file used to serve the API over TLS")
+	serverCmd.Flags().StringVar(&apiTLSKey, "api-tls-key", "", "Private key file of the certificate provided with --api-tls-cert")
+	serverCmd.Flags().StringSliceVar(&apiACMEHosts, "api-acme-host", []string{}, "Host name the API is reachable at. If set, the API is served over TLS using certificates automatically obtained from Let's Encrypt")
+	serverCmd.Flags().StringVar(&apiACMECache, "api-acme-cache", "", "Directory where the certificates obtained from Let's Encrypt are stored. Defaults to the user cache directory")
+	serverCmd.Flags().StringVar(&apiACMEEmail, "api-acme-email", "", "Contact email of the Let's Encrypt account, optional")
+	serverCmd.Flags().IntVar(&apiACMEHTTPPort, "api-acme-http-port", 0, "Port used to answer the HTTP-01 challenges, usually 80. If 0, only the TLS-ALPN-01 challenge is supported, which requires the API to listen on port 443")
+	serverCmd.Flags().Float64Var(&serverConfig.APIRateLimit, "api-rate-limit", d.APIRateLimit, "Number of requests per second each API client, identified by its token or address, can perform. If 0, the requests are not limited")
+	serverCmd.Flags().IntVar(&serverConfig.APIRateBurst, "api-rate-burst", d.APIRateBurst, "Number of requests each API client can perform at once, exceeding --api-rate-limit")
+	serverCmd.Flags().Int64Var(&serverConfig.APIMaxBodySize, "api-max-body-size", d.APIMaxBodySize, "Maximum size in bytes of the bodies of the API requests. If 0, it is not limited")
+	serverCmd.Flags().BoolVar(&serverConfig.Dashboard, "dashboard", d.Dashboard, "If set, the API serves a web dashboard at /ui/")
+	serverCmd.Flags().BoolVar(&serverConfig.APIDebug, "api-debug", false, "If set, the API serves the pprof profiles, the expvar variables and the goroutine dumps at /debug/, to the admin tokens only. Requires an admin --api-token")
+	serverCmd.Flags().StringVar(&serverConfig.AuditLog, "audit-log", "", "File the management operations performed through the API are appended to. If empty, they are only kept in memory")
+
+	// Unix sockets configuration
+	serverCmd.Flags().StringVar(&apiSocket, "api-socket", "", "If set, the API is served on this Unix socket in place of --api-port, e.g. /run/booster/api.sock, reachable with booster ctl --api unix:///run/booster/api.sock")
+	serverCmd.Flags().StringVar(&turboSocket, "turbo-socket", "", "If set, the turbo HTTP proxy is served on this Unix socket in place of --turbo-port. Its clients are allowed by the permissions of the socket, regardless of --allow-clients and of the schedules. The SOCKS5 proxies only listen on TCP ports: disable them with --proxy-port 0 to avoid any TCP exposure")
+	serverCmd.Flags().StringVar(&socketMode, "socket-mode", "0660", "Permissions of the Unix sockets, in octal")
+	serverCmd.Flags().StringVar(&socketGroup, "socket-group", "", "Group owning the Unix sockets, e.g. the one of the users allowed to use them. Defaults to the group of booster")
+
+	// Gateway configuration
+	serverCmd.Flags().BoolVar(&gatewayMode, "gateway", false, "Gateway mode, making the host, e.g. a Raspberry Pi, the bonding router of the local network: enables the IP forwarding and installs the nftables, or iptables, rules redirecting the TCP connections of the clients on --gateway-interface to a transparent proxy, which balances them across the sources, removing them on exit. The rest of the forwarded traffic is masqueraded. Point the default route of the clients, e.g. through DHCP, to the host (Linux only, IPv4 only, requires root)")
+	serverCmd.Flags().IntVar(&gatewayPort, "gateway-port", 1090, "Listening port of the transparent proxy of the gateway mode")
+	serverCmd.Flags().StringSliceVar(&gatewayInterfaces, "gateway-interface", []string{}, "Interfaces of the local network whose clients use the host as their gateway, e.g. eth0, in gateway mode")
+	serverCmd.Flags().StringSliceVar(&gatewayExclude, "gateway-exclude", gateway.DefaultExclude, "Destinations, as addresses or networks in CIDR notation, routed as usual instead of through the transparent proxy, in gateway mode. The connections to the host itself, e.g. to the API, and the ones of booster are never redirected")
+	serverCmd.Flags().StringVar(&gatewayBackend, "gateway-backend", "", "Firewall the rules of the gateway mode are installed with, either nft or iptables. Defaults to nft when installed, iptables otherwise")
+
+	// DHCP configuration
+	serverCmd.Flags().StringArrayVar(&dhcpRanges, "dhcp-range", []string{}, "Serves DHCP on an interface of the local network, handing out the addresses of a range, in the form interface=start-end, e.g. eth0=192.168.50.100-192.168.50.200, with the address of the interface on their network as router, completing the gateway mode (Linux only, requires root)")
+	serverCmd.Flags().StringSliceVar(&dhcpDNS, "dhcp-dns", []string{}, "DNS servers handed out by the DHCP server. Defaults to the ones of /etc/resolv.conf not on the loopback, whose queries the gateway forwards as the rest of the UDP traffic")
+	serverCmd.Flags().DurationVar(&dhcpLeaseTime, "dhcp-lease-time", dhcp.DefaultLeaseTime, "Duration of the leases of the DHCP server")
+
+	// Watchdog configuration
+	serverCmd.Flags().DurationVar(&serverConfig.WatchdogInterval, "watchdog-interval", d.WatchdogInterval, "Time between two counts of the goroutines and of the file descriptors, warning when they exceed their thresholds, e.g. because of a leak. If 0, the watchdog is disabled")
+	serverCmd.Flags().StringSliceVar(&watchdogGoroutines, "watchdog-goroutines", []string{}, "Thresholds of the goroutines: a number, for the total, or subsystem=number, for the ones of a subsystem: listener, prober, proxy, turbo or api, e.g. 20000,proxy=15000")
+	serverCmd.Flags().IntVar(&serverConfig.WatchdogFDs, "watchdog-fds", 0, "Threshold of the open file descriptors. If 0, 80% of the limit of the process")
+	serverCmd.Flags().StringVar(&serverConfig.WatchdogDumpDir, "watchdog-dump-dir", "", "If set, the stacks of the goroutines are dumped into this directory when a threshold is exceeded")
+	serverCmd.Flags().StringVar(&serverConfig.CrashDir, "crash-dir", "", "If set, the reports of the panics recovered while handling the connections are written into this directory, one json file each, e.g. to upload them later")
+
+	// Privileges configuration
+	serverCmd.Flags().StringVar(&runAsUser, "user", "", "User booster runs as once its listeners are bound. Requires booster to be started as root, which clears its capabilities when switching user. Binding connections to the network interfaces without privileges requires Linux 5.7 or later")
+	serverCmd.Flags().StringVar(&runAsGroup, "group", "", "Group booster runs as once its listeners are bound. Defaults to the primary group of --user")
+
+	// Discovery configuration
+	serverCmd.Flags().StringVar(&configDir, "config-dir", "", "If set, the flags not passed on the command line are read from the files of this directory, each named after a flag, e.g. a mounted Kubernetes ConfigMap, with a value per line. The BOOSTER_<FLAG> environment variables, e.g. BOOSTER_REMOTE_SOURCE, take precedence over them")
+	serverCmd.Flags().DurationVar(&shutdownDelay, "shutdown-delay", 0, "Time booster keeps serving after being asked to stop, failing its readiness check, e.g. while the other containers of its pod shut down. A second signal stops it immediately")
+	serverCmd.Flags().BoolVar(&mdns, "mdns", false, "If set, advertises the SOCKS5 proxy, the API and the turbo proxy on the local network via mDNS/DNS-SD, as _socks5._tcp, _http._tcp (or _https._tcp) and _http-proxy._tcp. Anyone on the network then finds the proxies, which do not authenticate their clients: restrict them with --allow-clients")
+	serverCmd.Flags().BoolVar(&natMap, "nat-map", false, "If set, maps the API port, when it requires tokens and TLS, and the turbo proxy port, when clients are restricted with --allow-clients, on the local router using NAT-PMP or UPnP. The SOCKS5 proxy port is never mapped")
+
+	// Turbo proxy configuration
+	serverCmd.Flags().IntVar(&serverConfig.TurboPort, "turbo-port", 0, "If not 0, starts an HTTP proxy on this port that splits large downloads across sources")
+	serverCmd.Flags().BoolVar(&serverConfig.TurboTLS, "turbo-tls", false, "If set, the turbo proxy is served over TLS, as an HTTPS proxy, with the certificate of --api-tls-cert or --api-acme-host")
+	serverCmd.Flags().Int64Var(&serverConfig.TurboMinSize, "turbo-min-size", d.TurboMinSize, "Minimum size in bytes of a download to be split by the turbo proxy")
+	serverCmd.Flags().IntVar(&serverConfig.TurboSegments, "turbo-segments", d.TurboSegments, "Number of parallel ranged requests used by the turbo proxy")
+	serverCmd.Flags().BoolVar(&serverConfig.MatchProcesses, "match-process", false, "If set, the turbo proxy finds the local process that sent each request, applying the process policies (Linux only)")
+	serverCmd.Flags().StringSliceVar(&serverConfig.ProxyProtocol, "proxy-protocol", []string{}, "Load balancers, as addresses or networks in CIDR notation, allowed to send a PROXY protocol (v1 or v2) header to the turbo proxy, the SOCKS5 proxies and the tunnel, which then see the address of the clients")
+	serverCmd.Flags().StringSliceVar(&serverConfig.AllowClients, "allow-clients", []string{}, "Clients allowed to use the proxies, as addresses or networks in CIDR notation. If empty, every client that is not denied is allowed. Can be changed through the API")
+	serverCmd.Flags().StringSliceVar(&serverConfig.DenyClients, "deny-clients", []string{}, "Clients refused by the proxies, as addresses or networks in CIDR notation. Can be changed through the API")
+	serverCmd.Flags().StringVar(&serverConfig.SchedulesFile, "schedules-file", "", "If set, the time rules denying clients the proxies, e.g. parental controls, are saved into this file, and restored at startup. The rules are managed through the API")
+	serverCmd.Flags().IntVar(&serverConfig.BufferSize, "buffer-size", d.BufferSize, "Size in bytes of the pooled buffers used to relay data between connections")
+
+	// Sources configuration
+	serverCmd.Flags().BoolVar(&serverConfig.MultipathTCP, "mptcp", false, "If set, dials connections using MultiPath TCP, adding a subflow for each source (Linux only)")
+	serverCmd.Flags().DurationVar(&serverConfig.EmptyWait, "empty-wait", d.EmptyWait, "Maximum time a connection waits for a source to become available when there is none, e.g. 5s while the interfaces come up at boot. If 0, connections fail immediately")
+	serverCmd.Flags().IntSliceVar(&serverConfig.SniffPorts, "sniff-ports", []int{}, "Ports of the connections by IP address whose TLS ClientHello or HTTP request is inspected, so that the server name or Host header it contains is used to apply the hostname policies and to collect the metrics, e.g. 80,443")
+	serverCmd.Flags().DurationVar(&serverConfig.SniffTimeout, "sniff-timeout", d.SniffTimeout, "Maximum time a sniffed connection waits for the client to write before being dialed by IP address")
+	serverCmd.Flags().BoolVar(&serverConfig.Classify, "classify", false, "If set, the protocol of each connection (http, tls, ssh, bittorrent) is detected from the first bytes sent by the client, before choosing the source, so that protocol policies apply. Connections whose server talks first are delayed by the sniff timeout")
+	serverCmd.Flags().DurationVar(&serverConfig.DialTimeout, "dial-timeout", 0, "Maximum time each attempt to dial a connection through a source can take before trying the next one. If 0, only the system timeout applies. Sources can override it through the API")
+	serverCmd.Flags().DurationVar(&serverConfig.KeepAlive, "keepalive", 0, "Interval between the TCP keep-alive probes of the upstream connections. If 0, the system default is used, if negative keep-alives are disabled. Sources can override it through the API")
+	serverCmd.Flags().BoolVar(&serverConfig.RaceSources, "race-sources", false, "If set, connects through the two best sources at once and uses the connection established first, unless a sticky policy applies")
+	serverCmd.Flags().DurationVar(&serverConfig.RaceDelay, "race-delay", d.RaceDelay, "Head start of the best source when racing: the other one is dialed only if the connection is not established in time, or as soon as it fails")
+	serverCmd.Flags().IntVar(&serverConfig.PoolSize, "pool-size", 0, "Number of upstream connections established in advance to each destination dialed repeatedly, for each source, so that new connections skip the handshake. If 0, no connection is pooled")
+	serverCmd.Flags().DurationVar(&serverConfig.PoolTTL, "pool-ttl", d.PoolTTL, "Maximum time a pooled connection is kept before being closed. Destinations dialed again within this time are pooled")
+	serverCmd.Flags().IntVar(&serverConfig.PoolDestinations, "pool-destinations", d.PoolDestinations, "Maximum number of destinations pooled at once")
+	serverCmd.Flags().StringSliceVar(&resetRules, "reset-on-failure", []string{}, "Connections reset as soon as their source fails, instead of hanging until they time out, so that the clients reconnect through a healthy source: all, or ports, protocols or both, e.g. 443,ssh,tls:8443")
+	serverCmd.Flags().DurationVar(&serverConfig.IdleTimeout, "idle-timeout", 0, "Upstream connections that do not transfer any data for longer are closed. If 0, idle connections are kept open. Sources can override it through the API")
+	serverCmd.Flags().StringSliceVar(&serverConfig.Metered, "metered", []string{}, "Sources that should be tagged as metered, regardless of what is detected")
+	serverCmd.Flags().StringSliceVar(&serverConfig.Unmetered, "unmetered", []string{}, "Sources that should be tagged as unmetered, regardless of what is detected")
+	serverCmd.Flags().BoolVar(&serverConfig.PreferUnmetered, "prefer-unmetered", false, "If set, metered sources are used only when no unmetered source is available or all of them are saturated")
+	serverCmd.Flags().IntVar(&serverConfig.SaturationConns, "saturation-conns", 0, "Number of open connections after which a source is considered saturated. If 0, sources are never saturated")
+	serverCmd.Flags().DurationVar(&serverConfig.WarmUp, "warm-up", d.WarmUp, "Duration during which the share of the new connections of a source that comes back after a failure grows gradually to the full one, so that marginal links are not flooded. If 0, sources are not warmed up")
+	serverCmd.Flags().DurationVar(&serverConfig.FailbackDelay, "failback-delay", 0, "Stabilization period during which the new connections are kept away from a source that comes back after a failure, so that a flapping link does not make the traffic ping-pong. If 0, sources are used as soon as they come back")
+	serverCmd.Flags().IntVar(&serverConfig.FailbackConns, "failback-conns", 0, "After the --failback-delay, keep holding back the sources that come back until less than these connections are open through the other ones. If 0, it is not considered")
+	serverCmd.Flags().BoolVar(&serverConfig.Standby, "standby", false, "Hot standby mode: send all the traffic through the active source, switching over to a standby one only when it goes down or fails its probes for longer than --standby-window")
+	serverCmd.Flags().DurationVar(&serverConfig.StandbyWindow, "standby-window", d.StandbyWindow, "Duration the active source has to fail its probes for before switching over to a standby one, in hot standby mode")
+	serverCmd.Flags().StringSliceVar(&serverConfig.Secondary, "secondary", []string{}, "Sources used only when the primary ones are unavailable or saturated")
+	serverCmd.Flags().StringSliceVar(&serverConfig.Backup, "backup", []string{}, "Sources used only when the primary and secondary ones are unavailable or saturated")
+	serverCmd.Flags().StringArrayVar(&sourceGroups, "source-group", []string{}, "Group of sources, in the form name[:weight]=pattern,pattern, e.g. lte:2=wwan*,usb*. The group name can be used in place of its members when tagging sources, assigning tiers and creating policies, and its weight is used by the weighted strategy")
+	serverCmd.Flags().StringArrayVar(&staticSources, "static-source", []string{}, "Development source that dials through the default route, in the form name[:option,option], e.g. lte:latency=80ms,bandwidth=20M,metered. Useful to exercise policies and strategies on machines with a single network interface")
+	serverCmd.Flags().StringArrayVar(&remoteSources, "remote-source", []string{}, "Source that dials through a remote SOCKS5 proxy, e.g. another booster instance, in the form name:address=host:port[,option], where the options are proxy-protocol=<1|2>, which announces the original client with a PROXY protocol header, and metered")
+	serverCmd.Flags().StringArrayVar(&gatewaySources, "gateway-source", []string{}, "Source identified by the router its connections leave through, in the form name:gateway=ip[,metered], e.g. lte:gateway=192.168.8.1. Its connections are dialed from the local address on the subnet of the gateway, which the routing has to send through it. Useful in containers, where the interfaces cannot be bound to")
+	serverCmd.Flags().BoolVar(&serverConfig.Container, "container", false, "Container mode, not requiring the NET_RAW and NET_ADMIN capabilities: the interfaces are inspected through the sysfs at --sysfs, leaving out the virtual ones, and their connections are dialed from their addresses instead of being bound to their devices")
+	serverCmd.Flags().StringVar(&serverConfig.SysFS, "sysfs", d.SysFS, "Where the sysfs of the host is mounted, e.g. /host/sys, in container mode")
+	serverCmd.Flags().BoolVar(&serverConfig.Sidecar, "sidecar", false, "Egress sidecar mode, e.g. in a Kubernetes pod: each replica balances the egress of its own pod with no shared nor persisted state, so that they need no coordination. Implies --container, disables mDNS and NAT mapping, and rejects the options persisting state")
+	serverCmd.Flags().StringArrayVar(&sourceMarks, "source-fwmark", []string{}, "Firewall mark of the connections of a source, or group, in the form source=mark, e.g. wg0=0x10, for the ip rule policy routing and the nftables accounting (Linux only, requires CAP_NET_ADMIN). The fwmark policies override it")
+	serverCmd.Flags().StringArrayVar(&sourceDNS, "source-dns", []string{}, "DNS servers resolving the host names dialed through an interface, in the form interface=ip,ip, e.g. wwan0=10.0.0.1. The queries are sent through the interface itself")
+	serverCmd.Flags().StringArrayVar(&sourceECS, "source-ecs", []string{}, "EDNS Client Subnet of the DNS queries sent through an interface, in the form interface=subnet, announcing a subnet of its exit network, e.g. wwan0=203.0.113.0/24, or interface=strip, removing the option, so that the answers of the CDNs suit the location of the interface")
+	serverCmd.Flags().BoolVar(&serverConfig.DiscoverDNS, "discover-dns", d.DiscoverDNS, "If set, the host names dialed through each interface are resolved with its own DNS servers, e.g. the ones assigned by DHCP, discovered through systemd-resolved, NetworkManager or scutil, so that the queries do not leak through the other links")
+	serverCmd.Flags().IntVar(&serverConfig.DNSCacheSize, "dns-cache-size", d.DNSCacheSize, "Number of DNS answers cached in process, shared by the dialers of the sources and the bind history. If 0, the answers are not cached")
+	serverCmd.Flags().DurationVar(&serverConfig.DNSCacheMinTTL, "dns-cache-min-ttl", d.DNSCacheMinTTL, "Minimum time the DNS answers are cached for, whatever their TTL")
+	serverCmd.Flags().DurationVar(&serverConfig.DNSCacheMaxTTL, "dns-cache-max-ttl", d.DNSCacheMaxTTL, "Maximum time the DNS answers are cached for, whatever their TTL")
+	serverCmd.Flags().StringVar(&serverConfig.LabelsFile, "labels-file", "", "If set, the display names and labels assigned to the sources are saved into this file, and restored at startup. Labels can be used to target sources in policies, e.g. label:metered=true")
+	serverCmd.Flags().StringVar(&serverConfig.DisabledFile, "disabled-file", "", "If set, the sources disabled through the API are saved into this file, and remain disabled after a restart")
+	serverCmd.Flags().StringArrayVar(&domainSets, "domain-set", []string{}, "Named set of domains, in the form name=domain,domain, e.g. banking=mybank.com,paypal.com. The sticky policy can be restricted to some sets through the API, so that the other connections are balanced freely")
+	serverCmd.Flags().IntVar(&serverConfig.BindHistorySize, "bind-history-size", d.BindHistorySize, "Maximum number of destinations recorded by the sticky policy, after which the least recently used are forgotten. If 0, it is not limited")
+	serverCmd.Flags().Int64Var(&serverConfig.BindHistoryMemory, "bind-history-memory", d.BindHistoryMemory, "Maximum estimated size in bytes of the destinations recorded by the sticky policy. If 0, it is not limited")
+	serverCmd.Flags().IntVar(&serverConfig.RecordDecisions, "record-decisions", 0, "Number of the last source selections recorded, so that proposed policies can be simulated against them through the API before applying them")
+
+	// GeoIP configuration
+	serverCmd.Flags().StringSliceVar(&serverConfig.GeoIPDBs, "geoip-db", []string{}, "MaxMind GeoLite2 or GeoIP2 database files (.mmdb), e.g. the Country and ASN ones, used by the geo policies")
+	serverCmd.Flags().DurationVar(&serverConfig.GeoIPReload, "geoip-reload", d.GeoIPReload, "Interval between checks for updated GeoIP database files")
+
+	// Blocklist configuration
+	serverCmd.Flags().StringArrayVar(&blocklists, "blocklist", []string{}, "Ad or tracker blocklist, in hosts format or with one domain per line, in the form name=location, where location is a file or an http(s) URL, e.g. ads=https://example.com/hosts. The connections to the hosts listed are refused. Each list can be disabled through the API")
+	serverCmd.Flags().DurationVar(&serverConfig.BlocklistRefresh, "blocklist-refresh", d.BlocklistRefresh, "Interval between the refreshes of the blocklists")
+
+	// Balancer configuration
+	serverCmd.Flags().StringVar(&serverConfig.Strategy, "strategy", d.Strategy, "Strategy used to choose the source of each connection, either round-robin, weighted, latency, bandwidth (measured by the speed tests), hash (which keeps using the same source for each destination, while it is available) or plugin:<name>, provided by the plugin <name>.wasm")
+	serverCmd.Flags().BoolVar(&serverConfig.HashClient, "hash-client", false, "If set, the hash strategy hashes the address of the client, when known, together with the destination")
+	serverCmd.Flags().StringSliceVar(&protocolStrategies, "protocol-strategy", []string{}, "Strategies used for the connections of a protocol in place of the default one, in the form protocol=strategy, e.g. ssh=latency,http=bandwidth. Enables --classify")
+	serverCmd.Flags().StringVar(&serverConfig.ProbeAnchor, "probe-anchor", d.ProbeAnchor, "TCP address dialed through each source to measure its latency and loss")
+	serverCmd.Flags().DurationVar(&serverConfig.ProbeInterval, "probe-interval", d.ProbeInterval, "Interval between source probes. If 0, sources are not probed")
+
+	// Plugins configuration
+	serverCmd.Flags().StringVar(&serverConfig.PluginsDir, "plugins-dir", "", "If set, the WebAssembly plugins (.wasm) in this directory are loaded, adding their policies and strategies")
+
+	// Speedtest configuration
+	serverCmd.Flags().StringVar(&serverConfig.SpeedtestURL, "speedtest-url", d.SpeedtestURL, "URL downloaded through each source to measure its capacity")
+	serverCmd.Flags().StringVar(&serverConfig.SpeedtestToken, "speedtest-token", "", "API token sent when the speedtest URL is the download endpoint of another booster having API tokens")
+	serverCmd.Flags().DurationVar(&serverConfig.SpeedtestDuration, "speedtest-duration", d.SpeedtestDuration, "Maximum duration of each speed test")
+	serverCmd.Flags().DurationVar(&serverConfig.SpeedtestInterval, "speedtest-interval", 0, "Interval between scheduled speed tests of all sources. If 0, speed tests only run on demand")
+
+	// Public IP configuration
+	serverCmd.Flags().DurationVar(&serverConfig.PublicIPInterval, "public-ip-interval", 0, "Interval between the detections of the public IP of each source, published as source.public_ip events when it changes. If 0, the public IPs are not detected, unless --ddns is set")
+	serverCmd.Flags().StringSliceVar(&serverConfig.PublicIPServers, "public-ip-server", d.PublicIPServers, "Servers asked, in order, the public IP of the sources: URLs of HTTP(S) echo services, replying the address in plain text, or STUN servers, as stun:host[:port]")
+	serverCmd.Flags().StringArrayVar(&ddnsRecords, "ddns", []string{}, "Dynamic DNS record updated with the public IP of a source, in the form source:cloudflare,zone=<zone id>,token=<api token>,hostname=<name>[,ttl=<seconds>] or source:dyndns,hostname=<name>,username=<user>,password=<password>[,url=<update url>], e.g. for No-IP. Enables the public IP detection")
+
+	// History configuration
+	serverCmd.Flags().StringVar(&serverConfig.HistoryDir, "history-dir", "", "If set, the per source metrics history is stored in this directory")
+	serverCmd.Flags().DurationVar(&serverConfig.HistoryRetention, "history-retention", d.HistoryRetention, "Amount of time the metrics history is kept for")
+	serverCmd.Flags().DurationVar(&serverConfig.HistoryInterval, "history-interval", d.HistoryInterval, "Interval between the samples of the metrics history")
+	serverCmd.Flags().StringVar(&serverConfig.ReportPeriod, "report", "", "If set, a report of the data used by source and by domain is produced at the end of each period, either daily or weekly. Requires --history-dir")
+	serverCmd.Flags().BoolVar(&serverConfig.ReportMail, "report-mail", false, "If set, the reports are sent by email, using the --notify-smtp configuration")
+
+	// InfluxDB configuration
+	serverCmd.Flags().StringVar(&serverConfig.InfluxURL, "influx-url", "", "If set, the per source metrics are pushed to this InfluxDB write URL, or Telegraf socket (udp://, tcp:// or unix://)")
+	serverCmd.Flags().StringVar(&serverConfig.InfluxToken, "influx-token", "", "Token used to authenticate to InfluxDB")
+	serverCmd.Flags().DurationVar(&serverConfig.InfluxInterval, "influx-interval", d.InfluxInterval, "Interval between metrics pushes")
+
+	// Notifications configuration
+	serverCmd.Flags().StringSliceVar(&serverConfig.NotifyWebhooks, "notify-webhook", []string{}, "Webhook URLs the events are posted to, e.g. a Slack incoming webhook")
+	serverCmd.Flags().StringVar(&serverConfig.NotifySMTP, "notify-smtp", "", "If set, the events are sent by email through this SMTP server, in the form host:port")
+	serverCmd.Flags().StringVar(&serverConfig.NotifySMTPUser, "notify-smtp-user", "", "Username used to authenticate to the SMTP server")
+	serverCmd.Flags().StringVar(&serverConfig.NotifySMTPPassword, "notify-smtp-password", "", "Password used to authenticate to the SMTP server")
+	serverCmd.Flags().StringVar(&serverConfig.NotifyMailFrom, "notify-mail-from", "", "Sender of the notification emails")
+	serverCmd.Flags().StringSliceVar(&serverConfig.NotifyMailTo, "notify-mail-to", []string{}, "Recipients of the notification emails")
+	serverCmd.Flags().BoolVar(&serverConfig.NotifyDesktop, "notify-desktop", false, "If set, the events are shown as desktop notifications")
+	serverCmd.Flags().StringSliceVar(&serverConfig.NotifyTopics, "notify-topics", []string{}, "Topics of the events notified, e.g. source.down,source.failover. If empty, every event is notified")
+	serverCmd.Flags().DurationVar(&serverConfig.NotifyCooldown, "notify-cooldown", d.NotifyCooldown, "Minimum interval between two notifications of the same event")
+
+	// MQTT configuration
+	serverCmd.Flags().StringVar(&serverConfig.MQTTBroker, "mqtt-broker", "", "If set, the events are published to this MQTT broker, e.g. tcp://localhost:1883 or tls://broker:8883")
+	serverCmd.Flags().StringVar(&serverConfig.MQTTClientID, "mqtt-client-id", d.MQTTClientID, "Client identifier used to connect to the MQTT broker")
+	serverCmd.Flags().StringVar(&serverConfig.MQTTUser, "mqtt-user", "", "Username used to authenticate to the MQTT broker")
+	serverCmd.Flags().StringVar(&serverConfig.MQTTPassword, "mqtt-password", "", "Password used to authenticate to the MQTT broker")
+	serverCmd.Flags().StringVar(&serverConfig.MQTTPrefix, "mqtt-prefix", d.MQTTPrefix, "Prefix of the MQTT topics, e.g. the source.down events are published on <prefix>/source/down")
+	serverCmd.Flags().BoolVar(&serverConfig.MQTTConnEvents, "mqtt-conn-events", false, "If set, the events of each connection opened and closed are published as well, on <prefix>/conn/open and <prefix>/conn/close")
+
+	// Tracing configuration
+	serverCmd.Flags().StringVar(&otlpEndpoint, "otlp-endpoint", "", "If set, traces are exported to this OTLP/HTTP collector URL, e.g. http://localhost:4318/v1/traces")
+	serverCmd.Flags().Float64Var(&traceRatio, "trace-ratio", 1, "Fraction of the connections traced, from 0 to 1")
 }
 
 func captureSignals(cancel context.CancelFunc) {
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, os.Kill)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
 		for range c {
@@ -0,0 +1,37 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"net"
+
+	"upspin.io/log"
+)
+
+// activatedListener returns the listener named `name` among the ones
+// passed by systemd, or nil if there is none. Only one listener per
+// service is supported, the others are closed.
+func activatedListener(activated map[string][]net.Listener, name string) net.Listener {
+	ls := activated[name]
+	if len(ls) == 0 {
+		return nil
+	}
+	for _, v := range ls[1:] {
+		log.Error.Printf("Ignoring additional %s socket %v", name, v.Addr())
+		v.Close()
+	}
+	return ls[0]
+}
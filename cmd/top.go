@@ -0,0 +1,224 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/booster-proj/booster"
+	"github.com/booster-proj/booster/dialer"
+	"github.com/booster-proj/booster/events"
+	"github.com/booster-proj/booster/history"
+	"github.com/booster-proj/booster/remote"
+	"github.com/booster-proj/booster/store"
+	"github.com/spf13/cobra"
+	"upspin.io/log"
+)
+
+var (
+	topClient remote.Client
+	topConns  int
+)
+
+// topBarWidth is the width of the throughput bars, in characters.
+const topBarWidth = 20
+
+// topCmd represents the top command
+var topCmd = &cobra.Command{
+	Use:   "top",
+	Short: "Show the throughput, the connections and the policy hits of a running booster",
+	Long: `Top shows, in the terminal, the throughput of each source, the connections open
+and how many times each policy refused a source, updating them as the event
+stream of the API of a running booster reports them. The token used is read
+from the BOOSTER_TOKEN environment variable, unless provided with --token.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if topClient.Token == "" {
+			topClient.Token = os.Getenv("BOOSTER_TOKEN")
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		captureSignals(cancel)
+
+		t := &topView{conns: make(map[uint64]dialer.ConnInfo)}
+		// The connections opened before are listed once, the
+		// following ones are reported by the events.
+		if conns, err := topClient.Conns(ctx); err == nil {
+			for _, v := range conns {
+				t.conns[v.ID] = v
+			}
+		}
+
+		// Use the alternate screen, restoring the previous one on
+		// exit.
+		fmt.Print("\x1b[?1049h")
+		err := topClient.Stream(ctx, nil, func(e events.Event) error {
+			return t.update(e, os.Stdout)
+		})
+		fmt.Print("\x1b[?1049l")
+		if err != nil && err != context.Canceled {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(topCmd)
+
+	d := booster.DefaultConfig
+	topCmd.Flags().StringVar(&topClient.URL, "api", fmt.Sprintf("http://localhost:%d", d.APIPort), "Address of the API of the running booster, or unix:// followed by the path of its socket")
+	topCmd.Flags().StringVar(&topClient.Token, "token", "", "Secret of the API token used. Defaults to the value of BOOSTER_TOKEN")
+	topCmd.Flags().IntVar(&topConns, "conns", 10, "Maximum number of connections listed, the most recent first")
+}
+
+// topView is the state shown by the top command.
+type topView struct {
+	stats, prev remote.Stats
+	last        time.Time
+	elapsed     time.Duration
+	conns       map[uint64]dialer.ConnInfo
+	events      []events.Event
+}
+
+// update applies `e` to the view, drawing it again into `w` when `e`
+// contains new statistics.
+func (t *topView) update(e events.Event, w io.Writer) error {
+	data, _ := e.Data.(json.RawMessage)
+	switch e.Topic {
+	case remote.TopicStats:
+		var stats remote.Stats
+		if err := json.Unmarshal(data, &stats); err != nil {
+			return err
+		}
+		if !t.last.IsZero() {
+			t.elapsed = e.Time.Sub(t.last)
+		}
+		t.prev, t.stats, t.last = t.stats, stats, e.Time
+		t.draw(w)
+	case events.TopicConnOpen, events.TopicConnClose:
+		var info dialer.ConnInfo
+		if err := json.Unmarshal(data, &info); err != nil {
+			return err
+		}
+		if e.Topic == events.TopicConnOpen {
+			t.conns[info.ID] = info
+		} else {
+			delete(t.conns, info.ID)
+		}
+	default:
+		t.events = append(t.events, e)
+		if n := len(t.events) - 5; n > 0 {
+			t.events = t.events[n:]
+		}
+	}
+	return nil
+}
+
+// rates returns the bytes received and sent per second through `src`
+// since the previous statistics, or zero if its counters were reset
+// in the meanwhile.
+func (t *topView) rates(src *store.DummySource) (int64, int64) {
+	if t.elapsed <= 0 {
+		return 0, 0
+	}
+	for _, v := range t.prev.Sources {
+		if v.ID == src.ID && src.Received >= v.Received && src.Sent >= v.Sent {
+			secs := t.elapsed.Seconds()
+			return int64(float64(src.Received-v.Received) / secs), int64(float64(src.Sent-v.Sent) / secs)
+		}
+	}
+	return 0, 0
+}
+
+func (t *topView) draw(w io.Writer) {
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	fmt.Fprintf(&b, "booster top - %s - %s\n\n", topClient.URL, t.last.Format("15:04:05"))
+
+	type row struct {
+		src      *store.DummySource
+		down, up int64
+	}
+	rows := make([]row, 0, len(t.stats.Sources))
+	var max int64
+	for _, v := range t.stats.Sources {
+		down, up := t.rates(v)
+		rows = append(rows, row{v, down, up})
+		if down > max {
+			max = down
+		}
+		if up > max {
+			max = up
+		}
+	}
+	fmt.Fprintf(&b, "%-12s %-9s %5s  %-*s  %s\n", "SOURCE", "STATE", "CONNS", topBarWidth+13, "DOWN", "UP")
+	for _, v := range rows {
+		fmt.Fprintf(&b, "%-12s %-9s %5d  %s %-12s %s %s\n", v.src.ID, v.src.State, v.src.Conns,
+			topBar(v.down, max), history.FormatBytes(v.down)+"/s", topBar(v.up, max), history.FormatBytes(v.up)+"/s")
+	}
+
+	ids := make([]string, 0, len(t.stats.PolicyHits))
+	for id := range t.stats.PolicyHits {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		hi, hj := t.stats.PolicyHits[ids[i]], t.stats.PolicyHits[ids[j]]
+		return hi > hj || (hi == hj && ids[i] < ids[j])
+	})
+	fmt.Fprintf(&b, "\n%-40s %s\n", "POLICY", "HITS")
+	for _, id := range ids {
+		fmt.Fprintf(&b, "%-40s %d\n", id, t.stats.PolicyHits[id])
+	}
+
+	conns := make([]dialer.ConnInfo, 0, len(t.conns))
+	for _, v := range t.conns {
+		conns = append(conns, v)
+	}
+	sort.Slice(conns, func(i, j int) bool { return conns[i].ID > conns[j].ID })
+	fmt.Fprintf(&b, "\nCONNECTIONS (%d open)\n", len(conns))
+	fmt.Fprintf(&b, "%-8s %-12s %-40s %s\n", "ID", "SOURCE", "TARGET", "AGE")
+	for i, v := range conns {
+		if topConns > 0 && i == topConns {
+			break
+		}
+		fmt.Fprintf(&b, "%-8d %-12s %-40s %v\n", v.ID, v.Source, v.Target, t.last.Sub(v.Started).Round(time.Second))
+	}
+
+	if len(t.events) > 0 {
+		b.WriteString("\nEVENTS\n")
+		for _, v := range t.events {
+			fmt.Fprintf(&b, "%s %-16s %s\n", v.Time.Format("15:04:05"), v.Topic, v.Message)
+		}
+	}
+	io.WriteString(w, b.String())
+}
+
+// topBar returns a bar whose length is proportional to `n` over
+// `max`.
+func topBar(n, max int64) string {
+	var fill int
+	if max > 0 {
+		fill = int(n * topBarWidth / max)
+	}
+	return strings.Repeat("█", fill) + strings.Repeat("░", topBarWidth-fill)
+}
@@ -0,0 +1,78 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+
+	"upspin.io/log"
+)
+
+// listenUnix binds the Unix socket at `path`, with permissions `mode`
+// and, if not empty, owned by `group`, exiting on failure. A stale
+// socket left at `path` by a previous booster is replaced.
+func listenUnix(path string, mode os.FileMode, group string) net.Listener {
+	ln, err := bindUnix(path, mode, group)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return ln
+}
+
+func bindUnix(path string, mode os.FileMode, group string) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("unable to listen on %s: not a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("unable to listen on %s: already in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			if g, err = user.LookupGroupId(group); err != nil {
+				ln.Close()
+				return nil, fmt.Errorf("unknown group %q", group)
+			}
+		}
+		gid, err := strconv.Atoi(g.Gid)
+		if err == nil {
+			err = os.Lchown(path, -1, gid)
+		}
+		if err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+	return ln, nil
+}
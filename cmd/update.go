@@ -0,0 +1,229 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/booster-proj/booster/update"
+	"github.com/spf13/cobra"
+	"upspin.io/log"
+)
+
+var (
+	updateCheck     bool
+	updateForce     bool
+	updateRollback  bool
+	updatePublicKey string
+	updateRestart   string
+	updateHealthURL string
+	updateTimeout   time.Duration
+)
+
+// updateCmd represents the update command
+var updateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Replace booster with the latest release",
+	Long: `Update downloads the latest release of booster from GitHub, verifies its signature
+and checksum and replaces the running binary with it. The new binary has to report
+the version of the release, otherwise the previous one is restored; the same happens
+if --health-url is set and it does not become healthy, e.g. after being restarted
+with --restart "systemctl restart booster". The previous binary is kept next to the
+new one, and can be restored with --rollback.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		captureSignals(cancel)
+
+		var restarted bool
+		u := update.Updater{}
+		if updateRollback {
+			if err := u.Rollback(); err != nil {
+				log.Fatal(err)
+			}
+			restart(updateRestart)
+			fmt.Println("Previous binary restored")
+			return
+		}
+
+		key := updatePublicKey
+		if key == "" {
+			key = update.PublicKey
+		}
+		pub, err := update.ParsePublicKey(key)
+		if err != nil {
+			log.Fatal(err)
+		}
+		u.PublicKey = pub
+		u.Check = func(ctx context.Context, path string, rel update.Release) error {
+			if err := update.ReportsVersion(ctx, path, rel); err != nil {
+				return err
+			}
+			if updateRestart != "" {
+				restarted = true
+				if err := restart(updateRestart); err != nil {
+					return err
+				}
+			}
+			if updateHealthURL != "" {
+				return waitHealthy(ctx, updateHealthURL, updateTimeout)
+			}
+			return nil
+		}
+
+		rel, err := u.Latest(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// A signed release could be replayed to downgrade booster:
+		// the older releases are installed only when forced.
+		switch c, err := compareRelease(rel.Tag); {
+		case updateForce:
+		case err != nil:
+			log.Fatalf("%v, use --force to install it anyway", err)
+		case c == 0:
+			fmt.Printf("booster %s is up to date\n", Version)
+			return
+		case c < 0:
+			fmt.Printf("booster %s is older than the running %s, use --force to downgrade\n", rel.Tag, Version)
+			return
+		}
+		if updateCheck {
+			fmt.Printf("booster %s is available, current version is %s\n", rel.Tag, Version)
+			return
+		}
+		if err := u.Apply(ctx, rel); err != nil {
+			if restarted {
+				restart(updateRestart)
+			}
+			log.Fatal(err)
+		}
+		fmt.Printf("booster updated from %s to %s\n", Version, rel.Tag)
+	},
+}
+
+var updateKeygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generate the key pair the releases are signed with",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Public key: %s\n", base64.StdEncoding.EncodeToString(pub))
+		fmt.Printf("Private key: %s\n", base64.StdEncoding.EncodeToString(priv))
+	},
+}
+
+var updateSignCmd = &cobra.Command{
+	Use:   "sign <file>",
+	Short: "Sign a release file, writing the signature to <file>.sig",
+	Long: `Sign signs a release file, usually the checksums file, with the private key read
+from the BOOSTER_SIGNING_KEY environment variable, as generated by keygen.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := base64.StdEncoding.DecodeString(os.Getenv("BOOSTER_SIGNING_KEY"))
+		if err != nil || len(b) != ed25519.PrivateKeySize {
+			log.Fatal("BOOSTER_SIGNING_KEY does not contain a valid private key")
+		}
+		data, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := ioutil.WriteFile(args[0]+".sig", update.Sign(ed25519.PrivateKey(b), data), 0644); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// compareRelease compares release `tag` with the running version, see
+// update.CompareVersions. The development builds, whose version is not
+// a semantic one, precede every release.
+func compareRelease(tag string) (int, error) {
+	if _, err := update.CompareVersions(tag, tag); err != nil {
+		return 0, err
+	}
+	if _, err := update.CompareVersions(Version, Version); err != nil {
+		return 1, nil
+	}
+	return update.CompareVersions(tag, Version)
+}
+
+// restart runs the command `cmdline`, if any, with the shell.
+func restart(cmdline string) error {
+	if cmdline == "" {
+		return nil
+	}
+	out, err := exec.Command("/bin/sh", "-c", cmdline).CombinedOutput()
+	if err != nil {
+		log.Error.Printf("Unable to run %q: %v: %s", cmdline, err, out)
+		return fmt.Errorf("%s: %v", cmdline, err)
+	}
+	return nil
+}
+
+// waitHealthy polls `url` until it answers with a 200 status code, or
+// `timeout` expires.
+func waitHealthy(ctx context.Context, url string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var lastErr error
+	for {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+			err = fmt.Errorf("%s: %s", url, resp.Status)
+		}
+		lastErr = err
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("not healthy after %v: %v", timeout, lastErr)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(updateCmd)
+	updateCmd.AddCommand(updateKeygenCmd, updateSignCmd)
+
+	updateCmd.Flags().BoolVar(&updateCheck, "check", false, "If set, only reports whether a new release is available")
+	updateCmd.Flags().BoolVar(&updateForce, "force", false, "If set, installs the latest release even if it is the current version, or an older one")
+	updateCmd.Flags().BoolVar(&updateRollback, "rollback", false, "If set, restores the binary replaced by the last update")
+	updateCmd.Flags().StringVar(&updatePublicKey, "public-key", "", "Base64 ed25519 key verifying the releases. Defaults to the one booster was built with")
+	updateCmd.Flags().StringVar(&updateRestart, "restart", "", "Shell command restarting the running booster after the binary is replaced, and after a rollback")
+	updateCmd.Flags().StringVar(&updateHealthURL, "health-url", "", "If set, the update is rolled back unless this URL, e.g. http://localhost:7764/readyz, answers with 200")
+	updateCmd.Flags().DurationVar(&updateTimeout, "health-timeout", time.Minute, "Maximum time the updated booster has to become healthy")
+}
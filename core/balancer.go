@@ -52,6 +52,36 @@ func RoundRobin(ctx context.Context, r *Ring) (Source, error) {
 	return r.Source(), nil
 }
 
+type blacklistKey struct{}
+
+// Blacklisted reports whether source `id` is part of the blacklist
+// of the Get call that invoked the strategy with `ctx`. Strategies
+// that do not simply iterate the ring can use it to avoid choosing
+// the same unsuitable source over and over.
+func Blacklisted(ctx context.Context, id string) bool {
+	bl, ok := ctx.Value(blacklistKey{}).(map[string]interface{})
+	if !ok {
+		return false
+	}
+	_, ok = bl[id]
+	return ok
+}
+
+type strategyKey struct{}
+
+// WithStrategy returns a copy of `ctx` carrying `s`, which the Balancer
+// uses in place of its own Strategy.
+func WithStrategy(ctx context.Context, s Strategy) context.Context {
+	return context.WithValue(ctx, strategyKey{}, s)
+}
+
+// StrategyFromContext returns the strategy stored in `ctx` by
+// WithStrategy, if any.
+func StrategyFromContext(ctx context.Context) (Strategy, bool) {
+	s, ok := ctx.Value(strategyKey{}).(Strategy)
+	return s, ok && s != nil
+}
+
 // Balancer distributes work to set of sources, using a particular strategy.
 // The zero value of the Balancer is ready to use and safe to be used by multiple
 // gorountines.
@@ -74,17 +104,22 @@ func (b *Balancer) Get(ctx context.Context, blacklist ...Source) (Source, error)
 	if b.Strategy == nil {
 		b.Strategy = RoundRobin
 	}
+	strategy := b.Strategy
+	if s, ok := StrategyFromContext(ctx); ok {
+		strategy = s
+	}
 	if len(blacklist) == 0 {
-		return b.Strategy(ctx, b.r)
+		return strategy(ctx, b.r)
 	}
 
 	bl := make(map[string]interface{})
 	for _, v := range blacklist {
 		bl[v.ID()] = nil
 	}
+	ctx = context.WithValue(ctx, blacklistKey{}, bl)
 
 	for i := 0; i < b.r.Len(); i++ {
-		s, err := b.Strategy(ctx, b.r)
+		s, err := strategy(ctx, b.r)
 		if err != nil {
 			// Avoid retring if the strategy returns an error.
 			return nil, err
@@ -0,0 +1,97 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"context"
+	"path"
+)
+
+// SourceGroup is a named set of sources, e.g. all the addresses of
+// one network card or all the LTE dongles connected. Groups can be
+// targeted in place of their members, making rules easier to write
+// when many similar sources are available.
+type SourceGroup struct {
+	Name string `json:"name"`
+	// Patterns select the members of the group, either by their
+	// identifier or with a shell pattern such as "wwan*".
+	Patterns []string `json:"patterns"`
+	// Weight is the share of connections each member of the group
+	// receives when the balancer uses the WeightedRoundRobin strategy.
+	Weight int `json:"weight,omitempty"`
+}
+
+// Contains reports whether source `id` is a member of the group.
+func (g *SourceGroup) Contains(id string) bool {
+	for _, v := range g.Patterns {
+		if v == id {
+			return true
+		}
+		if ok, err := path.Match(v, id); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Members returns the sources of `ss` that are members of the group.
+func (g *SourceGroup) Members(ss ...Source) []Source {
+	acc := make([]Source, 0, len(ss))
+	for _, v := range ss {
+		if g.Contains(v.ID()) {
+			acc = append(acc, v)
+		}
+	}
+	return acc
+}
+
+// WeightedRoundRobin returns a strategy that distributes the sources
+// proportionally to their weight, computed with `weight`, using the
+// smooth weighted round robin algorithm. Weights lower than 1 are
+// treated as 1.
+// The strategy keeps state across calls: use each instance with only
+// one Balancer.
+func WeightedRoundRobin(weight func(id string) int) Strategy {
+	current := make(map[string]int)
+	return func(ctx context.Context, r *Ring) (Source, error) {
+		next := make(map[string]int, r.Len())
+		total := 0
+		var best Source
+		r.Do(func(src Source) {
+			id := src.ID()
+			if Blacklisted(ctx, id) {
+				return
+			}
+			w := weight(id)
+			if w < 1 {
+				w = 1
+			}
+			next[id] = current[id] + w
+			total += w
+			if best == nil || next[id] > next[best.ID()] {
+				best = src
+			}
+		})
+		if best == nil {
+			// Every source is blacklisted, let the balancer
+			// reject it.
+			return r.Source(), nil
+		}
+		next[best.ID()] -= total
+		current = next
+		return best, nil
+	}
+}
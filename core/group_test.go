@@ -0,0 +1,80 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+)
+
+func TestSourceGroup_Contains(t *testing.T) {
+	g := &core.SourceGroup{Name: "lte", Patterns: []string{"wwan*", "usb0"}}
+	for id, want := range map[string]bool{
+		"wwan0": true,
+		"wwan1": true,
+		"usb0":  true,
+		"usb1":  false,
+		"en0":   false,
+	} {
+		if ok := g.Contains(id); ok != want {
+			t.Fatalf("Contains(%s): wanted %v, found %v", id, want, ok)
+		}
+	}
+
+	members := g.Members(newMock("wwan0"), newMock("en0"))
+	if len(members) != 1 || members[0].ID() != "wwan0" {
+		t.Fatalf("Unexpected members: %v", members)
+	}
+}
+
+func TestWeightedRoundRobin(t *testing.T) {
+	weights := map[string]int{"s0": 3, "s1": 1}
+	b := &core.Balancer{
+		Strategy: core.WeightedRoundRobin(func(id string) int { return weights[id] }),
+	}
+	s0, s1, s2 := newMock("s0"), newMock("s1"), newMock("s2")
+	b.Put(s0, s1, s2)
+
+	ctx := context.Background()
+	count := make(map[string]int)
+	for i := 0; i < 50; i++ {
+		src, err := b.Get(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count[src.ID()]++
+	}
+	// s2 has no weight, i.e. 1.
+	if count["s0"] != 30 || count["s1"] != 10 || count["s2"] != 10 {
+		t.Fatalf("Unexpected distribution: %v", count)
+	}
+
+	// Blacklisted sources are never chosen.
+	for i := 0; i < 10; i++ {
+		src, err := b.Get(ctx, s0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if src.ID() == "s0" {
+			t.Fatal("Blacklisted source returned")
+		}
+	}
+	if _, err := b.Get(ctx, s0, s1, s2); err == nil {
+		t.Fatal("Expected an error with all sources blacklisted")
+	}
+}
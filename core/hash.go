@@ -0,0 +1,130 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// HashReplicas is the number of points each source of weight 1 has on
+// the ring of the ConsistentHash strategy.
+const HashReplicas = 64
+
+type targetKey struct{}
+
+// WithTarget returns a copy of `ctx` carrying `target`, the host the
+// connection a source is chosen for is directed to.
+func WithTarget(ctx context.Context, target string) context.Context {
+	return context.WithValue(ctx, targetKey{}, target)
+}
+
+// TargetFromContext returns the target stored in `ctx` by WithTarget,
+// if any.
+func TargetFromContext(ctx context.Context) (string, bool) {
+	t, ok := ctx.Value(targetKey{}).(string)
+	return t, ok
+}
+
+type hashPoint struct {
+	hash uint64
+	id   string
+}
+
+// hash64 returns the FNV-1a hash of `s`, mixed with the finalizer of
+// MurmurHash3 as FNV alone spreads poorly the short keys that differ
+// only in their last bytes, such as the points of a source.
+func hash64(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// ConsistentHash returns a strategy that places the sources on a hash
+// ring, each with HashReplicas points for each unit of weight, computed
+// with `weight`, and chooses for each connection the first source
+// found on the ring after the hash of its key. The connections with the
+// same key then use the same source, without keeping track of them,
+// and when a source is added or removed only the keys that map to it
+// move. `key` returns the key of the connection described by `ctx`; if
+// nil, the target stored by WithTarget is used. Weights lower than 1
+// are treated as 1.
+// The strategy keeps state across calls: use each instance with only
+// one Balancer.
+func ConsistentHash(weight func(id string) int, key func(ctx context.Context) string) Strategy {
+	var ring []hashPoint
+	var members string // sources and weights the ring is built from
+	return func(ctx context.Context, r *Ring) (Source, error) {
+		sources := make(map[string]Source, r.Len())
+		ids := make([]string, 0, r.Len())
+		r.Do(func(src Source) {
+			if src != nil {
+				sources[src.ID()] = src
+				ids = append(ids, src.ID())
+			}
+		})
+		if len(ids) == 0 {
+			return r.Source(), nil
+		}
+		sort.Strings(ids)
+		var b strings.Builder
+		weights := make([]int, len(ids))
+		for i, id := range ids {
+			weights[i] = 1
+			if weight != nil && weight(id) > 1 {
+				weights[i] = weight(id)
+			}
+			b.WriteString(id + ":" + strconv.Itoa(weights[i]) + ",")
+		}
+		if b.String() != members {
+			// The sources changed, build the ring again.
+			ring = ring[:0]
+			for i, id := range ids {
+				for j := 0; j < HashReplicas*weights[i]; j++ {
+					ring = append(ring, hashPoint{hash: hash64(id + "#" + strconv.Itoa(j)), id: id})
+				}
+			}
+			sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+			members = b.String()
+		}
+
+		var k string
+		if key != nil {
+			k = key(ctx)
+		} else {
+			k, _ = TargetFromContext(ctx)
+		}
+		h := hash64(k)
+		start := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= h })
+		for i := 0; i < len(ring); i++ {
+			p := ring[(start+i)%len(ring)]
+			if !Blacklisted(ctx, p.id) {
+				return sources[p.id], nil
+			}
+		}
+		// Every source is blacklisted, let the balancer reject it.
+		return r.Source(), nil
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+)
+
+func TestConsistentHash(t *testing.T) {
+	b := &core.Balancer{Strategy: core.ConsistentHash(nil, nil)}
+	s0, s1, s2 := newMock("s0"), newMock("s1"), newMock("s2")
+	b.Put(s0, s1, s2)
+
+	get := func(target string, blacklisted ...core.Source) string {
+		src, err := b.Get(core.WithTarget(context.Background(), target), blacklisted...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return src.ID()
+	}
+
+	before := make(map[string]string)
+	count := make(map[string]int)
+	for i := 0; i < 300; i++ {
+		target := fmt.Sprintf("host%d.com", i)
+		before[target] = get(target)
+		count[before[target]]++
+		if get(target) != before[target] {
+			t.Fatalf("%s: the same target should use the same source", target)
+		}
+	}
+	for _, v := range []string{"s0", "s1", "s2"} {
+		if count[v] < 50 {
+			t.Fatalf("Unbalanced distribution: %v", count)
+		}
+	}
+
+	// Only the targets of the source removed move.
+	b.Del(s1)
+	for target, id := range before {
+		if now := get(target); id != "s1" && now != id {
+			t.Fatalf("%s: moved from %s to %s", target, id, now)
+		} else if now == "s1" {
+			t.Fatalf("%s: removed source returned", target)
+		}
+	}
+
+	// Blacklisted sources are skipped.
+	for target, id := range before {
+		if id == "s0" && get(target, s0) != "s2" {
+			t.Fatalf("%s: blacklisted source returned", target)
+		}
+	}
+}
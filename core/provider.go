@@ -0,0 +1,83 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// SourceProvider is implemented by the packages that contribute their
+// own sources to booster, e.g. modems driven through a vendor SDK.
+// Its sources are discovered, checked and stored alongside the
+// network interfaces found by booster itself.
+// The sources that dial through a remote proxy, e.g. another booster
+// instance, can forward the address of the original client to it: see
+// proxyproto.ClientFromContext.
+type SourceProvider interface {
+	// Provide returns the sources currently available.
+	Provide(ctx context.Context) ([]Source, error)
+	// Check returns an error if `src`, one of the sources returned
+	// by Provide, does not provide an internet connection.
+	Check(ctx context.Context, src Source) error
+}
+
+var providers = struct {
+	sync.Mutex
+	m map[string]SourceProvider
+}{m: make(map[string]SourceProvider)}
+
+// RegisterSourceProvider makes `p` available under `name`. It is meant
+// to be called from the init function of the package implementing the
+// provider, and panics if it is called twice with the same name or if
+// `p` is nil.
+func RegisterSourceProvider(name string, p SourceProvider) {
+	providers.Lock()
+	defer providers.Unlock()
+
+	if p == nil {
+		panic("core: RegisterSourceProvider provider is nil")
+	}
+	if _, ok := providers.m[name]; ok {
+		panic("core: RegisterSourceProvider called twice for provider " + name)
+	}
+	providers.m[name] = p
+}
+
+// SourceProviders returns the names of the providers registered,
+// sorted.
+func SourceProviders() []string {
+	providers.Lock()
+	defer providers.Unlock()
+
+	names := make([]string, 0, len(providers.m))
+	for k := range providers.m {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupSourceProvider returns the provider registered under `name`,
+// if any.
+func LookupSourceProvider(name string) (SourceProvider, bool) {
+	providers.Lock()
+	defer providers.Unlock()
+
+	p, ok := providers.m[name]
+	return p, ok
+}
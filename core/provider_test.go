@@ -0,0 +1,55 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+)
+
+type provider struct{}
+
+func (p provider) Provide(ctx context.Context) ([]core.Source, error) {
+	return []core.Source{newMock("s0")}, nil
+}
+
+func (p provider) Check(ctx context.Context, src core.Source) error {
+	return nil
+}
+
+func TestRegisterSourceProvider(t *testing.T) {
+	core.RegisterSourceProvider("test", provider{})
+
+	if _, ok := core.LookupSourceProvider("test"); !ok {
+		t.Fatalf("Provider was not registered")
+	}
+	found := false
+	for _, v := range core.SourceProviders() {
+		found = found || v == "test"
+	}
+	if !found {
+		t.Fatalf("Provider not listed in %v", core.SourceProviders())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("Registering a provider twice should panic")
+		}
+	}()
+	core.RegisterSourceProvider("test", provider{})
+}
@@ -0,0 +1,122 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package crash recovers the panics of the goroutines handling the
+// connections, so that a bug affecting one of them does not bring the
+// whole proxy down, and reports them.
+package crash
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/booster-proj/booster/events"
+	"upspin.io/log"
+)
+
+// MetricsExporter counts the panics recovered.
+type MetricsExporter interface {
+	IncPanic(labels map[string]string)
+}
+
+// Report describes a panic recovered: where it happened, its value and
+// stack, and the metadata of the connection being handled, e.g. its
+// target.
+type Report struct {
+	Time      time.Time         `json:"time"`
+	Subsystem string            `json:"subsystem"`
+	Panic     string            `json:"panic"`
+	Stack     string            `json:"stack"`
+	Conn      map[string]string `json:"conn,omitempty"`
+	// Path is the file the report was written to, if any.
+	Path string `json:"path,omitempty"`
+}
+
+// Reporter handles the panics recovered: it logs their reports, counts
+// them and publishes a TopicCrash event and, if Dir is set, writes the
+// reports into it, one json file each, e.g. to upload them later. A nil
+// Reporter only logs them.
+type Reporter struct {
+	// Dir, if set, is the directory the reports are written to.
+	Dir             string
+	MetricsExporter MetricsExporter
+	Events          *events.Bus
+
+	seq uint64
+}
+
+// Recover recovers a panic of the calling goroutine, reporting it. It
+// must be deferred directly, e.g.
+//
+//	defer r.Recover("dialer", map[string]string{"target": target})
+func (r *Reporter) Recover(subsystem string, conn map[string]string) {
+	if v := recover(); v != nil {
+		r.Handle(v, subsystem, conn)
+	}
+}
+
+// Handle reports the panic `v`, recovered in `subsystem` while handling
+// the connection described by `conn`, returning it as an error. It
+// has to be called in the deferred function that recovered it, for the
+// stack to be the one of the panic.
+func (r *Reporter) Handle(v interface{}, subsystem string, conn map[string]string) error {
+	rep := Report{
+		Time:      time.Now(),
+		Subsystem: subsystem,
+		Panic:     fmt.Sprint(v),
+		Stack:     string(debug.Stack()),
+		Conn:      conn,
+	}
+	if r != nil && r.Dir != "" {
+		var err error
+		if rep.Path, err = r.write(rep); err != nil {
+			log.Error.Printf("Crash: unable to write the report: %v", err)
+		}
+	}
+	log.Error.Printf("Crash: recovered panic in %s: %s (conn: %v)\n%s", subsystem, rep.Panic, conn, rep.Stack)
+	err := fmt.Errorf("panic in %s: %s", subsystem, rep.Panic)
+	if r == nil {
+		return err
+	}
+	if exp := r.MetricsExporter; exp != nil {
+		exp.IncPanic(map[string]string{"subsystem": subsystem})
+	}
+	r.Events.Publish(events.Event{
+		Topic:   events.TopicCrash,
+		Message: fmt.Sprintf("recovered panic in %s: %s", subsystem, rep.Panic),
+		Data:    rep,
+	})
+	return err
+}
+
+// write saves `rep` into a new file of Dir, returning its path.
+func (r *Reporter) write(rep Report) (string, error) {
+	if err := os.MkdirAll(r.Dir, 0700); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("crash-%s-%d.json", rep.Time.UTC().Format("20060102T150405Z"), atomic.AddUint64(&r.seq, 1))
+	path := filepath.Join(r.Dir, name)
+	b, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return path, ioutil.WriteFile(path, b, 0600)
+}
@@ -0,0 +1,80 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package crash_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/booster-proj/booster/crash"
+)
+
+type counter map[string]int
+
+func (c counter) IncPanic(labels map[string]string) {
+	c[labels["subsystem"]]++
+}
+
+func TestReporter_Recover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := counter{}
+	r := &crash.Reporter{Dir: dir, MetricsExporter: c}
+	func() {
+		defer r.Recover("proxy", map[string]string{"target": "example.com:443"})
+		var m map[string]int
+		m["boom"]++
+	}()
+	if c["proxy"] != 1 {
+		t.Fatalf("Unexpected panics counted: %v", c)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Unexpected reports: %v", files)
+	}
+	b, err := ioutil.ReadFile(dir + "/" + files[0].Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rep crash.Report
+	if err := json.Unmarshal(b, &rep); err != nil {
+		t.Fatal(err)
+	}
+	if rep.Subsystem != "proxy" || rep.Conn["target"] != "example.com:443" || !strings.Contains(rep.Panic, "nil map") {
+		t.Fatalf("Unexpected report: %+v", rep)
+	}
+	if !strings.Contains(rep.Stack, "TestReporter_Recover") {
+		t.Fatalf("The stack does not contain the panicking function: %s", rep.Stack)
+	}
+
+	// A nil reporter recovers the panics anyway.
+	var nilReporter *crash.Reporter
+	func() {
+		defer nilReporter.Recover("proxy", nil)
+		panic("boom")
+	}()
+}
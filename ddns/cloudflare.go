@@ -0,0 +1,146 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package ddns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultCloudflareAPI is the endpoint of the Cloudflare API.
+var DefaultCloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+// Cloudflare is a Provider updating a record of a zone managed by
+// Cloudflare, either the A or the AAAA one, depending on the address.
+// The record is created if missing.
+type Cloudflare struct {
+	// Zone is the identifier of the zone.
+	Zone string
+	// Token is an API token allowed to edit the DNS records of the
+	// zone.
+	Token string
+	// Hostname is the name of the record, e.g. home.example.com.
+	Hostname string
+	// TTL of the record, in seconds. If 0, the automatic one of
+	// Cloudflare is used.
+	TTL int
+
+	// API is the endpoint of the Cloudflare API. If empty,
+	// DefaultCloudflareAPI is used.
+	API string
+	// Client is used to perform the requests. If nil,
+	// http.DefaultClient is used.
+	Client *http.Client
+}
+
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+}
+
+// Update implements Provider.
+func (c *Cloudflare) Update(ctx context.Context, ip net.IP) error {
+	typ := "A"
+	if ip.To4() == nil {
+		typ = "AAAA"
+	}
+
+	var records []cloudflareRecord
+	query := url.Values{"type": {typ}, "name": {c.Hostname}}
+	if err := c.do(ctx, "GET", "/zones/"+c.Zone+"/dns_records?"+query.Encode(), nil, &records); err != nil {
+		return err
+	}
+
+	ttl := c.TTL
+	if ttl <= 0 {
+		ttl = 1 // Automatic.
+	}
+	r := cloudflareRecord{Type: typ, Name: c.Hostname, Content: ip.String(), TTL: ttl}
+	if len(records) == 0 {
+		return c.do(ctx, "POST", "/zones/"+c.Zone+"/dns_records", r, nil)
+	}
+	if records[0].Content == r.Content && records[0].TTL == r.TTL {
+		return nil
+	}
+	return c.do(ctx, "PUT", "/zones/"+c.Zone+"/dns_records/"+records[0].ID, r, nil)
+}
+
+// do performs an API request, decoding the result into `out`, if not
+// nil.
+func (c *Cloudflare) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+	api := c.API
+	if api == "" {
+		api = DefaultCloudflareAPI
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(api, "/")+path, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var res struct {
+		Success bool `json:"success"`
+		Errors  []struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return fmt.Errorf("cloudflare: unexpected response: %s", resp.Status)
+	}
+	if !res.Success {
+		msgs := make([]string, len(res.Errors))
+		for i, v := range res.Errors {
+			msgs[i] = fmt.Sprintf("%s (%d)", v.Message, v.Code)
+		}
+		return fmt.Errorf("cloudflare: %s: %s", resp.Status, strings.Join(msgs, ", "))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(res.Result, out)
+}
+
+func (c *Cloudflare) String() string {
+	return "cloudflare " + c.Hostname
+}
@@ -0,0 +1,203 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package ddns keeps dynamic DNS records pointing to the public address
+// of the sources, updating them when the public IP detected changes,
+// see the publicip package, e.g. so that a host behind a link that
+// renumbers stays reachable.
+package ddns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/booster-proj/booster/events"
+	"github.com/booster-proj/booster/store"
+	"upspin.io/log"
+)
+
+// Defaults used when the Updater fields are not set.
+var (
+	DefaultTimeout       = time.Second * 30
+	DefaultRetryInterval = time.Minute * 5
+)
+
+// Provider is implemented by the dynamic DNS services.
+type Provider interface {
+	// Update points the record to `ip`.
+	Update(ctx context.Context, ip net.IP) error
+	fmt.Stringer
+}
+
+// Record is a dynamic DNS record following the public IP of Source.
+type Record struct {
+	Source   string
+	Provider Provider
+}
+
+// ParseRecord parses a record, in the form
+// `source:cloudflare,zone=<zone id>,token=<api token>,hostname=<name>[,ttl=<seconds>]`
+// or `source:dyndns,hostname=<name>,username=<user>,password=<password>[,url=<update url>]`.
+func ParseRecord(s string) (Record, error) {
+	parts := strings.SplitN(s, ":", 2)
+	r := Record{Source: parts[0]}
+	if r.Source == "" || len(parts) == 1 {
+		return r, fmt.Errorf("invalid dynamic DNS record %q, expected source:provider,option=value,...", s)
+	}
+	opts := strings.Split(parts[1], ",")
+	values := make(map[string]string)
+	for _, v := range opts[1:] {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return r, fmt.Errorf("dynamic DNS record of %s: missing %q value", r.Source, kv[0])
+		}
+		values[kv[0]] = kv[1]
+	}
+	// take returns the option `key`, removing it from the values, so
+	// that the ones left are unknown.
+	take := func(key string) string {
+		v := values[key]
+		delete(values, key)
+		return v
+	}
+
+	var err error
+	switch opts[0] {
+	case "cloudflare":
+		p := &Cloudflare{Zone: take("zone"), Token: take("token"), Hostname: take("hostname")}
+		if v := take("ttl"); v != "" {
+			if p.TTL, err = strconv.Atoi(v); err != nil {
+				return r, fmt.Errorf("dynamic DNS record of %s: invalid ttl: %v", r.Source, err)
+			}
+		}
+		if p.Zone == "" || p.Token == "" || p.Hostname == "" {
+			err = fmt.Errorf("zone, token and hostname are required")
+		}
+		r.Provider = p
+	case "dyndns":
+		p := &DynDNS{URL: take("url"), Hostname: take("hostname"), Username: take("username"), Password: take("password")}
+		if p.Hostname == "" || p.Username == "" {
+			err = fmt.Errorf("hostname and username are required")
+		}
+		r.Provider = p
+	default:
+		err = fmt.Errorf("unknown provider %q, expected cloudflare or dyndns", opts[0])
+	}
+	if err != nil {
+		return r, fmt.Errorf("dynamic DNS record of %s: %v", r.Source, err)
+	}
+	for k := range values {
+		return r, fmt.Errorf("dynamic DNS record of %s: unknown option %q", r.Source, k)
+	}
+	return r, nil
+}
+
+// Store describes the entity that records the public addresses of
+// the sources.
+type Store interface {
+	PublicIP(id string) (string, bool)
+}
+
+// Updater updates the Records each time the public IP of their source
+// changes, following the store.PublicIPChange events published on Bus.
+// The updates that fail are retried every RetryInterval.
+type Updater struct {
+	Bus   *events.Bus
+	Store Store
+	// Records are the records kept up to date.
+	Records []Record
+	// Timeout is the maximum duration of each update.
+	Timeout time.Duration
+	// RetryInterval is the interval between the attempts to update
+	// a record that failed.
+	RetryInterval time.Duration
+}
+
+func (u *Updater) timeout() time.Duration {
+	if u.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return u.Timeout
+}
+
+func (u *Updater) retryInterval() time.Duration {
+	if u.RetryInterval <= 0 {
+		return DefaultRetryInterval
+	}
+	return u.RetryInterval
+}
+
+// Run updates the records until `ctx` is canceled. The records whose
+// source has a public IP already are updated right away.
+func (u *Updater) Run(ctx context.Context) error {
+	c, cancel := u.Bus.Subscribe(64)
+	defer cancel()
+
+	// pending are the addresses the records have to be updated to,
+	// by index.
+	pending := make(map[int]net.IP)
+	for i, r := range u.Records {
+		if ip, ok := u.Store.PublicIP(r.Source); ok {
+			pending[i] = net.ParseIP(ip)
+		}
+	}
+
+	retry := time.NewTicker(u.retryInterval())
+	defer retry.Stop()
+	for {
+		u.update(ctx, pending)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-retry.C:
+		case e := <-c:
+			change, ok := e.Data.(store.PublicIPChange)
+			if e.Topic != events.TopicPublicIP || !ok {
+				continue
+			}
+			for i, r := range u.Records {
+				if r.Source == change.Source {
+					pending[i] = net.ParseIP(change.Current)
+				}
+			}
+		}
+	}
+}
+
+// update updates the records of `pending`, removing the ones updated.
+func (u *Updater) update(ctx context.Context, pending map[int]net.IP) {
+	for i, ip := range pending {
+		r := u.Records[i]
+		if ip == nil {
+			delete(pending, i)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, u.timeout())
+		err := r.Provider.Update(ctx, ip)
+		cancel()
+		if err != nil {
+			log.Error.Printf("DDNS: unable to update %v to the public IP of %v, %v: %v", r.Provider, r.Source, ip, err)
+			continue
+		}
+		log.Info.Printf("DDNS: %v updated to the public IP of %v, %v", r.Provider, r.Source, ip)
+		delete(pending, i)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package ddns_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/ddns"
+	"github.com/booster-proj/booster/events"
+	"github.com/booster-proj/booster/store"
+)
+
+func TestParseRecord(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{in: "wwan0:cloudflare,zone=z,token=t,hostname=home.example.com,ttl=60", want: "cloudflare home.example.com", ok: true},
+		{in: "wwan0:dyndns,hostname=home.dyndns.org,username=u,password=p", want: "dyndns home.dyndns.org", ok: true},
+		{in: "wwan0:dyndns,hostname=h,username=u,url=https://dynupdate.no-ip.com/nic/update", want: "dyndns h", ok: true},
+		{in: "wwan0"},
+		{in: ":dyndns,hostname=h,username=u"},
+		{in: "wwan0:route53,hostname=h"},
+		{in: "wwan0:cloudflare,zone=z,hostname=h"},
+		{in: "wwan0:cloudflare,zone=z,token=t,hostname=h,ttl=x"},
+		{in: "wwan0:dyndns,hostname=h,username=u,proxied=true"},
+		{in: "wwan0:dyndns,hostname,username=u"},
+	}
+	for i, v := range tests {
+		r, err := ddns.ParseRecord(v.in)
+		if v.ok != (err == nil) {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+		if v.ok && (r.Source != "wwan0" || r.Provider.String() != v.want) {
+			t.Fatalf("%d: unexpected record: %+v", i, r)
+		}
+	}
+}
+
+// cloudflare fakes the DNS records API of a zone.
+type cloudflare struct {
+	sync.Mutex
+	records []map[string]interface{}
+	writes  int
+}
+
+func (c *cloudflare) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.Lock()
+	defer c.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"success":false,"errors":[{"code":9109,"message":"Invalid access token"}]}`)
+		return
+	}
+	var result interface{}
+	switch r.Method {
+	case "GET":
+		result = c.records
+	case "POST", "PUT":
+		var rec map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&rec)
+		rec["id"] = "r0"
+		c.records = []map[string]interface{}{rec}
+		c.writes++
+		result = rec
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "result": result})
+}
+
+func TestCloudflare_Update(t *testing.T) {
+	cf := &cloudflare{}
+	srv := httptest.NewServer(cf)
+	defer srv.Close()
+
+	p := &ddns.Cloudflare{API: srv.URL, Zone: "z", Token: "token", Hostname: "home.example.com"}
+	ctx := context.Background()
+	for _, v := range []string{"203.0.113.1", "203.0.113.1", "203.0.113.2"} {
+		if err := p.Update(ctx, net.ParseIP(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The record is created, left alone and then updated.
+	if cf.writes != 2 || cf.records[0]["content"] != "203.0.113.2" || cf.records[0]["type"] != "A" {
+		t.Fatalf("Unexpected records after %d writes: %v", cf.writes, cf.records)
+	}
+
+	p.Token = "invalid"
+	if err := p.Update(ctx, net.ParseIP("203.0.113.3")); err == nil {
+		t.Fatalf("The update should fail with an invalid token")
+	}
+}
+
+func TestDynDNS_Update(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, _ := r.BasicAuth(); u != "user" || p != "pass" {
+			fmt.Fprint(w, "badauth")
+			return
+		}
+		fmt.Fprintf(w, "good %s\n", r.URL.Query().Get("myip"))
+	}))
+	defer srv.Close()
+
+	p := &ddns.DynDNS{URL: srv.URL, Hostname: "home.dyndns.org", Username: "user", Password: "pass"}
+	ctx := context.Background()
+	if err := p.Update(ctx, net.ParseIP("203.0.113.1")); err != nil {
+		t.Fatal(err)
+	}
+	p.Password = "wrong"
+	if err := p.Update(ctx, net.ParseIP("203.0.113.1")); err == nil {
+		t.Fatalf("The update should fail with wrong credentials")
+	}
+}
+
+// provider records the addresses updated.
+type provider struct {
+	updates chan net.IP
+}
+
+func (p *provider) Update(ctx context.Context, ip net.IP) error {
+	p.updates <- ip
+	return nil
+}
+
+func (p *provider) String() string {
+	return "test"
+}
+
+func TestUpdater_Run(t *testing.T) {
+	bus := new(events.Bus)
+	s := store.New(nil)
+	s.Events = bus
+	s.SetPublicIP("wwan0", net.ParseIP("203.0.113.1"))
+
+	p := &provider{updates: make(chan net.IP, 4)}
+	u := &ddns.Updater{
+		Bus:     bus,
+		Store:   s,
+		Records: []ddns.Record{{Source: "wwan0", Provider: p}},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go u.Run(ctx)
+
+	expect := func(want string) {
+		select {
+		case ip := <-p.updates:
+			if ip.String() != want {
+				t.Fatalf("Unexpected update: wanted %v, found %v", want, ip)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Record not updated to %v", want)
+		}
+	}
+	// The address known already is updated right away, after
+	// subscribing to the changes.
+	expect("203.0.113.1")
+
+	// The changes of the other sources are ignored.
+	s.SetPublicIP("en0", net.ParseIP("198.51.100.1"))
+	s.SetPublicIP("wwan0", net.ParseIP("203.0.113.2"))
+	expect("203.0.113.2")
+}
@@ -0,0 +1,98 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package ddns
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultDynDNSURL is the update URL of Dyn.
+var DefaultDynDNSURL = "https://members.dyndns.org/nic/update"
+
+// DynDNS is a Provider speaking the update protocol of Dyn, also
+// implemented by other services, e.g. No-IP, Dynu or ddclient based
+// servers, through their own URL.
+type DynDNS struct {
+	// URL is the update URL. If empty, DefaultDynDNSURL is used.
+	URL string
+	// Hostname is the name of the record, e.g. home.dyndns.org.
+	Hostname string
+	// Username and Password of the account, or the update key,
+	// depending on the service.
+	Username string
+	Password string
+
+	// Client is used to perform the requests. If nil,
+	// http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Update implements Provider.
+func (d *DynDNS) Update(ctx context.Context, ip net.IP) error {
+	u := d.URL
+	if u == "" {
+		u = DefaultDynDNSURL
+	}
+	query := url.Values{"hostname": {d.Hostname}, "myip": {ip.String()}}
+	req, err := http.NewRequest("GET", u+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(d.Username, d.Password)
+	// The protocol requires the clients to identify themselves.
+	req.Header.Set("User-Agent", "booster")
+
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return err
+	}
+
+	// The reply is a return code, followed by the address on
+	// success.
+	reply := strings.TrimSpace(string(b))
+	var code string
+	if f := strings.Fields(reply); len(f) > 0 {
+		code = f[0]
+	}
+	switch {
+	case code == "good", code == "nochg":
+		return nil
+	case resp.StatusCode != http.StatusOK && code == "":
+		return fmt.Errorf("dyndns: unexpected response: %s", resp.Status)
+	default:
+		return fmt.Errorf("dyndns: update refused: %s", reply)
+	}
+}
+
+func (d *DynDNS) String() string {
+	return "dyndns " + d.Hostname
+}
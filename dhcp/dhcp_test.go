@@ -0,0 +1,164 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package dhcp_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/dhcp"
+)
+
+func server(t *testing.T) *dhcp.Server {
+	r, err := dhcp.ParseRange("192.168.50.10-192.168.50.11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &dhcp.Server{
+		Range:  r,
+		Router: net.ParseIP("192.168.50.1"),
+		Mask:   net.CIDRMask(24, 32),
+		DNS:    []net.IP{net.ParseIP("192.168.50.1")},
+	}
+}
+
+func message(typ byte, mac string, opts map[byte][]byte) *dhcp.Message {
+	hw, _ := net.ParseMAC(mac)
+	m := &dhcp.Message{XID: 42, CHAddr: hw, Options: map[byte][]byte{dhcp.OptionMessageType: {typ}}}
+	for k, v := range opts {
+		m.Options[k] = v
+	}
+	return m
+}
+
+func TestParseRange(t *testing.T) {
+	for _, v := range []string{"192.168.1.1", "192.168.1.10-192.168.1.1", "a-b", "::1-::2"} {
+		if _, err := dhcp.ParseRange(v); err == nil {
+			t.Fatalf("Expected an error parsing %q", v)
+		}
+	}
+	r, err := dhcp.ParseRange("192.168.1.10-192.168.1.20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Contains(net.ParseIP("192.168.1.20")) || r.Contains(net.ParseIP("192.168.1.21")) {
+		t.Fatalf("Unexpected range: %v", r)
+	}
+}
+
+func TestMessage(t *testing.T) {
+	m := message(dhcp.Request, "02:00:00:00:00:01", map[byte][]byte{
+		dhcp.OptionRequestedIP: net.ParseIP("192.168.50.10").To4(),
+		// Longer than an option can be, split in two.
+		dhcp.OptionDNS: make([]byte, 300),
+	})
+	got, err := dhcp.ParseMessage(m.Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Type() != dhcp.Request || got.XID != 42 || got.CHAddr.String() != "02:00:00:00:00:01" {
+		t.Fatalf("Unexpected message: %+v", got)
+	}
+	if !reflect.DeepEqual(got.Options, m.Options) {
+		t.Fatalf("Unexpected options: %v", got.Options)
+	}
+}
+
+func TestServer_Handle(t *testing.T) {
+	s := server(t)
+
+	offer := s.Handle(message(dhcp.Discover, "02:00:00:00:00:01", nil))
+	if offer == nil || offer.Type() != dhcp.Offer || !offer.YIAddr.Equal(net.ParseIP("192.168.50.10")) {
+		t.Fatalf("Unexpected offer: %+v", offer)
+	}
+	if !offer.IP(dhcp.OptionRouter).Equal(s.Router) || !offer.IP(dhcp.OptionDNS).Equal(s.DNS[0]) {
+		t.Fatalf("Unexpected options: %v", offer.Options)
+	}
+	ack := s.Handle(message(dhcp.Request, "02:00:00:00:00:01", map[byte][]byte{
+		dhcp.OptionRequestedIP: offer.YIAddr,
+		dhcp.OptionServerID:    s.Router.To4(),
+	}))
+	if ack == nil || ack.Type() != dhcp.ACK || !ack.YIAddr.Equal(offer.YIAddr) {
+		t.Fatalf("Unexpected ack: %+v", ack)
+	}
+
+	// Another client cannot take the address.
+	nak := s.Handle(message(dhcp.Request, "02:00:00:00:00:02", map[byte][]byte{
+		dhcp.OptionRequestedIP: offer.YIAddr,
+	}))
+	if nak == nil || nak.Type() != dhcp.NAK {
+		t.Fatalf("Unexpected reply: %+v", nak)
+	}
+	offer = s.Handle(message(dhcp.Discover, "02:00:00:00:00:02", nil))
+	if offer == nil || !offer.YIAddr.Equal(net.ParseIP("192.168.50.11")) {
+		t.Fatalf("Unexpected offer: %+v", offer)
+	}
+	// The range is exhausted.
+	if offer := s.Handle(message(dhcp.Discover, "02:00:00:00:00:03", nil)); offer != nil {
+		t.Fatalf("Unexpected offer: %+v", offer)
+	}
+	if n := len(s.Leases()); n != 2 {
+		t.Fatalf("Unexpected leases: %d", n)
+	}
+
+	s.Handle(message(dhcp.Release, "02:00:00:00:00:01", nil))
+	offer = s.Handle(message(dhcp.Discover, "02:00:00:00:00:03", nil))
+	if offer == nil || !offer.YIAddr.Equal(net.ParseIP("192.168.50.10")) {
+		t.Fatalf("Unexpected offer after release: %+v", offer)
+	}
+}
+
+func TestServer_Serve(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan error, 1)
+	go func() {
+		c <- server(t).Serve(ctx, conn)
+	}()
+
+	client, err := net.Dial("udp4", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.Write(message(dhcp.Discover, "02:00:00:00:00:01", nil).Marshal()); err != nil {
+		t.Fatal(err)
+	}
+	client.SetReadDeadline(time.Now().Add(time.Second * 5))
+	b := make([]byte, 1500)
+	n, err := client.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offer, err := dhcp.ParseMessage(b[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !offer.Reply || offer.Type() != dhcp.Offer || offer.XID != 42 {
+		t.Fatalf("Unexpected reply: %+v", offer)
+	}
+
+	cancel()
+	if err := <-c; err != nil {
+		t.Fatalf("Unexpected error once canceled: %v", err)
+	}
+}
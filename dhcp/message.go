@@ -0,0 +1,186 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package dhcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Message types, carried by OptionMessageType.
+const (
+	Discover byte = 1
+	Offer    byte = 2
+	Request  byte = 3
+	Decline  byte = 4
+	ACK      byte = 5
+	NAK      byte = 6
+	Release  byte = 7
+	Inform   byte = 8
+)
+
+// Options used by the server.
+const (
+	OptionSubnetMask  byte = 1
+	OptionRouter      byte = 3
+	OptionDNS         byte = 6
+	OptionRequestedIP byte = 50
+	OptionLeaseTime   byte = 51
+	OptionMessageType byte = 53
+	OptionServerID    byte = 54
+	OptionRenewalTime byte = 58
+	OptionRebindTime  byte = 59
+)
+
+const (
+	bootRequest = 1
+	bootReply   = 2
+
+	optionPad = 0
+	optionEnd = 255
+
+	// headerSize is the size of the fixed BOOTP header, followed
+	// by the magic cookie and the options.
+	headerSize = 236
+)
+
+var magicCookie = []byte{99, 130, 83, 99}
+
+// Message is a DHCPv4 message. Only Ethernet hardware addresses are
+// supported.
+type Message struct {
+	// Reply is set on the messages sent by the servers.
+	Reply bool
+	XID   uint32
+	Flags uint16
+	// CIAddr is the address of the client, if it has one.
+	CIAddr net.IP
+	// YIAddr is the address assigned to the client.
+	YIAddr net.IP
+	// SIAddr is the address of the next server.
+	SIAddr net.IP
+	// GIAddr is the address of the relay agent, if any.
+	GIAddr net.IP
+	CHAddr net.HardwareAddr
+	// Options maps the codes of the options to their values.
+	Options map[byte][]byte
+}
+
+// Type returns the type of the message, or 0 if missing.
+func (m *Message) Type() byte {
+	if v := m.Options[OptionMessageType]; len(v) == 1 {
+		return v[0]
+	}
+	return 0
+}
+
+// IP returns the address value of the option `code`, or nil.
+func (m *Message) IP(code byte) net.IP {
+	if v := m.Options[code]; len(v) == net.IPv4len {
+		return net.IP(v)
+	}
+	return nil
+}
+
+// ParseMessage parses the DHCPv4 message `b`.
+func ParseMessage(b []byte) (*Message, error) {
+	if len(b) < headerSize+len(magicCookie) {
+		return nil, errors.New("dhcp: message too short")
+	}
+	if string(b[headerSize:headerSize+4]) != string(magicCookie) {
+		return nil, errors.New("dhcp: missing magic cookie")
+	}
+	if b[1] != 1 || b[2] != 6 {
+		return nil, fmt.Errorf("dhcp: unsupported hardware type %d, length %d", b[1], b[2])
+	}
+	m := &Message{
+		Reply:   b[0] == bootReply,
+		XID:     binary.BigEndian.Uint32(b[4:8]),
+		Flags:   binary.BigEndian.Uint16(b[10:12]),
+		CIAddr:  net.IP(append([]byte(nil), b[12:16]...)),
+		YIAddr:  net.IP(append([]byte(nil), b[16:20]...)),
+		SIAddr:  net.IP(append([]byte(nil), b[20:24]...)),
+		GIAddr:  net.IP(append([]byte(nil), b[24:28]...)),
+		CHAddr:  net.HardwareAddr(append([]byte(nil), b[28:34]...)),
+		Options: make(map[byte][]byte),
+	}
+	opts := b[headerSize+4:]
+	for len(opts) > 0 {
+		code := opts[0]
+		if code == optionEnd {
+			break
+		}
+		if code == optionPad {
+			opts = opts[1:]
+			continue
+		}
+		if len(opts) < 2 || len(opts) < 2+int(opts[1]) {
+			return nil, fmt.Errorf("dhcp: truncated option %d", code)
+		}
+		end := 2 + int(opts[1])
+		// Options longer than 255 bytes are split, see RFC 3396.
+		m.Options[code] = append(m.Options[code], opts[2:end]...)
+		opts = opts[end:]
+	}
+	return m, nil
+}
+
+// Marshal returns the wire format of the message.
+func (m *Message) Marshal() []byte {
+	b := make([]byte, headerSize, headerSize+len(magicCookie)+64)
+	b[0] = bootRequest
+	if m.Reply {
+		b[0] = bootReply
+	}
+	b[1], b[2] = 1, 6
+	binary.BigEndian.PutUint32(b[4:8], m.XID)
+	binary.BigEndian.PutUint16(b[10:12], m.Flags)
+	for i, v := range []net.IP{m.CIAddr, m.YIAddr, m.SIAddr, m.GIAddr} {
+		if ip := v.To4(); ip != nil {
+			copy(b[12+i*4:], ip)
+		}
+	}
+	copy(b[28:44], m.CHAddr)
+	b = append(b, magicCookie...)
+
+	// Message type first, then the others in order, so that the
+	// output is stable.
+	if v, ok := m.Options[OptionMessageType]; ok {
+		b = append(b, OptionMessageType, byte(len(v)))
+		b = append(b, v...)
+	}
+	for code := 1; code < optionEnd; code++ {
+		v, ok := m.Options[byte(code)]
+		if !ok || byte(code) == OptionMessageType {
+			continue
+		}
+		for len(v) > 255 {
+			b = append(b, byte(code), 255)
+			b = append(b, v[:255]...)
+			v = v[255:]
+		}
+		b = append(b, byte(code), byte(len(v)))
+		b = append(b, v...)
+	}
+	b = append(b, optionEnd)
+	// Some clients drop the messages shorter than a BOOTP one.
+	for len(b) < 300 {
+		b = append(b, optionPad)
+	}
+	return b
+}
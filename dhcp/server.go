@@ -0,0 +1,337 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package dhcp provides a minimal DHCPv4 server, handing out the
+// addresses of a range together with the router and the DNS servers
+// of the network, e.g. booster in gateway mode.
+package dhcp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"upspin.io/log"
+)
+
+// DefaultLeaseTime is the duration of the leases when
+// Server.LeaseTime is 0.
+const DefaultLeaseTime = time.Hour * 12
+
+// offerTime is how long an address offered is kept for the client,
+// waiting for its request.
+const offerTime = time.Minute
+
+// Range is a range of IPv4 addresses, both ends included.
+type Range struct {
+	Start net.IP
+	End   net.IP
+}
+
+// ParseRange parses a range in the form start-end, e.g.
+// 192.168.1.100-192.168.1.200.
+func ParseRange(s string) (Range, error) {
+	parts := strings.SplitN(s, "-", 2)
+	if len(parts) != 2 {
+		return Range{}, fmt.Errorf("invalid range %q, expected start-end", s)
+	}
+	r := Range{Start: net.ParseIP(parts[0]).To4(), End: net.ParseIP(parts[1]).To4()}
+	switch {
+	case r.Start == nil:
+		return r, fmt.Errorf("invalid range %q: %q is not an IPv4 address", s, parts[0])
+	case r.End == nil:
+		return r, fmt.Errorf("invalid range %q: %q is not an IPv4 address", s, parts[1])
+	case toUint(r.End) < toUint(r.Start):
+		return r, fmt.Errorf("invalid range %q: the end precedes the start", s)
+	}
+	return r, nil
+}
+
+// Contains reports whether `ip` is in the range.
+func (r Range) Contains(ip net.IP) bool {
+	ip = ip.To4()
+	return ip != nil && toUint(ip) >= toUint(r.Start) && toUint(ip) <= toUint(r.End)
+}
+
+func (r Range) String() string {
+	return fmt.Sprintf("%v-%v", r.Start, r.End)
+}
+
+func toUint(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+func fromUint(v uint32) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, v)
+	return ip
+}
+
+// Lease is an address assigned to a client.
+type Lease struct {
+	IP      net.IP           `json:"ip"`
+	MAC     net.HardwareAddr `json:"mac"`
+	Expires time.Time        `json:"expires"`
+}
+
+// Server is a DHCPv4 server. The leases are kept in memory: after a
+// restart, the clients renewing their address keep it, as long as
+// it is still free. Fill at least Range, Router and Mask before use.
+type Server struct {
+	// Range is the pool of the addresses handed out.
+	Range Range
+	// Router is the default gateway of the clients, and the
+	// identifier of the server.
+	Router net.IP
+	// Mask is the subnet mask of the network.
+	Mask net.IPMask
+	// DNS are the DNS servers of the clients.
+	DNS []net.IP
+	// LeaseTime is the duration of the leases. If 0,
+	// DefaultLeaseTime is used.
+	LeaseTime time.Duration
+
+	mu sync.Mutex
+	// leases are indexed by address.
+	leases map[string]*Lease
+}
+
+// Validate returns an error if the server is not configured properly.
+func (s *Server) Validate() error {
+	switch {
+	case s.Range.Start.To4() == nil || s.Range.End.To4() == nil:
+		return errors.New("dhcp: missing range")
+	case s.Router.To4() == nil:
+		return errors.New("dhcp: missing router")
+	case len(s.Mask) != net.IPv4len:
+		return errors.New("dhcp: missing subnet mask")
+	}
+	n := net.IPNet{IP: s.Router.Mask(s.Mask), Mask: s.Mask}
+	if !n.Contains(s.Range.Start) || !n.Contains(s.Range.End) {
+		return fmt.Errorf("dhcp: range %v is not in the network %v", s.Range, n.String())
+	}
+	return nil
+}
+
+// Leases returns the leases that did not expire, by address.
+func (s *Server) Leases() []Lease {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var acc []Lease
+	for _, v := range s.leases {
+		if v.MAC != nil && v.Expires.After(now) {
+			acc = append(acc, *v)
+		}
+	}
+	sort.Slice(acc, func(i, j int) bool { return toUint(acc[i].IP) < toUint(acc[j].IP) })
+	return acc
+}
+
+// Serve answers the requests received on `conn`, e.g. returned by
+// Listen, until the context is canceled, closing it.
+func (s *Server) Serve(ctx context.Context, conn net.PacketConn) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	b := make([]byte, 1500)
+	for {
+		n, addr, err := conn.ReadFrom(b)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return err
+		}
+		req, err := ParseMessage(b[:n])
+		if err != nil || req.Reply {
+			continue
+		}
+		resp := s.Handle(req)
+		if resp == nil {
+			continue
+		}
+		if _, err := conn.WriteTo(resp.Marshal(), replyAddr(req, addr)); err != nil {
+			log.Error.Printf("DHCP: unable to reply to %v: %v", req.CHAddr, err)
+		}
+	}
+}
+
+// replyAddr returns where the reply to `req`, received from `addr`, is
+// sent: the relay agent, if any, the client if it already has an
+// address, the broadcast address otherwise.
+func replyAddr(req *Message, addr net.Addr) net.Addr {
+	if ip := req.GIAddr.To4(); ip != nil && !ip.IsUnspecified() {
+		return &net.UDPAddr{IP: ip, Port: 67}
+	}
+	if ua, ok := addr.(*net.UDPAddr); ok && !ua.IP.IsUnspecified() {
+		return ua
+	}
+	return &net.UDPAddr{IP: net.IPv4bcast, Port: 68}
+}
+
+// Handle returns the reply to `req`, or nil if there is none.
+func (s *Server) Handle(req *Message) *Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch req.Type() {
+	case Discover:
+		ip := s.allocate(req.CHAddr, req.IP(OptionRequestedIP))
+		if ip == nil {
+			log.Error.Printf("DHCP: no address left in %v for %v", s.Range, req.CHAddr)
+			return nil
+		}
+		s.lease(ip, req.CHAddr, offerTime)
+		return s.reply(req, Offer, ip)
+	case Request:
+		if id := req.IP(OptionServerID); id != nil && !id.Equal(s.Router) {
+			// The client chose another server.
+			s.release(req.CHAddr)
+			return nil
+		}
+		ip := req.IP(OptionRequestedIP)
+		if ip == nil {
+			ip = req.CIAddr
+		}
+		if !s.available(ip, req.CHAddr) {
+			return s.reply(req, NAK, nil)
+		}
+		s.lease(ip, req.CHAddr, s.leaseTime())
+		log.Debug.Printf("DHCP: leased %v to %v", ip, req.CHAddr)
+		return s.reply(req, ACK, ip)
+	case Decline:
+		// The address is in use by someone else: set it aside.
+		if ip := req.IP(OptionRequestedIP); ip != nil && s.Range.Contains(ip) {
+			s.lease(ip, nil, s.leaseTime())
+		}
+	case Release:
+		s.release(req.CHAddr)
+	case Inform:
+		return s.reply(req, ACK, nil)
+	}
+	return nil
+}
+
+func (s *Server) leaseTime() time.Duration {
+	if s.LeaseTime > 0 {
+		return s.LeaseTime
+	}
+	return DefaultLeaseTime
+}
+
+// available reports whether `ip` can be leased to `mac`.
+func (s *Server) available(ip net.IP, mac net.HardwareAddr) bool {
+	if !s.Range.Contains(ip) || ip.Equal(s.Router) {
+		return false
+	}
+	l, ok := s.leases[ip.To4().String()]
+	return !ok || l.Expires.Before(time.Now()) || (l.MAC != nil && l.MAC.String() == mac.String())
+}
+
+// allocate returns the address of `mac`, if it has one, or `requested`,
+// if available, or the first address available.
+func (s *Server) allocate(mac net.HardwareAddr, requested net.IP) net.IP {
+	for _, v := range s.leases {
+		if v.MAC != nil && v.MAC.String() == mac.String() && v.Expires.After(time.Now()) {
+			return v.IP
+		}
+	}
+	if requested != nil && s.available(requested, mac) {
+		return requested.To4()
+	}
+	for v := toUint(s.Range.Start); v <= toUint(s.Range.End); v++ {
+		if ip := fromUint(v); s.available(ip, mac) {
+			return ip
+		}
+		if v == ^uint32(0) {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *Server) lease(ip net.IP, mac net.HardwareAddr, d time.Duration) {
+	if s.leases == nil {
+		s.leases = make(map[string]*Lease)
+	}
+	ip = ip.To4()
+	s.leases[ip.String()] = &Lease{IP: ip, MAC: mac, Expires: time.Now().Add(d)}
+}
+
+func (s *Server) release(mac net.HardwareAddr) {
+	for k, v := range s.leases {
+		if v.MAC != nil && v.MAC.String() == mac.String() {
+			delete(s.leases, k)
+		}
+	}
+}
+
+// reply returns the reply of type `typ` to `req`, assigning `ip`.
+func (s *Server) reply(req *Message, typ byte, ip net.IP) *Message {
+	m := &Message{
+		Reply:   true,
+		XID:     req.XID,
+		Flags:   req.Flags,
+		CIAddr:  req.CIAddr,
+		YIAddr:  ip,
+		GIAddr:  req.GIAddr,
+		CHAddr:  req.CHAddr,
+		Options: map[byte][]byte{OptionMessageType: {typ}, OptionServerID: s.Router.To4()},
+	}
+	if typ == NAK {
+		m.CIAddr = nil
+		return m
+	}
+	m.Options[OptionSubnetMask] = s.Mask
+	m.Options[OptionRouter] = s.Router.To4()
+	var dns []byte
+	for _, v := range s.DNS {
+		if v4 := v.To4(); v4 != nil {
+			dns = append(dns, v4...)
+		}
+	}
+	if len(dns) > 0 {
+		m.Options[OptionDNS] = dns
+	}
+	if ip != nil {
+		d := s.leaseTime()
+		m.Options[OptionLeaseTime] = seconds(d)
+		m.Options[OptionRenewalTime] = seconds(d / 2)
+		m.Options[OptionRebindTime] = seconds(d * 7 / 8)
+	}
+	return m
+}
+
+func seconds(d time.Duration) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(d/time.Second))
+	return b
+}
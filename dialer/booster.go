@@ -23,10 +23,20 @@ package dialer
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/crash"
+	"github.com/booster-proj/booster/events"
+	"github.com/booster-proj/booster/protocol"
+	"github.com/booster-proj/booster/qos"
+	"github.com/booster-proj/booster/sockopt"
+	"github.com/booster-proj/booster/trace"
 	"upspin.io/log"
 )
 
@@ -37,6 +47,73 @@ type Balancer interface {
 	Len() int
 }
 
+// Marker is implemented by the balancers that assign DSCP values to
+// the connections. The value returned for the target of a connection
+// is applied to its upstream socket, see the qos package.
+type Marker interface {
+	DSCP(target string) (int, bool)
+}
+
+// FWMarker is implemented by the balancers that assign firewall marks
+// to the connections. The mark returned for the target of a connection
+// replaces the one of its source, see sockopt.Options.Mark.
+type FWMarker interface {
+	FWMark(target string) (uint32, bool)
+}
+
+// Tuner is implemented by the balancers that tune the connections
+// dialed through each source, see the sockopt package.
+type Tuner interface {
+	TCPOptions(source string) (sockopt.Options, bool)
+}
+
+// options returns the options of the connections dialed through
+// source `id`: the ones of the source, if any, on top of the dialer
+// defaults.
+func (d *Dialer) options(id string) sockopt.Options {
+	o := sockopt.Options{
+		KeepAlive:   d.KeepAlive,
+		DialTimeout: d.DialTimeout,
+		IdleTimeout: d.IdleTimeout,
+	}
+	if t, ok := d.b.(Tuner); ok {
+		if so, ok := t.TCPOptions(id); ok {
+			o = o.Override(so)
+		}
+	}
+	return o
+}
+
+// blocked returns an error wrapping ErrBlocked if the host of either
+// `address` or `target` is blocked.
+func (d *Dialer) blocked(address, target string) error {
+	if d.Blocker == nil {
+		return nil
+	}
+	for _, v := range []string{target, address} {
+		host, _, err := net.SplitHostPort(v)
+		if err != nil {
+			host = v
+		}
+		if list, ok := d.Blocker.Blocked(host); ok {
+			log.Debug.Printf("DialContext: %v is blocked by list %v", host, list)
+			return fmt.Errorf("%w: %v is listed in %v", ErrBlocked, host, list)
+		}
+	}
+	return nil
+}
+
+// marked returns a copy of `ctx` carrying the DSCP value of the
+// connections to `target`, if any.
+func (d *Dialer) marked(ctx context.Context, target string) context.Context {
+	if m, ok := d.b.(Marker); ok {
+		if dscp, ok := m.DSCP(target); ok {
+			return qos.WithDSCP(ctx, dscp)
+		}
+	}
+	return ctx
+}
+
 // New returns an instance of a booster dialer.
 func New(b Balancer) *Dialer {
 	return &Dialer{b: b}
@@ -48,16 +125,131 @@ type MetricsExporter interface {
 	IncSelectedSource(labels map[string]string)
 }
 
+// UsageRecorder collects the data transferred through each source to
+// each target.
+type UsageRecorder interface {
+	RecordUsage(source, target string, sent, received int64)
+}
+
+// ErrNoSources is returned by DialContext when the balancer does not
+// have any source at its disposal.
+var ErrNoSources = errors.New("dialer: no sources available")
+
+// ErrBlocked is returned by DialContext, wrapped, when the destination
+// is blocked by the Blocker of the dialer.
+var ErrBlocked = errors.New("dialer: destination blocked")
+
+// Blocker decides which destinations cannot be connected to, e.g. the
+// ones listed in ad and tracker blocklists, see the blocklist package.
+type Blocker interface {
+	Blocked(host string) (list string, ok bool)
+}
+
+// EmptyPollInterval is the interval used to check if a source became
+// available, when the dialer is waiting for one.
+var EmptyPollInterval = time.Millisecond * 100
+
 // Dialer is a core.Dialer implementation, which uses a core.Balancer
 // instance to to retrieve a source to use when it comes to dial a network
 // connection.
 type Dialer struct {
 	b Balancer
 
+	// EmptyWait is the maximum amount of time that DialContext waits
+	// for a source to become available when the balancer is empty, which
+	// is common at boot while the interfaces are still coming up.
+	// If zero, DialContext fails immediately with ErrNoSources.
+	EmptyWait time.Duration
+
+	// SniffPorts are the ports of the connections to IP addresses that
+	// are not dialed until the TLS ClientHello or the HTTP request sent
+	// by the client is inspected: the server name or the Host header it
+	// contains is used as target when selecting the source, so that
+	// hostname based policies apply to clients that connect by IP.
+	// If empty, no connection is sniffed.
+	SniffPorts []int
+	// SniffTimeout is the maximum amount of time that a sniffed
+	// connection waits for the ClientHello when the client reads
+	// first. When it expires, the connection is dialed to its IP
+	// address. If zero, DefaultSniffTimeout is used.
+	SniffTimeout time.Duration
+	// Classify makes every connection wait for the first bytes sent
+	// by the client, which are used to detect its protocol before
+	// selecting the source, see the protocol package. Connections
+	// whose server talks first are dialed after SniffTimeout, with
+	// an unknown protocol.
+	Classify bool
+
+	// DialTimeout is the maximum amount of time each attempt to dial
+	// a connection through a source can take, before trying the next
+	// source. If zero, only the operating system timeout applies.
+	DialTimeout time.Duration
+	// KeepAlive is the interval between the keep-alive probes of the
+	// connections dialed. If zero, the Go default is used, if
+	// negative keep-alives are disabled.
+	KeepAlive time.Duration
+	// IdleTimeout is the maximum amount of time a connection can stay
+	// open without transferring any data, after which it is closed
+	// by the reaper, within ReapInterval. If zero, idle connections
+	// are kept open.
+	IdleTimeout time.Duration
+	// The defaults above are overridden by the options of each
+	// source, if the balancer is a Tuner.
+
+	// Race, if true, makes the dialer race the connect over the two
+	// best sources selected by the balancer, using the connection
+	// established first, unless the target is sticky. See Binder.
+	Race bool
+	// RaceDelay is the head start of the best source: the other one
+	// is dialed only if the connection is not established within
+	// RaceDelay, or as soon as it fails. If zero, both sources are
+	// dialed at once.
+	RaceDelay time.Duration
+
+	// PoolSize is the number of connections established in advance
+	// to each hot destination, for each source, so that the clients
+	// connecting to them skip the handshake. A destination is hot
+	// when it is dialed again within PoolTTL. If zero, no connection
+	// is pooled.
+	PoolSize int
+	// PoolTTL is the maximum amount of time a pooled connection is
+	// kept before being closed, as the servers drop the idle ones.
+	// If zero, DefaultPoolTTL is used.
+	PoolTTL time.Duration
+	// PoolDestinations is the maximum number of destinations pooled
+	// at once. If zero, DefaultPoolDestinations is used.
+	PoolDestinations int
+
+	// ResetOnFailure selects the connections that are reset when
+	// their source fails, see Reset. If empty, none is.
+	ResetOnFailure []ResetRule
+
+	// Crashes reports the panics recovered while dialing, which make
+	// the dial fail instead of bringing booster down.
+	Crashes *crash.Reporter
+
+	// If Events is not nil, the dialer publishes a TopicFailover
+	// event each time a connection is dialed through a source after
+	// the failure of the ones selected before.
+	Events *events.Bus
+	// If ConnEvents is not nil, the dialer publishes a TopicConnOpen
+	// and a TopicConnClose event for each connection dialed. They are
+	// kept apart from Events, as they are many more.
+	ConnEvents *events.Bus
+	// If Usage is not nil, it receives the amount of data
+	// transferred by each connection, as soon as it is transferred.
+	Usage UsageRecorder
+	// If Blocker is not nil, the connections to the destinations it
+	// blocks are refused.
+	Blocker Blocker
+
 	metrics struct {
 		sync.Mutex
 		exporter MetricsExporter
 	}
+
+	conns conns
+	pool  pool
 }
 
 // DialContext dials a connection using `network` to `address`. The connection returned
@@ -66,37 +258,187 @@ type Dialer struct {
 // tries to dial it using another source, until source exhaustion. It that case,
 // only the last error received is returned.
 func (d *Dialer) DialContext(ctx context.Context, network, address string) (conn net.Conn, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			conn, err = nil, d.Crashes.Handle(v, "dialer", map[string]string{"network": network, "address": address})
+		}
+	}()
+	if d.Classify || d.shouldSniff(address) {
+		if err := d.waitSources(ctx); err != nil {
+			return nil, err
+		}
+		return newSniffConn(ctx, d, network, address), nil
+	}
+	return d.dial(ctx, network, address, address)
+}
+
+// dial dials a connection to `address`, using `target` to select the
+// source.
+func (d *Dialer) dial(ctx context.Context, network, address, target string) (conn net.Conn, err error) {
+	ctx, span := trace.Start(ctx, "booster.dial")
+	span.SetAttr("target", target)
+	defer func() { span.End(err) }()
+
+	if err = d.blocked(address, target); err != nil {
+		return
+	}
+	if err = d.waitSources(ctx); err != nil {
+		return
+	}
+
 	bl := make([]core.Source, 0, d.Len()) // blacklisted sources
 
+	dctx := d.marked(ctx, target)
+	if dscp, ok := qos.FromContext(dctx); ok {
+		span.SetAttr("dscp", dscp)
+	}
+	proto, _ := protocol.FromContext(ctx)
+	if proto != "" {
+		span.SetAttr("protocol", string(proto))
+	}
+
 	// If the dialing fails, keep on trying with the other sources until exaustion.
 	for i := 0; len(bl) < d.Len(); i++ {
+		span.SetAttr("attempts", i+1)
+
 		var src core.Source
-		src, err = d.b.Get(ctx, address, bl...)
+		_, sel := trace.Start(ctx, "booster.select")
+		src, err = d.b.Get(ctx, target, bl...)
 		if err != nil {
 			// Fail directly if the balancer returns an error, as
 			// we do not have any source to use.
+			sel.End(err)
 			return
 		}
+		sel.SetAttr("source", src.ID())
+		var o sockopt.Options
+		var pooled bool
+		conn, o, pooled = d.pooled(src.ID(), address)
+		candidates := []core.Source{src}
+		if !pooled && i == 0 && d.shouldRace(target) {
+			// Only the first attempt is raced: once a source
+			// fails, the next ones are tried in turn.
+			if alt, err := d.b.Get(ctx, target, append(bl[:len(bl):len(bl)], src)...); err == nil && alt.ID() != src.ID() {
+				log.Debug.Printf("DialContext: Racing source %v against %v to connect to %v", src.ID(), alt.ID(), target)
+				sel.SetAttr("alternative", alt.ID())
+				candidates = append(candidates, alt)
+			}
+		}
+		sel.End(nil)
 
-		d.sendMetrics(src.ID(), address)
+		for _, v := range candidates {
+			d.sendMetrics(v.ID(), target)
+		}
 
-		log.Debug.Printf("DialContext: Attempt #%d to connect to %v (source %v)", i, address, src.ID())
+		if pooled {
+			log.Debug.Printf("DialContext: Attempt #%d to connect to %v (source %v, pooled connection)", i, target, src.ID())
+			span.SetAttr("pooled", true)
+		} else {
+			log.Debug.Printf("DialContext: Attempt #%d to connect to %v (source %v)", i, target, src.ID())
 
-		conn, err = src.DialContext(ctx, "tcp4", address)
-		if err != nil {
-			// Log this error, otherwise it will be silently skipped.
-			log.Error.Printf("Unable to dial connection to %v using source %v. Error: %v", address, src.ID(), err)
-			bl = append(bl, src)
-			continue
+			var failed []core.Source
+			src, conn, o, failed, err = d.race(dctx, address, target, candidates...)
+			bl = append(bl, failed...)
+			if err != nil {
+				continue
+			}
 		}
+		d.refill(src, address, target)
 
-		// Connection dialed successfully.
+		// Connection dialed successfully. Keep on tracing it
+		// until it is closed.
+		span.SetAttr("source", src.ID())
+		_, cspan := trace.Start(ctx, "booster.conn")
+		cspan.SetAttr("source", src.ID())
+		cspan.SetAttr("target", target)
+		conn = d.track(trace.Conn(conn, cspan), src.ID(), target, proto, o.IdleTimeout)
+		if len(bl) > 0 {
+			d.publishFailover(bl, src, target)
+		}
 		break
 	}
 
 	return
 }
 
+// DialSource dials `address` through `src`, without asking the balancer
+// for a source and without trying the others if it fails. It is used
+// by the callers that spread the transfers over the sources on their
+// own, e.g. the turbo proxy, whose connections are still marked,
+// tuned, tracked and accounted for as the ones dialed by DialContext.
+func (d *Dialer) DialSource(ctx context.Context, src core.Source, network, address string) (conn net.Conn, err error) {
+	ctx, span := trace.Start(ctx, "booster.dial")
+	span.SetAttr("target", address)
+	span.SetAttr("source", src.ID())
+	defer func() { span.End(err) }()
+
+	if err = d.blocked(address, address); err != nil {
+		return
+	}
+	d.sendMetrics(src.ID(), address)
+
+	var o sockopt.Options
+	if conn, o, err = d.connect(d.marked(ctx, address), src, address, address); err != nil {
+		logDialErr(address, src, err)
+		return
+	}
+	_, cspan := trace.Start(ctx, "booster.conn")
+	cspan.SetAttr("source", src.ID())
+	cspan.SetAttr("target", address)
+	proto, _ := protocol.FromContext(ctx)
+	conn = d.track(trace.Conn(conn, cspan), src.ID(), address, proto, o.IdleTimeout)
+	return
+}
+
+// Failover is the data of the TopicFailover events.
+type Failover struct {
+	Target string   `json:"target"`
+	Source string   `json:"source"`
+	Failed []string `json:"failed"`
+}
+
+func (d *Dialer) publishFailover(failed []core.Source, src core.Source, target string) {
+	ids := make([]string, 0, len(failed))
+	for _, v := range failed {
+		ids = append(ids, v.ID())
+	}
+	d.Events.Publish(events.Event{
+		Topic:   events.TopicFailover,
+		Message: fmt.Sprintf("sources %v failed, connections moved to %v", strings.Join(ids, ", "), src.ID()),
+		Data:    &Failover{Target: target, Source: src.ID(), Failed: ids},
+	})
+}
+
+// waitSources returns nil as soon as the balancer has at least one source,
+// waiting at most EmptyWait. Returns ErrNoSources otherwise, or the context
+// error if it is canceled in the meanwhile.
+func (d *Dialer) waitSources(ctx context.Context) error {
+	if d.Len() > 0 {
+		return nil
+	}
+	if d.EmptyWait <= 0 {
+		return ErrNoSources
+	}
+
+	log.Debug.Printf("DialContext: no sources available, waiting up to %v", d.EmptyWait)
+	timeout := time.After(d.EmptyWait)
+	ticker := time.NewTicker(EmptyPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout:
+			return ErrNoSources
+		case <-ticker.C:
+			if d.Len() > 0 {
+				return nil
+			}
+		}
+	}
+}
+
 // Len returns the number of sources that the dialer as at it's disposal.
 func (d *Dialer) Len() int {
 	return d.b.Len()
@@ -0,0 +1,237 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package dialer_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/crash"
+	"github.com/booster-proj/booster/dialer"
+	"github.com/booster-proj/booster/events"
+	"github.com/booster-proj/booster/sockopt"
+)
+
+type mock struct {
+	id string
+}
+
+func (s *mock) ID() string {
+	return s.id
+}
+
+func (s *mock) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, _ := net.Pipe()
+	return conn, nil
+}
+
+func (s *mock) Close() error {
+	return nil
+}
+
+type balancer struct {
+	core.Balancer
+}
+
+func (b *balancer) Get(ctx context.Context, target string, blacklisted ...core.Source) (core.Source, error) {
+	return b.Balancer.Get(ctx, blacklisted...)
+}
+
+func TestDialContext_empty(t *testing.T) {
+	d := dialer.New(&balancer{})
+	if _, err := d.DialContext(context.Background(), "tcp", "host:80"); err != dialer.ErrNoSources {
+		t.Fatalf("Unexpected error: wanted %v, found %v", dialer.ErrNoSources, err)
+	}
+
+	d.EmptyWait = time.Millisecond * 50
+	t0 := time.Now()
+	if _, err := d.DialContext(context.Background(), "tcp", "host:80"); err != dialer.ErrNoSources {
+		t.Fatalf("Unexpected error: wanted %v, found %v", dialer.ErrNoSources, err)
+	}
+	if time.Since(t0) < d.EmptyWait {
+		t.Fatalf("DialContext did not wait for a source")
+	}
+}
+
+func TestDialContext_wait(t *testing.T) {
+	b := &balancer{}
+	d := dialer.New(b)
+	d.EmptyWait = time.Second
+
+	go func() {
+		<-time.After(time.Millisecond * 50)
+		b.Put(&mock{id: "s0"})
+	}()
+
+	conn, err := d.DialContext(context.Background(), "tcp", "host:80")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	conn.Close()
+}
+
+func TestDialContext_cancel(t *testing.T) {
+	d := dialer.New(&balancer{})
+	d.EmptyWait = time.Minute
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := d.DialContext(ctx, "tcp", "host:80"); err != ctx.Err() {
+		t.Fatalf("Unexpected error: wanted %v, found %v", ctx.Err(), err)
+	}
+}
+
+type failingMock struct {
+	mock
+}
+
+func (s *failingMock) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return nil, errors.New("no internet connection")
+}
+
+func TestDialContext_failover(t *testing.T) {
+	b := &balancer{}
+	b.Put(&failingMock{mock{id: "s0"}}, &mock{id: "s1"})
+	bus := new(events.Bus)
+	d := dialer.New(b)
+	d.Events = bus
+
+	for i := 0; i < 2; i++ {
+		conn, err := d.DialContext(context.Background(), "tcp", "host:80")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		conn.Close()
+	}
+
+	// Whichever source is selected first, s0 fails at least once.
+	recent := bus.Recent()
+	if len(recent) == 0 {
+		t.Fatalf("No failover event was published")
+	}
+	for _, e := range recent {
+		f, ok := e.Data.(*dialer.Failover)
+		if e.Topic != events.TopicFailover || !ok {
+			t.Fatalf("Unexpected event: %v", e)
+		}
+		if f.Source != "s1" || len(f.Failed) != 1 || f.Failed[0] != "s0" || f.Target != "host:80" {
+			t.Fatalf("Unexpected failover: %+v", f)
+		}
+	}
+}
+
+type panickingMock struct {
+	mock
+}
+
+func (s *panickingMock) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	panic("dialing bug")
+}
+
+func TestDialContext_panic(t *testing.T) {
+	b := &balancer{}
+	b.Put(&panickingMock{mock{id: "s0"}})
+	bus := new(events.Bus)
+	d := dialer.New(b)
+	d.Crashes = &crash.Reporter{Events: bus}
+
+	// The panic fails the dial only.
+	if _, err := d.DialContext(context.Background(), "tcp", "host:80"); err == nil {
+		t.Fatalf("Dial succeeded despite the panic")
+	}
+	recent := bus.Recent()
+	if len(recent) != 1 || recent[0].Topic != events.TopicCrash {
+		t.Fatalf("Unexpected events: %v", recent)
+	}
+	if rep := recent[0].Data.(crash.Report); rep.Panic != "dialing bug" || rep.Conn["address"] != "host:80" {
+		t.Fatalf("Unexpected report: %+v", rep)
+	}
+}
+
+// hangingMock dials connections that never complete.
+type hangingMock struct {
+	mock
+}
+
+func (s *hangingMock) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+type tuner struct {
+	balancer
+	options map[string]sockopt.Options
+}
+
+func (b *tuner) TCPOptions(source string) (sockopt.Options, bool) {
+	o, ok := b.options[source]
+	return o, ok
+}
+
+func TestDialContext_timeout(t *testing.T) {
+	b := &tuner{}
+	b.Put(&hangingMock{mock{id: "s0"}}, &mock{id: "s1"})
+	d := dialer.New(b)
+	d.DialTimeout = time.Millisecond * 50
+
+	for i := 0; i < 2; i++ {
+		conn, err := d.DialContext(context.Background(), "tcp", "host:80")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		conn.Close()
+	}
+
+	// The options of the source override the default timeout.
+	b = &tuner{options: map[string]sockopt.Options{"s0": {DialTimeout: time.Millisecond * 50}}}
+	b.Put(&hangingMock{mock{id: "s0"}})
+	d = dialer.New(b)
+	d.DialTimeout = time.Minute
+
+	t0 := time.Now()
+	if _, err := d.DialContext(context.Background(), "tcp", "host:80"); err != context.DeadlineExceeded {
+		t.Fatalf("Unexpected error: wanted %v, found %v", context.DeadlineExceeded, err)
+	}
+	if time.Since(t0) > time.Second {
+		t.Fatalf("The timeout of the source was not applied")
+	}
+}
+
+type blocker map[string]bool
+
+func (b blocker) Blocked(host string) (string, bool) {
+	return "test", b[host]
+}
+
+func TestDialContext_blocked(t *testing.T) {
+	b := &balancer{}
+	b.Put(&mock{id: "s0"})
+	d := dialer.New(b)
+	d.Blocker = blocker{"ads.example.com": true}
+
+	if _, err := d.DialContext(context.Background(), "tcp", "ads.example.com:443"); !errors.Is(err, dialer.ErrBlocked) {
+		t.Fatalf("Unexpected error: wanted %v, found %v", dialer.ErrBlocked, err)
+	}
+	conn, err := d.DialContext(context.Background(), "tcp", "example.com:443")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	conn.Close()
+}
@@ -0,0 +1,231 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package dialer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/booster-proj/booster/events"
+	"github.com/booster-proj/booster/protocol"
+)
+
+// ConnInfo describes a connection dialed by the Dialer that is still
+// open.
+type ConnInfo struct {
+	ID     uint64 `json:"id"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+	// Protocol is the protocol detected, if the dialer classifies
+	// the connections.
+	Protocol protocol.Protocol `json:"protocol,omitempty"`
+	Started  time.Time         `json:"started"`
+	// LastActive is the last time the connection transferred some
+	// data, or when it was started.
+	LastActive time.Time `json:"last_active"`
+}
+
+// conn is a connection tracked by the Dialer. Each connection has its
+// own context, canceled when the connection is closed, killed or when
+// the dialer itself is closed: the underlying connection is then
+// closed immediately, interrupting the reads and writes in progress
+// in both directions.
+type conn struct {
+	net.Conn
+	info  ConnInfo
+	usage UsageRecorder
+	// If idle is not zero, the connection is closed by the reaper
+	// when it does not transfer any data for longer. active is the
+	// unix time in nanoseconds of the last read or write.
+	idle   time.Duration
+	active int64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	once   sync.Once
+	err    error
+}
+
+func (c *conn) Close() error {
+	c.cancel()
+	return c.close()
+}
+
+func (c *conn) Unwrap() net.Conn {
+	return c.Conn
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.Relayed(n, false)
+	return n, err
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.Relayed(n, true)
+	return n, err
+}
+
+func (c *conn) Relayed(n int, write bool) {
+	if n <= 0 {
+		return
+	}
+	atomic.StoreInt64(&c.active, time.Now().UnixNano())
+	if c.usage == nil {
+		return
+	}
+	if write {
+		c.usage.RecordUsage(c.info.Source, c.info.Target, int64(n), 0)
+	} else {
+		c.usage.RecordUsage(c.info.Source, c.info.Target, 0, int64(n))
+	}
+}
+
+func (c *conn) close() error {
+	c.once.Do(func() {
+		c.err = c.Conn.Close()
+	})
+	return c.err
+}
+
+func (c *conn) lastActive() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&c.active))
+}
+
+type conns struct {
+	sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	next    uint64
+	m       map[uint64]*conn
+	reaping bool
+}
+
+// track makes the dialer keep track of `c`, dialed through `src` to
+// `target`, until it is closed or, if `idle` is not zero, until it
+// stays idle for longer.
+func (d *Dialer) track(c net.Conn, src, target string, proto protocol.Protocol, idle time.Duration) net.Conn {
+	d.conns.Lock()
+	if d.conns.ctx == nil {
+		d.conns.ctx, d.conns.cancel = context.WithCancel(context.Background())
+	}
+	if d.conns.m == nil {
+		d.conns.m = make(map[uint64]*conn)
+	}
+	d.conns.next++
+	tc := &conn{Conn: c, usage: d.Usage, idle: idle, info: ConnInfo{
+		ID:       d.conns.next,
+		Source:   src,
+		Target:   target,
+		Protocol: proto,
+		Started:  time.Now(),
+	}}
+	tc.active = tc.info.Started.UnixNano()
+	tc.ctx, tc.cancel = context.WithCancel(d.conns.ctx)
+	d.conns.m[tc.info.ID] = tc
+	if idle > 0 {
+		d.startReaper()
+	}
+	d.conns.Unlock()
+	d.ConnEvents.Publish(events.Event{
+		Topic:   events.TopicConnOpen,
+		Message: fmt.Sprintf("connection %d to %v opened through %v", tc.info.ID, target, src),
+		Data:    tc.info,
+	})
+
+	go func() {
+		defer d.Crashes.Recover("dialer", map[string]string{"source": src, "target": target})
+		<-tc.ctx.Done()
+		tc.close()
+
+		d.conns.Lock()
+		delete(d.conns.m, tc.info.ID)
+		d.conns.Unlock()
+		d.ConnEvents.Publish(events.Event{
+			Topic:   events.TopicConnClose,
+			Message: fmt.Sprintf("connection %d to %v closed after %v", tc.info.ID, target, time.Since(tc.info.Started).Round(time.Millisecond)),
+			Data:    tc.info,
+		})
+	}()
+	return tc
+}
+
+// Conns returns the connections dialed that are still open, sorted
+// by identifier.
+func (d *Dialer) Conns() []ConnInfo {
+	d.conns.Lock()
+	defer d.conns.Unlock()
+
+	acc := make([]ConnInfo, 0, len(d.conns.m))
+	for _, v := range d.conns.m {
+		info := v.info
+		info.LastActive = v.lastActive()
+		acc = append(acc, info)
+	}
+	sort.Slice(acc, func(i, j int) bool { return acc[i].ID < acc[j].ID })
+	return acc
+}
+
+// Kill closes connection `id`. Returns false if there is no such
+// connection.
+func (d *Dialer) Kill(id uint64) bool {
+	d.conns.Lock()
+	c, ok := d.conns.m[id]
+	d.conns.Unlock()
+
+	if ok {
+		c.cancel()
+	}
+	return ok
+}
+
+// Drain closes the connections dialed through source `id`, returning
+// how many they were.
+func (d *Dialer) Drain(id string) int {
+	d.conns.Lock()
+	acc := make([]*conn, 0, len(d.conns.m))
+	for _, v := range d.conns.m {
+		if v.info.Source == id {
+			acc = append(acc, v)
+		}
+	}
+	d.conns.Unlock()
+
+	for _, v := range acc {
+		v.cancel()
+	}
+	return len(acc)
+}
+
+// Close closes every connection dialed, including the ones dialed
+// after Close returns.
+func (d *Dialer) Close() error {
+	d.conns.Lock()
+	defer d.conns.Unlock()
+
+	if d.conns.ctx == nil {
+		d.conns.ctx, d.conns.cancel = context.WithCancel(context.Background())
+	}
+	d.conns.cancel()
+	d.closePool()
+	return nil
+}
@@ -0,0 +1,165 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package dialer_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/dialer"
+)
+
+// readErr reads from `conn` in the background, returning a channel
+// that receives the read error.
+func readErr(conn net.Conn) <-chan error {
+	c := make(chan error, 1)
+	go func() {
+		_, err := conn.Read(make([]byte, 1))
+		c <- err
+	}()
+	return c
+}
+
+func waitErr(t *testing.T, c <-chan error) {
+	select {
+	case err := <-c:
+		if err == nil {
+			t.Fatalf("Read should have failed")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Read was not interrupted")
+	}
+}
+
+func TestDialer_Kill(t *testing.T) {
+	src := &pipe{peers: make(chan net.Conn, 2)}
+	d := dialer.New(&recorder{src: src})
+
+	c0, err := d.DialContext(context.Background(), "tcp", "example.com:80")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer c0.Close()
+	c1, err := d.DialContext(context.Background(), "tcp", "example.org:80")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer c1.Close()
+
+	conns := d.Conns()
+	if len(conns) != 2 {
+		t.Fatalf("Unexpected connections: %+v", conns)
+	}
+	if conns[0].Source != "pipe" || conns[0].Target != "example.com:80" {
+		t.Fatalf("Unexpected connection info: %+v", conns[0])
+	}
+
+	read := readErr(c0)
+	if !d.Kill(conns[0].ID) {
+		t.Fatalf("Connection %d not found", conns[0].ID)
+	}
+	waitErr(t, read)
+	if d.Kill(conns[0].ID) {
+		t.Fatalf("Connection %d was killed twice", conns[0].ID)
+	}
+
+	read = readErr(c1)
+	if n := d.Drain("pipe"); n != 1 {
+		t.Fatalf("Unexpected number of connections drained: wanted 1, found %d", n)
+	}
+	waitErr(t, read)
+}
+
+func TestDialer_Close(t *testing.T) {
+	src := &pipe{peers: make(chan net.Conn, 2)}
+	d := dialer.New(&recorder{src: src})
+
+	conn, err := d.DialContext(context.Background(), "tcp", "example.com:80")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	read := readErr(conn)
+	d.Close()
+	waitErr(t, read)
+
+	// Closed connections are no longer tracked.
+	conn.Close()
+	for deadline := time.Now().Add(time.Second); len(d.Conns()) > 0; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Unexpected connections: %+v", d.Conns())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDialer_IdleTimeout(t *testing.T) {
+	defer func(d time.Duration) { dialer.ReapInterval = d }(dialer.ReapInterval)
+	dialer.ReapInterval = time.Millisecond * 10
+
+	src := &pipe{peers: make(chan net.Conn, 1)}
+	d := dialer.New(&recorder{src: src})
+	d.IdleTimeout = time.Millisecond * 50
+
+	conn, err := d.DialContext(context.Background(), "tcp", "example.com:80")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	// Reads that do not receive any data do not count as activity.
+	waitErr(t, readErr(conn))
+}
+
+func TestDialer_Reap(t *testing.T) {
+	src := &pipe{peers: make(chan net.Conn, 2)}
+	d := dialer.New(&recorder{src: src})
+
+	idle, err := d.DialContext(context.Background(), "tcp", "example.com:80")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer idle.Close()
+	time.Sleep(time.Millisecond * 50)
+
+	active, err := d.DialContext(context.Background(), "tcp", "example.org:80")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer active.Close()
+	<-src.peers
+	go (<-src.peers).Write([]byte("x"))
+	if _, err := active.Read(make([]byte, 1)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	conns := d.Conns()
+	if len(conns) != 2 || !conns[1].LastActive.After(conns[0].LastActive) {
+		t.Fatalf("Unexpected connections: %+v", conns)
+	}
+
+	// No idle timeout is set, so only the explicit sweeps close the
+	// connections.
+	if n := d.Reap(0); n != 0 {
+		t.Fatalf("Unexpected number of connections reaped: wanted 0, found %d", n)
+	}
+	read := readErr(idle)
+	if n := d.Reap(time.Millisecond * 30); n != 1 {
+		t.Fatalf("Unexpected number of connections reaped: wanted 1, found %d", n)
+	}
+	waitErr(t, read)
+}
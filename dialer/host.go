@@ -0,0 +1,100 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package dialer
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+)
+
+var (
+	errNotHTTP = errors.New("host: not an HTTP request")
+	errNoHost  = errors.New("host: no Host header")
+)
+
+// httpHost returns the host contained in the Host header of the HTTP
+// request at the beginning of `b`, without its port.
+func httpHost(b []byte) (string, error) {
+	end := bytes.Index(b, []byte("\r\n\r\n"))
+	if end < 0 {
+		// Fail as soon as the request line is not valid, to avoid
+		// waiting for data that is never going to come.
+		line, partial := b, true
+		if i := bytes.IndexByte(b, '\n'); i >= 0 {
+			line, partial = b[:i], false
+		}
+		if !validRequestLine(line, partial) {
+			return "", errNotHTTP
+		}
+		return "", errIncomplete
+	}
+
+	lines := strings.Split(string(b[:end]), "\r\n")
+	if !validRequestLine([]byte(lines[0]), false) {
+		return "", errNotHTTP
+	}
+	for _, l := range lines[1:] {
+		i := strings.IndexByte(l, ':')
+		if i < 0 || !strings.EqualFold(l[:i], "Host") {
+			continue
+		}
+		host := strings.TrimSpace(l[i+1:])
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if host == "" {
+			break
+		}
+		return host, nil
+	}
+	return "", errNoHost
+}
+
+// validRequestLine returns true if `line` is an HTTP request line, i.e.
+// "METHOD target HTTP/x.y", or its beginning when `partial` is true.
+func validRequestLine(line []byte, partial bool) bool {
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	i := bytes.IndexByte(line, ' ')
+	if i < 0 {
+		return partial && isToken(line)
+	}
+	if i == 0 || !isToken(line[:i]) {
+		return false
+	}
+	j := bytes.LastIndexByte(line, ' ')
+	if j == i {
+		return partial
+	}
+	proto := line[j+1:]
+	if partial && len(proto) < len("HTTP/") {
+		return bytes.HasPrefix([]byte("HTTP/"), proto)
+	}
+	return bytes.HasPrefix(proto, []byte("HTTP/"))
+}
+
+// isToken returns true if `b` is made of uppercase letters only, as
+// the request methods are.
+func isToken(b []byte) bool {
+	for _, c := range b {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,274 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package dialer
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/sockopt"
+	"upspin.io/log"
+)
+
+// Pool defaults, see the Dialer fields.
+const (
+	DefaultPoolTTL          = time.Second * 10
+	DefaultPoolDestinations = 16
+)
+
+type poolKey struct {
+	source  string
+	address string
+}
+
+type pooledConn struct {
+	net.Conn
+	o      sockopt.Options
+	t      *time.Timer
+	target string
+}
+
+// pool holds the connections established in advance. seen records
+// the last time each destination was dialed, to find the hot ones.
+type pool struct {
+	sync.Mutex
+	closed  bool
+	conns   map[poolKey][]*pooledConn
+	filling map[poolKey]int
+	seen    map[poolKey]time.Time
+}
+
+func (d *Dialer) poolTTL() time.Duration {
+	if d.PoolTTL > 0 {
+		return d.PoolTTL
+	}
+	return DefaultPoolTTL
+}
+
+func (d *Dialer) poolDestinations() int {
+	if d.PoolDestinations > 0 {
+		return d.PoolDestinations
+	}
+	return DefaultPoolDestinations
+}
+
+// pooled returns a connection to `address` established in advance
+// through source `id`, with its options, if any.
+func (d *Dialer) pooled(id, address string) (net.Conn, sockopt.Options, bool) {
+	if d.PoolSize <= 0 {
+		return nil, sockopt.Options{}, false
+	}
+	key := poolKey{source: id, address: address}
+
+	d.pool.Lock()
+	defer d.pool.Unlock()
+
+	conns := d.pool.conns[key]
+	if len(conns) == 0 {
+		return nil, sockopt.Options{}, false
+	}
+	// The oldest connection is the first to expire.
+	c := conns[0]
+	d.pool.remove(key, c)
+	c.t.Stop()
+	return c.Conn, c.o, true
+}
+
+// refill establishes the connections to `address` through `src`
+// needed to fill its pool, if the destination is hot. `target` is
+// the target of the connections, used to mark them.
+func (d *Dialer) refill(src core.Source, address, target string) {
+	if d.PoolSize <= 0 {
+		return
+	}
+	key := poolKey{source: src.ID(), address: address}
+	now := time.Now()
+	ttl := d.poolTTL()
+
+	d.pool.Lock()
+	if d.pool.closed {
+		d.pool.Unlock()
+		return
+	}
+	if d.pool.seen == nil {
+		d.pool.seen = make(map[poolKey]time.Time)
+		d.pool.conns = make(map[poolKey][]*pooledConn)
+		d.pool.filling = make(map[poolKey]int)
+	}
+	last, hot := d.pool.seen[key]
+	hot = hot && now.Sub(last) < ttl
+	d.pool.seen[key] = now
+	if len(d.pool.seen) > 4*d.poolDestinations() {
+		for k, v := range d.pool.seen {
+			if now.Sub(v) >= ttl {
+				delete(d.pool.seen, k)
+			}
+		}
+	}
+	_, pooling := d.pool.conns[key]
+	if !pooling {
+		pooling = d.pool.filling[key] > 0
+	}
+	if !pooling && (!hot || len(d.pool.conns)+len(d.pool.filling) >= d.poolDestinations()) {
+		d.pool.Unlock()
+		return
+	}
+	n := d.PoolSize - len(d.pool.conns[key]) - d.pool.filling[key]
+	if n > 0 {
+		d.pool.filling[key] += n
+	}
+	d.pool.Unlock()
+
+	for i := 0; i < n; i++ {
+		go d.fill(src, key, target)
+	}
+}
+
+// fill establishes a connection to the destination `key` and adds it
+// to the pool, until it expires.
+func (d *Dialer) fill(src core.Source, key poolKey, target string) {
+	conn, o, err := d.connect(d.marked(context.Background(), target), src, key.address, target)
+
+	d.pool.Lock()
+	defer d.pool.Unlock()
+
+	if d.pool.filling[key]--; d.pool.filling[key] <= 0 {
+		delete(d.pool.filling, key)
+	}
+	if err != nil {
+		log.Debug.Printf("Unable to pool a connection to %v using source %v: %v", key.address, src.ID(), err)
+		return
+	}
+	if d.pool.closed {
+		conn.Close()
+		return
+	}
+
+	c := &pooledConn{Conn: conn, o: o, target: target}
+	c.t = time.AfterFunc(d.poolTTL(), func() {
+		d.pool.Lock()
+		ok := d.pool.remove(key, c)
+		d.pool.Unlock()
+		if ok {
+			c.Close()
+		}
+	})
+	d.pool.conns[key] = append(d.pool.conns[key], c)
+}
+
+// Redial moves the connections pooled through source `id`, which is
+// meant to have failed, to the source that the balancer selects in its
+// place for each destination: they are closed, and as many are
+// established in the background through the other source, so that the
+// next clients connecting to the destination do not pay for the
+// failure. Returns the number of connections established again.
+func (d *Dialer) Redial(id string) int {
+	if d.PoolSize <= 0 {
+		return 0
+	}
+
+	type dest struct {
+		address, target string
+		n               int
+	}
+	var acc []dest
+	d.pool.Lock()
+	for key, conns := range d.pool.conns {
+		if key.source != id {
+			continue
+		}
+		for _, c := range conns {
+			c.t.Stop()
+			c.Close()
+		}
+		delete(d.pool.conns, key)
+		delete(d.pool.seen, key)
+		acc = append(acc, dest{address: key.address, target: conns[0].target, n: len(conns)})
+	}
+	d.pool.Unlock()
+
+	var n int
+	for _, v := range acc {
+		src, err := d.b.Get(context.Background(), v.target)
+		if err != nil || src.ID() == id {
+			log.Debug.Printf("Unable to pool the connections to %v again: no other source available", v.address)
+			continue
+		}
+		key := poolKey{source: src.ID(), address: v.address}
+
+		d.pool.Lock()
+		if d.pool.closed {
+			d.pool.Unlock()
+			break
+		}
+		d.pool.seen[key] = time.Now()
+		missing := d.PoolSize - len(d.pool.conns[key]) - d.pool.filling[key]
+		if missing > v.n {
+			missing = v.n
+		}
+		if missing > 0 {
+			d.pool.filling[key] += missing
+		}
+		d.pool.Unlock()
+
+		for i := 0; i < missing; i++ {
+			go d.fill(src, key, v.target)
+		}
+		if missing > 0 {
+			n += missing
+			log.Debug.Printf("Pooling %d connections to %v through %v in place of %v", missing, v.address, src.ID(), id)
+		}
+	}
+	return n
+}
+
+// remove removes `c` from the pool of `key`, returning false if it is
+// no longer there.
+func (p *pool) remove(key poolKey, c *pooledConn) bool {
+	conns := p.conns[key]
+	for i, v := range conns {
+		if v != c {
+			continue
+		}
+		conns = append(conns[:i:i], conns[i+1:]...)
+		if len(conns) == 0 {
+			delete(p.conns, key)
+		} else {
+			p.conns[key] = conns
+		}
+		return true
+	}
+	return false
+}
+
+// closePool closes the pooled connections, and stops pooling new
+// ones.
+func (d *Dialer) closePool() {
+	d.pool.Lock()
+	defer d.pool.Unlock()
+
+	d.pool.closed = true
+	for _, conns := range d.pool.conns {
+		for _, c := range conns {
+			c.t.Stop()
+			c.Close()
+		}
+	}
+	d.pool.conns = nil
+}
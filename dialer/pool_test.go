@@ -0,0 +1,150 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package dialer_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/dialer"
+)
+
+// waitDials waits until `src` dials `n` connections.
+func waitDials(t *testing.T, src *pipe, n int) {
+	for deadline := time.Now().Add(time.Second); len(src.peers) != n; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Unexpected number of connections dialed: wanted %d, found %d", n, len(src.peers))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDialContext_pool(t *testing.T) {
+	src := &pipe{peers: make(chan net.Conn, 16)}
+	d := dialer.New(&recorder{src: src})
+	d.PoolSize = 2
+	defer d.Close()
+
+	dial := func(address string) {
+		conn, err := d.DialContext(context.Background(), "tcp", address)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		conn.Close()
+	}
+
+	// The destination becomes hot when it is dialed again.
+	dial("example.com:443")
+	waitDials(t, src, 1)
+	dial("example.com:443")
+	waitDials(t, src, 4)
+
+	// The next connection is taken from the pool, which is refilled.
+	dial("example.com:443")
+	waitDials(t, src, 5)
+	time.Sleep(time.Millisecond * 20)
+	if n := len(src.peers); n != 5 {
+		t.Fatalf("Unexpected number of connections dialed: wanted 5, found %d", n)
+	}
+
+	// Other destinations are not pooled.
+	dial("example.org:443")
+	waitDials(t, src, 6)
+}
+
+func TestDialContext_poolTTL(t *testing.T) {
+	src := &pipe{peers: make(chan net.Conn, 16)}
+	d := dialer.New(&recorder{src: src})
+	d.PoolSize = 1
+	d.PoolTTL = time.Millisecond * 50
+	defer d.Close()
+
+	for i := 0; i < 2; i++ {
+		conn, err := d.DialContext(context.Background(), "tcp", "example.com:443")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		conn.Close()
+	}
+	waitDials(t, src, 3)
+
+	// The pooled connection is closed once expired.
+	for i := 0; i < 2; i++ {
+		<-src.peers
+	}
+	peer := <-src.peers
+	peer.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := peer.Read(make([]byte, 1)); err == nil || isTimeout(err) {
+		t.Fatalf("The pooled connection was not closed: %v", err)
+	}
+}
+
+func isTimeout(err error) bool {
+	nerr, ok := err.(net.Error)
+	return ok && nerr.Timeout()
+}
+
+// namedPipe is a pipe source with its own identifier.
+type namedPipe struct {
+	pipe
+	id string
+}
+
+func (s *namedPipe) ID() string {
+	return s.id
+}
+
+func TestDialer_Redial(t *testing.T) {
+	a := &namedPipe{pipe: pipe{peers: make(chan net.Conn, 16)}, id: "a"}
+	b := &namedPipe{pipe: pipe{peers: make(chan net.Conn, 16)}, id: "b"}
+	bal := &recorder{src: a}
+	d := dialer.New(bal)
+	d.PoolSize = 2
+	defer d.Close()
+
+	dial := func() {
+		conn, err := d.DialContext(context.Background(), "tcp", "example.com:443")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		conn.Close()
+	}
+	dial()
+	dial()
+	waitDials(t, &a.pipe, 4)
+
+	// Source a fails: the balancer selects b in its place.
+	bal.mux.Lock()
+	bal.src = b
+	bal.mux.Unlock()
+	if n := d.Redial("a"); n != 2 {
+		t.Fatalf("Unexpected connections pooled again: wanted 2, found %d", n)
+	}
+	waitDials(t, &b.pipe, 2)
+
+	// The next connection is taken from the pool of b.
+	dial()
+	waitDials(t, &b.pipe, 3)
+	time.Sleep(time.Millisecond * 20)
+	if n := len(b.peers); n != 3 {
+		t.Fatalf("Unexpected number of connections dialed: wanted 3, found %d", n)
+	}
+	if n := d.Redial("a"); n != 0 {
+		t.Fatalf("Connections pooled again twice: %d", n)
+	}
+}
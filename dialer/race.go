@@ -0,0 +1,187 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package dialer
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/sockopt"
+	"upspin.io/log"
+)
+
+// DefaultRaceDelay is the head start of the best source when racing,
+// as recommended by RFC 8305 for Happy Eyeballs.
+const DefaultRaceDelay = time.Millisecond * 250
+
+// Binder is implemented by the balancers that bind targets to
+// sources, e.g. the store when a StickyPolicy is applied. The
+// connections to sticky targets are never raced, as the source that
+// loses the race would be bound to the target.
+type Binder interface {
+	Sticky(target string) bool
+}
+
+func (d *Dialer) shouldRace(target string) bool {
+	if !d.Race {
+		return false
+	}
+	if b, ok := d.b.(Binder); ok && b.Sticky(target) {
+		return false
+	}
+	return true
+}
+
+// RemoteResolver is implemented by the sources that resolve the host
+// names dialed through them at their exit, e.g. the remote SOCKS5
+// proxies. When the client connected to an IP address but its host
+// name is known, e.g. because it was sniffed, they dial the host name
+// instead, so that it is resolved where the connection leaves from
+// rather than where the client is.
+type RemoteResolver interface {
+	ResolvesRemotely() bool
+}
+
+// dialAddress returns the address dialed through `src` to reach
+// `address`, whose target is `target`.
+func dialAddress(src core.Source, address, target string) string {
+	r, ok := src.(RemoteResolver)
+	if !ok || !r.ResolvesRemotely() || address == target {
+		return address
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) == nil {
+		return address
+	}
+	name, _, err := net.SplitHostPort(target)
+	if err != nil || net.ParseIP(name) != nil {
+		return address
+	}
+	return net.JoinHostPort(name, port)
+}
+
+// connect dials `address`, whose target is `target`, through `src`,
+// applying its options, which are returned.
+func (d *Dialer) connect(ctx context.Context, src core.Source, address, target string) (net.Conn, sockopt.Options, error) {
+	o := d.options(src.ID())
+	if m, ok := d.b.(FWMarker); ok {
+		if mark, ok := m.FWMark(target); ok {
+			o.Mark = mark
+		}
+	}
+	if !o.IsZero() {
+		ctx = sockopt.WithOptions(ctx, o)
+	}
+	if o.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.DialTimeout)
+		defer cancel()
+	}
+	conn, err := src.DialContext(ctx, "tcp4", dialAddress(src, address, target))
+	return conn, o, err
+}
+
+func logDialErr(address string, src core.Source, err error) {
+	// Log this error, otherwise it will be silently skipped.
+	log.Error.Printf("Unable to dial connection to %v using source %v. Error: %v", address, src.ID(), err)
+}
+
+type raceResult struct {
+	src  core.Source
+	conn net.Conn
+	o    sockopt.Options
+	err  error
+}
+
+// race dials `address`, whose target is `target`, through `srcs`, in
+// order, each one RaceDelay after the previous one or as soon as it
+// fails. The first connection established is returned, together with
+// its source and options, and the other attempts are canceled. The
+// sources that failed before are returned as well. If every source
+// fails, only the last error is returned.
+func (d *Dialer) race(ctx context.Context, address, target string, srcs ...core.Source) (core.Source, net.Conn, sockopt.Options, []core.Source, error) {
+	if len(srcs) == 1 {
+		conn, o, err := d.connect(ctx, srcs[0], address, target)
+		if err != nil {
+			logDialErr(address, srcs[0], err)
+			return nil, nil, o, srcs, err
+		}
+		return srcs[0], conn, o, nil, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c := make(chan raceResult, len(srcs))
+	start := func(src core.Source) {
+		go func() {
+			defer func() {
+				if v := recover(); v != nil {
+					err := d.Crashes.Handle(v, "dialer", map[string]string{"source": src.ID(), "address": address})
+					c <- raceResult{src: src, err: err}
+				}
+			}()
+			conn, o, err := d.connect(ctx, src, address, target)
+			c <- raceResult{src: src, conn: conn, o: o, err: err}
+		}()
+	}
+
+	t := time.NewTimer(d.RaceDelay)
+	defer t.Stop()
+
+	start(srcs[0])
+	next, pending := 1, 1
+	var failed []core.Source
+	var err error
+	for pending > 0 {
+		var delay <-chan time.Time
+		if next < len(srcs) {
+			delay = t.C
+		}
+		select {
+		case <-delay:
+			start(srcs[next])
+			next++
+			pending++
+			t.Reset(d.RaceDelay)
+		case r := <-c:
+			pending--
+			if r.err == nil {
+				// The losers are canceled, and closed if they
+				// connect anyway.
+				go func(pending int) {
+					for ; pending > 0; pending-- {
+						if r := <-c; r.conn != nil {
+							r.conn.Close()
+						}
+					}
+				}(pending)
+				return r.src, r.conn, r.o, failed, nil
+			}
+			logDialErr(address, r.src, r.err)
+			failed = append(failed, r.src)
+			err = r.err
+			if next < len(srcs) {
+				start(srcs[next])
+				next++
+				pending++
+			}
+		}
+	}
+	return nil, nil, sockopt.Options{}, failed, err
+}
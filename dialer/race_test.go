@@ -0,0 +1,117 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package dialer_test
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/dialer"
+)
+
+// slowMock takes a second to dial, counting the dials canceled.
+type slowMock struct {
+	mock
+	canceled int32
+}
+
+func (s *slowMock) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	select {
+	case <-time.After(time.Second):
+		return s.mock.DialContext(ctx, network, address)
+	case <-ctx.Done():
+		atomic.AddInt32(&s.canceled, 1)
+		return nil, ctx.Err()
+	}
+}
+
+type binder struct {
+	balancer
+	sticky bool
+}
+
+func (b *binder) Sticky(target string) bool {
+	return b.sticky
+}
+
+func TestDialContext_race(t *testing.T) {
+	slow := &slowMock{mock: mock{id: "s0"}}
+	b := &binder{}
+	b.Put(slow, &mock{id: "s1"})
+	d := dialer.New(b)
+	d.Race = true
+
+	// Whichever source is selected first, the fast one wins.
+	for i := 0; i < 2; i++ {
+		t0 := time.Now()
+		conn, err := d.DialContext(context.Background(), "tcp", "host:80")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		conn.Close()
+		if time.Since(t0) > time.Millisecond*500 {
+			t.Fatalf("The slow source won the race")
+		}
+	}
+	for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&slow.canceled) != 2; {
+		if time.Now().After(deadline) {
+			t.Fatalf("The losers were not canceled: %d", atomic.LoadInt32(&slow.canceled))
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Sticky targets are not raced.
+	b.sticky = true
+	var slowest time.Duration
+	for i := 0; i < 2; i++ {
+		t0 := time.Now()
+		conn, err := d.DialContext(context.Background(), "tcp", "host:80")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		conn.Close()
+		if d := time.Since(t0); d > slowest {
+			slowest = d
+		}
+	}
+	if slowest < time.Second {
+		t.Fatalf("Sticky connections were raced")
+	}
+}
+
+func TestDialContext_raceDelay(t *testing.T) {
+	b := &balancer{}
+	b.Put(&failingMock{mock{id: "s0"}}, &mock{id: "s1"})
+	d := dialer.New(b)
+	d.Race = true
+	d.RaceDelay = time.Minute
+
+	// The other source is dialed as soon as the best one fails.
+	for i := 0; i < 2; i++ {
+		t0 := time.Now()
+		conn, err := d.DialContext(context.Background(), "tcp", "host:80")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		conn.Close()
+		if time.Since(t0) > time.Second {
+			t.Fatalf("The other source waited for the race delay")
+		}
+	}
+}
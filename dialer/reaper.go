@@ -0,0 +1,76 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package dialer
+
+import (
+	"time"
+
+	"upspin.io/log"
+)
+
+// ReapInterval is the interval between the sweeps of the reaper,
+// which closes the connections that stay idle beyond their idle
+// timeout.
+var ReapInterval = time.Second
+
+// Reap closes the connections that did not transfer any data for
+// longer than `idle`, returning how many they were. If `idle` is
+// zero, the idle timeout of each connection is used instead, see
+// IdleTimeout.
+func (d *Dialer) Reap(idle time.Duration) int {
+	now := time.Now()
+	d.conns.Lock()
+	acc := make([]*conn, 0, len(d.conns.m))
+	for _, v := range d.conns.m {
+		limit := idle
+		if limit <= 0 {
+			limit = v.idle
+		}
+		if limit > 0 && now.Sub(v.lastActive()) >= limit {
+			acc = append(acc, v)
+		}
+	}
+	d.conns.Unlock()
+
+	for _, v := range acc {
+		log.Debug.Printf("Closing connection %d to %v through %v: idle since %v", v.info.ID, v.info.Target, v.info.Source, v.lastActive().Format(time.RFC3339))
+		v.cancel()
+	}
+	return len(acc)
+}
+
+// startReaper starts the reaper, if it is not running yet. It stops
+// when the dialer is closed. Has to be called holding the conns lock.
+func (d *Dialer) startReaper() {
+	if d.conns.reaping {
+		return
+	}
+	d.conns.reaping = true
+
+	ctx := d.conns.ctx
+	go func() {
+		t := time.NewTicker(ReapInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				d.Reap(0)
+			}
+		}
+	}()
+}
@@ -0,0 +1,139 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package dialer
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/booster-proj/booster/protocol"
+	"upspin.io/log"
+)
+
+// ResetRule selects the connections that are reset as soon as their
+// source fails, see Dialer.Reset: the ones to Port, if not 0, whose
+// protocol is Protocol, if not empty. The zero value selects every
+// connection.
+type ResetRule struct {
+	Port     int               `json:"port,omitempty"`
+	Protocol protocol.Protocol `json:"protocol,omitempty"`
+}
+
+// ParseResetRule parses a ResetRule: either "all", a port, e.g. "443",
+// a protocol, e.g. "ssh", or both, e.g. "tls:443".
+func ParseResetRule(s string) (ResetRule, error) {
+	var r ResetRule
+	if s == "all" {
+		return r, nil
+	}
+	name, port := s, ""
+	if _, err := strconv.Atoi(s); err == nil {
+		name, port = "", s
+	} else if h, p, err := net.SplitHostPort(s); err == nil {
+		name, port = h, p
+	}
+	if port != "" {
+		p, err := strconv.Atoi(port)
+		if err != nil || p <= 0 || p > 65535 {
+			return r, fmt.Errorf("invalid reset rule %q: invalid port %q", s, port)
+		}
+		r.Port = p
+	}
+	if name != "" {
+		p, err := protocol.Parse(name)
+		if err != nil {
+			return r, fmt.Errorf("invalid reset rule %q: %v", s, err)
+		}
+		r.Protocol = p
+	}
+	return r, nil
+}
+
+func (r ResetRule) String() string {
+	switch {
+	case r.Port == 0 && r.Protocol == "":
+		return "all"
+	case r.Port == 0:
+		return string(r.Protocol)
+	case r.Protocol == "":
+		return strconv.Itoa(r.Port)
+	default:
+		return string(r.Protocol) + ":" + strconv.Itoa(r.Port)
+	}
+}
+
+// Match reports whether the rule selects the connections to `target`
+// speaking `proto`.
+func (r ResetRule) Match(target string, proto protocol.Protocol) bool {
+	if r.Protocol != "" && r.Protocol != proto {
+		return false
+	}
+	if r.Port == 0 {
+		return true
+	}
+	_, port, err := net.SplitHostPort(target)
+	return err == nil && port == strconv.Itoa(r.Port)
+}
+
+// Reset aborts the connections dialed through source `id` that are
+// selected by ResetOnFailure, returning how many they were. It is meant
+// to be called when the source fails: rather than hanging until they
+// time out, the connections are reset, so that the proxies relaying
+// them close the ones of their clients at once, and the clients can
+// reconnect through a healthy source.
+func (d *Dialer) Reset(id string) int {
+	if len(d.ResetOnFailure) == 0 {
+		return 0
+	}
+	d.conns.Lock()
+	acc := make([]*conn, 0, len(d.conns.m))
+	for _, v := range d.conns.m {
+		if v.info.Source != id {
+			continue
+		}
+		for _, r := range d.ResetOnFailure {
+			if r.Match(v.info.Target, v.info.Protocol) {
+				acc = append(acc, v)
+				break
+			}
+		}
+	}
+	d.conns.Unlock()
+
+	for _, v := range acc {
+		log.Debug.Printf("Resetting connection %d to %v: source %v failed", v.info.ID, v.info.Target, id)
+		v.abort()
+	}
+	return len(acc)
+}
+
+// abort closes the connection, sending a RST to its peer instead of a
+// FIN when it is a TCP connection.
+func (c *conn) abort() {
+	var inner net.Conn = c
+	for {
+		w, ok := inner.(interface{ Unwrap() net.Conn })
+		if !ok {
+			break
+		}
+		inner = w.Unwrap()
+	}
+	if tc, ok := inner.(*net.TCPConn); ok {
+		tc.SetLinger(0)
+	}
+	c.cancel()
+}
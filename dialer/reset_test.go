@@ -0,0 +1,127 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package dialer_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/dialer"
+	"github.com/booster-proj/booster/protocol"
+)
+
+func TestParseResetRule(t *testing.T) {
+	tt := []struct {
+		in  string
+		out dialer.ResetRule
+		err bool
+	}{
+		{in: "all", out: dialer.ResetRule{}},
+		{in: "443", out: dialer.ResetRule{Port: 443}},
+		{in: "SSH", out: dialer.ResetRule{Protocol: protocol.SSH}},
+		{in: "tls:8443", out: dialer.ResetRule{Port: 8443, Protocol: protocol.TLS}},
+		{in: "70000", err: true},
+		{in: "gopher", err: true},
+		{in: "tls:https", err: true},
+	}
+	for _, v := range tt {
+		r, err := dialer.ParseResetRule(v.in)
+		if v.err {
+			if err == nil {
+				t.Fatalf("%s: expected error, found %+v", v.in, r)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", v.in, err)
+		}
+		if r != v.out {
+			t.Fatalf("%s: wanted %+v, found %+v", v.in, v.out, r)
+		}
+	}
+}
+
+// tcp is a source whose connections are dialed to a local listener,
+// whatever their address.
+type tcp struct {
+	ln net.Listener
+}
+
+func (s *tcp) ID() string {
+	return "tcp"
+}
+
+func (s *tcp) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", s.ln.Addr().String())
+}
+
+func (s *tcp) Close() error {
+	return nil
+}
+
+func TestDialer_Reset(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	d := dialer.New(&recorder{src: &tcp{ln: ln}})
+	d.ResetOnFailure = []dialer.ResetRule{{Port: 443}}
+
+	reset, err := d.DialContext(context.Background(), "tcp", "example.com:443")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer reset.Close()
+	peer, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	kept, err := d.DialContext(context.Background(), "tcp", "example.com:80")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer kept.Close()
+
+	if n := d.Reset("other"); n != 0 {
+		t.Fatalf("Connections of another source reset: %d", n)
+	}
+	read := readErr(reset)
+	if n := d.Reset("tcp"); n != 1 {
+		t.Fatalf("Unexpected connections reset: wanted 1, found %d", n)
+	}
+	waitErr(t, read)
+
+	// The peer receives a RST, not a FIN.
+	peer.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = peer.Read(make([]byte, 1))
+	if err == nil || !strings.Contains(err.Error(), "reset") {
+		t.Fatalf("Unexpected peer error: wanted connection reset, found %v", err)
+	}
+
+	for deadline := time.Now().Add(time.Second); len(d.Conns()) != 1; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Unexpected connections: %+v", d.Conns())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
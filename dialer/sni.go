@@ -0,0 +1,113 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package dialer
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var (
+	errNotTLS = errors.New("sni: not a TLS client hello")
+	errNoSNI  = errors.New("sni: no server name indication")
+)
+
+// serverName returns the server name indication contained in the TLS
+// ClientHello at the beginning of `b`.
+func serverName(b []byte) (string, error) {
+	// TLS record header: type, version, length.
+	if len(b) < 5 {
+		return "", errIncomplete
+	}
+	if b[0] != 0x16 || b[1] != 0x03 {
+		return "", errNotTLS
+	}
+	n := int(binary.BigEndian.Uint16(b[3:5]))
+	if len(b) < 5+n {
+		return "", errIncomplete
+	}
+	hs := b[5 : 5+n]
+
+	// Handshake header: type, length.
+	if len(hs) < 4 || hs[0] != 0x01 {
+		return "", errNotTLS
+	}
+	s := &reader{b: hs[4:]}
+	s.skip(2 + 32)       // version, random
+	s.skip(int(s.u8()))  // session id
+	s.skip(int(s.u16())) // cipher suites
+	s.skip(int(s.u8()))  // compression methods
+	exts := s.bytes(int(s.u16()))
+	if s.err != nil {
+		return "", errNoSNI
+	}
+
+	e := &reader{b: exts}
+	for len(e.b) > 0 && e.err == nil {
+		typ := e.u16()
+		data := e.bytes(int(e.u16()))
+		if typ != 0 { // server_name
+			continue
+		}
+		l := &reader{b: data}
+		list := &reader{b: l.bytes(int(l.u16()))}
+		for len(list.b) > 0 && list.err == nil {
+			nameType := list.u8()
+			name := list.bytes(int(list.u16()))
+			if nameType == 0 && list.err == nil && len(name) > 0 { // host_name
+				return string(name), nil
+			}
+		}
+	}
+	return "", errNoSNI
+}
+
+// reader reads big endian values from a buffer, recording the first
+// out of bounds access into err.
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil || n > len(r.b) {
+		r.err = errIncomplete
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *reader) skip(n int) {
+	r.bytes(n)
+}
+
+func (r *reader) u8() uint8 {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *reader) u16() uint16 {
+	b := r.bytes(2)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
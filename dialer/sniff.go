@@ -0,0 +1,324 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package dialer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/booster-proj/booster/protocol"
+	"upspin.io/log"
+)
+
+// DefaultSniffTimeout is the SniffTimeout used when the dialer does
+// not specify one.
+const DefaultSniffTimeout = time.Millisecond * 300
+
+// maxSniffed is the maximum amount of data buffered while waiting for
+// the client to send the hostname, i.e. the maximum size of a TLS
+// record.
+const maxSniffed = 16384 + 5
+
+// errIncomplete is returned when more data is needed to find the
+// hostname.
+var errIncomplete = errors.New("sniff: incomplete data")
+
+// sniffHost returns the hostname that the client is trying to reach,
+// reading it from the TLS ClientHello or the HTTP request at the
+// beginning of `b`.
+func sniffHost(b []byte) (string, error) {
+	if len(b) > 0 && b[0] == 0x16 {
+		return serverName(b)
+	}
+	return httpHost(b)
+}
+
+// shouldSniff returns true if the connection to `address` has to be
+// sniffed, i.e. if its host is an IP address and its port is one of
+// the dialer's SniffPorts.
+func (d *Dialer) shouldSniff(address string) bool {
+	if len(d.SniffPorts) == 0 {
+		return false
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) == nil {
+		return false
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return false
+	}
+	for _, v := range d.SniffPorts {
+		if v == p {
+			return true
+		}
+	}
+	return false
+}
+
+// sniffConn is a net.Conn that dials its upstream connection only
+// after the client wrote its TLS ClientHello or its HTTP request
+// headers, using the server name or the Host header contained in them
+// to select the source. If the client sends something else, the
+// connection is dialed as soon as that is clear, using its IP address
+// instead. When the dialer classifies the connections, the protocol
+// detected is stored in the context used to dial. In any case, the
+// data is forwarded untouched.
+type sniffConn struct {
+	ctx      context.Context
+	d        *Dialer
+	network  string
+	address  string
+	timeout  time.Duration
+	host     bool         // whether to sniff the hostname
+	classify bool         // whether to detect the protocol
+	proto    atomic.Value // protocol detected, if any
+
+	once  sync.Once
+	ready chan struct{}
+
+	mu       sync.Mutex
+	buf      []byte
+	conn     net.Conn
+	err      error
+	deadline struct {
+		read, write time.Time
+	}
+}
+
+func newSniffConn(ctx context.Context, d *Dialer, network, address string) *sniffConn {
+	timeout := d.SniffTimeout
+	if timeout <= 0 {
+		timeout = DefaultSniffTimeout
+	}
+	return &sniffConn{
+		// The connection is dialed after DialContext returned:
+		// the context must not cancel it.
+		ctx:      detachedContext{ctx},
+		d:        d,
+		network:  network,
+		address:  address,
+		timeout:  timeout,
+		host:     d.shouldSniff(address),
+		classify: d.Classify,
+		ready:    make(chan struct{}),
+	}
+}
+
+// connect dials the upstream connection using `target` to select the
+// source, flushing the data buffered in the meanwhile. Only the first
+// call has effect.
+func (c *sniffConn) connect(target string) {
+	c.once.Do(func() {
+		defer close(c.ready)
+
+		ctx := c.ctx
+		if c.classify {
+			// When the client did not write, or the dial was
+			// triggered by the buffer limit, the protocol is not
+			// known.
+			proto, _ := c.proto.Load().(protocol.Protocol)
+			if proto == "" {
+				proto = protocol.Unknown
+			}
+			ctx = protocol.NewContext(ctx, proto)
+		}
+		conn, err := c.d.dial(ctx, c.network, c.address, target)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if err == nil && len(c.buf) > 0 {
+			_, err = conn.Write(c.buf)
+		}
+		c.buf = nil
+		if err != nil {
+			if conn != nil {
+				conn.Close()
+			}
+			c.err = err
+			return
+		}
+		if !c.deadline.read.IsZero() {
+			conn.SetReadDeadline(c.deadline.read)
+		}
+		if !c.deadline.write.IsZero() {
+			conn.SetWriteDeadline(c.deadline.write)
+		}
+		c.conn = conn
+	})
+}
+
+// upstream waits for the upstream connection to be dialed.
+func (c *sniffConn) upstream() (net.Conn, error) {
+	<-c.ready
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn, c.err
+}
+
+func (c *sniffConn) Read(b []byte) (int, error) {
+	select {
+	case <-c.ready:
+	default:
+		t := time.NewTimer(c.timeout)
+		select {
+		case <-c.ready:
+		case <-t.C:
+			// The client is waiting for the server to talk first.
+			c.connect(c.address)
+		}
+		t.Stop()
+	}
+	conn, err := c.upstream()
+	if err != nil {
+		return 0, err
+	}
+	return conn.Read(b)
+}
+
+func (c *sniffConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	if c.conn != nil || c.err != nil {
+		conn, err := c.conn, c.err
+		c.mu.Unlock()
+		if err != nil {
+			return 0, err
+		}
+		return conn.Write(b)
+	}
+
+	c.buf = append(c.buf, b...)
+	target, ok := c.sniff()
+	if !ok && len(c.buf) < maxSniffed {
+		c.mu.Unlock()
+		return len(b), nil
+	}
+	c.mu.Unlock()
+
+	c.connect(target)
+	if _, err := c.upstream(); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// sniff inspects the data buffered, returning the target to use to
+// select the source, and recording the protocol detected, which is
+// stored in the context used to dial. It returns false if more data is needed. Has
+// to be called holding the lock.
+func (c *sniffConn) sniff() (string, bool) {
+	target, ok := c.address, true
+	if c.classify && c.proto.Load() == nil {
+		if p, done := protocol.Detect(c.buf); done {
+			c.proto.Store(p)
+			log.Debug.Printf("Detected protocol %v for connection to %v", p, c.address)
+		} else {
+			ok = false
+		}
+	}
+	if c.host {
+		name, err := sniffHost(c.buf)
+		switch err {
+		case nil:
+			_, port, _ := net.SplitHostPort(c.address)
+			target = net.JoinHostPort(name, port)
+			log.Debug.Printf("Sniffed hostname %v for connection to %v", name, c.address)
+		case errIncomplete:
+			ok = false
+		}
+	}
+	return target, ok
+}
+
+func (c *sniffConn) Close() error {
+	// Prevent the connection from being dialed later.
+	c.once.Do(func() {
+		c.mu.Lock()
+		c.err = net.ErrClosed
+		c.buf = nil
+		c.mu.Unlock()
+		close(c.ready)
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+func (c *sniffConn) LocalAddr() net.Addr {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		return c.conn.LocalAddr()
+	}
+	return &net.TCPAddr{}
+}
+
+func (c *sniffConn) RemoteAddr() net.Addr {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		return c.conn.RemoteAddr()
+	}
+	host, port, _ := net.SplitHostPort(c.address)
+	p, _ := strconv.Atoi(port)
+	return &net.TCPAddr{IP: net.ParseIP(host), Port: p}
+}
+
+func (c *sniffConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+func (c *sniffConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline.read = t
+	if c.conn != nil {
+		return c.conn.SetReadDeadline(t)
+	}
+	return nil
+}
+
+func (c *sniffConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline.write = t
+	if c.conn != nil {
+		return c.conn.SetWriteDeadline(t)
+	}
+	return nil
+}
+
+// detachedContext carries the values of its parent, but is never
+// canceled.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
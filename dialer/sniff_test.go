@@ -0,0 +1,312 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package dialer_test
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/dialer"
+	"github.com/booster-proj/booster/protocol"
+)
+
+// pipe is a source whose connections are pipes: the other end of
+// each one is sent to peers.
+type pipe struct {
+	peers chan net.Conn
+}
+
+func (s *pipe) ID() string {
+	return "pipe"
+}
+
+func (s *pipe) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	c1, c2 := net.Pipe()
+	s.peers <- c2
+	return c1, nil
+}
+
+func (s *pipe) Close() error {
+	return nil
+}
+
+// recorder is a balancer that records the targets requested.
+type recorder struct {
+	src core.Source
+
+	mux     sync.Mutex
+	targets []string
+}
+
+func (b *recorder) Get(ctx context.Context, target string, blacklisted ...core.Source) (core.Source, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.targets = append(b.targets, target)
+	return b.src, nil
+}
+
+func (b *recorder) Len() int {
+	return 1
+}
+
+func (b *recorder) Targets() []string {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return append([]string{}, b.targets...)
+}
+
+func TestDialContext_sniff(t *testing.T) {
+	src := &pipe{peers: make(chan net.Conn, 1)}
+	b := &recorder{src: src}
+	d := dialer.New(b)
+	d.SniffPorts = []int{443}
+
+	conn, err := d.DialContext(context.Background(), "tcp", "10.0.0.1:443")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+	if len(b.Targets()) != 0 {
+		t.Fatalf("Connection dialed before the client hello was sent")
+	}
+
+	go tls.Client(conn, &tls.Config{ServerName: "example.com"}).Handshake()
+
+	var peer net.Conn
+	select {
+	case peer = <-src.peers:
+	case <-time.After(time.Second):
+		t.Fatalf("Connection was not dialed")
+	}
+	defer peer.Close()
+
+	// The buffered client hello is forwarded upstream.
+	buf := make([]byte, 1)
+	if _, err := peer.Read(buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if buf[0] != 0x16 {
+		t.Fatalf("Unexpected record type: %#x", buf[0])
+	}
+
+	if targets := b.Targets(); len(targets) != 1 || targets[0] != "example.com:443" {
+		t.Fatalf("Unexpected targets: %v", targets)
+	}
+}
+
+func TestDialContext_sniffTimeout(t *testing.T) {
+	src := &pipe{peers: make(chan net.Conn, 1)}
+	b := &recorder{src: src}
+	d := dialer.New(b)
+	d.SniffPorts = []int{443}
+	d.SniffTimeout = time.Millisecond * 10
+
+	conn, err := d.DialContext(context.Background(), "tcp", "10.0.0.1:443")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	// The server talks first.
+	go func() {
+		peer := <-src.peers
+		peer.Write([]byte("hello"))
+		peer.Close()
+	}()
+
+	buf := make([]byte, 5)
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if targets := b.Targets(); len(targets) != 1 || targets[0] != "10.0.0.1:443" {
+		t.Fatalf("Unexpected targets: %v", targets)
+	}
+}
+
+// remotePipe is a pipe source that resolves the host names remotely,
+// recording the addresses dialed.
+type remotePipe struct {
+	pipe
+
+	mux       sync.Mutex
+	addresses []string
+}
+
+func (s *remotePipe) ResolvesRemotely() bool {
+	return true
+}
+
+func (s *remotePipe) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	s.mux.Lock()
+	s.addresses = append(s.addresses, address)
+	s.mux.Unlock()
+	return s.pipe.DialContext(ctx, network, address)
+}
+
+func (s *remotePipe) Addresses() []string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return append([]string{}, s.addresses...)
+}
+
+func TestDialContext_sniffRemote(t *testing.T) {
+	src := &remotePipe{pipe: pipe{peers: make(chan net.Conn, 1)}}
+	d := dialer.New(&recorder{src: src})
+	d.SniffPorts = []int{443}
+
+	conn, err := d.DialContext(context.Background(), "tcp", "10.0.0.1:443")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	go tls.Client(conn, &tls.Config{ServerName: "example.com"}).Handshake()
+
+	select {
+	case peer := <-src.peers:
+		peer.Close()
+	case <-time.After(time.Second):
+		t.Fatalf("Connection was not dialed")
+	}
+
+	// The host name sniffed is resolved by the source.
+	if addresses := src.Addresses(); len(addresses) != 1 || addresses[0] != "example.com:443" {
+		t.Fatalf("Unexpected addresses dialed: %v", addresses)
+	}
+}
+
+func TestDialContext_noSniff(t *testing.T) {
+	src := &pipe{peers: make(chan net.Conn, 2)}
+	b := &recorder{src: src}
+	d := dialer.New(b)
+	d.SniffPorts = []int{443}
+
+	for _, address := range []string{"10.0.0.1:80", "example.com:443"} {
+		conn, err := d.DialContext(context.Background(), "tcp", address)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		conn.Close()
+	}
+	if targets := b.Targets(); len(targets) != 2 {
+		t.Fatalf("Connections were not dialed immediately: %v", targets)
+	}
+}
+
+func TestDialContext_sniffHTTP(t *testing.T) {
+	tt := []struct {
+		writes []string
+		target string
+	}{
+		{[]string{"GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"}, "example.com:80"},
+		{[]string{"GE", "T / HTTP/1.1\r\nAccept: */*\r\n", "host: example.com:8080\r\n\r\n"}, "example.com:80"},
+		{[]string{"SSH-2.0-OpenSSH_7.9\r\n"}, "10.0.0.1:80"},
+		{[]string{"GET / HTTP/1.1\r\n\r\n"}, "10.0.0.1:80"},
+	}
+
+	for i, v := range tt {
+		src := &pipe{peers: make(chan net.Conn, 1)}
+		b := &recorder{src: src}
+		d := dialer.New(b)
+		d.SniffPorts = []int{80}
+
+		conn, err := d.DialContext(context.Background(), "tcp", "10.0.0.1:80")
+		if err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+
+		data := strings.Join(v.writes, "")
+		go func() {
+			for _, w := range v.writes {
+				if _, err := conn.Write([]byte(w)); err != nil {
+					return
+				}
+			}
+		}()
+
+		var peer net.Conn
+		select {
+		case peer = <-src.peers:
+		case <-time.After(time.Second):
+			t.Fatalf("%d: Connection was not dialed", i)
+		}
+
+		// The stream is not altered.
+		buf := make([]byte, len(data))
+		if _, err := io.ReadFull(peer, buf); err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		if string(buf) != data {
+			t.Fatalf("%d: Unexpected data: wanted %q, found %q", i, data, buf)
+		}
+		if targets := b.Targets(); len(targets) != 1 || targets[0] != v.target {
+			t.Fatalf("%d: Unexpected targets: wanted %v, found %v", i, v.target, targets)
+		}
+		peer.Close()
+		conn.Close()
+	}
+}
+
+func TestDialContext_classify(t *testing.T) {
+	tt := []struct {
+		write string
+		proto protocol.Protocol
+	}{
+		{"SSH-2.0-OpenSSH_7.9\r\n", protocol.SSH},
+		{"GET / HTTP/1.1\r\nHost: example.com\r\n\r\n", protocol.HTTP},
+		{"", protocol.Unknown},
+	}
+
+	for i, v := range tt {
+		src := &pipe{peers: make(chan net.Conn, 1)}
+		d := dialer.New(&recorder{src: src})
+		d.Classify = true
+		d.SniffTimeout = time.Millisecond * 10
+
+		conn, err := d.DialContext(context.Background(), "tcp", "10.0.0.1:22")
+		if err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		if v.write != "" {
+			go conn.Write([]byte(v.write))
+		}
+		// If the client does not write, the server talks first.
+		peers := make(chan net.Conn, 1)
+		go func() {
+			peer := <-src.peers
+			go io.Copy(ioutil.Discard, peer)
+			peer.Write([]byte("x"))
+			peers <- peer
+		}()
+		if _, err := conn.Read(make([]byte, 1)); err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		peer := <-peers
+		if conns := d.Conns(); len(conns) != 1 || conns[0].Protocol != v.proto {
+			t.Fatalf("%d: Unexpected connections: wanted protocol %v, found %+v", i, v.proto, conns)
+		}
+		peer.Close()
+		conn.Close()
+	}
+}
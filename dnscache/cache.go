@@ -0,0 +1,434 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package dnscache provides an in-process cache of DNS responses,
+// shared by the resolvers of the connections dialed by booster and
+// of its store.
+//
+// The cache sits between the pure Go resolver and the DNS servers:
+// the resolvers returned by Cache.Resolver answer the queries from
+// the cache when possible, and forward them to the servers otherwise,
+// caching the responses for as long as their TTL allows.
+package dnscache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Default bounds of the TTLs of the responses cached, and default
+// number of responses cached.
+const (
+	DefaultMinTTL = 5 * time.Second
+	DefaultMaxTTL = time.Hour
+	DefaultSize   = 4096
+)
+
+// Operations on the cache, reported as the "op" label of the metrics.
+const (
+	OpHit   = "hit"
+	OpMiss  = "miss"
+	OpEvict = "evict"
+)
+
+// MetricsExporter collects the operations performed on the cache.
+type MetricsExporter interface {
+	IncDNSCacheOp(labels map[string]string)
+}
+
+// DialFunc dials the connections to the DNS servers.
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// Cache is a cache of DNS responses. The zero value is ready to use.
+type Cache struct {
+	// MinTTL and MaxTTL bound the time the responses are cached for,
+	// which is otherwise the lowest TTL of their records. If 0,
+	// DefaultMinTTL and DefaultMaxTTL are used.
+	MinTTL time.Duration
+	MaxTTL time.Duration
+	// Size is the maximum number of responses cached. If 0,
+	// DefaultSize is used.
+	Size int
+	// If MetricsExporter is not nil, it receives the operations
+	// performed on the cache.
+	MetricsExporter MetricsExporter
+
+	mux     sync.Mutex
+	entries map[string]entry
+
+	hits, misses, evictions uint64
+}
+
+type entry struct {
+	msg     []byte
+	expires time.Time
+}
+
+// Stats describes the usage of a Cache.
+type Stats struct {
+	Entries   int    `json:"entries"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+}
+
+// Stats returns the usage statistics of the cache.
+func (c *Cache) Stats() Stats {
+	c.mux.Lock()
+	n := len(c.entries)
+	c.mux.Unlock()
+
+	return Stats{
+		Entries:   n,
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Evictions: atomic.LoadUint64(&c.evictions),
+	}
+}
+
+// Flush removes every response cached, returning how many they were.
+func (c *Cache) Flush() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	n := len(c.entries)
+	c.entries = nil
+	return n
+}
+
+// Resolver returns a resolver that answers the queries from the cache,
+// forwarding them through `dial`, or a net.Dialer if nil, when the
+// response is not cached. The responses are cached under `scope`, e.g.
+// the source whose DNS servers are queried, so that the resolvers of
+// different scopes do not share them.
+func (c *Cache) Resolver(scope string, dial DialFunc) *net.Resolver {
+	if dial == nil {
+		var d net.Dialer
+		dial = d.DialContext
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return &conn{cache: c, scope: scope, ctx: ctx, network: network, address: address, dial: dial}, nil
+		},
+	}
+}
+
+func (c *Cache) count(op string, n *uint64) {
+	atomic.AddUint64(n, 1)
+	if exp := c.MetricsExporter; exp != nil {
+		exp.IncDNSCacheOp(map[string]string{"op": op})
+	}
+}
+
+// get returns the response cached for `key` at `now`, if any.
+func (c *Cache) get(key string, now time.Time) ([]byte, bool) {
+	c.mux.Lock()
+	e, ok := c.entries[key]
+	if ok && !now.Before(e.expires) {
+		delete(c.entries, key)
+		ok = false
+	}
+	c.mux.Unlock()
+
+	if !ok {
+		c.count(OpMiss, &c.misses)
+		return nil, false
+	}
+	c.count(OpHit, &c.hits)
+	return e.msg, true
+}
+
+// put caches `msg`, the response for `key`, for `ttl`, clamped to the
+// bounds of the cache. When the cache is full, the expired responses
+// are removed first, and then the one expiring first.
+func (c *Cache) put(key string, msg []byte, ttl time.Duration, now time.Time) {
+	min, max := c.MinTTL, c.MaxTTL
+	if min <= 0 {
+		min = DefaultMinTTL
+	}
+	if max <= 0 {
+		max = DefaultMaxTTL
+	}
+	if ttl < min {
+		ttl = min
+	}
+	if ttl > max {
+		ttl = max
+	}
+	size := c.Size
+	if size <= 0 {
+		size = DefaultSize
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]entry)
+	}
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= size {
+		var first string
+		for k, v := range c.entries {
+			if !now.Before(v.expires) {
+				delete(c.entries, k)
+				continue
+			}
+			if first == "" || v.expires.Before(c.entries[first].expires) {
+				first = k
+			}
+		}
+		if len(c.entries) >= size {
+			delete(c.entries, first)
+			c.count(OpEvict, &c.evictions)
+		}
+	}
+	c.entries[key] = entry{msg: msg, expires: now.Add(ttl)}
+}
+
+// key returns the key of the query `msg` in `scope`, and reports
+// whether it can be cached, i.e. it contains one question.
+func key(scope string, msg []byte) (string, bool) {
+	var p dnsmessage.Parser
+	if _, err := p.Start(msg); err != nil {
+		return "", false
+	}
+	q, err := p.Question()
+	if err != nil {
+		return "", false
+	}
+	if _, err := p.Question(); err != dnsmessage.ErrSectionDone {
+		return "", false
+	}
+	return scope + "\x00" + strings.ToLower(q.Name.String()) + "\x00" + q.Type.String() + "\x00" + q.Class.String(), true
+}
+
+// ttl returns the time the response `msg` can be cached for: the
+// lowest TTL of its answers or, for the negative responses, the one
+// of the SOA record of its authority section, as in RFC 2308. Reports
+// false if it must not be cached, e.g. because it is truncated or it
+// reports a server failure.
+func ttl(msg []byte) (time.Duration, bool) {
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil || h.Truncated {
+		return 0, false
+	}
+	if h.RCode != dnsmessage.RCodeSuccess && h.RCode != dnsmessage.RCodeNameError {
+		return 0, false
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return 0, false
+	}
+
+	var min uint32
+	var found bool
+	for {
+		rh, err := p.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return 0, false
+		}
+		if !found || rh.TTL < min {
+			min, found = rh.TTL, true
+		}
+		if err := p.SkipAnswer(); err != nil {
+			return 0, false
+		}
+	}
+	if found {
+		return time.Duration(min) * time.Second, true
+	}
+	for {
+		rh, err := p.AuthorityHeader()
+		if err != nil {
+			// No SOA record: let the bounds of the cache decide.
+			return 0, true
+		}
+		if rh.Type != dnsmessage.TypeSOA {
+			if err := p.SkipAuthority(); err != nil {
+				return 0, true
+			}
+			continue
+		}
+		soa, err := p.SOAResource()
+		if err != nil {
+			return 0, true
+		}
+		min = rh.TTL
+		if soa.MinTTL < min {
+			min = soa.MinTTL
+		}
+		return time.Duration(min) * time.Second, true
+	}
+}
+
+// conn is the connection to a DNS server used by the resolvers of a
+// Cache. It implements net.PacketConn, so that the resolver writes
+// each query, and reads each response, as a whole message, also when
+// the query is sent over TCP.
+type conn struct {
+	cache            *Cache
+	scope            string
+	ctx              context.Context
+	network, address string
+	dial             DialFunc
+
+	mux      sync.Mutex
+	deadline time.Time
+	resp     []byte
+}
+
+var errNoResponse = errors.New("dnscache: no response pending")
+
+func (c *conn) Write(b []byte) (int, error) {
+	now := time.Now()
+	k, cacheable := key(c.scope, b)
+	if cacheable {
+		if msg, ok := c.cache.get(k, now); ok {
+			resp := append([]byte(nil), msg...)
+			copy(resp[:2], b[:2]) // the ID of the query
+			c.setResponse(resp)
+			return len(b), nil
+		}
+	}
+
+	resp, err := c.exchange(b)
+	if err != nil {
+		return 0, err
+	}
+	if d, ok := ttl(resp); ok && cacheable {
+		c.cache.put(k, append([]byte(nil), resp...), d, now)
+	}
+	c.setResponse(resp)
+	return len(b), nil
+}
+
+// exchange sends the query `b` to the server, returning its response.
+func (c *conn) exchange(b []byte) ([]byte, error) {
+	conn, err := c.dial(c.ctx, c.network, c.address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	c.mux.Lock()
+	deadline := c.deadline
+	c.mux.Unlock()
+	if !deadline.IsZero() {
+		conn.SetDeadline(deadline)
+	}
+
+	if strings.HasPrefix(c.network, "udp") {
+		if _, err := conn.Write(b); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, 65535)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+
+	// Over TCP each message is prefixed by its length.
+	msg := make([]byte, 2+len(b))
+	binary.BigEndian.PutUint16(msg, uint16(len(b)))
+	copy(msg[2:], b)
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+	var l [2]byte
+	if _, err := io.ReadFull(conn, l[:]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(l[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *conn) setResponse(resp []byte) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.resp = resp
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.resp == nil {
+		return 0, errNoResponse
+	}
+	n := copy(b, c.resp)
+	c.resp = nil
+	return n, nil
+}
+
+func (c *conn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, err := c.Read(b)
+	return n, c.RemoteAddr(), err
+}
+
+func (c *conn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return c.Write(b)
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) LocalAddr() net.Addr {
+	return addr{c.network, ""}
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	return addr{c.network, c.address}
+}
+
+func (c *conn) SetDeadline(t time.Time) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.deadline = t
+	return nil
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	return c.SetDeadline(t)
+}
+
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	return c.SetDeadline(t)
+}
+
+type addr struct {
+	network, address string
+}
+
+func (a addr) Network() string { return a.network }
+func (a addr) String() string  { return a.address }
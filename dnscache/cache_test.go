@@ -0,0 +1,153 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package dnscache_test
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/dnscache"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// server is a DNS server resolving every name to 10.0.0.1, with a TTL
+// of 0, and failing the ones in fail, set when it is created.
+type server struct {
+	conn    net.PacketConn
+	queries int32
+	fail    map[string]bool
+}
+
+func newServer(t *testing.T, fail ...string) *server {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{conn: conn, fail: make(map[string]bool)}
+	for _, v := range fail {
+		s.fail[v] = true
+	}
+	go s.serve()
+	return s
+}
+
+func (s *server) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var p dnsmessage.Parser
+		h, err := p.Start(buf[:n])
+		if err != nil {
+			continue
+		}
+		q, err := p.Question()
+		if err != nil {
+			continue
+		}
+		atomic.AddInt32(&s.queries, 1)
+
+		rh := dnsmessage.Header{ID: h.ID, Response: true, RecursionAvailable: true}
+		if s.fail[q.Name.String()] {
+			rh.RCode = dnsmessage.RCodeServerFailure
+		}
+		b := dnsmessage.NewBuilder(nil, rh)
+		b.StartQuestions()
+		b.Question(q)
+		b.StartAnswers()
+		if q.Type == dnsmessage.TypeA && rh.RCode == dnsmessage.RCodeSuccess {
+			b.AResource(dnsmessage.ResourceHeader{Name: q.Name, Class: q.Class}, dnsmessage.AResource{A: [4]byte{10, 0, 0, 1}})
+		}
+		msg, err := b.Finish()
+		if err != nil {
+			continue
+		}
+		s.conn.WriteTo(msg, addr)
+	}
+}
+
+func (s *server) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, "udp", s.conn.LocalAddr().String())
+}
+
+func TestCache(t *testing.T) {
+	s := newServer(t, "fail.test.")
+	defer s.conn.Close()
+
+	c := &dnscache.Cache{MinTTL: time.Hour, Size: 2}
+	r := c.Resolver("src", s.dial)
+	ctx := context.Background()
+
+	lookup := func(host string) {
+		t.Helper()
+		addrs, err := r.LookupHost(ctx, host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != 1 || addrs[0] != "10.0.0.1" {
+			t.Fatalf("Unexpected addresses of %s: %v", host, addrs)
+		}
+	}
+
+	// The answers, A and AAAA, are cached for MinTTL even if their TTL
+	// is 0.
+	lookup("example.test")
+	n := atomic.LoadInt32(&s.queries)
+	lookup("example.test")
+	lookup("EXAMPLE.test")
+	if m := atomic.LoadInt32(&s.queries); m != n {
+		t.Fatalf("Unexpected queries: wanted %d, found %d", n, m)
+	}
+	if stats := c.Stats(); stats.Entries != 2 || stats.Hits == 0 {
+		t.Fatalf("Unexpected stats: %+v", stats)
+	}
+
+	// The failures are not cached.
+	r.LookupHost(ctx, "fail.test")
+	n = atomic.LoadInt32(&s.queries)
+	r.LookupHost(ctx, "fail.test")
+	if m := atomic.LoadInt32(&s.queries); m == n {
+		t.Fatalf("Server failure answered from the cache")
+	}
+
+	// The scopes do not share the answers.
+	n = atomic.LoadInt32(&s.queries)
+	if _, err := c.Resolver("other", s.dial).LookupHost(ctx, "example.test"); err != nil {
+		t.Fatal(err)
+	}
+	if m := atomic.LoadInt32(&s.queries); m == n {
+		t.Fatalf("Answer shared across scopes")
+	}
+
+	// The cache is full: the new answers evicted the old ones.
+	stats := c.Stats()
+	if stats.Entries != 2 || stats.Evictions == 0 {
+		t.Fatalf("Unexpected stats: %+v", stats)
+	}
+
+	if n := c.Flush(); n != 2 {
+		t.Fatalf("Unexpected answers flushed: wanted 2, found %d", n)
+	}
+	if stats := c.Stats(); stats.Entries != 0 {
+		t.Fatalf("Unexpected entries after flush: %d", stats.Entries)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package events provides a simple publish/subscribe bus used by booster's
+// components to notify about things that happened, e.g. a source that went
+// down or a policy that conflicts with another one.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event topics published by booster's components.
+const (
+	TopicPolicyConflict = "policy.conflict"
+	TopicSourceUp       = "source.up"
+	TopicSourceDown     = "source.down"
+	TopicFailover       = "source.failover"
+	TopicSwitchover     = "source.switchover"
+	TopicPublicIP       = "source.public_ip"
+	TopicConnOpen       = "conn.open"
+	TopicConnClose      = "conn.close"
+	TopicWatchdog       = "watchdog.threshold"
+	TopicCrash          = "crash.report"
+)
+
+// Event describes something that happened inside booster.
+type Event struct {
+	Topic   string      `json:"topic"`
+	Time    time.Time   `json:"time"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// HistorySize is the default number of events kept by a Bus.
+var HistorySize = 100
+
+// Bus delivers the events published to its subscribers, and keeps
+// the last HistorySize events in memory.
+// The zero value of Bus is ready to use and safe to be used by multiple
+// goroutines. A nil *Bus silently drops the events published.
+type Bus struct {
+	mux    sync.Mutex
+	subs   map[int]chan Event
+	nextID int
+	recent []Event
+}
+
+// Publish delivers `e` to each subscriber. Subscribers that are not
+// able to keep up with the events published lose them, i.e. Publish
+// never blocks. If `e.Time` is zero, it is set to the current time.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.recent = append(b.recent, e)
+	if n := len(b.recent) - HistorySize; n > 0 {
+		b.recent = append(b.recent[:0], b.recent[n:]...)
+	}
+
+	for _, c := range b.subs {
+		select {
+		case c <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel that receives the events published
+// from now on, with a buffer of size `n`. Call the returned function
+// to stop receiving events; the channel is closed afterwards.
+func (b *Bus) Subscribe(n int) (<-chan Event, func()) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if b.subs == nil {
+		b.subs = make(map[int]chan Event)
+	}
+	id := b.nextID
+	b.nextID++
+	c := make(chan Event, n)
+	b.subs[id] = c
+
+	var once sync.Once
+	return c, func() {
+		once.Do(func() {
+			b.mux.Lock()
+			defer b.mux.Unlock()
+
+			delete(b.subs, id)
+			close(c)
+		})
+	}
+}
+
+// Recent returns a copy of the last events published, oldest first.
+func (b *Bus) Recent() []Event {
+	if b == nil {
+		return []Event{}
+	}
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	acc := make([]Event, len(b.recent))
+	copy(acc, b.recent)
+	return acc
+}
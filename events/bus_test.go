@@ -0,0 +1,78 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package events_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/events"
+)
+
+func TestPublish(t *testing.T) {
+	b := new(events.Bus)
+	c, cancel := b.Subscribe(1)
+	defer cancel()
+
+	b.Publish(events.Event{Topic: "foo"})
+
+	select {
+	case e := <-c:
+		if e.Topic != "foo" {
+			t.Fatalf("Unexpected topic: wanted foo, found %s", e.Topic)
+		}
+		if e.Time.IsZero() {
+			t.Fatal("Event time was not set")
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("Event was not delivered")
+	}
+
+	// The subscriber buffer is full: publish must not block.
+	b.Publish(events.Event{Topic: "bar"})
+	b.Publish(events.Event{Topic: "baz"})
+
+	cancel()
+	for range c {
+		// drain
+	}
+}
+
+func TestRecent(t *testing.T) {
+	n := events.HistorySize
+	events.HistorySize = 2
+	defer func() { events.HistorySize = n }()
+
+	b := new(events.Bus)
+	for i := 0; i < 3; i++ {
+		b.Publish(events.Event{Topic: fmt.Sprintf("%d", i)})
+	}
+
+	r := b.Recent()
+	if len(r) != 2 {
+		t.Fatalf("Unexpected recent events: wanted 2, found %d", len(r))
+	}
+	if r[0].Topic != "1" || r[1].Topic != "2" {
+		t.Fatalf("Unexpected recent events: %+v", r)
+	}
+
+	var nilBus *events.Bus
+	nilBus.Publish(events.Event{})
+	if len(nilBus.Recent()) != 0 {
+		t.Fatal("Nil bus should not record events")
+	}
+}
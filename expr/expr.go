@@ -0,0 +1,480 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package expr implements the small expression language used by the
+// expression policies. An expression combines literals (strings,
+// numbers, booleans and lists) and variables using:
+//
+//	||  &&  !                 boolean operators
+//	==  !=  <  <=  >  >=      comparisons, between numbers or strings
+//	in                        list membership, e.g. port in [80, 443]
+//	matches                   glob matching, e.g. host matches "*.example.com"
+//	cidr(ip, "10.0.0.0/8")    network membership
+//
+// Expressions are type checked when they are compiled, against the
+// variables that are going to be available at evaluation time.
+package expr
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strconv"
+)
+
+// Type is the type of a value.
+type Type int
+
+// Value types.
+const (
+	Bool Type = iota + 1
+	Number
+	String
+	NumberList
+	StringList
+)
+
+func (t Type) String() string {
+	switch t {
+	case Bool:
+		return "bool"
+	case Number:
+		return "number"
+	case String:
+		return "string"
+	case NumberList:
+		return "list of numbers"
+	case StringList:
+		return "list of strings"
+	default:
+		return "unknown"
+	}
+}
+
+// Env returns the value of variable `name`: a string, a number or a
+// bool, depending on its type. It is called only when the variable is
+// needed.
+type Env func(name string) interface{}
+
+// Program is a compiled expression.
+type Program struct {
+	src  string
+	eval func(Env) interface{}
+}
+
+// Compile parses the boolean expression `src`, in which only the
+// variables in `vars` can be used.
+func Compile(src string, vars map[string]Type) (*Program, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks, vars: vars}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, errorf(t.pos, "unexpected %q", t.text)
+	}
+	if n.typ != Bool {
+		return nil, errorf(0, "expression is a %v, not a bool", n.typ)
+	}
+	return &Program{src: src, eval: n.eval}, nil
+}
+
+// Eval evaluates the program using the variables provided by `env`.
+func (p *Program) Eval(env Env) bool {
+	return p.eval(env).(bool)
+}
+
+func (p *Program) String() string {
+	return p.src
+}
+
+// Error is returned when an expression cannot be compiled.
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("expr: %s (at position %d)", e.Msg, e.Pos)
+}
+
+func errorf(pos int, format string, args ...interface{}) error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// node is a compiled subexpression.
+type node struct {
+	typ  Type
+	eval func(Env) interface{}
+	// lit is the value of the node if it is a literal.
+	lit interface{}
+}
+
+func literal(typ Type, v interface{}) *node {
+	return &node{typ: typ, lit: v, eval: func(Env) interface{} { return v }}
+}
+
+type parser struct {
+	toks []token
+	i    int
+	vars map[string]Type
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// accept consumes the next token if it is the operator or keyword `s`.
+func (p *parser) accept(s string) bool {
+	t := p.peek()
+	if (t.kind == tokOp || t.kind == tokIdent) && t.text == s {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(s string) error {
+	if !p.accept(s) {
+		t := p.peek()
+		return errorf(t.pos, "expected %q, found %q", s, t.text)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (*node, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		pos := p.peek().pos
+		if !p.accept("||") {
+			return l, nil
+		}
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if l.typ != Bool || r.typ != Bool {
+			return nil, errorf(pos, "|| between %v and %v", l.typ, r.typ)
+		}
+		le, re := l.eval, r.eval
+		l = &node{typ: Bool, eval: func(env Env) interface{} {
+			return le(env).(bool) || re(env).(bool)
+		}}
+	}
+}
+
+func (p *parser) parseAnd() (*node, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		pos := p.peek().pos
+		if !p.accept("&&") {
+			return l, nil
+		}
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if l.typ != Bool || r.typ != Bool {
+			return nil, errorf(pos, "&& between %v and %v", l.typ, r.typ)
+		}
+		le, re := l.eval, r.eval
+		l = &node{typ: Bool, eval: func(env Env) interface{} {
+			return le(env).(bool) && re(env).(bool)
+		}}
+	}
+}
+
+func (p *parser) parseNot() (*node, error) {
+	pos := p.peek().pos
+	if !p.accept("!") {
+		return p.parseCmp()
+	}
+	n, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	if n.typ != Bool {
+		return nil, errorf(pos, "! applied to %v", n.typ)
+	}
+	e := n.eval
+	return &node{typ: Bool, eval: func(env Env) interface{} {
+		return !e(env).(bool)
+	}}, nil
+}
+
+func (p *parser) parseCmp() (*node, error) {
+	l, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.kind != tokOp && t.kind != tokIdent {
+		return l, nil
+	}
+	switch t.text {
+	case "==", "!=", "<", "<=", ">", ">=", "in", "matches":
+		p.next()
+	default:
+		return l, nil
+	}
+	r, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	le, re := l.eval, r.eval
+	switch t.text {
+	case "in":
+		if !(l.typ == String && r.typ == StringList) && !(l.typ == Number && r.typ == NumberList) {
+			return nil, errorf(t.pos, "%v in %v", l.typ, r.typ)
+		}
+		return &node{typ: Bool, eval: func(env Env) interface{} {
+			v := le(env)
+			for _, w := range re(env).([]interface{}) {
+				if v == w {
+					return true
+				}
+			}
+			return false
+		}}, nil
+	case "matches":
+		pattern, ok := r.lit.(string)
+		if l.typ != String || !ok {
+			return nil, errorf(t.pos, "matches requires a string and a string literal")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errorf(t.pos, "invalid pattern %q", pattern)
+		}
+		return &node{typ: Bool, eval: func(env Env) interface{} {
+			ok, _ := path.Match(pattern, le(env).(string))
+			return ok
+		}}, nil
+	}
+
+	if l.typ != r.typ || (l.typ != Number && l.typ != String && l.typ != Bool) {
+		return nil, errorf(t.pos, "%s between %v and %v", t.text, l.typ, r.typ)
+	}
+	if l.typ == Bool && t.text != "==" && t.text != "!=" {
+		return nil, errorf(t.pos, "%s between bools", t.text)
+	}
+	op := t.text
+	return &node{typ: Bool, eval: func(env Env) interface{} {
+		return compare(op, le(env), re(env))
+	}}, nil
+}
+
+func compare(op string, a, b interface{}) bool {
+	switch op {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	}
+	var c int
+	switch a := a.(type) {
+	case float64:
+		b := b.(float64)
+		if a < b {
+			c = -1
+		} else if a > b {
+			c = 1
+		}
+	case string:
+		b := b.(string)
+		if a < b {
+			c = -1
+		} else if a > b {
+			c = 1
+		}
+	}
+	switch op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+func (p *parser) parsePrimary() (*node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokString:
+		return literal(String, t.text), nil
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, errorf(t.pos, "invalid number %q", t.text)
+		}
+		return literal(Number, f), nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return literal(Bool, true), nil
+		case "false":
+			return literal(Bool, false), nil
+		}
+		if p.accept("(") {
+			return p.parseCall(t)
+		}
+		typ, ok := p.vars[t.text]
+		if !ok {
+			return nil, errorf(t.pos, "unknown variable %q", t.text)
+		}
+		return variable(t.text, typ), nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			n, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return n, nil
+		case "[":
+			return p.parseList(t)
+		}
+	case tokEOF:
+		return nil, errorf(t.pos, "unexpected end of expression")
+	}
+	return nil, errorf(t.pos, "unexpected %q", t.text)
+}
+
+func (p *parser) parseList(open token) (*node, error) {
+	var elems []*node
+	for !p.accept("]") {
+		if len(elems) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		pos := p.peek().pos
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if n.typ != String && n.typ != Number {
+			return nil, errorf(pos, "list of %v", n.typ)
+		}
+		if len(elems) > 0 && n.typ != elems[0].typ {
+			return nil, errorf(pos, "%v in a list of %v", n.typ, elems[0].typ)
+		}
+		elems = append(elems, n)
+	}
+	if len(elems) == 0 {
+		return nil, errorf(open.pos, "empty list")
+	}
+
+	typ := StringList
+	if elems[0].typ == Number {
+		typ = NumberList
+	}
+	return &node{typ: typ, eval: func(env Env) interface{} {
+		l := make([]interface{}, len(elems))
+		for i, v := range elems {
+			l[i] = v.eval(env)
+		}
+		return l
+	}}, nil
+}
+
+func (p *parser) parseCall(name token) (*node, error) {
+	var args []*node
+	for !p.accept(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, n)
+	}
+
+	switch name.text {
+	case "cidr":
+		if len(args) != 2 || args[0].typ != String {
+			return nil, errorf(name.pos, "cidr requires an address and a network literal")
+		}
+		s, ok := args[1].lit.(string)
+		if !ok {
+			return nil, errorf(name.pos, "cidr requires an address and a network literal")
+		}
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, errorf(name.pos, "invalid network %q", s)
+		}
+		e := args[0].eval
+		return &node{typ: Bool, eval: func(env Env) interface{} {
+			ip := net.ParseIP(e(env).(string))
+			return ip != nil && network.Contains(ip)
+		}}, nil
+	default:
+		return nil, errorf(name.pos, "unknown function %q", name.text)
+	}
+}
+
+// variable returns the node reading `name` from the environment,
+// converting its value to `typ`.
+func variable(name string, typ Type) *node {
+	return &node{typ: typ, eval: func(env Env) interface{} {
+		v := env(name)
+		switch typ {
+		case Bool:
+			b, _ := v.(bool)
+			return b
+		case Number:
+			switch n := v.(type) {
+			case int:
+				return float64(n)
+			case int64:
+				return float64(n)
+			case uint:
+				return float64(n)
+			case float64:
+				return n
+			}
+			return float64(0)
+		default:
+			s, _ := v.(string)
+			return s
+		}
+	}}
+}
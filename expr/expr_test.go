@@ -0,0 +1,101 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package expr_test
+
+import (
+	"testing"
+
+	"github.com/booster-proj/booster/expr"
+)
+
+var vars = map[string]expr.Type{
+	"source":  expr.String,
+	"host":    expr.String,
+	"ip":      expr.String,
+	"port":    expr.Number,
+	"metered": expr.Bool,
+}
+
+func env(name string) interface{} {
+	switch name {
+	case "source":
+		return "en0"
+	case "host":
+		return "video.example.com"
+	case "ip":
+		return "10.1.2.3"
+	case "port":
+		return 443
+	case "metered":
+		return true
+	}
+	return nil
+}
+
+func TestEval(t *testing.T) {
+	tt := []struct {
+		src  string
+		want bool
+	}{
+		{`true`, true},
+		{`source == "en0"`, true},
+		{`source != "en0"`, false},
+		{`port in [80, 443]`, true},
+		{`port >= 1024`, false},
+		{`host matches "*.example.com"`, true},
+		{`host matches "*.example.org" || metered`, true},
+		{`!metered && source == "en0"`, false},
+		{`!(host matches "*.example.com" && metered)`, false},
+		{`cidr(ip, "10.0.0.0/8") && source in ["en0", "en1"]`, true},
+		{`cidr(ip, "192.168.0.0/16")`, false},
+		{`"a" < "b" && 1.5 < 2`, true},
+	}
+
+	for _, v := range tt {
+		p, err := expr.Compile(v.src, vars)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", v.src, err)
+		}
+		if got := p.Eval(env); got != v.want {
+			t.Fatalf("%s: wanted %v, found %v", v.src, v.want, got)
+		}
+	}
+}
+
+func TestCompile_error(t *testing.T) {
+	tt := []string{
+		``,
+		`source`,
+		`port == "443"`,
+		`unknown == 1`,
+		`port in ["80"]`,
+		`host matches source`,
+		`host matches "[a"`,
+		`cidr(ip, "10.0.0.0")`,
+		`metered < true`,
+		`(metered`,
+		`"unterminated`,
+		`source == "en0" source`,
+		`port in []`,
+		`now()`,
+	}
+
+	for _, v := range tt {
+		if _, err := expr.Compile(v, vars); err == nil {
+			t.Fatalf("%s: expected an error", v)
+		}
+	}
+}
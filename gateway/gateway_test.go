@@ -0,0 +1,135 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package gateway_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/booster-proj/booster/acl"
+	"github.com/booster-proj/booster/gateway"
+)
+
+func rules(t *testing.T) *gateway.Rules {
+	exclude, err := acl.ParseNetworks([]string{"192.168.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &gateway.Rules{Port: 1090, Interfaces: []string{"eth0", "wlan1"}, Exclude: exclude}
+}
+
+func TestRules_NFT(t *testing.T) {
+	script := rules(t).NFT()
+	for _, v := range []string{
+		"table ip booster {",
+		`iifname != { "eth0", "wlan1" } return`,
+		"fib daddr type local return",
+		"ip daddr { 192.168.0.0/16 } return",
+		"meta l4proto tcp redirect to :1090",
+		`iifname { "eth0", "wlan1" } oifname != { "eth0", "wlan1" } masquerade`,
+	} {
+		if !strings.Contains(script, v) {
+			t.Fatalf("Missing %q from script:\n%s", v, script)
+		}
+	}
+}
+
+func TestRules_IPTables(t *testing.T) {
+	var got []string
+	for _, v := range rules(t).IPTables() {
+		got = append(got, strings.Join(v, " "))
+	}
+	want := []string{
+		"-t nat -N BOOSTER",
+		"-t nat -A BOOSTER -m addrtype --dst-type LOCAL -j RETURN",
+		"-t nat -A BOOSTER -d 192.168.0.0/16 -j RETURN",
+		"-t nat -A BOOSTER -p tcp -j REDIRECT --to-ports 1090",
+		"-t nat -N BOOSTER_POSTROUTING",
+		"-t nat -A BOOSTER_POSTROUTING -m addrtype --src-type LOCAL -j RETURN",
+		"-t nat -A BOOSTER_POSTROUTING -o eth0 -j RETURN",
+		"-t nat -A BOOSTER_POSTROUTING -o wlan1 -j RETURN",
+		"-t nat -A BOOSTER_POSTROUTING -j MASQUERADE",
+		"-t nat -A PREROUTING -i eth0 -j BOOSTER",
+		"-t nat -A PREROUTING -i wlan1 -j BOOSTER",
+		"-t nat -A POSTROUTING -j BOOSTER_POSTROUTING",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected commands:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestRules_Validate(t *testing.T) {
+	tt := []gateway.Rules{
+		{Interfaces: []string{"eth0"}},
+		{Port: 1090},
+		{Port: 1090, Interfaces: []string{"eth0"}, Backend: "pf"},
+	}
+	for i, v := range tt {
+		if err := v.Validate(); err == nil {
+			t.Fatalf("%d: expected an error", i)
+		}
+	}
+	if err := rules(t).Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type dialer struct {
+	dialed bool
+}
+
+func (d *dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.dialed = true
+	return nil, errors.New("unexpected dial")
+}
+
+func TestProxy_notRedirected(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan error, 1)
+	d := &dialer{}
+	go func() {
+		p := &gateway.Proxy{Dialer: d}
+		c <- p.Serve(ctx, ln)
+	}()
+
+	// A connection made to the proxy itself is closed, instead of
+	// being dialed back to the proxy.
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if b, _ := ioutil.ReadAll(conn); len(b) > 0 {
+		t.Fatalf("Unexpected data: %q", b)
+	}
+	if d.dialed {
+		t.Fatal("Connection not redirected was dialed")
+	}
+
+	cancel()
+	if err := <-c; err != nil {
+		t.Fatalf("Unexpected error once canceled: %v", err)
+	}
+}
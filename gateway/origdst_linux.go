@@ -0,0 +1,54 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package gateway
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// OriginalDst returns the destination of `conn` before it was
+// redirected to the transparent proxy. Only IPv4 is supported.
+func OriginalDst(conn net.Conn) (*net.TCPAddr, error) {
+	tc, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a TCP connection", conn)
+	}
+	raw, err := tc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var addr *net.TCPAddr
+	cerr := raw.Control(func(fd uintptr) {
+		// The sockaddr_in filled by SO_ORIGINAL_DST has the size
+		// of an IPv6Mreq.
+		var mreq *unix.IPv6Mreq
+		if mreq, err = unix.GetsockoptIPv6Mreq(int(fd), unix.SOL_IP, unix.SO_ORIGINAL_DST); err != nil {
+			return
+		}
+		b := mreq.Multiaddr
+		addr = &net.TCPAddr{
+			IP:   net.IPv4(b[4], b[5], b[6], b[7]),
+			Port: int(b[2])<<8 | int(b[3]),
+		}
+	})
+	if cerr != nil {
+		return nil, cerr
+	}
+	return addr, err
+}
@@ -0,0 +1,77 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/booster-proj/booster/acl"
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/proxyproto"
+	"github.com/booster-proj/booster/relay"
+	"github.com/booster-proj/booster/schedule"
+)
+
+// Proxy is the transparent proxy of the gateway mode: it accepts the
+// connections redirected by Rules and dials their original destination
+// through Dialer, so that the clients of the local network are
+// balanced across the sources without being configured. Linux only.
+type Proxy struct {
+	// Dialer dials the original destinations, e.g. the booster
+	// dialer.
+	Dialer core.Dialer
+	// Buffers, if not nil, provides the buffers of the copies.
+	Buffers *relay.Pool
+	// If ACL is not nil, the connections of the clients it does not
+	// allow are refused.
+	ACL *acl.List
+	// If Schedules is not nil, the connections of the clients it
+	// denies at the time are refused.
+	Schedules *schedule.Schedules
+}
+
+// Serve relays the connections accepted by `ln` until the context is
+// canceled.
+func (p *Proxy) Serve(ctx context.Context, ln net.Listener) error {
+	f := &relay.Forwarder{Buffers: p.Buffers, Dial: p.dial}
+	return f.Serve(ctx, ln)
+}
+
+func (p *Proxy) dial(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	client := conn.RemoteAddr().String()
+	if p.ACL != nil && !p.ACL.AllowedAddr(client) {
+		return nil, fmt.Errorf("client %v not allowed", client)
+	}
+	if p.Schedules != nil {
+		if rule, ok := p.Schedules.DeniedAddr(client, time.Now()); ok {
+			return nil, fmt.Errorf("client %v not allowed at this time, denied by schedule %v", client, rule.ID)
+		}
+	}
+	dst, err := OriginalDst(conn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find the destination of %v: %v", conn.RemoteAddr(), err)
+	}
+	// The connections made to the proxy itself have no other
+	// destination: dialing it would loop.
+	if local, ok := conn.LocalAddr().(*net.TCPAddr); ok && local.IP.Equal(dst.IP) && local.Port == dst.Port {
+		return nil, fmt.Errorf("connection from %v was not redirected", conn.RemoteAddr())
+	}
+	ctx = proxyproto.WithClient(ctx, conn.RemoteAddr(), dst)
+	return p.Dialer.DialContext(ctx, "tcp", dst.String())
+}
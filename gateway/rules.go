@@ -0,0 +1,263 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package gateway turns booster into the router of a local network:
+// Rules redirects the TCP connections forwarded for the clients to the
+// transparent Proxy, which dials them through the sources.
+package gateway
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// DefaultExclude are the destinations that are routed as usual
+// instead of being redirected: the private, shared and link-local
+// networks.
+var DefaultExclude = []string{
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"100.64.0.0/10",
+	"169.254.0.0/16",
+}
+
+// Backends of the rules.
+const (
+	BackendNFT      = "nft"
+	BackendIPTables = "iptables"
+)
+
+const (
+	table     = "booster"
+	chain     = "BOOSTER"
+	natChain  = "BOOSTER_POSTROUTING"
+	ipForward = "/proc/sys/net/ipv4/ip_forward"
+)
+
+// Rules are the firewall rules of the gateway mode, installed in
+// their own nftables table, or iptables chains, so that they are
+// removed without touching the others. The IPv4 TCP connections
+// forwarded from Interfaces are redirected to the transparent proxy,
+// except the ones to Exclude and to the host itself, e.g. to the API
+// and the proxies of booster. The rest of the forwarded traffic is
+// masqueraded. The connections of booster itself leave from the host
+// and are never redirected. Linux only, requires CAP_NET_ADMIN.
+type Rules struct {
+	// Port is the listening port of the transparent proxy.
+	Port int
+	// Interfaces are the interfaces of the local network, whose
+	// clients use the host as their gateway.
+	Interfaces []string
+	// Exclude are the destinations not redirected, see
+	// DefaultExclude.
+	Exclude []*net.IPNet
+	// Backend is either BackendNFT or BackendIPTables. If empty,
+	// nft is used when installed, iptables otherwise.
+	Backend string
+
+	// forward is the value of the IP forwarding before Install.
+	forward []byte
+}
+
+// Validate returns an error if the rules cannot be installed.
+func (r *Rules) Validate() error {
+	switch {
+	case r.Port <= 0 || r.Port > 65535:
+		return fmt.Errorf("invalid port of the transparent proxy: %d", r.Port)
+	case len(r.Interfaces) == 0:
+		return errors.New("no interface of the local network")
+	}
+	switch r.Backend {
+	case "", BackendNFT, BackendIPTables:
+	default:
+		return fmt.Errorf("unknown firewall backend %q, expected %s or %s", r.Backend, BackendNFT, BackendIPTables)
+	}
+	return nil
+}
+
+func (r *Rules) backend() (string, error) {
+	if r.Backend != "" {
+		return r.Backend, nil
+	}
+	for _, v := range []string{BackendNFT, BackendIPTables} {
+		if _, err := exec.LookPath(v); err == nil {
+			return v, nil
+		}
+	}
+	return "", errors.New("neither nft nor iptables is installed")
+}
+
+// Install enables the IP forwarding and installs the rules, replacing
+// the ones left behind by a previous run, if any.
+func (r *Rules) Install() error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	backend, err := r.backend()
+	if err != nil {
+		return err
+	}
+	r.remove(backend)
+
+	switch backend {
+	case BackendNFT:
+		err = run(strings.NewReader(r.NFT()), "nft", "-f", "-")
+	case BackendIPTables:
+		for _, v := range r.IPTables() {
+			if err = run(nil, "iptables", v...); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		r.remove(backend)
+		return err
+	}
+
+	if r.forward, err = ioutil.ReadFile(ipForward); err != nil {
+		r.remove(backend)
+		return fmt.Errorf("unable to read the IP forwarding: %v", err)
+	}
+	if err := ioutil.WriteFile(ipForward, []byte("1\n"), 0644); err != nil {
+		r.remove(backend)
+		return fmt.Errorf("unable to enable the IP forwarding: %v", err)
+	}
+	return nil
+}
+
+// Remove removes the rules and restores the IP forwarding as it was
+// before Install.
+func (r *Rules) Remove() error {
+	backend, err := r.backend()
+	if err != nil {
+		return err
+	}
+	err = r.remove(backend)
+	if r.forward != nil {
+		if werr := ioutil.WriteFile(ipForward, r.forward, 0644); werr != nil && err == nil {
+			err = fmt.Errorf("unable to restore the IP forwarding: %v", werr)
+		}
+		r.forward = nil
+	}
+	return err
+}
+
+// remove removes the rules of `backend`, returning the first error
+// but going on with the others, as some may be missing already.
+func (r *Rules) remove(backend string) error {
+	if backend == BackendNFT {
+		return run(nil, "nft", "delete", "table", "ip", table)
+	}
+	var err error
+	cmds := [][]string{{"-t", "nat", "-D", "POSTROUTING", "-j", natChain}}
+	for _, v := range r.Interfaces {
+		cmds = append(cmds, []string{"-t", "nat", "-D", "PREROUTING", "-i", v, "-j", chain})
+	}
+	for _, v := range []string{chain, natChain} {
+		cmds = append(cmds, []string{"-t", "nat", "-F", v}, []string{"-t", "nat", "-X", v})
+	}
+	for _, v := range cmds {
+		if rerr := run(nil, "iptables", v...); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+// NFT returns the nftables script installing the rules, e.g. to be
+// reviewed or applied by hand with `nft -f`.
+func (r *Rules) NFT() string {
+	lan := make([]string, len(r.Interfaces))
+	for i, v := range r.Interfaces {
+		lan[i] = strconv.Quote(v)
+	}
+	ifaces := "{ " + strings.Join(lan, ", ") + " }"
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "table ip %s {\n", table)
+	b.WriteString("\tchain prerouting {\n")
+	b.WriteString("\t\ttype nat hook prerouting priority -100; policy accept;\n")
+	fmt.Fprintf(&b, "\t\tiifname != %s return\n", ifaces)
+	b.WriteString("\t\tfib daddr type local return\n")
+	if len(r.Exclude) > 0 {
+		nets := make([]string, len(r.Exclude))
+		for i, v := range r.Exclude {
+			nets[i] = v.String()
+		}
+		fmt.Fprintf(&b, "\t\tip daddr { %s } return\n", strings.Join(nets, ", "))
+	}
+	fmt.Fprintf(&b, "\t\tmeta l4proto tcp redirect to :%d\n", r.Port)
+	b.WriteString("\t}\n")
+	b.WriteString("\tchain postrouting {\n")
+	b.WriteString("\t\ttype nat hook postrouting priority 100; policy accept;\n")
+	fmt.Fprintf(&b, "\t\tiifname %s oifname != %s masquerade\n", ifaces, ifaces)
+	b.WriteString("\t}\n")
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// IPTables returns the arguments of the iptables commands installing
+// the rules, in order.
+func (r *Rules) IPTables() [][]string {
+	nat := func(args ...string) []string {
+		return append([]string{"-t", "nat"}, args...)
+	}
+	cmds := [][]string{
+		nat("-N", chain),
+		nat("-A", chain, "-m", "addrtype", "--dst-type", "LOCAL", "-j", "RETURN"),
+	}
+	for _, v := range r.Exclude {
+		cmds = append(cmds, nat("-A", chain, "-d", v.String(), "-j", "RETURN"))
+	}
+	cmds = append(cmds,
+		nat("-A", chain, "-p", "tcp", "-j", "REDIRECT", "--to-ports", strconv.Itoa(r.Port)),
+		nat("-N", natChain),
+		// POSTROUTING cannot match the input interface: leave out
+		// the traffic of the host and the one to the local network.
+		nat("-A", natChain, "-m", "addrtype", "--src-type", "LOCAL", "-j", "RETURN"),
+	)
+	for _, v := range r.Interfaces {
+		cmds = append(cmds, nat("-A", natChain, "-o", v, "-j", "RETURN"))
+	}
+	cmds = append(cmds, nat("-A", natChain, "-j", "MASQUERADE"))
+	for _, v := range r.Interfaces {
+		cmds = append(cmds, nat("-A", "PREROUTING", "-i", v, "-j", chain))
+	}
+	return append(cmds, nat("-A", "POSTROUTING", "-j", natChain))
+}
+
+// run runs `name` with `args`, reading `stdin` if not nil, returning
+// an error carrying its output on failure.
+func run(stdin io.Reader, name string, args ...string) error {
+	var out bytes.Buffer
+	cmd := exec.Command(name, args...)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, strings.TrimSpace(out.String()))
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package geoip locates destinations using MaxMind GeoLite2 (or
+// GeoIP2) databases, so that policies can target countries,
+// continents and autonomous systems.
+package geoip
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"upspin.io/log"
+)
+
+// Location describes where an address is, as far as the databases
+// loaded know. Empty fields are unknown.
+type Location struct {
+	Country   string `json:"country,omitempty"`
+	Continent string `json:"continent,omitempty"`
+	ASN       uint   `json:"asn,omitempty"`
+	ASOrg     string `json:"as_org,omitempty"`
+}
+
+// DefaultReloadInterval is how often the databases are checked for
+// updates.
+const DefaultReloadInterval = time.Hour
+
+// cacheTTL is how long host name resolutions are kept.
+const cacheTTL = time.Minute
+
+// DB combines one or more databases, e.g. GeoLite2-Country and
+// GeoLite2-ASN. Open it with Open, then call Run to reload the files
+// when they change.
+type DB struct {
+	// ReloadInterval is how often the files are checked for changes.
+	ReloadInterval time.Duration
+	// Resolver is used to resolve the host names located.
+	Resolver *net.Resolver
+
+	mux     sync.Mutex
+	paths   []string
+	readers []*Reader
+	mtimes  []time.Time
+
+	cache struct {
+		sync.Mutex
+		val map[string]cached
+	}
+}
+
+type cached struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+// Open loads the databases at `paths`.
+func Open(paths ...string) (*DB, error) {
+	db := &DB{paths: paths}
+	if err := db.Reload(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Reload reads again the database files that changed since they were
+// last loaded. If a file cannot be read, the previous version is kept.
+func (db *DB) Reload() error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	if db.readers == nil {
+		db.readers = make([]*Reader, len(db.paths))
+		db.mtimes = make([]time.Time, len(db.paths))
+	}
+	var failed error
+	for i, path := range db.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			failed = err
+			continue
+		}
+		if db.readers[i] != nil && !info.ModTime().After(db.mtimes[i]) {
+			continue
+		}
+		r, err := OpenReader(path)
+		if err != nil {
+			failed = err
+			continue
+		}
+		if db.readers[i] != nil {
+			log.Info.Printf("GeoIP: reloaded %s (%s)", path, r.Metadata.DatabaseType)
+		}
+		db.readers[i], db.mtimes[i] = r, info.ModTime()
+	}
+	return failed
+}
+
+func (db *DB) reloadInterval() time.Duration {
+	if db.ReloadInterval <= 0 {
+		return DefaultReloadInterval
+	}
+	return db.ReloadInterval
+}
+
+// Run reloads the databases every ReloadInterval, until the context
+// is canceled.
+func (db *DB) Run(ctx context.Context) error {
+	t := time.NewTicker(db.reloadInterval())
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			if err := db.Reload(); err != nil {
+				log.Error.Printf("GeoIP: %v", err)
+			}
+		}
+	}
+}
+
+// LocateIP returns the location of `ip`.
+func (db *DB) LocateIP(ip net.IP) Location {
+	db.mux.Lock()
+	readers := append([]*Reader(nil), db.readers...)
+	db.mux.Unlock()
+
+	var loc Location
+	for _, r := range readers {
+		if r == nil {
+			continue
+		}
+		v, err := r.Lookup(ip)
+		if err != nil {
+			log.Debug.Printf("GeoIP: %v", err)
+			continue
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if loc.Country == "" {
+			loc.Country = nested(m, "country", "iso_code")
+		}
+		if loc.Country == "" {
+			loc.Country = nested(m, "registered_country", "iso_code")
+		}
+		if loc.Continent == "" {
+			loc.Continent = nested(m, "continent", "code")
+		}
+		if n, ok := m["autonomous_system_number"].(uint64); ok && loc.ASN == 0 {
+			loc.ASN = uint(n)
+		}
+		if s, ok := m["autonomous_system_organization"].(string); ok && loc.ASOrg == "" {
+			loc.ASOrg = s
+		}
+	}
+	return loc
+}
+
+// Locate returns the locations of `host`, which is either an IP
+// address or a host name. Host names may resolve to addresses in
+// different locations.
+func (db *DB) Locate(host string) []Location {
+	ips := db.resolve(host)
+	acc := make([]Location, 0, len(ips))
+	for _, ip := range ips {
+		acc = append(acc, db.LocateIP(ip))
+	}
+	return acc
+}
+
+func (db *DB) resolve(host string) []net.IP {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}
+	}
+
+	db.cache.Lock()
+	defer db.cache.Unlock()
+	if v, ok := db.cache.val[host]; ok && time.Now().Before(v.expires) {
+		return v.ips
+	}
+
+	r := db.Resolver
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	addrs, err := r.LookupIPAddr(ctx, host)
+	if err != nil {
+		log.Debug.Printf("GeoIP: unable to resolve %s: %v", host, err)
+		return nil
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, v := range addrs {
+		ips = append(ips, v.IP)
+	}
+
+	if db.cache.val == nil {
+		db.cache.val = make(map[string]cached)
+	}
+	now := time.Now()
+	for k, v := range db.cache.val {
+		if now.After(v.expires) {
+			delete(db.cache.val, k)
+		}
+	}
+	db.cache.val[host] = cached{ips: ips, expires: now.Add(cacheTTL)}
+	return ips
+}
+
+// nested returns the string at path `keys` of `m`, if any.
+func nested(m map[string]interface{}, keys ...string) string {
+	var v interface{} = m
+	for _, k := range keys {
+		mm, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		v = mm[k]
+	}
+	s, _ := v.(string)
+	return s
+}
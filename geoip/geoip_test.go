@@ -0,0 +1,238 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package geoip_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/geoip"
+)
+
+// encode encodes `v` as a MaxMind DB data section value. Only the
+// types needed by the tests are supported.
+func encode(buf *bytes.Buffer, v interface{}) {
+	ctrl := func(typ, size int) {
+		if typ < 8 {
+			buf.WriteByte(byte(typ<<5 | size))
+			return
+		}
+		buf.WriteByte(byte(size))
+		buf.WriteByte(byte(typ - 7))
+	}
+	switch v := v.(type) {
+	case string:
+		ctrl(2, len(v))
+		buf.WriteString(v)
+	case uint32:
+		ctrl(6, 4)
+		buf.Write([]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+	case uint64:
+		ctrl(9, 8)
+		for i := 7; i >= 0; i-- {
+			buf.WriteByte(byte(v >> (uint(i) * 8)))
+		}
+	case pointer:
+		buf.WriteByte(byte(1<<5 | (v>>8)&0x7))
+		buf.WriteByte(byte(v))
+	case map[string]interface{}:
+		ctrl(7, len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			encode(buf, k)
+			encode(buf, v[k])
+		}
+	}
+}
+
+// pointer is a data section pointer, smaller than 2048.
+type pointer uint
+
+type network struct {
+	cidr   string
+	record interface{}
+}
+
+// build returns an IPv6 database, with 24 bit records, containing
+// `networks`.
+func build(networks ...network) []byte {
+	const empty = -1
+	nodes := [][2]int{{empty, empty}}
+	var data bytes.Buffer
+	for _, v := range networks {
+		_, ipnet, _ := net.ParseCIDR(v.cidr)
+		ones, bits := ipnet.Mask.Size()
+		ip := ipnet.IP.To16()
+		if bits == 32 {
+			// IPv4 networks are stored under ::/96.
+			ip = append(make(net.IP, 12), ipnet.IP.To4()...)
+			ones += 96
+		}
+
+		offset := data.Len()
+		encode(&data, v.record)
+
+		node := 0
+		for i := 0; i < ones; i++ {
+			bit := int(ip[i/8]>>(7-uint(i%8))) & 1
+			if i == ones-1 {
+				nodes[node][bit] = -(offset + 2)
+				break
+			}
+			if nodes[node][bit] == empty {
+				nodes = append(nodes, [2]int{empty, empty})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+	}
+
+	n := len(nodes)
+	var buf bytes.Buffer
+	for _, v := range nodes {
+		for _, r := range v {
+			switch {
+			case r == empty:
+				r = n
+			case r < 0:
+				r = n + 16 + (-r - 2)
+			}
+			buf.Write([]byte{byte(r >> 16), byte(r >> 8), byte(r)})
+		}
+	}
+	buf.Write(make([]byte, 16))
+	buf.Write(data.Bytes())
+	buf.WriteString("\xab\xcd\xefMaxMind.com")
+	encode(&buf, map[string]interface{}{
+		"node_count":    uint32(n),
+		"record_size":   uint32(24),
+		"ip_version":    uint32(6),
+		"database_type": "Test",
+		"build_epoch":   uint64(1546300800),
+	})
+	return buf.Bytes()
+}
+
+var italy = map[string]interface{}{
+	"country":   map[string]interface{}{"iso_code": "IT"},
+	"continent": map[string]interface{}{"code": "EU"},
+}
+
+func TestReader(t *testing.T) {
+	b := build(
+		network{"192.0.2.0/24", italy},
+		// Points to the record above.
+		network{"198.51.100.0/24", pointer(0)},
+		network{"2001:db8::/32", map[string]interface{}{"autonomous_system_number": uint32(64496)}},
+	)
+	r, err := geoip.NewReader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Metadata.DatabaseType != "Test" || r.Metadata.BuildEpoch != 1546300800 {
+		t.Fatalf("Unexpected metadata: %+v", r.Metadata)
+	}
+
+	for _, ip := range []string{"192.0.2.1", "198.51.100.200"} {
+		v, err := r.Lookup(net.ParseIP(ip))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			t.Fatalf("%s: unexpected record: %v", ip, v)
+		}
+		if c := m["country"].(map[string]interface{})["iso_code"]; c != "IT" {
+			t.Fatalf("%s: unexpected country: %v", ip, c)
+		}
+	}
+	v, err := r.Lookup(net.ParseIP("2001:db8::1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asn := v.(map[string]interface{})["autonomous_system_number"]; asn != uint64(64496) {
+		t.Fatalf("Unexpected ASN: %v", asn)
+	}
+	if v, err := r.Lookup(net.ParseIP("203.0.113.1")); v != nil || err != nil {
+		t.Fatalf("Unexpected record: %v, %v", v, err)
+	}
+
+	if _, err := geoip.NewReader([]byte("not a database")); err == nil {
+		t.Fatal("Invalid databases should not be accepted")
+	}
+}
+
+func TestReader_corrupt(t *testing.T) {
+	marker := "\xab\xcd\xefMaxMind.com"
+	deep := bytes.Repeat([]byte{0x01, 0x04}, 1000) // arrays of one array
+	for name, meta := range map[string][]byte{
+		"pointer to itself":     {0x20, 0x00},
+		"map containing itself": {0xe1, 0x41, 'a', 0x20, 0x00},
+		"huge map":              {0xff, 0xff, 0xff, 0xff},
+		"huge array":            {0x1f, 0x04, 0xff, 0xff, 0xff},
+		"too deep":              append(deep, 0x40),
+	} {
+		if _, err := geoip.NewReader(append([]byte(marker), meta...)); err == nil {
+			t.Fatalf("%s: corrupt metadata should not be accepted", name)
+		}
+	}
+}
+
+func TestDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "booster-geoip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.mmdb")
+	if err := ioutil.WriteFile(path, build(network{"192.0.2.0/24", italy}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	db, err := geoip.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locs := db.Locate("192.0.2.1")
+	if len(locs) != 1 || locs[0].Country != "IT" || locs[0].Continent != "EU" {
+		t.Fatalf("Unexpected locations: %+v", locs)
+	}
+
+	// Update the database.
+	if err := ioutil.WriteFile(path, build(network{"192.0.2.0/24", map[string]interface{}{
+		"country": map[string]interface{}{"iso_code": "FR"},
+	}}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(path, future, future)
+	if err := db.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if loc := db.LocateIP(net.ParseIP("192.0.2.1")); loc.Country != "FR" {
+		t.Fatalf("Database not reloaded: %+v", loc)
+	}
+}
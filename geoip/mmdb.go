@@ -0,0 +1,357 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+)
+
+// metadataMarker precedes the metadata section of a MaxMind DB file.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// Metadata describes a MaxMind DB database.
+type Metadata struct {
+	NodeCount    uint
+	RecordSize   uint
+	IPVersion    uint
+	DatabaseType string
+	BuildEpoch   uint
+}
+
+// Reader reads MaxMind DB (.mmdb) files, such as the GeoLite2 ones,
+// following the MaxMind DB file format specification.
+type Reader struct {
+	Metadata Metadata
+
+	buf       []byte
+	tree      []byte
+	data      []byte
+	ipv4Start uint
+}
+
+// OpenReader reads the database at `path` into memory.
+func OpenReader(path string) (*Reader, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewReader(b)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: %s: %v", path, err)
+	}
+	return r, nil
+}
+
+// NewReader returns a Reader of the database contained in `b`.
+func NewReader(b []byte) (*Reader, error) {
+	i := bytes.LastIndex(b, metadataMarker)
+	if i < 0 {
+		return nil, errors.New("invalid database: metadata not found")
+	}
+	meta := b[i+len(metadataMarker):]
+	v, _, err := (&decoder{buf: meta}).decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata: %v", err)
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid metadata: not a map")
+	}
+
+	r := &Reader{buf: b}
+	r.Metadata.NodeCount = toUint(m["node_count"])
+	r.Metadata.RecordSize = toUint(m["record_size"])
+	r.Metadata.IPVersion = toUint(m["ip_version"])
+	r.Metadata.BuildEpoch = toUint(m["build_epoch"])
+	r.Metadata.DatabaseType, _ = m["database_type"].(string)
+	switch r.Metadata.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported record size %d", r.Metadata.RecordSize)
+	}
+
+	treeSize := r.Metadata.RecordSize * 2 / 8 * r.Metadata.NodeCount
+	if treeSize+16 > uint(i) {
+		return nil, errors.New("invalid database: search tree exceeds file size")
+	}
+	r.tree = b[:treeSize]
+	r.data = b[treeSize+16 : i]
+
+	// IPv4 addresses are stored in IPv6 databases under ::/96.
+	if r.Metadata.IPVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < r.Metadata.NodeCount; i++ {
+			node = r.record(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// record returns the left (bit == 0) or right record of `node`.
+func (r *Reader) record(node uint, bit uint) uint {
+	switch r.Metadata.RecordSize {
+	case 24:
+		b := r.tree[node*6+bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := r.tree[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(r.tree[node*8+bit*4:]))
+	}
+}
+
+// Lookup returns the record associated with `ip`, or nil if there is
+// none. Records are usually maps, decoded as map[string]interface{}.
+func (r *Reader) Lookup(ip net.IP) (interface{}, error) {
+	node := uint(0)
+	bits := ip.To16()
+	if v4 := ip.To4(); v4 != nil {
+		bits = v4
+		node = r.ipv4Start
+	} else if r.Metadata.IPVersion == 4 {
+		return nil, fmt.Errorf("geoip: IPv6 address %v in IPv4 database", ip)
+	}
+	if bits == nil {
+		return nil, fmt.Errorf("geoip: invalid address %v", ip)
+	}
+
+	n := r.Metadata.NodeCount
+	for i := 0; i < len(bits)*8 && node < n; i++ {
+		bit := uint(bits[i/8]>>(7-uint(i%8))) & 1
+		node = r.record(node, bit)
+	}
+	if node == n {
+		return nil, nil
+	}
+	if node < n {
+		return nil, errors.New("geoip: invalid search tree")
+	}
+	offset := node - n - 16
+	if offset >= uint(len(r.data)) {
+		return nil, errors.New("geoip: invalid data pointer")
+	}
+	v, _, err := (&decoder{buf: r.data}).decode(offset)
+	return v, err
+}
+
+// Data section types.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// maxDepth is the maximum nesting of the maps, arrays and pointers of
+// a value, so that corrupt databases referencing themselves do not
+// exhaust the stack.
+const maxDepth = 512
+
+// decoder decodes the values of a data section.
+type decoder struct {
+	buf []byte
+}
+
+func (d *decoder) bytes(offset, n uint) ([]byte, error) {
+	if offset+n > uint(len(d.buf)) {
+		return nil, errors.New("unexpected end of data")
+	}
+	return d.buf[offset : offset+n], nil
+}
+
+// decode decodes the value at `offset`, returning the offset of the
+// next value.
+func (d *decoder) decode(offset uint) (interface{}, uint, error) {
+	return d.decodeDepth(offset, 0)
+}
+
+func (d *decoder) decodeDepth(offset uint, depth int) (interface{}, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, errors.New("maximum data structure depth exceeded")
+	}
+	b, err := d.bytes(offset, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	ctrl := b[0]
+	offset++
+	typ := uint(ctrl >> 5)
+
+	if typ == typePointer {
+		ss := uint(ctrl>>3) & 0x3
+		b, err := d.bytes(offset, ss+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		var p uint
+		vvv := uint(ctrl & 0x7)
+		switch ss {
+		case 0:
+			p = vvv<<8 | uint(b[0])
+		case 1:
+			p = (vvv<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+		case 2:
+			p = (vvv<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+		default:
+			p = uint(binary.BigEndian.Uint32(b))
+		}
+		// Pointers cannot point to pointers.
+		b, err = d.bytes(p, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		if b[0]>>5 == typePointer {
+			return nil, 0, errors.New("pointer to a pointer")
+		}
+		v, _, err := d.decodeDepth(p, depth+1)
+		return v, offset + ss + 1, err
+	}
+
+	if typ == typeExtended {
+		b, err := d.bytes(offset, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		typ = 7 + uint(b[0])
+		offset++
+	}
+
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		b, err := d.bytes(offset, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += n
+		switch n {
+		case 1:
+			size = 29 + uint(b[0])
+		case 2:
+			size = 285 + (uint(b[0])<<8 | uint(b[1]))
+		default:
+			size = 65821 + (uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]))
+		}
+	}
+
+	// Each entry of the maps and of the arrays takes at least one
+	// byte: larger sizes cannot be satisfied by the data left.
+	if (typ == typeMap || typ == typeArray) && size > uint(len(d.buf))-offset {
+		return nil, 0, errors.New("unexpected end of data")
+	}
+	switch typ {
+	case typeMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			k, next, err := d.decodeDepth(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			v, next, err := d.decodeDepth(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			v, next, err := d.decodeDepth(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			offset = next
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeEndMarker, typeContainer:
+		return nil, offset, nil
+	}
+
+	b, err = d.bytes(offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset += size
+	switch typ {
+	case typeString:
+		return string(b), offset, nil
+	case typeBytes, typeUint128:
+		return append([]byte(nil), b...), offset, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errors.New("invalid double size")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errors.New("invalid float size")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case typeUint16, typeUint32, typeUint64:
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, offset, nil
+	case typeInt32:
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int64(int32(v)), offset, nil
+	default:
+		return nil, 0, fmt.Errorf("unknown data type %d", typ)
+	}
+}
+
+func toUint(v interface{}) uint {
+	if n, ok := v.(uint64); ok {
+		return uint(n)
+	}
+	return 0
+}
@@ -1,7 +1,8 @@
 module github.com/booster-proj/booster
 
+go 1.21
+
 require (
-	github.com/booster-proj/proxy v0.1.4
 	github.com/cenkalti/backoff v2.1.0+incompatible // indirect
 	github.com/gorilla/context v1.1.1 // indirect
 	github.com/gorilla/mux v1.6.2
@@ -10,8 +11,8 @@ require (
 	github.com/prometheus/client_golang v0.9.2
 	github.com/spf13/cobra v0.0.3
 	github.com/spf13/pflag v1.0.3 // indirect
-	golang.org/x/crypto v0.0.0-20181203042331-505ab145d0a9 // indirect
-	golang.org/x/net v0.0.0-20190119204137-ed066c81e75e // indirect
+	golang.org/x/crypto v0.0.0-20181203042331-505ab145d0a9
+	golang.org/x/net v0.0.0-20190119204137-ed066c81e75e
 	golang.org/x/sync v0.0.0-20181221193216-37e7f081c4d4
 	golang.org/x/sys v0.0.0-20181026064943-731415f00dce
 	upspin.io v0.0.0-20181217205605-686971a7c4ba
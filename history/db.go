@@ -0,0 +1,223 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package history persists the per-source bandwidth and latency
+// samples on disk, allowing to query them later, e.g. for charting.
+//
+// Samples are stored as JSON lines in one file per (UTC) day, which
+// keeps the database dependency free, human readable, and makes
+// retention as cheap as removing the oldest files.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRetention is the amount of time samples are kept for.
+const DefaultRetention = time.Hour * 24 * 7
+
+const dayLayout = "2006-01-02"
+
+// Sample describes the activity of a source during an interval of
+// time, ending at Time.
+type Sample struct {
+	Time     time.Time     `json:"time"`
+	Source   string        `json:"source"`
+	Interval time.Duration `json:"interval"`
+	// Sent and Received are the bytes transmitted during the interval.
+	Sent     int64 `json:"sent"`
+	Received int64 `json:"received"`
+	// RTT and Loss are the last values measured by the prober,
+	// if any.
+	RTT  time.Duration `json:"rtt,omitempty"`
+	Loss float64       `json:"loss,omitempty"`
+	// Domains are the bytes transmitted to each domain during the
+	// interval. There are at most MaxDomains of them: the traffic of
+	// the domains in excess is accounted to OtherDomain.
+	Domains map[string]Traffic `json:"domains,omitempty"`
+}
+
+// Traffic is the amount of data transmitted.
+type Traffic struct {
+	Sent     int64 `json:"sent"`
+	Received int64 `json:"received"`
+}
+
+// MaxDomains is the maximum number of domains of a sample.
+const MaxDomains = 256
+
+// OtherDomain collects the traffic of the domains in excess of
+// MaxDomains.
+const OtherDomain = "other"
+
+// DB is the on disk samples database.
+type DB struct {
+	dir       string
+	retention time.Duration
+
+	mux sync.Mutex
+}
+
+// Open opens the database contained in `dir`, creating the directory
+// if needed. Samples older than `retention` are removed; if it is 0,
+// DefaultRetention is used.
+func Open(dir string, retention time.Duration) (*DB, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+	db := &DB{dir: dir, retention: retention}
+	return db, db.Prune(time.Now())
+}
+
+func (db *DB) path(day string) string {
+	return filepath.Join(db.dir, day+".jsonl")
+}
+
+// days returns the days for which a file exists, sorted.
+func (db *DB) days() ([]string, error) {
+	infos, err := ioutil.ReadDir(db.dir)
+	if err != nil {
+		return nil, err
+	}
+	acc := make([]string, 0, len(infos))
+	for _, v := range infos {
+		day := strings.TrimSuffix(v.Name(), ".jsonl")
+		if _, err := time.Parse(dayLayout, day); err == nil && day != v.Name() {
+			acc = append(acc, day)
+		}
+	}
+	sort.Strings(acc)
+	return acc, nil
+}
+
+// Append stores `samples`.
+func (db *DB) Append(samples ...Sample) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	files := make(map[string]*os.File)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, v := range samples {
+		day := v.Time.UTC().Format(dayLayout)
+		f, ok := files[day]
+		if !ok {
+			var err error
+			f, err = os.OpenFile(db.path(day), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+			if err != nil {
+				return err
+			}
+			files[day] = f
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(append(b, '\n')); err != nil {
+			return err
+		}
+	}
+	for _, f := range files {
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	files = nil
+	return nil
+}
+
+// Query returns the samples of `source` taken in [from, to], sorted
+// by time. If `source` is empty, the samples of every source are
+// returned.
+func (db *DB) Query(source string, from, to time.Time) ([]Sample, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	days, err := db.days()
+	if err != nil {
+		return nil, err
+	}
+	first, last := from.UTC().Format(dayLayout), to.UTC().Format(dayLayout)
+
+	acc := []Sample{}
+	for _, day := range days {
+		if day < first || day > last {
+			continue
+		}
+		f, err := os.Open(db.path(day))
+		if err != nil {
+			return nil, err
+		}
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			var v Sample
+			if err := json.Unmarshal(s.Bytes(), &v); err != nil {
+				// Skip partially written lines.
+				continue
+			}
+			if source != "" && v.Source != source {
+				continue
+			}
+			if v.Time.Before(from) || v.Time.After(to) {
+				continue
+			}
+			acc = append(acc, v)
+		}
+		err = s.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(acc, func(i, j int) bool {
+		return acc[i].Time.Before(acc[j].Time)
+	})
+	return acc, nil
+}
+
+// Prune removes the samples older than the retention period,
+// relative to `now`. Samples are removed one day at a time.
+func (db *DB) Prune(now time.Time) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	days, err := db.days()
+	if err != nil {
+		return err
+	}
+	limit := now.Add(-db.retention).UTC().Format(dayLayout)
+	for _, day := range days {
+		if day < limit {
+			if err := os.Remove(db.path(day)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package history_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/history"
+	"github.com/booster-proj/booster/source"
+)
+
+func TestDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "booster-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := history.Open(dir, time.Hour*48)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2019, 5, 10, 12, 0, 0, 0, time.UTC)
+	samples := []history.Sample{
+		{Time: now.Add(-time.Hour * 72), Source: "s0", Sent: 1},
+		{Time: now.Add(-time.Hour * 24), Source: "s0", Sent: 2},
+		{Time: now.Add(-time.Hour * 24), Source: "s1", Sent: 3},
+		{Time: now, Source: "s0", Sent: 4},
+	}
+	if err := db.Append(samples...); err != nil {
+		t.Fatal(err)
+	}
+
+	acc, err := db.Query("s0", now.Add(-time.Hour*100), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(acc) != 3 || acc[0].Sent != 1 || acc[2].Sent != 4 {
+		t.Fatalf("Unexpected samples: %+v", acc)
+	}
+	acc, _ = db.Query("", now.Add(-time.Hour*25), now.Add(-time.Hour))
+	if len(acc) != 2 {
+		t.Fatalf("Unexpected samples: %+v", acc)
+	}
+
+	if err := db.Prune(now); err != nil {
+		t.Fatal(err)
+	}
+	acc, _ = db.Query("s0", now.Add(-time.Hour*100), now)
+	if len(acc) != 2 {
+		t.Fatalf("Old samples were not pruned: %+v", acc)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if len(files) != 2 {
+		t.Fatalf("Unexpected files: %v", files)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "booster-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := history.Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &history.Recorder{DB: db}
+	labels := map[string]string{"source": "s0", "target": "host:443"}
+	r.SendDataFlow(labels, &source.DataFlow{Type: "read", N: 10})
+	r.SendDataFlow(labels, &source.DataFlow{Type: "read", N: 5})
+	r.SendDataFlow(labels, &source.DataFlow{Type: "write", N: 7})
+	r.SetProbeStats(map[string]string{"source": "s0"}, time.Millisecond*20, 0.5)
+
+	now := time.Now()
+	if err := r.Flush(now); err != nil {
+		t.Fatal(err)
+	}
+	// Nothing happened since the last flush.
+	if err := r.Flush(now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	acc, err := db.Query("s0", now.Add(-time.Minute), now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(acc) != 1 {
+		t.Fatalf("Unexpected samples: %+v", acc)
+	}
+	if s := acc[0]; s.Received != 15 || s.Sent != 7 || s.RTT != time.Millisecond*20 || s.Loss != 0.5 {
+		t.Fatalf("Unexpected sample: %+v", s)
+	}
+}
@@ -0,0 +1,391 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package history
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/booster-proj/booster/events"
+	"github.com/booster-proj/booster/store"
+	"upspin.io/log"
+)
+
+// States of the sources recorded by the Journal. A source is in
+// StateUnknown before it is seen for the first time, and while booster
+// is not running.
+const (
+	StateUp      = "up"
+	StateDown    = "down"
+	StateUnknown = "unknown"
+)
+
+// DefaultWindows are the windows the availability of the sources is
+// reported over, if none is requested.
+var DefaultWindows = []time.Duration{time.Hour, time.Hour * 24, time.Hour * 24 * 7, time.Hour * 24 * 30}
+
+// Transition is a change of the state of a source.
+type Transition struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	State  string    `json:"state"`
+}
+
+// Outage is an interval of time during which a source was down.
+type Outage struct {
+	Source string    `json:"source"`
+	Start  time.Time `json:"start"`
+	// End is nil while the outage is in progress. Outages ended by
+	// booster stopping end when it stopped.
+	End      *time.Time    `json:"end,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Availability is the time a source spent up and down during a window
+// of time. The time during which its state is unknown is not
+// accounted.
+type Availability struct {
+	Window  time.Duration `json:"window"`
+	Up      time.Duration `json:"up"`
+	Down    time.Duration `json:"down"`
+	Outages int           `json:"outages"`
+}
+
+// Percent returns the percentage of the time known during which the
+// source was up, or 100 if it is not known at all.
+func (a Availability) Percent() float64 {
+	if a.Up+a.Down == 0 {
+		return 100
+	}
+	return float64(a.Up) * 100 / float64(a.Up+a.Down)
+}
+
+// MarshalJSON implements json.Marshaler, adding the percentage to the
+// fields of `a`.
+func (a Availability) MarshalJSON() ([]byte, error) {
+	type availability Availability
+	return json.Marshal(struct {
+		availability
+		Percent float64 `json:"availability"`
+	}{availability(a), a.Percent()})
+}
+
+// Journal records the transitions of the sources between up and down,
+// i.e. when they are added to and removed from the store, in order to
+// report their outages and availability.
+type Journal struct {
+	// Bus is where the events of the sources are received from.
+	Bus *events.Bus
+	// File, if set, is where the transitions are saved, as JSON lines,
+	// and loaded from by Load.
+	File string
+	// Retention is the amount of time transitions are kept for. If 0,
+	// DefaultRetention is used.
+	Retention time.Duration
+
+	mux         sync.Mutex
+	transitions []Transition // sorted by time
+	last        map[string]Transition
+}
+
+// Load reads the transitions saved into File, if any, discarding the
+// ones older than Retention. The sources are then in StateUnknown,
+// since booster was not running.
+func (j *Journal) Load(now time.Time) error {
+	if j.File == "" {
+		return nil
+	}
+	f, err := os.Open(j.File)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var acc []Transition
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var v Transition
+		if err := json.Unmarshal(s.Bytes(), &v); err != nil {
+			// Skip partially written lines.
+			continue
+		}
+		acc = append(acc, v)
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	sort.SliceStable(acc, func(i, k int) bool { return acc[i].Time.Before(acc[k].Time) })
+
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	j.transitions = acc
+	j.last = make(map[string]Transition)
+	for _, v := range acc {
+		j.last[v.Source] = v
+	}
+	// If booster did not stop cleanly, the state of the sources is
+	// unknown since the last transition recorded.
+	var stopped []Transition
+	for id, v := range j.last {
+		if v.State != StateUnknown {
+			stopped = append(stopped, Transition{Time: acc[len(acc)-1].Time, Source: id, State: StateUnknown})
+		}
+	}
+	sort.Slice(stopped, func(i, k int) bool { return stopped[i].Source < stopped[k].Source })
+	j.transitions = append(j.transitions, stopped...)
+	for _, v := range stopped {
+		j.last[v.Source] = v
+	}
+	j.prune(now)
+
+	// Rewrite the file, without the transitions pruned.
+	return j.save(true, j.transitions...)
+}
+
+// Record records `t`, if it changes the state of its source and is
+// not older than its last transition.
+func (j *Journal) Record(t Transition) error {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	if j.last == nil {
+		j.last = make(map[string]Transition)
+	}
+	last, ok := j.last[t.Source]
+	if !ok {
+		last.State = StateUnknown
+	}
+	if t.State == last.State || t.Time.Before(last.Time) {
+		return nil
+	}
+	j.last[t.Source] = t
+	j.transitions = append(j.transitions, t)
+	j.prune(t.Time)
+	return j.save(false, t)
+}
+
+// prune removes the transitions older than Retention, keeping the last
+// one of each source, which tells its state when the retention period
+// starts. Call it with the lock held.
+func (j *Journal) prune(now time.Time) {
+	retention := j.Retention
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+	limit := now.Add(-retention)
+	n := sort.Search(len(j.transitions), func(i int) bool {
+		return !j.transitions[i].Time.Before(limit)
+	})
+	if n == 0 {
+		return
+	}
+	last := make(map[string]Transition)
+	for _, v := range j.transitions[:n] {
+		last[v.Source] = v
+	}
+	acc := make([]Transition, 0, len(last)+len(j.transitions)-n)
+	for _, v := range j.transitions[:n] {
+		if last[v.Source] == v && v.State != StateUnknown {
+			acc = append(acc, v)
+		}
+	}
+	j.transitions = append(acc, j.transitions[n:]...)
+}
+
+// save appends `transitions` to File, if set, or replaces its content
+// with them if `truncate` is true. Call it with the lock held.
+func (j *Journal) save(truncate bool, transitions ...Transition) error {
+	if j.File == "" {
+		return nil
+	}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if truncate {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	}
+	f, err := os.OpenFile(j.File, flags, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, v := range transitions {
+		b, err := json.Marshal(v)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		w.Write(append(b, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Sources returns the sources recorded, sorted.
+func (j *Journal) Sources() []string {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	acc := make([]string, 0, len(j.last))
+	for id := range j.last {
+		acc = append(acc, id)
+	}
+	sort.Strings(acc)
+	return acc
+}
+
+// Transitions returns the transitions of `source` that happened in
+// [from, to], or of every source if `source` is empty.
+func (j *Journal) Transitions(source string, from, to time.Time) []Transition {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	acc := []Transition{}
+	for _, v := range j.transitions {
+		if (source == "" || v.Source == source) && !v.Time.Before(from) && !v.Time.After(to) {
+			acc = append(acc, v)
+		}
+	}
+	return acc
+}
+
+// walk calls `f` with each interval of time in [from, to] and the state
+// of `source` during it. Call it with the lock held.
+func (j *Journal) walk(source string, from, to time.Time, f func(state string, start, end time.Time)) {
+	state, start := StateUnknown, from
+	for _, v := range j.transitions {
+		if v.Source != source {
+			continue
+		}
+		if v.Time.After(to) {
+			break
+		}
+		if v.Time.After(start) {
+			f(state, start, v.Time)
+			start = v.Time
+		}
+		state = v.State
+	}
+	if to.After(start) {
+		f(state, start, to)
+	}
+}
+
+// Outages returns the outages of `source` that overlap [from, to],
+// clipped to it, or of every source if `source` is empty.
+func (j *Journal) Outages(source string, from, to time.Time) []Outage {
+	sources := []string{source}
+	if source == "" {
+		sources = j.Sources()
+	}
+
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	acc := []Outage{}
+	for _, id := range sources {
+		j.walk(id, from, to, func(state string, start, end time.Time) {
+			if state != StateDown {
+				return
+			}
+			o := Outage{Source: id, Start: start, Duration: end.Sub(start)}
+			if !end.Equal(to) || j.last[id].State != StateDown {
+				end := end
+				o.End = &end
+			}
+			acc = append(acc, o)
+		})
+	}
+	sort.SliceStable(acc, func(i, k int) bool { return acc[i].Start.Before(acc[k].Start) })
+	return acc
+}
+
+// Availability returns the availability of `source` during the
+// `window` of time ending at `now`.
+func (j *Journal) Availability(source string, window time.Duration, now time.Time) Availability {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	a := Availability{Window: window}
+	j.walk(source, now.Add(-window), now, func(state string, start, end time.Time) {
+		switch state {
+		case StateUp:
+			a.Up += end.Sub(start)
+		case StateDown:
+			a.Down += end.Sub(start)
+			a.Outages++
+		}
+	})
+	return a
+}
+
+// Run records the transitions of the sources published on Bus until
+// `ctx` is canceled, starting from the ones still in its history. The
+// sources are then recorded in StateUnknown.
+func (j *Journal) Run(ctx context.Context) error {
+	c, cancel := j.Bus.Subscribe(64)
+	defer cancel()
+
+	for _, e := range j.Bus.Recent() {
+		j.recordEvent(e)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			now := time.Now()
+			for _, id := range j.Sources() {
+				if err := j.Record(Transition{Time: now, Source: id, State: StateUnknown}); err != nil {
+					log.Error.Printf("Journal: %v", err)
+				}
+			}
+			return ctx.Err()
+		case e := <-c:
+			j.recordEvent(e)
+		}
+	}
+}
+
+// recordEvent records the transition described by `e`, if it is the
+// event of a source going up or down.
+func (j *Journal) recordEvent(e events.Event) {
+	t := Transition{Time: e.Time}
+	switch e.Topic {
+	case events.TopicSourceUp:
+		t.State = StateUp
+	case events.TopicSourceDown:
+		t.State = StateDown
+	default:
+		return
+	}
+	src, ok := e.Data.(*store.DummySource)
+	if !ok {
+		return
+	}
+	t.Source = src.ID
+	if err := j.Record(t); err != nil {
+		log.Error.Printf("Journal: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package history_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/history"
+)
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "booster-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2019, 5, 10, 12, 0, 0, 0, time.UTC)
+	j := &history.Journal{File: filepath.Join(dir, "journal.jsonl"), Retention: time.Hour * 48}
+	for _, v := range []history.Transition{
+		{Time: now.Add(-time.Hour * 72), Source: "s0", State: history.StateUp},
+		{Time: now.Add(-time.Hour * 10), Source: "s0", State: history.StateDown},
+		{Time: now.Add(-time.Hour * 9), Source: "s0", State: history.StateUp},
+		{Time: now.Add(-time.Hour * 9), Source: "s0", State: history.StateUp}, // no change
+		{Time: now.Add(-time.Hour * 2), Source: "s1", State: history.StateUp},
+		{Time: now.Add(-time.Hour), Source: "s1", State: history.StateDown},
+	} {
+		if err := j.Record(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a := j.Availability("s0", time.Hour*20, now)
+	if a.Up != time.Hour*19 || a.Down != time.Hour || a.Outages != 1 || a.Percent() != 95 {
+		t.Fatalf("Unexpected availability: %+v", a)
+	}
+	// The time before the first transition is not accounted.
+	if a := j.Availability("s1", time.Hour*24, now); a.Up != time.Hour || a.Down != time.Hour || a.Percent() != 50 {
+		t.Fatalf("Unexpected availability: %+v", a)
+	}
+
+	outages := j.Outages("", now.Add(-time.Hour*24), now)
+	if len(outages) != 2 {
+		t.Fatalf("Unexpected outages: %+v", outages)
+	}
+	if o := outages[0]; o.Source != "s0" || o.Duration != time.Hour || o.End == nil {
+		t.Fatalf("Unexpected outage: %+v", o)
+	}
+	if o := outages[1]; o.Source != "s1" || o.Duration != time.Hour || o.End != nil {
+		t.Fatalf("Outage should be in progress: %+v", o)
+	}
+
+	// Once loaded again, the transitions older than the retention are
+	// pruned, and the state of the sources is unknown.
+	j = &history.Journal{File: filepath.Join(dir, "journal.jsonl"), Retention: time.Hour * 48}
+	if err := j.Load(now); err != nil {
+		t.Fatal(err)
+	}
+	if ts := j.Transitions("s0", now.Add(-time.Hour*100), now); len(ts) != 4 || ts[3].State != history.StateUnknown {
+		t.Fatalf("Unexpected transitions: %+v", ts)
+	}
+	// The state is unknown since the last transition recorded.
+	if a := j.Availability("s0", time.Hour*20, now.Add(time.Hour)); a.Up != time.Hour*17 || a.Down != time.Hour {
+		t.Fatalf("Unexpected availability after the restart: %+v", a)
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package history
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/booster-proj/booster/source"
+	"upspin.io/log"
+)
+
+// DefaultInterval is the default sampling interval.
+const DefaultInterval = time.Minute
+
+// Exporter is the set of hooks the Recorder collects its data from.
+type Exporter interface {
+	source.MetricsExporter
+	SetProbeStats(labels map[string]string, rtt time.Duration, loss float64)
+}
+
+// Recorder is an Exporter that accumulates the data it receives,
+// forwarding it to Next if not nil, and periodically saves the
+// samples collected into the database.
+type Recorder struct {
+	DB       *DB
+	Next     Exporter
+	Interval time.Duration
+
+	mux     sync.Mutex
+	current map[string]*Sample
+	last    time.Time
+}
+
+func (r *Recorder) sample(id string) *Sample {
+	if r.current == nil {
+		r.current = make(map[string]*Sample)
+	}
+	s, ok := r.current[id]
+	if !ok {
+		s = &Sample{Source: id}
+		r.current[id] = s
+	}
+	return s
+}
+
+// SendDataFlow implements Exporter.
+func (r *Recorder) SendDataFlow(labels map[string]string, data *source.DataFlow) {
+	r.mux.Lock()
+	s := r.sample(labels["source"])
+	switch data.Type {
+	case "read":
+		s.Received += int64(data.N)
+	case "write":
+		s.Sent += int64(data.N)
+	}
+	r.mux.Unlock()
+
+	if r.Next != nil {
+		r.Next.SendDataFlow(labels, data)
+	}
+}
+
+// SetProbeStats implements Exporter.
+func (r *Recorder) SetProbeStats(labels map[string]string, rtt time.Duration, loss float64) {
+	r.mux.Lock()
+	s := r.sample(labels["source"])
+	s.RTT, s.Loss = rtt, loss
+	r.mux.Unlock()
+
+	if r.Next != nil {
+		r.Next.SetProbeStats(labels, rtt, loss)
+	}
+}
+
+// RecordUsage accounts the data transferred through `source` to the
+// domain of `target`. It implements dialer.UsageRecorder.
+func (r *Recorder) RecordUsage(source, target string, sent, received int64) {
+	domain := target
+	if host, _, err := net.SplitHostPort(target); err == nil {
+		domain = host
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	s := r.sample(source)
+	if s.Domains == nil {
+		s.Domains = make(map[string]Traffic)
+	}
+	if _, ok := s.Domains[domain]; !ok && len(s.Domains) >= MaxDomains-1 {
+		domain = OtherDomain
+	}
+	t := s.Domains[domain]
+	t.Sent += sent
+	t.Received += received
+	s.Domains[domain] = t
+}
+
+// CountOpenConn implements Exporter.
+func (r *Recorder) CountOpenConn(labels map[string]string, inc int) {
+	if r.Next != nil {
+		r.Next.CountOpenConn(labels, inc)
+	}
+}
+
+// AddLatency implements Exporter.
+func (r *Recorder) AddLatency(labels map[string]string, d time.Duration) {
+	if r.Next != nil {
+		r.Next.AddLatency(labels, d)
+	}
+}
+
+// CountPort implements Exporter.
+func (r *Recorder) CountPort(labels map[string]string, inc int) {
+	if r.Next != nil {
+		r.Next.CountPort(labels, inc)
+	}
+}
+
+// Flush saves the samples collected since the last flush.
+func (r *Recorder) Flush(now time.Time) error {
+	r.mux.Lock()
+	current := r.current
+	r.current = nil
+	interval := now.Sub(r.last)
+	if r.last.IsZero() {
+		interval = r.interval()
+	}
+	r.last = now
+	r.mux.Unlock()
+
+	acc := make([]Sample, 0, len(current))
+	for _, v := range current {
+		v.Time = now
+		v.Interval = interval
+		acc = append(acc, *v)
+	}
+	if len(acc) == 0 {
+		return nil
+	}
+	return r.DB.Append(acc...)
+}
+
+func (r *Recorder) interval() time.Duration {
+	if r.Interval <= 0 {
+		return DefaultInterval
+	}
+	return r.Interval
+}
+
+// Run flushes the samples every Interval, pruning the database once
+// in a while, until the context is canceled. A last flush is
+// performed before returning.
+func (r *Recorder) Run(ctx context.Context) error {
+	r.mux.Lock()
+	r.last = time.Now()
+	r.mux.Unlock()
+
+	t := time.NewTicker(r.interval())
+	defer t.Stop()
+	lastPrune := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := r.Flush(time.Now()); err != nil {
+				log.Error.Printf("History: %v", err)
+			}
+			return ctx.Err()
+		case now := <-t.C:
+			if err := r.Flush(now); err != nil {
+				log.Error.Printf("History: %v", err)
+			}
+			if now.Sub(lastPrune) > time.Hour {
+				lastPrune = now
+				if err := r.DB.Prune(now); err != nil {
+					log.Error.Printf("History: %v", err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package history
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"upspin.io/log"
+)
+
+// Report periods.
+const (
+	Daily  = "daily"
+	Weekly = "weekly"
+)
+
+// PeriodStart returns the start of the `period` containing `t`, i.e.
+// the midnight of its day, or the midnight of the Monday of its week,
+// in the location of `t`.
+func PeriodStart(period string, t time.Time) (time.Time, error) {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch period {
+	case Daily:
+		return day, nil
+	case Weekly:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7), nil
+	default:
+		return time.Time{}, fmt.Errorf("history: unknown report period %q", period)
+	}
+}
+
+// PeriodEnd returns the end of the `period` starting at `start`.
+func PeriodEnd(period string, start time.Time) time.Time {
+	if period == Weekly {
+		return start.AddDate(0, 0, 7)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// Usage is the data transmitted through a source, or to a domain.
+type Usage struct {
+	Name string `json:"name"`
+	Traffic
+}
+
+// Total returns the bytes both sent and received.
+func (u Usage) Total() int64 {
+	return u.Sent + u.Received
+}
+
+// Report is the data transmitted in a time range, by source and by
+// domain, sorted by total usage.
+type Report struct {
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Sources []Usage   `json:"sources"`
+	Domains []Usage   `json:"domains"`
+}
+
+// Report aggregates the samples stored between `from` and `to`.
+func (db *DB) Report(from, to time.Time) (*Report, error) {
+	samples, err := db.Query("", from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make(map[string]Traffic)
+	domains := make(map[string]Traffic)
+	for _, v := range samples {
+		if !v.Time.Before(to) {
+			// Belongs to the next report.
+			continue
+		}
+		add(sources, v.Source, Traffic{Sent: v.Sent, Received: v.Received})
+		for k, d := range v.Domains {
+			add(domains, k, d)
+		}
+	}
+	return &Report{
+		From:    from,
+		To:      to,
+		Sources: sortUsage(sources),
+		Domains: sortUsage(domains),
+	}, nil
+}
+
+// TopDomains returns the `n` domains to which the most data was
+// transmitted through `source` between `from` and `to`, or through
+// any source if `source` is empty. If `n` is not positive, every
+// domain is returned.
+func (db *DB) TopDomains(source string, from, to time.Time, n int) ([]Usage, error) {
+	samples, err := db.Query(source, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	domains := make(map[string]Traffic)
+	for _, v := range samples {
+		if !v.Time.Before(to) {
+			continue
+		}
+		for k, d := range v.Domains {
+			add(domains, k, d)
+		}
+	}
+	acc := sortUsage(domains)
+	if n > 0 && len(acc) > n {
+		acc = acc[:n]
+	}
+	return acc, nil
+}
+
+func add(m map[string]Traffic, k string, t Traffic) {
+	v := m[k]
+	v.Sent += t.Sent
+	v.Received += t.Received
+	m[k] = v
+}
+
+func sortUsage(m map[string]Traffic) []Usage {
+	acc := make([]Usage, 0, len(m))
+	for k, v := range m {
+		acc = append(acc, Usage{Name: k, Traffic: v})
+	}
+	sort.Slice(acc, func(i, j int) bool {
+		if acc[i].Total() != acc[j].Total() {
+			return acc[i].Total() > acc[j].Total()
+		}
+		return acc[i].Name < acc[j].Name
+	})
+	return acc
+}
+
+// ReportDomains is the number of domains listed by WriteText.
+const ReportDomains = 20
+
+// WriteText writes the human readable representation of `r` into `w`.
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Data usage from %v to %v\n", r.From.Format("2006-01-02 15:04"), r.To.Format("2006-01-02 15:04"))
+	table := func(title string, usage []Usage) {
+		fmt.Fprintf(tw, "\n%s\tSENT\tRECEIVED\tTOTAL\n", strings.ToUpper(title))
+		for _, v := range usage {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", v.Name, FormatBytes(v.Sent), FormatBytes(v.Received), FormatBytes(v.Total()))
+		}
+	}
+	table("source", r.Sources)
+	domains := r.Domains
+	if len(domains) > ReportDomains {
+		domains = domains[:ReportDomains]
+	}
+	table("domain", domains)
+	return tw.Flush()
+}
+
+// FormatBytes returns the human readable representation of `n` bytes,
+// e.g. "1.5 MB".
+func FormatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
+
+// Mailer sends messages by email.
+type Mailer interface {
+	Send(ctx context.Context, subject, body string) error
+}
+
+// Reporter produces the report of each Period as soon as it ends,
+// logging it and sending it with Mailer, if not nil.
+type Reporter struct {
+	DB     *DB
+	Period string
+	Mailer Mailer
+}
+
+// Run produces the reports until `ctx` is canceled.
+func (r *Reporter) Run(ctx context.Context) error {
+	start, err := PeriodStart(r.Period, time.Now())
+	if err != nil {
+		return err
+	}
+	for {
+		end := PeriodEnd(r.Period, start)
+		for now := time.Now(); now.Before(end); now = time.Now() {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(end.Sub(now)):
+			}
+		}
+
+		if err := r.send(ctx, start, end); err != nil {
+			log.Error.Printf("History: unable to send the %v report: %v", r.Period, err)
+		}
+		start = end
+	}
+}
+
+func (r *Reporter) send(ctx context.Context, from, to time.Time) error {
+	report, err := r.DB.Report(from, to)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	if err := report.WriteText(&b); err != nil {
+		return err
+	}
+	log.Info.Printf("History: %v report\n%s", r.Period, b.String())
+	if r.Mailer == nil {
+		return nil
+	}
+	subject := fmt.Sprintf("booster %v report, %v", r.Period, from.Format("2006-01-02"))
+	return r.Mailer.Send(ctx, subject, b.String())
+}
@@ -0,0 +1,157 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package history_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/history"
+)
+
+func TestPeriodStart(t *testing.T) {
+	// Friday.
+	now := time.Date(2019, 5, 10, 12, 30, 0, 0, time.UTC)
+	day, _ := history.PeriodStart(history.Daily, now)
+	if !day.Equal(time.Date(2019, 5, 10, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Unexpected start of the day: %v", day)
+	}
+	week, _ := history.PeriodStart(history.Weekly, now)
+	if !week.Equal(time.Date(2019, 5, 6, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Unexpected start of the week: %v", week)
+	}
+	if end := history.PeriodEnd(history.Weekly, week); !end.Equal(time.Date(2019, 5, 13, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Unexpected end of the week: %v", end)
+	}
+	// Sunday belongs to the week that started on Monday.
+	week, _ = history.PeriodStart(history.Weekly, time.Date(2019, 5, 12, 23, 0, 0, 0, time.UTC))
+	if week.Day() != 6 {
+		t.Fatalf("Unexpected start of the week: %v", week)
+	}
+	if _, err := history.PeriodStart("monthly", now); err == nil {
+		t.Fatalf("Expected an error with an unknown period")
+	}
+}
+
+func TestReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "booster-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := history.Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &history.Recorder{DB: db}
+	r.RecordUsage("s0", "example.com:443", 10, 1000)
+	r.RecordUsage("s1", "example.com:443", 5, 500)
+	r.RecordUsage("s1", "foo.org:80", 1, 100)
+
+	now := time.Now()
+	if err := r.Flush(now); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := db.Report(now.Add(-time.Minute), now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Domains) != 2 {
+		t.Fatalf("Unexpected domains: %+v", report.Domains)
+	}
+	if d := report.Domains[0]; d.Name != "example.com" || d.Sent != 15 || d.Received != 1500 {
+		t.Fatalf("Unexpected domain usage: %+v", d)
+	}
+	if len(report.Sources) != 2 {
+		t.Fatalf("Unexpected sources: %+v", report.Sources)
+	}
+
+	var b strings.Builder
+	if err := report.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "example.com") || !strings.Contains(b.String(), "1.5 kB") {
+		t.Fatalf("Unexpected text report:\n%s", b.String())
+	}
+}
+
+func TestRecordUsage_other(t *testing.T) {
+	dir, err := ioutil.TempDir("", "booster-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := history.Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &history.Recorder{DB: db}
+	for i := 0; i < history.MaxDomains+10; i++ {
+		r.RecordUsage("s0", strings.Repeat("a", i+1)+".com:443", 0, 1)
+	}
+	now := time.Now()
+	if err := r.Flush(now); err != nil {
+		t.Fatal(err)
+	}
+	acc, _ := db.Query("s0", now.Add(-time.Minute), now.Add(time.Minute))
+	if len(acc) != 1 || len(acc[0].Domains) != history.MaxDomains {
+		t.Fatalf("Unexpected samples: %+v", acc)
+	}
+	if o := acc[0].Domains[history.OtherDomain]; o.Received == 0 {
+		t.Fatalf("The domains in excess were not accounted to %v", history.OtherDomain)
+	}
+}
+
+func TestTopDomains(t *testing.T) {
+	dir, err := ioutil.TempDir("", "booster-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := history.Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &history.Recorder{DB: db}
+	r.RecordUsage("lte", "video.example.com:443", 0, 5000)
+	r.RecordUsage("lte", "mail.example.com:443", 0, 10)
+	r.RecordUsage("lte", "news.example.com:443", 0, 100)
+	r.RecordUsage("wifi", "backup.example.com:443", 100000, 0)
+
+	now := time.Now()
+	if err := r.Flush(now); err != nil {
+		t.Fatal(err)
+	}
+
+	acc, err := db.TopDomains("lte", now.Add(-time.Minute), now.Add(time.Minute), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(acc) != 2 || acc[0].Name != "video.example.com" || acc[1].Name != "news.example.com" {
+		t.Fatalf("Unexpected domains: %+v", acc)
+	}
+	acc, _ = db.TopDomains("", now.Add(-time.Minute), now.Add(time.Minute), 0)
+	if len(acc) != 4 || acc[0].Name != "backup.example.com" {
+		t.Fatalf("Unexpected domains: %+v", acc)
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package influx provides a metrics sink that periodically pushes the
+// per-source counters and gauges to InfluxDB, or to a Telegraf socket
+// listener, using the line protocol.
+package influx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/booster-proj/booster/source"
+	"upspin.io/log"
+)
+
+// DefaultInterval is the default push interval.
+const DefaultInterval = time.Second * 10
+
+// Measurement is the name of the measurement written.
+const Measurement = "booster_source"
+
+// Exporter is the set of hooks the Sink collects its data from.
+type Exporter interface {
+	source.MetricsExporter
+	SetProbeStats(labels map[string]string, rtt time.Duration, loss float64)
+}
+
+type stats struct {
+	sent, received int64
+	conns          int
+	rtt            time.Duration
+	loss           float64
+	probed         bool
+}
+
+// Sink is an Exporter that accumulates the data it receives,
+// forwarding it to Next if not nil, and pushes it to URL every
+// Interval.
+//
+// URL is either an InfluxDB write endpoint, e.g.
+// `http://localhost:8086/write?db=booster` (1.x) or
+// `http://localhost:8086/api/v2/write?org=o&bucket=b` (2.x), or
+// the address of a Telegraf socket listener, e.g.
+// `udp://localhost:8094`, `tcp://localhost:8094` or
+// `unix:///tmp/telegraf.sock`.
+type Sink struct {
+	URL string
+	// Token, if set, is sent as authorization token to InfluxDB.
+	Token    string
+	Interval time.Duration
+	// Tags are added to each point written, e.g. host=foo.
+	Tags map[string]string
+	Next Exporter
+
+	mux   sync.Mutex
+	stats map[string]*stats
+}
+
+func (s *Sink) get(id string) *stats {
+	if s.stats == nil {
+		s.stats = make(map[string]*stats)
+	}
+	st, ok := s.stats[id]
+	if !ok {
+		st = &stats{}
+		s.stats[id] = st
+	}
+	return st
+}
+
+// SendDataFlow implements Exporter.
+func (s *Sink) SendDataFlow(labels map[string]string, data *source.DataFlow) {
+	s.mux.Lock()
+	st := s.get(labels["source"])
+	switch data.Type {
+	case "read":
+		st.received += int64(data.N)
+	case "write":
+		st.sent += int64(data.N)
+	}
+	s.mux.Unlock()
+
+	if s.Next != nil {
+		s.Next.SendDataFlow(labels, data)
+	}
+}
+
+// CountOpenConn implements Exporter.
+func (s *Sink) CountOpenConn(labels map[string]string, inc int) {
+	s.mux.Lock()
+	s.get(labels["source"]).conns += inc
+	s.mux.Unlock()
+
+	if s.Next != nil {
+		s.Next.CountOpenConn(labels, inc)
+	}
+}
+
+// SetProbeStats implements Exporter.
+func (s *Sink) SetProbeStats(labels map[string]string, rtt time.Duration, loss float64) {
+	s.mux.Lock()
+	st := s.get(labels["source"])
+	st.rtt, st.loss, st.probed = rtt, loss, true
+	s.mux.Unlock()
+
+	if s.Next != nil {
+		s.Next.SetProbeStats(labels, rtt, loss)
+	}
+}
+
+// AddLatency implements Exporter.
+func (s *Sink) AddLatency(labels map[string]string, d time.Duration) {
+	if s.Next != nil {
+		s.Next.AddLatency(labels, d)
+	}
+}
+
+// CountPort implements Exporter.
+func (s *Sink) CountPort(labels map[string]string, inc int) {
+	if s.Next != nil {
+		s.Next.CountPort(labels, inc)
+	}
+}
+
+var tagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// Lines returns the line protocol representation of the current
+// state of the sources, timestamped with `now`.
+func (s *Sink) Lines(now time.Time) []byte {
+	tags := make([]string, 0, len(s.Tags))
+	for k, v := range s.Tags {
+		tags = append(tags, tagEscaper.Replace(k)+"="+tagEscaper.Replace(v))
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	ids := make([]string, 0, len(s.stats))
+	for id := range s.stats {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var buf bytes.Buffer
+	for _, id := range ids {
+		st := s.stats[id]
+		// Tags must be sorted by key for best performance.
+		t := append([]string{"source=" + tagEscaper.Replace(id)}, tags...)
+		sort.Strings(t)
+		fmt.Fprintf(&buf, "%s,%s sent=%di,received=%di,open_conns=%di", Measurement, strings.Join(t, ","), st.sent, st.received, st.conns)
+		if st.probed {
+			fmt.Fprintf(&buf, ",rtt_ms=%g,loss=%g", float64(st.rtt)/float64(time.Millisecond), st.loss)
+		}
+		fmt.Fprintf(&buf, " %d\n", now.UnixNano())
+	}
+	return buf.Bytes()
+}
+
+// Push writes the current state of the sources to URL.
+func (s *Sink) Push(ctx context.Context) error {
+	lines := s.Lines(time.Now())
+	if len(lines) == 0 {
+		return nil
+	}
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return s.post(ctx, lines)
+	case "udp", "tcp":
+		return s.write(ctx, u.Scheme, u.Host, lines)
+	case "unix", "unixgram":
+		return s.write(ctx, u.Scheme, u.Path, lines)
+	default:
+		return fmt.Errorf("influx: unsupported url scheme %q", u.Scheme)
+	}
+}
+
+func (s *Sink) post(ctx context.Context, lines []byte) error {
+	req, err := http.NewRequest("POST", s.URL, bytes.NewReader(lines))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.Token)
+	}
+	// Make sure that the precision matches the timestamps.
+	q := req.URL.Query()
+	if q.Get("precision") == "" {
+		q.Set("precision", "ns")
+		req.URL.RawQuery = q.Encode()
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("influx: write failed: %s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+	return nil
+}
+
+func (s *Sink) write(ctx context.Context, network, address string, lines []byte) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if network == "tcp" || network == "unix" {
+		_, err = conn.Write(lines)
+		return err
+	}
+	// Datagram sockets: send one point per packet, avoiding to
+	// exceed the maximum datagram size.
+	for _, l := range bytes.SplitAfter(lines, []byte("\n")) {
+		if len(l) == 0 {
+			continue
+		}
+		if _, err := conn.Write(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run pushes the metrics every Interval, until the context is
+// canceled.
+func (s *Sink) Run(ctx context.Context) error {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			_ctx, cancel := context.WithTimeout(ctx, interval)
+			if err := s.Push(_ctx); err != nil {
+				log.Error.Printf("Influx: %v", err)
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package influx_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/influx"
+	"github.com/booster-proj/booster/source"
+)
+
+func fill(s *influx.Sink) {
+	labels := map[string]string{"source": "en0", "target": "host:443"}
+	s.SendDataFlow(labels, &source.DataFlow{Type: "read", N: 10})
+	s.SendDataFlow(labels, &source.DataFlow{Type: "write", N: 4})
+	s.CountOpenConn(labels, 1)
+	s.SetProbeStats(map[string]string{"source": "en0"}, time.Millisecond*15, 0.25)
+}
+
+func TestLines(t *testing.T) {
+	s := &influx.Sink{Tags: map[string]string{"host": "my host"}}
+	fill(s)
+
+	lines := string(s.Lines(time.Unix(0, 42)))
+	want := `booster_source,host=my\ host,source=en0 sent=4i,received=10i,open_conns=1i,rtt_ms=15,loss=0.25 42` + "\n"
+	if lines != want {
+		t.Fatalf("Unexpected lines:\nwanted %q\nfound  %q", want, lines)
+	}
+}
+
+func TestPush_http(t *testing.T) {
+	var body, auth, precision string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		auth = r.Header.Get("Authorization")
+		precision = r.URL.Query().Get("precision")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	s := &influx.Sink{URL: srv.URL + "/write?db=booster", Token: "secret"}
+	fill(s)
+	if err := s.Push(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(body, "booster_source,source=en0 ") {
+		t.Fatalf("Unexpected body: %q", body)
+	}
+	if auth != "Token secret" || precision != "ns" {
+		t.Fatalf("Unexpected request: auth %q, precision %q", auth, precision)
+	}
+}
+
+func TestPush_udp(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	s := &influx.Sink{URL: "udp://" + conn.LocalAddr().String()}
+	fill(s)
+	if err := s.Push(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(buf[:n]), "booster_source,source=en0 ") {
+		t.Fatalf("Unexpected packet: %q", buf[:n])
+	}
+}
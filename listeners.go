@@ -0,0 +1,193 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package booster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/booster-proj/booster/acl"
+	"github.com/booster-proj/booster/crash"
+	"github.com/booster-proj/booster/dialer"
+	"github.com/booster-proj/booster/gateway"
+	"github.com/booster-proj/booster/metrics"
+	"github.com/booster-proj/booster/proxyproto"
+	"github.com/booster-proj/booster/relay"
+	"github.com/booster-proj/booster/socks"
+	"github.com/booster-proj/booster/store"
+	"github.com/booster-proj/booster/turbo"
+	"github.com/booster-proj/booster/websocket"
+	"golang.org/x/sync/errgroup"
+	"upspin.io/log"
+)
+
+// initProxies builds the proxies enabled by the configuration: the
+// SOCKS5 ones, the turbo, the tunnel and the transparent proxies.
+func (bst *Booster) initProxies(exp *metrics.Exporter, crashes *crash.Reporter) error {
+	c := bst.conf
+	d := bst.dialer
+	rs := bst.store
+
+	if c.TunnelPort > 0 && !strings.HasPrefix(c.TunnelPath, "/") {
+		return errors.New("the tunnel requires a path, starting with /, use --tunnel-path")
+	}
+	if (c.ProxyTLSPort > 0 || c.TurboTLS || c.TunnelTLS) && c.APITLS == nil {
+		return errors.New("the proxies over TLS use the certificates of the API, use --api-tls-cert or --api-acme-host")
+	}
+	trusted, err := acl.ParseNetworks(c.ProxyProtocol)
+	if err != nil {
+		return fmt.Errorf("%v, use --proxy-protocol", err)
+	}
+	if c.TurboPort > 0 || c.TurboListener != nil {
+		bst.turbo = &turbo.Proxy{
+			Store:           rs,
+			Dialer:          d,
+			MinSize:         c.TurboMinSize,
+			Segments:        c.TurboSegments,
+			MatchProcesses:  c.MatchProcesses,
+			MetricsExporter: exp,
+			Buffers:         &relay.Pool{Size: c.BufferSize, MetricsExporter: exp},
+			ProxyProtocol:   trusted,
+			ACL:             bst.acl,
+			Schedules:       bst.sched,
+			Crashes:         crashes,
+		}
+		if c.TurboTLS {
+			if bst.turbo.TLS, _, err = c.APITLS.Config(); err != nil {
+				return err
+			}
+		}
+	}
+	bst.proxy = &socks.Proxy{
+		Dialer:        d,
+		Buffers:       &relay.Pool{Size: c.BufferSize, MetricsExporter: exp},
+		ACL:           bst.acl,
+		Schedules:     bst.sched,
+		ProxyProtocol: trusted,
+	}
+	if c.ProxyTLSPort > 0 {
+		if bst.proxyTLS, _, err = c.APITLS.Config(); err != nil {
+			return err
+		}
+	}
+	if c.TunnelPort > 0 {
+		bst.tunnel = &websocket.Server{Path: c.TunnelPath, Handle: bst.proxy.Handle}
+		if c.TunnelTLS {
+			if bst.tunnel.TLS, _, err = c.APITLS.Config(); err != nil {
+				return err
+			}
+		}
+	}
+	if c.GatewayPort > 0 {
+		bst.gateway = &gateway.Proxy{
+			Dialer:    d,
+			Buffers:   &relay.Pool{Size: c.BufferSize, MetricsExporter: exp},
+			ACL:       bst.acl,
+			Schedules: bst.sched,
+		}
+	}
+
+	for _, v := range c.Listeners {
+		bst.listeners = append(bst.listeners, &socks.Proxy{
+			Dialer:        scoped{Dialer: d, scope: v.Name},
+			Buffers:       bst.proxy.Buffers,
+			ACL:           bst.acl,
+			Schedules:     bst.sched,
+			ProxyProtocol: trusted,
+		})
+	}
+	return nil
+}
+
+// scoped dials the connections of a listener within its scope.
+type scoped struct {
+	*dialer.Dialer
+	scope string
+}
+
+func (d scoped) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return d.Dialer.DialContext(store.WithScope(ctx, d.scope), network, address)
+}
+
+// serveProxies serves the proxies built by initProxies in `g`.
+func (bst *Booster) serveProxies(ctx context.Context, g *errgroup.Group) {
+	c := bst.conf
+	if c.ProxyPort > 0 {
+		g.Go(labeled(ctx, "proxy", func() error {
+			log.Info.Printf("Booster proxy (%v) listening on :%d", bst.proxy.Protocol(), c.ProxyPort)
+			defer log.Info.Print("Booster proxy stopped.")
+			return bst.proxy.ListenAndServe(ctx, c.ProxyPort)
+		}))
+	}
+	if c.ProxyTLSPort > 0 {
+		g.Go(labeled(ctx, "proxy", func() error {
+			ln, err := net.Listen("tcp", fmt.Sprintf(":%d", c.ProxyTLSPort))
+			if err != nil {
+				return err
+			}
+			log.Info.Printf("Booster proxy (%v over TLS) listening on :%d", bst.proxy.Protocol(), c.ProxyTLSPort)
+			defer log.Info.Print("Booster proxy over TLS stopped.")
+			return bst.proxy.ServeTLS(ctx, ln, bst.proxyTLS)
+		}))
+	}
+	if ws := bst.tunnel; ws != nil {
+		g.Go(labeled(ctx, "proxy", func() error {
+			ln, err := net.Listen("tcp", fmt.Sprintf(":%d", c.TunnelPort))
+			if err != nil {
+				return err
+			}
+			if trusted := bst.proxy.ProxyProtocol; len(trusted) > 0 {
+				ln = &proxyproto.Listener{Listener: ln, Trusted: trusted}
+			}
+			log.Info.Printf("Booster tunnel (WebSocket) listening on :%d", c.TunnelPort)
+			defer log.Info.Print("Booster tunnel stopped.")
+			return ws.Serve(ctx, ln)
+		}))
+	}
+	if gw := bst.gateway; gw != nil {
+		g.Go(labeled(ctx, "proxy", func() error {
+			ln, err := net.Listen("tcp", fmt.Sprintf(":%d", c.GatewayPort))
+			if err != nil {
+				return err
+			}
+			log.Info.Printf("Booster transparent proxy listening on :%d", c.GatewayPort)
+			defer log.Info.Print("Booster transparent proxy stopped.")
+			return gw.Serve(ctx, ln)
+		}))
+	}
+	for i, v := range c.Listeners {
+		lp, v := bst.listeners[i], v
+		g.Go(labeled(ctx, "proxy", func() error {
+			log.Info.Printf("Booster proxy %s (%v) listening on :%d", v.Name, lp.Protocol(), v.Port)
+			defer log.Info.Printf("Booster proxy %s stopped.", v.Name)
+			return lp.ListenAndServe(ctx, v.Port)
+		}))
+	}
+	if tp := bst.turbo; tp != nil {
+		g.Go(labeled(ctx, "turbo", func() error {
+			defer log.Info.Print("Booster turbo HTTP proxy stopped.")
+			if ln := c.TurboListener; ln != nil {
+				log.Info.Printf("Booster turbo HTTP proxy listening on %v", ln.Addr())
+				return tp.Serve(ctx, ln)
+			}
+			log.Info.Printf("Booster turbo HTTP proxy listening on :%d", c.TurboPort)
+			return tp.ListenAndServe(ctx, c.TurboPort)
+		}))
+	}
+}
@@ -0,0 +1,442 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package loadtest drives connections through the full booster stack:
+// clients open tunnels through the turbo HTTP proxy, which dials them
+// with the booster dialer, using the sources selected by a source
+// store. The sources are synthetic, and connect to a local echo server.
+// Faults can be injected into them, see package chaos.
+// Run measures connection setup and source selection latency, data
+// throughput and the memory allocated in the meanwhile.
+package loadtest
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/booster-proj/booster/chaos"
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/dialer"
+	"github.com/booster-proj/booster/relay"
+	"github.com/booster-proj/booster/store"
+	"github.com/booster-proj/booster/store/bench"
+	"github.com/booster-proj/booster/turbo"
+)
+
+// Config describes the workload produced by Run.
+type Config struct {
+	// Sources is the number of synthetic sources stored.
+	Sources int
+	// Conns is the total number of connections opened by the
+	// clients.
+	Conns int
+	// Concurrency is the number of clients opening connections
+	// concurrently.
+	Concurrency int
+	// Size is the number of bytes sent, and received back, on each
+	// connection.
+	Size int
+	// Latency is added by the synthetic sources to every dial.
+	Latency time.Duration
+	// BufferSize is the size of the buffers used by the proxy to
+	// relay data. If 0, relay.DefaultBufferSize is used.
+	BufferSize int
+	// Timeout is the maximum amount of time a connection may take,
+	// including the transfer.
+	Timeout time.Duration
+
+	// Faults are injected into the sources with the identifiers
+	// used as keys, i.e. s0, s1, ... See package chaos.
+	Faults map[string]chaos.Faults
+	// Seed initializes the generator used to choose the faults.
+	Seed int64
+}
+
+// DefaultConfig is the configuration used when a zero value field is found.
+var DefaultConfig = Config{
+	Sources:     4,
+	Conns:       2000,
+	Concurrency: 64,
+	Size:        64 << 10,
+	Timeout:     time.Second * 10,
+}
+
+func (c Config) withDefaults() Config {
+	if c.Sources <= 0 {
+		c.Sources = DefaultConfig.Sources
+	}
+	if c.Conns <= 0 {
+		c.Conns = DefaultConfig.Conns
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = DefaultConfig.Concurrency
+	}
+	if c.Size < 0 {
+		c.Size = 0
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultConfig.Timeout
+	}
+	return c
+}
+
+// Allocs describes the memory allocated during a run.
+type Allocs struct {
+	// Mallocs is the number of heap objects allocated.
+	Mallocs uint64 `json:"mallocs"`
+	// Bytes is the amount of heap memory allocated.
+	Bytes uint64 `json:"bytes"`
+	// GC is the number of garbage collections completed.
+	GC uint32 `json:"gc"`
+}
+
+// Result is the outcome of a Run.
+type Result struct {
+	Config  Config        `json:"config"`
+	Elapsed time.Duration `json:"elapsed"`
+	// Connect is the time taken to establish the tunnels, from the
+	// dial of the proxy to the reception of its response.
+	Connect bench.Stats `json:"connect"`
+	// Select is the time taken by the store to select the sources.
+	Select bench.Stats `json:"select"`
+	// Transfer is the time taken to send and receive the data on
+	// each connection.
+	Transfer bench.Stats `json:"transfer"`
+	// Bytes is the amount of data received back by the clients.
+	Bytes   int64          `json:"bytes"`
+	Allocs  Allocs         `json:"allocs"`
+	Sources map[string]int `json:"sources"`
+	// Faults are the faults injected into each faulty source.
+	Faults map[string]chaos.Stats `json:"faults,omitempty"`
+}
+
+// ConnsPerSecond returns the connection throughput measured in the run.
+func (r *Result) ConnsPerSecond() float64 {
+	if r.Elapsed == 0 {
+		return 0
+	}
+	return float64(r.Connect.Ops) / r.Elapsed.Seconds()
+}
+
+// BytesPerSecond returns the data throughput measured in the run,
+// i.e. the data sent and received back by the clients.
+func (r *Result) BytesPerSecond() float64 {
+	if r.Elapsed == 0 {
+		return 0
+	}
+	return float64(r.Bytes*2) / r.Elapsed.Seconds()
+}
+
+// Fprint writes a human readable report of r into w.
+func (r *Result) Fprint(w io.Writer) {
+	c := r.Config
+	fmt.Fprintf(w, "sources=%d conns=%d concurrency=%d size=%d latency=%v\n",
+		c.Sources, c.Conns, c.Concurrency, c.Size, c.Latency)
+	fmt.Fprintf(w, "elapsed=%v conns/s=%.0f MB/s=%.2f\n", r.Elapsed, r.ConnsPerSecond(), r.BytesPerSecond()/1e6)
+	bench.FprintStats(w, "connect", r.Connect)
+	bench.FprintStats(w, "select", r.Select)
+	bench.FprintStats(w, "transfer", r.Transfer)
+	fmt.Fprintf(w, "allocs     mallocs=%d bytes=%d gc=%d (%.0f mallocs/conn)\n",
+		r.Allocs.Mallocs, r.Allocs.Bytes, r.Allocs.GC, float64(r.Allocs.Mallocs)/float64(c.Conns))
+	for i := 0; i < c.Sources; i++ {
+		id := sourceID(i)
+		fmt.Fprintf(w, "source     %-8s conns=%d", id, r.Sources[id])
+		if f, ok := r.Faults[id]; ok {
+			fmt.Fprintf(w, " dials=%d dial_errors=%d dial_drops=%d transfer_errors=%d",
+				f.Dials, f.DialErrors, f.DialDrops, f.TransferErrors)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// Run builds the stack described by c and measures its performance.
+// It returns early with ctx's error if the context is canceled.
+func Run(ctx context.Context, c Config) (*Result, error) {
+	c = c.withDefaults()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The echo server reached by the sources.
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	defer echo.Close()
+	go serveEcho(echo)
+
+	synth := make([]*source, c.Sources)
+	sources := make([]core.Source, c.Sources)
+	faulty := make(map[string]*chaos.Source)
+	for i := range sources {
+		synth[i] = &source{id: sourceID(i), latency: c.Latency}
+		sources[i] = synth[i]
+		if f, ok := c.Faults[synth[i].id]; ok {
+			cs := chaos.New(synth[i], f, c.Seed+int64(i))
+			faulty[cs.ID()] = cs
+			sources[i] = cs
+		}
+	}
+	s := store.New(new(core.Balancer))
+	s.Put(sources...)
+
+	b := &balancer{SourceStore: s}
+	p := &turbo.Proxy{
+		Store:   s,
+		Dialer:  dialer.New(b),
+		Buffers: &relay.Pool{Size: c.BufferSize},
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	go p.Serve(ctx, ln)
+
+	res := &Result{Config: c, Sources: make(map[string]int)}
+	jobs := make(chan struct{})
+	go func() {
+		defer close(jobs)
+		for i := 0; i < c.Conns; i++ {
+			select {
+			case jobs <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var mux sync.Mutex
+	var connect, transfer []time.Duration
+	var connectErrs, transferErrs int
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < c.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				// Failures are expected when faults are injected:
+				// count them and move on.
+				t, err := tunnel(ctx, ln.Addr().String(), echo.Addr().String(), c.Size, c.Timeout)
+				if ctx.Err() != nil {
+					return
+				}
+				mux.Lock()
+				switch {
+				case !t.connected:
+					connectErrs++
+				case err != nil:
+					connect = append(connect, t.connect)
+					transferErrs++
+				default:
+					connect = append(connect, t.connect)
+					transfer = append(transfer, t.transfer)
+				}
+				res.Bytes += t.n
+				mux.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	res.Elapsed = time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	res.Connect = bench.MakeStats(connect)
+	res.Connect.Errors = connectErrs
+	res.Transfer = bench.MakeStats(transfer)
+	res.Transfer.Errors = transferErrs
+	res.Select = bench.MakeStats(b.durations())
+	res.Allocs = Allocs{
+		Mallocs: after.Mallocs - before.Mallocs,
+		Bytes:   after.TotalAlloc - before.TotalAlloc,
+		GC:      after.NumGC - before.NumGC,
+	}
+	for _, v := range synth {
+		res.Sources[v.id] = v.count()
+	}
+	if len(faulty) > 0 {
+		res.Faults = make(map[string]chaos.Stats)
+		for id, v := range faulty {
+			res.Faults[id] = v.Stats()
+		}
+	}
+	return res, nil
+}
+
+// timings describes how a tunnel went.
+type timings struct {
+	connected bool
+	connect   time.Duration
+	transfer  time.Duration
+	n         int64
+}
+
+// tunnel opens a tunnel to `target` through the proxy listening on
+// `proxy`, sends `size` bytes and reads them back, in at most
+// `timeout`.
+func tunnel(ctx context.Context, proxy, target string, size int, timeout time.Duration) (timings, error) {
+	var t timings
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var d net.Dialer
+	t0 := time.Now()
+	conn, err := d.DialContext(ctx, "tcp", proxy)
+	if err != nil {
+		return t, err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		return t, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return t, fmt.Errorf("loadtest: unexpected proxy response: %v", resp.Status)
+	}
+	t.connected = true
+	t.connect = time.Since(t0)
+
+	t0 = time.Now()
+	errc := make(chan error, 1)
+	go func() {
+		_, err := io.CopyN(conn, zeros{}, int64(size))
+		errc <- err
+	}()
+	t.n, err = io.CopyN(io.Discard, br, int64(size))
+	if err != nil {
+		return t, err
+	}
+	if err := <-errc; err != nil {
+		return t, err
+	}
+	t.transfer = time.Since(t0)
+	return t, nil
+}
+
+func serveEcho(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			io.Copy(conn, conn)
+		}()
+	}
+}
+
+// balancer records how long the store takes to select the sources.
+type balancer struct {
+	*store.SourceStore
+
+	mux sync.Mutex
+	val []time.Duration
+}
+
+func (b *balancer) Get(ctx context.Context, target string, blacklisted ...core.Source) (core.Source, error) {
+	t0 := time.Now()
+	src, err := b.SourceStore.Get(ctx, target, blacklisted...)
+	d := time.Since(t0)
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.val = append(b.val, d)
+	return src, err
+}
+
+func (b *balancer) durations() []time.Duration {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.val
+}
+
+func sourceID(i int) string {
+	return fmt.Sprintf("s%d", i)
+}
+
+// source is a core.Source that dials the connections on the loopback
+// interface, after waiting `latency`.
+type source struct {
+	id      string
+	latency time.Duration
+
+	mux   sync.Mutex
+	conns int
+}
+
+func (s *source) ID() string {
+	return s.id
+}
+
+func (s *source) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if s.latency > 0 {
+		select {
+		case <-time.After(s.latency):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	s.mux.Lock()
+	s.conns++
+	s.mux.Unlock()
+
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", address)
+}
+
+func (s *source) count() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.conns
+}
+
+func (s *source) Close() error {
+	return nil
+}
+
+func (s *source) String() string {
+	return s.id
+}
+
+// zeros is an io.Reader that never ends, producing zeros.
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
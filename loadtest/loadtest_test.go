@@ -0,0 +1,120 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package loadtest_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/booster-proj/booster/chaos"
+	"github.com/booster-proj/booster/loadtest"
+)
+
+func TestRun(t *testing.T) {
+	c := loadtest.Config{
+		Sources:     3,
+		Conns:       60,
+		Concurrency: 4,
+		Size:        128 << 10,
+	}
+	res, err := loadtest.Run(context.Background(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Connect.Ops != c.Conns {
+		t.Fatalf("Unexpected connections: wanted %d, found %d", c.Conns, res.Connect.Ops)
+	}
+	if res.Select.Ops != c.Conns {
+		t.Fatalf("Unexpected selections: wanted %d, found %d", c.Conns, res.Select.Ops)
+	}
+	if want := int64(c.Conns * c.Size); res.Bytes != want {
+		t.Fatalf("Unexpected data received: wanted %d, found %d", want, res.Bytes)
+	}
+	var n int
+	for id, v := range res.Sources {
+		if v == 0 {
+			t.Fatalf("Source %s was never used", id)
+		}
+		n += v
+	}
+	if n != c.Conns {
+		t.Fatalf("Unexpected connections dialed by the sources: wanted %d, found %d", c.Conns, n)
+	}
+	if res.Allocs.Mallocs == 0 {
+		t.Fatalf("Allocations were not measured")
+	}
+
+	var buf bytes.Buffer
+	res.Fprint(&buf)
+	t.Log(buf.String())
+}
+
+func TestRun_faults(t *testing.T) {
+	c := loadtest.Config{
+		Sources:     2,
+		Conns:       40,
+		Concurrency: 4,
+		Size:        1 << 10,
+		Faults: map[string]chaos.Faults{
+			"s0": {DialError: 1},
+		},
+	}
+	res, err := loadtest.Run(context.Background(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every connection fails over to the healthy source.
+	if res.Connect.Ops != c.Conns || res.Connect.Errors != 0 {
+		t.Fatalf("Unexpected connections: %+v", res.Connect)
+	}
+	if res.Sources["s0"] != 0 || res.Sources["s1"] != c.Conns {
+		t.Fatalf("Unexpected connections dialed by the sources: %v", res.Sources)
+	}
+	if f := res.Faults["s0"]; f.DialErrors == 0 || f.DialErrors != f.Dials {
+		t.Fatalf("Unexpected faults injected: %+v", f)
+	}
+}
+
+func TestRun_transferFaults(t *testing.T) {
+	c := loadtest.Config{
+		Sources:     1,
+		Conns:       20,
+		Concurrency: 2,
+		Size:        1 << 10,
+		Faults: map[string]chaos.Faults{
+			"s0": {TransferError: 1},
+		},
+	}
+	res, err := loadtest.Run(context.Background(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Transfer.Errors != c.Conns {
+		t.Fatalf("Unexpected transfer errors: wanted %d, found %d", c.Conns, res.Transfer.Errors)
+	}
+}
+
+func TestRun_cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := loadtest.Run(ctx, loadtest.Config{}); err == nil {
+		t.Fatalf("Run did not fail with a canceled context")
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package logging provides a structured logger, registered as external
+// logger of upspin.io/log, which prints its messages either as text or
+// as JSON objects, with levels configurable per module at runtime.
+//
+// The module of a message is the prefix that booster components use
+// in their messages, e.g. "SourceStore" in "SourceStore: policy ...".
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"upspin.io/log"
+)
+
+// Output formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var levelNames = map[log.Level]string{
+	log.DebugLevel:    "debug",
+	log.InfoLevel:     "info",
+	log.ErrorLevel:    "error",
+	log.DisabledLevel: "disabled",
+}
+
+// ParseLevel returns the level named `s`.
+func ParseLevel(s string) (log.Level, error) {
+	for k, v := range levelNames {
+		if v == s {
+			return k, nil
+		}
+	}
+	return log.DisabledLevel, fmt.Errorf("logging: unknown level %q", s)
+}
+
+// Logger is an implementation of log.ExternalLogger.
+type Logger struct {
+	mux        sync.Mutex
+	w          io.Writer
+	format     string
+	timestamps bool
+	level      log.Level
+	modules    map[string]log.Level
+}
+
+// New returns a Logger that writes to `w` using `format`, printing
+// the messages at level `level` or higher. If `timestamps` is false,
+// text messages do not contain the time, which is useful when the
+// output is collected by a daemon that adds it by itself.
+func New(w io.Writer, format string, level log.Level, timestamps bool) (*Logger, error) {
+	if format != FormatText && format != FormatJSON {
+		return nil, fmt.Errorf("logging: unknown format %q", format)
+	}
+	return &Logger{
+		w:          w,
+		format:     format,
+		timestamps: timestamps,
+		level:      level,
+		modules:    make(map[string]log.Level),
+	}, nil
+}
+
+// Install makes `l` the only destination of the messages logged
+// with upspin.io/log.
+func Install(l *Logger) {
+	log.SetOutput(nil)
+	log.Register(l)
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.updateLevel()
+}
+
+// updateLevel makes upspin.io/log forward the messages of the lowest
+// level enabled. Must be called with the lock held.
+func (l *Logger) updateLevel() {
+	min := l.level
+	for _, v := range l.modules {
+		if v < min {
+			min = v
+		}
+	}
+	log.SetLevel(levelNames[min])
+}
+
+// Module returns the module of `msg`, if any, and the rest of it.
+func Module(msg string) (string, string) {
+	i := strings.Index(msg, ": ")
+	if i <= 0 || strings.ContainsAny(msg[:i], " \t\n") {
+		return "", msg
+	}
+	return msg[:i], msg[i+2:]
+}
+
+// SetLevel sets the level of `module`. If module is empty, the
+// default level is set instead. Use ResetLevel to make a module
+// use the default level again.
+func (l *Logger) SetLevel(module string, level log.Level) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if module == "" {
+		l.level = level
+	} else {
+		l.modules[module] = level
+	}
+	l.updateLevel()
+}
+
+// ResetLevel makes `module` use the default level.
+func (l *Logger) ResetLevel(module string) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	delete(l.modules, module)
+	l.updateLevel()
+}
+
+// Levels returns the default level and the level of each module
+// configured.
+func (l *Logger) Levels() (string, map[string]string) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	acc := make(map[string]string, len(l.modules))
+	for k, v := range l.modules {
+		acc[k] = levelNames[v]
+	}
+	return levelNames[l.level], acc
+}
+
+// Log implements log.ExternalLogger.
+func (l *Logger) Log(level log.Level, msg string) {
+	module, text := Module(strings.TrimRight(msg, "\n"))
+	now := time.Now()
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	min := l.level
+	if v, ok := l.modules[module]; ok && module != "" {
+		min = v
+	}
+	if level < min {
+		return
+	}
+
+	switch l.format {
+	case FormatJSON:
+		b, _ := json.Marshal(struct {
+			Time   time.Time `json:"time"`
+			Level  string    `json:"level"`
+			Module string    `json:"module,omitempty"`
+			Msg    string    `json:"msg"`
+		}{
+			Time:   now,
+			Level:  levelNames[level],
+			Module: module,
+			Msg:    text,
+		})
+		l.w.Write(append(b, '\n'))
+	default:
+		line := msg
+		if !strings.HasSuffix(line, "\n") {
+			line += "\n"
+		}
+		if l.timestamps {
+			line = now.Format("2006/01/02 15:04:05 ") + line
+		}
+		io.WriteString(l.w, line)
+	}
+}
+
+// Flush implements log.ExternalLogger.
+func (l *Logger) Flush() {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if s, ok := l.w.(interface{ Sync() error }); ok {
+		s.Sync()
+	}
+}
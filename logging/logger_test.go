@@ -0,0 +1,105 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/booster-proj/booster/logging"
+	"upspin.io/log"
+)
+
+func TestModule(t *testing.T) {
+	tt := []struct {
+		in, module, msg string
+	}{
+		{in: "SourceStore: foo: bar", module: "SourceStore", msg: "foo: bar"},
+		{in: "Unable to dial: foo", module: "", msg: "Unable to dial: foo"},
+		{in: "no module", module: "", msg: "no module"},
+	}
+	for i, v := range tt {
+		module, msg := logging.Module(v.in)
+		if module != v.module || msg != v.msg {
+			t.Fatalf("%d: unexpected module/message: %q %q", i, module, msg)
+		}
+	}
+}
+
+func TestLog(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := logging.New(&buf, logging.FormatJSON, log.InfoLevel, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.SetLevel("Listener", log.DebugLevel)
+	l.SetLevel("NAT", log.ErrorLevel)
+
+	l.Log(log.DebugLevel, "Listener: poll")
+	l.Log(log.DebugLevel, "SourceStore: hidden")
+	l.Log(log.InfoLevel, "NAT: hidden")
+	l.Log(log.InfoLevel, "started")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Unexpected lines: %q", lines)
+	}
+	var entry struct {
+		Level, Module, Msg string
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Level != "debug" || entry.Module != "Listener" || entry.Msg != "poll" {
+		t.Fatalf("Unexpected entry: %+v", entry)
+	}
+
+	l.ResetLevel("NAT")
+	if def, modules := l.Levels(); def != "info" || len(modules) != 1 {
+		t.Fatalf("Unexpected levels: %v %v", def, modules)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "booster-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "booster.log")
+	f := &logging.RotatingFile{Path: path, MaxSize: 10, MaxBackups: 2}
+	defer f.Close()
+	for i := 0; i < 5; i++ {
+		if _, err := f.Write([]byte("12345678\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 2 {
+		t.Fatalf("Unexpected backups: %v", backups)
+	}
+	b, _ := ioutil.ReadFile(path)
+	if string(b) != "12345678\n" {
+		t.Fatalf("Unexpected content: %q", b)
+	}
+}
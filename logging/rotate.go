@@ -0,0 +1,161 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RotatingFile is an io.Writer that writes to the file at Path,
+// rotating it when it exceeds MaxSize bytes or is older than MaxAge.
+// Rotated files are renamed adding a timestamp suffix to Path; only
+// the last MaxBackups of them are kept.
+type RotatingFile struct {
+	Path string
+	// If 0, the file is not rotated by size.
+	MaxSize int64
+	// If 0, the file is not rotated by age.
+	MaxAge time.Duration
+	// If 0, all rotated files are kept.
+	MaxBackups int
+
+	mux     sync.Mutex
+	f       *os.File
+	size    int64
+	created time.Time
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f = f
+	r.size = info.Size()
+	r.created = time.Now()
+	if r.size > 0 {
+		// The file was already there, assume it was created when it
+		// was last modified, approximating by excess.
+		r.created = info.ModTime()
+	}
+	return nil
+}
+
+// Write implements io.Writer.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if r.f == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	if r.shouldRotate(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) shouldRotate(n int64) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.MaxSize > 0 && r.size+n > r.MaxSize {
+		return true
+	}
+	return r.MaxAge > 0 && time.Since(r.created) > r.MaxAge
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	r.f = nil
+	name := r.Path + "." + time.Now().Format("20060102-150405.000")
+	for i := 1; ; i++ {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			break
+		}
+		name = fmt.Sprintf("%s.%s-%d", r.Path, time.Now().Format("20060102-150405.000"), i)
+	}
+	if err := os.Rename(r.Path, name); err != nil {
+		return err
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	return r.prune()
+}
+
+// prune removes the oldest rotated files.
+func (r *RotatingFile) prune() error {
+	if r.MaxBackups <= 0 {
+		return nil
+	}
+	matches, err := filepath.Glob(r.Path + ".*")
+	if err != nil {
+		return err
+	}
+	// The timestamp suffix makes lexical order chronological.
+	sort.Strings(matches)
+	for len(matches) > r.MaxBackups {
+		if err := os.Remove(matches[0]); err != nil {
+			return err
+		}
+		matches = matches[1:]
+	}
+	return nil
+}
+
+// Sync commits the file contents to stable storage.
+func (r *RotatingFile) Sync() error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if r.f == nil {
+		return nil
+	}
+	return r.f.Sync()
+}
+
+// Close closes the file.
+func (r *RotatingFile) Close() error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
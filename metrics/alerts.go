@@ -0,0 +1,151 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultQuotaPeriod is the default period the data quota of the
+	// metered sources refers to.
+	DefaultQuotaPeriod = 30 * 24 * time.Hour
+	// QuotaRatio is the share of the data quota whose use triggers
+	// the quota alerts.
+	QuotaRatio = 0.9
+	// ErrorRatio is the share of the connections failing to be dialed
+	// through a source that triggers the error alerts.
+	ErrorRatio = 0.1
+)
+
+// RuleFile is a Prometheus rule file. Its json encoding is also valid
+// YAML, and can be loaded by Prometheus as is.
+type RuleFile struct {
+	Groups []RuleGroup `json:"groups"`
+}
+
+// RuleGroup is a group of Prometheus rules.
+type RuleGroup struct {
+	Name  string `json:"name"`
+	Rules []Rule `json:"rules"`
+}
+
+// Rule is a Prometheus alerting rule.
+type Rule struct {
+	Alert       string            `json:"alert"`
+	Expr        string            `json:"expr"`
+	For         string            `json:"for,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// AlertSource describes a source the alerting rules are generated for.
+type AlertSource struct {
+	ID      string
+	Name    string
+	Metered bool
+}
+
+// AlertOptions configure the alerting rules generated.
+type AlertOptions struct {
+	// Quota is the amount of data, in bytes, that the metered
+	// sources may transmit in QuotaPeriod. If 0, the quota rules
+	// are not generated.
+	Quota int64
+	// QuotaPeriod is the period Quota refers to. If 0,
+	// DefaultQuotaPeriod is used.
+	QuotaPeriod time.Duration
+}
+
+// AlertRules returns the recommended alerting rules for the metrics of
+// `sources`: when a source goes down, when too many of its connections
+// fail to be dialed and, for the metered ones, when their data quota is
+// almost used.
+func AlertRules(sources []AlertSource, opts AlertOptions) RuleFile {
+	period := opts.QuotaPeriod
+	if period <= 0 {
+		period = DefaultQuotaPeriod
+	}
+
+	g := RuleGroup{Name: namespace, Rules: []Rule{}}
+	for _, v := range sources {
+		name := v.Name
+		if name == "" {
+			name = v.ID
+		}
+		sel := fmt.Sprintf(`{source=%q}`, v.ID)
+		labels := func(severity string) map[string]string {
+			return map[string]string{"severity": severity, "source": v.ID}
+		}
+
+		g.Rules = append(g.Rules, Rule{
+			Alert:  "BoosterSourceDown",
+			Expr:   fmt.Sprintf("%s_source_up%s == 0", namespace, sel),
+			For:    "1m",
+			Labels: labels("critical"),
+			Annotations: map[string]string{
+				"summary":     fmt.Sprintf("Source %s is down", name),
+				"description": fmt.Sprintf("Source %s has not been available for more than a minute.", name),
+			},
+		})
+		g.Rules = append(g.Rules, Rule{
+			Alert: "BoosterSourceErrors",
+			Expr: fmt.Sprintf("sum(rate(%[1]s_dial_errors_total%[2]s[5m])) / sum(rate(%[1]s_select_source_total%[2]s[5m])) > %[3]s",
+				namespace, sel, strconv.FormatFloat(ErrorRatio, 'g', -1, 64)),
+			For:    "5m",
+			Labels: labels("warning"),
+			Annotations: map[string]string{
+				"summary":     fmt.Sprintf("Source %s fails to dial its connections", name),
+				"description": fmt.Sprintf("More than %.0f%% of the connections of source %s failed to be dialed in the last 5 minutes.", ErrorRatio*100, name),
+			},
+		})
+		if !v.Metered || opts.Quota <= 0 {
+			continue
+		}
+		g.Rules = append(g.Rules, Rule{
+			Alert: "BoosterSourceQuota",
+			Expr: fmt.Sprintf("sum(increase(%[1]s_network_send_bytes%[2]s[%[3]s])) + sum(increase(%[1]s_network_receive_bytes%[2]s[%[3]s])) > %[4]d",
+				namespace, sel, promDuration(period), int64(float64(opts.Quota)*QuotaRatio)),
+			Labels: labels("warning"),
+			Annotations: map[string]string{
+				"summary":     fmt.Sprintf("Source %s is near its data quota", name),
+				"description": fmt.Sprintf("Source %s transmitted more than %.0f%% of its quota of %d bytes in the last %s.", name, QuotaRatio*100, opts.Quota, promDuration(period)),
+			},
+		})
+	}
+	return RuleFile{Groups: []RuleGroup{g}}
+}
+
+// promDuration formats `d` as a Prometheus duration, in the largest
+// unit that represents it exactly.
+func promDuration(d time.Duration) string {
+	for _, v := range []struct {
+		unit time.Duration
+		name string
+	}{
+		{24 * time.Hour, "d"},
+		{time.Hour, "h"},
+		{time.Minute, "m"},
+		{time.Second, "s"},
+	} {
+		if d%v.unit == 0 {
+			return strconv.FormatInt(int64(d/v.unit), 10) + v.name
+		}
+	}
+	return strconv.FormatInt(int64(d/time.Millisecond), 10) + "ms"
+}
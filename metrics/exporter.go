@@ -19,6 +19,7 @@ package metrics
 
 import (
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/booster-proj/booster/source"
@@ -28,61 +29,148 @@ import (
 
 const namespace = "booster"
 
-var (
-	sendBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+// Exporter can be used to both capture and serve metrics. Each
+// Exporter has its own registry: create it with New.
+type Exporter struct {
+	registry *prometheus.Registry
+
+	sendBytes    *prometheus.GaugeVec
+	receiveBytes *prometheus.GaugeVec
+	selectSource *prometheus.CounterVec
+	countConn    *prometheus.GaugeVec
+	addLatency   *prometheus.GaugeVec
+	probeRTT     *prometheus.GaugeVec
+	probeLoss    *prometheus.GaugeVec
+	countPort    *prometheus.GaugeVec
+	relayed      *prometheus.CounterVec
+	bufferOps    *prometheus.CounterVec
+	dnsCacheOps  *prometheus.CounterVec
+	sourceInfo   *prometheus.GaugeVec
+	sourceLabel  *prometheus.GaugeVec
+	sourceUp     *prometheus.GaugeVec
+	dialErrors   *prometheus.CounterVec
+	panics       *prometheus.CounterVec
+
+	// labels are the labels exported for each source, deleted when
+	// they change.
+	labels struct {
+		sync.Mutex
+		val map[string][]prometheus.Labels
+	}
+}
+
+// New returns an Exporter whose registry contains the booster metrics,
+// together with the ones of the Go runtime and of the process.
+func New() *Exporter {
+	exp := &Exporter{registry: prometheus.NewRegistry()}
+	exp.sendBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: namespace,
 		Name:      "network_send_bytes",
 		Help:      "Sent bytes for network source",
 	}, []string{"source", "target"})
-
-	receiveBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	exp.receiveBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: namespace,
 		Name:      "network_receive_bytes",
 		Help:      "Received bytes for network source",
 	}, []string{"source", "target"})
-
-	selectSource = prometheus.NewCounterVec(prometheus.CounterOpts{
+	exp.selectSource = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: namespace,
 		Name:      "select_source_total",
 		Help:      "Number of times a source was chosen",
 	}, []string{"source", "target"})
-
-	countConn = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	exp.countConn = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: namespace,
 		Name:      "open_conn_count",
 		Help:      "Number of open connections",
 	}, []string{"source", "target"})
-
-	addLatency = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	exp.addLatency = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: namespace,
 		Name:      "conn_latency_ms",
 		Help:      "Latency value measured in milliseconds",
 	}, []string{"source", "target"})
-
-	countPort = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	exp.probeRTT = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "source_rtt_ms",
+		Help:      "Mean round trip time to the probe anchor, measured in milliseconds",
+	}, []string{"source"})
+	exp.probeLoss = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "source_loss_ratio",
+		Help:      "Ratio of failed probes to the probe anchor",
+	}, []string{"source"})
+	exp.countPort = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: namespace,
 		Name:      "port_count",
 		Help:      "Number of times a port is being used",
 	}, []string{"port", "protocol"})
-)
-
-func init() {
-	prometheus.MustRegister(sendBytes)
-	prometheus.MustRegister(receiveBytes)
-	prometheus.MustRegister(selectSource)
-	prometheus.MustRegister(countConn)
-	prometheus.MustRegister(addLatency)
-	prometheus.MustRegister(countPort)
-}
+	exp.relayed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relayed_bytes_total",
+		Help:      "Bytes relayed between connections, by copy path: splice or copy",
+	}, []string{"path"})
+	exp.bufferOps = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "buffer_ops_total",
+		Help:      "Operations on the relay buffer pool: get, alloc or put",
+	}, []string{"op"})
+	exp.dnsCacheOps = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dns_cache_ops_total",
+		Help:      "Operations on the DNS cache: hit, miss or evict",
+	}, []string{"op"})
+	exp.sourceInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "source_info",
+		Help:      "Display name assigned to a source, always 1",
+	}, []string{"source", "display_name"})
+	exp.sourceLabel = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "source_label",
+		Help:      "Label assigned to a source, always 1",
+	}, []string{"source", "key", "value"})
+	exp.sourceUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "source_up",
+		Help:      "Whether a source is available, 1, or went down, 0",
+	}, []string{"source"})
+	exp.dialErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dial_errors_total",
+		Help:      "Number of connections that a source failed to dial",
+	}, []string{"source"})
+	exp.panics = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "panics_total",
+		Help:      "Number of panics recovered, by subsystem",
+	}, []string{"subsystem"})
 
-// Exporter can be used to both capture and serve metrics.
-type Exporter struct {
+	exp.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		exp.sendBytes,
+		exp.receiveBytes,
+		exp.selectSource,
+		exp.countConn,
+		exp.addLatency,
+		exp.probeRTT,
+		exp.probeLoss,
+		exp.countPort,
+		exp.relayed,
+		exp.bufferOps,
+		exp.dnsCacheOps,
+		exp.sourceInfo,
+		exp.sourceLabel,
+		exp.sourceUp,
+		exp.dialErrors,
+		exp.panics,
+	)
+	return exp
 }
 
-// ServeHTTP is just a wrapper around the ServeHTTP function
-// of the prohttp default Handler.
+// ServeHTTP serves the metrics of the registry of `exp`, in
+// prometheus format.
 func (exp *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	promhttp.Handler().ServeHTTP(w, r)
+	promhttp.HandlerFor(exp.registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
 }
 
 // SendDataFlow can be used to update the metrics exported by the broker
@@ -92,9 +180,9 @@ func (exp *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func (exp *Exporter) SendDataFlow(labels map[string]string, data *source.DataFlow) {
 	switch data.Type {
 	case "read":
-		receiveBytes.With(prometheus.Labels(labels)).Add(float64(data.N))
+		exp.receiveBytes.With(prometheus.Labels(labels)).Add(float64(data.N))
 	case "write":
-		sendBytes.With(prometheus.Labels(labels)).Add(float64(data.N))
+		exp.sendBytes.With(prometheus.Labels(labels)).Add(float64(data.N))
 	default:
 	}
 }
@@ -102,22 +190,98 @@ func (exp *Exporter) SendDataFlow(labels map[string]string, data *source.DataFlo
 // IncSelectedSource is used to update the number of times a source was
 // chosen.
 func (exp *Exporter) IncSelectedSource(labels map[string]string) {
-	selectSource.With(prometheus.Labels(labels)).Inc()
+	exp.selectSource.With(prometheus.Labels(labels)).Inc()
 }
 
 // CountOpenConn is used to updated the number of open connections created
 // through booster sources.
 func (exp *Exporter) CountOpenConn(labels map[string]string, val int) {
-	countConn.With(prometheus.Labels(labels)).Add(float64(val))
+	exp.countConn.With(prometheus.Labels(labels)).Add(float64(val))
 }
 
 // AddLatency is used to update the latency of the connections opened.
 func (exp *Exporter) AddLatency(labels map[string]string, d time.Duration) {
 	ms := float64(d / 1000000)
-	addLatency.With(prometheus.Labels(labels)).Add(ms)
+	exp.addLatency.With(prometheus.Labels(labels)).Add(ms)
 }
 
-//CountPort updates the port counter
+// CountPort updates the port counter
 func (exp *Exporter) CountPort(labels map[string]string, val int) {
-	countPort.With(prometheus.Labels(labels)).Add(float64(val))
+	exp.countPort.With(prometheus.Labels(labels)).Add(float64(val))
+}
+
+// CountRelayed updates the amount of data relayed through each copy
+// path.
+func (exp *Exporter) CountRelayed(labels map[string]string, n int64) {
+	exp.relayed.With(prometheus.Labels(labels)).Add(float64(n))
+}
+
+// IncBufferOp is used to update the number of operations performed
+// on the relay buffer pool.
+func (exp *Exporter) IncBufferOp(labels map[string]string) {
+	exp.bufferOps.With(prometheus.Labels(labels)).Inc()
+}
+
+// IncDNSCacheOp is used to update the number of operations performed
+// on the DNS cache.
+func (exp *Exporter) IncDNSCacheOp(labels map[string]string) {
+	exp.dnsCacheOps.With(prometheus.Labels(labels)).Inc()
+}
+
+// SetSourceUp updates the availability of source `id`.
+func (exp *Exporter) SetSourceUp(id string, up bool) {
+	var v float64
+	if up {
+		v = 1
+	}
+	exp.sourceUp.With(prometheus.Labels{"source": id}).Set(v)
+}
+
+// IncDialError is used to update the number of dial errors of the
+// sources.
+func (exp *Exporter) IncDialError(labels map[string]string) {
+	exp.dialErrors.With(prometheus.Labels(labels)).Inc()
+}
+
+// IncPanic is used to update the number of panics recovered.
+func (exp *Exporter) IncPanic(labels map[string]string) {
+	exp.panics.With(prometheus.Labels(labels)).Inc()
+}
+
+// SetSourceLabels exports the display name and the labels assigned
+// to source `id`, replacing the ones exported before.
+func (exp *Exporter) SetSourceLabels(id, name string, labels map[string]string) {
+	exp.labels.Lock()
+	defer exp.labels.Unlock()
+
+	for _, v := range exp.labels.val[id] {
+		if _, ok := v["display_name"]; ok {
+			exp.sourceInfo.Delete(v)
+		} else {
+			exp.sourceLabel.Delete(v)
+		}
+	}
+	if exp.labels.val == nil {
+		exp.labels.val = make(map[string][]prometheus.Labels)
+	}
+
+	var acc []prometheus.Labels
+	if name != "" {
+		l := prometheus.Labels{"source": id, "display_name": name}
+		exp.sourceInfo.With(l).Set(1)
+		acc = append(acc, l)
+	}
+	for k, v := range labels {
+		l := prometheus.Labels{"source": id, "key": k, "value": v}
+		exp.sourceLabel.With(l).Set(1)
+		acc = append(acc, l)
+	}
+	exp.labels.val[id] = acc
+}
+
+// SetProbeStats updates the round trip time and packet loss measured
+// by the prober.
+func (exp *Exporter) SetProbeStats(labels map[string]string, rtt time.Duration, loss float64) {
+	exp.probeRTT.With(prometheus.Labels(labels)).Set(float64(rtt) / float64(time.Millisecond))
+	exp.probeLoss.With(prometheus.Labels(labels)).Set(loss)
 }
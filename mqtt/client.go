@@ -0,0 +1,239 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package mqtt publishes booster's events to an MQTT broker, so that
+// home automation setups can react to them. It implements the subset
+// of MQTT 3.1.1 needed to publish messages with QoS 0.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Packet types, already shifted into the fixed header.
+const (
+	packetConnect    = 0x10
+	packetConnack    = 0x20
+	packetPublish    = 0x30
+	packetPingreq    = 0xc0
+	packetDisconnect = 0xe0
+)
+
+// Options are the parameters of the connection to the broker.
+type Options struct {
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration
+}
+
+// Client is a connection to an MQTT broker. It is safe to be used by
+// multiple goroutines.
+type Client struct {
+	mux  sync.Mutex
+	conn net.Conn
+	done chan struct{}
+}
+
+// Dial connects to `broker`, in the form tcp://host:port, or
+// tls://host:port for TLS connections. The default ports are 1883 and
+// 8883 respectively. The mqtt:// and mqtts:// schemes are accepted as
+// well.
+func Dial(ctx context.Context, broker string, opts Options) (*Client, error) {
+	u, err := url.Parse(broker)
+	if err != nil {
+		return nil, err
+	}
+	var secure bool
+	port := "1883"
+	switch u.Scheme {
+	case "tcp", "mqtt":
+	case "tls", "ssl", "mqtts":
+		secure, port = true, "8883"
+	default:
+		return nil, fmt.Errorf("mqtt: unsupported broker scheme %q", u.Scheme)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if secure {
+		conn = tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c := &Client{conn: conn, done: make(chan struct{})}
+	if err := c.connect(opts); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	// The only packets sent by the broker from now on are the ping
+	// responses: discard them, and notice when the connection is
+	// closed.
+	go func() {
+		io.Copy(ioutil.Discard, conn)
+		close(c.done)
+	}()
+	return c, nil
+}
+
+func (c *Client) connect(opts Options) error {
+	flags := byte(0x02) // clean session
+	payload := appendString(nil, opts.ClientID)
+	if opts.Username != "" {
+		flags |= 0x80
+		payload = appendString(payload, opts.Username)
+	}
+	if opts.Password != "" {
+		flags |= 0x40
+		payload = appendString(payload, opts.Password)
+	}
+	keepAlive := uint16(opts.KeepAlive / time.Second)
+
+	b := appendString(nil, "MQTT")
+	b = append(b, 4, flags, byte(keepAlive>>8), byte(keepAlive))
+	if err := c.write(packetConnect, append(b, payload...)); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(c.conn)
+	header, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	if header != packetConnack || len(body) != 2 {
+		return fmt.Errorf("mqtt: unexpected packet %#x, expected CONNACK", header)
+	}
+	if code := body[1]; code != 0 {
+		return fmt.Errorf("mqtt: connection refused, code %d", code)
+	}
+	if r.Buffered() > 0 {
+		return errors.New("mqtt: unexpected data after CONNACK")
+	}
+	return nil
+}
+
+// Publish publishes `payload` on `topic`, with QoS 0.
+func (c *Client) Publish(topic string, payload []byte, retain bool) error {
+	header := byte(packetPublish)
+	if retain {
+		header |= 0x01
+	}
+	return c.write(header, append(appendString(nil, topic), payload...))
+}
+
+// Ping sends a ping request to the broker, which keeps the connection
+// alive.
+func (c *Client) Ping() error {
+	return c.write(packetPingreq, nil)
+}
+
+// Done returns a channel that is closed when the connection to the
+// broker is lost.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close disconnects from the broker.
+func (c *Client) Close() error {
+	c.write(packetDisconnect, nil)
+	return c.conn.Close()
+}
+
+func (c *Client) write(header byte, body []byte) error {
+	if len(body) > maxLength {
+		return fmt.Errorf("mqtt: packet too large: %d bytes", len(body))
+	}
+	b := append([]byte{header}, appendLength(nil, len(body))...)
+	b = append(b, body...)
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	_, err := c.conn.Write(b)
+	return err
+}
+
+// maxLength is the maximum length of the body of a packet.
+const maxLength = 268435455
+
+// appendLength appends the variable length encoding of `n`.
+func appendLength(b []byte, n int) []byte {
+	for {
+		d := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			d |= 0x80
+		}
+		b = append(b, d)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+func appendString(b []byte, s string) []byte {
+	b = append(b, 0, 0)
+	binary.BigEndian.PutUint16(b[len(b)-2:], uint16(len(s)))
+	return append(b, s...)
+}
+
+// readBody reads the remaining length of a packet, and then its body.
+func readBody(r *bufio.Reader) ([]byte, error) {
+	n, mul := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return nil, errors.New("mqtt: malformed remaining length")
+		}
+		d, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		n += int(d&0x7f) * mul
+		mul *= 128
+		if d&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
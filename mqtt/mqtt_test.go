@@ -0,0 +1,183 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package mqtt_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/events"
+	"github.com/booster-proj/booster/mqtt"
+)
+
+func TestTopic(t *testing.T) {
+	e := events.Event{Topic: events.TopicSourceDown}
+	if got := mqtt.Topic("", e); got != "booster/source/down" {
+		t.Fatalf("Unexpected topic: %v", got)
+	}
+	if got := mqtt.Topic("home/net/", e); got != "home/net/source/down" {
+		t.Fatalf("Unexpected topic: %v", got)
+	}
+}
+
+type packet struct {
+	header byte
+	body   []byte
+}
+
+func readPacket(r *bufio.Reader) (packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+	n, mul := 0, 1
+	for {
+		d, err := r.ReadByte()
+		if err != nil {
+			return packet{}, err
+		}
+		n += int(d&0x7f) * mul
+		mul *= 128
+		if d&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, n)
+	_, err = io.ReadFull(r, body)
+	return packet{header, body}, err
+}
+
+func readString(b []byte) (string, []byte) {
+	n := binary.BigEndian.Uint16(b)
+	return string(b[2 : 2+n]), b[2+n:]
+}
+
+// broker accepts a connection, and sends the packets it receives to
+// the channel returned.
+func broker(t *testing.T, ln net.Listener) <-chan packet {
+	c := make(chan packet, 16)
+	go func() {
+		defer close(c)
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		p, err := readPacket(r)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		c <- p
+		conn.Write([]byte{0x20, 0x02, 0x00, 0x00}) // CONNACK
+		for {
+			p, err := readPacket(r)
+			if err != nil {
+				return
+			}
+			c <- p
+		}
+	}()
+	return c
+}
+
+func TestPublisher(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	packets := broker(t, ln)
+
+	bus := new(events.Bus)
+	p := &mqtt.Publisher{
+		Broker:  "tcp://" + ln.Addr().String(),
+		Options: mqtt.Options{ClientID: "test", Username: "user"},
+		Buses:   []*events.Bus{bus},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx)
+
+	// Publish until the publisher subscribes to the bus.
+	e := events.Event{Topic: events.TopicSourceDown, Message: "source en0 is down"}
+	var connect packet
+	for received := false; !received; {
+		bus.Publish(e)
+		select {
+		case connect = <-packets:
+			received = true
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+	if connect.header != 0x10 {
+		t.Fatalf("Unexpected packet: %#x, expected CONNECT", connect.header)
+	}
+	proto, rest := readString(connect.body)
+	if proto != "MQTT" || rest[0] != 4 || rest[1]&0x80 == 0 {
+		t.Fatalf("Unexpected CONNECT: %v", connect.body)
+	}
+	if id, _ := readString(rest[4:]); id != "test" {
+		t.Fatalf("Unexpected client id: %v", id)
+	}
+
+	publish := <-packets
+	if publish.header != 0x30 {
+		t.Fatalf("Unexpected packet: %#x, expected PUBLISH", publish.header)
+	}
+	topic, payload := readString(publish.body)
+	if topic != "booster/source/down" {
+		t.Fatalf("Unexpected topic: %v", topic)
+	}
+	var got events.Event
+	if err := json.Unmarshal(payload, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Topic != e.Topic || got.Message != e.Message {
+		t.Fatalf("Unexpected payload: %s", payload)
+	}
+}
+
+func TestDial_refused(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		readPacket(bufio.NewReader(conn))
+		conn.Write([]byte{0x20, 0x02, 0x00, 0x05}) // not authorized
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := mqtt.Dial(ctx, "tcp://"+ln.Addr().String(), mqtt.Options{ClientID: "test"}); err == nil {
+		t.Fatalf("Expected an error when the broker refuses the connection")
+	}
+}
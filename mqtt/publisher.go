@@ -0,0 +1,139 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/booster-proj/booster/events"
+	"upspin.io/log"
+)
+
+// Defaults used when the Publisher fields are not set.
+const (
+	DefaultPrefix        = "booster"
+	DefaultKeepAlive     = time.Minute
+	DefaultRetryInterval = time.Second * 10
+)
+
+// Publisher publishes the events of its Buses to Broker. Each event is
+// published on the topic returned by Topic, with its json encoding as
+// payload. The events published while the broker is unreachable are
+// lost.
+type Publisher struct {
+	// Broker is the address of the broker, see Dial.
+	Broker  string
+	Options Options
+	// Prefix is prepended to the topic of each event. If empty,
+	// DefaultPrefix is used.
+	Prefix string
+	// RetryInterval is the minimum interval between two connection
+	// attempts. If zero, DefaultRetryInterval is used.
+	RetryInterval time.Duration
+	Buses         []*events.Bus
+}
+
+// Topic returns the MQTT topic `e` is published on, i.e. the event
+// topic with slashes in place of the dots, under `prefix`. For
+// example, the source.down events are published on
+// booster/source/down.
+func Topic(prefix string, e events.Event) string {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	return strings.TrimSuffix(prefix, "/") + "/" + strings.Replace(e.Topic, ".", "/", -1)
+}
+
+// Run publishes the events until `ctx` is canceled.
+func (p *Publisher) Run(ctx context.Context) error {
+	c := make(chan events.Event, 64)
+	for _, b := range p.Buses {
+		sub, cancel := b.Subscribe(64)
+		defer cancel()
+		go func() {
+			for e := range sub {
+				select {
+				case c <- e:
+				default:
+				}
+			}
+		}()
+	}
+
+	opts := p.Options
+	if opts.KeepAlive <= 0 {
+		opts.KeepAlive = DefaultKeepAlive
+	}
+	retry := p.RetryInterval
+	if retry <= 0 {
+		retry = DefaultRetryInterval
+	}
+	ping := time.NewTicker(opts.KeepAlive / 2)
+	defer ping.Stop()
+
+	var client *Client
+	var done <-chan struct{}
+	var lastDial time.Time
+	defer func() {
+		if client != nil {
+			client.Close()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-done:
+			log.Error.Printf("MQTT: connection to %v lost", p.Broker)
+			client, done = nil, nil
+		case <-ping.C:
+			if client != nil {
+				client.Ping()
+			}
+		case e := <-c:
+			if client == nil && time.Since(lastDial) >= retry {
+				lastDial = time.Now()
+				dctx, cancel := context.WithTimeout(ctx, retry)
+				var err error
+				client, err = Dial(dctx, p.Broker, opts)
+				cancel()
+				if err != nil {
+					log.Error.Printf("MQTT: unable to connect to %v: %v", p.Broker, err)
+					client = nil
+				} else {
+					done = client.Done()
+				}
+			}
+			if client == nil {
+				continue
+			}
+			payload, err := json.Marshal(e)
+			if err != nil {
+				log.Error.Printf("MQTT: unable to encode %v event: %v", e.Topic, err)
+				continue
+			}
+			if err := client.Publish(Topic(p.Prefix, e), payload, false); err != nil {
+				log.Error.Printf("MQTT: unable to publish %v event: %v", e.Topic, err)
+				client.Close()
+				client, done = nil, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package nat
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// DefaultGateway returns the address of the IPv4 default gateway.
+func DefaultGateway() (net.IP, error) {
+	switch runtime.GOOS {
+	case "linux":
+		return linuxGateway()
+	case "darwin":
+		return darwinGateway()
+	default:
+		return nil, errors.New("nat: default gateway lookup not supported on " + runtime.GOOS)
+	}
+}
+
+func linuxGateway() (net.IP, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Iface Destination Gateway Flags ...
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		b, err := hex.DecodeString(fields[2])
+		if err != nil || len(b) != 4 {
+			continue
+		}
+		ip := make(net.IP, 4)
+		// The kernel prints addresses in host byte order.
+		binary.LittleEndian.PutUint32(ip, binary.BigEndian.Uint32(b))
+		if !ip.IsUnspecified() {
+			return ip, nil
+		}
+	}
+	return nil, errors.New("nat: no default gateway found")
+}
+
+func darwinGateway() (net.IP, error) {
+	out, err := exec.Command("route", "-n", "get", "default").Output()
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range strings.Split(string(out), "\n") {
+		l = strings.TrimSpace(l)
+		if strings.HasPrefix(l, "gateway:") {
+			if ip := net.ParseIP(strings.TrimSpace(strings.TrimPrefix(l, "gateway:"))); ip != nil {
+				return ip, nil
+			}
+		}
+	}
+	return nil, errors.New("nat: no default gateway found")
+}
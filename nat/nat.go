@@ -0,0 +1,113 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package nat maps booster's listening ports on the local router using
+// either NAT-PMP (RFC 6886) or UPnP IGD, making booster reachable from
+// outside the local network.
+package nat
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"upspin.io/log"
+)
+
+// Mapper is implemented by the port mapping protocols supported.
+type Mapper interface {
+	// AddMapping maps the external `port` to the same internal port on
+	// this host, for `lifetime`. `protocol` is either "tcp" or "udp".
+	AddMapping(ctx context.Context, protocol string, port int, lifetime time.Duration) error
+	// DelMapping removes the mapping of `port`.
+	DelMapping(ctx context.Context, protocol string, port int) error
+	// ExternalIP returns the public address of the router.
+	ExternalIP(ctx context.Context) (net.IP, error)
+	// Protocol returns the name of the mapping protocol.
+	Protocol() string
+}
+
+// ErrNoGateway is returned when no router supporting port mapping was
+// found.
+var ErrNoGateway = errors.New("nat: no gateway supporting NAT-PMP or UPnP found")
+
+// Discover returns a Mapper for the default gateway, preferring NAT-PMP
+// over UPnP.
+func Discover(ctx context.Context) (Mapper, error) {
+	if gw, err := DefaultGateway(); err == nil {
+		pmp := NewPMP(gw)
+		_ctx, cancel := context.WithTimeout(ctx, time.Second*2)
+		_, err := pmp.ExternalIP(_ctx)
+		cancel()
+		if err == nil {
+			return pmp, nil
+		}
+		log.Debug.Printf("NAT: gateway %v does not support NAT-PMP: %v", gw, err)
+	}
+
+	_ctx, cancel := context.WithTimeout(ctx, time.Second*3)
+	defer cancel()
+	igd, err := DiscoverUPnP(_ctx)
+	if err != nil {
+		log.Debug.Printf("NAT: UPnP discovery failed: %v", err)
+		return nil, ErrNoGateway
+	}
+	return igd, nil
+}
+
+// DefaultLifetime is the lifetime requested for each mapping,
+// which is renewed before expiring.
+var DefaultLifetime = time.Hour
+
+// Keep maps `port` using `m`, renewing the mapping until the context
+// is canceled. The mapping is then removed.
+func Keep(ctx context.Context, m Mapper, protocol string, port int) error {
+	renew := func() error {
+		_ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+		defer cancel()
+		return m.AddMapping(_ctx, protocol, port, DefaultLifetime)
+	}
+	if err := renew(); err != nil {
+		return err
+	}
+	log.Info.Printf("NAT: %s port %d mapped using %s", protocol, port, m.Protocol())
+
+	for {
+		select {
+		case <-ctx.Done():
+			_ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+			defer cancel()
+			if err := m.DelMapping(_ctx, protocol, port); err != nil {
+				log.Error.Printf("NAT: unable to remove mapping of port %d: %v", port, err)
+			}
+			return ctx.Err()
+		case <-time.After(DefaultLifetime / 2):
+			if err := renew(); err != nil {
+				log.Error.Printf("NAT: unable to renew mapping of port %d: %v", port, err)
+			}
+		}
+	}
+}
+
+// localIP returns the address used by this host to reach `ip`.
+func localIP(ip net.IP) (net.IP, error) {
+	conn, err := net.Dial("udp4", net.JoinHostPort(ip.String(), "1"))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
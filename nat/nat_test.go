@@ -0,0 +1,197 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package nat_test
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/nat"
+)
+
+type mappings struct {
+	sync.Mutex
+	val map[uint16]uint32
+}
+
+func (m *mappings) get(port uint16) (uint32, bool) {
+	m.Lock()
+	defer m.Unlock()
+	l, ok := m.val[port]
+	return l, ok
+}
+
+// fakePMP is a NAT-PMP gateway that accepts every request.
+func fakePMP(t *testing.T, m *mappings) (string, func()) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 12)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			resp := make([]byte, 16)
+			resp[1] = buf[1] + 128
+			switch {
+			case n == 2 && buf[1] == 0:
+				copy(resp[8:12], []byte{203, 0, 113, 7})
+				resp = resp[:12]
+			case n == 12:
+				port := binary.BigEndian.Uint16(buf[4:6])
+				lifetime := binary.BigEndian.Uint32(buf[8:12])
+				m.Lock()
+				m.val[port] = lifetime
+				m.Unlock()
+				copy(resp[8:12], buf[4:8])
+				copy(resp[12:16], buf[8:12])
+			default:
+				binary.BigEndian.PutUint16(resp[2:4], 5)
+			}
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().String(), func() { conn.Close() }
+}
+
+func TestPMP(t *testing.T) {
+	m := &mappings{val: make(map[uint16]uint32)}
+	addr, stop := fakePMP(t, m)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	pmp := &nat.PMP{Addr: addr}
+	ip, err := pmp.ExternalIP(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.Equal(net.IPv4(203, 0, 113, 7)) {
+		t.Fatalf("Unexpected external ip: %v", ip)
+	}
+
+	if err := pmp.AddMapping(ctx, "tcp", 1080, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if l, _ := m.get(1080); l != 3600 {
+		t.Fatalf("Unexpected lifetime: wanted 3600, found %d", l)
+	}
+	if err := pmp.DelMapping(ctx, "tcp", 1080); err != nil {
+		t.Fatal(err)
+	}
+	if l, ok := m.get(1080); !ok || l != 0 {
+		t.Fatalf("Mapping was not deleted: %v", l)
+	}
+
+	if err := pmp.AddMapping(ctx, "sctp", 1080, time.Hour); err == nil {
+		t.Fatal("Expected an error with unsupported protocol")
+	}
+}
+
+const igdDesc = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+    <deviceList>
+      <device>
+        <deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+        <deviceList>
+          <device>
+            <deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+            <serviceList>
+              <service>
+                <serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+                <controlURL>/ctl/IPConn</controlURL>
+              </service>
+            </serviceList>
+          </device>
+        </deviceList>
+      </device>
+    </deviceList>
+  </device>
+</root>`
+
+func TestUPnP(t *testing.T) {
+	var actions []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/desc.xml":
+			fmt.Fprint(w, igdDesc)
+		case "/ctl/IPConn":
+			action := r.Header.Get("SOAPAction")
+			body, _ := ioutil.ReadAll(r.Body)
+			if !strings.Contains(string(body), "<NewExternalPort>1080</NewExternalPort>") && !strings.HasSuffix(action, `#GetExternalIPAddress"`) {
+				http.Error(w, "bad request", http.StatusInternalServerError)
+				return
+			}
+			actions = append(actions, action)
+			fmt.Fprint(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>`+
+				`<u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">`+
+				`<NewExternalIPAddress>203.0.113.7</NewExternalIPAddress></u:GetExternalIPAddressResponse></s:Body></s:Envelope>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	igd, err := nat.NewUPnP(ctx, srv.URL+"/desc.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if igd.ControlURL != srv.URL+"/ctl/IPConn" {
+		t.Fatalf("Unexpected control url: %v", igd.ControlURL)
+	}
+
+	ip, err := igd.ExternalIP(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.Equal(net.IPv4(203, 0, 113, 7)) {
+		t.Fatalf("Unexpected external ip: %v", ip)
+	}
+	if err := igd.AddMapping(ctx, "tcp", 1080, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := igd.DelMapping(ctx, "tcp", 1080); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := "urn:schemas-upnp-org:service:WANIPConnection:1"
+	want := []string{
+		`"` + svc + `#GetExternalIPAddress"`,
+		`"` + svc + `#AddPortMapping"`,
+		`"` + svc + `#DeletePortMapping"`,
+	}
+	if fmt.Sprint(actions) != fmt.Sprint(want) {
+		t.Fatalf("Unexpected actions: wanted %v, found %v", want, actions)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package nat
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// PMPPort is the port NAT-PMP gateways listen on.
+const PMPPort = 5351
+
+// PMP is a NAT-PMP client.
+type PMP struct {
+	// Addr is the address of the gateway, host:port.
+	Addr string
+}
+
+// NewPMP returns a NAT-PMP client for `gateway`.
+func NewPMP(gateway net.IP) *PMP {
+	return &PMP{Addr: net.JoinHostPort(gateway.String(), strconv.Itoa(PMPPort))}
+}
+
+// Protocol implements Mapper.
+func (p *PMP) Protocol() string {
+	return "NAT-PMP"
+}
+
+var pmpErrors = map[uint16]string{
+	1: "unsupported version",
+	2: "not authorized",
+	3: "network failure",
+	4: "out of resources",
+	5: "unsupported opcode",
+}
+
+// call sends `req` to the gateway, retransmitting it with exponential
+// backoff as described by the RFC, and returns the response.
+func (p *PMP) call(ctx context.Context, req []byte, size int) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp4", p.Addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	resp := make([]byte, 16)
+	timeout := time.Millisecond * 250
+	for i := 0; i < 6; i++ {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		deadline := time.Now().Add(timeout)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		conn.SetReadDeadline(deadline)
+
+		n, err := conn.Read(resp)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				timeout *= 2
+				continue
+			}
+			return nil, err
+		}
+		if n < size || resp[0] != 0 || resp[1] != req[1]+128 {
+			return nil, errors.New("nat-pmp: invalid response")
+		}
+		if code := binary.BigEndian.Uint16(resp[2:4]); code != 0 {
+			return nil, fmt.Errorf("nat-pmp: %s", pmpErrors[code])
+		}
+		return resp[:n], nil
+	}
+	return nil, errors.New("nat-pmp: gateway did not respond")
+}
+
+// ExternalIP implements Mapper.
+func (p *PMP) ExternalIP(ctx context.Context) (net.IP, error) {
+	resp, err := p.call(ctx, []byte{0, 0}, 12)
+	if err != nil {
+		return nil, err
+	}
+	return net.IPv4(resp[8], resp[9], resp[10], resp[11]), nil
+}
+
+func (p *PMP) mapping(ctx context.Context, protocol string, port int, lifetime time.Duration) error {
+	req := make([]byte, 12)
+	switch protocol {
+	case "udp":
+		req[1] = 1
+	case "tcp":
+		req[1] = 2
+	default:
+		return fmt.Errorf("nat-pmp: unsupported protocol %s", protocol)
+	}
+	binary.BigEndian.PutUint16(req[4:6], uint16(port))
+	if lifetime > 0 {
+		// Deletion requests must suggest external port 0.
+		binary.BigEndian.PutUint16(req[6:8], uint16(port))
+	}
+	binary.BigEndian.PutUint32(req[8:12], uint32(lifetime/time.Second))
+
+	resp, err := p.call(ctx, req, 16)
+	if err != nil {
+		return err
+	}
+	if lifetime > 0 {
+		if ext := binary.BigEndian.Uint16(resp[10:12]); int(ext) != port {
+			return fmt.Errorf("nat-pmp: gateway mapped port %d to %d instead", port, ext)
+		}
+	}
+	return nil
+}
+
+// AddMapping implements Mapper.
+func (p *PMP) AddMapping(ctx context.Context, protocol string, port int, lifetime time.Duration) error {
+	return p.mapping(ctx, protocol, port, lifetime)
+}
+
+// DelMapping implements Mapper.
+func (p *PMP) DelMapping(ctx context.Context, protocol string, port int) error {
+	return p.mapping(ctx, protocol, port, 0)
+}
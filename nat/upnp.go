@@ -0,0 +1,282 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package nat
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ssdpAddr = "239.255.255.250:1900"
+
+// Service types that provide port mapping.
+var igdServices = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:2",
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+// UPnP is a UPnP Internet Gateway Device client.
+type UPnP struct {
+	// ControlURL is the URL used for SOAP requests.
+	ControlURL string
+	// Service is the service type of the control URL.
+	Service string
+
+	client http.Client
+}
+
+// Protocol implements Mapper.
+func (u *UPnP) Protocol() string {
+	return "UPnP"
+}
+
+// DiscoverUPnP finds an Internet Gateway Device on the local network
+// using SSDP.
+func DiscoverUPnP(ctx context.Context) (*UPnP, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	dst, err := net.ResolveUDPAddr("udp4", ssdpAddr)
+	if err != nil {
+		return nil, err
+	}
+	req := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + ssdpAddr + "\r\n" +
+		"ST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n\r\n"
+	if _, err := conn.WriteTo([]byte(req), dst); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(time.Second * 3)
+	if d, ok := ctx.Deadline(); ok {
+		deadline = d
+	}
+	conn.SetReadDeadline(deadline)
+
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		loc := resp.Header.Get("Location")
+		if loc == "" {
+			continue
+		}
+		if igd, err := NewUPnP(ctx, loc); err == nil {
+			return igd, nil
+		}
+	}
+}
+
+type device struct {
+	Services []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []device `xml:"deviceList>device"`
+}
+
+func (d *device) find() (string, string, bool) {
+	for _, t := range igdServices {
+		for _, s := range d.Services {
+			if s.ServiceType == t {
+				return s.ServiceType, s.ControlURL, true
+			}
+		}
+	}
+	for _, v := range d.Devices {
+		if t, u, ok := v.find(); ok {
+			return t, u, ok
+		}
+	}
+	return "", "", false
+}
+
+// NewUPnP fetches the device description found at `location`, and
+// returns a client for its port mapping service.
+func NewUPnP(ctx context.Context, location string) (*UPnP, error) {
+	req, err := http.NewRequest("GET", location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var root struct {
+		URLBase string `xml:"URLBase"`
+		Device  device `xml:"device"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&root); err != nil {
+		return nil, err
+	}
+	st, control, ok := root.Device.find()
+	if !ok {
+		return nil, errors.New("upnp: device does not provide port mapping")
+	}
+
+	base := location
+	if root.URLBase != "" {
+		base = root.URLBase
+	}
+	bu, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	cu, err := bu.Parse(control)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UPnP{ControlURL: cu.String(), Service: st}, nil
+}
+
+func (u *UPnP) soap(ctx context.Context, action string, args [][2]string) ([]byte, error) {
+	var body bytes.Buffer
+	fmt.Fprintf(&body, `<?xml version="1.0"?>`+
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">`+
+		`<s:Body><u:%s xmlns:u="%s">`, action, u.Service)
+	for _, v := range args {
+		fmt.Fprintf(&body, "<%s>", v[0])
+		xml.EscapeText(&body, []byte(v[1]))
+		fmt.Fprintf(&body, "</%s>", v[0])
+	}
+	fmt.Fprintf(&body, `</u:%s></s:Body></s:Envelope>`, action)
+
+	req, err := http.NewRequest("POST", u.ControlURL, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+u.Service+"#"+action+`"`)
+
+	resp, err := u.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upnp: %s failed: %s", action, resp.Status)
+	}
+	return b, nil
+}
+
+func upnpProtocol(protocol string) (string, error) {
+	switch protocol {
+	case "tcp", "udp":
+		return strings.ToUpper(protocol), nil
+	default:
+		return "", fmt.Errorf("upnp: unsupported protocol %s", protocol)
+	}
+}
+
+// AddMapping implements Mapper.
+func (u *UPnP) AddMapping(ctx context.Context, protocol string, port int, lifetime time.Duration) error {
+	proto, err := upnpProtocol(protocol)
+	if err != nil {
+		return err
+	}
+	host, err := u.localIP()
+	if err != nil {
+		return err
+	}
+	_, err = u.soap(ctx, "AddPortMapping", [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(port)},
+		{"NewProtocol", proto},
+		{"NewInternalPort", strconv.Itoa(port)},
+		{"NewInternalClient", host.String()},
+		{"NewEnabled", "1"},
+		{"NewPortMappingDescription", "booster"},
+		{"NewLeaseDuration", strconv.Itoa(int(lifetime / time.Second))},
+	})
+	return err
+}
+
+// DelMapping implements Mapper.
+func (u *UPnP) DelMapping(ctx context.Context, protocol string, port int) error {
+	proto, err := upnpProtocol(protocol)
+	if err != nil {
+		return err
+	}
+	_, err = u.soap(ctx, "DeletePortMapping", [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(port)},
+		{"NewProtocol", proto},
+	})
+	return err
+}
+
+// ExternalIP implements Mapper.
+func (u *UPnP) ExternalIP(ctx context.Context) (net.IP, error) {
+	b, err := u.soap(ctx, "GetExternalIPAddress", nil)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		IP string `xml:"Body>GetExternalIPAddressResponse>NewExternalIPAddress"`
+	}
+	if err := xml.Unmarshal(b, &resp); err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(resp.IP)
+	if ip == nil {
+		return nil, fmt.Errorf("upnp: invalid external address %q", resp.IP)
+	}
+	return ip, nil
+}
+
+// localIP returns the address of this host as seen by the gateway.
+func (u *UPnP) localIP() (net.IP, error) {
+	cu, err := url.Parse(u.ControlURL)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := net.LookupIP(cu.Hostname())
+	if err != nil || len(ips) == 0 {
+		return nil, fmt.Errorf("upnp: unable to resolve gateway address: %v", err)
+	}
+	return localIP(ips[0])
+}
@@ -0,0 +1,44 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/booster-proj/booster/events"
+)
+
+// ErrDesktopUnsupported is returned by Desktop when the platform does
+// not support desktop notifications.
+var ErrDesktopUnsupported = errors.New("notify: desktop notifications are not supported on this platform")
+
+// Desktop is a Notifier that shows the events as desktop notifications,
+// using notify-send on Linux and osascript on macOS.
+type Desktop struct{}
+
+// Notify implements Notifier.
+func (Desktop) Notify(ctx context.Context, e events.Event) error {
+	cmd := desktopCommand(ctx, "booster", fmt.Sprintf("%v: %v", e.Topic, e.Message))
+	if cmd == nil {
+		return ErrDesktopUnsupported
+	}
+	if b, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("notify: %v: %v: %s", cmd.Path, err, b)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+var scriptEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+func desktopCommand(ctx context.Context, title, body string) *exec.Cmd {
+	script := fmt.Sprintf(`display notification "%s" with title "%s"`, scriptEscaper.Replace(body), scriptEscaper.Replace(title))
+	return exec.CommandContext(ctx, "osascript", "-e", script)
+}
@@ -0,0 +1,140 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package notify delivers the events published by booster's components
+// to the user, e.g. when a source goes down. The events can be posted
+// to a webhook, sent by email or shown as desktop notifications.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/booster-proj/booster/events"
+	"upspin.io/log"
+)
+
+// DefaultCooldown is the default minimum interval between two
+// notifications of the same event.
+const DefaultCooldown = time.Minute * 5
+
+// DefaultTimeout is the maximum amount of time a notification is
+// allowed to take, when no Timeout is provided.
+const DefaultTimeout = time.Second * 10
+
+// Notifier is implemented by the notification channels.
+type Notifier interface {
+	Notify(ctx context.Context, e events.Event) error
+}
+
+// Text returns the human readable representation of `e`.
+func Text(e events.Event) string {
+	return fmt.Sprintf("booster %v: %v", e.Topic, e.Message)
+}
+
+// Dispatcher delivers the events published on Bus to each of its
+// Notifiers.
+type Dispatcher struct {
+	Bus       *events.Bus
+	Notifiers []Notifier
+	// Topics are the topics of the events notified. If empty, every
+	// event is.
+	Topics []string
+	// Cooldown is the minimum interval between two notifications of
+	// events with the same topic and message, so that a flapping
+	// source does not flood the user. If zero, every event is
+	// notified.
+	Cooldown time.Duration
+	// Timeout is the maximum amount of time each notification is
+	// allowed to take. If zero, DefaultTimeout is used.
+	Timeout time.Duration
+
+	mux  sync.Mutex
+	last map[string]time.Time
+}
+
+// Run delivers the events published until `ctx` is canceled. The events
+// are delivered one at a time: the ones published while the notifiers
+// are busy are queued, and dropped when the queue is full.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	c, cancel := d.Bus.Subscribe(64)
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e := <-c:
+			if d.ShouldNotify(e, time.Now()) {
+				d.Notify(ctx, e)
+			}
+		}
+	}
+}
+
+// ShouldNotify reports whether `e`, published at `now`, has to be
+// notified, recording it if so.
+func (d *Dispatcher) ShouldNotify(e events.Event, now time.Time) bool {
+	if len(d.Topics) > 0 {
+		found := false
+		for _, v := range d.Topics {
+			if v == e.Topic {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if d.Cooldown <= 0 {
+		return true
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if d.last == nil {
+		d.last = make(map[string]time.Time)
+	}
+	key := e.Topic + "\x00" + e.Message
+	if t, ok := d.last[key]; ok && now.Sub(t) < d.Cooldown {
+		return false
+	}
+	for k, t := range d.last {
+		if now.Sub(t) >= d.Cooldown {
+			delete(d.last, k)
+		}
+	}
+	d.last[key] = now
+	return true
+}
+
+// Notify delivers `e` to each notifier. The errors are logged.
+func (d *Dispatcher) Notify(ctx context.Context, e events.Event) {
+	timeout := d.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	for _, n := range d.Notifiers {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		if err := n.Notify(ctx, e); err != nil {
+			log.Error.Printf("Notify: unable to notify %v event: %v", e.Topic, err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package notify_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/events"
+	"github.com/booster-proj/booster/notify"
+)
+
+func TestShouldNotify(t *testing.T) {
+	d := &notify.Dispatcher{
+		Topics:   []string{events.TopicSourceDown},
+		Cooldown: time.Minute,
+	}
+	now := time.Now()
+	down := events.Event{Topic: events.TopicSourceDown, Message: "source en0 is down"}
+
+	if d.ShouldNotify(events.Event{Topic: events.TopicSourceUp}, now) {
+		t.Fatalf("Events of other topics should not be notified")
+	}
+	if !d.ShouldNotify(down, now) {
+		t.Fatalf("The first event should be notified")
+	}
+	if d.ShouldNotify(down, now.Add(time.Second)) {
+		t.Fatalf("The event should not be notified again within the cooldown")
+	}
+	if !d.ShouldNotify(events.Event{Topic: events.TopicSourceDown, Message: "source en1 is down"}, now.Add(time.Second)) {
+		t.Fatalf("Events with a different message should be notified")
+	}
+	if !d.ShouldNotify(down, now.Add(time.Minute)) {
+		t.Fatalf("The event should be notified again after the cooldown")
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	c := make(chan map[string]interface{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		c <- payload
+	}))
+	defer srv.Close()
+
+	w := &notify.Webhook{URL: srv.URL}
+	e := events.Event{Topic: events.TopicSourceDown, Message: "source en0 is down"}
+	if err := w.Notify(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	payload := <-c
+	if payload["text"] != notify.Text(e) || payload["topic"] != e.Topic {
+		t.Fatalf("Unexpected payload: %v", payload)
+	}
+}
+
+func TestWebhook_status(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	w := &notify.Webhook{URL: srv.URL}
+	if err := w.Notify(context.Background(), events.Event{Topic: "foo"}); err == nil {
+		t.Fatalf("Expected an error with status 500")
+	}
+}
+
+type notifier chan events.Event
+
+func (n notifier) Notify(ctx context.Context, e events.Event) error {
+	n <- e
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	bus := new(events.Bus)
+	n := make(notifier, 2)
+	d := &notify.Dispatcher{Bus: bus, Notifiers: []notify.Notifier{n}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- d.Run(ctx) }()
+
+	// Publish until the dispatcher subscribes to the bus.
+	var got events.Event
+	for received := false; !received; {
+		bus.Publish(events.Event{Topic: "foo"})
+		select {
+		case got = <-n:
+			received = true
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+	if got.Topic != "foo" {
+		t.Fatalf("Unexpected event: %v", got)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/booster-proj/booster/events"
+)
+
+// Webhook is a Notifier that POSTs the events to URL. The body is
+// compatible with the Slack incoming webhooks: the `text` field
+// contains the representation of the event returned by Text, and
+// the other fields its content, i.e. `topic`, `time`, `message` and
+// `data`.
+type Webhook struct {
+	URL string
+	// Client is used to perform the requests. If nil,
+	// http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Notify implements Notifier.
+func (w *Webhook) Notify(ctx context.Context, e events.Event) error {
+	b, err := json.Marshal(struct {
+		Text string `json:"text"`
+		events.Event
+	}{
+		Text:  Text(e),
+		Event: e,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", w.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notify: webhook %v: unexpected status: %v", w.URL, resp.Status)
+	}
+	return nil
+}
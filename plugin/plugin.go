@@ -0,0 +1,359 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package plugin loads policy and strategy plugins compiled to
+// WebAssembly, extending booster without forking it.
+//
+// A plugin is a WebAssembly module exporting its memory and at least
+// one of these functions:
+//
+//	accept(source i32) i32   policy: non zero if the source can be used
+//	                         for the connection to the current address
+//	choose() i32             strategy: the index of the source to use
+//
+// The sources are identified by their index, and the module can
+// import from the "booster" module the functions that describe them:
+//
+//	source_count() i32                        number of sources
+//	source_id(source, ptr, len i32) i32       copies the identifier of the
+//	                                          source to ptr, if it fits into
+//	                                          len bytes, returns its length
+//	source_stat(source, stat i32) i64         statistic of the source, see
+//	                                          the Stat constants, -1 if unknown
+//	address(ptr, len i32) i32                 like source_id, for the address
+//	                                          of the connection, policies only
+//	log(ptr, len i32)                         logs a message
+//
+// Plugins targeting WASI preview 1 are supported as well, even though
+// they have no access to the file system and cannot wait. If the
+// module exports `_initialize`, it is called once loaded.
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/probe"
+	"github.com/booster-proj/booster/store"
+	"github.com/booster-proj/booster/wasm"
+	"upspin.io/log"
+)
+
+// Statistics exposed to the plugins through source_stat.
+const (
+	// StatConns is the number of connections open.
+	StatConns int32 = iota
+	// StatMetered is 1 if the source is metered, 0 otherwise.
+	StatMetered
+	// StatTier is the tier of the source.
+	StatTier
+	// StatWeight is the weight of the source, see core.SourceGroup.
+	StatWeight
+	// StatRTT is the mean round trip time measured by the
+	// probes, in microseconds.
+	StatRTT
+	// StatLoss is the ratio of the probes lost, per thousand.
+	StatLoss
+)
+
+// DefaultFuel is the maximum number of instructions executed by each
+// call to a plugin, after which it is aborted.
+const DefaultFuel = 10000000
+
+// Host provides the information about the sources that the plugins
+// can query.
+type Host struct {
+	Store *store.SourceStore
+	// Probes, if not nil, provides the latency statistics.
+	Probes *probe.Prober
+}
+
+// Plugin is a loaded plugin. It is safe for concurrent use, but the
+// calls to the module are serialized.
+type Plugin struct {
+	Name string
+
+	host *Host
+
+	mux sync.Mutex
+	in  *wasm.Instance
+	// The state of the call in progress.
+	sources []core.Source
+	address string
+}
+
+// Load loads the plugin at `path`, named after its file name.
+func Load(path string, h *Host) (*Plugin, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return New(name, b, h)
+}
+
+// LoadDir loads every plugin, i.e. ".wasm" file, in `dir`.
+func LoadDir(dir string, h *Host) ([]*Plugin, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.wasm"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var plugins []*Plugin
+	for _, path := range paths {
+		p, err := Load(path, h)
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s: %v", path, err)
+		}
+		plugins = append(plugins, p)
+	}
+	return plugins, nil
+}
+
+// New instantiates plugin `name` from the binary module `b`.
+func New(name string, b []byte, h *Host) (*Plugin, error) {
+	m, err := wasm.Decode(b)
+	if err != nil {
+		return nil, err
+	}
+	p := &Plugin{Name: name, host: h}
+	p.in, err = wasm.Instantiate(m, wasm.Imports{
+		"booster":                p.api(),
+		"wasi_snapshot_preview1": p.wasi(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !p.IsPolicy() && !p.IsStrategy() {
+		return nil, fmt.Errorf("module exports neither accept nor choose")
+	}
+	if p.in.Exported("_initialize") {
+		// The initialization of some runtimes is expensive:
+		// do not limit it.
+		if _, err := p.in.Call("_initialize"); err != nil {
+			return nil, err
+		}
+	}
+	p.in.Fuel = DefaultFuel
+	return p, nil
+}
+
+// IsPolicy reports whether the plugin provides a policy.
+func (p *Plugin) IsPolicy() bool {
+	return p.in.Exported("accept")
+}
+
+// IsStrategy reports whether the plugin provides a strategy.
+func (p *Plugin) IsStrategy() bool {
+	return p.in.Exported("choose")
+}
+
+// Policy returns the policy provided by the plugin.
+func (p *Plugin) Policy(issuer string) *store.PluginPolicy {
+	return store.NewPluginPolicy(issuer, p.Name, p.Accept)
+}
+
+// Accept reports whether source `id` can be used for the connection
+// to `address`, according to the plugin. If the plugin fails, the
+// source is accepted.
+func (p *Plugin) Accept(id, address string) bool {
+	var sources []core.Source
+	idx := -1
+	if s := p.host.Store; s != nil {
+		s.Do(func(src core.Source) {
+			if src.ID() == id {
+				idx = len(sources)
+			}
+			sources = append(sources, src)
+		})
+	}
+	if idx < 0 {
+		idx = len(sources)
+		sources = append(sources, unknown(id))
+	}
+
+	res, err := p.call("accept", sources, address, uint64(idx))
+	if err != nil {
+		log.Error.Printf("Plugin %s: accept: %v", p.Name, err)
+		return true
+	}
+	return uint32(res) != 0
+}
+
+// Strategy is a core.Strategy that lets the plugin choose the source,
+// among the ones that are not blacklisted. If the plugin fails, the
+// sources are returned in round robin order.
+func (p *Plugin) Strategy(ctx context.Context, r *core.Ring) (core.Source, error) {
+	var sources []core.Source
+	r.Do(func(src core.Source) {
+		if src != nil && !core.Blacklisted(ctx, src.ID()) {
+			sources = append(sources, src)
+		}
+	})
+	if len(sources) == 0 {
+		// Every source is blacklisted: let the balancer fail.
+		return r.Source(), nil
+	}
+
+	res, err := p.call("choose", sources, "")
+	if err == nil && int32(res) >= 0 && int(int32(res)) < len(sources) {
+		return sources[int32(res)], nil
+	}
+	if err == nil {
+		err = fmt.Errorf("invalid source index %d", int32(res))
+	}
+	log.Error.Printf("Plugin %s: choose: %v", p.Name, err)
+	return core.RoundRobin(ctx, r)
+}
+
+func (p *Plugin) call(name string, sources []core.Source, address string, args ...uint64) (uint64, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	p.sources, p.address = sources, address
+	defer func() { p.sources, p.address = nil, "" }()
+
+	res, err := p.in.Call(name, args...)
+	if err != nil {
+		return 0, err
+	}
+	if len(res) != 1 {
+		return 0, fmt.Errorf("%s returned %d values", name, len(res))
+	}
+	return res[0], nil
+}
+
+// api returns the functions of the "booster" module.
+func (p *Plugin) api() map[string]wasm.HostFunc {
+	i32, i64 := wasm.I32, wasm.I64
+	fn := func(params []wasm.ValType, results []wasm.ValType, f func(in *wasm.Instance, args []uint64) uint64) wasm.HostFunc {
+		return wasm.HostFunc{
+			Type: wasm.FuncType{Params: params, Results: results},
+			Func: func(in *wasm.Instance, args []uint64) ([]uint64, error) {
+				v := f(in, args)
+				if len(results) == 0 {
+					return nil, nil
+				}
+				return []uint64{v}, nil
+			},
+		}
+	}
+	// put copies `s` into the memory, if it fits.
+	put := func(in *wasm.Instance, s string, ptr, n uint64) uint64 {
+		if buf, ok := p.bytes(in, ptr, n); ok && len(s) <= len(buf) {
+			copy(buf, s)
+		}
+		return uint64(len(s))
+	}
+
+	return map[string]wasm.HostFunc{
+		"source_count": fn(nil, []wasm.ValType{i32}, func(in *wasm.Instance, args []uint64) uint64 {
+			return uint64(len(p.sources))
+		}),
+		"source_id": fn([]wasm.ValType{i32, i32, i32}, []wasm.ValType{i32}, func(in *wasm.Instance, args []uint64) uint64 {
+			src := p.source(args[0])
+			if src == nil {
+				return uint64(^uint32(0))
+			}
+			return put(in, src.ID(), args[1], args[2])
+		}),
+		"source_stat": fn([]wasm.ValType{i32, i32}, []wasm.ValType{i64}, func(in *wasm.Instance, args []uint64) uint64 {
+			src := p.source(args[0])
+			if src == nil {
+				return ^uint64(0)
+			}
+			return uint64(p.stat(src, int32(args[1])))
+		}),
+		"address": fn([]wasm.ValType{i32, i32}, []wasm.ValType{i32}, func(in *wasm.Instance, args []uint64) uint64 {
+			return put(in, p.address, args[0], args[1])
+		}),
+		"log": fn([]wasm.ValType{i32, i32}, nil, func(in *wasm.Instance, args []uint64) uint64 {
+			if buf, ok := p.bytes(in, args[0], args[1]); ok {
+				log.Info.Printf("Plugin %s: %s", p.Name, buf)
+			}
+			return 0
+		}),
+	}
+}
+
+// unknown is a source that is not part of the store.
+type unknown string
+
+func (s unknown) ID() string {
+	return string(s)
+}
+
+func (s unknown) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return nil, fmt.Errorf("source %s is not available", string(s))
+}
+
+func (s unknown) Close() error {
+	return nil
+}
+
+func (p *Plugin) source(idx uint64) core.Source {
+	i := int(int32(idx))
+	if i < 0 || i >= len(p.sources) {
+		return nil
+	}
+	return p.sources[i]
+}
+
+func (p *Plugin) stat(src core.Source, stat int32) int64 {
+	id := src.ID()
+	switch stat {
+	case StatConns:
+		if l, ok := src.(interface{ Len() int }); ok {
+			return int64(l.Len())
+		}
+	case StatMetered:
+		if s := p.host.Store; s != nil {
+			if s.IsMetered(id) {
+				return 1
+			}
+			return 0
+		}
+	case StatTier:
+		if s := p.host.Store; s != nil {
+			return int64(s.SourceTier(id))
+		}
+	case StatWeight:
+		if s := p.host.Store; s != nil {
+			return int64(s.Weight(id))
+		}
+	case StatRTT, StatLoss:
+		if p.host.Probes == nil {
+			break
+		}
+		st, ok := p.host.Probes.Stats(id)
+		if !ok || st.Samples == 0 {
+			break
+		}
+		if stat == StatRTT {
+			return int64(st.RTT / time.Microsecond)
+		}
+		return int64(st.Loss * 1000)
+	}
+	return -1
+}
@@ -0,0 +1,135 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package plugin_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/plugin"
+	"github.com/booster-proj/booster/store"
+)
+
+type mock struct {
+	id string
+}
+
+func (s *mock) ID() string {
+	return s.id
+}
+
+func (s *mock) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (s *mock) Close() error {
+	return nil
+}
+
+func section(id byte, b ...byte) []byte {
+	return append([]byte{id, byte(len(b))}, b...)
+}
+
+// testModule returns a plugin that accepts only the sources that are
+// not metered, and that chooses the last source available.
+func testModule() []byte {
+	return bytes.Join([][]byte{
+		[]byte("\x00asm\x01\x00\x00\x00"),
+		section(1, 3,
+			0x60, 2, 0x7f, 0x7f, 1, 0x7e, // (i32, i32) -> i64
+			0x60, 0, 1, 0x7f, // () -> i32
+			0x60, 1, 0x7f, 1, 0x7f, // (i32) -> i32
+		),
+		section(2, 2,
+			7, 'b', 'o', 'o', 's', 't', 'e', 'r', 11, 's', 'o', 'u', 'r', 'c', 'e', '_', 's', 't', 'a', 't', 0, 0,
+			7, 'b', 'o', 'o', 's', 't', 'e', 'r', 12, 's', 'o', 'u', 'r', 'c', 'e', '_', 'c', 'o', 'u', 'n', 't', 0, 1,
+		),
+		section(3, 2, 2, 1),
+		section(7, 2,
+			6, 'a', 'c', 'c', 'e', 'p', 't', 0, 2,
+			6, 'c', 'h', 'o', 'o', 's', 'e', 0, 3,
+		),
+		section(10, 2,
+			// source_stat(source, StatMetered) == 0
+			9, 0, 0x20, 0, 0x41, byte(plugin.StatMetered), 0x10, 0, 0x50, 0x0b,
+			// source_count() - 1
+			7, 0, 0x10, 1, 0x41, 1, 0x6b, 0x0b,
+		),
+	}, nil)
+}
+
+func TestPlugin(t *testing.T) {
+	s0, s1 := &mock{id: "s0"}, &mock{id: "s1"}
+	b := new(core.Balancer)
+	s := store.New(b)
+	s.Put(s0, s1)
+	s.SetMetered(s0.ID(), true)
+
+	p, err := plugin.New("test", testModule(), &plugin.Host{Store: s})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !p.IsPolicy() || !p.IsStrategy() {
+		t.Fatalf("Plugin should provide both a policy and a strategy")
+	}
+
+	if p.Accept(s0.ID(), "example.com") {
+		t.Fatalf("Source %v is metered and should not be accepted", s0)
+	}
+	if !p.Accept(s1.ID(), "example.com") {
+		t.Fatalf("Source %v should be accepted", s1)
+	}
+	if !p.Accept("s2", "example.com") {
+		t.Fatalf("Unknown sources are not metered and should be accepted")
+	}
+
+	if err := s.AppendPolicy(p.Policy("test")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ok, _ := s.ShouldAccept(s0.ID(), "example.com:443"); ok {
+		t.Fatalf("Source %v should be blocked by the plugin policy", s0)
+	}
+
+	b.Strategy = p.Strategy
+	src, err := b.Get(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if src.ID() != s1.ID() {
+		t.Fatalf("Unexpected source: wanted %v, found %v", s1, src)
+	}
+	src, err = b.Get(context.Background(), s1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if src.ID() != s0.ID() {
+		t.Fatalf("Blacklisted sources should not be candidates: wanted %v, found %v", s0, src)
+	}
+}
+
+func TestNew_invalid(t *testing.T) {
+	empty := []byte("\x00asm\x01\x00\x00\x00")
+	if _, err := plugin.New("empty", empty, &plugin.Host{}); err == nil {
+		t.Fatalf("Modules exporting neither accept nor choose should be rejected")
+	}
+	if _, err := plugin.New("garbage", []byte("garbage"), &plugin.Host{}); err == nil {
+		t.Fatalf("Invalid modules should be rejected")
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package plugin
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/booster-proj/booster/wasm"
+	"upspin.io/log"
+)
+
+// WASI errno values.
+const (
+	errnoSuccess = 0
+	errnoBadf    = 8
+	errnoFault   = 21
+	errnoNosys   = 52
+)
+
+// exitError is returned when the plugin calls proc_exit.
+type exitError int
+
+func (e exitError) Error() string {
+	return fmt.Sprintf("plugin exited with code %d", int(e))
+}
+
+// wasi returns a minimal implementation of WASI preview 1, enough for
+// the runtimes of the toolchains that target it: there is no file
+// system, no arguments and no environment, the standard output and
+// error are logged.
+func (p *Plugin) wasi() map[string]wasm.HostFunc {
+	i32, i64 := wasm.I32, wasm.I64
+	errno := func(params ...wasm.ValType) wasm.FuncType {
+		return wasm.FuncType{Params: params, Results: []wasm.ValType{i32}}
+	}
+	ret := func(v uint64) ([]uint64, error) {
+		return []uint64{v}, nil
+	}
+	zeros := func(in *wasm.Instance, args []uint64) ([]uint64, error) {
+		for _, ptr := range args {
+			if !p.putUint32(in, ptr, 0) {
+				return ret(errnoFault)
+			}
+		}
+		return ret(errnoSuccess)
+	}
+
+	return map[string]wasm.HostFunc{
+		"args_get":          {Type: errno(i32, i32), Func: zeros},
+		"args_sizes_get":    {Type: errno(i32, i32), Func: zeros},
+		"environ_get":       {Type: errno(i32, i32), Func: zeros},
+		"environ_sizes_get": {Type: errno(i32, i32), Func: zeros},
+		"clock_time_get": {Type: errno(i32, i64, i32), Func: func(in *wasm.Instance, args []uint64) ([]uint64, error) {
+			mem := in.Memory()
+			ptr := uint64(uint32(args[2]))
+			if ptr+8 > uint64(len(mem)) {
+				return ret(errnoFault)
+			}
+			binary.LittleEndian.PutUint64(mem[ptr:], uint64(time.Now().UnixNano()))
+			return ret(errnoSuccess)
+		}},
+		"fd_write": {Type: errno(i32, i32, i32, i32), Func: func(in *wasm.Instance, args []uint64) ([]uint64, error) {
+			fd := uint32(args[0])
+			if fd != 1 && fd != 2 {
+				return ret(errnoBadf)
+			}
+			iovs, n := uint32(args[1]), uint32(args[2])
+			var b strings.Builder
+			for i := uint32(0); i < n; i++ {
+				buf, ok := p.read(in, iovs+i*8)
+				if !ok {
+					return ret(errnoFault)
+				}
+				b.Write(buf)
+			}
+			for _, l := range strings.Split(strings.TrimRight(b.String(), "\n"), "\n") {
+				if fd == 2 {
+					log.Error.Printf("Plugin %s: %s", p.Name, l)
+				} else {
+					log.Info.Printf("Plugin %s: %s", p.Name, l)
+				}
+			}
+			if !p.putUint32(in, args[3], uint32(b.Len())) {
+				return ret(errnoFault)
+			}
+			return ret(errnoSuccess)
+		}},
+		"random_get": {Type: errno(i32, i32), Func: func(in *wasm.Instance, args []uint64) ([]uint64, error) {
+			mem := in.Memory()
+			ptr, n := uint64(uint32(args[0])), uint64(uint32(args[1]))
+			if ptr+n > uint64(len(mem)) {
+				return ret(errnoFault)
+			}
+			if _, err := rand.Read(mem[ptr : ptr+n]); err != nil {
+				return nil, err
+			}
+			return ret(errnoSuccess)
+		}},
+		"poll_oneoff": {Type: errno(i32, i32, i32, i32), Func: func(in *wasm.Instance, args []uint64) ([]uint64, error) {
+			// Plugins are not allowed to wait: every subscription
+			// is reported as ready immediately.
+			mem := in.Memory()
+			subs, events, n := uint64(uint32(args[0])), uint64(uint32(args[1])), uint64(uint32(args[2]))
+			if subs+n*48 > uint64(len(mem)) || events+n*32 > uint64(len(mem)) {
+				return ret(errnoFault)
+			}
+			for i := uint64(0); i < n; i++ {
+				s, e := mem[subs+i*48:], mem[events+i*32:events+i*32+32]
+				for j := range e {
+					e[j] = 0
+				}
+				copy(e[0:8], s[0:8]) // userdata
+				e[10] = s[8]         // type
+			}
+			if !p.putUint32(in, args[3], uint32(n)) {
+				return ret(errnoFault)
+			}
+			return ret(errnoSuccess)
+		}},
+		"sched_yield": {Type: errno(), Func: func(in *wasm.Instance, args []uint64) ([]uint64, error) {
+			return ret(errnoSuccess)
+		}},
+		"proc_exit": {Type: wasm.FuncType{Params: []wasm.ValType{i32}}, Func: func(in *wasm.Instance, args []uint64) ([]uint64, error) {
+			return nil, exitError(int32(args[0]))
+		}},
+		"fd_close": {Type: errno(i32), Func: func(in *wasm.Instance, args []uint64) ([]uint64, error) {
+			return ret(errnoBadf)
+		}},
+		"fd_fdstat_get": {Type: errno(i32, i32), Func: func(in *wasm.Instance, args []uint64) ([]uint64, error) {
+			if uint32(args[0]) > 2 {
+				return ret(errnoBadf)
+			}
+			mem := in.Memory()
+			ptr := uint64(uint32(args[1]))
+			if ptr+24 > uint64(len(mem)) {
+				return ret(errnoFault)
+			}
+			st := mem[ptr : ptr+24]
+			for i := range st {
+				st[i] = 0
+			}
+			st[0] = 2 // character device
+			return ret(errnoSuccess)
+		}},
+		"fd_fdstat_set_flags": {Type: errno(i32, i32), Func: func(in *wasm.Instance, args []uint64) ([]uint64, error) {
+			return ret(errnoNosys)
+		}},
+		"fd_prestat_get": {Type: errno(i32, i32), Func: func(in *wasm.Instance, args []uint64) ([]uint64, error) {
+			return ret(errnoBadf)
+		}},
+		"fd_prestat_dir_name": {Type: errno(i32, i32, i32), Func: func(in *wasm.Instance, args []uint64) ([]uint64, error) {
+			return ret(errnoBadf)
+		}},
+	}
+}
+
+// read reads the buffer described by the (pointer, length) pair
+// stored at `ptr`.
+func (p *Plugin) read(in *wasm.Instance, ptr uint32) ([]byte, bool) {
+	mem := in.Memory()
+	if uint64(ptr)+8 > uint64(len(mem)) {
+		return nil, false
+	}
+	return p.bytes(in, uint64(binary.LittleEndian.Uint32(mem[ptr:])), uint64(binary.LittleEndian.Uint32(mem[ptr+4:])))
+}
+
+func (p *Plugin) bytes(in *wasm.Instance, ptr, n uint64) ([]byte, bool) {
+	mem := in.Memory()
+	ptr, n = uint64(uint32(ptr)), uint64(uint32(n))
+	if ptr+n > uint64(len(mem)) {
+		return nil, false
+	}
+	return mem[ptr : ptr+n], true
+}
+
+func (p *Plugin) putUint32(in *wasm.Instance, ptr uint64, v uint32) bool {
+	mem := in.Memory()
+	ptr = uint64(uint32(ptr))
+	if ptr+4 > uint64(len(mem)) {
+		return false
+	}
+	binary.LittleEndian.PutUint32(mem[ptr:], v)
+	return true
+}
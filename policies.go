@@ -0,0 +1,179 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package booster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/booster-proj/booster/acl"
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/plugin"
+	"github.com/booster-proj/booster/protocol"
+	"github.com/booster-proj/booster/proxyproto"
+	"github.com/booster-proj/booster/schedule"
+	"github.com/booster-proj/booster/store"
+	"upspin.io/log"
+)
+
+// initClientRules loads the access control lists and the schedules
+// applied to the clients of the proxies.
+func (bst *Booster) initClientRules() error {
+	c := bst.conf
+	var err error
+	if bst.acl, err = acl.New(acl.Rules{Allow: c.AllowClients, Deny: c.DenyClients}); err != nil {
+		return fmt.Errorf("%v, use --allow-clients and --deny-clients", err)
+	}
+	bst.sched = &schedule.Schedules{File: c.SchedulesFile}
+	if err := bst.sched.Load(); err != nil {
+		return fmt.Errorf("%v, use --schedules-file", err)
+	}
+	return nil
+}
+
+// scopes returns the scopes of the store for `listeners`, without
+// their strategies, set by Booster.strategy.
+func scopes(rs *store.SourceStore, listeners []ListenerConfig) (map[string]*store.Scope, error) {
+	if len(listeners) == 0 {
+		return nil, nil
+	}
+	acc := make(map[string]*store.Scope, len(listeners))
+	ports := make(map[int]bool, len(listeners))
+	for _, v := range listeners {
+		switch {
+		case v.Name == "":
+			return nil, errors.New("listeners must have a name")
+		case v.Port <= 0:
+			return nil, fmt.Errorf("listener %s: invalid port %d", v.Name, v.Port)
+		case acc[v.Name] != nil:
+			return nil, fmt.Errorf("listener %s is configured more than once", v.Name)
+		case ports[v.Port]:
+			return nil, fmt.Errorf("listener %s: port %d is already used by another listener", v.Name, v.Port)
+		}
+		scope := &store.Scope{Name: v.Name}
+		for i, src := range v.Policies {
+			p, err := store.NewExprPolicy("listener "+v.Name, fmt.Sprintf("%s_%d", v.Name, i), src, rs.IsMetered)
+			if err != nil {
+				return nil, fmt.Errorf("listener %s: %v", v.Name, err)
+			}
+			scope.Policies = append(scope.Policies, p)
+		}
+		acc[v.Name], ports[v.Port] = scope, true
+	}
+	return acc, nil
+}
+
+// strategy returns the balancing strategy selected by the
+// configuration, loading the plugins, and sets the strategies of the
+// scopes of the listeners.
+func (bst *Booster) strategy() (core.Strategy, error) {
+	c := bst.conf
+	plugins := make(map[string]*plugin.Plugin)
+	if c.PluginsDir != "" {
+		l, err := plugin.LoadDir(c.PluginsDir, &plugin.Host{Store: bst.store, Probes: bst.prober})
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range l {
+			log.Info.Printf("Loaded plugin %s (policy: %v, strategy: %v)", p.Name, p.IsPolicy(), p.IsStrategy())
+			plugins[p.Name] = p
+			if !p.IsPolicy() {
+				continue
+			}
+			if err := bst.store.AppendPolicy(p.Policy("plugin")); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, v := range c.Listeners {
+		if v.Strategy == "" {
+			continue
+		}
+		s, err := bst.namedStrategy(v.Strategy, plugins)
+		if err != nil {
+			return nil, fmt.Errorf("listener %s: %v", v.Name, err)
+		}
+		bst.store.Scopes[v.Name].Strategy = s
+	}
+
+	s, err := bst.namedStrategy(c.Strategy, plugins)
+	if err != nil || len(c.ProtocolStrategies) == 0 {
+		return s, err
+	}
+	m := make(map[protocol.Protocol]core.Strategy, len(c.ProtocolStrategies))
+	for k, v := range c.ProtocolStrategies {
+		p, err := protocol.Parse(k)
+		if err != nil {
+			return nil, err
+		}
+		if m[p], err = bst.namedStrategy(v, plugins); err != nil {
+			return nil, fmt.Errorf("%v protocol: %v", p, err)
+		}
+		log.Info.Printf("Using strategy %s for the %v connections", v, p)
+	}
+	return protocol.Strategy(m, s), nil
+}
+
+// namedStrategy returns the strategy called `name`.
+func (bst *Booster) namedStrategy(name string, plugins map[string]*plugin.Plugin) (core.Strategy, error) {
+	switch pname := strings.TrimPrefix(name, "plugin:"); {
+	case pname != name:
+		p, ok := plugins[pname]
+		if !ok || !p.IsStrategy() {
+			return nil, fmt.Errorf("plugin %q does not provide a strategy", pname)
+		}
+		return p.Strategy, nil
+	case name == "round-robin", name == "":
+		return core.RoundRobin, nil
+	case name == "weighted":
+		return core.WeightedRoundRobin(bst.store.Weight), nil
+	case name == "latency":
+		if bst.prober == nil {
+			return nil, fmt.Errorf("latency strategy requires probing, use a probe interval greater than 0")
+		}
+		return bst.prober.Strategy, nil
+	case name == "bandwidth":
+		return bst.tester.Strategy, nil
+	case name == "hash":
+		var key func(context.Context) string
+		if bst.conf.HashClient {
+			key = hashClientKey
+		}
+		return core.ConsistentHash(bst.store.Weight, key), nil
+	default:
+		return nil, fmt.Errorf("unknown strategy %q", name)
+	}
+}
+
+// hashClientKey returns the key of the hash strategy for the connection
+// described by `ctx`: its destination and, when known, the address of
+// its client.
+func hashClientKey(ctx context.Context) string {
+	target, _ := core.TargetFromContext(ctx)
+	src, _, ok := proxyproto.ClientFromContext(ctx)
+	if !ok {
+		return target
+	}
+	host, _, err := net.SplitHostPort(src.String())
+	if err != nil {
+		host = src.String()
+	}
+	return host + "|" + target
+}
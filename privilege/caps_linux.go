@@ -0,0 +1,75 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package privilege
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// capSets are the capability sets that must be empty after dropping
+// privileges.
+var capSets = []string{"CapInh", "CapPrm", "CapEff", "CapAmb"}
+
+// checkCapabilities ensures that no thread of the process holds
+// any capability, as capabilities are a per thread attribute.
+func checkCapabilities() error {
+	tasks, err := filepath.Glob("/proc/self/task/*/status")
+	if err != nil {
+		return err
+	}
+	for _, v := range tasks {
+		caps, err := readCapabilities(v)
+		if err != nil {
+			return fmt.Errorf("privilege: unable to read capabilities: %v", err)
+		}
+		for _, set := range capSets {
+			if caps[set] != 0 {
+				return fmt.Errorf("privilege: %s still has capabilities %s %#x", v, set, caps[set])
+			}
+		}
+	}
+	return nil
+}
+
+// readCapabilities parses the capability sets contained in the
+// /proc status file at `path`.
+func readCapabilities(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	acc := make(map[string]uint64)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 2 || !strings.HasPrefix(fields[0], "Cap") {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[1], 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		acc[strings.TrimSuffix(fields[0], ":")] = v
+	}
+	return acc, s.Err()
+}
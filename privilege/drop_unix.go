@@ -0,0 +1,41 @@
+//go:build linux || darwin
+// +build linux darwin
+
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package privilege
+
+import (
+	"fmt"
+	"syscall"
+)
+
+func drop(c Credentials) error {
+	// Groups first, as they cannot be changed once the uid is not
+	// root anymore.
+	if err := syscall.Setgroups([]int{}); err != nil {
+		return fmt.Errorf("privilege: unable to clear supplementary groups: %v", err)
+	}
+	if err := syscall.Setgid(c.GID); err != nil {
+		return fmt.Errorf("privilege: unable to set gid %d: %v", c.GID, err)
+	}
+	// Changing the uid from root to a non zero one clears the
+	// permitted and effective capabilities too.
+	if err := syscall.Setuid(c.UID); err != nil {
+		return fmt.Errorf("privilege: unable to set uid %d: %v", c.UID, err)
+	}
+	return checkCapabilities()
+}
@@ -0,0 +1,77 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package privilege allows booster to give up root privileges once
+// the operations that require them, e.g. binding low ports, have been
+// performed.
+package privilege
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+)
+
+// Credentials identify the user and group booster runs as after
+// dropping its privileges.
+type Credentials struct {
+	UID int
+	GID int
+}
+
+// Lookup returns the credentials of `username`, which is either a user
+// name or a numeric uid. If `group` is empty, the primary group of the
+// user is used.
+func Lookup(username, group string) (Credentials, error) {
+	u, err := user.Lookup(username)
+	if err != nil {
+		if u, err = user.LookupId(username); err != nil {
+			return Credentials{}, fmt.Errorf("privilege: unknown user %q", username)
+		}
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("privilege: unsupported uid %q of user %s", u.Uid, username)
+	}
+
+	gids := u.Gid
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			if g, err = user.LookupGroupId(group); err != nil {
+				return Credentials{}, fmt.Errorf("privilege: unknown group %q", group)
+			}
+		}
+		gids = g.Gid
+	}
+	gid, err := strconv.Atoi(gids)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("privilege: unsupported gid %q", gids)
+	}
+
+	return Credentials{UID: uid, GID: gid}, nil
+}
+
+// Drop makes the process run with credentials `c`, clearing the
+// supplementary groups. On Linux, capabilities are cleared as well
+// and Drop fails if any thread still holds one.
+// Operations requiring privileges, e.g. binding ports < 1024, will
+// fail afterwards: perform them before calling Drop.
+func Drop(c Credentials) error {
+	if c.UID == 0 {
+		return fmt.Errorf("privilege: refusing to drop privileges to root")
+	}
+	return drop(c)
+}
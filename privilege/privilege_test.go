@@ -0,0 +1,54 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package privilege_test
+
+import (
+	"os/user"
+	"strconv"
+	"testing"
+
+	"github.com/booster-proj/booster/privilege"
+)
+
+func TestLookup(t *testing.T) {
+	u, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	for _, v := range []string{u.Username, u.Uid} {
+		c, err := privilege.Lookup(v, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strconv.Itoa(c.UID) != u.Uid || strconv.Itoa(c.GID) != u.Gid {
+			t.Fatalf("Unexpected credentials for %s: %+v", v, c)
+		}
+	}
+
+	if _, err := privilege.Lookup("booster-no-such-user", ""); err == nil {
+		t.Fatal("Unknown users should not be accepted")
+	}
+	if _, err := privilege.Lookup(u.Username, "booster-no-such-group"); err == nil {
+		t.Fatal("Unknown groups should not be accepted")
+	}
+}
+
+func TestDrop_root(t *testing.T) {
+	if err := privilege.Drop(privilege.Credentials{}); err == nil {
+		t.Fatal("Dropping privileges to root should not be allowed")
+	}
+}
@@ -0,0 +1,301 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package probe continuously measures the round trip time and the
+// packet loss of each source, dialing a TCP connection through it to
+// a well known anchor.
+package probe
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+	"upspin.io/log"
+)
+
+// Defaults used when the Prober fields are not set.
+const (
+	DefaultAnchor   = "1.1.1.1:443"
+	DefaultInterval = time.Second * 5
+	DefaultTimeout  = time.Second * 2
+	DefaultWindow   = 20
+)
+
+// Store describes the entity that contains the sources to probe.
+type Store interface {
+	Do(func(core.Source))
+}
+
+// Exporter is the entity the measurements are sent to.
+type Exporter interface {
+	SetProbeStats(labels map[string]string, rtt time.Duration, loss float64)
+}
+
+// Stats contains the measurements of a source, computed over the
+// last `Samples` probes.
+type Stats struct {
+	// RTT is the mean round trip time of the successful probes.
+	RTT time.Duration `json:"rtt"`
+	// Loss is the ratio of failed probes, from 0 to 1.
+	Loss    float64   `json:"loss"`
+	Samples int       `json:"samples"`
+	Updated time.Time `json:"updated"`
+}
+
+type sample struct {
+	rtt time.Duration
+	ok  bool
+}
+
+// Prober probes the sources of its Store every Interval. Its zero
+// value is not ready to be used: Store must be set.
+type Prober struct {
+	Store Store
+	// Anchor is the host:port dialed to perform the measurements.
+	Anchor   string
+	Interval time.Duration
+	Timeout  time.Duration
+	// Window is the number of probes used to compute the stats.
+	Window   int
+	Exporter Exporter
+
+	mux     sync.Mutex
+	samples map[string][]sample
+	updated map[string]time.Time
+	// failing records when the sources whose last probe failed
+	// started failing.
+	failing map[string]time.Time
+}
+
+func (p *Prober) anchor() string {
+	if p.Anchor == "" {
+		return DefaultAnchor
+	}
+	return p.Anchor
+}
+
+func (p *Prober) interval() time.Duration {
+	if p.Interval <= 0 {
+		return DefaultInterval
+	}
+	return p.Interval
+}
+
+func (p *Prober) timeout() time.Duration {
+	if p.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return p.Timeout
+}
+
+func (p *Prober) window() int {
+	if p.Window <= 0 {
+		return DefaultWindow
+	}
+	return p.Window
+}
+
+// Run probes the sources every Interval, until the context is canceled.
+func (p *Prober) Run(ctx context.Context) error {
+	for {
+		p.ProbeAll(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(p.interval()):
+		}
+	}
+}
+
+// ProbeAll probes each source concurrently, and waits for the
+// measurements to complete. The stats of the sources that are no
+// longer stored are discarded.
+func (p *Prober) ProbeAll(ctx context.Context) {
+	var sources []core.Source
+	p.Store.Do(func(src core.Source) {
+		sources = append(sources, src)
+	})
+
+	var wg sync.WaitGroup
+	for _, v := range sources {
+		wg.Add(1)
+		go func(src core.Source) {
+			defer wg.Done()
+			p.Probe(ctx, src)
+		}(v)
+	}
+	wg.Wait()
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for id := range p.samples {
+		found := false
+		for _, v := range sources {
+			if v.ID() == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			delete(p.samples, id)
+			delete(p.updated, id)
+			delete(p.failing, id)
+		}
+	}
+}
+
+// Probe performs a single measurement on `src`.
+func (p *Prober) Probe(ctx context.Context, src core.Source) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout())
+	defer cancel()
+
+	start := time.Now()
+	conn, err := src.DialContext(ctx, "tcp", p.anchor())
+	s := sample{rtt: time.Since(start), ok: err == nil}
+	if err == nil {
+		conn.Close()
+	} else {
+		if ctx.Err() != nil && ctx.Err() != context.DeadlineExceeded {
+			// The prober is stopping, this is not a loss.
+			return
+		}
+		log.Debug.Printf("Prober: %v: %v", src.ID(), err)
+	}
+
+	p.mux.Lock()
+	if p.samples == nil {
+		p.samples = make(map[string][]sample)
+		p.updated = make(map[string]time.Time)
+		p.failing = make(map[string]time.Time)
+	}
+	if _, failing := p.failing[src.ID()]; s.ok {
+		delete(p.failing, src.ID())
+	} else if !failing {
+		p.failing[src.ID()] = start
+	}
+	acc := append(p.samples[src.ID()], s)
+	if n := len(acc) - p.window(); n > 0 {
+		acc = acc[n:]
+	}
+	p.samples[src.ID()] = acc
+	p.updated[src.ID()] = time.Now()
+	stats := p.stats(src.ID())
+	p.mux.Unlock()
+
+	if exp := p.Exporter; exp != nil {
+		exp.SetProbeStats(map[string]string{"source": src.ID()}, stats.RTT, stats.Loss)
+	}
+}
+
+func (p *Prober) stats(id string) Stats {
+	acc := p.samples[id]
+	var sum time.Duration
+	var ok int
+	for _, v := range acc {
+		if v.ok {
+			sum += v.rtt
+			ok++
+		}
+	}
+	st := Stats{Samples: len(acc), Updated: p.updated[id]}
+	if len(acc) > 0 {
+		st.Loss = float64(len(acc)-ok) / float64(len(acc))
+	}
+	if ok > 0 {
+		st.RTT = sum / time.Duration(ok)
+	}
+	return st
+}
+
+// Stats returns the measurements of source `id`, and false if it was
+// never probed.
+func (p *Prober) Stats(id string) (Stats, bool) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if _, ok := p.samples[id]; !ok {
+		return Stats{}, false
+	}
+	return p.stats(id), true
+}
+
+// FailingSince returns when source `id` started failing its probes,
+// and false if its last probe succeeded or it was never probed.
+func (p *Prober) FailingSince(id string) (time.Time, bool) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	t, ok := p.failing[id]
+	return t, ok
+}
+
+// Snapshot returns the measurements of every source probed.
+func (p *Prober) Snapshot() map[string]Stats {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	acc := make(map[string]Stats, len(p.samples))
+	for id := range p.samples {
+		acc[id] = p.stats(id)
+	}
+	return acc
+}
+
+// score returns a value proportional to the expected connection
+// time through source `id`: the lower, the better. Sources never
+// probed have score 0, so that they are measured by real traffic
+// as well.
+func (p *Prober) score(id string) float64 {
+	st, ok := p.Stats(id)
+	if !ok || st.Samples == 0 {
+		return 0
+	}
+	if st.Loss >= 1 {
+		return math.Inf(1)
+	}
+	// Each lost probe costs on average a retransmission.
+	return float64(st.RTT) / (1 - st.Loss)
+}
+
+// Strategy is a core.Strategy that chooses the source with the lowest
+// latency, taking packet loss into account. Sources with the same
+// score are returned in round robin order.
+func (p *Prober) Strategy(ctx context.Context, r *core.Ring) (core.Source, error) {
+	var best core.Source
+	var bestScore float64
+	steps, i := 0, 0
+	// Start from the next position, so that ties rotate.
+	r.Next()
+	r.Do(func(src core.Source) {
+		defer func() { i++ }()
+		if src == nil || core.Blacklisted(ctx, src.ID()) {
+			return
+		}
+		if s := p.score(src.ID()); best == nil || s < bestScore {
+			best, bestScore, steps = src, s, i
+		}
+	})
+	if best == nil {
+		// Every source is blacklisted: let the balancer fail.
+		return r.Source(), nil
+	}
+	for ; steps > 0; steps-- {
+		r.Next()
+	}
+	return best, nil
+}
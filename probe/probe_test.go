@@ -0,0 +1,123 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package probe_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/probe"
+)
+
+type mock struct {
+	id      string
+	latency time.Duration
+	fail    bool
+}
+
+func (s *mock) ID() string {
+	return s.id
+}
+
+func (s *mock) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	time.Sleep(s.latency)
+	if s.fail {
+		return nil, errors.New("unreachable")
+	}
+	c0, c1 := net.Pipe()
+	c1.Close()
+	return c0, nil
+}
+
+func (s *mock) Close() error {
+	return nil
+}
+
+type store []core.Source
+
+func (s store) Do(f func(core.Source)) {
+	for _, v := range s {
+		f(v)
+	}
+}
+
+func TestProbeAll(t *testing.T) {
+	s0 := &mock{id: "s0", latency: time.Millisecond * 20}
+	s1 := &mock{id: "s1", fail: true}
+	p := &probe.Prober{Store: store{s0, s1}, Window: 2}
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		p.ProbeAll(ctx)
+	}
+
+	st, ok := p.Stats(s0.ID())
+	if !ok {
+		t.Fatalf("Source %v was not probed", s0)
+	}
+	if st.Samples != 2 || st.Loss != 0 || st.RTT < s0.latency {
+		t.Fatalf("Unexpected stats for %v: %+v", s0, st)
+	}
+	st, _ = p.Stats(s1.ID())
+	if st.Loss != 1 || st.RTT != 0 {
+		t.Fatalf("Unexpected stats for %v: %+v", s1, st)
+	}
+
+	// Stats of removed sources are discarded.
+	p.Store = store{s0}
+	p.ProbeAll(ctx)
+	if _, ok := p.Stats(s1.ID()); ok {
+		t.Fatalf("Stats of %v should have been removed", s1)
+	}
+}
+
+func TestStrategy(t *testing.T) {
+	s0 := &mock{id: "s0", latency: time.Millisecond * 30}
+	s1 := &mock{id: "s1", latency: time.Millisecond * 5}
+	s2 := &mock{id: "s2", fail: true}
+	p := &probe.Prober{Store: store{s0, s1, s2}}
+	p.ProbeAll(context.Background())
+
+	b := &core.Balancer{Strategy: p.Strategy}
+	b.Put(s0, s1, s2)
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		src, err := b.Get(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if src.ID() != s1.ID() {
+			t.Fatalf("Unexpected source: wanted %v, found %v", s1, src)
+		}
+	}
+
+	src, err := b.Get(ctx, s1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.ID() != s0.ID() {
+		t.Fatalf("Unexpected source: wanted %v, found %v", s0, src)
+	}
+
+	if src, err := b.Get(ctx, s0, s1, s2); err == nil {
+		t.Fatalf("Unexpected source %v with every source blacklisted", src)
+	}
+}
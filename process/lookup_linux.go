@@ -0,0 +1,149 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package process
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// procRoot is the mount point of procfs, changed by tests.
+var procRoot = "/proc"
+
+// Lookup returns the local process owning the TCP connection from
+// `client` to `server`, i.e. the remote and local address of a
+// connection accepted by booster.
+func Lookup(client, server *net.TCPAddr) (Process, error) {
+	inode, err := findInode(client, server)
+	if err != nil {
+		return Process{}, err
+	}
+	return findOwner(inode)
+}
+
+// findInode returns the inode of the socket with `local` and `remote`
+// addresses, searching the kernel TCP tables.
+func findInode(local, remote *net.TCPAddr) (string, error) {
+	for _, v := range []string{"net/tcp", "net/tcp6"} {
+		inode, err := searchTable(filepath.Join(procRoot, v), local, remote)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		if inode != "" {
+			return inode, nil
+		}
+	}
+	return "", ErrNotFound
+}
+
+func searchTable(path string, local, remote *net.TCPAddr) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	s.Scan() // skip the header
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		l, err := parseAddr(fields[1])
+		if err != nil || !equal(l, local) {
+			continue
+		}
+		r, err := parseAddr(fields[2])
+		if err != nil || !equal(r, remote) {
+			continue
+		}
+		return fields[9], nil
+	}
+	return "", s.Err()
+}
+
+func equal(a, b *net.TCPAddr) bool {
+	return a.Port == b.Port && a.IP.Equal(b.IP)
+}
+
+// parseAddr parses an address of the kernel tables, i.e. the hex
+// encoded IP, as 32 bit words in host byte order, and port.
+func parseAddr(s string) (*net.TCPAddr, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid address %q", s)
+	}
+	b, err := hex.DecodeString(parts[0])
+	if err != nil || (len(b) != net.IPv4len && len(b) != net.IPv6len) {
+		return nil, fmt.Errorf("invalid ip %q", parts[0])
+	}
+	port, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", parts[1])
+	}
+
+	// Each word is little endian, at least on the architectures
+	// booster runs on.
+	ip := make(net.IP, len(b))
+	for i := 0; i < len(b); i += 4 {
+		ip[i], ip[i+1], ip[i+2], ip[i+3] = b[i+3], b[i+2], b[i+1], b[i]
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// findOwner returns the process holding a file descriptor of the
+// socket with `inode`.
+func findOwner(inode string) (Process, error) {
+	pids, err := ioutil.ReadDir(procRoot)
+	if err != nil {
+		return Process{}, err
+	}
+
+	target := "socket:[" + inode + "]"
+	for _, v := range pids {
+		pid, err := strconv.Atoi(v.Name())
+		if err != nil {
+			continue
+		}
+		dir := filepath.Join(procRoot, v.Name())
+		fds, err := ioutil.ReadDir(filepath.Join(dir, "fd"))
+		if err != nil {
+			// Most probably a process of another user.
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(dir, "fd", fd.Name()))
+			if err != nil || link != target {
+				continue
+			}
+			p := Process{PID: pid}
+			if b, err := ioutil.ReadFile(filepath.Join(dir, "comm")); err == nil {
+				p.Name = strings.TrimSpace(string(b))
+			}
+			p.Exe, _ = os.Readlink(filepath.Join(dir, "exe"))
+			return p, nil
+		}
+	}
+	return Process{}, ErrNotFound
+}
@@ -0,0 +1,76 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package process_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/booster-proj/booster/process"
+)
+
+func TestLookup(t *testing.T) {
+	for _, network := range []string{"tcp4", "tcp6"} {
+		ln, err := net.Listen(network, "localhost:0")
+		if err != nil {
+			t.Logf("%s not available: %v", network, err)
+			continue
+		}
+		defer ln.Close()
+
+		conn, err := net.Dial(network, ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		sconn, err := ln.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sconn.Close()
+
+		// Find ourselves, from the point of view of the server.
+		p, err := process.Lookup(sconn.RemoteAddr().(*net.TCPAddr), sconn.LocalAddr().(*net.TCPAddr))
+		if err != nil {
+			t.Fatalf("%s: %v", network, err)
+		}
+		if p.PID != os.Getpid() {
+			t.Fatalf("%s: unexpected process: %+v", network, p)
+		}
+	}
+
+	unknown := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1}
+	if _, err := process.Lookup(unknown, unknown); err != process.ErrNotFound {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	if _, ok := process.FromContext(ctx); ok {
+		t.Fatal("Empty context should not contain a process")
+	}
+	p := process.Process{PID: 1, Name: "spotify", Exe: "/usr/share/spotify/spotify"}
+	q, ok := process.FromContext(process.NewContext(ctx, p))
+	if !ok || q != p {
+		t.Fatalf("Unexpected process: %v", q)
+	}
+	if !p.Matches("spotify") || p.Matches("firefox") {
+		t.Fatal("Unexpected match")
+	}
+}
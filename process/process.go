@@ -0,0 +1,68 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package process maps local connections to the process that owns
+// them, so that connections can be routed depending on the application
+// that opened them. Supported on Linux only.
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// Process describes the owner of a connection.
+type Process struct {
+	PID int `json:"pid"`
+	// Name is the command name of the process, as reported by
+	// /proc/<pid>/comm.
+	Name string `json:"name"`
+	// Exe is the path of the executable, if it can be read.
+	Exe string `json:"exe,omitempty"`
+}
+
+func (p Process) String() string {
+	return fmt.Sprintf("%s (%d)", p.Name, p.PID)
+}
+
+// Matches reports whether the process is named `name`, either as
+// command name or executable file name.
+func (p Process) Matches(name string) bool {
+	return p.Name == name || (p.Exe != "" && filepath.Base(p.Exe) == name)
+}
+
+var (
+	// ErrNotFound is returned when no process owning the connection
+	// could be found, e.g. because it comes from another host.
+	ErrNotFound = errors.New("process: no process owns the connection")
+	// ErrUnsupported is returned on systems where processes cannot
+	// be matched.
+	ErrUnsupported = errors.New("process: process matching is only supported on linux")
+)
+
+type processKey struct{}
+
+// NewContext returns a copy of `ctx` carrying `p`.
+func NewContext(ctx context.Context, p Process) context.Context {
+	return context.WithValue(ctx, processKey{}, p)
+}
+
+// FromContext returns the process stored in `ctx`, if any.
+func FromContext(ctx context.Context) (Process, bool) {
+	p, ok := ctx.Value(processKey{}).(Process)
+	return p, ok
+}
@@ -0,0 +1,127 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package protocol classifies the connections by the first bytes sent
+// by the client, so that policies and strategies can take the
+// application protocol into account, e.g. "SSH prefers the lowest
+// latency, HTTP the highest bandwidth".
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/booster-proj/booster/core"
+)
+
+// Protocol is an application protocol.
+type Protocol string
+
+// Protocols detected.
+const (
+	HTTP       Protocol = "http"
+	TLS        Protocol = "tls"
+	SSH        Protocol = "ssh"
+	BitTorrent Protocol = "bittorrent"
+	// Unknown is the protocol of the connections that do not match
+	// any other.
+	Unknown Protocol = "unknown"
+)
+
+// Known are the protocols that can be detected, Unknown excluded.
+var Known = []Protocol{HTTP, TLS, SSH, BitTorrent}
+
+// Parse returns the protocol named `s`, case insensitive.
+func Parse(s string) (Protocol, error) {
+	p := Protocol(strings.ToLower(s))
+	if p == Unknown {
+		return p, nil
+	}
+	for _, v := range Known {
+		if p == v {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("protocol: unknown protocol %q", s)
+}
+
+type signature struct {
+	prefix []byte
+	proto  Protocol
+}
+
+var signatures = []signature{
+	{[]byte("SSH-"), SSH},
+	{[]byte("\x13BitTorrent protocol"), BitTorrent},
+	{[]byte("\x16\x03"), TLS}, // handshake record
+	{[]byte("GET "), HTTP},
+	{[]byte("HEAD "), HTTP},
+	{[]byte("POST "), HTTP},
+	{[]byte("PUT "), HTTP},
+	{[]byte("DELETE "), HTTP},
+	{[]byte("OPTIONS "), HTTP},
+	{[]byte("PATCH "), HTTP},
+	{[]byte("CONNECT "), HTTP},
+	{[]byte("TRACE "), HTTP},
+}
+
+// Detect returns the protocol of a connection whose client sent `b`
+// first. It returns false if more data is needed to tell.
+func Detect(b []byte) (Protocol, bool) {
+	if len(b) == 0 {
+		return "", false
+	}
+	incomplete := false
+	for _, v := range signatures {
+		if bytes.HasPrefix(b, v.prefix) {
+			return v.proto, true
+		}
+		if bytes.HasPrefix(v.prefix, b) {
+			incomplete = true
+		}
+	}
+	if incomplete {
+		return "", false
+	}
+	return Unknown, true
+}
+
+type protocolKey struct{}
+
+// NewContext returns a copy of `ctx` carrying `p`.
+func NewContext(ctx context.Context, p Protocol) context.Context {
+	return context.WithValue(ctx, protocolKey{}, p)
+}
+
+// FromContext returns the protocol stored in `ctx`, if any.
+func FromContext(ctx context.Context) (Protocol, bool) {
+	p, ok := ctx.Value(protocolKey{}).(Protocol)
+	return p, ok
+}
+
+// Strategy returns a core.Strategy that uses the strategy in `m` of
+// the protocol stored in the context, or `fallback` if there is none.
+func Strategy(m map[Protocol]core.Strategy, fallback core.Strategy) core.Strategy {
+	return func(ctx context.Context, r *core.Ring) (core.Source, error) {
+		if p, ok := FromContext(ctx); ok {
+			if s, ok := m[p]; ok {
+				return s(ctx, r)
+			}
+		}
+		return fallback(ctx, r)
+	}
+}
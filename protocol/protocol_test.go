@@ -0,0 +1,92 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package protocol_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/protocol"
+)
+
+func TestDetect(t *testing.T) {
+	tt := []struct {
+		in    string
+		proto protocol.Protocol
+		done  bool
+	}{
+		{"", "", false},
+		{"GET / HTTP/1.1\r\n", protocol.HTTP, true},
+		{"PO", "", false},
+		{"POST /upload HTTP/1.1\r\n", protocol.HTTP, true},
+		{"\x16\x03\x01\x02\x00", protocol.TLS, true},
+		{"SSH-2.0-OpenSSH_7.9\r\n", protocol.SSH, true},
+		{"\x13BitTorrent", "", false},
+		{"\x13BitTorrent protocol\x00\x00", protocol.BitTorrent, true},
+		{"EHLO example.com\r\n", protocol.Unknown, true},
+		{"\x00\x01", protocol.Unknown, true},
+	}
+
+	for i, v := range tt {
+		proto, done := protocol.Detect([]byte(v.in))
+		if proto != v.proto || done != v.done {
+			t.Fatalf("%d: Unexpected result for %q: wanted %v (%v), found %v (%v)", i, v.in, v.proto, v.done, proto, done)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	if p, err := protocol.Parse("SSH"); err != nil || p != protocol.SSH {
+		t.Fatalf("Unexpected result: %v, %v", p, err)
+	}
+	if p, err := protocol.Parse("unknown"); err != nil || p != protocol.Unknown {
+		t.Fatalf("Unexpected result: %v, %v", p, err)
+	}
+	if _, err := protocol.Parse("gopher"); err == nil {
+		t.Fatalf("Parse accepted an unknown protocol")
+	}
+}
+
+func TestStrategy(t *testing.T) {
+	var used string
+	named := func(name string) core.Strategy {
+		return func(ctx context.Context, r *core.Ring) (core.Source, error) {
+			used = name
+			return nil, nil
+		}
+	}
+	s := protocol.Strategy(map[protocol.Protocol]core.Strategy{
+		protocol.SSH: named("ssh"),
+	}, named("default"))
+
+	tt := []struct {
+		ctx  context.Context
+		used string
+	}{
+		{context.Background(), "default"},
+		{protocol.NewContext(context.Background(), protocol.HTTP), "default"},
+		{protocol.NewContext(context.Background(), protocol.SSH), "ssh"},
+	}
+	for i, v := range tt {
+		if _, err := s(v.ctx, new(core.Ring)); err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		if used != v.used {
+			t.Fatalf("%d: Unexpected strategy: wanted %v, found %v", i, v.used, used)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package proxyproto
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+)
+
+// WriteHeader writes a PROXY protocol header of `version`, either 1
+// or 2, to `w`. The header announces a connection from `src` to
+// `dst`. If they are not TCP addresses of the same family, e.g. when
+// the client is unknown, the header carries no address.
+func WriteHeader(w io.Writer, version int, src, dst net.Addr) error {
+	switch version {
+	case 1:
+		_, err := io.WriteString(w, v1Header(src, dst))
+		return err
+	case 2:
+		_, err := w.Write(v2Header(src, dst))
+		return err
+	default:
+		return fmt.Errorf("proxyproto: unsupported version %d", version)
+	}
+}
+
+// tcpAddrs returns the TCP addresses `src` and `dst`, converted to
+// the same family, and whether they are IPv4 addresses.
+func tcpAddrs(src, dst net.Addr) (s, d *net.TCPAddr, ip4 bool, ok bool) {
+	s, ok1 := src.(*net.TCPAddr)
+	d, ok2 := dst.(*net.TCPAddr)
+	if !ok1 || !ok2 || s == nil || d == nil {
+		return nil, nil, false, false
+	}
+	if s.IP.To4() != nil && d.IP.To4() != nil {
+		return s, d, true, true
+	}
+	if s.IP.To16() == nil || d.IP.To16() == nil || s.IP.To4() != nil || d.IP.To4() != nil {
+		return nil, nil, false, false
+	}
+	return s, d, false, true
+}
+
+func v1Header(src, dst net.Addr) string {
+	s, d, ip4, ok := tcpAddrs(src, dst)
+	if !ok {
+		return "PROXY UNKNOWN\r\n"
+	}
+	proto := "TCP6"
+	if ip4 {
+		proto = "TCP4"
+	}
+	return fmt.Sprintf("PROXY %s %s %s %d %d\r\n", proto, s.IP, d.IP, s.Port, d.Port)
+}
+
+func v2Header(src, dst net.Addr) []byte {
+	var buf bytes.Buffer
+	buf.Write(v2Signature)
+
+	s, d, ip4, ok := tcpAddrs(src, dst)
+	if !ok {
+		buf.Write([]byte{2<<4 | cmdLocal, 0, 0, 0})
+		return buf.Bytes()
+	}
+	fam, sip, dip := byte(famTCP6), s.IP.To16(), d.IP.To16()
+	if ip4 {
+		fam, sip, dip = famTCP4, s.IP.To4(), d.IP.To4()
+	}
+	buf.Write([]byte{2<<4 | cmdProxy, fam})
+	binary.Write(&buf, binary.BigEndian, uint16(2*len(sip)+4))
+	buf.Write(sip)
+	buf.Write(dip)
+	binary.Write(&buf, binary.BigEndian, uint16(s.Port))
+	binary.Write(&buf, binary.BigEndian, uint16(d.Port))
+	return buf.Bytes()
+}
+
+type clientKey struct{}
+
+type client struct {
+	src, dst net.Addr
+}
+
+// WithClient returns a copy of `ctx` carrying the address of the
+// client, `src`, and the one it connected to, `dst`, of the
+// connection the context belongs to. The sources that dial through
+// remote proxies, such as source.Remote, write
+// them with WriteHeader so that the exit node knows the original
+// client.
+func WithClient(ctx context.Context, src, dst net.Addr) context.Context {
+	return context.WithValue(ctx, clientKey{}, client{src: src, dst: dst})
+}
+
+// ClientFromContext returns the addresses stored in `ctx` by
+// WithClient, if any.
+func ClientFromContext(ctx context.Context) (src, dst net.Addr, ok bool) {
+	c, ok := ctx.Value(clientKey{}).(client)
+	return c.src, c.dst, ok
+}
@@ -0,0 +1,68 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package proxyproto_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/booster-proj/booster/proxyproto"
+)
+
+func TestWriteHeader(t *testing.T) {
+	tt := []struct {
+		src, dst net.Addr
+		want     string
+	}{
+		{src: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 56324}, dst: &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 3128}, want: "192.0.2.1:56324"},
+		{src: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 4000}, dst: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 3128}, want: "[2001:db8::1]:4000"},
+		// Mixed families cannot be represented.
+		{src: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 4000}, dst: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 3128}},
+		{},
+	}
+	for _, version := range []int{1, 2} {
+		for i, v := range tt {
+			var buf bytes.Buffer
+			if err := proxyproto.WriteHeader(&buf, version, v.src, v.dst); err != nil {
+				t.Fatal(err)
+			}
+			addr, err := proxyproto.ReadHeader(bufio.NewReader(&buf))
+			if err != nil {
+				t.Fatalf("v%d, %d: unexpected error: %v", version, i, err)
+			}
+			if (v.want == "" && addr != nil) || (v.want != "" && (addr == nil || addr.String() != v.want)) {
+				t.Fatalf("v%d, %d: unexpected address: wanted %q, found %v", version, i, v.want, addr)
+			}
+		}
+	}
+	if err := proxyproto.WriteHeader(&bytes.Buffer{}, 3, nil, nil); err == nil {
+		t.Fatalf("An unsupported version was accepted")
+	}
+}
+
+func TestClientFromContext(t *testing.T) {
+	if _, _, ok := proxyproto.ClientFromContext(context.Background()); ok {
+		t.Fatalf("Unexpected client in an empty context")
+	}
+	src := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 4000}
+	ctx := proxyproto.WithClient(context.Background(), src, nil)
+	if got, _, ok := proxyproto.ClientFromContext(ctx); !ok || got != src {
+		t.Fatalf("Unexpected client: %v", got)
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package proxyproto implements the receiving side of the PROXY
+// protocol, versions 1 and 2, which load balancers use to forward the
+// address of the clients they accept connections from. See
+// https://www.haproxy.org/download/2.0/doc/proxy-protocol.txt.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoHeader is returned by ReadHeader when the stream does not start
+// with a PROXY protocol header.
+var ErrNoHeader = errors.New("proxyproto: no header")
+
+// DefaultTimeout is the maximum amount of time a Conn waits for its
+// header.
+const DefaultTimeout = time.Second * 5
+
+var (
+	v1Prefix    = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// v1MaxLen is the maximum length of a version 1 header, including
+// the CRLF.
+const v1MaxLen = 107
+
+// ReadHeader reads the PROXY protocol header at the beginning of `r`,
+// returning the source address it carries. The address is nil if the
+// header does not carry one, e.g. for health checks. If `r` does not
+// start with a header, ErrNoHeader is returned and nothing is
+// consumed.
+func ReadHeader(r *bufio.Reader) (net.Addr, error) {
+	// Check the first byte alone, so that the clients that send
+	// short messages before waiting for a reply are not stalled.
+	b, err := r.Peek(1)
+	if err != nil {
+		if err == io.EOF {
+			return nil, ErrNoHeader
+		}
+		return nil, err
+	}
+	if b[0] != v1Prefix[0] && b[0] != v2Signature[0] {
+		return nil, ErrNoHeader
+	}
+
+	b, err = r.Peek(len(v1Prefix))
+	if err != nil {
+		if err == io.EOF {
+			return nil, ErrNoHeader
+		}
+		return nil, err
+	}
+	if bytes.Equal(b, v1Prefix) {
+		return readV1(r)
+	}
+	if b, err = r.Peek(len(v2Signature)); err == nil && bytes.Equal(b, v2Signature) {
+		return readV2(r)
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return nil, ErrNoHeader
+}
+
+func readV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < v1MaxLen {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, c)
+		if c == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("proxyproto: header line too long")
+	}
+
+	f := strings.Fields(string(line[:len(line)-2]))
+	if len(f) >= 2 && f[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(f) != 6 || (f[1] != "TCP4" && f[1] != "TCP6") {
+		return nil, fmt.Errorf("proxyproto: invalid header %q", line)
+	}
+	ip := net.ParseIP(f[2])
+	port, err := strconv.ParseUint(f[4], 10, 16)
+	if ip == nil || err != nil || net.ParseIP(f[3]) == nil {
+		return nil, fmt.Errorf("proxyproto: invalid header %q", line)
+	}
+	if _, err := strconv.ParseUint(f[5], 10, 16); err != nil {
+		return nil, fmt.Errorf("proxyproto: invalid header %q", line)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// Version 2 commands and address families.
+const (
+	cmdLocal = 0x0
+	cmdProxy = 0x1
+
+	famTCP4 = 0x11
+	famTCP6 = 0x21
+)
+
+func readV2(r *bufio.Reader) (net.Addr, error) {
+	h := make([]byte, len(v2Signature)+4)
+	if _, err := io.ReadFull(r, h); err != nil {
+		return nil, err
+	}
+	ver, cmd, fam := h[12]>>4, h[12]&0xf, h[13]
+	payload := make([]byte, binary.BigEndian.Uint16(h[14:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	if ver != 2 {
+		return nil, fmt.Errorf("proxyproto: unsupported version %d", ver)
+	}
+
+	switch cmd {
+	case cmdLocal:
+		return nil, nil
+	case cmdProxy:
+	default:
+		return nil, fmt.Errorf("proxyproto: unsupported command %#x", cmd)
+	}
+	// The addresses are followed by the TLVs, which are ignored.
+	switch fam {
+	case famTCP4:
+		if len(payload) < 12 {
+			return nil, errors.New("proxyproto: short IPv4 addresses")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:]))}, nil
+	case famTCP6:
+		if len(payload) < 36 {
+			return nil, errors.New("proxyproto: short IPv6 addresses")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:]))}, nil
+	default:
+		// Unsupported families are treated as UNKNOWN.
+		return nil, nil
+	}
+}
+
+// Listener is a net.Listener that reads the PROXY protocol header
+// sent by the trusted peers, reporting the address it carries as the
+// remote address of the connections.
+type Listener struct {
+	net.Listener
+	// Trusted are the networks of the load balancers. The headers
+	// sent by other peers are not read, as anyone could forge them.
+	Trusted []*net.IPNet
+	// Timeout is the maximum amount of time the connections wait for
+	// the header. If zero, DefaultTimeout is used.
+	Timeout time.Duration
+}
+
+// Accept implements net.Listener. The header is read on the first
+// call to Read or RemoteAddr of the connection returned, so that the
+// clients slow to send it do not block the listener.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.trusts(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	timeout := l.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Conn{Conn: conn, r: bufio.NewReader(conn), timeout: timeout}, nil
+}
+
+func (l *Listener) trusts(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, v := range l.Trusted {
+		if v.Contains(tcp.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// Conn is a connection accepted by a Listener from a trusted peer.
+// If the header is invalid, its reads fail.
+type Conn struct {
+	net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+
+	once   sync.Once
+	remote net.Addr
+	err    error
+}
+
+func (c *Conn) readHeader() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+
+		addr, err := ReadHeader(c.r)
+		switch {
+		case err == ErrNoHeader:
+		case err != nil:
+			c.err = err
+		default:
+			c.remote = addr
+		}
+	})
+}
+
+// Read implements net.Conn.
+func (c *Conn) Read(p []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(p)
+}
+
+// RemoteAddr returns the address of the client, as reported by the
+// header, or the address of the peer if the header does not carry
+// one.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
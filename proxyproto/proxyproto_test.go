@@ -0,0 +1,123 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package proxyproto_test
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/proxyproto"
+)
+
+var v2Signature = "\r\n\r\n\x00\r\nQUIT\n"
+
+func TestReadHeader(t *testing.T) {
+	tt := []struct {
+		in   string
+		addr string
+		err  bool
+	}{
+		{in: "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nGET /", addr: "192.0.2.1:56324"},
+		{in: "PROXY TCP6 2001:db8::1 2001:db8::2 4000 80\r\nGET /", addr: "[2001:db8::1]:4000"},
+		{in: "PROXY UNKNOWN\r\nGET /"},
+		{in: v2Signature + "\x21\x11\x00\x0c\xc0\x00\x02\x01\xc6\x33\x64\x01\xdc\x04\x01\xbbGET /", addr: "192.0.2.1:56324"},
+		{in: v2Signature + "\x20\x00\x00\x00GET /"},
+		{in: "PROXY TCP4 192.0.2.1\r\nGET /", err: true},
+		{in: "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443", err: true},
+		{in: v2Signature + "\x11\x11\x00\x00GET /", err: true},
+	}
+	for i, v := range tt {
+		r := bufio.NewReader(strings.NewReader(v.in))
+		addr, err := proxyproto.ReadHeader(r)
+		if v.err {
+			if err == nil {
+				t.Fatalf("%d: expected an error, found %v", i, addr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+		if (v.addr == "" && addr != nil) || (v.addr != "" && (addr == nil || addr.String() != v.addr)) {
+			t.Fatalf("%d: unexpected address: wanted %q, found %v", i, v.addr, addr)
+		}
+		if rest, _ := ioutil.ReadAll(r); string(rest) != "GET /" {
+			t.Fatalf("%d: unexpected data after the header: %q", i, rest)
+		}
+	}
+
+	r := bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\n"))
+	if _, err := proxyproto.ReadHeader(r); err != proxyproto.ErrNoHeader {
+		t.Fatalf("Unexpected error: wanted %v, found %v", proxyproto.ErrNoHeader, err)
+	}
+	if b, _ := r.Peek(3); string(b) != "GET" {
+		t.Fatalf("ReadHeader consumed the data: %q", b)
+	}
+}
+
+func TestListener(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	trusted := []*net.IPNet{{IP: net.IPv4(127, 0, 0, 1), Mask: net.CIDRMask(32, 32)}}
+	pln := &proxyproto.Listener{Listener: ln, Trusted: trusted, Timeout: time.Second}
+
+	send := func(s string) {
+		conn, err := net.Dial("tcp4", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			conn.Write([]byte(s))
+			conn.Close()
+		}()
+	}
+	accept := func() (net.Addr, string) {
+		conn, err := pln.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		addr := conn.RemoteAddr()
+		b, _ := ioutil.ReadAll(conn)
+		return addr, string(b)
+	}
+
+	send("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nhello")
+	if addr, data := accept(); addr.String() != "192.0.2.1:56324" || data != "hello" {
+		t.Fatalf("Unexpected connection: %v, %q", addr, data)
+	}
+
+	// Connections without a header are passed through.
+	send("hello")
+	if addr, data := accept(); !strings.HasPrefix(addr.String(), "127.0.0.1:") || data != "hello" {
+		t.Fatalf("Unexpected connection: %v, %q", addr, data)
+	}
+
+	// The headers of untrusted peers are not read.
+	pln.Trusted = []*net.IPNet{{IP: net.IPv4(10, 0, 0, 0), Mask: net.CIDRMask(8, 32)}}
+	send("PROXY UNKNOWN\r\nhello")
+	if _, data := accept(); data != "PROXY UNKNOWN\r\nhello" {
+		t.Fatalf("Unexpected data: %q", data)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package publicip periodically detects the public address of each
+// source, i.e. the one its connections reach the Internet from, asking
+// either an HTTPS echo service or a STUN server through the source.
+package publicip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+	"upspin.io/log"
+)
+
+// Defaults used when the Detector fields are not set.
+var (
+	DefaultServers  = []string{"https://api.ipify.org", "stun:stun.l.google.com:19302"}
+	DefaultInterval = time.Minute * 5
+	DefaultTimeout  = time.Second * 10
+)
+
+// Store describes the entity that contains the sources and records
+// their public addresses.
+type Store interface {
+	Do(func(core.Source))
+	SetPublicIP(id string, ip net.IP)
+}
+
+// Detector detects the public address of the sources of its Store.
+// Its zero value is not ready to be used: Store must be set.
+type Detector struct {
+	Store Store
+	// Servers are asked in order, until one of them replies. They
+	// are either the URLs of HTTP(S) echo services, replying the
+	// address of the client in plain text, e.g.
+	// https://api.ipify.org, or STUN servers, as stun:host[:port].
+	Servers []string
+	// Interval between the detections.
+	Interval time.Duration
+	// Timeout of each server asked.
+	Timeout time.Duration
+}
+
+func (d *Detector) servers() []string {
+	if len(d.Servers) == 0 {
+		return DefaultServers
+	}
+	return d.Servers
+}
+
+func (d *Detector) interval() time.Duration {
+	if d.Interval <= 0 {
+		return DefaultInterval
+	}
+	return d.Interval
+}
+
+func (d *Detector) timeout() time.Duration {
+	if d.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return d.Timeout
+}
+
+// Run detects the public address of the sources right away and then
+// every Interval, until the context is canceled.
+func (d *Detector) Run(ctx context.Context) error {
+	for {
+		d.DetectAll(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d.interval()):
+		}
+	}
+}
+
+// DetectAll detects the public address of each source, in parallel,
+// recording it into the Store. The sources whose address cannot be
+// detected keep the one recorded before.
+func (d *Detector) DetectAll(ctx context.Context) {
+	var sources []core.Source
+	d.Store.Do(func(src core.Source) {
+		sources = append(sources, src)
+	})
+
+	var wg sync.WaitGroup
+	for _, v := range sources {
+		wg.Add(1)
+		go func(src core.Source) {
+			defer wg.Done()
+			ip, err := d.Detect(ctx, src)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Debug.Printf("Public IP: %v: %v", src.ID(), err)
+				}
+				return
+			}
+			d.Store.SetPublicIP(src.ID(), ip)
+		}(v)
+	}
+	wg.Wait()
+}
+
+// Detect returns the public address of `src`, asking the Servers in
+// order until one of them replies.
+func (d *Detector) Detect(ctx context.Context, src core.Source) (net.IP, error) {
+	var errs []string
+	for _, v := range d.servers() {
+		actx, cancel := context.WithTimeout(ctx, d.timeout())
+		ip, err := ask(actx, src, v)
+		cancel()
+		if err == nil {
+			return ip, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", v, err))
+	}
+	return nil, errors.New("publicip: " + strings.Join(errs, "; "))
+}
+
+// ask asks `server` the public address of `src`.
+func ask(ctx context.Context, src core.Source, server string) (net.IP, error) {
+	switch {
+	case strings.HasPrefix(server, "stun:"):
+		return stun(ctx, src, stunAddress(strings.TrimPrefix(server, "stun:")))
+	case strings.HasPrefix(server, "http://"), strings.HasPrefix(server, "https://"):
+		return echo(ctx, src, server)
+	default:
+		return nil, fmt.Errorf("unsupported server, expected an http(s) URL or stun:host[:port]")
+	}
+}
+
+// echo asks the HTTP(S) echo service at `url`.
+func echo(ctx context.Context, src core.Source, url string) (net.IP, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext:       src.DialContext,
+			DisableKeepAlives: true,
+		},
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(strings.TrimSpace(string(b)))
+	if ip == nil {
+		return nil, fmt.Errorf("invalid reply %q", b)
+	}
+	return ip, nil
+}
@@ -0,0 +1,153 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package publicip_test
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/publicip"
+)
+
+type mock struct {
+	id string
+	net.Dialer
+}
+
+func (s *mock) ID() string {
+	return s.id
+}
+
+func (s *mock) Close() error {
+	return nil
+}
+
+type store struct {
+	sync.Mutex
+	sources []core.Source
+	ips     map[string]net.IP
+}
+
+func (s *store) Do(f func(core.Source)) {
+	for _, v := range s.sources {
+		f(v)
+	}
+}
+
+func (s *store) SetPublicIP(id string, ip net.IP) {
+	s.Lock()
+	defer s.Unlock()
+	if s.ips == nil {
+		s.ips = make(map[string]net.IP)
+	}
+	s.ips[id] = ip
+}
+
+// stunServer replies to the Binding requests with the XOR-MAPPED-ADDRESS
+// of the client.
+func stunServer(t *testing.T) string {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer conn.Close()
+		b := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(b)
+			if err != nil {
+				return
+			}
+			if n < 20 {
+				continue
+			}
+			ip := addr.(*net.UDPAddr).IP.To4()
+			resp := make([]byte, 32)
+			binary.BigEndian.PutUint16(resp[0:], 0x0101)
+			binary.BigEndian.PutUint16(resp[2:], 12)
+			copy(resp[4:20], b[4:20])
+			binary.BigEndian.PutUint16(resp[20:], 0x0020)
+			binary.BigEndian.PutUint16(resp[22:], 8)
+			resp[25] = 0x01
+			for i := range ip {
+				resp[28+i] = ip[i] ^ b[4+i]
+			}
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestDetect(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "203.0.113.7")
+	}))
+	defer srv.Close()
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+
+	s0 := &mock{id: "s0"}
+	ctx := context.Background()
+	tests := []struct {
+		servers []string
+		want    string
+	}{
+		{servers: []string{srv.URL}, want: "203.0.113.7"},
+		{servers: []string{"stun:" + stunServer(t)}, want: "127.0.0.1"},
+		// The next server is asked when one fails.
+		{servers: []string{missing.URL, srv.URL}, want: "203.0.113.7"},
+	}
+	for i, v := range tests {
+		d := &publicip.Detector{Servers: v.servers, Timeout: time.Second}
+		ip, err := d.Detect(ctx, s0)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if ip.String() != v.want {
+			t.Fatalf("%d: Unexpected public IP: wanted %v, found %v", i, v.want, ip)
+		}
+	}
+
+	d := &publicip.Detector{Servers: []string{missing.URL, "ftp://example.com"}, Timeout: time.Second}
+	if ip, err := d.Detect(ctx, s0); err == nil {
+		t.Fatalf("Unexpected public IP: %v", ip)
+	}
+}
+
+func TestDetectAll(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "2001:db8::1")
+	}))
+	defer srv.Close()
+
+	st := &store{sources: []core.Source{&mock{id: "s0"}, &mock{id: "s1"}}}
+	d := &publicip.Detector{Store: st, Servers: []string{srv.URL}}
+	d.DetectAll(context.Background())
+
+	for _, v := range st.sources {
+		if ip := st.ips[v.ID()]; ip.String() != "2001:db8::1" {
+			t.Fatalf("Unexpected public IP of %v: %v", v.ID(), ip)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package publicip
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+)
+
+// The bits of RFC 5389 used by the Binding requests.
+const (
+	stunPort          = "3478"
+	stunMagicCookie   = 0x2112A442
+	stunHeaderLen     = 20
+	bindingRequest    = 0x0001
+	bindingSuccess    = 0x0101
+	attrMappedAddress = 0x0001
+	attrXORMapped     = 0x0020
+)
+
+// stunAddress adds the default STUN port to `host`, if missing.
+func stunAddress(host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, stunPort)
+}
+
+// stun sends a Binding request to the STUN server at `address`
+// through `src`, returning the address it was received from.
+func stun(ctx context.Context, src core.Source, address string) (net.IP, error) {
+	conn, err := src.DialContext(ctx, "udp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	req := make([]byte, stunHeaderLen)
+	binary.BigEndian.PutUint16(req[0:], bindingRequest)
+	binary.BigEndian.PutUint32(req[4:], stunMagicCookie)
+	if _, err := rand.Read(req[8:]); err != nil {
+		return nil, err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(DefaultTimeout)
+	}
+
+	// Retransmit the request as the RFC suggests, doubling the wait
+	// each time, until the deadline.
+	b := make([]byte, 1500)
+	for rto := time.Millisecond * 500; ; rto *= 2 {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		wait := time.Now().Add(rto)
+		if wait.After(deadline) {
+			wait = deadline
+		}
+		conn.SetReadDeadline(wait)
+		for {
+			n, err := conn.Read(b)
+			if ne, ok := err.(net.Error); ok && ne.Timeout() && wait.Before(deadline) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if ip, err := parseBinding(b[:n], req[8:stunHeaderLen]); err == nil {
+				return ip, nil
+			}
+			// Ignore the stray packets.
+		}
+	}
+}
+
+// parseBinding returns the mapped address of the Binding success
+// response `b`, of transaction `tid`.
+func parseBinding(b, tid []byte) (net.IP, error) {
+	if len(b) < stunHeaderLen ||
+		binary.BigEndian.Uint16(b[0:]) != bindingSuccess ||
+		binary.BigEndian.Uint32(b[4:]) != stunMagicCookie ||
+		string(b[8:stunHeaderLen]) != string(tid) {
+		return nil, errors.New("not a binding response")
+	}
+	n := int(binary.BigEndian.Uint16(b[2:]))
+	if len(b) < stunHeaderLen+n {
+		return nil, errors.New("truncated binding response")
+	}
+
+	var mapped net.IP
+	attrs := b[stunHeaderLen : stunHeaderLen+n]
+	for len(attrs) >= 4 {
+		typ := binary.BigEndian.Uint16(attrs[0:])
+		l := int(binary.BigEndian.Uint16(attrs[2:]))
+		if len(attrs) < 4+l {
+			break
+		}
+		v := attrs[4 : 4+l]
+		switch typ {
+		case attrXORMapped:
+			if ip := parseAddress(v); ip != nil {
+				// The address is XOR-ed with the magic cookie
+				// followed by the transaction ID.
+				for i := range ip {
+					ip[i] ^= b[4+i]
+				}
+				return ip, nil
+			}
+		case attrMappedAddress:
+			mapped = parseAddress(v)
+		}
+		// The attributes are padded to 4 bytes.
+		next := 4 + (l+3)&^3
+		if next > len(attrs) {
+			next = len(attrs)
+		}
+		attrs = attrs[next:]
+	}
+	if mapped == nil {
+		return nil, errors.New("no mapped address in the binding response")
+	}
+	return mapped, nil
+}
+
+// parseAddress returns a copy of the address of the (XOR-)MAPPED-ADDRESS
+// attribute `v`.
+func parseAddress(v []byte) net.IP {
+	if len(v) < 4 {
+		return nil
+	}
+	var n int
+	switch v[1] {
+	case 0x01:
+		n = net.IPv4len
+	case 0x02:
+		n = net.IPv6len
+	default:
+		return nil
+	}
+	if len(v) < 4+n {
+		return nil
+	}
+	return append(net.IP(nil), v[4:4+n]...)
+}
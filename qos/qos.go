@@ -0,0 +1,65 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package qos marks the upstream connections with a DSCP value, so
+// that the routers downstream can prioritize them. The value travels
+// with the context used to dial the connection, and it is applied to
+// the socket by the sources before connecting.
+package qos
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Names are the DSCP values known by name, as defined by RFC 2474,
+// RFC 2597, RFC 3246 and RFC 5865.
+var Names = map[string]int{
+	"CS0": 0, "DF": 0, "BE": 0,
+	"CS1": 8, "CS2": 16, "CS3": 24, "CS4": 32, "CS5": 40, "CS6": 48, "CS7": 56,
+	"AF11": 10, "AF12": 12, "AF13": 14,
+	"AF21": 18, "AF22": 20, "AF23": 22,
+	"AF31": 26, "AF32": 28, "AF33": 30,
+	"AF41": 34, "AF42": 36, "AF43": 38,
+	"VA": 44, "EF": 46,
+}
+
+// ParseDSCP parses a DSCP value, either by name, e.g. EF, or as a
+// number from 0 to 63.
+func ParseDSCP(s string) (int, error) {
+	if v, ok := Names[strings.ToUpper(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 || v > 63 {
+		return 0, fmt.Errorf("qos: invalid DSCP value %q", s)
+	}
+	return v, nil
+}
+
+type dscpKey struct{}
+
+// WithDSCP returns a copy of `ctx` that carries the DSCP value `v`.
+func WithDSCP(ctx context.Context, v int) context.Context {
+	return context.WithValue(ctx, dscpKey{}, v)
+}
+
+// FromContext returns the DSCP value stored in `ctx`, if any.
+func FromContext(ctx context.Context) (int, bool) {
+	v, ok := ctx.Value(dscpKey{}).(int)
+	return v, ok
+}
@@ -0,0 +1,66 @@
+//go:build linux
+// +build linux
+
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package qos_test
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/booster-proj/booster/qos"
+	"golang.org/x/sys/unix"
+)
+
+func TestSet(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	d := &net.Dialer{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var err error
+			c.Control(func(fd uintptr) {
+				err = qos.Set(fd, network, 46)
+			})
+			return err
+		},
+	}
+	conn, err := d.Dial("tcp4", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	rc, err := conn.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tos int
+	rc.Control(func(fd uintptr) {
+		tos, err = unix.GetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_TOS)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tos>>2 != 46 {
+		t.Fatalf("Unexpected TOS: %#x", tos)
+	}
+}
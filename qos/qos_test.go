@@ -0,0 +1,57 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package qos_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/booster-proj/booster/qos"
+)
+
+func TestParseDSCP(t *testing.T) {
+	tt := []struct {
+		in  string
+		out int
+		err bool
+	}{
+		{in: "EF", out: 46},
+		{in: "af41", out: 34},
+		{in: "cs0", out: 0},
+		{in: "10", out: 10},
+		{in: "64", err: true},
+		{in: "-1", err: true},
+		{in: "foo", err: true},
+	}
+	for _, v := range tt {
+		out, err := qos.ParseDSCP(v.in)
+		if v.err != (err != nil) {
+			t.Fatalf("%s: unexpected error: %v", v.in, err)
+		}
+		if out != v.out {
+			t.Fatalf("%s: wanted %d, found %d", v.in, v.out, out)
+		}
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if _, ok := qos.FromContext(context.Background()); ok {
+		t.Fatalf("Unexpected DSCP value in an empty context")
+	}
+	if v, ok := qos.FromContext(qos.WithDSCP(context.Background(), 46)); !ok || v != 46 {
+		t.Fatalf("Unexpected DSCP value: %d, %v", v, ok)
+	}
+}
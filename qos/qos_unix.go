@@ -0,0 +1,34 @@
+//go:build linux || darwin
+// +build linux darwin
+
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package qos
+
+import (
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Set sets the DSCP value of socket `fd`, of `network`, which is
+// either "tcp4", "tcp6", "udp4" or "udp6".
+func Set(fd uintptr, network string, dscp int) error {
+	if strings.HasSuffix(network, "6") {
+		return unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_TCLASS, dscp<<2)
+	}
+	return unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_TOS, dscp<<2)
+}
@@ -0,0 +1,121 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package relay
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"upspin.io/log"
+)
+
+// Forwarder relays the connections accepted by a listener to Address,
+// e.g. terminating the TLS connections of the clients in front of a
+// proxy that does not support it.
+type Forwarder struct {
+	// Address is the TCP address each connection accepted is
+	// relayed to.
+	Address string
+	// Buffers, if not nil, provides the buffers of the copies.
+	Buffers *Pool
+	// Dial, if not nil, dials the upstream of each connection in
+	// place of Address, e.g. through the sources to its original
+	// destination.
+	Dial func(ctx context.Context, conn net.Conn) (net.Conn, error)
+}
+
+// Serve relays the connections accepted by `ln` until the context is
+// canceled, closing them together with `ln`.
+func (f *Forwarder) Serve(ctx context.Context, ln net.Listener) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(time.Millisecond * 50)
+				continue
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			f.Forward(ctx, conn)
+		}()
+	}
+}
+
+func (f *Forwarder) dial(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	if f.Dial != nil {
+		return f.Dial(ctx, conn)
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", f.Address)
+}
+
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// Forward relays `conn` to Address, or to the connection returned by
+// Dial, until both directions end, or the context is canceled. The
+// caller closes `conn`.
+func (f *Forwarder) Forward(ctx context.Context, conn net.Conn) {
+	upstream, err := f.dial(ctx, conn)
+	if err != nil {
+		log.Debug.Printf("Relay: unable to forward %v: %v", conn.RemoteAddr(), err)
+		return
+	}
+	defer upstream.Close()
+
+	done := make(chan struct{}, 2)
+	cp := func(dst, src net.Conn) {
+		defer func() { done <- struct{}{} }()
+		Copy(dst, src, f.Buffers)
+		// Let the other end know that no more data is coming,
+		// keeping the other direction open if possible.
+		if cw, ok := dst.(closeWriter); ok {
+			cw.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+	go cp(upstream, conn)
+	go cp(conn, upstream)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
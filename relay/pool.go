@@ -0,0 +1,113 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package relay
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBufferSize is the size of the buffers of a Pool whose Size
+// is not set.
+const DefaultBufferSize = 32 << 10
+
+// Pool is a pool of buffers of the same size, reused across the copy
+// loops to reduce the pressure on the garbage collector when many
+// connections are open. The zero value is ready to use. A Pool must
+// not be copied after first use.
+type Pool struct {
+	// Size is the size of the buffers. If 0, DefaultBufferSize is
+	// used.
+	Size int
+	// MetricsExporter, if not nil, is notified each time a buffer
+	// is requested, allocated or returned to the pool.
+	MetricsExporter MetricsExporter
+
+	once   sync.Once
+	pool   sync.Pool
+	gets   uint64
+	allocs uint64
+	puts   uint64
+}
+
+// PoolStats describe the usage of a Pool.
+type PoolStats struct {
+	Size int `json:"size"`
+	// Gets is the number of buffers requested.
+	Gets uint64 `json:"gets"`
+	// Allocs is the number of buffers allocated, because the pool was
+	// empty.
+	Allocs uint64 `json:"allocs"`
+	// InUse is the number of buffers requested and not yet returned.
+	InUse uint64 `json:"in_use"`
+}
+
+func (p *Pool) size() int {
+	if p.Size > 0 {
+		return p.Size
+	}
+	return DefaultBufferSize
+}
+
+func (p *Pool) init() {
+	p.once.Do(func() {
+		size := p.size()
+		p.pool.New = func() interface{} {
+			atomic.AddUint64(&p.allocs, 1)
+			p.count("alloc")
+			b := make([]byte, size)
+			return &b
+		}
+	})
+}
+
+// Get returns a buffer from the pool, allocating a new one if needed.
+// Return it with Put when it is no longer used.
+func (p *Pool) Get() *[]byte {
+	p.init()
+	atomic.AddUint64(&p.gets, 1)
+	p.count("get")
+	return p.pool.Get().(*[]byte)
+}
+
+// Put returns `b` to the pool. Buffers of the wrong size are
+// discarded.
+func (p *Pool) Put(b *[]byte) {
+	if b == nil || len(*b) != p.size() {
+		return
+	}
+	atomic.AddUint64(&p.puts, 1)
+	p.count("put")
+	p.pool.Put(b)
+}
+
+// Stats returns the usage statistics of the pool.
+func (p *Pool) Stats() PoolStats {
+	gets := atomic.LoadUint64(&p.gets)
+	puts := atomic.LoadUint64(&p.puts)
+	return PoolStats{
+		Size:   p.size(),
+		Gets:   gets,
+		Allocs: atomic.LoadUint64(&p.allocs),
+		InUse:  gets - puts,
+	}
+}
+
+func (p *Pool) count(op string) {
+	if exp := p.MetricsExporter; exp != nil {
+		exp.IncBufferOp(map[string]string{"op": op})
+	}
+}
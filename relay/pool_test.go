@@ -0,0 +1,73 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package relay_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/booster-proj/booster/relay"
+)
+
+type exporter struct {
+	mux sync.Mutex
+	ops map[string]int
+}
+
+func (e *exporter) CountRelayed(labels map[string]string, n int64) {}
+
+func (e *exporter) IncBufferOp(labels map[string]string) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if e.ops == nil {
+		e.ops = make(map[string]int)
+	}
+	e.ops[labels["op"]]++
+}
+
+func TestPool(t *testing.T) {
+	exp := &exporter{}
+	pool := &relay.Pool{Size: 512, MetricsExporter: exp}
+
+	b := pool.Get()
+	if len(*b) != 512 {
+		t.Fatalf("Unexpected buffer size: wanted 512, found %d", len(*b))
+	}
+	if s := pool.Stats(); s.Gets != 1 || s.Allocs != 1 || s.InUse != 1 {
+		t.Fatalf("Unexpected pool stats: %+v", s)
+	}
+	pool.Put(b)
+
+	// Buffers of the wrong size do not end up in the pool.
+	short := make([]byte, 10)
+	pool.Put(&short)
+
+	if s := pool.Stats(); s.InUse != 0 {
+		t.Fatalf("Unexpected buffers in use: %d", s.InUse)
+	}
+	if exp.ops["get"] != 1 || exp.ops["alloc"] != 1 || exp.ops["put"] != 1 {
+		t.Fatalf("Unexpected buffer operations exported: %v", exp.ops)
+	}
+}
+
+func TestPool_default(t *testing.T) {
+	var pool relay.Pool
+	b := pool.Get()
+	defer pool.Put(b)
+	if len(*b) != relay.DefaultBufferSize {
+		t.Fatalf("Unexpected buffer size: wanted %d, found %d", relay.DefaultBufferSize, len(*b))
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package relay copies data between network connections. On Linux,
+// data flowing from a TCP connection to another is moved with
+// splice(2), without being copied to user space. On the other systems,
+// or with any other kind of connection, io.Copy is used.
+package relay
+
+import (
+	"io"
+	"net"
+)
+
+// Wrapper is implemented by the connections that wrap another one,
+// e.g. to collect metrics. The relay bypasses them to reach the
+// underlying TCP connections, reporting to every wrapper the data
+// transferred on its behalf.
+type Wrapper interface {
+	// Unwrap returns the connection wrapped.
+	Unwrap() net.Conn
+	// Relayed is called each time `n` bytes are read from, or
+	// written to when `write` is true, the underlying connection
+	// by the relay.
+	Relayed(n int, write bool)
+}
+
+// Copy paths, reported as the "path" label of the metrics.
+const (
+	PathSplice = "splice"
+	PathCopy   = "copy"
+)
+
+// MetricsExporter collects the amount of data relayed through each
+// path, and the operations performed on the buffer pools.
+type MetricsExporter interface {
+	CountRelayed(labels map[string]string, n int64)
+	IncBufferOp(labels map[string]string)
+}
+
+// Copy copies from `src` to `dst` until EOF is reached on src or an
+// error occurs, as io.Copy does. Returns the number of bytes copied
+// and the path used. If `pool` is not nil, the buffer used by the copy
+// path is taken from it.
+func Copy(dst, src net.Conn, pool *Pool) (int64, string, error) {
+	d, dw := unwrap(dst)
+	s, sw := unwrap(src)
+	if dt, ok := d.(*net.TCPConn); ok {
+		if st, ok := s.(*net.TCPConn); ok && spliceAvailable {
+			report := func(n int) {
+				for _, w := range sw {
+					w.Relayed(n, false)
+				}
+				for _, w := range dw {
+					w.Relayed(n, true)
+				}
+			}
+			n, err := splice(dt, st, report)
+			return n, PathSplice, err
+		}
+	}
+	if pool == nil {
+		n, err := io.Copy(dst, src)
+		return n, PathCopy, err
+	}
+	b := pool.Get()
+	defer pool.Put(b)
+	n, err := io.CopyBuffer(dst, src, *b)
+	return n, PathCopy, err
+}
+
+// unwrap returns the connection wrapped by `c`, together with the
+// wrappers around it, outermost first.
+func unwrap(c net.Conn) (net.Conn, []Wrapper) {
+	var acc []Wrapper
+	for {
+		w, ok := c.(Wrapper)
+		if !ok {
+			return c, acc
+		}
+		acc = append(acc, w)
+		c = w.Unwrap()
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package relay_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"net"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/booster-proj/booster/relay"
+)
+
+// tcpPair returns the two ends of a loopback TCP connection.
+func tcpPair(t *testing.T) (*net.TCPConn, *net.TCPConn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	c := make(chan net.Conn)
+	go func() {
+		conn, _ := ln.Accept()
+		c <- conn
+	}()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := <-c
+	if server == nil {
+		t.Fatal("Unable to accept the connection")
+	}
+	return client.(*net.TCPConn), server.(*net.TCPConn)
+}
+
+// counter is a relay.Wrapper that counts the bytes relayed.
+type counter struct {
+	net.Conn
+
+	mux           sync.Mutex
+	read, written int
+}
+
+func (c *counter) Unwrap() net.Conn {
+	return c.Conn
+}
+
+func (c *counter) Relayed(n int, write bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if write {
+		c.written += n
+		return
+	}
+	c.read += n
+}
+
+func TestCopy(t *testing.T) {
+	c0, s0 := tcpPair(t)
+	defer c0.Close()
+	defer s0.Close()
+	c1, s1 := tcpPair(t)
+	defer c1.Close()
+	defer s1.Close()
+
+	data := make([]byte, 1<<20)
+	rand.Read(data)
+	go func() {
+		c0.Write(data)
+		c0.CloseWrite()
+	}()
+
+	src, dst := &counter{Conn: s0}, &counter{Conn: c1}
+	c := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(s1)
+		c <- b
+	}()
+
+	n, path, err := relay.Copy(dst, src, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	c1.CloseWrite()
+	if n != int64(len(data)) {
+		t.Fatalf("Unexpected amount of data copied: wanted %d, found %d", len(data), n)
+	}
+	if b := <-c; !bytes.Equal(b, data) {
+		t.Fatalf("Data was corrupted during the copy")
+	}
+
+	want := relay.PathCopy
+	if runtime.GOOS == "linux" {
+		want = relay.PathSplice
+	}
+	if path != want {
+		t.Fatalf("Unexpected path: wanted %s, found %s", want, path)
+	}
+	if path == relay.PathSplice && (src.read != len(data) || dst.written != len(data)) {
+		t.Fatalf("Unexpected data reported to the wrappers: read %d, written %d", src.read, dst.written)
+	}
+}
+
+func TestCopy_pipe(t *testing.T) {
+	a0, a1 := net.Pipe()
+	b0, b1 := net.Pipe()
+	go func() {
+		a0.Write([]byte("hello"))
+		a0.Close()
+	}()
+	c := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(b1)
+		c <- b
+	}()
+
+	pool := &relay.Pool{Size: 1024}
+	_, path, err := relay.Copy(b0, a1, pool)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	b0.Close()
+	if path != relay.PathCopy {
+		t.Fatalf("Unexpected path: wanted %s, found %s", relay.PathCopy, path)
+	}
+	if b := <-c; string(b) != "hello" {
+		t.Fatalf("Unexpected data: %q", b)
+	}
+	if s := pool.Stats(); s.Gets != 1 || s.InUse != 0 {
+		t.Fatalf("Unexpected pool stats: %+v", s)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package relay
+
+import (
+	"io"
+	"net"
+	"syscall"
+)
+
+const spliceAvailable = true
+
+const (
+	spliceMove     = 0x1 // SPLICE_F_MOVE
+	spliceNonblock = 0x2 // SPLICE_F_NONBLOCK
+
+	// maxSplice is the maximum amount of data moved by each call,
+	// which is the default capacity of a pipe.
+	maxSplice = 64 << 10
+)
+
+// splice moves the data from `src` to `dst` through a pipe, calling
+// report after each chunk written.
+func splice(dst, src *net.TCPConn, report func(int)) (int64, error) {
+	var p [2]int
+	if err := syscall.Pipe2(p[:], syscall.O_CLOEXEC|syscall.O_NONBLOCK); err != nil {
+		return 0, err
+	}
+	defer syscall.Close(p[0])
+	defer syscall.Close(p[1])
+
+	rc, err := src.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	wc, err := dst.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var written int64
+	for {
+		// Socket to pipe.
+		var n int
+		var serr error
+		err := rc.Read(func(fd uintptr) bool {
+			var m int64
+			m, serr = syscall.Splice(int(fd), nil, p[1], nil, maxSplice, spliceMove|spliceNonblock)
+			if serr == syscall.EAGAIN {
+				return false
+			}
+			n = int(m)
+			return true
+		})
+		if err == nil {
+			err = serr
+		}
+		if err != nil {
+			return written, err
+		}
+		if n == 0 {
+			// EOF.
+			return written, nil
+		}
+
+		// Pipe to socket.
+		for n > 0 {
+			var m int64
+			err := wc.Write(func(fd uintptr) bool {
+				m, serr = syscall.Splice(p[0], nil, int(fd), nil, n, spliceMove|spliceNonblock)
+				return serr != syscall.EAGAIN
+			})
+			if err == nil {
+				err = serr
+			}
+			if err != nil {
+				return written, err
+			}
+			if m == 0 {
+				return written, io.ErrNoProgress
+			}
+			n -= int(m)
+			written += m
+			report(int(m))
+		}
+	}
+}
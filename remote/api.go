@@ -0,0 +1,129 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package remote
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// APIPrefix is the prefix of the paths of the versioned API. Its
+// endpoints have no `.json` suffix: the format of the responses is
+// negotiated through the `Accept` header instead.
+const APIPrefix = "/api/v1"
+
+// Media types produced by the endpoints.
+const (
+	mediaJSON   = "application/json"
+	mediaText   = "text/plain"
+	mediaBinary = "application/octet-stream"
+)
+
+// operation describes an endpoint, and is used to generate the
+// OpenAPI document of the API.
+type operation struct {
+	// Methods accepted. If empty, any method is, and the endpoint
+	// is documented as a GET one.
+	Methods []string
+	Summary string
+	// Role required to perform the operation. If 0, the endpoint
+	// is public.
+	Role Role
+	// Query contains the names of the query parameters accepted.
+	Query []string
+	// In is a value of the type of the body of the POST and PUT
+	// requests, if any.
+	In interface{}
+	// Out is a value of the type of the response, if known.
+	Out interface{}
+	// Produces is the media type of the responses, JSON if empty.
+	Produces string
+	// Status is the status code of the successful responses, 200
+	// if 0.
+	Status int
+}
+
+type route struct {
+	path string // relative to APIPrefix
+	op   operation
+}
+
+// handle registers `h` at `path`, which is the legacy path of the
+// endpoint and is kept for compatibility, and at the corresponding
+// path of the versioned API, without the `.json` suffix. The
+// authentication required by `op` and the limits of the router are
+// enforced on both.
+func (r *Router) handle(path string, op operation, h http.HandlerFunc) {
+	if op.Produces == "" {
+		op.Produces = mediaJSON
+	}
+	h = r.limited(h)
+	if op.Role != 0 {
+		h = r.require(op.Role, h)
+	}
+	v1 := strings.TrimSuffix(path, ".json")
+	r.routes = append(r.routes, route{path: v1, op: op})
+
+	legacy := r.r.HandleFunc(path, h)
+	versioned := r.r.HandleFunc(APIPrefix+v1, negotiate(op.Produces, h))
+	if len(op.Methods) > 0 {
+		legacy.Methods(op.Methods...)
+		versioned.Methods(op.Methods...)
+	}
+}
+
+// negotiate makes `h` reply 406 to the requests that do not accept
+// `produces`, and 415 to the ones with a body that is not JSON.
+func negotiate(produces string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		if !accepts(req.Header.Get("Accept"), produces) {
+			writeError(w, fmt.Errorf("only %s is available", produces), http.StatusNotAcceptable)
+			return
+		}
+		if v := req.Header.Get("Content-Type"); v != "" && req.ContentLength != 0 {
+			if t, _, err := mime.ParseMediaType(v); err != nil || t != mediaJSON {
+				writeError(w, fmt.Errorf("unsupported content type %q, use %s", v, mediaJSON), http.StatusUnsupportedMediaType)
+				return
+			}
+		}
+		h(w, req)
+	}
+}
+
+// accepts reports whether `mediaType` is acceptable according to the
+// `Accept` header `header`. An empty header accepts anything.
+func accepts(header, mediaType string) bool {
+	if header == "" {
+		return true
+	}
+	major := strings.SplitN(mediaType, "/", 2)[0]
+	for _, v := range strings.Split(header, ",") {
+		t, params, err := mime.ParseMediaType(strings.TrimSpace(v))
+		if err != nil {
+			continue
+		}
+		if q := params["q"]; q == "0" || q == "0.0" || q == "0.00" || q == "0.000" {
+			continue
+		}
+		if t == "*/*" || t == major+"/*" || t == mediaType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package remote_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/metrics"
+	"github.com/booster-proj/booster/remote"
+	"github.com/booster-proj/booster/source"
+	"github.com/booster-proj/booster/store"
+)
+
+func TestVersionedAPI(t *testing.T) {
+	router := remote.NewRouter()
+	router.Store = store.New(new(core.Balancer))
+	router.Tokens = []remote.Token{{Name: "ops", Role: remote.RoleOperator, Secret: "o"}}
+	router.SetupRoutes()
+
+	tt := []struct {
+		method, path, accept, contentType string
+		code                              int
+	}{
+		{"GET", "/api/v1/health", "", "", 200},
+		{"GET", "/api/v1/sources", "application/json", "", 200},
+		{"GET", "/api/v1/sources", "text/html, */*;q=0.1", "", 200},
+		{"GET", "/api/v1/sources", "text/html", "", 406},
+		{"GET", "/api/v1/sources", "application/json;q=0", "", 406},
+		{"GET", "/api/v1/sources.json", "", "", 404},
+		{"POST", "/api/v1/policies/block", "", "application/json; charset=utf-8", 201},
+		{"POST", "/api/v1/policies/block", "", "application/x-www-form-urlencoded", 415},
+		{"DELETE", "/api/v1/policies/block_en0", "", "", 200},
+		// The legacy paths are still available.
+		{"GET", "/sources.json", "", "", 200},
+		{"POST", "/policies/block.json", "", "", 201},
+	}
+	for i, v := range tt {
+		req := httptest.NewRequest(v.method, v.path, strings.NewReader(`{"source_id": "en0"}`))
+		req.Header.Set("Authorization", "Bearer o")
+		if v.accept != "" {
+			req.Header.Set("Accept", v.accept)
+		}
+		if v.contentType != "" {
+			req.Header.Set("Content-Type", v.contentType)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != v.code {
+			t.Fatalf("%d: %s %s: unexpected status code: wanted %d, found %d", i, v.method, v.path, v.code, w.Code)
+		}
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	router := remote.NewRouter()
+	router.Store = store.New(new(core.Balancer))
+	router.Tokens = []remote.Token{{Name: "ops", Role: remote.RoleOperator, Secret: "o"}}
+	router.SetupRoutes()
+
+	// The document is public.
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/openapi.json", nil))
+	if w.Code != 200 {
+		t.Fatalf("Unexpected status code: %d", w.Code)
+	}
+
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]struct {
+			Security    []map[string][]string `json:"security"`
+			RequestBody struct {
+				Content map[string]struct {
+					Schema struct {
+						Properties map[string]interface{} `json:"properties"`
+					} `json:"schema"`
+				} `json:"content"`
+			} `json:"requestBody"`
+			Responses map[string]interface{} `json:"responses"`
+		} `json:"paths"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Fatalf("Unexpected OpenAPI version: %q", doc.OpenAPI)
+	}
+
+	block, ok := doc.Paths["/policies/block"]["post"]
+	if !ok {
+		t.Fatalf("Block policy endpoint not documented: %v", doc.Paths)
+	}
+	if _, ok := block.RequestBody.Content["application/json"].Schema.Properties["source_id"]; !ok {
+		t.Fatalf("Unexpected request body: %+v", block.RequestBody)
+	}
+	if _, ok := block.Responses["201"]; !ok || len(block.Security) != 1 {
+		t.Fatalf("Unexpected operation: %+v", block)
+	}
+	if _, ok := doc.Paths["/policies/{id}"]["delete"]; !ok {
+		t.Fatalf("Policy removal endpoint not documented")
+	}
+	if health := doc.Paths["/health"]["get"]; len(health.Security) != 0 {
+		t.Fatalf("The health check should be public")
+	}
+}
+
+func TestAlertRules(t *testing.T) {
+	ss := store.New(new(core.Balancer))
+	ss.Put(source.NewStatic(source.StaticConfig{Name: "en0"}), source.NewStatic(source.StaticConfig{Name: "en1", Metered: true}))
+	router := remote.NewRouter()
+	router.Store = ss
+	router.MetricsProvider = metrics.New()
+	router.SetupRoutes()
+
+	get := func(path string, code int) metrics.RuleFile {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != code {
+			t.Fatalf("%s: unexpected status code: wanted %d, found %d", path, code, w.Code)
+		}
+		var f metrics.RuleFile
+		if code == 200 {
+			if err := json.NewDecoder(w.Body).Decode(&f); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return f
+	}
+	count := func(f metrics.RuleFile) map[string]int {
+		acc := make(map[string]int)
+		for _, g := range f.Groups {
+			for _, r := range g.Rules {
+				acc[r.Alert+"/"+r.Labels["source"]]++
+			}
+		}
+		return acc
+	}
+
+	if n := count(get("/api/v1/metrics/rules", 200)); len(n) != 4 || n["BoosterSourceDown/en0"] != 1 || n["BoosterSourceErrors/en1"] != 1 {
+		t.Fatalf("Unexpected rules: %v", n)
+	}
+
+	// The quota rules are generated only for the metered sources.
+	f := get("/api/v1/metrics/rules?quota=1000&period=168h", 200)
+	if n := count(f); len(n) != 5 || n["BoosterSourceQuota/en1"] != 1 {
+		t.Fatalf("Unexpected rules: %v", n)
+	}
+	for _, r := range f.Groups[0].Rules {
+		if r.Alert == "BoosterSourceQuota" && !strings.Contains(r.Expr, `[7d])) > 900`) {
+			t.Fatalf("Unexpected quota expression: %s", r.Expr)
+		}
+	}
+
+	get("/api/v1/metrics/rules?quota=lots", 400)
+}
@@ -0,0 +1,174 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package remote
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Role defines which operations an API token is allowed to perform.
+type Role int
+
+// Roles available, each one is allowed to perform the operations
+// of the previous ones.
+const (
+	// RoleViewer can only read the state of booster, e.g. sources,
+	// policies and metrics.
+	RoleViewer Role = iota + 1
+	// RoleOperator can also modify it, e.g. add and remove policies.
+	RoleOperator
+	// RoleAdmin can also access the audit log and change the log
+	// levels.
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleViewer:   "viewer",
+	RoleOperator: "operator",
+	RoleAdmin:    "admin",
+}
+
+func (r Role) String() string {
+	if s, ok := roleNames[r]; ok {
+		return s
+	}
+	return fmt.Sprintf("role(%d)", int(r))
+}
+
+// ParseRole returns the role named `s`.
+func ParseRole(s string) (Role, error) {
+	for k, v := range roleNames {
+		if v == s {
+			return k, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown role %q, expected viewer, operator or admin", s)
+}
+
+// Token is an API token.
+type Token struct {
+	// Name identifies the token owner, and it is used as actor in
+	// the audit log.
+	Name   string
+	Role   Role
+	Secret string
+}
+
+// ParseToken parses a token in the form `name:role:secret`.
+func ParseToken(s string) (Token, error) {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return Token{}, fmt.Errorf("invalid token %q, expected name:role:secret", s)
+	}
+	role, err := ParseRole(parts[1])
+	if err != nil {
+		return Token{}, err
+	}
+	return Token{Name: parts[0], Role: role, Secret: parts[2]}, nil
+}
+
+// FormatToken returns `t` in the form accepted by ParseToken.
+func FormatToken(t Token) string {
+	return t.Name + ":" + t.Role.String() + ":" + t.Secret
+}
+
+// ReadTokens reads the tokens contained in the file at `path`, one
+// per line. Empty lines and lines starting with # are ignored.
+func ReadTokens(path string) ([]Token, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var acc []Token
+	s := bufio.NewScanner(f)
+	for i := 1; s.Scan(); i++ {
+		l := strings.TrimSpace(s.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		t, err := ParseToken(l)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, i, err)
+		}
+		acc = append(acc, t)
+	}
+	return acc, s.Err()
+}
+
+// tokens returns the API tokens currently accepted: the ones imported
+// through the `/config/import` endpoint, if any, or Tokens.
+func (r *Router) tokens() []Token {
+	if v, ok := r.imported.Load().([]Token); ok {
+		return v
+	}
+	return r.Tokens
+}
+
+// setTokens replaces the API tokens accepted. Authentication cannot
+// be enabled or disabled this way, see require.
+func (r *Router) setTokens(tokens []Token) {
+	r.imported.Store(tokens)
+}
+
+// authenticate returns the token used by request `r`, provided with
+// the `Authorization: Bearer <secret>` header.
+func (r *Router) authenticate(req *http.Request) (Token, bool) {
+	h := req.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return Token{}, false
+	}
+	secret := []byte(strings.TrimPrefix(h, "Bearer "))
+
+	var found Token
+	ok := false
+	// Compare every token, in constant time.
+	for _, v := range r.tokens() {
+		if subtle.ConstantTimeCompare([]byte(v.Secret), secret) == 1 {
+			found, ok = v, true
+		}
+	}
+	return found, ok
+}
+
+// require makes `h` accessible only with a token having at least
+// `role`. If the router has no tokens, authentication is disabled.
+func (r *Router) require(role Role, h http.HandlerFunc) http.HandlerFunc {
+	if len(r.Tokens) == 0 {
+		return h
+	}
+	return func(w http.ResponseWriter, req *http.Request) {
+		t, ok := r.authenticate(req)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="booster"`)
+			writeError(w, fmt.Errorf("authentication required"), http.StatusUnauthorized)
+			return
+		}
+		if t.Role < role {
+			writeError(w, fmt.Errorf("token %s (%v) is not allowed to perform this operation, %v required", t.Name, t.Role, role), http.StatusForbidden)
+			return
+		}
+		ctx := context.WithValue(req.Context(), actorKey{}, t.Name)
+		h(w, req.WithContext(ctx))
+	}
+}
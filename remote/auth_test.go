@@ -0,0 +1,92 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package remote_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/booster-proj/booster/audit"
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/remote"
+	"github.com/booster-proj/booster/speedtest"
+	"github.com/booster-proj/booster/store"
+	"github.com/booster-proj/booster/traceroute"
+)
+
+func TestParseToken(t *testing.T) {
+	tt, err := remote.ParseToken("grafana:viewer:s3cr:et")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tt.Name != "grafana" || tt.Role != remote.RoleViewer || tt.Secret != "s3cr:et" {
+		t.Fatalf("Unexpected token: %+v", tt)
+	}
+	for _, v := range []string{"", "grafana:viewer", "grafana:root:secret", ":admin:secret", "grafana:admin:"} {
+		if _, err := remote.ParseToken(v); err == nil {
+			t.Fatalf("Token %q should not be accepted", v)
+		}
+	}
+}
+
+func TestRequire(t *testing.T) {
+	router := remote.NewRouter()
+	router.Store = store.New(new(core.Balancer))
+	router.Audit = audit.New()
+	router.Speedtest = &speedtest.Tester{Store: router.Store}
+	router.Traceroute = &traceroute.Tracer{Store: router.Store}
+	router.Tokens = []remote.Token{
+		{Name: "grafana", Role: remote.RoleViewer, Secret: "v"},
+		{Name: "ops", Role: remote.RoleOperator, Secret: "o"},
+	}
+	router.SetupRoutes()
+
+	tt := []struct {
+		method, path, token string
+		code                int
+	}{
+		{"GET", "/health.json", "", 200},
+		{"GET", "/sources.json", "", 401},
+		{"GET", "/sources.json", "wrong", 401},
+		{"GET", "/sources.json", "v", 200},
+		{"POST", "/policies/block.json", "v", 403},
+		{"POST", "/policies/block.json", "o", 201},
+		{"GET", "/audit.json", "o", 403},
+		{"GET", "/speedtest/download?bytes=10", "", 401},
+		{"GET", "/speedtest/download?bytes=10", "v", 200},
+		{"POST", "/traceroute/en0.json?host=example.com", "v", 403},
+		{"POST", "/traceroute/en0.json", "o", 400},
+		{"POST", "/traceroute/en0.json?host=example.com", "o", 404},
+	}
+	for i, v := range tt {
+		req := httptest.NewRequest(v.method, v.path, strings.NewReader(`{"source_id": "en0"}`))
+		if v.token != "" {
+			req.Header.Set("Authorization", "Bearer "+v.token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != v.code {
+			t.Fatalf("%d: %s %s: unexpected status code: wanted %d, found %d", i, v.method, v.path, v.code, w.Code)
+		}
+	}
+
+	// The token name is used as actor in the audit log.
+	entries, _ := router.Audit.Query(audit.Filter{})
+	if len(entries) != 1 || entries[0].Actor != "ops" {
+		t.Fatalf("Unexpected entries: %+v", entries)
+	}
+}
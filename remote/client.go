@@ -0,0 +1,270 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/booster-proj/booster/dialer"
+	"github.com/booster-proj/booster/events"
+	"github.com/booster-proj/booster/traceroute"
+)
+
+// Error is returned by Client when the API replies with an error.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("api: %s (%d)", e.Message, e.StatusCode)
+}
+
+// Client performs requests to the versioned API of a running booster.
+type Client struct {
+	// URL is the address of the API, e.g. "http://localhost:7764",
+	// or the path of its Unix socket, e.g.
+	// "unix:///run/booster/api.sock".
+	URL string
+	// Token is the secret of the API token used, if any.
+	Token string
+	// HTTPClient is the client used. If nil, http.DefaultClient is
+	// used. Only its Timeout applies to the Unix sockets.
+	HTTPClient *http.Client
+}
+
+// Do performs a request to `path`, relative to APIPrefix, encoding
+// `in` in its body, if not nil. The response is decoded into `out`,
+// if not nil, or copied into it if it is an io.Writer.
+func (c *Client) Do(ctx context.Context, method, path string, in, out interface{}) error {
+	resp, err := c.do(ctx, method, path, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch v := out.(type) {
+	case nil:
+		return nil
+	case io.Writer:
+		_, err = io.Copy(v, resp.Body)
+		return err
+	default:
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+}
+
+// do performs the request described by Do, returning the response if
+// it is successful. The caller must close its body.
+func (c *Client) do(ctx context.Context, method, path string, in interface{}) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+	base, hc := c.endpoint()
+	req, err := http.NewRequest(method, base+APIPrefix+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if in != nil {
+		req.Header.Set("Content-Type", mediaJSON)
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		var payload struct {
+			Error string `json:"error"`
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		if err := json.Unmarshal(b, &payload); err != nil || payload.Error == "" {
+			payload.Error = strings.TrimSpace(string(b))
+		}
+		return nil, &Error{StatusCode: resp.StatusCode, Message: payload.Error}
+	}
+	return resp, nil
+}
+
+// endpoint returns the base URL of the requests and the client
+// performing them, which dials the Unix socket of the URL, if any.
+func (c *Client) endpoint() (string, *http.Client) {
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	if !strings.HasPrefix(c.URL, "unix:") {
+		return strings.TrimSuffix(c.URL, "/"), hc
+	}
+	path := strings.TrimPrefix(strings.TrimPrefix(c.URL, "unix:"), "//")
+	var d net.Dialer
+	return "http://unix", &http.Client{
+		Timeout: hc.Timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return d.DialContext(ctx, "unix", path)
+			},
+			DisableKeepAlives: true,
+		},
+	}
+}
+
+// Sources returns the sources of booster.
+func (c *Client) Sources(ctx context.Context) ([]SourceDetails, error) {
+	var payload struct {
+		Sources []SourceDetails `json:"sources"`
+	}
+	err := c.Do(ctx, "GET", "/sources", nil, &payload)
+	return payload.Sources, err
+}
+
+// Policies returns the policies of booster, as they are encoded by
+// the API.
+func (c *Client) Policies(ctx context.Context) ([]map[string]interface{}, error) {
+	var payload struct {
+		Policies []map[string]interface{} `json:"policies"`
+	}
+	err := c.Do(ctx, "GET", "/policies", nil, &payload)
+	return payload.Policies, err
+}
+
+// AddPolicy creates the policy described by `in`, returning it as it
+// is encoded by the API.
+func (c *Client) AddPolicy(ctx context.Context, in PolicyInput) (map[string]interface{}, error) {
+	if in.Type == "" {
+		return nil, fmt.Errorf("api: policy type cannot be empty")
+	}
+	var p map[string]interface{}
+	err := c.Do(ctx, "POST", "/policies/"+url.PathEscape(in.Type), in, &p)
+	return p, err
+}
+
+// DelPolicy removes the policy identified by `id`.
+func (c *Client) DelPolicy(ctx context.Context, id string) error {
+	return c.Do(ctx, "DELETE", "/policies/"+url.PathEscape(id), nil, nil)
+}
+
+// Conns returns the connections open.
+func (c *Client) Conns(ctx context.Context) ([]dialer.ConnInfo, error) {
+	var conns []dialer.ConnInfo
+	err := c.Do(ctx, "GET", "/conns", nil, &conns)
+	return conns, err
+}
+
+// KillConn closes the connection identified by `id`.
+func (c *Client) KillConn(ctx context.Context, id uint64) error {
+	return c.Do(ctx, "DELETE", "/conns/"+strconv.FormatUint(id, 10), nil, nil)
+}
+
+// Traceroute traces the route to `host` through the source identified
+// by `id`.
+func (c *Client) Traceroute(ctx context.Context, id, host string) (traceroute.Result, error) {
+	var res traceroute.Result
+	err := c.Do(ctx, "POST", "/traceroute/"+url.PathEscape(id)+"?host="+url.QueryEscape(host), nil, &res)
+	return res, err
+}
+
+// Metrics writes the metrics of booster, in the Prometheus text
+// format, into `w`.
+func (c *Client) Metrics(ctx context.Context, w io.Writer) error {
+	return c.Do(ctx, "GET", "/metrics", nil, w)
+}
+
+// Stream calls `f` with each event of the event stream, restricted to
+// `topics` if not empty, until `ctx` is done or `f` returns an error.
+// The data of the events is passed to `f` as a json.RawMessage, e.g.
+// a Stats value for the TopicStats events. As the stream is closed by
+// the server when its write timeout expires, Stream opens it again
+// each time it ends.
+func (c *Client) Stream(ctx context.Context, topics []string, f func(events.Event) error) error {
+	path := "/events/stream"
+	if len(topics) > 0 {
+		path += "?topics=" + url.QueryEscape(strings.Join(topics, ","))
+	}
+	for {
+		received, err := c.stream(ctx, path, f)
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			return err
+		case !received:
+			return fmt.Errorf("api: event stream closed")
+		}
+	}
+}
+
+// stream reads the event stream at `path` until it ends, reporting
+// whether some event was received. Once some event was, the errors
+// reading the stream are not reported, as they are produced by the
+// server closing it.
+func (c *Client) stream(ctx context.Context, path string, f func(events.Event) error) (bool, error) {
+	resp, err := c.do(ctx, "GET", path, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	var received bool
+	var data []byte
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimSpace(strings.TrimPrefix(line, "data:"))...)
+		case line == "" && len(data) > 0:
+			var e struct {
+				events.Event
+				Data json.RawMessage `json:"data"`
+			}
+			if err := json.Unmarshal(data, &e); err != nil {
+				return received, err
+			}
+			data = data[:0]
+			received = true
+			e.Event.Data = e.Data
+			if err := f(e.Event); err != nil {
+				return received, err
+			}
+		}
+	}
+	if err := sc.Err(); err != nil && !received {
+		return false, err
+	}
+	return received, nil
+}
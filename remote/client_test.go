@@ -0,0 +1,99 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package remote_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/remote"
+	"github.com/booster-proj/booster/store"
+)
+
+func TestClient(t *testing.T) {
+	router := remote.NewRouter()
+	router.Store = store.New(new(core.Balancer))
+	router.Tokens = []remote.Token{{Name: "ops", Role: remote.RoleOperator, Secret: "o"}}
+	router.SetupRoutes()
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := &remote.Client{URL: srv.URL + "/", Token: "o"}
+	p, err := c.AddPolicy(ctx, remote.PolicyInput{
+		Type:          "reserve",
+		PoliciesInput: remote.PoliciesInput{SourceID: "en0", Ports: store.Ports{{From: 443, To: 443}}},
+		Hosts:         []string{"a.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p["id"] != "reserve_en0_on_443" {
+		t.Fatalf("Unexpected policy: %v", p)
+	}
+
+	policies, err := c.Policies(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) != 1 {
+		t.Fatalf("Unexpected policies: %v", policies)
+	}
+	if err := c.DelPolicy(ctx, "reserve_en0_on_443"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Errors contain the message and the status code of the reply.
+	err = c.DelPolicy(ctx, "reserve_en0_on_443")
+	if e, ok := err.(*remote.Error); !ok || e.StatusCode != 404 || e.Message == "" {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	c.Token = "wrong"
+	if _, err := c.Sources(ctx); err == nil {
+		t.Fatalf("The token should not be accepted")
+	}
+}
+
+func TestClient_unix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "booster-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "api.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := remote.NewRouter()
+	router.Store = store.New(new(core.Balancer))
+	router.SetupRoutes()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go remote.New(router).Serve(ctx, ln)
+
+	c := &remote.Client{URL: "unix://" + path}
+	if _, err := c.Sources(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,371 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/booster-proj/booster/acl"
+	"github.com/booster-proj/booster/geoip"
+	"github.com/booster-proj/booster/protocol"
+	"github.com/booster-proj/booster/qos"
+	"github.com/booster-proj/booster/schedule"
+	"github.com/booster-proj/booster/sockopt"
+	"github.com/booster-proj/booster/store"
+)
+
+// PolicyInput describes a policy of any type, e.g. one of the policies
+// evaluated by the `/policies/simulate.json` endpoint or stored in a
+// ConfigDocument. Type is one of block, reserve, avoid, metered,
+// sticky, process, protocol, dscp, fwmark, expr, webhook and geo, and the
+// other fields are the ones accepted by the endpoint creating the
+// policies of that type.
+type PolicyInput struct {
+	Type string `json:"type"`
+	PoliciesInput
+	Hosts      []string `json:"hosts,omitempty"`
+	Metered    bool     `json:"metered,omitempty"`
+	Name       string   `json:"name,omitempty"`
+	Expression string   `json:"expression,omitempty"`
+	Process    string   `json:"process,omitempty"`
+	Protocol   string   `json:"protocol,omitempty"`
+	DSCP       string   `json:"dscp,omitempty"`
+	FWMark     string   `json:"fwmark,omitempty"`
+	URL        string   `json:"url,omitempty"`
+	FailOpen   bool     `json:"fail_open,omitempty"`
+	CacheTTL   string   `json:"cache_ttl,omitempty"`
+	Countries  []string `json:"countries,omitempty"`
+	Continents []string `json:"continents,omitempty"`
+	ASNs       []uint   `json:"asns,omitempty"`
+	Domains    []string `json:"domains,omitempty"`
+	DomainSets []string `json:"domain_sets,omitempty"`
+}
+
+// newPolicy returns the policy described by `in`. `db` is only
+// required by the geo policies.
+func newPolicy(s *store.SourceStore, db *geoip.DB, in PolicyInput) (store.Policy, error) {
+	if in.SourceID == "" {
+		switch in.Type {
+		case "block", "reserve", "avoid", "process", "protocol", "geo":
+			return nil, fmt.Errorf("validation error: source_id cannot be empty")
+		}
+	}
+	if in.Name == "" {
+		switch in.Type {
+		case "dscp", "fwmark", "expr", "webhook":
+			return nil, fmt.Errorf("validation error: name cannot be empty")
+		}
+	}
+
+	switch in.Type {
+	case "block":
+		p := store.NewBlockPolicy(in.Issuer, in.SourceID)
+		p.Reason = in.Reason
+		return p, nil
+	case "reserve":
+		if len(in.Hosts) == 0 && len(in.Ports) == 0 {
+			return nil, fmt.Errorf("validation error: hosts and ports cannot be both empty lists")
+		}
+		p := store.NewReservedPolicy(in.Issuer, in.SourceID, in.Hosts...)
+		p.OnPorts(in.Ports)
+		p.Reason = in.Reason
+		return p, nil
+	case "avoid":
+		if in.Target == "" {
+			return nil, fmt.Errorf("validation error: target cannot be empty")
+		}
+		p := store.NewAvoidPolicy(in.Issuer, in.SourceID, in.Target)
+		p.OnPorts(in.Ports)
+		p.Reason = in.Reason
+		return p, nil
+	case "metered":
+		p := store.NewMeteredPolicy(in.Issuer, in.Metered, s.IsMetered, in.Hosts...)
+		p.OnPorts(in.Ports)
+		p.Reason = in.Reason
+		return p, nil
+	case "sticky":
+		return newStickyPolicy(s, StickyPolicyInput{PoliciesInput: in.PoliciesInput, Domains: in.Domains, DomainSets: in.DomainSets})
+	case "process":
+		if in.Process == "" {
+			return nil, fmt.Errorf("validation error: process cannot be empty")
+		}
+		p := store.NewProcessPolicy(in.Issuer, in.Process, in.SourceID)
+		p.Reason = in.Reason
+		return p, nil
+	case "protocol":
+		proto, err := protocol.Parse(in.Protocol)
+		if err != nil {
+			return nil, fmt.Errorf("validation error: %v", err)
+		}
+		p := store.NewProtocolPolicy(in.Issuer, proto, in.SourceID)
+		p.Reason = in.Reason
+		return p, nil
+	case "dscp":
+		dscp, err := qos.ParseDSCP(in.DSCP)
+		if err != nil {
+			return nil, fmt.Errorf("validation error: dscp: %v", err)
+		}
+		p := store.NewDSCPPolicy(in.Issuer, in.Name, dscp, in.Ports, in.Hosts...)
+		p.Reason = in.Reason
+		return p, nil
+	case "fwmark":
+		mark, err := sockopt.ParseMark(in.FWMark)
+		if err != nil {
+			return nil, fmt.Errorf("validation error: fwmark: %v", err)
+		}
+		p := store.NewFWMarkPolicy(in.Issuer, in.Name, mark, in.Ports, in.Hosts...)
+		p.Reason = in.Reason
+		return p, nil
+	case "expr":
+		p, err := store.NewExprPolicy(in.Issuer, in.Name, in.Expression, s.IsMetered)
+		if err != nil {
+			return nil, fmt.Errorf("validation error: %v", err)
+		}
+		p.Reason = in.Reason
+		return p, nil
+	case "webhook":
+		if !strings.HasPrefix(in.URL, "http://") && !strings.HasPrefix(in.URL, "https://") {
+			return nil, fmt.Errorf("validation error: url must be an http or https URL")
+		}
+		ttl := store.DefaultWebhookTTL
+		if in.CacheTTL != "" {
+			var err error
+			if ttl, err = time.ParseDuration(in.CacheTTL); err != nil {
+				return nil, fmt.Errorf("validation error: %v", err)
+			}
+		}
+		p := store.NewWebhookPolicy(in.Issuer, in.Name, in.URL, in.FailOpen, ttl)
+		p.Reason = in.Reason
+		return p, nil
+	case "geo":
+		if db == nil {
+			return nil, fmt.Errorf("validation error: geo policies require a GeoIP database")
+		}
+		if len(in.Countries)+len(in.Continents)+len(in.ASNs) == 0 {
+			return nil, fmt.Errorf("validation error: at least one of countries, continents or asns is required")
+		}
+		p := store.NewGeoPolicy(in.Issuer, in.SourceID, db.Locate, in.Countries, in.Continents, in.ASNs)
+		p.Reason = in.Reason
+		return p, nil
+	default:
+		return nil, fmt.Errorf("validation error: unsupported policy type %q", in.Type)
+	}
+}
+
+// policyInput returns the description of `p`, from which newPolicy
+// creates it again. Returns false for the policies that cannot be
+// described, e.g. the ones provided by plugins.
+func policyInput(p store.Policy) (PolicyInput, bool) {
+	var in PolicyInput
+	switch v := p.(type) {
+	case *store.BlockPolicy:
+		in = PolicyInput{Type: "block", PoliciesInput: PoliciesInput{SourceID: v.SourceID, Reason: v.Reason, Issuer: v.Issuer}}
+	case *store.ReservedPolicy:
+		in = PolicyInput{Type: "reserve", PoliciesInput: PoliciesInput{SourceID: v.SourceID, Reason: v.Reason, Issuer: v.Issuer, Ports: v.Ports}, Hosts: v.Addrs}
+	case *store.AvoidPolicy:
+		in = PolicyInput{Type: "avoid", PoliciesInput: PoliciesInput{SourceID: v.SourceID, Target: v.Address, Reason: v.Reason, Issuer: v.Issuer, Ports: v.Ports}}
+	case *store.MeteredPolicy:
+		in = PolicyInput{Type: "metered", PoliciesInput: PoliciesInput{Reason: v.Reason, Issuer: v.Issuer, Ports: v.Ports}, Hosts: v.Addrs, Metered: v.Metered}
+	case *store.StickyPolicy:
+		in = PolicyInput{Type: "sticky", PoliciesInput: PoliciesInput{Issuer: v.Issuer}, Domains: v.Domains}
+	case *store.ProcessPolicy:
+		in = PolicyInput{Type: "process", PoliciesInput: PoliciesInput{SourceID: v.SourceID, Reason: v.Reason, Issuer: v.Issuer}, Process: v.Process}
+	case *store.ProtocolPolicy:
+		in = PolicyInput{Type: "protocol", PoliciesInput: PoliciesInput{SourceID: v.SourceID, Reason: v.Reason, Issuer: v.Issuer}, Protocol: string(v.Protocol)}
+	case *store.DSCPPolicy:
+		in = PolicyInput{Type: "dscp", PoliciesInput: PoliciesInput{Reason: v.Reason, Issuer: v.Issuer, Ports: v.Ports}, Name: strings.TrimPrefix(v.ID(), "dscp_"), Hosts: v.Addrs, DSCP: strconv.Itoa(v.DSCP)}
+	case *store.FWMarkPolicy:
+		in = PolicyInput{Type: "fwmark", PoliciesInput: PoliciesInput{Reason: v.Reason, Issuer: v.Issuer, Ports: v.Ports}, Name: strings.TrimPrefix(v.ID(), "fwmark_"), Hosts: v.Addrs, FWMark: fmt.Sprintf("%#x", v.Mark)}
+	case *store.ExprPolicy:
+		in = PolicyInput{Type: "expr", PoliciesInput: PoliciesInput{Reason: v.Reason, Issuer: v.Issuer}, Name: strings.TrimPrefix(v.ID(), "expr_"), Expression: v.Expr}
+	case *store.WebhookPolicy:
+		in = PolicyInput{Type: "webhook", PoliciesInput: PoliciesInput{Reason: v.Reason, Issuer: v.Issuer}, Name: strings.TrimPrefix(v.ID(), "webhook_"), URL: v.URL, FailOpen: v.FailOpen, CacheTTL: v.CacheTTL.String()}
+	case *store.GeoPolicy:
+		in = PolicyInput{Type: "geo", PoliciesInput: PoliciesInput{SourceID: v.SourceID, Reason: v.Reason, Issuer: v.Issuer}, Countries: v.Countries, Continents: v.Continents, ASNs: v.ASNs}
+	default:
+		return in, false
+	}
+	return in, true
+}
+
+// ConfigVersion is the version of the ConfigDocument format.
+const ConfigVersion = 1
+
+// ConfigDocument contains the configuration changed at runtime through
+// the API, as returned by the `/config/export` endpoint and accepted
+// by the `/config/import` one. The configuration provided at startup,
+// e.g. the strategy, is not part of it.
+//
+// When importing, the state and the policies are always replaced,
+// while ACL, Schedules and Tokens are replaced only if present: an
+// absent field keeps the current configuration, and an empty one
+// clears it.
+type ConfigDocument struct {
+	Version int `json:"version"`
+	store.State
+	Policies []PolicyInput `json:"policies"`
+	// ACL and Schedules are exported only if they can be managed
+	// through the API.
+	ACL       *acl.Rules       `json:"acl,omitempty"`
+	Schedules *[]schedule.Rule `json:"schedules,omitempty"`
+	// Tokens are the API tokens, in the name:role:secret form.
+	Tokens []string `json:"tokens,omitempty"`
+}
+
+func makeConfigExportHandler(r *Router) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		doc := ConfigDocument{
+			Version:  ConfigVersion,
+			State:    r.Store.State(),
+			Policies: []PolicyInput{},
+		}
+		for _, p := range r.Store.GetPoliciesSnapshot() {
+			if in, ok := policyInput(p); ok {
+				doc.Policies = append(doc.Policies, in)
+			}
+		}
+		if l := r.ACL; l != nil {
+			rules := l.Rules()
+			doc.ACL = &rules
+		}
+		if s := r.Schedules; s != nil {
+			rules := s.Rules()
+			doc.Schedules = &rules
+		}
+		for _, v := range r.tokens() {
+			doc.Tokens = append(doc.Tokens, FormatToken(v))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(doc)
+	}
+}
+
+func makeConfigImportHandler(r *Router) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		defer req.Body.Close()
+		var doc ConfigDocument
+		if err := json.NewDecoder(req.Body).Decode(&doc); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		if doc.Version != ConfigVersion {
+			writeError(w, fmt.Errorf("validation error: unsupported version %d, expected %d", doc.Version, ConfigVersion), http.StatusBadRequest)
+			return
+		}
+
+		// Validate everything before changing anything.
+		policies := make([]store.Policy, 0, len(doc.Policies))
+		for _, v := range doc.Policies {
+			p, err := newPolicy(r.Store, r.GeoIP, v)
+			if err != nil {
+				writeError(w, err, http.StatusBadRequest)
+				return
+			}
+			policies = append(policies, p)
+		}
+		if doc.ACL != nil {
+			if r.ACL == nil {
+				writeError(w, fmt.Errorf("validation error: the access control lists cannot be managed through the API"), http.StatusBadRequest)
+				return
+			}
+			if _, err := acl.New(*doc.ACL); err != nil {
+				writeError(w, fmt.Errorf("validation error: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := store.ValidatePolicies(policies); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		if err := doc.State.Validate(); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		if doc.Schedules != nil {
+			if r.Schedules == nil {
+				writeError(w, fmt.Errorf("validation error: the schedules cannot be managed through the API"), http.StatusBadRequest)
+				return
+			}
+			if err := schedule.Validate(*doc.Schedules); err != nil {
+				writeError(w, fmt.Errorf("validation error: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+		var tokens []Token
+		if doc.Tokens != nil {
+			if len(r.Tokens) == 0 {
+				writeError(w, fmt.Errorf("validation error: the API does not require authentication, tokens must be configured at startup"), http.StatusBadRequest)
+				return
+			}
+			for _, v := range doc.Tokens {
+				t, err := ParseToken(v)
+				if err != nil {
+					writeError(w, fmt.Errorf("validation error: %v", err), http.StatusBadRequest)
+					return
+				}
+				tokens = append(tokens, t)
+			}
+			if !hasAdmin(tokens) {
+				writeError(w, fmt.Errorf("validation error: the tokens must include an admin one"), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// The schedules and the state can still fail to be saved:
+		// they are set first, and restored on failure.
+		var schedules []schedule.Rule
+		if doc.Schedules != nil {
+			schedules = r.Schedules.Rules()
+			if err := r.Schedules.Set(*doc.Schedules); err != nil {
+				writeError(w, err, http.StatusInternalServerError)
+				return
+			}
+		}
+		state := r.Store.State()
+		if err := r.Store.SetState(doc.State); err != nil {
+			r.Store.SetState(state)
+			if doc.Schedules != nil {
+				r.Schedules.Set(schedules)
+			}
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+		r.Store.SetPolicies(policies)
+		if doc.ACL != nil {
+			r.ACL.Set(*doc.ACL)
+		}
+		if tokens != nil {
+			r.setTokens(tokens)
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func hasAdmin(tokens []Token) bool {
+	for _, v := range tokens {
+		if v.Role == RoleAdmin {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package remote_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/booster-proj/booster/acl"
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/remote"
+	"github.com/booster-proj/booster/schedule"
+	"github.com/booster-proj/booster/store"
+)
+
+func TestConfig(t *testing.T) {
+	newRouter := func() *remote.Router {
+		router := remote.NewRouter()
+		router.Store = store.New(new(core.Balancer))
+		router.Schedules = new(schedule.Schedules)
+		router.Tokens = []remote.Token{{Name: "root", Role: remote.RoleAdmin, Secret: "a"}}
+		router.SetupRoutes()
+		return router
+	}
+	do := func(router *remote.Router, method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	src := newRouter()
+	src.Store.SetTier("en0", store.TierBackup)
+	src.Store.AppendPolicy(store.NewBlockPolicy("T", "en0"))
+	reserve := store.NewReservedPolicy("T", "en1", "a.com")
+	reserve.OnPorts(store.Ports{{From: 443, To: 443}})
+	src.Store.AppendPolicy(reserve)
+	p, err := store.NewExprPolicy("T", "night", `source == "en1"`, src.Store.IsMetered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.Store.AppendPolicy(p)
+
+	w := do(src, "GET", "/config/export", "a", "")
+	if w.Code != 200 {
+		t.Fatalf("Unexpected status code: %d: %s", w.Code, w.Body)
+	}
+	var doc remote.ConfigDocument
+	if err := json.NewDecoder(bytes.NewReader(w.Body.Bytes())).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Version != remote.ConfigVersion || len(doc.Policies) != 3 || len(doc.Tokens) != 1 {
+		t.Fatalf("Unexpected document: %+v", doc)
+	}
+
+	dst := newRouter()
+	dst.Store.AppendPolicy(store.NewBlockPolicy("T", "en2"))
+	body := strings.Replace(w.Body.String(), "root:admin:a", "root:admin:b", 1)
+	if w := do(dst, "POST", "/config/import", "a", body); w.Code != 200 {
+		t.Fatalf("Unexpected status code: %d: %s", w.Code, w.Body)
+	}
+	if !reflect.DeepEqual(dst.Store.State(), src.Store.State()) {
+		t.Fatalf("Unexpected state: %+v", dst.Store.State())
+	}
+	var ids []string
+	for _, p := range dst.Store.GetPoliciesSnapshot() {
+		ids = append(ids, p.ID())
+	}
+	if !reflect.DeepEqual(ids, []string{"block_en0", "reserve_en1_on_443", "expr_night"}) {
+		t.Fatalf("Unexpected policies: %v", ids)
+	}
+
+	// The tokens were replaced too.
+	if w := do(dst, "GET", "/config/export", "a", ""); w.Code != 401 {
+		t.Fatalf("The old token should not be accepted, found status code %d", w.Code)
+	}
+	if w := do(dst, "GET", "/config/export", "b", ""); w.Code != 200 {
+		t.Fatalf("The imported token should be accepted, found status code %d", w.Code)
+	}
+
+	tt := []string{
+		`{"version": 2}`,
+		`{"version": 1, "policies": [{"type": "block"}]}`,
+		`{"version": 1, "tokens": ["ops:operator:o"]}`,
+		`{"version": 1, "acl": {"allow": ["10.0.0.0/8"]}}`,
+		// The policies are not replaced when the rest is invalid.
+		`{"version": 1, "groups": [{"name": "cellular"}]}`,
+		`{"version": 1, "schedules": [{"id": "night", "clients": ["10.0.0.300"]}]}`,
+	}
+	for i, v := range tt {
+		if w := do(dst, "POST", "/config/import", "b", v); w.Code != 400 {
+			t.Fatalf("%d: Unexpected status code: %d", i, w.Code)
+		}
+	}
+	if len(dst.Store.GetPoliciesSnapshot()) != 3 {
+		t.Fatalf("Invalid documents should not change the policies")
+	}
+}
+
+func TestConfig_absent(t *testing.T) {
+	router := remote.NewRouter()
+	router.Store = store.New(new(core.Balancer))
+	router.ACL, _ = acl.New(acl.Rules{Deny: []string{"10.0.0.1"}})
+	router.Schedules = new(schedule.Schedules)
+	router.Schedules.Set([]schedule.Rule{{ID: "night", Clients: []string{"10.0.0.2"}, Deny: []schedule.Window{{From: "22:00", To: "06:00"}}}})
+	router.SetupRoutes()
+	do := func(body string) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/config/import", strings.NewReader(body)))
+		if w.Code != 200 {
+			t.Fatalf("Unexpected status code: %d: %s", w.Code, w.Body)
+		}
+	}
+
+	// The absent fields are kept.
+	do(`{"version": 1}`)
+	if n := len(router.ACL.Rules().Deny); n != 1 {
+		t.Fatalf("Unexpected deny rules: %d", n)
+	}
+	if n := len(router.Schedules.Rules()); n != 1 {
+		t.Fatalf("Unexpected schedules: %d", n)
+	}
+
+	// The empty ones are cleared.
+	do(`{"version": 1, "acl": {}, "schedules": []}`)
+	if n := len(router.ACL.Rules().Deny); n != 0 {
+		t.Fatalf("Unexpected deny rules: %d", n)
+	}
+	if n := len(router.Schedules.Rules()); n != 0 {
+		t.Fatalf("Unexpected schedules: %d", n)
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package remote
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// DashboardPrefix is the path the web dashboard is served at.
+const DashboardPrefix = "/ui/"
+
+//go:embed dashboard
+var dashboard embed.FS
+
+// makeDashboardHandler serves the files of the web dashboard, which
+// uses the versioned API authenticating with the token provided by
+// the user, if any: the files themselves are public.
+func makeDashboardHandler() http.HandlerFunc {
+	files, err := fs.Sub(dashboard, "dashboard")
+	if err != nil {
+		panic(err)
+	}
+	h := http.StripPrefix(DashboardPrefix, http.FileServer(http.FS(files)))
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		h.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// The dashboard follows the event stream of the API for the sources and
+// their throughput, and polls the policies and the connections.
+"use strict";
+
+const api = "/api/v1";
+const samples = 60; // points of each chart
+const pollInterval = 5000;
+
+let token = localStorage.getItem("booster-token") || "";
+let prev = null; // previous stats event
+const history = {}; // source -> [{down, up}]
+let hits = {};
+
+function el(tag, props, ...children) {
+	const e = document.createElement(tag);
+	Object.assign(e, props || {});
+	for (const c of children) {
+		e.append(c);
+	}
+	return e;
+}
+
+function formatBytes(n) {
+	const units = ["B", "kB", "MB", "GB", "TB"];
+	let i = 0;
+	while (n >= 1000 && i < units.length - 1) {
+		n /= 1000;
+		i++;
+	}
+	return (i === 0 ? n.toFixed(0) : n.toFixed(1)) + " " + units[i];
+}
+
+function setStatus(text, error) {
+	const s = document.getElementById("status");
+	s.textContent = text;
+	s.className = error ? "error" : "";
+}
+
+async function call(method, path, body) {
+	const headers = {};
+	if (token) {
+		headers["Authorization"] = "Bearer " + token;
+	}
+	if (body !== undefined) {
+		headers["Content-Type"] = "application/json";
+		body = JSON.stringify(body);
+	}
+	const resp = await fetch(api + path, { method, headers, body });
+	if (!resp.ok) {
+		let msg = resp.statusText;
+		try {
+			msg = (await resp.json()).error || msg;
+		} catch (e) {}
+		throw new Error(msg + " (" + resp.status + ")");
+	}
+	const type = resp.headers.get("Content-Type") || "";
+	return type.startsWith("application/json") ? resp.json() : null;
+}
+
+// act performs a change, refreshing the view afterwards.
+async function act(method, path, body) {
+	try {
+		await call(method, path, body);
+		await poll();
+	} catch (e) {
+		alert(e.message);
+	}
+}
+
+function drawChart(canvas, points) {
+	const w = (canvas.width = canvas.clientWidth * devicePixelRatio);
+	const h = (canvas.height = canvas.clientHeight * devicePixelRatio);
+	const ctx = canvas.getContext("2d");
+	const max = Math.max(1, ...points.map((p) => Math.max(p.down, p.up)));
+	for (const [key, color] of [["down", "#1e88e5"], ["up", "#43a047"]]) {
+		ctx.beginPath();
+		ctx.strokeStyle = color;
+		ctx.lineWidth = devicePixelRatio;
+		points.forEach((p, i) => {
+			const x = (w * (i + samples - points.length)) / (samples - 1);
+			const y = h - (h * p[key]) / max;
+			i === 0 ? ctx.moveTo(x, y) : ctx.lineTo(x, y);
+		});
+		ctx.stroke();
+	}
+}
+
+function renderSources(stats, elapsed) {
+	const box = document.getElementById("sources");
+	box.replaceChildren();
+	for (const src of stats.sources || []) {
+		const old = prev && (prev.sources || []).find((v) => v.name === src.name);
+		const h = (history[src.name] = history[src.name] || []);
+		if (old && elapsed > 0) {
+			h.push({
+				down: Math.max(0, src.received_bytes - old.received_bytes) / elapsed,
+				up: Math.max(0, src.sent_bytes - old.sent_bytes) / elapsed,
+			});
+			if (h.length > samples) {
+				h.shift();
+			}
+		}
+		const last = h[h.length - 1] || { down: 0, up: 0 };
+		const blocked = src.state === "blocked";
+		const canvas = el("canvas");
+		box.append(
+			el("div", { className: "source" },
+				el("h3", { textContent: src.display_name || src.name }),
+				el("div", { className: "state", textContent: `${src.name} · ${src.state || "active"} · ${src.conns} connections` }),
+				canvas,
+				el("div", { className: "rates" },
+					el("span", { className: "down", textContent: "↓ " + formatBytes(last.down) + "/s" }),
+					el("span", { className: "up", textContent: "↑ " + formatBytes(last.up) + "/s" })),
+				el("div", { className: "controls" },
+					el("button", {
+						textContent: blocked ? "Unblock" : "Block",
+						onclick: () => blocked
+							? act("DELETE", "/policies/" + encodeURIComponent("block_" + src.name))
+							: act("POST", "/policies/block", { source_id: src.name, issuer: "dashboard" }),
+					}),
+					el("label", {},
+						el("input", {
+							type: "checkbox",
+							checked: src.metered,
+							onchange: (e) => act("PUT", "/sources/" + encodeURIComponent(src.name) + "/metered", { metered: e.target.checked }),
+						}),
+						" Metered"))));
+		drawChart(canvas, h);
+	}
+}
+
+function renderPolicies(policies) {
+	const body = document.getElementById("policies");
+	body.replaceChildren();
+	document.getElementById("sticky").checked = policies.some((p) => p.id === "stick");
+	for (const p of policies) {
+		body.append(el("tr", {},
+			el("td", { textContent: p.id }),
+			el("td", { textContent: p.issuer || "" }),
+			el("td", { textContent: p.description || "" }),
+			el("td", { textContent: hits[p.id] || 0 }),
+			el("td", {}, el("button", {
+				textContent: "Remove",
+				onclick: () => act("DELETE", "/policies/" + encodeURIComponent(p.id)),
+			}))));
+	}
+}
+
+function renderConns(conns) {
+	const body = document.getElementById("conns");
+	body.replaceChildren();
+	document.getElementById("conns-count").textContent = "(" + conns.length + ")";
+	const now = Date.now();
+	for (const c of conns.slice().reverse().slice(0, 100)) {
+		const age = Math.round((now - new Date(c.started)) / 1000);
+		body.append(el("tr", {},
+			el("td", { textContent: c.id }),
+			el("td", { textContent: c.source }),
+			el("td", { textContent: c.target }),
+			el("td", { textContent: c.protocol || "" }),
+			el("td", { textContent: age + "s" }),
+			el("td", {}, el("button", {
+				textContent: "Kill",
+				onclick: () => act("DELETE", "/conns/" + c.id),
+			}))));
+	}
+}
+
+async function poll() {
+	try {
+		const { policies } = await call("GET", "/policies");
+		renderPolicies(policies || []);
+	} catch (e) {
+		setStatus(e.message, true);
+	}
+	try {
+		renderConns((await call("GET", "/conns")) || []);
+	} catch (e) {
+		// The connections are not tracked by every booster.
+	}
+}
+
+// stream reads the event stream until it ends. EventSource cannot be
+// used, as it does not send the Authorization header.
+async function stream() {
+	const headers = token ? { Authorization: "Bearer " + token } : {};
+	const resp = await fetch(api + "/events/stream?topics=stats", { headers });
+	if (!resp.ok) {
+		throw new Error(resp.statusText + " (" + resp.status + ")");
+	}
+	setStatus("live");
+	const reader = resp.body.getReader();
+	const decoder = new TextDecoder();
+	let buf = "";
+	for (;;) {
+		const { value, done } = await reader.read();
+		if (done) {
+			return;
+		}
+		buf += decoder.decode(value, { stream: true });
+		let i;
+		while ((i = buf.indexOf("\n\n")) >= 0) {
+			const chunk = buf.slice(0, i);
+			buf = buf.slice(i + 2);
+			const data = chunk.split("\n").filter((l) => l.startsWith("data:")).map((l) => l.slice(5)).join("");
+			if (data) {
+				const e = JSON.parse(data);
+				const elapsed = prev ? (new Date(e.time) - new Date(prev.time)) / 1000 : 0;
+				hits = e.data.policy_hits || {};
+				renderSources(e.data, elapsed);
+				prev = Object.assign({ time: e.time }, e.data);
+			}
+		}
+	}
+}
+
+async function follow() {
+	for (;;) {
+		try {
+			await stream();
+		} catch (e) {
+			setStatus(e.message, true);
+		}
+		// The server closes the stream periodically.
+		await new Promise((r) => setTimeout(r, 1000));
+	}
+}
+
+document.getElementById("token").value = token;
+document.getElementById("login").onsubmit = (e) => {
+	e.preventDefault();
+	token = document.getElementById("token").value;
+	localStorage.setItem("booster-token", token);
+	poll();
+};
+document.getElementById("sticky").onchange = (e) => e.target.checked
+	? act("POST", "/policies/sticky", { issuer: "dashboard" })
+	: act("DELETE", "/policies/stick");
+
+poll();
+setInterval(poll, pollInterval);
+follow();
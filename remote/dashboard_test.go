@@ -0,0 +1,63 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package remote_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/booster-proj/booster/remote"
+)
+
+func TestDashboard(t *testing.T) {
+	router := remote.NewRouter()
+	router.Tokens = []remote.Token{{Name: "ops", Role: remote.RoleOperator, Secret: "o"}}
+	router.Dashboard = true
+	router.SetupRoutes()
+
+	tt := []struct {
+		path     string
+		code     int
+		contains string
+	}{
+		{"/", 302, ""},
+		{"/ui/", 200, "dashboard.js"},
+		{"/ui/dashboard.js", 200, "/events/stream"},
+		{"/ui/missing.js", 404, ""},
+	}
+	for i, v := range tt {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", v.path, nil))
+		if w.Code != v.code {
+			t.Fatalf("%d: %s: unexpected status code: wanted %d, found %d", i, v.path, v.code, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), v.contains) {
+			t.Fatalf("%d: %s: unexpected body: %s", i, v.path, w.Body)
+		}
+		if w.Code == 200 && w.Header().Get("Content-Security-Policy") == "" {
+			t.Fatalf("%d: %s: Content-Security-Policy header not set", i, v.path)
+		}
+	}
+
+	router = remote.NewRouter()
+	router.SetupRoutes()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/ui/", nil))
+	if w.Code != 404 {
+		t.Fatalf("The dashboard should not be served: %d", w.Code)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package remote
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	runtimepprof "runtime/pprof"
+)
+
+// DebugPrefix is the path prefix of the diagnostics endpoints, served
+// when the Debug field of the Router is set.
+const DebugPrefix = "/debug/"
+
+// setupDebug adds the diagnostics endpoints, available to the admin
+// tokens only: the pprof profiles at `/debug/pprof/`, the expvar
+// variables at `/debug/vars` and the stacks of the goroutines at
+// `/debug/goroutines`. The profiles cannot last longer than the write
+// timeout of the server, e.g. `/debug/pprof/profile?seconds=10`.
+func (r *Router) setupDebug() {
+	router := r.r
+	admin := func(h http.HandlerFunc) http.HandlerFunc {
+		return r.require(RoleAdmin, r.limited(h))
+	}
+	router.HandleFunc(DebugPrefix+"pprof/cmdline", admin(pprof.Cmdline))
+	router.HandleFunc(DebugPrefix+"pprof/profile", admin(pprof.Profile))
+	router.HandleFunc(DebugPrefix+"pprof/symbol", admin(pprof.Symbol))
+	router.HandleFunc(DebugPrefix+"pprof/trace", admin(pprof.Trace))
+	router.PathPrefix(DebugPrefix + "pprof/").Handler(admin(pprof.Index))
+	router.HandleFunc(DebugPrefix+"vars", admin(expvar.Handler().ServeHTTP)).Methods("GET")
+	router.HandleFunc(DebugPrefix+"goroutines", admin(goroutinesHandler)).Methods("GET")
+}
+
+// goroutinesHandler dumps the stacks of the goroutines, each on its own
+// or, if the `aggregate` query parameter is set, grouped by stack.
+func goroutinesHandler(w http.ResponseWriter, r *http.Request) {
+	debug := 2
+	if _, ok := r.URL.Query()["aggregate"]; ok {
+		debug = 1
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	runtimepprof.Lookup("goroutine").WriteTo(w, debug)
+}
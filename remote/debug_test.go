@@ -0,0 +1,64 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package remote_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/booster-proj/booster/remote"
+)
+
+func TestDebug(t *testing.T) {
+	tokens := []remote.Token{
+		{Name: "ops", Role: remote.RoleOperator, Secret: "o"},
+		{Name: "root", Role: remote.RoleAdmin, Secret: "a"},
+	}
+	get := func(router *remote.Router, path, secret string, code int) string {
+		req := httptest.NewRequest("GET", path, nil)
+		if secret != "" {
+			req.Header.Set("Authorization", "Bearer "+secret)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != code {
+			t.Fatalf("%s: unexpected status code: wanted %d, found %d", path, code, w.Code)
+		}
+		return w.Body.String()
+	}
+
+	// The endpoints are not served unless enabled.
+	router := remote.NewRouter()
+	router.Tokens = tokens
+	router.SetupRoutes()
+	get(router, "/debug/goroutines", "a", 404)
+
+	router = remote.NewRouter()
+	router.Tokens = tokens
+	router.Debug = true
+	router.SetupRoutes()
+	get(router, "/debug/goroutines", "", 401)
+	get(router, "/debug/goroutines", "o", 403)
+	if body := get(router, "/debug/goroutines", "a", 200); !strings.Contains(body, "goroutine ") {
+		t.Fatalf("Unexpected goroutines dump: %q", body)
+	}
+	if body := get(router, "/debug/vars", "a", 200); !strings.Contains(body, `"memstats"`) {
+		t.Fatalf("Unexpected vars: %q", body)
+	}
+	get(router, "/debug/pprof/", "a", 200)
+	get(router, "/debug/pprof/heap", "o", 403)
+}
@@ -17,10 +17,34 @@ package remote
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/booster-proj/booster/acl"
+	"github.com/booster-proj/booster/audit"
+	"github.com/booster-proj/booster/blocklist"
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/dialer"
+	"github.com/booster-proj/booster/dnscache"
+	"github.com/booster-proj/booster/events"
+	"github.com/booster-proj/booster/geoip"
+	"github.com/booster-proj/booster/history"
+	"github.com/booster-proj/booster/logging"
+	"github.com/booster-proj/booster/metrics"
+	"github.com/booster-proj/booster/probe"
+	"github.com/booster-proj/booster/protocol"
+	"github.com/booster-proj/booster/qos"
+	"github.com/booster-proj/booster/schedule"
+	"github.com/booster-proj/booster/sockopt"
+	"github.com/booster-proj/booster/speedtest"
 	"github.com/booster-proj/booster/store"
+	"github.com/booster-proj/booster/traceroute"
+	"github.com/booster-proj/booster/watchdog"
 	"github.com/gorilla/mux"
 )
 
@@ -39,15 +63,34 @@ func makeHealthCheckHandler(info BoosterInfo) http.HandlerFunc {
 	}
 }
 
-func makeSourcesHandler(s *store.SourceStore) http.HandlerFunc {
+// SourceDetails describes a source, together with its health as
+// measured by the prober, if any.
+type SourceDetails struct {
+	*store.DummySource
+	Health *probe.Stats `json:"health,omitempty"`
+}
+
+func makeSourcesHandler(s *store.SourceStore, prober *probe.Prober) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		snapshot := s.GetSourcesSnapshot()
+		acc := make([]SourceDetails, 0, len(snapshot))
+		for _, v := range snapshot {
+			d := SourceDetails{DummySource: v}
+			if prober != nil {
+				if stats, ok := prober.Stats(v.ID); ok {
+					d.Health = &stats
+				}
+			}
+			acc = append(acc, d)
+		}
+
 		w.WriteHeader(http.StatusOK)
 		w.Header().Set("Content-Type", "application/json")
 
 		json.NewEncoder(w).Encode(struct {
-			Sources []*store.DummySource `json:"sources"`
+			Sources []SourceDetails `json:"sources"`
 		}{
-			Sources: s.GetSourcesSnapshot(),
+			Sources: acc,
 		})
 	}
 }
@@ -65,6 +108,81 @@ func makePoliciesHandler(s *store.SourceStore) http.HandlerFunc {
 	}
 }
 
+func makeBindingsStatsHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		json.NewEncoder(w).Encode(s.BindHistoryStats())
+	}
+}
+
+func makeBindingsHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		acc := s.Bindings()
+		if src := r.URL.Query().Get("source"); src != "" {
+			filtered := make([]store.Binding, 0, len(acc))
+			for _, v := range acc {
+				if v.Source == src {
+					filtered = append(filtered, v)
+				}
+			}
+			acc = filtered
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		json.NewEncoder(w).Encode(struct {
+			Bindings []store.Binding `json:"bindings"`
+		}{
+			Bindings: acc,
+		})
+	}
+}
+
+func makeBindingPinHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		address := mux.Vars(r)["address"]
+		defer r.Body.Close()
+		var payload PoliciesInput
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		if payload.SourceID == "" {
+			writeError(w, fmt.Errorf("validation error: source_id cannot be empty"), http.StatusBadRequest)
+			return
+		}
+
+		b, err := s.PinBinding(r.Context(), address, payload.SourceID)
+		switch err {
+		case nil:
+		case store.ErrUnknownSource:
+			writeError(w, err, http.StatusNotFound)
+			return
+		default:
+			writeError(w, err, http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(b)
+	}
+}
+
+func makeBindingDelHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.DelBinding(mux.Vars(r)["address"]); err != nil {
+			writeError(w, err, http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
 func makePoliciesDelHandler(s *store.SourceStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := mux.Vars(r)["id"]
@@ -85,6 +203,10 @@ type PoliciesInput struct {
 	Target   string `json:"target"`
 	Reason   string `json:"reason"`
 	Issuer   string `json:"issuer"`
+	// Ports restricts the reserve, avoid and metered policies to
+	// the connections to these ports, or port ranges, e.g. 443 or
+	// "6881-6889".
+	Ports store.Ports `json:"ports"`
 }
 
 func makePoliciesBlockHandler(s *store.SourceStore) http.HandlerFunc {
@@ -106,16 +228,39 @@ func makePoliciesBlockHandler(s *store.SourceStore) http.HandlerFunc {
 	}
 }
 
+// StickyPolicyInput describes the sticky policy. If Domains or
+// DomainSets are not empty, the policy applies only to the connections
+// to those domains, and to their subdomains.
+type StickyPolicyInput struct {
+	PoliciesInput
+	Domains    []string `json:"domains"`
+	DomainSets []string `json:"domain_sets"`
+}
+
+func newStickyPolicy(s *store.SourceStore, in StickyPolicyInput) (*store.StickyPolicy, error) {
+	domains, err := s.ExpandDomainSets(in.DomainSets...)
+	if err != nil {
+		return nil, fmt.Errorf("validation error: %v", err)
+	}
+	p := store.NewStickyPolicy(in.Issuer, s.QueryBindHistory)
+	p.ScopeTo(append(in.Domains, domains...), in.DomainSets...)
+	return p, nil
+}
+
 func makePoliciesStickyHandler(s *store.SourceStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
-		var payload PoliciesInput
+		var payload StickyPolicyInput
 		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 			writeError(w, err, http.StatusBadRequest)
 			return
 		}
 
-		p := store.NewStickyPolicy(payload.Issuer, s.QueryBindHistory)
+		p, err := newStickyPolicy(s, payload)
+		if err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
 		handlePolicy(s, p, w, r)
 	}
 }
@@ -137,12 +282,13 @@ func makePoliciesReserveHandler(s *store.SourceStore) http.HandlerFunc {
 			writeError(w, fmt.Errorf("validation error: source_id cannot be empty"), http.StatusBadRequest)
 			return
 		}
-		if len(payload.Hosts) == 0 {
-			writeError(w, fmt.Errorf("validation error: hosts cannot be empty list"), http.StatusBadRequest)
+		if len(payload.Hosts) == 0 && len(payload.Ports) == 0 {
+			writeError(w, fmt.Errorf("validation error: hosts and ports cannot be both empty lists"), http.StatusBadRequest)
 			return
 		}
 
 		p := store.NewReservedPolicy(payload.Issuer, payload.SourceID, payload.Hosts...)
+		p.OnPorts(payload.Ports)
 		p.Reason = payload.Reason
 		handlePolicy(s, p, w, r)
 	}
@@ -166,28 +312,1198 @@ func makePoliciesAvoidHandler(s *store.SourceStore) http.HandlerFunc {
 		}
 
 		p := store.NewAvoidPolicy(payload.Issuer, payload.SourceID, payload.Target)
+		p.OnPorts(payload.Ports)
 		p.Reason = payload.Reason
 		handlePolicy(s, p, w, r)
 	}
 }
 
-func handlePolicy(s *store.SourceStore, p store.Policy, w http.ResponseWriter, r *http.Request) {
-	if err := s.AppendPolicy(p); err != nil {
-		writeError(w, err, http.StatusBadRequest)
-		return
+// MeteredPolicyInput describes the fields accepted by the
+// `/policies/metered.json` endpoint.
+type MeteredPolicyInput struct {
+	PoliciesInput
+	Hosts   []string `json:"hosts"`
+	Metered bool     `json:"metered"`
+}
+
+func makePoliciesMeteredHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var payload MeteredPolicyInput
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		p := store.NewMeteredPolicy(payload.Issuer, payload.Metered, s.IsMetered, payload.Hosts...)
+		p.OnPorts(payload.Ports)
+		p.Reason = payload.Reason
+		handlePolicy(s, p, w, r)
 	}
+}
 
-	w.WriteHeader(http.StatusCreated)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(p)
+// DSCPPolicyInput describes the fields accepted by the
+// `/policies/dscp.json` endpoint.
+type DSCPPolicyInput struct {
+	PoliciesInput
+	Name  string   `json:"name"`
+	Hosts []string `json:"hosts"`
+	// DSCP is either a name, e.g. "EF", or a number from 0 to 63.
+	DSCP string `json:"dscp"`
 }
 
-func writeError(w http.ResponseWriter, err error, code int) {
-	w.WriteHeader(code)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(struct {
-		Error string `json:"error"`
-	}{
-		Error: err.Error(),
-	})
+func makePoliciesDSCPHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var payload DSCPPolicyInput
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		if payload.Name == "" {
+			writeError(w, fmt.Errorf("validation error: name cannot be empty"), http.StatusBadRequest)
+			return
+		}
+		dscp, err := qos.ParseDSCP(payload.DSCP)
+		if err != nil {
+			writeError(w, fmt.Errorf("validation error: dscp: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		p := store.NewDSCPPolicy(payload.Issuer, payload.Name, dscp, payload.Ports, payload.Hosts...)
+		p.Reason = payload.Reason
+		handlePolicy(s, p, w, r)
+	}
+}
+
+// FWMarkPolicyInput describes the fields accepted by the
+// `/policies/fwmark.json` endpoint.
+type FWMarkPolicyInput struct {
+	PoliciesInput
+	Name  string   `json:"name"`
+	Hosts []string `json:"hosts"`
+	// FWMark is either decimal, e.g. "16", or hexadecimal, e.g.
+	// "0x10".
+	FWMark string `json:"fwmark"`
+}
+
+func makePoliciesFWMarkHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var payload FWMarkPolicyInput
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		if payload.Name == "" {
+			writeError(w, fmt.Errorf("validation error: name cannot be empty"), http.StatusBadRequest)
+			return
+		}
+		mark, err := sockopt.ParseMark(payload.FWMark)
+		if err != nil {
+			writeError(w, fmt.Errorf("validation error: fwmark: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		p := store.NewFWMarkPolicy(payload.Issuer, payload.Name, mark, payload.Ports, payload.Hosts...)
+		p.Reason = payload.Reason
+		handlePolicy(s, p, w, r)
+	}
+}
+
+// ProcessPolicyInput describes the fields accepted by the
+// `/policies/process.json` endpoint.
+type ProcessPolicyInput struct {
+	PoliciesInput
+	Process string `json:"process"`
+}
+
+func makePoliciesProcessHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var payload ProcessPolicyInput
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		if payload.SourceID == "" {
+			writeError(w, fmt.Errorf("validation error: source_id cannot be empty"), http.StatusBadRequest)
+			return
+		}
+		if payload.Process == "" {
+			writeError(w, fmt.Errorf("validation error: process cannot be empty"), http.StatusBadRequest)
+			return
+		}
+
+		p := store.NewProcessPolicy(payload.Issuer, payload.Process, payload.SourceID)
+		p.Reason = payload.Reason
+		handlePolicy(s, p, w, r)
+	}
+}
+
+// ProtocolPolicyInput describes the fields accepted by the
+// `/policies/protocol.json` endpoint.
+type ProtocolPolicyInput struct {
+	PoliciesInput
+	Protocol string `json:"protocol"`
+}
+
+func makePoliciesProtocolHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var payload ProtocolPolicyInput
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		if payload.SourceID == "" {
+			writeError(w, fmt.Errorf("validation error: source_id cannot be empty"), http.StatusBadRequest)
+			return
+		}
+		proto, err := protocol.Parse(payload.Protocol)
+		if err != nil {
+			writeError(w, fmt.Errorf("validation error: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		p := store.NewProtocolPolicy(payload.Issuer, proto, payload.SourceID)
+		p.Reason = payload.Reason
+		handlePolicy(s, p, w, r)
+	}
+}
+
+// ExprPolicyInput describes the fields accepted by the
+// `/policies/expr.json` endpoint.
+type ExprPolicyInput struct {
+	PoliciesInput
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+}
+
+func makePoliciesExprHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var payload ExprPolicyInput
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		if payload.Name == "" {
+			writeError(w, fmt.Errorf("validation error: name cannot be empty"), http.StatusBadRequest)
+			return
+		}
+
+		p, err := store.NewExprPolicy(payload.Issuer, payload.Name, payload.Expression, s.IsMetered)
+		if err != nil {
+			writeError(w, fmt.Errorf("validation error: %v", err), http.StatusBadRequest)
+			return
+		}
+		p.Reason = payload.Reason
+		handlePolicy(s, p, w, r)
+	}
+}
+
+// WebhookPolicyInput describes the fields accepted by the
+// `/policies/webhook.json` endpoint.
+type WebhookPolicyInput struct {
+	PoliciesInput
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	FailOpen bool   `json:"fail_open"`
+	// CacheTTL is a duration, e.g. "30s". If empty,
+	// store.DefaultWebhookTTL is used.
+	CacheTTL string `json:"cache_ttl"`
+}
+
+func makePoliciesWebhookHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var payload WebhookPolicyInput
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		if payload.Name == "" {
+			writeError(w, fmt.Errorf("validation error: name cannot be empty"), http.StatusBadRequest)
+			return
+		}
+		if u, err := url.Parse(payload.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			writeError(w, fmt.Errorf("validation error: url must be an http or https URL"), http.StatusBadRequest)
+			return
+		}
+		ttl := store.DefaultWebhookTTL
+		if payload.CacheTTL != "" {
+			var err error
+			if ttl, err = time.ParseDuration(payload.CacheTTL); err != nil {
+				writeError(w, fmt.Errorf("validation error: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		p := store.NewWebhookPolicy(payload.Issuer, payload.Name, payload.URL, payload.FailOpen, ttl)
+		p.Reason = payload.Reason
+		handlePolicy(s, p, w, r)
+	}
+}
+
+// GeoPolicyInput describes the fields accepted by the
+// `/policies/geo.json` endpoint.
+type GeoPolicyInput struct {
+	PoliciesInput
+	Countries  []string `json:"countries"`
+	Continents []string `json:"continents"`
+	ASNs       []uint   `json:"asns"`
+}
+
+func makePoliciesGeoHandler(s *store.SourceStore, db *geoip.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var payload GeoPolicyInput
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		if payload.SourceID == "" {
+			writeError(w, fmt.Errorf("validation error: source_id cannot be empty"), http.StatusBadRequest)
+			return
+		}
+		if len(payload.Countries)+len(payload.Continents)+len(payload.ASNs) == 0 {
+			writeError(w, fmt.Errorf("validation error: at least one of countries, continents or asns is required"), http.StatusBadRequest)
+			return
+		}
+
+		p := store.NewGeoPolicy(payload.Issuer, payload.SourceID, db.Locate, payload.Countries, payload.Continents, payload.ASNs)
+		p.Reason = payload.Reason
+		handlePolicy(s, p, w, r)
+	}
+}
+
+func makeDecisionsHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		json.NewEncoder(w).Encode(struct {
+			Decisions []store.Decision `json:"decisions"`
+		}{
+			Decisions: s.Decisions(),
+		})
+	}
+}
+
+// SimulationInput describes the fields accepted by the
+// `/policies/simulate.json` endpoint. The policies evaluated are the
+// ones stored, without the ones in Remove, followed by the ones in
+// Add. If Replace is true, the ones stored are ignored.
+type SimulationInput struct {
+	Add     []PolicyInput `json:"add"`
+	Remove  []string      `json:"remove"`
+	Replace bool          `json:"replace"`
+}
+
+func makePoliciesSimulateHandler(s *store.SourceStore, db *geoip.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var payload SimulationInput
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		var policies []store.Policy
+		if !payload.Replace {
+			removed := make(map[string]bool, len(payload.Remove))
+			for _, v := range payload.Remove {
+				removed[v] = true
+			}
+			for _, p := range s.GetPoliciesSnapshot() {
+				if !removed[p.ID()] {
+					policies = append(policies, p)
+				}
+			}
+		}
+		for _, v := range payload.Add {
+			p, err := newPolicy(s, db, v)
+			if err != nil {
+				writeError(w, err, http.StatusBadRequest)
+				return
+			}
+			policies = append(policies, p)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(s.Simulate(policies))
+	}
+}
+
+func makeGeoIPHandler(db *geoip.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.URL.Query().Get("host")
+		if host == "" {
+			writeError(w, fmt.Errorf("validation error: host cannot be empty"), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(struct {
+			Host      string           `json:"host"`
+			Locations []geoip.Location `json:"locations"`
+		}{
+			Host:      host,
+			Locations: db.Locate(host),
+		})
+	}
+}
+
+func makeSourceMeteredHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		if r.Method == "DELETE" {
+			s.ResetMetered(id)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		defer r.Body.Close()
+		var payload struct {
+			Metered bool `json:"metered"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		s.SetMetered(id, payload.Metered)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(store.DummySource{
+			ID:      id,
+			Metered: payload.Metered,
+			Tier:    s.SourceTier(id),
+		})
+	}
+}
+
+func makeConnsHandler(d *dialer.Dialer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(d.Conns())
+	}
+}
+
+func makeConnKillHandler(d *dialer.Dialer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		if !d.Kill(id) {
+			writeError(w, fmt.Errorf("connection %d not found", id), http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func makeConnsReapHandler(d *dialer.Dialer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var idle time.Duration
+		if v := r.URL.Query().Get("idle"); v != "" {
+			var err error
+			if idle, err = time.ParseDuration(v); err != nil || idle <= 0 {
+				writeError(w, fmt.Errorf("invalid idle duration %q", v), http.StatusBadRequest)
+				return
+			}
+		}
+		n := d.Reap(idle)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(struct {
+			Closed int `json:"closed"`
+		}{
+			Closed: n,
+		})
+	}
+}
+
+func makeSourceDrainHandler(d *dialer.Dialer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n := d.Drain(mux.Vars(r)["id"])
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(struct {
+			Closed int `json:"closed"`
+		}{
+			Closed: n,
+		})
+	}
+}
+
+func makeSourceTierHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		defer r.Body.Close()
+		var payload struct {
+			Tier store.Tier `json:"tier"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		s.SetTier(id, payload.Tier)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(store.DummySource{
+			ID:      id,
+			Metered: s.IsMetered(id),
+			Tier:    payload.Tier,
+		})
+	}
+}
+
+func makeSourceLabelsHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		var l store.SourceLabels
+		if r.Method == http.MethodPut {
+			defer r.Body.Close()
+			if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+				writeError(w, err, http.StatusBadRequest)
+				return
+			}
+		}
+		if err := s.SetLabels(id, l); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(store.DummySource{
+			ID:          id,
+			DisplayName: l.Name,
+			Labels:      l.Labels,
+			Metered:     s.IsMetered(id),
+			Tier:        s.SourceTier(id),
+		})
+	}
+}
+
+func makeSourceDisabledHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		if err := s.SetDisabled(id, r.Method == http.MethodPut); err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(struct {
+			ID       string `json:"name"`
+			Disabled bool   `json:"disabled"`
+		}{
+			ID:       id,
+			Disabled: s.IsDisabled(id),
+		})
+	}
+}
+
+func makeSourceTCPHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		var o sockopt.Options
+		if r.Method == http.MethodPut {
+			defer r.Body.Close()
+			if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+				writeError(w, err, http.StatusBadRequest)
+				return
+			}
+		}
+		if err := s.SetTCPOptions(id, o); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		o, _ = s.TCPOptions(id)
+		json.NewEncoder(w).Encode(struct {
+			ID  string          `json:"name"`
+			TCP sockopt.Options `json:"tcp"`
+		}{
+			ID:  id,
+			TCP: o,
+		})
+	}
+}
+
+func makeGroupsHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		json.NewEncoder(w).Encode(struct {
+			Groups []core.SourceGroup `json:"groups"`
+		}{
+			Groups: s.GetGroupsSnapshot(),
+		})
+	}
+}
+
+// GroupInput describes the fields required by a `PUT` request to
+// `/groups/{name}.json`.
+type GroupInput struct {
+	Patterns []string `json:"patterns"`
+	Weight   int      `json:"weight"`
+}
+
+func makeGroupPutHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var payload GroupInput
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		g := core.SourceGroup{
+			Name:     mux.Vars(r)["name"],
+			Patterns: payload.Patterns,
+			Weight:   payload.Weight,
+		}
+		if err := s.PutGroup(g); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(g)
+	}
+}
+
+func makeGroupDelHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.DelGroup(mux.Vars(r)["name"]); err != nil {
+			writeError(w, err, http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func handlePolicy(s *store.SourceStore, p store.Policy, w http.ResponseWriter, r *http.Request) {
+	conflicts := s.FindConflicts(p)
+	if err := s.AppendPolicy(p); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if len(conflicts) == 0 {
+		json.NewEncoder(w).Encode(p)
+		return
+	}
+
+	// Add the conflicts found to the policy fields.
+	var acc map[string]interface{}
+	b, _ := json.Marshal(p)
+	json.Unmarshal(b, &acc)
+	acc["warnings"] = conflicts
+	json.NewEncoder(w).Encode(acc)
+}
+
+func makeEventsHandler(b *events.Bus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		json.NewEncoder(w).Encode(struct {
+			Events []events.Event `json:"events"`
+		}{
+			Events: b.Recent(),
+		})
+	}
+}
+
+func makeProbesHandler(p *probe.Prober) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		json.NewEncoder(w).Encode(struct {
+			Anchor string                 `json:"anchor"`
+			Probes map[string]probe.Stats `json:"probes"`
+		}{
+			Anchor: p.Anchor,
+			Probes: p.Snapshot(),
+		})
+	}
+}
+
+func makeSpeedtestHandler(t *speedtest.Tester) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		json.NewEncoder(w).Encode(struct {
+			Results map[string][]speedtest.Result `json:"results"`
+		}{
+			Results: t.Snapshot(),
+		})
+	}
+}
+
+func makeSpeedtestRunHandler(t *speedtest.Tester) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		res, err := t.TestID(r.Context(), id)
+		switch err {
+		case nil:
+		case speedtest.ErrUnknownSource:
+			writeError(w, err, http.StatusNotFound)
+			return
+		case speedtest.ErrRunning:
+			writeError(w, err, http.StatusConflict)
+			return
+		default:
+			writeError(w, err, http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+// makeTracerouteHandler traces the route to the `host` query
+// parameter through the source of the path.
+func makeTracerouteHandler(t *traceroute.Tracer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.URL.Query().Get("host")
+		if host == "" {
+			writeError(w, fmt.Errorf("validation error: host cannot be empty"), http.StatusBadRequest)
+			return
+		}
+		res, err := t.TraceID(r.Context(), mux.Vars(r)["id"], host)
+		switch err {
+		case nil:
+		case traceroute.ErrUnknownSource:
+			writeError(w, err, http.StatusNotFound)
+			return
+		case traceroute.ErrUnsupported:
+			writeError(w, err, http.StatusBadRequest)
+			return
+		default:
+			writeError(w, err, http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+// makeHistoryHandler serves the samples stored in `db`. The query
+// parameters `from` and `to` (RFC 3339) define the time range, which
+// defaults to the last hour; `source` filters the samples by source.
+func makeHistoryHandler(db *history.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		from, to, err := parseRange(q, time.Hour)
+		if err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		samples, err := db.Query(q.Get("source"), from, to)
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(struct {
+			From    time.Time        `json:"from"`
+			To      time.Time        `json:"to"`
+			Samples []history.Sample `json:"samples"`
+		}{
+			From:    from,
+			To:      to,
+			Samples: samples,
+		})
+	}
+}
+
+// makeReportHandler serves the report of the data transmitted by
+// source and by domain during the period described by the query, see
+// parsePeriod.
+func makeReportHandler(db *history.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := parsePeriod(r.URL.Query())
+		if err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		report, err := db.Report(from, to)
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// makeDomainsHandler serves the domains to which the most data was
+// transmitted during a period, see makeReportHandler. The query
+// parameter `source` filters the data by source, and `limit` is the
+// maximum number of domains returned, 10 by default.
+func makeDomainsHandler(db *history.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		from, to, err := parsePeriod(q)
+		if err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		limit := 10
+		if v := q.Get("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil {
+				writeError(w, fmt.Errorf("validation error: limit: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		domains, err := db.TopDomains(q.Get("source"), from, to, limit)
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(struct {
+			From    time.Time       `json:"from"`
+			To      time.Time       `json:"to"`
+			Source  string          `json:"source,omitempty"`
+			Domains []history.Usage `json:"domains"`
+		}{
+			From:    from,
+			To:      to,
+			Source:  q.Get("source"),
+			Domains: domains,
+		})
+	}
+}
+
+// makeAvailabilityHandler serves the availability of the sources
+// recorded by `j` over the windows listed in the query, as durations
+// separated by commas, or history.DefaultWindows.
+func makeAvailabilityHandler(j *history.Journal) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		windows := history.DefaultWindows
+		if v := q.Get("windows"); v != "" {
+			windows = nil
+			for _, s := range strings.Split(v, ",") {
+				d, err := time.ParseDuration(strings.TrimSpace(s))
+				if err != nil || d <= 0 {
+					writeError(w, fmt.Errorf("validation error: windows: invalid window %q", s), http.StatusBadRequest)
+					return
+				}
+				windows = append(windows, d)
+			}
+		}
+		sources := j.Sources()
+		if v := q.Get("source"); v != "" {
+			sources = []string{v}
+		}
+
+		type sourceAvailability struct {
+			Source       string                 `json:"source"`
+			Availability []history.Availability `json:"availability"`
+		}
+		now := time.Now()
+		acc := make([]sourceAvailability, 0, len(sources))
+		for _, id := range sources {
+			v := sourceAvailability{Source: id}
+			for _, d := range windows {
+				v.Availability = append(v.Availability, j.Availability(id, d, now))
+			}
+			acc = append(acc, v)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(struct {
+			Time    time.Time            `json:"time"`
+			Sources []sourceAvailability `json:"sources"`
+		}{
+			Time:    now,
+			Sources: acc,
+		})
+	}
+}
+
+// makeOutagesHandler serves the outages of the sources recorded by `j`
+// in the time range described by the query, which defaults to the last
+// day.
+func makeOutagesHandler(j *history.Journal) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		from, to, err := parseRange(q, time.Hour*24)
+		if err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(struct {
+			From    time.Time        `json:"from"`
+			To      time.Time        `json:"to"`
+			Outages []history.Outage `json:"outages"`
+		}{
+			From:    from,
+			To:      to,
+			Outages: j.Outages(q.Get("source"), from, to),
+		})
+	}
+}
+
+// parseRange returns the time range described by the query parameters
+// `from` and `to` (RFC 3339), which default to `d` before `to` and to
+// the current time.
+func parseRange(q url.Values, d time.Duration) (time.Time, time.Time, error) {
+	to := time.Now()
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("validation error: to: %v", err)
+		}
+		to = t
+	}
+	from := to.Add(-d)
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("validation error: from: %v", err)
+		}
+		from = t
+	}
+	return from, to, nil
+}
+
+// parsePeriod returns the time range of the period described by the
+// query parameters `period`, either daily (the default) or weekly,
+// and `date` (2006-01-02), any day of the period, which defaults to
+// the current one.
+func parsePeriod(q url.Values) (time.Time, time.Time, error) {
+	period := q.Get("period")
+	if period == "" {
+		period = history.Daily
+	}
+	date := time.Now()
+	if v := q.Get("date"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("validation error: date: %v", err)
+		}
+		date = t
+	}
+	from, err := history.PeriodStart(period, date)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("validation error: period: %v", err)
+	}
+	return from, history.PeriodEnd(period, from), nil
+}
+
+func writeLogLevels(w http.ResponseWriter, l *logging.Logger) {
+	def, modules := l.Levels()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(struct {
+		Default string            `json:"default"`
+		Modules map[string]string `json:"modules"`
+	}{
+		Default: def,
+		Modules: modules,
+	})
+}
+
+func makeLogLevelsHandler(l *logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeLogLevels(w, l)
+	}
+}
+
+// LogLevelInput describes the fields accepted by the `PUT /log/levels.json`
+// endpoint. If Module is empty, the default level is set. If Level is
+// empty, the module level is reset to the default.
+type LogLevelInput struct {
+	Module string `json:"module"`
+	Level  string `json:"level"`
+}
+
+func makeLogLevelsSetHandler(l *logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var payload LogLevelInput
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		if payload.Level == "" {
+			if payload.Module == "" {
+				writeError(w, fmt.Errorf("validation error: level cannot be empty"), http.StatusBadRequest)
+				return
+			}
+			l.ResetLevel(payload.Module)
+			writeLogLevels(w, l)
+			return
+		}
+		level, err := logging.ParseLevel(payload.Level)
+		if err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		l.SetLevel(payload.Module, level)
+		writeLogLevels(w, l)
+	}
+}
+
+func makeACLHandler(l *acl.List) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(l.Rules())
+	}
+}
+
+func makeACLSetHandler(l *acl.List) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var payload acl.Rules
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		if err := l.Set(payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(l.Rules())
+	}
+}
+
+func makeSchedulesHandler(s *schedule.Schedules) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(s.Rules())
+	}
+}
+
+func makeSchedulePutHandler(s *schedule.Schedules) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var payload schedule.Rule
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		payload.ID = mux.Vars(r)["id"]
+		if err := s.Put(payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(payload)
+	}
+}
+
+func makeScheduleDelHandler(s *schedule.Schedules) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.Del(mux.Vars(r)["id"]); err != nil {
+			writeError(w, err, http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func makeBlocklistsHandler(f *blocklist.Filter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(f.Lists())
+	}
+}
+
+// makeBlocklistEnabledHandler enables the list on PUT and disables it
+// on DELETE.
+func makeBlocklistEnabledHandler(f *blocklist.Filter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := f.SetEnabled(mux.Vars(r)["name"], r.Method == "PUT"); err != nil {
+			writeError(w, err, http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(f.Lists())
+	}
+}
+
+func makeBlocklistRefreshHandler(f *blocklist.Filter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := f.RefreshList(r.Context(), mux.Vars(r)["name"])
+		switch {
+		case errors.Is(err, blocklist.ErrNotFound):
+			writeError(w, err, http.StatusNotFound)
+			return
+		case err != nil:
+			writeError(w, err, http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(f.Lists())
+	}
+}
+
+// makeAuditHandler serves the audit log entries. The query parameters
+// `actor` and `action` filter the entries, `from` and `to` (RFC 3339)
+// restrict the time range.
+func makeAuditHandler(l *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		f := audit.Filter{
+			Actor:  q.Get("actor"),
+			Action: q.Get("action"),
+		}
+		for k, t := range map[string]*time.Time{"from": &f.From, "to": &f.To} {
+			v := q.Get(k)
+			if v == "" {
+				continue
+			}
+			var err error
+			if *t, err = time.Parse(time.RFC3339, v); err != nil {
+				writeError(w, fmt.Errorf("validation error: %s: %v", k, err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		entries, err := l.Query(f)
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(struct {
+			Entries []audit.Entry `json:"entries"`
+		}{
+			Entries: entries,
+		})
+	}
+}
+
+func writeError(w http.ResponseWriter, err error, code int) {
+	w.WriteHeader(code)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{
+		Error: err.Error(),
+	})
+}
+
+func makeAlertRulesHandler(ss *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var opts metrics.AlertOptions
+		if v := q.Get("quota"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n <= 0 {
+				writeError(w, fmt.Errorf("validation error: quota: invalid number of bytes %q", v), http.StatusBadRequest)
+				return
+			}
+			opts.Quota = n
+		}
+		if v := q.Get("period"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				writeError(w, fmt.Errorf("validation error: period: invalid duration %q", v), http.StatusBadRequest)
+				return
+			}
+			opts.QuotaPeriod = d
+		}
+
+		snapshot := ss.GetSourcesSnapshot()
+		sources := make([]metrics.AlertSource, 0, len(snapshot))
+		for _, v := range snapshot {
+			sources = append(sources, metrics.AlertSource{ID: v.ID, Name: v.DisplayName, Metered: v.Metered})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(metrics.AlertRules(sources, opts))
+	}
+}
+
+func makeWatchdogHandler(wd *watchdog.Watchdog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(wd.Stats())
+	}
+}
+
+func makeDNSCacheHandler(c *dnscache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(c.Stats())
+	}
+}
+
+func makeDNSCacheFlushHandler(c *dnscache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n := c.Flush()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(struct {
+			Flushed int `json:"flushed"`
+		}{
+			Flushed: n,
+		})
+	}
 }
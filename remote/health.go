@@ -0,0 +1,187 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/booster-proj/booster/probe"
+	"github.com/booster-proj/booster/store"
+)
+
+// CheckTimeout is the time each health check has to complete.
+var CheckTimeout = 2 * time.Second
+
+// Check reports whether a dependency of booster, e.g. one of its
+// listeners, is ready, returning an error if it is not.
+type Check func(ctx context.Context) error
+
+// Statuses of the health checks.
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// CheckResult is the outcome of a health check.
+type CheckResult struct {
+	Status     string      `json:"status"`
+	Error      string      `json:"error,omitempty"`
+	DurationMs float64     `json:"duration_ms"`
+	Detail     interface{} `json:"detail,omitempty"`
+}
+
+// HealthReport is the body of the `/healthz` and `/readyz` responses:
+// Status is StatusOK only if every check succeeded.
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// SourcesHealth is the detail of the sources check.
+type SourcesHealth struct {
+	Healthy int `json:"healthy"`
+	Total   int `json:"total"`
+}
+
+// detailed is a check that also returns its detail.
+type detailed func(ctx context.Context) (interface{}, error)
+
+// storeCheck reports whether the store answers within the timeout of
+// the check, i.e. it is not stuck.
+func storeCheck(ss *store.SourceStore) detailed {
+	return func(ctx context.Context) (interface{}, error) {
+		done := make(chan struct{})
+		go func() {
+			ss.GetSourcesSnapshot()
+			close(done)
+		}()
+		select {
+		case <-done:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, errors.New("store is not responding")
+		}
+	}
+}
+
+// sourcesCheck counts the healthy sources, i.e. the ones that are
+// neither disabled nor blocked and, if `prober` is not nil, are not
+// failing their probes, and fails if there are none.
+func sourcesCheck(ss *store.SourceStore, prober *probe.Prober) detailed {
+	return func(ctx context.Context) (interface{}, error) {
+		snapshot := ss.GetSourcesSnapshot()
+		h := SourcesHealth{Total: len(snapshot)}
+		for _, v := range snapshot {
+			switch v.State {
+			case store.StateDisabled, store.StateBlocked, store.StateDraining:
+				continue
+			}
+			if prober != nil {
+				if _, failing := prober.FailingSince(v.ID); failing {
+					continue
+				}
+			}
+			h.Healthy++
+		}
+		if h.Healthy == 0 {
+			return h, fmt.Errorf("no healthy source out of %d", h.Total)
+		}
+		return h, nil
+	}
+}
+
+// runChecks runs `checks` concurrently, each with CheckTimeout.
+func runChecks(ctx context.Context, checks map[string]detailed) HealthReport {
+	report := HealthReport{Status: StatusOK, Checks: make(map[string]CheckResult, len(checks))}
+	var mux sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check detailed) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			detail, err := check(ctx)
+			res := CheckResult{
+				Status:     StatusOK,
+				DurationMs: float64(time.Since(start)) / float64(time.Millisecond),
+				Detail:     detail,
+			}
+			if err != nil {
+				res.Status, res.Error = StatusFail, err.Error()
+			}
+
+			mux.Lock()
+			defer mux.Unlock()
+			report.Checks[name] = res
+			if err != nil {
+				report.Status = StatusFail
+			}
+		}(name, check)
+	}
+	wg.Wait()
+	return report
+}
+
+// makeHealthzHandler reports whether booster is alive: it fails only
+// when the store is stuck, in which case it should be restarted.
+func (r *Router) makeHealthzHandler() http.HandlerFunc {
+	checks := make(map[string]detailed)
+	if ss := r.Store; ss != nil {
+		checks["store"] = storeCheck(ss)
+	}
+	return makeChecksHandler(checks)
+}
+
+// makeReadyzHandler reports whether booster is ready to receive
+// traffic: the store is responsive, at least a source is healthy and
+// the Checks of the router, e.g. the ones of the listeners, succeed.
+func (r *Router) makeReadyzHandler() http.HandlerFunc {
+	checks := make(map[string]detailed)
+	if ss := r.Store; ss != nil {
+		checks["store"] = storeCheck(ss)
+		checks["sources"] = sourcesCheck(ss, r.Probes)
+	}
+	for name, check := range r.Checks {
+		check := check
+		checks[name] = func(ctx context.Context) (interface{}, error) {
+			return nil, check(ctx)
+		}
+	}
+	return makeChecksHandler(checks)
+}
+
+func makeChecksHandler(checks map[string]detailed) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := runChecks(r.Context(), checks)
+		code := http.StatusOK
+		if report.Status != StatusOK {
+			code = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(report)
+	}
+}
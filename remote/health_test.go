@@ -0,0 +1,79 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package remote_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/remote"
+	"github.com/booster-proj/booster/source"
+	"github.com/booster-proj/booster/store"
+)
+
+func TestHealthChecks(t *testing.T) {
+	ss := store.New(new(core.Balancer))
+	var proxyErr error
+	router := remote.NewRouter()
+	router.Store = ss
+	router.Tokens = []remote.Token{{Name: "ops", Role: remote.RoleOperator, Secret: "o"}}
+	router.Checks = map[string]remote.Check{
+		"proxy": func(ctx context.Context) error { return proxyErr },
+	}
+	router.SetupRoutes()
+
+	get := func(path string, code int) remote.HealthReport {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != code {
+			t.Fatalf("%s: unexpected status code: wanted %d, found %d: %s", path, code, w.Code, w.Body)
+		}
+		var report remote.HealthReport
+		if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+
+	// Booster is alive, but not ready without sources.
+	if r := get("/healthz", 200); r.Status != remote.StatusOK || r.Checks["store"].Status != remote.StatusOK {
+		t.Fatalf("Unexpected report: %+v", r)
+	}
+	if r := get("/readyz", 503); r.Checks["sources"].Status != remote.StatusFail || r.Checks["proxy"].Status != remote.StatusOK {
+		t.Fatalf("Unexpected report: %+v", r)
+	}
+
+	ss.Put(source.NewStatic(source.StaticConfig{Name: "en0"}), source.NewStatic(source.StaticConfig{Name: "en1"}))
+	if err := ss.SetDisabled("en1", true); err != nil {
+		t.Fatal(err)
+	}
+	r := get("/readyz", 200)
+	if r.Status != remote.StatusOK {
+		t.Fatalf("Unexpected report: %+v", r)
+	}
+	if d, _ := r.Checks["sources"].Detail.(map[string]interface{}); d["healthy"] != 1.0 || d["total"] != 2.0 {
+		t.Fatalf("Unexpected sources detail: %+v", r.Checks["sources"])
+	}
+
+	proxyErr = errors.New("not listening")
+	if r := get("/readyz", 503); r.Checks["proxy"].Error != "not listening" {
+		t.Fatalf("Unexpected report: %+v", r)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package remote
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Default limits of the requests to the API.
+const (
+	DefaultRateLimit   = 20
+	DefaultRateBurst   = 40
+	DefaultMaxBodySize = 1 << 20
+)
+
+// maxBuckets is the number of clients tracked by a limiter after
+// which the ones that have not performed requests lately are
+// forgotten.
+const maxBuckets = 1024
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limiter is a token bucket for each client of the API.
+type limiter struct {
+	rate  float64 // tokens per second
+	burst float64
+
+	mux     sync.Mutex
+	buckets map[string]*bucket
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// allow reports whether `key` can perform a request at `now`. If it
+// cannot, it also returns how long it has to wait.
+func (l *limiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxBuckets {
+			l.prune(now)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// prune removes the buckets that would be full at `now`. Must be
+// called with the lock held.
+func (l *limiter) prune(now time.Time) {
+	for k, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// limited returns `h` wrapped by a handler enforcing RateLimit, for
+// each actor, and MaxBodySize. It must be called after the
+// authentication middleware, which identifies the actor.
+func (r *Router) limited(h http.HandlerFunc) http.HandlerFunc {
+	if r.RateLimit <= 0 && r.MaxBodySize <= 0 {
+		return h
+	}
+	if r.RateLimit > 0 && r.limiter == nil {
+		r.limiter = newLimiter(r.RateLimit, r.RateBurst)
+	}
+	return func(w http.ResponseWriter, req *http.Request) {
+		if l := r.limiter; l != nil {
+			if ok, wait := l.allow(Actor(req), time.Now()); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				writeError(w, fmt.Errorf("rate limit exceeded, retry in %v", wait.Round(time.Millisecond)), http.StatusTooManyRequests)
+				return
+			}
+		}
+		if max := r.MaxBodySize; max > 0 {
+			if req.ContentLength > max {
+				writeError(w, fmt.Errorf("request body larger than %d bytes", max), http.StatusRequestEntityTooLarge)
+				return
+			}
+			req.Body = http.MaxBytesReader(w, req.Body, max)
+		}
+		h(w, req)
+	}
+}
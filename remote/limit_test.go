@@ -0,0 +1,61 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package remote_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/remote"
+	"github.com/booster-proj/booster/store"
+)
+
+func TestLimited(t *testing.T) {
+	router := remote.NewRouter()
+	router.Store = store.New(new(core.Balancer))
+	router.Tokens = []remote.Token{
+		{Name: "dashboard", Role: remote.RoleOperator, Secret: "d"},
+		{Name: "ops", Role: remote.RoleOperator, Secret: "o"},
+	}
+	router.RateLimit = 0.001
+	router.RateBurst = 2
+	router.MaxBodySize = 32
+	router.SetupRoutes()
+
+	tt := []struct {
+		path, token, body string
+		code              int
+	}{
+		{"/policies/block.json", "d", strings.Repeat(" ", 32) + `{"source_id": "en0"}`, 413},
+		{"/api/v1/policies/block", "d", `{"source_id": "en0"}`, 201},
+		{"/policies.json", "d", "", 429},
+		{"/policies.json", "o", "", 200},
+	}
+	for i, v := range tt {
+		req := httptest.NewRequest("POST", v.path, strings.NewReader(v.body))
+		req.Header.Set("Authorization", "Bearer "+v.token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != v.code {
+			t.Fatalf("%d: %s: unexpected status code: wanted %d, found %d", i, v.path, v.code, w.Code)
+		}
+		if w.Code == 429 && w.Header().Get("Retry-After") == "" {
+			t.Fatalf("%d: Retry-After header not set", i)
+		}
+	}
+}
@@ -16,8 +16,11 @@
 package remote
 
 import (
+	"encoding/json"
+	"net"
 	"net/http"
 
+	"github.com/booster-proj/booster/audit"
 	"upspin.io/log"
 )
 
@@ -27,3 +30,64 @@ func loggingMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+type actorKey struct{}
+
+// Actor returns who performed request `r`: the identity assigned to
+// the request by the authentication middleware, if any, otherwise the
+// address of the client.
+func Actor(r *http.Request) string {
+	if v, ok := r.Context().Value(actorKey{}).(string); ok {
+		return v
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// auditHandler records the requests served successfully by `next` into
+// `l`, together with the output of `snapshot` before and after the
+// request, which should describe the state modified by the
+// request.
+func auditHandler(l *audit.Log, snapshot func() interface{}, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		before, _ := json.Marshal(snapshot())
+		sw := &statusWriter{ResponseWriter: w}
+		next(sw, r)
+		if sw.status >= 400 {
+			return
+		}
+		after, _ := json.Marshal(snapshot())
+
+		err := l.Record(audit.Entry{
+			Actor:  Actor(r),
+			Action: r.Method + " " + r.URL.Path,
+			Before: json.RawMessage(before),
+			After:  json.RawMessage(after),
+		})
+		if err != nil {
+			log.Error.Printf("Remote: unable to record audit entry: %v", err)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package remote_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/booster-proj/booster/audit"
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/remote"
+	"github.com/booster-proj/booster/store"
+)
+
+func TestAudit(t *testing.T) {
+	router := remote.NewRouter()
+	router.Store = store.New(new(core.Balancer))
+	router.Audit = audit.New()
+	router.SetupRoutes()
+
+	for _, body := range []string{`{"source_id": "en0"}`, `{}`} {
+		req := httptest.NewRequest("POST", "/policies/block.json", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+	}
+
+	// Only the successful request is recorded.
+	entries, _ := router.Audit.Query(audit.Filter{})
+	if len(entries) != 1 {
+		t.Fatalf("Unexpected entries: %+v", entries)
+	}
+	e := entries[0]
+	if e.Action != "POST /policies/block.json" || e.Actor != "192.0.2.1" {
+		t.Fatalf("Unexpected entry: %+v", e)
+	}
+	if fmt.Sprint(e.Before) == fmt.Sprint(e.After) {
+		t.Fatalf("Before and after state should differ: %+v", e)
+	}
+}
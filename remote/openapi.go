@@ -0,0 +1,222 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package remote
+
+import (
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type object = map[string]interface{}
+
+var pathParam = regexp.MustCompile(`{([^}]+)}`)
+
+// openAPI returns the OpenAPI 3 document describing `routes`.
+// `secured` tells whether the API requires authentication.
+func openAPI(info BoosterInfo, routes []route, secured bool) object {
+	version := info.Version
+	if version == "" {
+		version = "unknown"
+	}
+	paths := make(object)
+	for _, v := range routes {
+		item, ok := paths[v.path].(object)
+		if !ok {
+			item = make(object)
+			paths[v.path] = item
+		}
+		methods := v.op.Methods
+		if len(methods) == 0 {
+			methods = []string{http.MethodGet}
+		}
+		for _, m := range methods {
+			item[strings.ToLower(m)] = openAPIOperation(v.path, m, v.op, secured)
+		}
+	}
+
+	doc := object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":   "booster",
+			"version": version,
+		},
+		"servers": []object{{"url": APIPrefix}},
+		"paths":   paths,
+	}
+	if secured {
+		doc["components"] = object{
+			"securitySchemes": object{
+				"bearer": object{"type": "http", "scheme": "bearer"},
+			},
+		}
+	}
+	return doc
+}
+
+func openAPIOperation(path, method string, op operation, secured bool) object {
+	var params []object
+	for _, v := range pathParam.FindAllStringSubmatch(path, -1) {
+		params = append(params, object{
+			"name":     v[1],
+			"in":       "path",
+			"required": true,
+			"schema":   object{"type": "string"},
+		})
+	}
+	for _, v := range op.Query {
+		params = append(params, object{
+			"name":   v,
+			"in":     "query",
+			"schema": object{"type": "string"},
+		})
+	}
+
+	ok := object{"description": "Success"}
+	if method != http.MethodDelete || op.Out != nil {
+		content := object{}
+		if op.Out != nil {
+			content["schema"] = schemaOf(reflect.TypeOf(op.Out), nil)
+		}
+		ok["content"] = object{op.Produces: content}
+	}
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	res := object{
+		"summary":   op.Summary,
+		"responses": object{strconv.Itoa(status): ok},
+	}
+	if len(params) > 0 {
+		res["parameters"] = params
+	}
+	if op.In != nil && (method == http.MethodPost || method == http.MethodPut) {
+		res["requestBody"] = object{
+			"content": object{
+				mediaJSON: object{"schema": schemaOf(reflect.TypeOf(op.In), nil)},
+			},
+		}
+	}
+	if op.Role == 0 {
+		res["security"] = []object{}
+	} else {
+		res["description"] = "Requires the " + op.Role.String() + " role."
+		if secured {
+			res["security"] = []object{{"bearer": []string{}}}
+		}
+	}
+	return res
+}
+
+var (
+	jsonMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	timeType      = reflect.TypeOf(time.Time{})
+)
+
+// schemaOf returns the JSON schema of the values of type `t` encoded
+// with encoding/json. The types with custom encodings are described
+// with an empty schema, i.e. any value. `seen` contains the types
+// being described, to stop at recursive ones.
+func schemaOf(t reflect.Type, seen map[reflect.Type]bool) object {
+	if t == timeType {
+		return object{"type": "string", "format": "date-time"}
+	}
+	if t.Implements(jsonMarshaler) || reflect.PtrTo(t).Implements(jsonMarshaler) {
+		return object{}
+	}
+	if t.Implements(textMarshaler) || reflect.PtrTo(t).Implements(textMarshaler) {
+		return object{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem(), seen)
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return object{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return object{"type": "number"}
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return object{"type": "string", "format": "byte"}
+		}
+		return object{"type": "array", "items": schemaOf(t.Elem(), seen)}
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": schemaOf(t.Elem(), seen)}
+	case reflect.Struct:
+		if seen[t] {
+			return object{}
+		}
+		if seen == nil {
+			seen = make(map[reflect.Type]bool)
+		}
+		seen[t] = true
+		defer delete(seen, t)
+
+		props := make(object)
+		addFields(props, t, seen)
+		return object{"type": "object", "properties": props}
+	default:
+		return object{}
+	}
+}
+
+// addFields adds the schemas of the fields of struct `t` to `props`,
+// including the ones of its embedded structs.
+func addFields(props object, t reflect.Type, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			addFields(props, ft, seen)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = schemaOf(f.Type, seen)
+	}
+}
+
+func makeOpenAPIHandler(doc object) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(doc)
+	}
+}
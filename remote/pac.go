@@ -0,0 +1,70 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package remote
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"text/template"
+)
+
+var pacTmpl = template.Must(template.New("pac").Parse(`// Proxy auto-config file generated by booster {{.Version}}.
+function FindProxyForURL(url, host) {
+	if (isPlainHostName(host) ||
+		host == "localhost" ||
+		isInNet(dnsResolve(host), "127.0.0.0", "255.0.0.0") ||
+		isInNet(dnsResolve(host), "10.0.0.0", "255.0.0.0") ||
+		isInNet(dnsResolve(host), "172.16.0.0", "255.240.0.0") ||
+		isInNet(dnsResolve(host), "192.168.0.0", "255.255.0.0")) {
+		return "DIRECT";
+	}
+{{- if .TurboAddr}}
+	if (url.substring(0, 5) == "http:") {
+		return "PROXY {{.TurboAddr}}; SOCKS5 {{.SocksAddr}}; DIRECT";
+	}
+{{- end}}
+	return "SOCKS5 {{.SocksAddr}}; SOCKS {{.SocksAddr}}; DIRECT";
+}
+`))
+
+// makePACHandler serves a proxy auto-config file pointing to booster's
+// proxy listeners. The host used in the file is the one that the client
+// used to reach the API.
+func makePACHandler(info BoosterInfo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+
+		data := struct {
+			Version   string
+			SocksAddr string
+			TurboAddr string
+		}{
+			Version:   info.Version,
+			SocksAddr: net.JoinHostPort(host, strconv.Itoa(info.ProxyPort)),
+		}
+		if info.TurboPort > 0 {
+			data.TurboAddr = net.JoinHostPort(host, strconv.Itoa(info.TurboPort))
+		}
+
+		w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+		w.WriteHeader(http.StatusOK)
+		pacTmpl.Execute(w, data)
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package remote_test
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/booster-proj/booster/remote"
+)
+
+func TestPAC(t *testing.T) {
+	router := remote.NewRouter()
+	router.Info = remote.BoosterInfo{ProxyPort: 1080, TurboPort: 8080}
+	router.SetupRoutes()
+
+	req := httptest.NewRequest("GET", "http://192.168.1.2:7764/proxy.pac", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	resp := w.Result()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ns-proxy-autoconfig" {
+		t.Fatalf("Unexpected content type: %s", ct)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	for _, v := range []string{"FindProxyForURL", "SOCKS5 192.168.1.2:1080", "PROXY 192.168.1.2:8080"} {
+		if !strings.Contains(string(b), v) {
+			t.Fatalf("PAC file does not contain %q:\n%s", v, b)
+		}
+	}
+}
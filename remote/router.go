@@ -23,8 +23,26 @@ package remote
 
 import (
 	"net/http"
+	"sync/atomic"
 
+	"github.com/booster-proj/booster/acl"
+	"github.com/booster-proj/booster/audit"
+	"github.com/booster-proj/booster/blocklist"
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/dialer"
+	"github.com/booster-proj/booster/dnscache"
+	"github.com/booster-proj/booster/events"
+	"github.com/booster-proj/booster/geoip"
+	"github.com/booster-proj/booster/history"
+	"github.com/booster-proj/booster/logging"
+	"github.com/booster-proj/booster/metrics"
+	"github.com/booster-proj/booster/probe"
+	"github.com/booster-proj/booster/schedule"
+	"github.com/booster-proj/booster/sockopt"
+	"github.com/booster-proj/booster/speedtest"
 	"github.com/booster-proj/booster/store"
+	"github.com/booster-proj/booster/traceroute"
+	"github.com/booster-proj/booster/watchdog"
 	"github.com/gorilla/mux"
 )
 
@@ -35,7 +53,23 @@ type BoosterInfo struct {
 	Commit    string `json:"commit"`
 	BuildTime string `json:"build_time"`
 
-	ProxyPort int `json:"proxy_port"`
+	ProxyPort    int  `json:"proxy_port"`
+	ProxyTLSPort int  `json:"proxy_tls_port,omitempty"`
+	TunnelPort   int  `json:"tunnel_port,omitempty"`
+	GatewayPort  int  `json:"gateway_port,omitempty"`
+	TurboPort    int  `json:"turbo_port,omitempty"`
+	TurboTLS     bool `json:"turbo_tls,omitempty"`
+	// Listeners are the additional SOCKS5 proxies.
+	Listeners []ListenerInfo `json:"listeners,omitempty"`
+}
+
+// ListenerInfo describes an additional SOCKS5 proxy: the policies, as
+// expressions, and the strategy applied to its connections.
+type ListenerInfo struct {
+	Name     string   `json:"name"`
+	Port     int      `json:"port"`
+	Strategy string   `json:"strategy,omitempty"`
+	Policies []string `json:"policies,omitempty"`
 }
 
 var Info BoosterInfo = BoosterInfo{}
@@ -48,8 +82,53 @@ type Router struct {
 	r *mux.Router
 
 	Store           *store.SourceStore
+	Dialer          *dialer.Dialer
 	Info            BoosterInfo
 	MetricsProvider http.Handler
+	Events          *events.Bus
+	Probes          *probe.Prober
+	Speedtest       *speedtest.Tester
+	Traceroute      *traceroute.Tracer
+	History         *history.DB
+	Journal         *history.Journal
+	DNSCache        *dnscache.Cache
+	GeoIP           *geoip.DB
+	Logger          *logging.Logger
+	ACL             *acl.List
+	Blocklist       *blocklist.Filter
+	Schedules       *schedule.Schedules
+	Watchdog        *watchdog.Watchdog
+	// Checks are the readiness checks of the dependencies of booster,
+	// e.g. its listeners, reported by `/readyz`.
+	Checks map[string]Check
+	// ConnEvents, if not nil, are the events of the connections,
+	// which are only available through the event stream.
+	ConnEvents *events.Bus
+	// If Audit is not nil, the management operations are
+	// recorded into it.
+	Audit *audit.Log
+	// Tokens are the API tokens accepted. If empty, the API does
+	// not require authentication.
+	Tokens []Token
+	// RateLimit is the number of requests per second each client,
+	// identified by its token or its address, can perform, with
+	// bursts of up to RateBurst requests. If 0, the requests are not
+	// limited.
+	RateLimit float64
+	RateBurst int
+	// MaxBodySize is the maximum size in bytes of the bodies of the
+	// requests. If 0, it is not limited.
+	MaxBodySize int64
+	// Dashboard, if set, makes the router serve the web dashboard
+	// at DashboardPrefix.
+	Dashboard bool
+	// Debug, if set, makes the router serve the diagnostics
+	// endpoints, i.e. pprof and expvar, at DebugPrefix.
+	Debug bool
+
+	imported atomic.Value // []Token, replacing Tokens when set
+	routes   []route
+	limiter  *limiter
 }
 
 // NewRouter creates a new router instance. Router should not
@@ -62,26 +141,208 @@ func NewRouter() *Router {
 // to fill the public fields of the Router before calling this
 // function, otherwise the handlers will not be able to work
 // properly.
+//
+// Each endpoint is available under APIPrefix and at its legacy,
+// unversioned path. The OpenAPI document describing the versioned
+// API is served at `/api/v1/openapi.json`.
 func (r *Router) SetupRoutes() {
 	router := r.r
-	router.HandleFunc("/health.json", makeHealthCheckHandler(r.Info))
-	if store := r.Store; store != nil {
-		router.HandleFunc("/sources.json", makeSourcesHandler(store))
+	// The health checks and the PAC file are public: clients fetching
+	// them cannot authenticate.
+	r.handle("/health.json", operation{Summary: "Report that booster is alive, with its version"}, makeHealthCheckHandler(r.Info))
+	router.HandleFunc("/healthz", r.makeHealthzHandler()).Methods("GET")
+	router.HandleFunc("/readyz", r.makeReadyzHandler()).Methods("GET")
+	router.HandleFunc("/proxy.pac", makePACHandler(r.Info))
+	router.HandleFunc("/wpad.dat", makePACHandler(r.Info))
+	if ss := r.Store; ss != nil {
+		sources := func() interface{} { return ss.GetSourcesSnapshot() }
+		policies := func() interface{} { return ss.GetPoliciesSnapshot() }
+		groups := func() interface{} { return ss.GetGroupsSnapshot() }
 
-		router.HandleFunc("/policies.json", makePoliciesHandler(store))
-		router.HandleFunc("/policies/{id}.json", makePoliciesDelHandler(store)).Methods("DELETE")
+		r.handle("/sources.json", operation{Summary: "List the sources", Role: RoleViewer}, makeSourcesHandler(ss, r.Probes))
+		router.HandleFunc("/sources", r.require(RoleViewer, r.limited(makeSourcesHandler(ss, r.Probes)))).Methods("GET")
+		r.handle("/sources/{id}/metered.json", operation{
+			Methods: []string{"PUT", "DELETE"}, Summary: "Tag a source as metered, or remove the tag", Role: RoleOperator,
+			In: struct {
+				Metered bool `json:"metered"`
+			}{}, Out: store.DummySource{},
+		}, r.audited(sources, makeSourceMeteredHandler(ss)))
+		r.handle("/sources/{id}/tier.json", operation{
+			Methods: []string{"PUT"}, Summary: "Set the priority tier of a source", Role: RoleOperator,
+			In: struct {
+				Tier store.Tier `json:"tier"`
+			}{}, Out: store.DummySource{},
+		}, r.audited(sources, makeSourceTierHandler(ss)))
+		r.handle("/sources/{id}/labels.json", operation{
+			Methods: []string{"PUT", "DELETE"}, Summary: "Set the name and labels of a source, or remove them", Role: RoleOperator,
+			In: store.SourceLabels{}, Out: store.DummySource{},
+		}, r.audited(sources, makeSourceLabelsHandler(ss)))
+		r.handle("/sources/{id}/disabled.json", operation{Methods: []string{"PUT", "DELETE"}, Summary: "Disable a source, or enable it again", Role: RoleOperator}, r.audited(sources, makeSourceDisabledHandler(ss)))
+		r.handle("/sources/{id}/tcp.json", operation{
+			Methods: []string{"PUT", "DELETE"}, Summary: "Set the TCP options of a source, or reset them", Role: RoleOperator,
+			In: sockopt.Options{},
+		}, r.audited(sources, makeSourceTCPHandler(ss)))
+
+		r.handle("/groups.json", operation{Summary: "List the source groups", Role: RoleViewer}, makeGroupsHandler(ss))
+		r.handle("/groups/{name}.json", operation{Methods: []string{"PUT"}, Summary: "Create or replace a source group", Role: RoleOperator, In: GroupInput{}, Out: core.SourceGroup{}}, r.audited(groups, makeGroupPutHandler(ss)))
+		r.handle("/groups/{name}.json", operation{Methods: []string{"DELETE"}, Summary: "Remove a source group", Role: RoleOperator}, r.audited(groups, makeGroupDelHandler(ss)))
+
+		r.handle("/policies.json", operation{Summary: "List the policies", Role: RoleViewer}, makePoliciesHandler(ss))
+		bindings := func() interface{} { return ss.Bindings() }
+		r.handle("/bindings.json", operation{Summary: "List the bindings of the destinations to the sources, recorded or pinned", Role: RoleViewer, Query: []string{"source"}, Out: []store.Binding{}}, makeBindingsHandler(ss))
+		r.handle("/bindings/{address}.json", operation{Methods: []string{"PUT"}, Summary: "Pin a destination to a source", Role: RoleOperator, In: PoliciesInput{}, Out: store.Binding{}}, r.audited(bindings, makeBindingPinHandler(ss)))
+		r.handle("/bindings/{address}.json", operation{Methods: []string{"DELETE"}, Summary: "Remove the binding of a destination", Role: RoleOperator}, r.audited(bindings, makeBindingDelHandler(ss)))
+		r.handle("/bindings/stats.json", operation{Summary: "Report the size and the hit rate of the bind history of the sticky policy", Role: RoleViewer, Out: store.BindHistoryStats{}}, makeBindingsStatsHandler(ss))
+		r.handle("/decisions.json", operation{Summary: "List the recent decisions of the policies", Role: RoleViewer}, makeDecisionsHandler(ss))
+		r.handle("/policies/simulate.json", operation{
+			Methods: []string{"POST"}, Summary: "Evaluate proposed policies against the recorded selections", Role: RoleViewer,
+			In: SimulationInput{}, Out: store.Simulation{},
+		}, makePoliciesSimulateHandler(ss, r.GeoIP))
+		r.handle("/policies/{id}.json", operation{Methods: []string{"DELETE"}, Summary: "Remove a policy", Role: RoleOperator}, r.audited(policies, makePoliciesDelHandler(ss)))
+
+		for _, v := range []struct {
+			name    string
+			summary string
+			in      interface{}
+			h       http.HandlerFunc
+		}{
+			{"block", "Block a source", PoliciesInput{}, makePoliciesBlockHandler(ss)},
+			{"sticky", "Keep using the source selected for each destination", StickyPolicyInput{}, makePoliciesStickyHandler(ss)},
+			{"reserve", "Reserve a source for some destinations", ReservedPolicyInput{}, makePoliciesReserveHandler(ss)},
+			{"avoid", "Avoid a source for a destination", PoliciesInput{}, makePoliciesAvoidHandler(ss)},
+			{"metered", "Avoid, or prefer, the metered sources", MeteredPolicyInput{}, makePoliciesMeteredHandler(ss)},
+			{"dscp", "Mark the connections with a DSCP value", DSCPPolicyInput{}, makePoliciesDSCPHandler(ss)},
+			{"fwmark", "Set the firewall mark of the connections", FWMarkPolicyInput{}, makePoliciesFWMarkHandler(ss)},
+			{"process", "Route the connections of a process through a source", ProcessPolicyInput{}, makePoliciesProcessHandler(ss)},
+			{"protocol", "Route the connections of a protocol through a source", ProtocolPolicyInput{}, makePoliciesProtocolHandler(ss)},
+			{"expr", "Add a policy described by an expression", ExprPolicyInput{}, makePoliciesExprHandler(ss)},
+			{"webhook", "Delegate the decisions to a webhook", WebhookPolicyInput{}, makePoliciesWebhookHandler(ss)},
+		} {
+			op := operation{Methods: []string{"POST"}, Summary: v.summary, Role: RoleOperator, In: v.in, Status: http.StatusCreated}
+			r.handle("/policies/"+v.name+".json", op, r.audited(policies, v.h))
+		}
+		if db := r.GeoIP; db != nil {
+			op := operation{Methods: []string{"POST"}, Summary: "Route the connections to some locations through a source", Role: RoleOperator, In: GeoPolicyInput{}, Status: http.StatusCreated}
+			r.handle("/policies/geo.json", op, r.audited(policies, makePoliciesGeoHandler(ss, db)))
+		}
+	}
+	if d := r.Dialer; d != nil {
+		conns := func() interface{} { return d.Conns() }
 
-		router.HandleFunc("/policies/block.json", makePoliciesBlockHandler(store)).Methods("POST")
-		router.HandleFunc("/policies/sticky.json", makePoliciesStickyHandler(store)).Methods("POST")
-		router.HandleFunc("/policies/reserve.json", makePoliciesReserveHandler(store)).Methods("POST")
-		router.HandleFunc("/policies/avoid.json", makePoliciesAvoidHandler(store)).Methods("POST")
+		r.handle("/conns.json", operation{Methods: []string{"GET"}, Summary: "List the open connections", Role: RoleViewer, Out: []dialer.ConnInfo{}}, makeConnsHandler(d))
+		r.handle("/conns.json", operation{Methods: []string{"DELETE"}, Summary: "Close the idle connections", Role: RoleOperator, Query: []string{"idle"}}, r.audited(conns, makeConnsReapHandler(d)))
+		r.handle("/conns/{id}.json", operation{Methods: []string{"DELETE"}, Summary: "Close a connection", Role: RoleOperator}, r.audited(conns, makeConnKillHandler(d)))
+		r.handle("/sources/{id}/conns.json", operation{Methods: []string{"DELETE"}, Summary: "Close the connections of a source", Role: RoleOperator}, r.audited(conns, makeSourceDrainHandler(d)))
 	}
 	if handler := r.MetricsProvider; handler != nil {
-		router.Handle("/metrics", handler)
+		r.handle("/metrics", operation{Summary: "Export the metrics in the Prometheus format", Role: RoleViewer, Produces: mediaText}, handler.ServeHTTP)
+		if ss := r.Store; ss != nil {
+			r.handle("/metrics/rules.json", operation{Summary: "Generate the recommended Prometheus alerting rules for the sources", Role: RoleViewer, Query: []string{"quota", "period"}, Out: metrics.RuleFile{}}, makeAlertRulesHandler(ss))
+		}
+	}
+	if bus := r.Events; bus != nil {
+		r.handle("/events.json", operation{Summary: "List the recent events", Role: RoleViewer}, makeEventsHandler(bus))
+	}
+	if s := r.Store; s != nil {
+		r.handle("/events/stream", operation{Summary: "Stream the events and the statistics of the sources", Role: RoleViewer, Query: []string{"topics", "interval"}, Produces: mediaEventStream}, makeStreamHandler(s, r.Events, r.ConnEvents))
+	}
+	if prober := r.Probes; prober != nil {
+		r.handle("/probes.json", operation{Summary: "Report the latency and packet loss of each source", Role: RoleViewer}, makeProbesHandler(prober))
+	}
+	if tester := r.Speedtest; tester != nil {
+		results := func() interface{} { return tester.Snapshot() }
+		r.handle("/speedtest.json", operation{Summary: "List the results of the speed tests", Role: RoleViewer}, makeSpeedtestHandler(tester))
+		r.handle("/speedtest/download", operation{Summary: "Download random data, to measure the throughput", Role: RoleViewer, Query: []string{"bytes"}, Produces: mediaBinary}, speedtest.DownloadHandler)
+		r.handle("/speedtest/{id}.json", operation{Methods: []string{"POST"}, Summary: "Run a speed test through a source", Role: RoleOperator, Out: speedtest.Result{}}, r.audited(results, makeSpeedtestRunHandler(tester)))
+	}
+	if t := r.Traceroute; t != nil {
+		// The traces change no state: only who traced through
+		// which source is recorded.
+		none := func() interface{} { return nil }
+		r.handle("/traceroute/{id}.json", operation{Methods: []string{"POST"}, Summary: "Trace the route to a host through a source", Role: RoleOperator, Query: []string{"host"}, Out: traceroute.Result{}}, r.audited(none, makeTracerouteHandler(t)))
+	}
+	if db := r.GeoIP; db != nil {
+		r.handle("/geoip.json", operation{Summary: "Locate a host", Role: RoleViewer, Query: []string{"host"}}, makeGeoIPHandler(db))
+	}
+	if db := r.History; db != nil {
+		period := []string{"period", "date"}
+		r.handle("/history.json", operation{Summary: "List the metrics recorded", Role: RoleViewer, Query: []string{"source", "from", "to"}}, makeHistoryHandler(db))
+		r.handle("/report.json", operation{Summary: "Report the data transmitted in a period", Role: RoleViewer, Query: period, Out: history.Report{}}, makeReportHandler(db))
+		r.handle("/domains.json", operation{Summary: "List the domains to which the most data was transmitted", Role: RoleViewer, Query: append(period, "source", "limit")}, makeDomainsHandler(db))
+	}
+	if j := r.Journal; j != nil {
+		r.handle("/availability.json", operation{Summary: "Report the availability of each source over some windows of time", Role: RoleViewer, Query: []string{"source", "windows"}}, makeAvailabilityHandler(j))
+		r.handle("/outages.json", operation{Summary: "List the outages of the sources", Role: RoleViewer, Query: []string{"source", "from", "to"}}, makeOutagesHandler(j))
 	}
+	if c := r.DNSCache; c != nil {
+		stats := func() interface{} { return c.Stats() }
+
+		r.handle("/dns/cache.json", operation{Methods: []string{"GET"}, Summary: "Report the usage of the DNS cache", Role: RoleViewer, Out: dnscache.Stats{}}, makeDNSCacheHandler(c))
+		r.handle("/dns/cache.json", operation{Methods: []string{"DELETE"}, Summary: "Flush the DNS cache", Role: RoleOperator}, r.audited(stats, makeDNSCacheFlushHandler(c)))
+	}
+	if w := r.Watchdog; w != nil {
+		r.handle("/watchdog.json", operation{Summary: "Report the goroutines, by subsystem, and the file descriptors counted by the watchdog", Role: RoleViewer, Out: watchdog.Stats{}}, makeWatchdogHandler(w))
+	}
+	if l := r.Logger; l != nil {
+		levels := func() interface{} {
+			def, modules := l.Levels()
+			return map[string]interface{}{"default": def, "modules": modules}
+		}
+		r.handle("/log/levels.json", operation{Methods: []string{"GET"}, Summary: "List the log levels", Role: RoleViewer}, makeLogLevelsHandler(l))
+		r.handle("/log/levels.json", operation{Methods: []string{"PUT"}, Summary: "Set the log level of a module", Role: RoleAdmin, In: LogLevelInput{}}, r.audited(levels, makeLogLevelsSetHandler(l)))
+	}
+	if l := r.ACL; l != nil {
+		rules := func() interface{} { return l.Rules() }
+		r.handle("/acl.json", operation{Methods: []string{"GET"}, Summary: "List the access control rules", Role: RoleViewer, Out: acl.Rules{}}, makeACLHandler(l))
+		r.handle("/acl.json", operation{Methods: []string{"PUT"}, Summary: "Replace the access control rules", Role: RoleAdmin, In: acl.Rules{}, Out: acl.Rules{}}, r.audited(rules, makeACLSetHandler(l)))
+	}
+	if s := r.Schedules; s != nil {
+		rules := func() interface{} { return s.Rules() }
+		r.handle("/schedules.json", operation{Summary: "List the schedules", Role: RoleViewer, Out: []schedule.Rule{}}, makeSchedulesHandler(s))
+		r.handle("/schedules/{id}.json", operation{Methods: []string{"PUT"}, Summary: "Create or replace a schedule", Role: RoleAdmin, In: schedule.Rule{}, Out: schedule.Rule{}}, r.audited(rules, makeSchedulePutHandler(s)))
+		r.handle("/schedules/{id}.json", operation{Methods: []string{"DELETE"}, Summary: "Remove a schedule", Role: RoleAdmin}, r.audited(rules, makeScheduleDelHandler(s)))
+	}
+	if f := r.Blocklist; f != nil {
+		lists := func() interface{} { return f.Lists() }
+		r.handle("/blocklists.json", operation{Summary: "List the blocklists", Role: RoleViewer, Out: []blocklist.Info{}}, makeBlocklistsHandler(f))
+		r.handle("/blocklists/{name}/enabled.json", operation{Methods: []string{"PUT", "DELETE"}, Summary: "Enable a blocklist, or disable it", Role: RoleOperator, Out: []blocklist.Info{}}, r.audited(lists, makeBlocklistEnabledHandler(f)))
+		r.handle("/blocklists/{name}/refresh.json", operation{Methods: []string{"POST"}, Summary: "Download a blocklist again", Role: RoleOperator, Out: []blocklist.Info{}}, r.audited(lists, makeBlocklistRefreshHandler(f)))
+	}
+	if store := r.Store; store != nil {
+		// The tokens are not part of the snapshot: the audit log
+		// must not contain their secrets.
+		config := func() interface{} {
+			return map[string]interface{}{"state": store.State(), "policies": store.GetPoliciesSnapshot()}
+		}
+		r.handle("/config/export", operation{Methods: []string{"GET"}, Summary: "Export the configuration", Role: RoleAdmin, Out: ConfigDocument{}}, makeConfigExportHandler(r))
+		r.handle("/config/import", operation{Methods: []string{"POST"}, Summary: "Replace the configuration", Role: RoleAdmin, In: ConfigDocument{}}, r.audited(config, makeConfigImportHandler(r)))
+	}
+	if l := r.Audit; l != nil {
+		r.handle("/audit.json", operation{Summary: "List the management operations performed", Role: RoleAdmin, Query: []string{"actor", "action", "from", "to"}}, makeAuditHandler(l))
+	}
+
+	if r.Debug {
+		r.setupDebug()
+	}
+	if r.Dashboard {
+		router.PathPrefix(DashboardPrefix).Methods("GET").Handler(r.limited(makeDashboardHandler()))
+		router.Handle("/", http.RedirectHandler(DashboardPrefix, http.StatusFound)).Methods("GET")
+	}
+
+	doc := openAPI(r.Info, r.routes, len(r.Tokens) > 0)
+	router.HandleFunc(APIPrefix+"/openapi.json", r.limited(makeOpenAPIHandler(doc)))
 	router.Use(loggingMiddleware)
 }
 
+// audited returns `h` wrapped by auditHandler, if the router has an
+// audit log.
+func (r *Router) audited(snapshot func() interface{}, h http.HandlerFunc) http.HandlerFunc {
+	if r.Audit == nil {
+		return h
+	}
+	return auditHandler(r.Audit, snapshot, h)
+}
+
 // ServeHTTP implements `http.Handler`.
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	r.r.ServeHTTP(w, req)
@@ -16,18 +16,85 @@ package remote
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
+	"sync"
 	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+	"upspin.io/log"
 )
 
+// TLS configures the management server to serve HTTPS. Either provide
+// a certificate and its key, or the hosts for which a certificate should
+// be automatically obtained from Let's Encrypt.
+type TLS struct {
+	CertFile string
+	KeyFile  string
+
+	// ACMEHosts are the host names certificates are issued for.
+	// If not empty, CertFile and KeyFile are ignored.
+	ACMEHosts []string
+	// ACMECache is the directory where the issued certificates are
+	// stored, so that they survive restarts.
+	ACMECache string
+	// ACMEEmail is the contact address of the ACME account, optional.
+	ACMEEmail string
+	// ACMEHTTPPort, if not 0, is the port where HTTP-01 challenges
+	// are served, usually 80. Other plain HTTP requests are redirected
+	// to HTTPS. If 0, only the TLS-ALPN-01 challenge is available,
+	// which requires the API to be reachable on port 443.
+	ACMEHTTPPort int
+	// ACMEHTTPListener, if not nil, is used to serve the HTTP-01
+	// challenges instead of listening on ACMEHTTPPort.
+	ACMEHTTPListener net.Listener
+
+	once      sync.Once
+	conf      *tls.Config
+	challenge http.Handler
+	err       error
+}
+
+// Config returns the configuration of the TLS servers described by
+// `t`, and the handler of the ACME HTTP-01 challenges when the
+// certificates are obtained from Let's Encrypt. The servers sharing `t`,
+// e.g. the API and the proxies, share its certificates.
+func (t *TLS) Config() (*tls.Config, http.Handler, error) {
+	t.once.Do(func() {
+		if len(t.ACMEHosts) == 0 {
+			cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+			if err != nil {
+				t.err = fmt.Errorf("unable to load the TLS certificate: %v", err)
+				return
+			}
+			t.conf = &tls.Config{Certificates: []tls.Certificate{cert}}
+			return
+		}
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(t.ACMEHosts...),
+			Email:      t.ACMEEmail,
+		}
+		if t.ACMECache != "" {
+			m.Cache = autocert.DirCache(t.ACMECache)
+		}
+		t.conf, t.challenge = m.TLSConfig(), m.HTTPHandler(nil)
+	})
+	return t.conf, t.challenge, t.err
+}
+
 type Remote struct {
 	*http.Server
+
+	// If TLS is not nil, the server only accepts TLS connections.
+	TLS *TLS
 }
 
 func New(h http.Handler) *Remote {
 	return &Remote{
-		&http.Server{
+		Server: &http.Server{
 			WriteTimeout: time.Second * 15,
 			ReadTimeout:  time.Second * 15,
 			IdleTimeout:  time.Second * 60,
@@ -37,20 +104,67 @@ func New(h http.Handler) *Remote {
 }
 
 func (r *Remote) ListenAndServe(ctx context.Context, port int) error {
-	c := make(chan error)
-	go func() {
-		r.Server.Addr = fmt.Sprintf(":%d", port)
-		c <- r.Server.ListenAndServe()
-	}()
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+	return r.Serve(ctx, ln)
+}
+
+// Serve accepts incoming connections on `ln`, until the context is
+// canceled. Use it when the listener is created by someone else, e.g.
+// systemd socket activation.
+func (r *Remote) Serve(ctx context.Context, ln net.Listener) error {
+	c := make(chan error, 2)
+
+	var challenge *http.Server
+	if t := r.TLS; t == nil {
+		go func() {
+			c <- r.Server.Serve(ln)
+		}()
+	} else {
+		conf, handler, err := t.Config()
+		if err != nil {
+			return err
+		}
+		r.Server.TLSConfig = conf
+		if handler != nil && (t.ACMEHTTPPort != 0 || t.ACMEHTTPListener != nil) {
+			challenge = &http.Server{
+				Addr:         fmt.Sprintf(":%d", t.ACMEHTTPPort),
+				WriteTimeout: time.Second * 15,
+				ReadTimeout:  time.Second * 15,
+				Handler:      handler,
+			}
+			go func() {
+				if ln := t.ACMEHTTPListener; ln != nil {
+					log.Info.Printf("Remote: serving ACME HTTP challenges on %v", ln.Addr())
+					c <- challenge.Serve(ln)
+					return
+				}
+				log.Info.Printf("Remote: serving ACME HTTP challenges on %v", challenge.Addr)
+				c <- challenge.ListenAndServe()
+			}()
+		}
+		go func() {
+			c <- r.Server.ServeTLS(ln, "", "")
+		}()
+	}
 
 	select {
 	case <-ctx.Done():
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 		defer cancel()
 
+		if challenge != nil {
+			challenge.Shutdown(ctx)
+		}
 		r.Shutdown(ctx)
 		return <-c
 	case err := <-c:
+		if challenge != nil {
+			challenge.Close()
+		}
+		r.Close()
 		return err
 	}
 }
@@ -17,7 +17,20 @@ package remote_test
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -41,3 +54,124 @@ func TestListenAndServe(t *testing.T) {
 	case <-c:
 	}
 }
+
+// writeCert writes a self signed certificate for 127.0.0.1 and its key
+// into `dir`.
+func writeCert(t *testing.T, dir string) (cert, key string) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"booster"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kder, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, key = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestListenAndServe_tls(t *testing.T) {
+	dir, err := ioutil.TempDir("", "booster-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cert, key := writeCert(t, dir)
+
+	// Find a free port.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secure"))
+	})
+	srv := remote.New(mux)
+	srv.TLS = &remote.TLS{CertFile: cert, KeyFile: key}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan error, 1)
+	go func() {
+		c <- srv.ListenAndServe(ctx, port)
+	}()
+	defer func() {
+		cancel()
+		<-c
+	}()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	url := fmt.Sprintf("https://127.0.0.1:%d", port)
+
+	// Wait for the server to come up.
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		if resp, err = client.Get(url); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.TLS == nil {
+		t.Fatal("Response was not served over TLS")
+	}
+	if b, _ := ioutil.ReadAll(resp.Body); string(b) != "secure" {
+		t.Fatalf("Unexpected body: %s", b)
+	}
+}
+
+func TestTLS_config(t *testing.T) {
+	dir, err := ioutil.TempDir("", "booster-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cert, key := writeCert(t, dir)
+
+	tc := &remote.TLS{CertFile: cert, KeyFile: key}
+	conf, challenge, err := tc.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.Certificates) != 1 || challenge != nil {
+		t.Fatalf("Unexpected configuration: %d certificates, challenge handler %v", len(conf.Certificates), challenge)
+	}
+	// The servers sharing the configuration share the certificates.
+	if again, _, _ := tc.Config(); again != conf {
+		t.Fatal("The configuration should be built once")
+	}
+
+	if _, _, err := (&remote.TLS{CertFile: filepath.Join(dir, "missing.pem"), KeyFile: key}).Config(); err == nil {
+		t.Fatal("A missing certificate should be reported")
+	}
+}
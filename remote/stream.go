@@ -0,0 +1,135 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/booster-proj/booster/events"
+	"github.com/booster-proj/booster/store"
+)
+
+// TopicStats is the topic of the events sent periodically by the event
+// stream, whose data is a Stats value.
+const TopicStats = "stats"
+
+// DefaultStreamInterval is the default interval between the
+// TopicStats events of the event stream.
+const DefaultStreamInterval = time.Second
+
+const mediaEventStream = "text/event-stream"
+
+// Stats describes the state of the sources and of the policies at
+// some point in time.
+type Stats struct {
+	Sources []*store.DummySource `json:"sources"`
+	// PolicyHits contains, for each policy, the number of sources it
+	// refused to the connections.
+	PolicyHits map[string]uint64 `json:"policy_hits"`
+}
+
+// makeStreamHandler streams the events published on `buses` using
+// server-sent events, together with a TopicStats event for each
+// interval, the first one immediately. The `topics` query parameter,
+// a comma separated list, restricts the topics streamed.
+func makeStreamHandler(s *store.SourceStore, buses ...*events.Bus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeError(w, fmt.Errorf("streaming is not supported"), http.StatusInternalServerError)
+			return
+		}
+		interval := DefaultStreamInterval
+		if v := r.URL.Query().Get("interval"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 100*time.Millisecond {
+				writeError(w, fmt.Errorf("validation error: interval must be a duration of at least 100ms"), http.StatusBadRequest)
+				return
+			}
+			interval = d
+		}
+		var topics map[string]bool
+		if v := r.URL.Query().Get("topics"); v != "" {
+			topics = make(map[string]bool)
+			for _, t := range strings.Split(v, ",") {
+				topics[strings.TrimSpace(t)] = true
+			}
+		}
+
+		c := make(chan events.Event, 64)
+		for _, b := range buses {
+			if b == nil {
+				continue
+			}
+			sub, cancel := b.Subscribe(64)
+			defer cancel()
+			go func() {
+				for e := range sub {
+					select {
+					case c <- e:
+					default:
+					}
+				}
+			}()
+		}
+
+		w.Header().Set("Content-Type", mediaEventStream)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+
+		send := func(e events.Event) bool {
+			if topics != nil && !topics[e.Topic] {
+				return true
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				return true
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Topic, data); err != nil {
+				return false
+			}
+			flusher.Flush()
+			return true
+		}
+		stats := func() events.Event {
+			return events.Event{
+				Topic: TopicStats,
+				Time:  time.Now(),
+				Data: Stats{
+					Sources:    s.GetSourcesSnapshot(),
+					PolicyHits: s.PolicyHits(),
+				},
+			}
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for ok := send(stats()); ok; {
+			select {
+			case <-r.Context().Done():
+				return
+			case e := <-c:
+				ok = send(e)
+			case <-ticker.C:
+				ok = send(stats())
+			}
+		}
+	}
+}
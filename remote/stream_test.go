@@ -0,0 +1,69 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package remote_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/events"
+	"github.com/booster-proj/booster/remote"
+	"github.com/booster-proj/booster/store"
+)
+
+func TestStream(t *testing.T) {
+	router := remote.NewRouter()
+	router.Store = store.New(new(core.Balancer))
+	router.Store.AppendPolicy(store.NewBlockPolicy("", "en0"))
+	router.Events = new(events.Bus)
+	router.SetupRoutes()
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := &remote.Client{URL: srv.URL}
+
+	var topics []string
+	err := c.Stream(ctx, []string{remote.TopicStats, events.TopicSourceUp}, func(e events.Event) error {
+		topics = append(topics, e.Topic)
+		switch e.Topic {
+		case remote.TopicStats:
+			var stats remote.Stats
+			if err := json.Unmarshal(e.Data.(json.RawMessage), &stats); err != nil {
+				return err
+			}
+			if _, ok := stats.PolicyHits["block_en0"]; !ok {
+				return fmt.Errorf("unexpected stats: %+v", stats)
+			}
+			router.Events.Publish(events.Event{Topic: events.TopicSourceDown})
+			router.Events.Publish(events.Event{Topic: events.TopicSourceUp})
+		case events.TopicSourceUp:
+			cancel()
+		}
+		return nil
+	})
+	if err != context.Canceled {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(topics) < 2 || topics[0] != remote.TopicStats || topics[len(topics)-1] != events.TopicSourceUp {
+		t.Fatalf("Unexpected topics: %v", topics)
+	}
+}
@@ -0,0 +1,357 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package schedule provides the time rules that deny the clients the
+// use of the proxies during configured windows, e.g. the parental
+// controls of a home gateway.
+package schedule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/booster-proj/booster/acl"
+)
+
+// ErrNotFound is returned when a rule does not exist.
+var ErrNotFound = errors.New("schedule: rule not found")
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Window is a daily time window, from `From` to `To`, both in 15:04
+// format. Windows ending before they start span midnight, and the
+// hours after midnight belong to the day the window started. Windows
+// starting and ending at the same time last the whole day.
+type Window struct {
+	// Days are the days of the week the window applies to, i.e.
+	// "mon", "tue" and so on. If empty, it applies every day.
+	Days []string `json:"days,omitempty"`
+	From string   `json:"from"`
+	To   string   `json:"to"`
+}
+
+// Rule denies the clients in `Clients`, networks in CIDR notation or
+// single addresses, the use of the proxies during the `Deny` windows.
+type Rule struct {
+	ID      string   `json:"id"`
+	Clients []string `json:"clients"`
+	Deny    []Window `json:"deny"`
+	Reason  string   `json:"reason,omitempty"`
+}
+
+type window struct {
+	days     map[time.Weekday]bool
+	from, to int // minutes since midnight
+}
+
+// contains reports whether `t` falls in the window.
+func (w window) contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	switch {
+	case w.from == w.to:
+	case w.from < w.to:
+		if m < w.from || m >= w.to {
+			return false
+		}
+	case m >= w.from:
+	case m < w.to:
+		// The window started the day before.
+		day = (day + 6) % 7
+	default:
+		return false
+	}
+	return len(w.days) == 0 || w.days[day]
+}
+
+type rule struct {
+	Rule
+	clients []*net.IPNet
+	windows []window
+}
+
+func parseMinutes(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("schedule: invalid time %q, expected 15:04 format", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func compile(r Rule) (*rule, error) {
+	if r.ID == "" {
+		return nil, fmt.Errorf("schedule: rule id cannot be empty")
+	}
+	if len(r.Clients) == 0 {
+		return nil, fmt.Errorf("schedule: rule %v has no clients", r.ID)
+	}
+	clients, err := acl.ParseNetworks(r.Clients)
+	if err != nil {
+		return nil, err
+	}
+	c := &rule{Rule: r, clients: clients}
+	for _, v := range r.Deny {
+		w := window{days: make(map[time.Weekday]bool, len(v.Days))}
+		for _, d := range v.Days {
+			wd, ok := weekdays[strings.ToLower(d)]
+			if !ok {
+				return nil, fmt.Errorf("schedule: invalid day %q", d)
+			}
+			w.days[wd] = true
+		}
+		if w.from, err = parseMinutes(v.From); err != nil {
+			return nil, err
+		}
+		if w.to, err = parseMinutes(v.To); err != nil {
+			return nil, err
+		}
+		c.windows = append(c.windows, w)
+	}
+	return c, nil
+}
+
+// Schedules is a set of rules. Its zero value is ready to use and
+// denies no client. It is safe for concurrent use.
+type Schedules struct {
+	// File, if set, is where the rules are saved. See Load.
+	File string
+	// Location is the time zone of the windows. If nil, the local
+	// time zone is used.
+	Location *time.Location
+
+	mux   sync.RWMutex
+	rules []*rule
+}
+
+// Load reads the rules from File, replacing the ones stored. A
+// missing file is not an error.
+func (s *Schedules) Load() error {
+	if s.File == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(s.File)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return fmt.Errorf("schedule: invalid file %s: %v", s.File, err)
+	}
+	acc := make([]*rule, 0, len(rules))
+	for _, v := range rules {
+		r, err := compile(v)
+		if err != nil {
+			return err
+		}
+		acc = append(acc, r)
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.rules = acc
+	return nil
+}
+
+// Put adds rule `r`, replacing the one with the same id if present.
+// The rules are changed only if they could be saved.
+func (s *Schedules) Put(r Rule) error {
+	c, err := compile(r)
+	if err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	rules := make([]*rule, 0, len(s.rules)+1)
+	found := false
+	for _, v := range s.rules {
+		if v.ID == r.ID {
+			v, found = c, true
+		}
+		rules = append(rules, v)
+	}
+	if !found {
+		rules = append(rules, c)
+	}
+	return s.swap(rules)
+}
+
+// Del removes rule `id`. The rules are changed only if they could be
+// saved.
+func (s *Schedules) Del(id string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for i, v := range s.rules {
+		if v.ID == id {
+			rules := make([]*rule, 0, len(s.rules)-1)
+			rules = append(rules, s.rules[:i]...)
+			return s.swap(append(rules, s.rules[i+1:]...))
+		}
+	}
+	return ErrNotFound
+}
+
+// swap saves `rules` and, on success, replaces the rules stored with
+// them. Has to be called holding the lock.
+func (s *Schedules) swap(rules []*rule) error {
+	if err := s.save(rules); err != nil {
+		return err
+	}
+	s.rules = rules
+	return nil
+}
+
+// Validate returns an error if `rules` cannot be set with Set.
+func Validate(rules []Rule) error {
+	_, err := compileAll(rules)
+	return err
+}
+
+func compileAll(rules []Rule) ([]*rule, error) {
+	acc := make([]*rule, 0, len(rules))
+	ids := make(map[string]bool, len(rules))
+	for _, v := range rules {
+		c, err := compile(v)
+		if err != nil {
+			return nil, err
+		}
+		if ids[v.ID] {
+			return nil, fmt.Errorf("schedule: more than one rule with id %s", v.ID)
+		}
+		ids[v.ID] = true
+		acc = append(acc, c)
+	}
+	return acc, nil
+}
+
+// Set replaces the rules stored with `rules`. Nothing is changed if
+// one of them is not valid, if two of them have the same id or if
+// they could not be saved.
+func (s *Schedules) Set(rules []Rule) error {
+	acc, err := compileAll(rules)
+	if err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.swap(acc)
+}
+
+// Rules returns the rules stored.
+func (s *Schedules) Rules() []Rule {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	acc := make([]Rule, 0, len(s.rules))
+	for _, v := range s.rules {
+		acc = append(acc, v.Rule)
+	}
+	return acc
+}
+
+// save writes `rules` to File, if set.
+func (s *Schedules) save(rules []*rule) error {
+	if s.File == "" {
+		return nil
+	}
+	acc := make([]Rule, 0, len(rules))
+	for _, v := range rules {
+		acc = append(acc, v.Rule)
+	}
+	b, err := json.MarshalIndent(acc, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(s.File), "."+filepath.Base(s.File))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.File)
+}
+
+// Denied reports whether client `ip` is denied the use of the proxies
+// at time `t`, returning the rule denying it.
+func (s *Schedules) Denied(ip net.IP, t time.Time) (Rule, bool) {
+	if s.Location != nil {
+		t = t.In(s.Location)
+	} else {
+		t = t.Local()
+	}
+
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	for _, r := range s.rules {
+		if !contains(r.clients, ip) {
+			continue
+		}
+		for _, w := range r.windows {
+			if w.contains(t) {
+				return r.Rule, true
+			}
+		}
+	}
+	return Rule{}, false
+}
+
+// DeniedAddr is Denied for the address of a client in host:port form.
+// Addresses that cannot be parsed are never denied, the ACL is in
+// charge of refusing them.
+func (s *Schedules) DeniedAddr(addr string, t time.Time) (Rule, bool) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return Rule{}, false
+	}
+	return s.Denied(ip, t)
+}
+
+func contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, v := range networks {
+		if v.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
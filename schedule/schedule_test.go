@@ -0,0 +1,151 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package schedule_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/schedule"
+)
+
+func TestDenied(t *testing.T) {
+	s := &schedule.Schedules{Location: time.UTC}
+	err := s.Put(schedule.Rule{
+		ID:      "kids",
+		Clients: []string{"192.168.1.0/28", "192.168.1.100"},
+		Deny: []schedule.Window{
+			{Days: []string{"mon", "tue", "wed", "thu", "sun"}, From: "21:30", To: "07:00"},
+			{Days: []string{"Sat"}, From: "12:00", To: "13:00"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2019-01-07 is a Monday.
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2019, time.January, day, hour, min, 0, 0, time.UTC)
+	}
+	tt := []struct {
+		ip     string
+		t      time.Time
+		denied bool
+	}{
+		{ip: "192.168.1.3", t: at(7, 22, 0), denied: true},
+		{ip: "192.168.1.3", t: at(7, 21, 29)},
+		{ip: "192.168.1.3", t: at(8, 6, 59), denied: true},     // Monday night
+		{ip: "192.168.1.3", t: at(8, 7, 0)},                    // Tuesday morning
+		{ip: "192.168.1.100", t: at(11, 23, 0)},                // Friday night
+		{ip: "192.168.1.100", t: at(12, 3, 0)},                 // Friday night, after midnight
+		{ip: "192.168.1.100", t: at(12, 12, 30), denied: true}, // Saturday lunch
+		{ip: "192.168.1.100", t: at(7, 6, 0), denied: true},    // Sunday night
+		{ip: "192.168.1.50", t: at(7, 22, 0)},
+	}
+	for _, v := range tt {
+		rule, denied := s.Denied(net.ParseIP(v.ip), v.t)
+		if denied != v.denied {
+			t.Fatalf("%v at %v: wanted denied %v, found %v", v.ip, v.t, v.denied, denied)
+		}
+		if denied && rule.ID != "kids" {
+			t.Fatalf("Unexpected rule: %+v", rule)
+		}
+	}
+	if _, denied := s.DeniedAddr("192.168.1.3:5000", at(7, 22, 0)); !denied {
+		t.Fatalf("The client address was not denied")
+	}
+}
+
+func TestPut_invalid(t *testing.T) {
+	s := &schedule.Schedules{}
+	for _, v := range []schedule.Rule{
+		{Clients: []string{"10.0.0.1"}},
+		{ID: "a"},
+		{ID: "a", Clients: []string{"10.0.0.300"}},
+		{ID: "a", Clients: []string{"10.0.0.1"}, Deny: []schedule.Window{{From: "25:00", To: "07:00"}}},
+		{ID: "a", Clients: []string{"10.0.0.1"}, Deny: []schedule.Window{{Days: []string{"monday"}, From: "20:00", To: "07:00"}}},
+	} {
+		if err := s.Put(v); err == nil {
+			t.Fatalf("Put accepted an invalid rule: %+v", v)
+		}
+	}
+	if err := s.Del("a"); !errors.Is(err, schedule.ErrNotFound) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "booster-schedules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "schedules.json")
+
+	s := &schedule.Schedules{File: file}
+	if err := s.Load(); err != nil {
+		t.Fatalf("Unexpected error with a missing file: %v", err)
+	}
+	r := schedule.Rule{ID: "tv", Clients: []string{"10.0.0.5"}, Deny: []schedule.Window{{From: "00:00", To: "00:00"}}}
+	if err := s.Put(r); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(schedule.Rule{ID: "old", Clients: []string{"10.0.0.6"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Del("old"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The rules survive a restart.
+	s = &schedule.Schedules{File: file}
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if rules := s.Rules(); len(rules) != 1 || rules[0].ID != "tv" {
+		t.Fatalf("Unexpected rules loaded: %+v", rules)
+	}
+	if _, denied := s.Denied(net.ParseIP("10.0.0.5"), time.Now()); !denied {
+		t.Fatalf("A whole day window should always deny")
+	}
+}
+
+func TestPut_saveError(t *testing.T) {
+	s := &schedule.Schedules{}
+	if err := s.Put(schedule.Rule{ID: "tv", Clients: []string{"10.0.0.5"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The rules are not changed when they cannot be saved.
+	s.File = filepath.Join(os.DevNull, "schedules.json")
+	if err := s.Put(schedule.Rule{ID: "tv", Clients: []string{"10.0.0.6"}}); err == nil {
+		t.Fatalf("Put did not report the save error")
+	}
+	if err := s.Put(schedule.Rule{ID: "new", Clients: []string{"10.0.0.7"}}); err == nil {
+		t.Fatalf("Put did not report the save error")
+	}
+	if err := s.Del("tv"); err == nil {
+		t.Fatalf("Del did not report the save error")
+	}
+	if rules := s.Rules(); len(rules) != 1 || rules[0].ID != "tv" || rules[0].Clients[0] != "10.0.0.5" {
+		t.Fatalf("Unexpected rules after the failures: %+v", rules)
+	}
+}
@@ -32,6 +32,11 @@ function release {
 	echo "Starting release pipeline..."
 	prepare
 
+	if [ -z "$BOOSTER_PUBLIC_KEY" ] || [ -z "$BOOSTER_SIGNING_KEY" ]; then
+		echo >&2 "BOOSTER_PUBLIC_KEY and BOOSTER_SIGNING_KEY are required to sign the release, generate them with \`booster update keygen\`. Quitting..."
+		exit 1
+	fi
+
 	echo "Please insert git tag to be used for the release: "
 	read version
 
@@ -68,7 +73,7 @@ function snapshot {
 	fi
 
 	echo "Executing goreleaser..."
-	goreleaser release --rm-dist --snapshot --skip-publish
+	goreleaser release --rm-dist --snapshot --skip-publish --skip-sign
 }
 
 function tag {
@@ -0,0 +1,228 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package sockopt tunes the TCP sockets of the upstream connections,
+// since cellular and satellite links benefit from a different tuning
+// than fiber. The options travel with the context used to dial the
+// connection, and they are applied by the sources. The timeouts they
+// define are instead enforced by the dialer.
+package sockopt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Options are TCP socket options. The zero value of each field keeps
+// the system default.
+type Options struct {
+	// NoDelay, if not nil, enables or disables TCP_NODELAY, which
+	// is enabled by default.
+	NoDelay *bool
+	// KeepAlive is the interval between keep-alive probes. If
+	// negative, keep-alives are disabled.
+	KeepAlive time.Duration
+	// Congestion is the congestion control algorithm, e.g. bbr or
+	// cubic. Supported on Linux only.
+	Congestion string
+	// SendBuffer and ReceiveBuffer are the sizes of the socket
+	// buffers, in bytes.
+	SendBuffer    int
+	ReceiveBuffer int
+	// Mark is the firewall mark of the sockets (SO_MARK), matched by
+	// the `ip rule ... fwmark` policy routing rules and by the
+	// nftables `meta mark` expressions. Supported on Linux only, it
+	// requires the CAP_NET_ADMIN capability.
+	Mark uint32
+
+	// DialTimeout is the maximum amount of time dialing a connection
+	// can take, including name resolution.
+	DialTimeout time.Duration
+	// IdleTimeout is the maximum amount of time a connection can stay
+	// open without transferring any data.
+	IdleTimeout time.Duration
+}
+
+type options struct {
+	NoDelay       *bool  `json:"no_delay,omitempty"`
+	KeepAlive     string `json:"keepalive,omitempty"`
+	Congestion    string `json:"congestion,omitempty"`
+	SendBuffer    int    `json:"send_buffer,omitempty"`
+	ReceiveBuffer int    `json:"receive_buffer,omitempty"`
+	Mark          uint32 `json:"mark,omitempty"`
+	DialTimeout   string `json:"dial_timeout,omitempty"`
+	IdleTimeout   string `json:"idle_timeout,omitempty"`
+}
+
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// MarshalJSON implements json.Marshaler. The durations are encoded
+// as strings, e.g. "30s".
+func (o Options) MarshalJSON() ([]byte, error) {
+	return json.Marshal(options{
+		NoDelay:       o.NoDelay,
+		KeepAlive:     formatDuration(o.KeepAlive),
+		Congestion:    o.Congestion,
+		SendBuffer:    o.SendBuffer,
+		ReceiveBuffer: o.ReceiveBuffer,
+		Mark:          o.Mark,
+		DialTimeout:   formatDuration(o.DialTimeout),
+		IdleTimeout:   formatDuration(o.IdleTimeout),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (o *Options) UnmarshalJSON(b []byte) error {
+	var v options
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*o = Options{
+		NoDelay:       v.NoDelay,
+		Congestion:    v.Congestion,
+		SendBuffer:    v.SendBuffer,
+		ReceiveBuffer: v.ReceiveBuffer,
+		Mark:          v.Mark,
+	}
+	var err error
+	if o.KeepAlive, err = parseDuration(v.KeepAlive); err != nil {
+		return err
+	}
+	if o.DialTimeout, err = parseDuration(v.DialTimeout); err != nil {
+		return err
+	}
+	if o.IdleTimeout, err = parseDuration(v.IdleTimeout); err != nil {
+		return err
+	}
+	return nil
+}
+
+// IsZero reports whether `o` keeps every system default.
+func (o Options) IsZero() bool {
+	return o == Options{}
+}
+
+// Override returns `o` with the fields set in `p` replacing its own.
+func (o Options) Override(p Options) Options {
+	if p.NoDelay != nil {
+		o.NoDelay = p.NoDelay
+	}
+	if p.KeepAlive != 0 {
+		o.KeepAlive = p.KeepAlive
+	}
+	if p.Congestion != "" {
+		o.Congestion = p.Congestion
+	}
+	if p.SendBuffer != 0 {
+		o.SendBuffer = p.SendBuffer
+	}
+	if p.ReceiveBuffer != 0 {
+		o.ReceiveBuffer = p.ReceiveBuffer
+	}
+	if p.Mark != 0 {
+		o.Mark = p.Mark
+	}
+	if p.DialTimeout != 0 {
+		o.DialTimeout = p.DialTimeout
+	}
+	if p.IdleTimeout != 0 {
+		o.IdleTimeout = p.IdleTimeout
+	}
+	return o
+}
+
+// Validate returns an error if `o` cannot be applied on this platform.
+func (o Options) Validate() error {
+	if o.SendBuffer < 0 || o.ReceiveBuffer < 0 {
+		return errors.New("sockopt: buffer sizes cannot be negative")
+	}
+	if o.DialTimeout < 0 || o.IdleTimeout < 0 {
+		return errors.New("sockopt: timeouts cannot be negative")
+	}
+	if o.Mark != 0 {
+		if err := validMark(); err != nil {
+			return err
+		}
+	}
+	if o.Congestion != "" {
+		return validCongestion(o.Congestion)
+	}
+	return nil
+}
+
+// Apply sets the options that Go sets itself once connected, i.e.
+// TCP_NODELAY and the keep-alives, on `conn`, if it is a TCP
+// connection.
+func (o Options) Apply(conn net.Conn) error {
+	tc, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	if o.NoDelay != nil {
+		if err := tc.SetNoDelay(*o.NoDelay); err != nil {
+			return err
+		}
+	}
+	switch {
+	case o.KeepAlive < 0:
+		return tc.SetKeepAlive(false)
+	case o.KeepAlive > 0:
+		if err := tc.SetKeepAlive(true); err != nil {
+			return err
+		}
+		return tc.SetKeepAlivePeriod(o.KeepAlive)
+	}
+	return nil
+}
+
+// ParseMark parses a firewall mark, either decimal, e.g. 16, or
+// hexadecimal, e.g. 0x10.
+func ParseMark(s string) (uint32, error) {
+	v, err := strconv.ParseUint(s, 0, 32)
+	if err != nil || v == 0 {
+		return 0, fmt.Errorf("sockopt: invalid firewall mark %q", s)
+	}
+	return uint32(v), nil
+}
+
+type optionsKey struct{}
+
+// WithOptions returns a copy of `ctx` that carries the options `o`.
+func WithOptions(ctx context.Context, o Options) context.Context {
+	return context.WithValue(ctx, optionsKey{}, o)
+}
+
+// FromContext returns the options stored in `ctx`, if any.
+func FromContext(ctx context.Context) (Options, bool) {
+	o, ok := ctx.Value(optionsKey{}).(Options)
+	return o, ok
+}
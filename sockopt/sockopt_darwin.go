@@ -0,0 +1,46 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sockopt
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// Control sets the buffer sizes on socket `fd`, before connecting.
+func (o Options) Control(fd uintptr) error {
+	if o.SendBuffer > 0 {
+		if err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_SNDBUF, o.SendBuffer); err != nil {
+			return fmt.Errorf("sockopt: send buffer: %v", err)
+		}
+	}
+	if o.ReceiveBuffer > 0 {
+		if err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RCVBUF, o.ReceiveBuffer); err != nil {
+			return fmt.Errorf("sockopt: receive buffer: %v", err)
+		}
+	}
+	return nil
+}
+
+func validMark() error {
+	return errors.New("sockopt: the firewall mark can only be set on Linux")
+}
+
+func validCongestion(name string) error {
+	return errors.New("sockopt: the congestion control algorithm can only be set on Linux")
+}
@@ -0,0 +1,77 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sockopt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Control sets the options that have to be set before connecting,
+// i.e. the congestion control algorithm, the buffer sizes and the
+// firewall mark, on socket `fd`.
+func (o Options) Control(fd uintptr) error {
+	if o.Mark != 0 {
+		if err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_MARK, int(o.Mark)); err != nil {
+			return fmt.Errorf("sockopt: mark %#x: %v", o.Mark, err)
+		}
+	}
+	if o.Congestion != "" {
+		if err := unix.SetsockoptString(int(fd), unix.IPPROTO_TCP, unix.TCP_CONGESTION, o.Congestion); err != nil {
+			return fmt.Errorf("sockopt: congestion %v: %v", o.Congestion, err)
+		}
+	}
+	return setBuffers(fd, o)
+}
+
+func setBuffers(fd uintptr, o Options) error {
+	if o.SendBuffer > 0 {
+		if err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_SNDBUF, o.SendBuffer); err != nil {
+			return fmt.Errorf("sockopt: send buffer: %v", err)
+		}
+	}
+	if o.ReceiveBuffer > 0 {
+		if err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RCVBUF, o.ReceiveBuffer); err != nil {
+			return fmt.Errorf("sockopt: receive buffer: %v", err)
+		}
+	}
+	return nil
+}
+
+// availableCongestion lists the congestion control algorithms loaded
+// by the kernel.
+const availableCongestion = "/proc/sys/net/ipv4/tcp_available_congestion_control"
+
+func validMark() error {
+	return nil
+}
+
+func validCongestion(name string) error {
+	b, err := ioutil.ReadFile(availableCongestion)
+	if err != nil {
+		// Let the kernel decide when the connections are dialed.
+		return nil
+	}
+	for _, v := range strings.Fields(string(b)) {
+		if v == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("sockopt: congestion control algorithm %q is not available, available ones are: %s", name, strings.TrimSpace(string(b)))
+}
@@ -0,0 +1,38 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sockopt
+
+import "errors"
+
+// Control is not supported on this platform: only the options set by
+// Apply are.
+func (o Options) Control(fd uintptr) error {
+	if o.SendBuffer > 0 || o.ReceiveBuffer > 0 {
+		return errors.New("sockopt: the buffer sizes cannot be set on this platform")
+	}
+	return nil
+}
+
+func validMark() error {
+	return errors.New("sockopt: the firewall mark can only be set on Linux")
+}
+
+func validCongestion(name string) error {
+	return errors.New("sockopt: the congestion control algorithm can only be set on Linux")
+}
@@ -0,0 +1,115 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sockopt_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/sockopt"
+)
+
+func TestOptions_JSON(t *testing.T) {
+	var o sockopt.Options
+	if err := json.Unmarshal([]byte(`{"no_delay":false,"keepalive":"30s","send_buffer":65536,"mark":16,"dial_timeout":"5s"}`), &o); err != nil {
+		t.Fatal(err)
+	}
+	if o.NoDelay == nil || *o.NoDelay || o.KeepAlive != 30*time.Second || o.SendBuffer != 65536 || o.Mark != 16 || o.DialTimeout != 5*time.Second {
+		t.Fatalf("Unexpected options: %+v", o)
+	}
+	b, err := json.Marshal(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != `{"no_delay":false,"keepalive":"30s","send_buffer":65536,"mark":16,"dial_timeout":"5s"}` {
+		t.Fatalf("Unexpected encoding: %s", s)
+	}
+	if err := json.Unmarshal([]byte(`{"keepalive":"soon"}`), &o); err == nil {
+		t.Fatalf("An invalid keepalive was accepted")
+	}
+}
+
+func TestOptions_Validate(t *testing.T) {
+	if err := (sockopt.Options{ReceiveBuffer: -1}).Validate(); err == nil {
+		t.Fatalf("A negative buffer size was accepted")
+	}
+	if !(sockopt.Options{}).IsZero() {
+		t.Fatalf("The zero options should keep the system defaults")
+	}
+}
+
+func TestParseMark(t *testing.T) {
+	for in, out := range map[string]uint32{"16": 16, "0x10": 16, "0xffffffff": 0xffffffff} {
+		if v, err := sockopt.ParseMark(in); err != nil || v != out {
+			t.Fatalf("%s: wanted %#x, found %#x, %v", in, out, v, err)
+		}
+	}
+	for _, in := range []string{"0", "-1", "0x100000000", "mark"} {
+		if _, err := sockopt.ParseMark(in); err == nil {
+			t.Fatalf("%s: expected an error", in)
+		}
+	}
+}
+
+func TestOptions_Override(t *testing.T) {
+	def := sockopt.Options{KeepAlive: time.Minute, DialTimeout: time.Second * 10, IdleTimeout: time.Hour}
+	o := def.Override(sockopt.Options{DialTimeout: time.Second, Congestion: "bbr"})
+	want := sockopt.Options{KeepAlive: time.Minute, DialTimeout: time.Second, IdleTimeout: time.Hour, Congestion: "bbr"}
+	if o != want {
+		t.Fatalf("Unexpected options: wanted %+v, found %+v", want, o)
+	}
+	if err := (sockopt.Options{IdleTimeout: -1}).Validate(); err == nil {
+		t.Fatalf("A negative timeout was accepted")
+	}
+}
+
+func TestApply(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	conn, err := net.Dial("tcp4", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	off := false
+	if err := (sockopt.Options{NoDelay: &off, KeepAlive: time.Minute}).Apply(conn); err != nil {
+		t.Fatal(err)
+	}
+	p1, p2 := net.Pipe()
+	defer p1.Close()
+	defer p2.Close()
+	if err := (sockopt.Options{KeepAlive: -1}).Apply(p1); err != nil {
+		t.Fatalf("Options should be ignored on non TCP connections: %v", err)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if _, ok := sockopt.FromContext(context.Background()); ok {
+		t.Fatalf("Unexpected options in an empty context")
+	}
+	ctx := sockopt.WithOptions(context.Background(), sockopt.Options{Congestion: "bbr"})
+	if o, ok := sockopt.FromContext(ctx); !ok || o.Congestion != "bbr" {
+		t.Fatalf("Unexpected options: %+v", o)
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package socks implements a SOCKS5 proxy, RFC 1928, limited to the
+// CONNECT command of the clients that require no authentication,
+// which dials the destinations of its clients through booster.
+package socks
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/booster-proj/booster/acl"
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/proxyproto"
+	"github.com/booster-proj/booster/relay"
+	"github.com/booster-proj/booster/schedule"
+)
+
+// HandshakeTimeout is the maximum amount of time a client has to
+// send its request.
+const HandshakeTimeout = time.Second * 10
+
+const (
+	version5 = 0x05
+
+	methodNone         = 0x00
+	methodNoAcceptable = 0xff
+
+	cmdConnect = 0x01
+
+	atypIPv4   = 0x01
+	atypDomain = 0x03
+	atypIPv6   = 0x04
+
+	repSucceeded           = 0x00
+	repFailure             = 0x01
+	repNotAllowed          = 0x02
+	repCmdNotSupported     = 0x07
+	repAddrTypeUnsupported = 0x08
+)
+
+// Proxy is a SOCKS5 proxy.
+type Proxy struct {
+	// Dialer dials the destinations requested, e.g. the booster
+	// dialer.
+	Dialer core.Dialer
+	// Buffers, if not nil, provides the buffers of the copies.
+	Buffers *relay.Pool
+	// If ACL is not nil, the requests of the clients it does not
+	// allow are refused.
+	ACL *acl.List
+	// If Schedules is not nil, the requests of the clients it
+	// denies at the time are refused.
+	Schedules *schedule.Schedules
+	// ProxyProtocol are the networks of the load balancers allowed
+	// to send a PROXY protocol header, whose client is then checked
+	// and dialed for in place of the load balancer.
+	ProxyProtocol []*net.IPNet
+}
+
+// Protocol returns the name of the protocol served.
+func (p *Proxy) Protocol() string {
+	return "socks5"
+}
+
+// ListenAndServe serves the proxy on `port`, until the context is
+// canceled.
+func (p *Proxy) ListenAndServe(ctx context.Context, port int) error {
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+	return p.Serve(ctx, ln)
+}
+
+// Serve serves the proxy on the connections accepted by `ln`, until
+// the context is canceled.
+func (p *Proxy) Serve(ctx context.Context, ln net.Listener) error {
+	return p.ServeTLS(ctx, ln, nil)
+}
+
+// ServeTLS is Serve over TLS, with `conf`, if not nil. The PROXY
+// protocol headers precede the TLS handshake.
+func (p *Proxy) ServeTLS(ctx context.Context, ln net.Listener, conf *tls.Config) error {
+	if len(p.ProxyProtocol) > 0 {
+		ln = &proxyproto.Listener{Listener: ln, Trusted: p.ProxyProtocol}
+	}
+	if conf != nil {
+		ln = tls.NewListener(ln, conf)
+	}
+	return p.forwarder().Serve(ctx, ln)
+}
+
+// Handle serves the proxy on `conn`, e.g. accepted by a tunnel, until
+// it is done or the context is canceled. The caller closes `conn`.
+func (p *Proxy) Handle(ctx context.Context, conn net.Conn) {
+	p.forwarder().Forward(ctx, conn)
+}
+
+func (p *Proxy) forwarder() *relay.Forwarder {
+	return &relay.Forwarder{Buffers: p.Buffers, Dial: p.dial}
+}
+
+// dial performs the handshake with the client of `conn` and dials
+// the destination it requests.
+func (p *Proxy) dial(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	conn.SetDeadline(time.Now().Add(HandshakeTimeout))
+	address, err := handshake(conn)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	client := conn.RemoteAddr().String()
+	if p.ACL != nil && !p.ACL.AllowedAddr(client) {
+		reply(conn, repNotAllowed, nil)
+		return nil, fmt.Errorf("client %v not allowed", client)
+	}
+	if p.Schedules != nil {
+		if rule, ok := p.Schedules.DeniedAddr(client, time.Now()); ok {
+			reply(conn, repNotAllowed, nil)
+			return nil, fmt.Errorf("client %v not allowed at this time, denied by schedule %v", client, rule.ID)
+		}
+	}
+	ctx = proxyproto.WithClient(ctx, conn.RemoteAddr(), conn.LocalAddr())
+	upstream, err := p.Dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		reply(conn, repFailure, nil)
+		return nil, err
+	}
+	if err := reply(conn, repSucceeded, upstream.LocalAddr()); err != nil {
+		upstream.Close()
+		return nil, err
+	}
+	return upstream, nil
+}
+
+// handshake negotiates the authentication method with the client of
+// `conn` and reads its request, returning the destination requested.
+// The unsupported requests are replied with an error.
+func handshake(conn net.Conn) (string, error) {
+	buf := make([]byte, 255)
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return "", err
+	}
+	if buf[0] != version5 {
+		return "", fmt.Errorf("unsupported SOCKS version %d", buf[0])
+	}
+	methods := buf[:buf[1]]
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+	method := byte(methodNoAcceptable)
+	for _, v := range methods {
+		if v == methodNone {
+			method = methodNone
+		}
+	}
+	if _, err := conn.Write([]byte{version5, method}); err != nil {
+		return "", err
+	}
+	if method == methodNoAcceptable {
+		return "", errors.New("the client requires authentication")
+	}
+
+	if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+		return "", err
+	}
+	if buf[0] != version5 {
+		return "", fmt.Errorf("unsupported SOCKS version %d", buf[0])
+	}
+	cmd, atyp := buf[1], buf[3]
+	var host string
+	switch atyp {
+	case atypIPv4, atypIPv6:
+		n := net.IPv4len
+		if atyp == atypIPv6 {
+			n = net.IPv6len
+		}
+		ip := make(net.IP, n)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = ip.String()
+	case atypDomain:
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return "", err
+		}
+		name := buf[:buf[0]]
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return "", err
+		}
+		host = string(name)
+	default:
+		reply(conn, repAddrTypeUnsupported, nil)
+		return "", fmt.Errorf("unsupported address type %d", atyp)
+	}
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return "", err
+	}
+	port := binary.BigEndian.Uint16(buf[:2])
+	if cmd != cmdConnect {
+		reply(conn, repCmdNotSupported, nil)
+		return "", fmt.Errorf("unsupported command %d", cmd)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), nil
+}
+
+// reply writes the reply `rep` to a request, with the address bound,
+// if known.
+func reply(conn net.Conn, rep byte, bound net.Addr) error {
+	ip, port := net.IPv4zero.To4(), 0
+	if addr, ok := bound.(*net.TCPAddr); ok && addr.IP != nil {
+		ip, port = addr.IP, addr.Port
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+	}
+	atyp := byte(atypIPv4)
+	if len(ip) == net.IPv6len {
+		atyp = atypIPv6
+	}
+	b := append([]byte{version5, rep, 0x00, atyp}, ip...)
+	b = append(b, byte(port>>8), byte(port))
+	_, err := conn.Write(b)
+	return err
+}
@@ -0,0 +1,214 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package socks_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/acl"
+	"github.com/booster-proj/booster/proxyproto"
+	"github.com/booster-proj/booster/schedule"
+	"github.com/booster-proj/booster/socks"
+)
+
+// echoDialer connects every destination to an echo server, recording
+// the destination and the client of the last connection.
+type echoDialer struct {
+	sync.Mutex
+	address string
+	client  net.Addr
+}
+
+func (d *echoDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.Lock()
+	d.address = address
+	d.client, _, _ = proxyproto.ClientFromContext(ctx)
+	d.Unlock()
+	c0, c1 := net.Pipe()
+	go func() {
+		defer c1.Close()
+		io.Copy(c1, c1)
+	}()
+	return c0, nil
+}
+
+// serve serves `p` on a local port, returning its address.
+func serve(t *testing.T, p *socks.Proxy) (string, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Serve(ctx, ln)
+	}()
+	return ln.Addr().String(), func() {
+		cancel()
+		<-done
+	}
+}
+
+// request performs the handshake of `req` with the proxy at `addr`,
+// returning the connection and the reply code.
+func request(t *testing.T, addr string, methods, req []byte) (net.Conn, byte) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(time.Second * 5))
+	conn.Write(methods)
+	b := make([]byte, 2)
+	if _, err := io.ReadFull(conn, b); err != nil {
+		t.Fatal(err)
+	}
+	if b[1] != 0x00 {
+		return conn, b[1]
+	}
+	conn.Write(req)
+	b = make([]byte, 10)
+	if _, err := io.ReadFull(conn, b); err != nil {
+		t.Fatal(err)
+	}
+	return conn, b[1]
+}
+
+var (
+	noAuth  = []byte{0x05, 0x01, 0x00}
+	connect = append([]byte{0x05, 0x01, 0x00, 0x03, 11}, append([]byte("example.com"), 0x01, 0xbb)...)
+)
+
+func TestProxy(t *testing.T) {
+	d := new(echoDialer)
+	addr, stop := serve(t, &socks.Proxy{Dialer: d})
+	defer stop()
+
+	conn, rep := request(t, addr, noAuth, connect)
+	defer conn.Close()
+	if rep != 0x00 {
+		t.Fatalf("Unexpected reply: %#x", rep)
+	}
+	d.Lock()
+	defer d.Unlock()
+	if d.address != "example.com:443" {
+		t.Fatalf("Unexpected destination: %v", d.address)
+	}
+	if d.client == nil || d.client.String() != conn.LocalAddr().String() {
+		t.Fatalf("Unexpected client: %v, wanted %v", d.client, conn.LocalAddr())
+	}
+
+	conn.Write([]byte("ping"))
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(conn, b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, []byte("ping")) {
+		t.Fatalf("Unexpected data: %q", b)
+	}
+}
+
+func TestProxy_refused(t *testing.T) {
+	l, err := acl.New(acl.Rules{Deny: []string{"127.0.0.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := new(echoDialer)
+	addr, stop := serve(t, &socks.Proxy{Dialer: d, ACL: l})
+	defer stop()
+
+	for i, tt := range []struct {
+		methods, req []byte
+		rep          byte
+	}{
+		{noAuth, connect, 0x02},
+		// Username and password only.
+		{[]byte{0x05, 0x01, 0x02}, nil, 0xff},
+		// BIND.
+		{noAuth, []byte{0x05, 0x02, 0x00, 0x01, 10, 0, 0, 1, 0, 80}, 0x07},
+		{noAuth, []byte{0x05, 0x01, 0x00, 0x05, 10, 0, 0, 1, 0, 80}, 0x08},
+	} {
+		conn, rep := request(t, addr, tt.methods, tt.req)
+		conn.Close()
+		if rep != tt.rep {
+			t.Fatalf("%d: Unexpected reply %#x, wanted %#x", i, rep, tt.rep)
+		}
+	}
+	d.Lock()
+	defer d.Unlock()
+	if d.address != "" {
+		t.Fatalf("No destination should have been dialed, found %v", d.address)
+	}
+}
+
+func TestProxy_schedules(t *testing.T) {
+	s := &schedule.Schedules{}
+	if err := s.Put(schedule.Rule{ID: "always", Clients: []string{"127.0.0.0/8"}, Deny: []schedule.Window{{From: "00:00", To: "00:00"}}}); err != nil {
+		t.Fatal(err)
+	}
+	d := new(echoDialer)
+	addr, stop := serve(t, &socks.Proxy{Dialer: d, Schedules: s})
+	defer stop()
+
+	conn, rep := request(t, addr, noAuth, connect)
+	conn.Close()
+	if rep != 0x02 {
+		t.Fatalf("Unexpected reply %#x, the client should be denied by the schedule", rep)
+	}
+
+	if err := s.Del("always"); err != nil {
+		t.Fatal(err)
+	}
+	conn, rep = request(t, addr, noAuth, connect)
+	conn.Close()
+	if rep != 0x00 {
+		t.Fatalf("Unexpected reply %#x once the schedule is removed", rep)
+	}
+}
+
+func TestProxy_proxyProtocol(t *testing.T) {
+	trusted, err := acl.ParseNetworks([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := acl.New(acl.Rules{Deny: []string{"127.0.0.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := new(echoDialer)
+	addr, stop := serve(t, &socks.Proxy{Dialer: d, ACL: l, ProxyProtocol: trusted})
+	defer stop()
+
+	// The client announced by the load balancer is checked in place
+	// of the load balancer itself.
+	header := []byte("PROXY TCP4 10.1.2.3 127.0.0.1 4321 1080\r\n")
+	conn, rep := request(t, addr, append(header, noAuth...), connect)
+	defer conn.Close()
+	if rep != 0x00 {
+		t.Fatalf("Unexpected reply: %#x", rep)
+	}
+	d.Lock()
+	defer d.Unlock()
+	if d.client == nil || d.client.String() != "10.1.2.3:4321" {
+		t.Fatalf("Unexpected client: %v", d.client)
+	}
+}
@@ -103,6 +103,26 @@ func (c *Conn) Write(p []byte) (int, error) {
 	return n, err
 }
 
+// Unwrap returns the underlying net.Conn. It implements relay.Wrapper.
+func (c *Conn) Unwrap() net.Conn {
+	return c.Conn
+}
+
+// Relayed reports the data transferred by the relay directly through
+// the underlying net.Conn using the OnRead and OnWrite callbacks. It
+// implements relay.Wrapper.
+func (c *Conn) Relayed(n int, write bool) {
+	df, f := &DataFlow{Type: "read"}, c.OnRead
+	if write {
+		df, f = &DataFlow{Type: "write"}, c.OnWrite
+	}
+	df.Start()
+	df.Stop(n)
+	if f != nil {
+		f(df)
+	}
+}
+
 // Close closes the underlying net.Conn, calling the OnClose callback
 // afterwards.
 func (c *Conn) Close() error {
@@ -0,0 +1,69 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package source
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultSysFS is where the sysfs is usually mounted.
+const DefaultSysFS = "/sys"
+
+// InContainer reports whether booster is running in a container, e.g.
+// Docker, Podman or a Kubernetes pod.
+func InContainer() bool {
+	for _, v := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(v); err == nil {
+			return true
+		}
+	}
+	b, err := ioutil.ReadFile("/proc/1/cgroup")
+	if err != nil {
+		return false
+	}
+	for _, v := range []string{"docker", "kubepods", "containerd", "libpod"} {
+		if bytes.Contains(b, []byte(v)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPhysical returns a check failing for the interfaces that, according
+// to the sysfs mounted at `sysfs`, are virtual, i.e. have no backing
+// device, or whose operational state is down.
+func isPhysical(sysfs string) check {
+	return func(ctx context.Context, ifi *Interface) error {
+		dir := filepath.Join(sysfs, "class", "net", ifi.ID())
+		if _, err := os.Stat(dir); err != nil {
+			return fmt.Errorf("interface %s is not in %s: %v", ifi.ID(), sysfs, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "device")); err != nil {
+			return fmt.Errorf("interface %s is virtual", ifi.ID())
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, "operstate"))
+		if err == nil && strings.TrimSpace(string(b)) == "down" {
+			return fmt.Errorf("interface %s is down", ifi.ID())
+		}
+		return nil
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package source
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsPhysical(t *testing.T) {
+	sysfs, err := ioutil.TempDir("", "booster-sysfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(sysfs)
+
+	iface := func(name, operstate string, device bool) {
+		dir := filepath.Join(sysfs, "class", "net", name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if device {
+			os.Mkdir(filepath.Join(dir, "device"), 0755)
+		}
+		ioutil.WriteFile(filepath.Join(dir, "operstate"), []byte(operstate+"\n"), 0644)
+	}
+	iface("eth0", "up", true)
+	iface("wwan0", "unknown", true)
+	iface("eth1", "down", true)
+	iface("docker0", "up", false)
+
+	check := isPhysical(sysfs)
+	tt := []struct {
+		name string
+		ok   bool
+	}{
+		{"eth0", true},
+		{"wwan0", true},
+		{"eth1", false},
+		{"docker0", false},
+		{"veth0", false},
+	}
+	for _, v := range tt {
+		err := check(context.Background(), &Interface{ifi: net.Interface{Name: v.name}})
+		if ok := err == nil; ok != v.ok {
+			t.Fatalf("%s: wanted physical %v, found error %v", v.name, v.ok, err)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package source
+
+import (
+	"context"
+	"net"
+
+	"github.com/booster-proj/booster/core"
+)
+
+// Custom wraps a source contributed by a core.SourceProvider, collecting
+// for the connections it dials the same metrics collected for the
+// network interfaces.
+type Custom struct {
+	core.Source
+
+	// Provider is the name the provider of the source is
+	// registered with.
+	Provider string
+
+	// If OnDialErr is not nil, it is called each time that the
+	// source is not able to create a network connection.
+	OnDialErr DialHook
+
+	meter
+}
+
+// DialContext dials the connection through the wrapped source,
+// following it as Interface.Follow does.
+func (c *Custom) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := c.Source.DialContext(ctx, network, address)
+	if err != nil {
+		if f := c.OnDialErr; f != nil {
+			f(c.ID(), network, address, err)
+		}
+		return nil, err
+	}
+	return c.follow(c.ID(), conn), nil
+}
+
+// Close closes the open connections and the wrapped source.
+func (c *Custom) Close() error {
+	if c.conns != nil {
+		c.conns.Close()
+	}
+	return c.Source.Close()
+}
+
+// Metered reports whether the wrapped source is metered, if it is
+// able to tell.
+func (c *Custom) Metered() bool {
+	if m, ok := c.Source.(interface{ Metered() bool }); ok {
+		return m.Metered()
+	}
+	return false
+}
+
+func (c *Custom) String() string {
+	return c.ID()
+}
@@ -0,0 +1,134 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package source_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/source"
+)
+
+type modem struct {
+	id string
+}
+
+func (s *modem) ID() string {
+	return s.id
+}
+
+func (s *modem) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, _ := net.Pipe()
+	return conn, nil
+}
+
+func (s *modem) Close() error {
+	return nil
+}
+
+func (s *modem) Metered() bool {
+	return true
+}
+
+type modemProvider struct{}
+
+func (p modemProvider) Provide(ctx context.Context) ([]core.Source, error) {
+	return []core.Source{&modem{id: "sat0"}}, nil
+}
+
+func (p modemProvider) Check(ctx context.Context, src core.Source) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if _, ok := src.(*modem); !ok {
+		return fmt.Errorf("unexpected source %v", src)
+	}
+	return nil
+}
+
+func init() {
+	core.RegisterSourceProvider("modem", modemProvider{})
+}
+
+type exporter struct {
+	sync.Mutex
+	open map[string]int
+}
+
+func (e *exporter) SendDataFlow(labels map[string]string, data *source.DataFlow) {}
+func (e *exporter) AddLatency(labels map[string]string, d time.Duration)         {}
+func (e *exporter) CountPort(labels map[string]string, inc int)                  {}
+
+func (e *exporter) CountOpenConn(labels map[string]string, inc int) {
+	e.Lock()
+	defer e.Unlock()
+	e.open[labels["source"]] += inc
+}
+
+func TestProvide_custom(t *testing.T) {
+	exp := &exporter{open: make(map[string]int)}
+	p := &source.MergedProvider{
+		ControlCustom: func(c *source.Custom) {
+			c.SetMetricsExporter(exp)
+		},
+	}
+	srcs, err := p.Provide(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var c *source.Custom
+	for _, v := range srcs {
+		if v.ID() == "sat0" {
+			c, _ = v.(*source.Custom)
+		}
+	}
+	if c == nil {
+		t.Fatalf("Custom source not found in %v", srcs)
+	}
+	if c.Provider != "modem" {
+		t.Fatalf("Unexpected provider: wanted modem, found %s", c.Provider)
+	}
+	if !c.Metered() {
+		t.Fatalf("Custom source should report itself as metered")
+	}
+	if err := p.Check(context.Background(), c, source.High); err != nil {
+		t.Fatalf("Unexpected check error: %v", err)
+	}
+
+	conn, err := c.DialContext(context.Background(), "tcp", "example.com:80")
+	if err != nil {
+		t.Fatalf("Unexpected dial error: %v", err)
+	}
+	if n := c.Len(); n != 1 {
+		t.Fatalf("Unexpected Len: wanted 1, found %d", n)
+	}
+	exp.Lock()
+	if n := exp.open["sat0"]; n != 1 {
+		t.Fatalf("Unexpected open connections metric: wanted 1, found %d", n)
+	}
+	exp.Unlock()
+
+	conn.Close()
+	if n := c.Len(); n != 0 {
+		t.Fatalf("Unexpected Len: wanted 0, found %d", n)
+	}
+}
@@ -1,3 +1,4 @@
+//go:build darwin
 // +build darwin
 
 // Copyright © 2019 KIM KeepInMind GmbH/srl
@@ -64,12 +65,16 @@ func (i *Interface) dialContext(ctx context.Context, network, address string) (n
 
 	d := &net.Dialer{
 		Control: func(network, address string, c syscall.RawConn) error {
+			connecting(ctx, address)
 			return c.Control(func(fd uintptr) {
 				if err := unix.Bind(int(fd), addr); err != nil {
 					log.Debug.Printf("dialContext_unix error: unable to bind to interface %v: %v", i.ID(), err)
 				}
+				mark(ctx, network, fd)
+				tune(ctx, fd)
 			})
 		},
+		Resolver: i.resolver(),
 	}
 
 	return d.DialContext(ctx, network, address)
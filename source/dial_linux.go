@@ -1,3 +1,4 @@
+//go:build linux
 // +build linux
 
 // Copyright © 2019 KIM KeepInMind GmbH/srl
@@ -19,7 +20,9 @@ package source
 
 import (
 	"context"
+	"fmt"
 	"net"
+	"strings"
 	"syscall"
 
 	"golang.org/x/sys/unix"
@@ -27,15 +30,82 @@ import (
 )
 
 func (i *Interface) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	// A socket bound to the device cannot open subflows through the
+	// other interfaces: MPTCP connections are bound to the interface
+	// address instead, as the ones of the interfaces configured with
+	// BindAddress.
+	mptcp := i.MultipathTCP && strings.HasPrefix(network, "tcp")
+	bindAddr := mptcp || i.BindAddress
 	d := &net.Dialer{
 		Control: func(network, address string, c syscall.RawConn) error {
+			connecting(ctx, address)
 			return c.Control(func(fd uintptr) {
-				if err := unix.BindToDevice(int(fd), i.ID()); err != nil {
-					log.Debug.Printf("dialContext_linux error: unable to bind to interface %v: %v", i.ID(), err)
+				if !bindAddr {
+					if err := unix.BindToDevice(int(fd), i.ID()); err != nil {
+						log.Debug.Printf("dialContext_linux error: unable to bind to interface %v: %v", i.ID(), err)
+					}
 				}
+				mark(ctx, network, fd)
+				tune(ctx, fd)
 			})
 		},
+		Resolver: i.resolver(),
+	}
+	if mptcp {
+		// If the kernel does not support MPTCP, the dialer falls
+		// back to plain TCP.
+		d.SetMultipathTCP(true)
+	}
+	if bindAddr {
+		addrs, err := i.ifi.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		laddr := localAddr(addrs, network)
+		if laddr == nil {
+			return nil, fmt.Errorf("interface %s has no address to dial %s connections from", i.ID(), network)
+		}
+		d.LocalAddr = laddr
+		if strings.HasPrefix(network, "udp") {
+			d.LocalAddr = &net.UDPAddr{IP: laddr.IP}
+		}
 	}
 
 	return d.DialContext(ctx, network, address)
 }
+
+// localAddr returns the TCP address, from `addrs`, that the
+// connections of `network` are dialed from: the first IPv4 address,
+// unless `network` is tcp6 or the interface only has IPv6 addresses.
+// Link local addresses are ignored. The same applies to the udp
+// networks. Returns nil if no address is
+// suitable.
+func localAddr(addrs []net.Addr, network string) *net.TCPAddr {
+	var ip4, ip6 net.IP
+	for _, v := range addrs {
+		ip, _, err := net.ParseCIDR(v.String())
+		if err != nil || ip.IsLinkLocalUnicast() {
+			continue
+		}
+		if ip.To4() != nil {
+			if ip4 == nil {
+				ip4 = ip
+			}
+		} else if ip6 == nil {
+			ip6 = ip
+		}
+	}
+	switch network {
+	case "tcp4", "udp4":
+		ip6 = nil
+	case "tcp6", "udp6":
+		ip4 = nil
+	}
+	if ip4 != nil {
+		return &net.TCPAddr{IP: ip4}
+	}
+	if ip6 != nil {
+		return &net.TCPAddr{IP: ip6}
+	}
+	return nil
+}
@@ -1,3 +1,4 @@
+//go:build windows
 // +build windows
 
 // Copyright © 2019 KIM KeepInMind GmbH/srl
@@ -31,6 +32,7 @@ func (i *Interface) dialContext(ctx context.Context, network, address string) (n
 	d := &net.Dialer{
 		// TODO: add windows implementation
 		Control: func(network, address string, c syscall.RawConn) error {
+			connecting(ctx, address)
 			return errors.New("dialContext: Control not yet implemented on Windows")
 		},
 	}
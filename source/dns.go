@@ -0,0 +1,175 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package source
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"upspin.io/log"
+)
+
+// DNSRefresh is the interval after which the DNS servers discovered
+// for an interface are discovered again, as they change with its
+// DHCP leases.
+var DNSRefresh = time.Minute
+
+// interfaceDNS are the DNS servers of an interface, and the resolver
+// querying them through it.
+type interfaceDNS struct {
+	sync.Mutex
+	servers  []string
+	resolver *net.Resolver
+	expires  time.Time
+	// system is the resolver used when the servers are not known.
+	system *net.Resolver
+}
+
+// resolver returns the resolver of the host names dialed through the
+// interface, which queries its DNS servers through it, so that the
+// queries do not leak through the other links and the answers match
+// the network of the interface. Returns nil, i.e. the system resolver
+// is used, if its DNS servers are not known.
+func (i *Interface) resolver() *net.Resolver {
+	i.dns.Lock()
+	defer i.dns.Unlock()
+
+	if len(i.DNS) == 0 && !i.DiscoverDNS {
+		return i.systemResolver()
+	}
+	if i.dns.resolver != nil && (len(i.DNS) > 0 || time.Now().Before(i.dns.expires)) {
+		return i.dns.resolver
+	}
+
+	servers := i.DNS
+	if len(servers) == 0 {
+		var err error
+		if servers, err = discoverDNS(i.ID()); err != nil {
+			log.Debug.Printf("Interface %s: unable to discover its DNS servers: %v", i.ID(), err)
+		}
+		i.dns.expires = time.Now().Add(DNSRefresh)
+	}
+	if !equalStrings(servers, i.dns.servers) || i.dns.resolver == nil {
+		i.dns.servers = servers
+		i.dns.resolver = i.newResolver(servers)
+	}
+	if i.dns.resolver == nil {
+		return i.systemResolver()
+	}
+	return i.dns.resolver
+}
+
+// systemResolver returns the resolver used when the DNS servers of the
+// interface are not known: the system one, going through DNSCache if
+// set, and applying ECS. Call it with the lock held.
+func (i *Interface) systemResolver() *net.Resolver {
+	if i.DNSCache == nil && !i.ECS.Enabled() {
+		return nil
+	}
+	if i.dns.system != nil {
+		return i.dns.system
+	}
+	var d net.Dialer
+	dial := withECS(i.ECS, d.DialContext)
+	switch {
+	case i.DNSCache == nil:
+		i.dns.system = &net.Resolver{PreferGo: true, Dial: dial}
+	case i.ECS.Enabled():
+		// The answers depend on the client subnet announced.
+		i.dns.system = i.DNSCache.Resolver(i.ID(), dial)
+	default:
+		i.dns.system = i.DNSCache.Resolver("", dial)
+	}
+	return i.dns.system
+}
+
+// DNSServers returns the DNS servers the host names dialed through
+// the interface are resolved with. If empty, the system resolver is
+// used.
+func (i *Interface) DNSServers() []string {
+	if i.resolver() == nil {
+		return nil
+	}
+	i.dns.Lock()
+	defer i.dns.Unlock()
+	if len(i.DNS) == 0 && !i.DiscoverDNS {
+		return nil
+	}
+	return append([]string(nil), i.dns.servers...)
+}
+
+// newResolver returns a resolver that queries `servers`, in turn,
+// through the interface, or nil if `servers` is empty. The answers are
+// cached into DNSCache, if set, apart from the ones of the other
+// interfaces.
+func (i *Interface) newResolver(servers []string) *net.Resolver {
+	if len(servers) == 0 {
+		return nil
+	}
+	var next uint32
+	dial := withECS(i.ECS, func(ctx context.Context, network, address string) (net.Conn, error) {
+		server := servers[int(atomic.AddUint32(&next, 1)-1)%len(servers)]
+		// The resolution ends when the connection dialing
+		// the address resolved starts, not this one.
+		ctx = context.WithValue(ctx, resolvedKey{}, nil)
+		return i.dialContext(ctx, network, net.JoinHostPort(server, "53"))
+	})
+	if i.DNSCache != nil {
+		return i.DNSCache.Resolver(i.ID(), dial)
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial:     dial,
+	}
+}
+
+// parseServers returns the IP addresses found in `out`, the output of
+// a command listing DNS servers, in order and without duplicates.
+// IPv6 addresses may carry a zone, e.g. fe80::1%wlan0.
+func parseServers(out string) []string {
+	var acc []string
+	seen := make(map[string]bool)
+	for _, v := range strings.FieldsFunc(out, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == '|' || r == ','
+	}) {
+		ip := v
+		if i := strings.IndexByte(v, '%'); i >= 0 {
+			ip = v[:i]
+		}
+		if net.ParseIP(ip) == nil || seen[v] {
+			continue
+		}
+		seen[v] = true
+		acc = append(acc, v)
+	}
+	return acc
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
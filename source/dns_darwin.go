@@ -0,0 +1,69 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"strings"
+)
+
+// discoverDNS returns the DNS servers of interface `name`, as they are
+// listed by `scutil --dns`.
+func discoverDNS(name string) ([]string, error) {
+	out, err := exec.Command("scutil", "--dns").Output()
+	if err != nil {
+		return nil, err
+	}
+	return scutilServers(out, name), nil
+}
+
+// scutilServers returns the nameservers of the resolvers listed in
+// `out`, the output of `scutil --dns`, that are bound to interface
+// `name`. Resolvers look like:
+//
+//	resolver #1
+//	  nameserver[0] : 192.168.1.1
+//	  if_index : 6 (en0)
+func scutilServers(out []byte, name string) []string {
+	var acc, servers []string
+	var ifi string
+	flush := func() {
+		if ifi == name {
+			acc = append(acc, servers...)
+		}
+		servers, ifi = nil, ""
+	}
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case strings.HasPrefix(line, "resolver #"):
+			flush()
+		case strings.HasPrefix(line, "nameserver["):
+			if i := strings.Index(line, ":"); i >= 0 {
+				servers = append(servers, strings.TrimSpace(line[i+1:]))
+			}
+		case strings.HasPrefix(line, "if_index"):
+			if i, j := strings.Index(line, "("), strings.Index(line, ")"); i >= 0 && j > i {
+				ifi = line[i+1 : j]
+			}
+		}
+	}
+	flush()
+	return parseServers(strings.Join(acc, " "))
+}
@@ -0,0 +1,43 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package source
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+)
+
+// discoverDNS returns the DNS servers of interface `name`, as they are
+// known to systemd-resolved or, if it is not running, to
+// NetworkManager.
+func discoverDNS(name string) ([]string, error) {
+	out, err := exec.Command("resolvectl", "dns", name).Output()
+	if err == nil {
+		// The output looks like `Link 3 (wlan0): 192.168.1.1`.
+		if i := bytes.IndexByte(out, ':'); i >= 0 {
+			out = out[i+1:]
+		}
+		if servers := parseServers(string(out)); len(servers) > 0 {
+			return servers, nil
+		}
+	}
+	out, err = exec.Command("nmcli", "-t", "-g", "IP4.DNS,IP6.DNS", "device", "show", name).Output()
+	if err != nil {
+		return nil, fmt.Errorf("neither systemd-resolved nor NetworkManager know the DNS servers of %s: %v", name, err)
+	}
+	return parseServers(string(out)), nil
+}
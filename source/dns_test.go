@@ -0,0 +1,51 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package source
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseServers(t *testing.T) {
+	tt := []struct {
+		out  string
+		want []string
+	}{
+		{"192.168.1.1 fe80::1%wlan0\n", []string{"192.168.1.1", "fe80::1%wlan0"}},
+		{"10.0.0.1 | 10.0.0.2\n2001:db8::1\n10.0.0.1\n", []string{"10.0.0.1", "10.0.0.2", "2001:db8::1"}},
+		{"Link 3 (wlan0)", nil},
+	}
+	for i, v := range tt {
+		if servers := parseServers(v.out); !reflect.DeepEqual(servers, v.want) {
+			t.Fatalf("%d: Unexpected servers: wanted %v, found %v", i, v.want, servers)
+		}
+	}
+}
+
+func TestInterface_DNSServers(t *testing.T) {
+	ifi := &Interface{}
+	if servers := ifi.DNSServers(); len(servers) != 0 {
+		t.Fatalf("Unexpected servers: %v", servers)
+	}
+	ifi.DNS = []string{"10.0.0.1"}
+	if servers := ifi.DNSServers(); !reflect.DeepEqual(servers, ifi.DNS) {
+		t.Fatalf("Unexpected servers: %v", servers)
+	}
+	if ifi.resolver() == nil || ifi.resolver() != ifi.resolver() {
+		t.Fatalf("The resolver should be kept")
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package source
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// optionECS is the code of the EDNS Client Subnet option, RFC 7871.
+const optionECS = 8
+
+// ednsSize is the UDP payload size announced by the OPT records added
+// to the queries.
+const ednsSize = 1232
+
+// ECS describes how the EDNS Client Subnet option of the DNS queries
+// sent through a source is handled. CDNs use it to pick the servers
+// closest to the client: setting it to a subnet of the exit network of
+// the source, or stripping it, keeps their answers appropriate for the
+// location the connections actually leave from.
+type ECS struct {
+	// Strip removes the option from the queries.
+	Strip bool
+	// Subnet, if set, is announced as the subnet of the client,
+	// replacing the option of the queries, if any.
+	Subnet *net.IPNet
+}
+
+// ParseECS parses the EDNS Client Subnet handling of a source: either
+// "strip" or a subnet in CIDR notation, e.g. "203.0.113.0/24".
+func ParseECS(s string) (ECS, error) {
+	if s == "strip" {
+		return ECS{Strip: true}, nil
+	}
+	_, subnet, err := net.ParseCIDR(s)
+	if err != nil {
+		return ECS{}, fmt.Errorf("invalid client subnet %q, expected strip or a CIDR subnet", s)
+	}
+	return ECS{Subnet: subnet}, nil
+}
+
+// Enabled reports whether the queries are modified.
+func (e ECS) Enabled() bool {
+	return e.Strip || e.Subnet != nil
+}
+
+func (e ECS) String() string {
+	switch {
+	case e.Subnet != nil:
+		return e.Subnet.String()
+	case e.Strip:
+		return "strip"
+	default:
+		return ""
+	}
+}
+
+// option returns the data of the client subnet option announcing
+// Subnet.
+func (e ECS) option() []byte {
+	ip, family := e.Subnet.IP.To4(), uint16(1)
+	if ip == nil {
+		ip, family = e.Subnet.IP.To16(), 2
+	}
+	ones, _ := e.Subnet.Mask.Size()
+	b := make([]byte, 4, 4+(ones+7)/8)
+	binary.BigEndian.PutUint16(b, family)
+	b[2] = byte(ones)
+	return append(b, ip[:(ones+7)/8]...)
+}
+
+// rewrite returns the DNS message `msg` with its client subnet option
+// stripped or replaced, as configured. The messages that cannot be
+// parsed are returned unchanged.
+func (e ECS) rewrite(msg []byte) []byte {
+	var m dnsmessage.Message
+	if err := m.Unpack(msg); err != nil {
+		return msg
+	}
+
+	var opt *dnsmessage.OPTResource
+	for _, v := range m.Additionals {
+		if r, ok := v.Body.(*dnsmessage.OPTResource); ok {
+			opt = r
+			break
+		}
+	}
+	if opt == nil {
+		if e.Subnet == nil {
+			return msg
+		}
+		name, _ := dnsmessage.NewName(".")
+		opt = &dnsmessage.OPTResource{}
+		m.Additionals = append(m.Additionals, dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeOPT, Class: ednsSize},
+			Body:   opt,
+		})
+	}
+	options := opt.Options[:0]
+	for _, v := range opt.Options {
+		if v.Code != optionECS {
+			options = append(options, v)
+		}
+	}
+	if e.Subnet != nil {
+		options = append(options, dnsmessage.Option{Code: optionECS, Data: e.option()})
+	}
+	opt.Options = options
+
+	b, err := m.Pack()
+	if err != nil {
+		return msg
+	}
+	return b
+}
+
+// ecsConn rewrites the DNS queries written into it. Over streams, each
+// query is expected to be written at once, with its length prefix.
+type ecsConn struct {
+	net.Conn
+	ecs    ECS
+	stream bool
+}
+
+func (c *ecsConn) Write(b []byte) (int, error) {
+	msg := b
+	if c.stream {
+		if len(b) < 2 || int(binary.BigEndian.Uint16(b)) != len(b)-2 {
+			return c.Conn.Write(b)
+		}
+		msg = b[2:]
+	}
+	msg = c.ecs.rewrite(msg)
+	if c.stream {
+		msg = append(make([]byte, 2, 2+len(msg)), msg...)
+		binary.BigEndian.PutUint16(msg, uint16(len(msg)-2))
+	}
+	if _, err := c.Conn.Write(msg); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// ecsPacketConn is an ecsConn over a packet connection: it implements
+// net.PacketConn as well, so that the resolver does not frame the
+// queries as over TCP.
+type ecsPacketConn struct {
+	*ecsConn
+	pc net.PacketConn
+}
+
+func (c *ecsPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	return c.pc.ReadFrom(b)
+}
+
+func (c *ecsPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if _, err := c.pc.WriteTo(c.ecs.rewrite(b), addr); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// withECS returns `dial`, dialing connections to DNS servers, with the
+// queries written into its connections rewritten according to `ecs`.
+func withECS(ecs ECS, dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error) {
+	if !ecs.Enabled() {
+		return dial
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		if pc, ok := conn.(net.PacketConn); ok {
+			return &ecsPacketConn{ecsConn: &ecsConn{Conn: conn, ecs: ecs}, pc: pc}, nil
+		}
+		return &ecsConn{Conn: conn, ecs: ecs, stream: true}, nil
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package source
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// query returns a query for example.com, with an OPT record carrying
+// `options`, if not nil.
+func query(t *testing.T, options []dnsmessage.Option) []byte {
+	m := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: 1, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName("example.com."),
+			Type:  dnsmessage.TypeA,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	if options != nil {
+		m.Additionals = append(m.Additionals, dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName("."), Type: dnsmessage.TypeOPT, Class: 4096},
+			Body:   &dnsmessage.OPTResource{Options: options},
+		})
+	}
+	b, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// options returns the options of the OPT record of `msg`, or nil if it
+// has none.
+func options(t *testing.T, msg []byte) []dnsmessage.Option {
+	var m dnsmessage.Message
+	if err := m.Unpack(msg); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range m.Additionals {
+		if opt, ok := v.Body.(*dnsmessage.OPTResource); ok {
+			return append([]dnsmessage.Option{}, opt.Options...)
+		}
+	}
+	return nil
+}
+
+func TestECS_rewrite(t *testing.T) {
+	cookie := dnsmessage.Option{Code: 10, Data: []byte{1, 2, 3, 4, 5, 6, 7, 8}}
+	client := dnsmessage.Option{Code: optionECS, Data: []byte{0, 1, 24, 0, 192, 168, 1}}
+
+	strip, err := ParseECS("strip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := options(t, strip.rewrite(query(t, []dnsmessage.Option{cookie, client})))
+	if len(opts) != 1 || opts[0].Code != cookie.Code {
+		t.Fatalf("Unexpected options after strip: %v", opts)
+	}
+	if msg := query(t, nil); !bytes.Equal(strip.rewrite(msg), msg) {
+		t.Fatalf("Query without OPT record modified by strip")
+	}
+
+	set, err := ParseECS("203.0.113.7/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0, 1, 24, 0, 203, 0, 113}
+	for _, q := range [][]byte{query(t, []dnsmessage.Option{client}), query(t, nil)} {
+		opts := options(t, set.rewrite(q))
+		if len(opts) != 1 || opts[0].Code != optionECS || !bytes.Equal(opts[0].Data, want) {
+			t.Fatalf("Unexpected options: wanted client subnet %v, found %v", want, opts)
+		}
+	}
+
+	set6, err := ParseECS("2001:db8:1234::/36")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []byte{0, 2, 36, 0, 0x20, 0x01, 0x0d, 0xb8, 0x10}
+	if opts := options(t, set6.rewrite(query(t, nil))); len(opts) != 1 || !bytes.Equal(opts[0].Data, want) {
+		t.Fatalf("Unexpected options: wanted client subnet %v, found %v", want, opts)
+	}
+
+	if _, err := ParseECS("203.0.113.7"); err == nil {
+		t.Fatalf("Address without prefix length accepted")
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package source
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// GatewayConfig describes a Gateway source.
+type GatewayConfig struct {
+	// Name is the identifier of the source.
+	Name string `json:"name"`
+	// Gateway is the address of the router the connections leave
+	// through.
+	Gateway net.IP `json:"gateway"`
+	// Metered is reported as the metered state of the source.
+	Metered bool `json:"metered,omitempty"`
+}
+
+// ParseGateway parses the configuration of a Gateway source, in the
+// form `name:gateway=<ip>[,metered]`, e.g. `lte:gateway=192.168.8.1`.
+func ParseGateway(s string) (GatewayConfig, error) {
+	parts := strings.SplitN(s, ":", 2)
+	c := GatewayConfig{Name: parts[0]}
+	if c.Name == "" || len(parts) == 1 {
+		return c, fmt.Errorf("invalid gateway source %q, expected name:gateway=ip[,metered]", s)
+	}
+	for _, v := range strings.Split(parts[1], ",") {
+		kv := strings.SplitN(v, "=", 2)
+		var err error
+		switch kv[0] {
+		case "metered":
+			c.Metered = true
+			if len(kv) == 2 {
+				c.Metered, err = strconv.ParseBool(kv[1])
+			}
+		case "gateway":
+			if len(kv) != 2 {
+				return c, fmt.Errorf("gateway source %s: missing gateway value", c.Name)
+			}
+			if c.Gateway = net.ParseIP(kv[1]); c.Gateway == nil {
+				err = fmt.Errorf("%q is not an IP address", kv[1])
+			}
+		default:
+			err = fmt.Errorf("unknown option %q", kv[0])
+		}
+		if err != nil {
+			return c, fmt.Errorf("gateway source %s: %v", c.Name, err)
+		}
+	}
+	if c.Gateway == nil {
+		return c, fmt.Errorf("gateway source %s: missing gateway", c.Name)
+	}
+	return c, nil
+}
+
+// Gateway is a source identified by the router its connections leave
+// through, for when the interfaces cannot be bound to, e.g. in a
+// container without the NET_RAW and NET_ADMIN capabilities, or are not
+// meaningful, e.g. the eth0 and eth1 of a container attached to two
+// networks. Its connections are dialed from the local address on the
+// subnet of the gateway: the routing, configured in advance, has to
+// send the traffic from that address through the gateway, e.g. with
+// `ip rule add from <address> table <n>` and `ip route add default via
+// <gateway> table <n>`.
+type Gateway struct {
+	conf GatewayConfig
+
+	// If OnDialErr is not nil, it is called each time that the
+	// source is not able to create a network connection.
+	OnDialErr DialHook
+
+	meter
+}
+
+// NewGateway returns a Gateway source configured with `c`.
+func NewGateway(c GatewayConfig) *Gateway {
+	return &Gateway{conf: c}
+}
+
+// ID implements core.Source.
+func (g *Gateway) ID() string {
+	return g.conf.Name
+}
+
+// Metered reports the metered state configured.
+func (g *Gateway) Metered() bool {
+	return g.conf.Metered
+}
+
+// DialContext implements core.Source. The connections returned are
+// followed as Interface.Follow does.
+func (g *Gateway) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := g.dial(ctx, network, address)
+	if err != nil {
+		if f := g.OnDialErr; f != nil {
+			f(g.ID(), network, address, err)
+		}
+		return nil, err
+	}
+	return g.follow(g.ID(), conn), nil
+}
+
+func (g *Gateway) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	ip, err := g.LocalIP()
+	if err != nil {
+		return nil, err
+	}
+	d := &net.Dialer{
+		Control: func(network, address string, c syscall.RawConn) error {
+			connecting(ctx, address)
+			return c.Control(func(fd uintptr) {
+				mark(ctx, network, fd)
+				tune(ctx, fd)
+			})
+		},
+		LocalAddr: &net.TCPAddr{IP: ip},
+	}
+	if strings.HasPrefix(network, "udp") {
+		d.LocalAddr = &net.UDPAddr{IP: ip}
+	}
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	tuneConn(ctx, conn)
+	return conn, nil
+}
+
+// LocalIP returns the address, among the ones of the local interfaces,
+// on the subnet of the gateway.
+func (g *Gateway) LocalIP() (net.IP, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	return gatewayIP(addrs, g.conf.Gateway)
+}
+
+// gatewayIP returns the IP, from `addrs`, whose subnet contains
+// `gateway`.
+func gatewayIP(addrs []net.Addr, gateway net.IP) (net.IP, error) {
+	for _, v := range addrs {
+		if n, ok := v.(*net.IPNet); ok && n.Contains(gateway) && !n.IP.Equal(gateway) {
+			return n.IP, nil
+		}
+	}
+	return nil, fmt.Errorf("no local address on the subnet of gateway %v", gateway)
+}
+
+// Check returns an error if there is no local address on the subnet
+// of the gateway.
+func (g *Gateway) Check(ctx context.Context) error {
+	_, err := g.LocalIP()
+	return err
+}
+
+// Close closes the open connections.
+func (g *Gateway) Close() error {
+	if g.conns != nil {
+		g.conns.Close()
+	}
+	return nil
+}
+
+func (g *Gateway) String() string {
+	return fmt.Sprintf("%s (via %v)", g.ID(), g.conf.Gateway)
+}
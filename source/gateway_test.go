@@ -0,0 +1,90 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package source_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/booster-proj/booster/source"
+)
+
+func TestParseGateway(t *testing.T) {
+	tt := []struct {
+		in  string
+		out source.GatewayConfig
+	}{
+		{in: "lte:gateway=192.168.8.1", out: source.GatewayConfig{Name: "lte", Gateway: net.ParseIP("192.168.8.1")}},
+		{in: "sat:gateway=2001:db8::1,metered", out: source.GatewayConfig{Name: "sat", Gateway: net.ParseIP("2001:db8::1"), Metered: true}},
+	}
+	for i, v := range tt {
+		c, err := source.ParseGateway(v.in)
+		if err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		if !reflect.DeepEqual(c, v.out) {
+			t.Fatalf("%d: Unexpected config: wanted %+v, found %+v", i, v.out, c)
+		}
+	}
+
+	for _, v := range []string{"", "lte", "lte:metered", "lte:gateway", "lte:gateway=x", "lte:gateway=10.0.0.1,foo"} {
+		if _, err := source.ParseGateway(v); err == nil {
+			t.Fatalf("ParseGateway(%q) did not fail", v)
+		}
+	}
+}
+
+func TestGateway(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		conn.Close()
+	}()
+
+	// The loopback network contains the gateway: the connections are
+	// dialed from its address.
+	g := source.NewGateway(source.GatewayConfig{Name: "lo", Gateway: net.ParseIP("127.0.0.2")})
+	ip, err := g.LocalIP()
+	if err != nil {
+		t.Skipf("No loopback address: %v", err)
+	}
+	ctx := context.Background()
+	if err := g.Check(ctx); err != nil {
+		t.Fatalf("Unexpected check error: %v", err)
+	}
+	conn, err := g.DialContext(ctx, "tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if laddr := conn.LocalAddr().(*net.TCPAddr); !laddr.IP.Equal(ip) {
+		t.Fatalf("Connection dialed from %v, wanted %v", laddr.IP, ip)
+	}
+
+	g = source.NewGateway(source.GatewayConfig{Name: "none", Gateway: net.ParseIP("198.51.100.1")})
+	if err := g.Check(ctx); err == nil {
+		t.Fatal("Check did not fail without an address on the subnet of the gateway")
+	}
+}
@@ -20,6 +20,12 @@ import (
 	"net"
 	"sync"
 	"time"
+
+	"github.com/booster-proj/booster/dnscache"
+	"github.com/booster-proj/booster/qos"
+	"github.com/booster-proj/booster/sockopt"
+	"github.com/booster-proj/booster/trace"
+	"upspin.io/log"
 )
 
 // DialHook describes the function used to notify about
@@ -47,17 +53,54 @@ type Interface struct {
 	// dialer is not able to create a network connection.
 	OnDialErr DialHook
 
+	// MultipathTCP, if true, makes the interface dial its connections
+	// using MultiPath TCP. Only supported on Linux, ignored elsewhere.
+	MultipathTCP bool
+
+	// BindAddress, if true, makes the interface dial its connections
+	// from its address instead of binding them to the device, which
+	// requires CAP_NET_RAW, e.g. when running in a container: the
+	// routing of the host has to select the interface by the source
+	// address. Linux only, the other systems need no privileges.
+	BindAddress bool
+
+	// DNS are the DNS servers the host names dialed through the
+	// interface are resolved with, through the interface itself. If
+	// empty and DiscoverDNS is set, the servers assigned to the
+	// interface, e.g. by DHCP, are used when they can be discovered;
+	// otherwise the system resolver is.
+	DNS         []string
+	DiscoverDNS bool
+	// DNSCache, if set, caches the answers to the DNS queries of the
+	// interface.
+	DNSCache *dnscache.Cache
+	// ECS is how the EDNS Client Subnet option of the DNS queries of
+	// the interface is handled.
+	ECS ECS
+	dns interfaceDNS
+
+	meter
+}
+
+// meter keeps track of the connections dialed by a source, sending
+// their metrics to its MetricsExporter.
+type meter struct {
 	metrics struct {
 		sync.Mutex
 		exporter MetricsExporter
 	}
 
 	conns *conns
+
+	traffic struct {
+		sync.Mutex
+		sent, received int64
+	}
 }
 
-// SetMetricsExporter sets exp as the default MetricsExporter of interface
-// `i`. It is safe to use by multiple goroutines.
-func (i *Interface) SetMetricsExporter(exp MetricsExporter) {
+// SetMetricsExporter sets exp as the default MetricsExporter of the
+// source. It is safe to use by multiple goroutines.
+func (i *meter) SetMetricsExporter(exp MetricsExporter) {
 	i.metrics.Lock()
 	defer i.metrics.Unlock()
 
@@ -74,15 +117,23 @@ func (i *Interface) ID() string {
 // `Follow` is called is called on the net.Conn before returning it.
 // This function dials the connection using the interface's actual device as mean.
 func (i *Interface) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	ctx, span := trace.Start(ctx, "booster.connect")
+	span.SetAttr("source", i.ID())
+	span.SetAttr("address", address)
+	ctx, resolved := traceDNS(ctx, address)
+
 	// Implementations of the `dialContext` function can be found
 	// in the {darwin, linux, windows}_dial.go files.
 	conn, err := i.dialContext(ctx, network, address)
+	resolved(err)
+	span.End(err)
 	if err != nil {
 		if f := i.OnDialErr; f != nil {
 			f(i.ID(), network, address, err)
 		}
 		return nil, err
 	}
+	tuneConn(ctx, conn)
 
 	return i.Follow(conn), nil
 }
@@ -95,9 +146,13 @@ func (i *Interface) DialContext(ctx context.Context, network, address string) (n
 // connections. The connection is removed from such list when the conn's
 // OnClose function is called.
 func (i *Interface) Follow(conn net.Conn) net.Conn {
+	return i.follow(i.ID(), conn)
+}
+
+func (i *meter) follow(id string, conn net.Conn) net.Conn {
 	wconn := &Conn{Conn: conn}
 	labels := map[string]string{
-		"source": i.ID(),
+		"source": id,
 		"target": conn.RemoteAddr().String(),
 	}
 	_, port, _ := net.SplitHostPort(conn.RemoteAddr().String())
@@ -113,10 +168,14 @@ func (i *Interface) Follow(conn net.Conn) net.Conn {
 	// Note that it is better to avoid sending wrong metrics, just
 	// send them when we're sure that they're valid.
 
-	started := false
-	received := false
-
-	var t0 time.Time
+	// The connection is read and written from different
+	// goroutines: mux guards the latency measurement.
+	var (
+		mux      sync.Mutex
+		started  bool
+		received bool
+		t0       time.Time
+	)
 	i.SendCountOpenConn(labels, 1)
 	i.SendCountPort(portNetworkLabels, 1)
 	wconn.OnClose = func() {
@@ -125,18 +184,25 @@ func (i *Interface) Follow(conn net.Conn) net.Conn {
 		i.SendCountPort(portNetworkLabels, -1)
 	}
 	wconn.OnRead = func(data *DataFlow) {
-		if started && !received {
-			received = true
-			d := time.Since(t0)
+		mux.Lock()
+		first := started && !received
+		received = received || started
+		d := time.Since(t0)
+		mux.Unlock()
+		if first {
 			i.SendAddLatency(labels, d)
 		}
+		i.count(data)
 		i.SendDataFlow(labels, data)
 	}
 	wconn.OnWrite = func(data *DataFlow) {
+		mux.Lock()
 		if !started {
 			started = true
 			t0 = time.Now()
 		}
+		mux.Unlock()
+		i.count(data)
 		i.SendDataFlow(labels, data)
 	}
 	if i.conns == nil {
@@ -148,7 +214,7 @@ func (i *Interface) Follow(conn net.Conn) net.Conn {
 	return wconn
 }
 
-func (i *Interface) SendAddLatency(labels map[string]string, d time.Duration) {
+func (i *meter) SendAddLatency(labels map[string]string, d time.Duration) {
 	if i.metrics.exporter == nil {
 		return
 	}
@@ -159,7 +225,7 @@ func (i *Interface) SendAddLatency(labels map[string]string, d time.Duration) {
 	i.metrics.exporter.AddLatency(labels, d)
 }
 
-func (i *Interface) SendCountOpenConn(labels map[string]string, inc int) {
+func (i *meter) SendCountOpenConn(labels map[string]string, inc int) {
 	if i.metrics.exporter == nil {
 		return
 	}
@@ -170,7 +236,7 @@ func (i *Interface) SendCountOpenConn(labels map[string]string, inc int) {
 	i.metrics.exporter.CountOpenConn(labels, inc)
 }
 
-func (i *Interface) SendCountPort(labels map[string]string, inc int) {
+func (i *meter) SendCountPort(labels map[string]string, inc int) {
 	if i.metrics.exporter == nil {
 		return
 	}
@@ -181,9 +247,9 @@ func (i *Interface) SendCountPort(labels map[string]string, inc int) {
 	i.metrics.exporter.CountPort(labels, inc)
 }
 
-// SendDataFlow sends the transmission data using the Interface's MetricsExporter.
+// SendDataFlow sends the transmission data using the source's MetricsExporter.
 // It is safe to use by multiple goroutines.
-func (i *Interface) SendDataFlow(labels map[string]string, data *DataFlow) {
+func (i *meter) SendDataFlow(labels map[string]string, data *DataFlow) {
 	if i.metrics.exporter == nil {
 		return
 	}
@@ -194,6 +260,40 @@ func (i *Interface) SendDataFlow(labels map[string]string, data *DataFlow) {
 	i.metrics.exporter.SendDataFlow(labels, data)
 }
 
+func (i *meter) count(data *DataFlow) {
+	i.traffic.Lock()
+	defer i.traffic.Unlock()
+
+	switch data.Type {
+	case "read":
+		i.traffic.received += int64(data.N)
+	case "write":
+		i.traffic.sent += int64(data.N)
+	}
+}
+
+// Traffic returns the amount of data sent and received through the
+// connections of the source.
+func (i *meter) Traffic() (sent, received int64) {
+	i.traffic.Lock()
+	defer i.traffic.Unlock()
+
+	return i.traffic.sent, i.traffic.received
+}
+
+// Addrs returns the addresses assigned to the interface.
+func (i *Interface) Addrs() []string {
+	addrs, err := i.ifi.Addrs()
+	if err != nil {
+		return nil
+	}
+	acc := make([]string, 0, len(addrs))
+	for _, v := range addrs {
+		acc = append(acc, v.String())
+	}
+	return acc
+}
+
 // Close closes all open connections.
 func (i *Interface) Close() error {
 	i.conns.Close()
@@ -201,12 +301,32 @@ func (i *Interface) Close() error {
 	return nil
 }
 
+// CloseStale closes the connections dialed from addresses that are no
+// longer assigned to the interface, e.g. after it obtained a new DHCP
+// lease, returning how many were closed. They would not receive any
+// more data anyway.
+func (i *Interface) CloseStale() int {
+	if i.conns == nil {
+		return 0
+	}
+	current := make(map[string]bool)
+	for _, v := range i.Addrs() {
+		if ip, _, err := net.ParseCIDR(v); err == nil {
+			current[ip.String()] = true
+		}
+	}
+	return i.conns.CloseIf(func(conn *Conn) bool {
+		addr, ok := conn.LocalAddr().(*net.TCPAddr)
+		return ok && !current[addr.IP.String()]
+	})
+}
+
 func (i *Interface) String() string {
 	return i.ID()
 }
 
 // Len returns the number of open connections.
-func (i *Interface) Len() int {
+func (i *meter) Len() int {
 	if i.conns == nil {
 		return 0
 	}
@@ -214,6 +334,66 @@ func (i *Interface) Len() int {
 	return i.conns.Len()
 }
 
+type resolvedKey struct{}
+
+// traceDNS starts the span of the DNS resolution of `address`, if
+// it is not an IP address. The span is ended by `connecting`, which
+// is called by the dialer Control function, i.e. right after name
+// resolution, or by the function returned.
+func traceDNS(ctx context.Context, address string) (context.Context, func(error)) {
+	if trace.FromContext(ctx) == nil {
+		return ctx, func(error) {}
+	}
+	host, _, _ := net.SplitHostPort(address)
+	if net.ParseIP(host) != nil {
+		return ctx, func(error) {}
+	}
+
+	_, span := trace.Start(ctx, "booster.dns")
+	span.SetAttr("host", host)
+	f := func(err error) { span.End(err) }
+	return context.WithValue(ctx, resolvedKey{}, f), f
+}
+
+// connecting notifies the tracer that the DNS resolution completed
+// and the connection to `address` is being established.
+func connecting(ctx context.Context, address string) {
+	if f, ok := ctx.Value(resolvedKey{}).(func(error)); ok {
+		f(nil)
+	}
+	trace.FromContext(ctx).AddEvent("connect " + address)
+}
+
+// mark applies the DSCP value stored in `ctx`, if any, to socket `fd`
+// of `network`.
+func mark(ctx context.Context, network string, fd uintptr) {
+	if v, ok := qos.FromContext(ctx); ok {
+		if err := qos.Set(fd, network, v); err != nil {
+			log.Debug.Printf("Unable to set DSCP %d: %v", v, err)
+		}
+	}
+}
+
+// tune applies the socket options stored in `ctx`, if any, that have
+// to be set before connecting to socket `fd`.
+func tune(ctx context.Context, fd uintptr) {
+	if o, ok := sockopt.FromContext(ctx); ok {
+		if err := o.Control(fd); err != nil {
+			log.Debug.Printf("Unable to tune socket: %v", err)
+		}
+	}
+}
+
+// tuneConn applies the socket options stored in `ctx`, if any, that
+// have to be set once connected to `conn`.
+func tuneConn(ctx context.Context, conn net.Conn) {
+	if o, ok := sockopt.FromContext(ctx); ok {
+		if err := o.Apply(conn); err != nil {
+			log.Debug.Printf("Unable to tune connection: %v", err)
+		}
+	}
+}
+
 type conns struct {
 	sync.Mutex
 	val []*Conn
@@ -239,6 +419,25 @@ func (c *conns) Close() {
 	c.Unlock()
 }
 
+// CloseIf closes the connections for which `f` returns true,
+// returning how many they are.
+func (c *conns) CloseIf(f func(*Conn) bool) int {
+	c.Lock()
+	acc := make([]*Conn, 0, len(c.val))
+	for _, v := range c.val {
+		if f(v) {
+			acc = append(acc, v)
+		}
+	}
+	c.Unlock()
+
+	// Closing a connection removes it from the list, see follow.
+	for _, v := range acc {
+		v.Close()
+	}
+	return len(acc)
+}
+
 func (c *conns) Del(conn *Conn) {
 	c.Lock()
 	defer c.Unlock()
@@ -20,10 +20,13 @@ package source
 import (
 	"context"
 	"fmt"
+	"net"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/dnscache"
 	"upspin.io/log"
 )
 
@@ -52,36 +55,129 @@ type Listener struct {
 	s Store
 	// Hook errors handler.
 	h *Hooker
+	// Tells wether new interfaces should be registered as
+	// MPTCP subflow endpoints.
+	mptcp bool
+	// addrs are the addresses of the stored sources, as they were
+	// when they were last inspected.
+	addrs map[string]string
+	// unaddressed are the stored interfaces that lost their
+	// addresses, with the time it was noticed.
+	unaddressed map[string]time.Time
 }
 
 var PollInterval = time.Second * 3
 var PollTimeout = time.Second * 5
 
+// ReaddressTimeout is the amount of time a stored interface that lost
+// its addresses, e.g. while renewing its DHCP lease, is waited for
+// before removing it.
+var ReaddressTimeout = time.Second * 15
+
 type Config struct {
 	Store           Store
 	Provider        Provider
 	MetricsExporter MetricsExporter
+	// DialErrExporter, if set, counts the dial errors of the
+	// sources.
+	DialErrExporter DialErrExporter
+
+	// MultipathTCP makes the interfaces dial connections using
+	// MultiPath TCP, registering each new interface as an additional
+	// subflow endpoint. Linux only.
+	MultipathTCP bool
+	// BindAddress makes the interfaces dial from their addresses
+	// instead of binding to their devices, see Interface.
+	BindAddress bool
+	// SysFS, if set, is where the sysfs the interfaces are inspected
+	// through is mounted, see Local.
+	SysFS string
+
+	// Static are the static sources provided, used for development.
+	Static []StaticConfig
+	// Remote are the sources that dial through a remote SOCKS5
+	// proxy.
+	Remote []RemoteConfig
+	// Gateway are the sources identified by the router their
+	// connections leave through.
+	Gateway []GatewayConfig
+
+	// DNS maps the interfaces to the DNS servers used to resolve the
+	// host names dialed through them. The servers of the other
+	// interfaces are discovered if DiscoverDNS is set.
+	DNS         map[string][]string
+	DiscoverDNS bool
+	// DNSCache, if set, caches the answers to the DNS queries of the
+	// interfaces.
+	DNSCache *dnscache.Cache
+	// ECS maps the interfaces to the handling of the EDNS Client
+	// Subnet option of their DNS queries, see ECS.
+	ECS map[string]ECS
 }
 
 // NewListener creates a new Listener with the provided storage, using
 // as Provider the MergedProvider implementation.
 func NewListener(c Config) *Listener {
-	hooker := &Hooker{hooked: make(map[string]*hookErr)}
+	hooker := &Hooker{hooked: make(map[string]*hookErr), exp: c.DialErrExporter}
+
+	static := make([]*Static, 0, len(c.Static))
+	for _, v := range c.Static {
+		s := NewStatic(v)
+		s.OnDialErr = hooker.HandleDialErr
+		s.SetMetricsExporter(c.MetricsExporter)
+		static = append(static, s)
+	}
+	remote := make([]*Remote, 0, len(c.Remote))
+	for _, v := range c.Remote {
+		r := NewRemote(v)
+		r.OnDialErr = hooker.HandleDialErr
+		r.SetMetricsExporter(c.MetricsExporter)
+		remote = append(remote, r)
+	}
+	gateway := make([]*Gateway, 0, len(c.Gateway))
+	for _, v := range c.Gateway {
+		g := NewGateway(v)
+		g.OnDialErr = hooker.HandleDialErr
+		g.SetMetricsExporter(c.MetricsExporter)
+		gateway = append(gateway, g)
+	}
 
 	var p Provider = &MergedProvider{
 		ControlInterface: func(ifi *Interface) {
 			ifi.OnDialErr = hooker.HandleDialErr
 			ifi.SetMetricsExporter(c.MetricsExporter)
+			ifi.MultipathTCP = c.MultipathTCP
+			ifi.BindAddress = c.BindAddress
+			ifi.DNS = c.DNS[ifi.ID()]
+			ifi.DiscoverDNS = c.DiscoverDNS
+			ifi.DNSCache = c.DNSCache
+			ifi.ECS = c.ECS[ifi.ID()]
 		},
+		ControlCustom: func(src *Custom) {
+			src.OnDialErr = hooker.HandleDialErr
+			src.SetMetricsExporter(c.MetricsExporter)
+		},
+		Static:  static,
+		Remote:  remote,
+		Gateway: gateway,
+		SysFS:   c.SysFS,
 	}
 	if c.Provider != nil {
 		p = c.Provider
 	}
+	// The endpoints cannot be registered without MPTCP, which is
+	// reported by the caller.
+	mptcp := c.MultipathTCP && MPTCPAvailable()
+	if mptcp && !SubflowEndpointsAvailable() {
+		log.Error.Printf("Listener: the ip command of iproute2 was not found, the interfaces are not registered as MPTCP subflow endpoints")
+		mptcp = false
+	}
 
 	return &Listener{
 		s:        c.Store,
 		h:        hooker,
 		Provider: p,
+		mptcp:    mptcp,
 	}
 }
 
@@ -97,9 +193,15 @@ func (err *hookErr) Error() string {
 	return fmt.Sprintf("error %v produced by source %s while contacting %s using %s", err.err, err.ref, err.address, err.network)
 }
 
+// DialErrExporter counts the dial errors of the sources.
+type DialErrExporter interface {
+	IncDialError(labels map[string]string)
+}
+
 type Hooker struct {
 	sync.Mutex
 	hooked map[string]*hookErr // list of hook errors mapped by source ID
+	exp    DialErrExporter
 }
 
 func (h *Hooker) HandleDialErr(ref, network, address string, err error) {
@@ -112,6 +214,9 @@ func (h *Hooker) HandleDialErr(ref, network, address string, err error) {
 		err:        err,
 	}
 	h.Add(hookErr)
+	if h.exp != nil {
+		h.exp.IncDialError(map[string]string{"source": ref})
+	}
 }
 
 func (h *Hooker) Add(err *hookErr) {
@@ -222,15 +327,38 @@ func (l *Listener) Poll(ctx context.Context) error {
 		// New source WITH active internet connection found!
 		log.Info.Printf("Listener: adding (%v) to storage.", v)
 		l.s.Put(v)
+		l.saveAddrs(v)
+
+		if ifi, ok := v.(*Interface); ok && l.mptcp {
+			if err := AddSubflowEndpoint(ifi); err != nil {
+				log.Error.Printf("Listener: %v", err)
+			}
+		}
 	}
 
-	// Remove what has to be removed without further investigation
+	// Remove what has to be removed without further investigation,
+	// unless it is an interface waiting for a new address.
 	for _, v := range remove {
+		if l.waitAddrs(v) {
+			continue
+		}
 		log.Info.Printf("Listener: removing (%v) from storage.", v)
-		l.s.Del(v)
+		l.del(v)
 		_ = l.h.HookErr(v.ID()) // also consume hook errors.
 	}
 
+	// Rebind the sources whose addresses changed, keeping them in
+	// the storage if they still provide an internet connection.
+	for _, v := range old {
+		if contains(remove, v) {
+			continue
+		}
+		delete(l.unaddressed, v.ID())
+		if l.addrsChanged(v) {
+			l.readdress(ctx, v)
+		}
+	}
+
 	// Eventually remove the sources that contain hook errors.
 	old = l.StoredSources() // as the list has been updated before the last call.
 	acc := make([]core.Source, 0, len(old))
@@ -245,9 +373,115 @@ func (l *Listener) Poll(ctx context.Context) error {
 		// not provide an internet connection.
 		if err := l.Check(ctx, v, High); err != nil {
 			log.Info.Printf("Listener: removing (%v) from storage after hook error.", v)
-			l.s.Del(v)
+			l.del(v)
 		}
 	}
 
 	return nil
 }
+
+// addrs returns the addresses of `src`, if it exposes them, joined.
+func addrs(src core.Source) string {
+	if a, ok := src.(interface{ Addrs() []string }); ok {
+		return strings.Join(a.Addrs(), ",")
+	}
+	return ""
+}
+
+func contains(sources []core.Source, src core.Source) bool {
+	for _, v := range sources {
+		if v.ID() == src.ID() {
+			return true
+		}
+	}
+	return false
+}
+
+// saveAddrs records the current addresses of `src`.
+func (l *Listener) saveAddrs(src core.Source) {
+	if l.addrs == nil {
+		l.addrs = make(map[string]string)
+	}
+	l.addrs[src.ID()] = addrs(src)
+}
+
+// addrsChanged reports whether the addresses of stored source `src`
+// changed since they were recorded.
+func (l *Listener) addrsChanged(src core.Source) bool {
+	saved, ok := l.addrs[src.ID()]
+	return ok && saved != addrs(src)
+}
+
+// waitAddrs reports whether stored source `src`, which is no longer
+// provided, is an interface that is still up but lost its addresses,
+// and did so less than ReaddressTimeout ago.
+func (l *Listener) waitAddrs(src core.Source) bool {
+	ifi, ok := src.(*Interface)
+	if !ok {
+		return false
+	}
+	cur, err := net.InterfaceByName(ifi.ID())
+	if err != nil || cur.Flags&net.FlagUp == 0 || len(ifi.Addrs()) > 0 {
+		delete(l.unaddressed, src.ID())
+		return false
+	}
+	if l.unaddressed == nil {
+		l.unaddressed = make(map[string]time.Time)
+	}
+	since, ok := l.unaddressed[src.ID()]
+	if !ok {
+		log.Info.Printf("Listener: (%v) lost its addresses, waiting for new ones.", src)
+		l.unaddressed[src.ID()] = time.Now()
+		return true
+	}
+	if time.Since(since) < ReaddressTimeout {
+		return true
+	}
+	delete(l.unaddressed, src.ID())
+	return false
+}
+
+// readdress handles the change of the addresses of stored source
+// `src`, e.g. after it obtained a new DHCP lease. The source keeps its
+// identity, and with it its labels, policies and history, as long as it
+// still provides an internet connection: the connections dialed from
+// the old addresses are closed, and the MPTCP subflow endpoints are
+// registered again.
+func (l *Listener) readdress(ctx context.Context, src core.Source) {
+	log.Info.Printf("Listener: addresses of (%v) changed from [%s] to [%s].", src, l.addrs[src.ID()], addrs(src))
+	if err := l.Check(ctx, src, High); err != nil {
+		log.Info.Printf("Listener: removing (%v) from storage after address change: %v", src, err)
+		l.del(src)
+		return
+	}
+	l.saveAddrs(src)
+
+	ifi, ok := src.(*Interface)
+	if !ok {
+		return
+	}
+	if n := ifi.CloseStale(); n > 0 {
+		log.Info.Printf("Listener: closed %d connections of (%v) dialed from its old addresses.", n, src)
+	}
+	if l.mptcp {
+		if err := RemoveSubflowEndpoint(ifi); err != nil {
+			log.Error.Printf("Listener: %v", err)
+		}
+		if err := AddSubflowEndpoint(ifi); err != nil {
+			log.Error.Printf("Listener: %v", err)
+		}
+	}
+}
+
+// del removes `src` from the storage, together with its MPTCP subflow
+// endpoints, if any.
+func (l *Listener) del(src core.Source) {
+	l.s.Del(src)
+	delete(l.addrs, src.ID())
+	delete(l.unaddressed, src.ID())
+	if ifi, ok := src.(*Interface); ok && l.mptcp {
+		if err := RemoveSubflowEndpoint(ifi); err != nil {
+			log.Error.Printf("Listener: %v", err)
+		}
+	}
+}
@@ -330,3 +330,57 @@ func TestPoll(t *testing.T) {
 		}
 	}
 }
+
+type addrMock struct {
+	mock
+	addrs []string
+}
+
+func (s *addrMock) Addrs() []string {
+	return s.addrs
+}
+
+type addrProvider struct {
+	mockProvider
+	src *addrMock
+}
+
+func (p *addrProvider) Provide(ctx context.Context) ([]core.Source, error) {
+	return []core.Source{p.src}, nil
+}
+
+func TestPoll_readdress(t *testing.T) {
+	var puts, dels int
+	s := &storage{
+		putHook: func(ss ...core.Source) { puts += len(ss) },
+		delHook: func(ss ...core.Source) { dels += len(ss) },
+	}
+	wlan0 := &addrMock{mock: mock{id: "wlan0", active: true}, addrs: []string{"192.168.1.2/24"}}
+	l := source.NewListener(source.Config{Store: s})
+	l.Provider = &addrProvider{src: wlan0}
+
+	ctx := context.Background()
+	if err := l.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The source keeps its identity when its address changes...
+	wlan0.addrs = []string{"192.168.1.7/24"}
+	if err := l.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if puts != 1 || dels != 0 || s.Len() != 1 {
+		t.Fatalf("Unexpected changes: %d puts, %d dels", puts, dels)
+	}
+
+	// ...unless the new address does not provide an internet
+	// connection.
+	wlan0.addrs = []string{"10.0.0.2/8"}
+	wlan0.active = false
+	if err := l.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if dels != 1 || s.Len() != 0 {
+		t.Fatalf("Unexpected changes: %d puts, %d dels", puts, dels)
+	}
+}
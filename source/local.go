@@ -25,6 +25,12 @@ import (
 )
 
 type Local struct {
+	// SysFS, if set, is where the sysfs the interfaces are inspected
+	// through is mounted, e.g. the one of the host mounted into a
+	// container: only the physical interfaces that are not down are
+	// provided, leaving out the bridges and the veth pairs of the
+	// containers.
+	SysFS string
 }
 
 func (l *Local) Provide(ctx context.Context, level Confidence) ([]*Interface, error) {
@@ -45,6 +51,9 @@ func (l *Local) Provide(ctx context.Context, level Confidence) ([]*Interface, er
 
 func (l *Local) Check(ctx context.Context, ifi *Interface, level Confidence) error {
 	checks := []check{hasHardwareAddr, hasIP}
+	if l.SysFS != "" {
+		checks = append(checks, isPhysical(l.SysFS))
+	}
 	if level == High {
 		checks = append(checks, hasNetworkConnRetry)
 	}
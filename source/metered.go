@@ -0,0 +1,42 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package source
+
+import "strings"
+
+// meteredPrefixes contains the name prefixes of the interfaces that
+// are usually backed by a metered connection: cellular modems,
+// point-to-point links, USB and bluetooth tethering.
+var meteredPrefixes = []string{
+	"wwan", "rmnet", "ppp", "pdp_ip", "usb", "rndis", "bnep",
+}
+
+// IsMetered guesses, from the interface name, whether the connection
+// provided by interface `name` is metered.
+func IsMetered(name string) bool {
+	for _, v := range meteredPrefixes {
+		if strings.HasPrefix(name, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Metered reports whether the interface is believed to provide a
+// metered connection. See IsMetered.
+func (i *Interface) Metered() bool {
+	return IsMetered(i.ID())
+}
@@ -0,0 +1,119 @@
+//go:build linux
+// +build linux
+
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package source
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// MPTCPAvailable reports wether the running kernel has MultiPath TCP
+// enabled.
+func MPTCPAvailable() bool {
+	b, err := ioutil.ReadFile("/proc/sys/net/mptcp/enabled")
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(b)) == "1"
+}
+
+// SubflowEndpointsAvailable reports whether the iproute2 `ip` command,
+// which manages the MPTCP endpoints, is installed.
+func SubflowEndpointsAvailable() bool {
+	_, err := exec.LookPath("ip")
+	return err == nil
+}
+
+// AddSubflowEndpoint registers the addresses of `ifi` as MPTCP
+// endpoints of the kernel path manager, flagged as "subflow". This way
+// the kernel opens additional subflows through `ifi` for the MPTCP
+// connections dialed by the other interfaces, making a single
+// connection aggregate the bandwidth of multiple sources.
+// Requires the iproute2 `ip` command and CAP_NET_ADMIN.
+func AddSubflowEndpoint(ifi *Interface) error {
+	addrs, err := ifi.ifi.Addrs()
+	if err != nil {
+		return fmt.Errorf("unable to get addresses of interface %s: %v", ifi.ID(), err)
+	}
+
+	for _, v := range addrs {
+		ip, _, err := net.ParseCIDR(v.String())
+		if err != nil || ip.IsLinkLocalUnicast() {
+			continue
+		}
+
+		var stderr bytes.Buffer
+		cmd := exec.Command("ip", "mptcp", "endpoint", "add", ip.String(), "dev", ifi.ID(), "subflow")
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			if strings.Contains(stderr.String(), "exists") {
+				continue
+			}
+			return fmt.Errorf("unable to add mptcp endpoint %v for interface %s: %v: %s", ip, ifi.ID(), err, strings.TrimSpace(stderr.String()))
+		}
+	}
+	return nil
+}
+
+// RemoveSubflowEndpoint removes the MPTCP endpoints of the kernel path
+// manager bound to `ifi`, undoing AddSubflowEndpoint. The interface
+// may be gone already: the endpoints are found by device name.
+// Requires the iproute2 `ip` command and CAP_NET_ADMIN.
+func RemoveSubflowEndpoint(ifi *Interface) error {
+	out, err := exec.Command("ip", "mptcp", "endpoint", "show").Output()
+	if err != nil {
+		return fmt.Errorf("unable to list mptcp endpoints: %v", err)
+	}
+	for _, id := range endpointIDs(string(out), ifi.ID()) {
+		var stderr bytes.Buffer
+		cmd := exec.Command("ip", "mptcp", "endpoint", "delete", "id", id)
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("unable to remove mptcp endpoint %s of interface %s: %v: %s", id, ifi.ID(), err, strings.TrimSpace(stderr.String()))
+		}
+	}
+	return nil
+}
+
+// endpointIDs returns the ids of the endpoints bound to device `dev`
+// listed in `out`, the output of `ip mptcp endpoint show`, whose lines
+// look like `192.168.1.2 id 1 subflow dev wlan0`.
+func endpointIDs(out, dev string) []string {
+	var ids []string
+	for _, line := range strings.Split(out, "\n") {
+		var id, d string
+		fields := strings.Fields(line)
+		for i := 0; i+1 < len(fields); i++ {
+			switch fields[i] {
+			case "id":
+				id = fields[i+1]
+			case "dev":
+				d = fields[i+1]
+			}
+		}
+		if id != "" && d == dev {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,67 @@
+//go:build linux
+// +build linux
+
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package source
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestEndpointIDs(t *testing.T) {
+	out := "192.168.1.2 id 1 subflow dev wlan0 \n" +
+		"10.0.0.2 id 2 subflow dev eth0 \n" +
+		"2001:db8::2 id 3 subflow dev wlan0 \n" +
+		"10.0.0.3 id 4 signal \n"
+	if ids := endpointIDs(out, "wlan0"); !reflect.DeepEqual(ids, []string{"1", "3"}) {
+		t.Fatalf("Unexpected ids for wlan0: %v", ids)
+	}
+	if ids := endpointIDs(out, "eth1"); len(ids) != 0 {
+		t.Fatalf("Unexpected ids for eth1: %v", ids)
+	}
+}
+
+func TestLocalAddr(t *testing.T) {
+	addrs := []net.Addr{
+		&net.IPNet{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)},
+		&net.IPNet{IP: net.ParseIP("2001:db8::2"), Mask: net.CIDRMask(64, 128)},
+		&net.IPNet{IP: net.ParseIP("192.168.1.2").To4(), Mask: net.CIDRMask(24, 32)},
+	}
+	tt := []struct {
+		network string
+		addrs   []net.Addr
+		ip      string
+	}{
+		{network: "tcp", addrs: addrs, ip: "192.168.1.2"},
+		{network: "tcp4", addrs: addrs, ip: "192.168.1.2"},
+		{network: "tcp6", addrs: addrs, ip: "2001:db8::2"},
+		{network: "tcp", addrs: addrs[:2], ip: "2001:db8::2"},
+		{network: "tcp4", addrs: addrs[:2]},
+		{network: "tcp", addrs: addrs[:1]},
+	}
+	for i, v := range tt {
+		laddr := localAddr(v.addrs, v.network)
+		switch {
+		case v.ip == "" && laddr != nil:
+			t.Fatalf("%d: Unexpected address %v", i, laddr)
+		case v.ip != "" && (laddr == nil || !laddr.IP.Equal(net.ParseIP(v.ip))):
+			t.Fatalf("%d: Unexpected address: wanted %v, found %v", i, v.ip, laddr)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+//go:build !linux
+// +build !linux
+
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package source
+
+import "errors"
+
+// MPTCPAvailable reports wether the running kernel has MultiPath TCP
+// enabled. MPTCP is only supported on Linux.
+func MPTCPAvailable() bool {
+	return false
+}
+
+// SubflowEndpointsAvailable is only supported on Linux.
+func SubflowEndpointsAvailable() bool {
+	return false
+}
+
+// AddSubflowEndpoint is only supported on Linux.
+func AddSubflowEndpoint(ifi *Interface) error {
+	return errors.New("mptcp is only supported on linux")
+}
+
+// RemoveSubflowEndpoint is only supported on Linux.
+func RemoveSubflowEndpoint(ifi *Interface) error {
+	return errors.New("mptcp is only supported on linux")
+}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 
 	"github.com/booster-proj/booster/core"
+	"upspin.io/log"
 )
 
 type Confidence int
@@ -36,15 +37,31 @@ type MergedProvider struct {
 	// on an interface that has been found by the provider, before
 	// it is hidden inside a core.Source.
 	ControlInterface func(ifi *Interface)
+	// ControlCustom, as ControlInterface, allows to configure the
+	// sources found by the providers registered with
+	// core.RegisterSourceProvider.
+	ControlCustom func(c *Custom)
+	// Static sources are provided as they are, together with the
+	// ones found.
+	Static []*Static
+	// Remote sources, as the static ones, are provided as they are.
+	Remote []*Remote
+	// Gateway sources, as the static ones, are provided as they are.
+	Gateway []*Gateway
+	// SysFS, if set, is where the sysfs the local interfaces are
+	// inspected through is mounted, see Local.
+	SysFS string
 
 	local *Local
 }
 
 // Provide returns the list of sources returned by each provider owned
-// by merged. Currently only a local provider is queried.
+// by merged: the local one, which finds the network interfaces, and
+// the ones registered with core.RegisterSourceProvider. The failure of
+// a registered provider does not prevent the others from being queried.
 func (p *MergedProvider) Provide(ctx context.Context) ([]core.Source, error) {
 	if p.local == nil {
-		p.local = new(Local)
+		p.local = &Local{SysFS: p.SysFS}
 	}
 
 	interfaces, err := p.local.Provide(ctx, Low)
@@ -59,6 +76,31 @@ func (p *MergedProvider) Provide(ctx context.Context) ([]core.Source, error) {
 		}
 		sources = append(sources, v)
 	}
+
+	for _, name := range core.SourceProviders() {
+		cp, _ := core.LookupSourceProvider(name)
+		l, err := cp.Provide(ctx)
+		if err != nil {
+			log.Error.Printf("Provider %s: %v", name, err)
+			continue
+		}
+		for _, v := range l {
+			c := &Custom{Source: v, Provider: name}
+			if f := p.ControlCustom; f != nil {
+				f(c)
+			}
+			sources = append(sources, c)
+		}
+	}
+	for _, v := range p.Static {
+		sources = append(sources, v)
+	}
+	for _, v := range p.Remote {
+		sources = append(sources, v)
+	}
+	for _, v := range p.Gateway {
+		sources = append(sources, v)
+	}
 	return sources, nil
 }
 
@@ -66,5 +108,21 @@ func (p *MergedProvider) Check(ctx context.Context, src core.Source, level Confi
 	if ifi, ok := src.(*Interface); ok {
 		return p.local.Check(ctx, ifi, level)
 	}
+	if _, ok := src.(*Static); ok {
+		// Static sources use the default route, which is assumed
+		// to work.
+		return nil
+	}
+	if r, ok := src.(*Remote); ok {
+		return r.Check(ctx)
+	}
+	if g, ok := src.(*Gateway); ok {
+		return g.Check(ctx)
+	}
+	if c, ok := src.(*Custom); ok {
+		if cp, ok := core.LookupSourceProvider(c.Provider); ok {
+			return cp.Check(ctx, c.Source)
+		}
+	}
 	return fmt.Errorf("provider: unable to find suitable checks for source %s", src.ID())
 }
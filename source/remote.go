@@ -0,0 +1,277 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package source
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/booster-proj/booster/proxyproto"
+)
+
+// RemoteConfig describes a Remote source.
+type RemoteConfig struct {
+	// Name is the identifier of the source.
+	Name string `json:"name"`
+	// Address is the address of the SOCKS5 proxy, e.g. another
+	// booster instance, the connections are dialed through.
+	Address string `json:"address"`
+	// ProxyProtocol, if not 0, is the version of the PROXY protocol
+	// header, 1 or 2, sent to the proxy before the SOCKS5 handshake,
+	// announcing the original client of each connection.
+	ProxyProtocol int `json:"proxy_protocol,omitempty"`
+	// Metered is reported as the metered state of the source.
+	Metered bool `json:"metered,omitempty"`
+}
+
+// ParseRemote parses the configuration of a Remote source, in the form
+// `name:address=<host:port>[,option]`, where the options are
+// proxy-protocol=<1|2> and metered, e.g.
+// `office:address=10.0.0.2:1080,proxy-protocol=2`.
+func ParseRemote(s string) (RemoteConfig, error) {
+	parts := strings.SplitN(s, ":", 2)
+	c := RemoteConfig{Name: parts[0]}
+	if c.Name == "" || len(parts) == 1 {
+		return c, fmt.Errorf("invalid remote source %q, expected name:address=host:port[,option]", s)
+	}
+	for _, v := range strings.Split(parts[1], ",") {
+		kv := strings.SplitN(v, "=", 2)
+		var err error
+		switch kv[0] {
+		case "metered":
+			c.Metered = true
+			if len(kv) == 2 {
+				c.Metered, err = strconv.ParseBool(kv[1])
+			}
+		case "address":
+			if len(kv) != 2 {
+				return c, fmt.Errorf("remote source %s: missing address value", c.Name)
+			}
+			c.Address = kv[1]
+			_, _, err = net.SplitHostPort(c.Address)
+		case "proxy-protocol":
+			if len(kv) != 2 {
+				return c, fmt.Errorf("remote source %s: missing proxy-protocol value", c.Name)
+			}
+			c.ProxyProtocol, err = strconv.Atoi(kv[1])
+			if err == nil && c.ProxyProtocol != 1 && c.ProxyProtocol != 2 {
+				err = fmt.Errorf("unsupported proxy-protocol version %d", c.ProxyProtocol)
+			}
+		default:
+			err = fmt.Errorf("unknown option %q", kv[0])
+		}
+		if err != nil {
+			return c, fmt.Errorf("remote source %s: %v", c.Name, err)
+		}
+	}
+	if c.Address == "" {
+		return c, fmt.Errorf("remote source %s: missing address", c.Name)
+	}
+	return c, nil
+}
+
+// Remote is a source that dials its connections through a remote
+// SOCKS5 proxy, e.g. a booster instance running on another network.
+// When configured to, it writes a PROXY protocol header before the
+// handshake, carrying the client stored in the context of the dial
+// with proxyproto.WithClient, so that the exit node knows who the
+// connection belongs to.
+type Remote struct {
+	conf RemoteConfig
+
+	// If OnDialErr is not nil, it is called each time that the
+	// source is not able to create a network connection.
+	OnDialErr DialHook
+
+	meter
+}
+
+// NewRemote returns a Remote source configured with `c`.
+func NewRemote(c RemoteConfig) *Remote {
+	return &Remote{conf: c}
+}
+
+// ID implements core.Source.
+func (r *Remote) ID() string {
+	return r.conf.Name
+}
+
+// Metered reports the metered state configured.
+func (r *Remote) Metered() bool {
+	return r.conf.Metered
+}
+
+// ResolvesRemotely reports that the host names dialed through the
+// source are resolved by the proxy, as they are sent to it in the
+// CONNECT request.
+func (r *Remote) ResolvesRemotely() bool {
+	return true
+}
+
+// DialContext implements core.Source. The connections returned are
+// followed as Interface.Follow does.
+func (r *Remote) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := r.dial(ctx, network, address)
+	if err != nil {
+		if f := r.OnDialErr; f != nil {
+			f(r.ID(), network, address, err)
+		}
+		return nil, err
+	}
+	return r.follow(r.ID(), conn), nil
+}
+
+func (r *Remote) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("remote source %s: unsupported network %s", r.ID(), network)
+	}
+	d := &net.Dialer{
+		Control: func(network, address string, c syscall.RawConn) error {
+			return c.Control(func(fd uintptr) {
+				mark(ctx, network, fd)
+				tune(ctx, fd)
+			})
+		},
+	}
+	conn, err := d.DialContext(ctx, "tcp", r.conf.Address)
+	if err != nil {
+		return nil, err
+	}
+	tuneConn(ctx, conn)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	if v := r.conf.ProxyProtocol; v > 0 {
+		// Without a client, the header tells the proxy to use the
+		// address of the connection itself.
+		src, dst, _ := proxyproto.ClientFromContext(ctx)
+		if err = proxyproto.WriteHeader(conn, v, src, dst); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if err = socksConnect(conn, address); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("remote source %s: %v", r.ID(), err)
+	}
+	return conn, nil
+}
+
+// Check returns an error if the proxy is not reachable.
+func (r *Remote) Check(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", r.conf.Address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Close closes the open connections.
+func (r *Remote) Close() error {
+	if r.conns != nil {
+		r.conns.Close()
+	}
+	return nil
+}
+
+func (r *Remote) String() string {
+	return fmt.Sprintf("%s (remote %s)", r.ID(), r.conf.Address)
+}
+
+// socksConnect performs, on `rw`, the SOCKS5 handshake asking the
+// proxy to connect to `address`, without authentication.
+func socksConnect(rw io.ReadWriter, address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	if _, err = rw.Write([]byte{5, 1, 0}); err != nil {
+		return err
+	}
+	b := make([]byte, 2)
+	if _, err = io.ReadFull(rw, b); err != nil {
+		return err
+	}
+	if b[0] != 5 || b[1] != 0 {
+		return errors.New("socks: authentication required")
+	}
+
+	req := []byte{5, 1, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return fmt.Errorf("socks: host name too long")
+		}
+		req = append(req, 3, byte(len(host)))
+		req = append(req, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(req, 1)
+		req = append(req, ip4...)
+	} else {
+		req = append(req, 4)
+		req = append(req, ip.To16()...)
+	}
+	req = append(req, 0, 0)
+	binary.BigEndian.PutUint16(req[len(req)-2:], uint16(p))
+	if _, err = rw.Write(req); err != nil {
+		return err
+	}
+
+	b = make([]byte, 4)
+	if _, err = io.ReadFull(rw, b); err != nil {
+		return err
+	}
+	if b[0] != 5 {
+		return fmt.Errorf("socks: unexpected version %d", b[0])
+	}
+	if b[1] != 0 {
+		return fmt.Errorf("socks: connect to %s failed with code %d", address, b[1])
+	}
+	// Skip the bound address.
+	var n int
+	switch b[3] {
+	case 1:
+		n = net.IPv4len
+	case 4:
+		n = net.IPv6len
+	case 3:
+		l := make([]byte, 1)
+		if _, err = io.ReadFull(rw, l); err != nil {
+			return err
+		}
+		n = int(l[0])
+	default:
+		return fmt.Errorf("socks: unknown address type %d", b[3])
+	}
+	_, err = io.ReadFull(rw, make([]byte, n+2))
+	return err
+}
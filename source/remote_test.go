@@ -0,0 +1,147 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package source_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/booster-proj/booster/proxyproto"
+	"github.com/booster-proj/booster/source"
+)
+
+func TestParseRemote(t *testing.T) {
+	tt := []struct {
+		in  string
+		out source.RemoteConfig
+	}{
+		{in: "office:address=10.0.0.2:1080", out: source.RemoteConfig{Name: "office", Address: "10.0.0.2:1080"}},
+		{in: "lte:address=[::1]:1080,proxy-protocol=2,metered", out: source.RemoteConfig{Name: "lte", Address: "[::1]:1080", ProxyProtocol: 2, Metered: true}},
+	}
+	for i, v := range tt {
+		c, err := source.ParseRemote(v.in)
+		if err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		if c != v.out {
+			t.Fatalf("%d: Unexpected config: wanted %+v, found %+v", i, v.out, c)
+		}
+	}
+
+	for _, v := range []string{"", "office", "office:metered", "office:address=10.0.0.2", "office:address=10.0.0.2:1080,proxy-protocol=3", "office:address=10.0.0.2:1080,foo"} {
+		if _, err := source.ParseRemote(v); err == nil {
+			t.Fatalf("ParseRemote(%q) did not fail", v)
+		}
+	}
+}
+
+// socksServer accepts a connection on `ln`, reads the PROXY protocol
+// header and the SOCKS5 handshake, and echoes back what it receives
+// after that. The header read and the target requested are sent on
+// the channels.
+func socksServer(t *testing.T, ln net.Listener, header chan<- []byte, target chan<- []byte) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var raw bytes.Buffer
+	r := bufio.NewReader(io.TeeReader(conn, &raw))
+	if _, err := proxyproto.ReadHeader(r); err != nil && err != proxyproto.ErrNoHeader {
+		t.Errorf("Unexpected header error: %v", err)
+		return
+	}
+	header <- raw.Bytes()[:raw.Len()-r.Buffered()]
+
+	b := make([]byte, 3)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return
+	}
+	conn.Write([]byte{5, 0})
+	// IPv4 connect request: version, command, reserved, type,
+	// address and port.
+	b = make([]byte, 10)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return
+	}
+	target <- b
+	conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0})
+	io.Copy(conn, r)
+}
+
+func TestRemote(t *testing.T) {
+	client := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 4000}
+	server := &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 1080}
+	v2 := []byte("\r\n\r\n\x00\r\nQUIT\n\x21\x11\x00\x0c\xc0\x00\x02\x01\xc6\x33\x64\x01\x0f\xa0\x04\x38")
+
+	tt := []struct {
+		version int
+		ctx     context.Context
+		header  []byte
+	}{
+		{version: 0, ctx: proxyproto.WithClient(context.Background(), client, server), header: []byte{}},
+		{version: 1, ctx: proxyproto.WithClient(context.Background(), client, server), header: []byte("PROXY TCP4 192.0.2.1 198.51.100.1 4000 1080\r\n")},
+		{version: 1, ctx: context.Background(), header: []byte("PROXY UNKNOWN\r\n")},
+		{version: 2, ctx: proxyproto.WithClient(context.Background(), client, server), header: v2},
+	}
+	for i, v := range tt {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		header, target := make(chan []byte, 1), make(chan []byte, 1)
+		go socksServer(t, ln, header, target)
+
+		p := &source.MergedProvider{
+			Remote: []*source.Remote{source.NewRemote(source.RemoteConfig{
+				Name:          "office",
+				Address:       ln.Addr().String(),
+				ProxyProtocol: v.version,
+			})},
+		}
+		srcs, err := p.Provide(context.Background())
+		if err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		s, _ := srcs[len(srcs)-1].(*source.Remote)
+		if s == nil || s.ID() != "office" {
+			t.Fatalf("%d: Remote source not found in %v", i, srcs)
+		}
+
+		conn, err := s.DialContext(v.ctx, "tcp", "203.0.113.5:443")
+		if err != nil {
+			t.Fatalf("%d: Unexpected dial error: %v", i, err)
+		}
+		if h := <-header; !bytes.Equal(h, v.header) {
+			t.Fatalf("%d: Unexpected header: wanted %q, found %q", i, v.header, h)
+		}
+		if b := <-target; !bytes.Equal(b, []byte{5, 1, 0, 1, 203, 0, 113, 5, 1, 187}) {
+			t.Fatalf("%d: Unexpected connect request: %v", i, b)
+		}
+		conn.Write([]byte("ping"))
+		b := make([]byte, 4)
+		if _, err := io.ReadFull(conn, b); err != nil || string(b) != "ping" {
+			t.Fatalf("%d: Unexpected echo: %q, %v", i, b, err)
+		}
+		conn.Close()
+		ln.Close()
+	}
+}
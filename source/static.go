@@ -0,0 +1,260 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package source
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// StaticConfig describes a Static source.
+type StaticConfig struct {
+	// Name is the identifier of the source.
+	Name string `json:"name"`
+	// Latency is added to every dial.
+	Latency time.Duration `json:"latency,omitempty"`
+	// Bandwidth, if not 0, limits the data sent and received by the
+	// source, in bits per second, in each direction.
+	Bandwidth int64 `json:"bandwidth,omitempty"`
+	// Metered is reported as the metered state of the source.
+	Metered bool `json:"metered,omitempty"`
+}
+
+// ParseStatic parses the configuration of a Static source, in the form
+// `name[:option,option]`, where the options are latency=<duration>,
+// bandwidth=<bits per second> and metered, e.g.
+// `lte:latency=80ms,bandwidth=20M,metered`. The bandwidth accepts the
+// k, M and G suffixes.
+func ParseStatic(s string) (StaticConfig, error) {
+	parts := strings.SplitN(s, ":", 2)
+	c := StaticConfig{Name: parts[0]}
+	if c.Name == "" {
+		return c, fmt.Errorf("invalid static source %q, expected name[:option,option]", s)
+	}
+	if len(parts) == 1 {
+		return c, nil
+	}
+	for _, v := range strings.Split(parts[1], ",") {
+		kv := strings.SplitN(v, "=", 2)
+		var err error
+		switch kv[0] {
+		case "metered":
+			c.Metered = true
+			if len(kv) == 2 {
+				c.Metered, err = strconv.ParseBool(kv[1])
+			}
+		case "latency":
+			if len(kv) != 2 {
+				return c, fmt.Errorf("static source %s: missing latency value", c.Name)
+			}
+			c.Latency, err = time.ParseDuration(kv[1])
+		case "bandwidth":
+			if len(kv) != 2 {
+				return c, fmt.Errorf("static source %s: missing bandwidth value", c.Name)
+			}
+			c.Bandwidth, err = parseBandwidth(kv[1])
+		default:
+			err = fmt.Errorf("unknown option %q", kv[0])
+		}
+		if err != nil {
+			return c, fmt.Errorf("static source %s: %v", c.Name, err)
+		}
+	}
+	return c, nil
+}
+
+func parseBandwidth(s string) (int64, error) {
+	mul := int64(1)
+	switch {
+	case strings.HasSuffix(s, "k"):
+		mul, s = 1e3, strings.TrimSuffix(s, "k")
+	case strings.HasSuffix(s, "M"):
+		mul, s = 1e6, strings.TrimSuffix(s, "M")
+	case strings.HasSuffix(s, "G"):
+		mul, s = 1e9, strings.TrimSuffix(s, "G")
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if v <= 0 {
+		return 0, fmt.Errorf("bandwidth must be positive")
+	}
+	return int64(v * float64(mul)), nil
+}
+
+// Static is a source that dials its connections through the default
+// route, presenting itself as a named source. Its latency and bandwidth
+// can be limited artificially, making it useful to exercise policies
+// and strategies on machines with a single network interface.
+type Static struct {
+	conf StaticConfig
+
+	// If OnDialErr is not nil, it is called each time that the
+	// source is not able to create a network connection.
+	OnDialErr DialHook
+
+	down, up limiter
+	meter
+}
+
+// NewStatic returns a Static source configured with `c`.
+func NewStatic(c StaticConfig) *Static {
+	rate := c.Bandwidth / 8
+	return &Static{
+		conf: c,
+		down: limiter{rate: rate},
+		up:   limiter{rate: rate},
+	}
+}
+
+// ID implements core.Source.
+func (s *Static) ID() string {
+	return s.conf.Name
+}
+
+// Metered reports the metered state configured.
+func (s *Static) Metered() bool {
+	return s.conf.Metered
+}
+
+// DialContext implements core.Source. The connections returned are
+// followed as Interface.Follow does.
+func (s *Static) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := s.dial(ctx, network, address)
+	if err != nil {
+		if f := s.OnDialErr; f != nil {
+			f(s.ID(), network, address, err)
+		}
+		return nil, err
+	}
+	if s.conf.Bandwidth > 0 {
+		conn = &limitedConn{Conn: conn, s: s}
+	}
+	return s.follow(s.ID(), conn), nil
+}
+
+func (s *Static) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if d := s.conf.Latency; d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	d := &net.Dialer{
+		Control: func(network, address string, c syscall.RawConn) error {
+			return c.Control(func(fd uintptr) {
+				mark(ctx, network, fd)
+				tune(ctx, fd)
+			})
+		},
+	}
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	tuneConn(ctx, conn)
+	return conn, nil
+}
+
+// Close closes the open connections.
+func (s *Static) Close() error {
+	if s.conns != nil {
+		s.conns.Close()
+	}
+	return nil
+}
+
+func (s *Static) String() string {
+	return fmt.Sprintf("%s (static)", s.ID())
+}
+
+// limiter delays the callers so that the amount of data transferred
+// does not exceed `rate` bytes per second.
+type limiter struct {
+	rate int64
+
+	mux  sync.Mutex
+	next time.Time
+}
+
+// burst is the maximum amount of data transferred at once, 50ms worth
+// of data.
+func (l *limiter) burst() int {
+	if b := l.rate / 20; b > 0 {
+		return int(b)
+	}
+	return 1
+}
+
+// wait blocks until `n` bytes can be transferred.
+func (l *limiter) wait(n int) {
+	l.mux.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	d := l.next.Sub(now)
+	l.mux.Unlock()
+
+	time.Sleep(d)
+}
+
+// limitedConn limits the bandwidth of its connection, sharing the
+// limit with the other connections of its source.
+type limitedConn struct {
+	net.Conn
+	s *Static
+}
+
+func (c *limitedConn) Read(p []byte) (int, error) {
+	if b := c.s.down.burst(); len(p) > b {
+		p = p[:b]
+	}
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.s.down.wait(n)
+	}
+	return n, err
+}
+
+func (c *limitedConn) Write(p []byte) (int, error) {
+	var acc int
+	for len(p) > 0 {
+		chunk := p
+		if b := c.s.up.burst(); len(chunk) > b {
+			chunk = chunk[:b]
+		}
+		c.s.up.wait(len(chunk))
+		n, err := c.Conn.Write(chunk)
+		acc += n
+		if err != nil {
+			return acc, err
+		}
+		p = p[n:]
+	}
+	return acc, nil
+}
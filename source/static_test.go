@@ -0,0 +1,126 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package source_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/source"
+)
+
+func TestParseStatic(t *testing.T) {
+	tt := []struct {
+		in  string
+		out source.StaticConfig
+	}{
+		{in: "dev0", out: source.StaticConfig{Name: "dev0"}},
+		{in: "lte:latency=80ms,bandwidth=20M,metered", out: source.StaticConfig{Name: "lte", Latency: time.Millisecond * 80, Bandwidth: 20e6, Metered: true}},
+		{in: "dsl:bandwidth=1.5k,metered=false", out: source.StaticConfig{Name: "dsl", Bandwidth: 1500}},
+	}
+	for i, v := range tt {
+		c, err := source.ParseStatic(v.in)
+		if err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		if c != v.out {
+			t.Fatalf("%d: Unexpected config: wanted %+v, found %+v", i, v.out, c)
+		}
+	}
+
+	for _, v := range []string{"", ":latency=1s", "lte:latency", "lte:latency=x", "lte:bandwidth=0", "lte:foo"} {
+		if _, err := source.ParseStatic(v); err == nil {
+			t.Fatalf("ParseStatic(%q) did not fail", v)
+		}
+	}
+}
+
+func TestStatic(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.CopyN(conn, zeros{}, 20<<10)
+	}()
+
+	p := &source.MergedProvider{
+		Static: []*source.Static{source.NewStatic(source.StaticConfig{
+			Name:      "dev0",
+			Latency:   time.Millisecond * 50,
+			Bandwidth: 800e3, // 100KB/s
+			Metered:   true,
+		})},
+	}
+	srcs, err := p.Provide(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var s *source.Static
+	for _, v := range srcs {
+		if v.ID() == "dev0" {
+			s, _ = v.(*source.Static)
+		}
+	}
+	if s == nil {
+		t.Fatalf("Static source not found in %v", srcs)
+	}
+	if !s.Metered() {
+		t.Fatalf("Static source should report itself as metered")
+	}
+	if err := p.Check(context.Background(), s, source.High); err != nil {
+		t.Fatalf("Unexpected check error: %v", err)
+	}
+
+	t0 := time.Now()
+	conn, err := s.DialContext(context.Background(), "tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected dial error: %v", err)
+	}
+	defer conn.Close()
+	if d := time.Since(t0); d < time.Millisecond*50 {
+		t.Fatalf("Dial took %v, less than the latency configured", d)
+	}
+
+	t0 = time.Now()
+	n, _ := io.Copy(ioutil.Discard, conn)
+	if n != 20<<10 {
+		t.Fatalf("Unexpected data received: wanted %d, found %d", 20<<10, n)
+	}
+	// 20KB at 100KB/s.
+	if d := time.Since(t0); d < time.Millisecond*150 {
+		t.Fatalf("Transfer took %v, faster than the bandwidth configured", d)
+	}
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
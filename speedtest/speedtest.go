@@ -0,0 +1,324 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package speedtest measures the download throughput of the sources,
+// either on demand or periodically, keeping the results of the last
+// tests performed.
+package speedtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+	"upspin.io/log"
+)
+
+// Defaults used when the Tester fields are not set.
+var (
+	DefaultURL      = "http://speed.cloudflare.com/__down?bytes=100000000"
+	DefaultDuration = time.Second * 10
+	DefaultHistory  = 50
+)
+
+// ErrUnknownSource is returned when the source to test is not stored.
+var ErrUnknownSource = errors.New("speedtest: no such source")
+
+// ErrRunning is returned when a test is already running on the source.
+var ErrRunning = errors.New("speedtest: a test is already running on this source")
+
+// Store describes the entity that contains the sources to test.
+type Store interface {
+	Do(func(core.Source))
+}
+
+// Result describes the outcome of a speed test.
+type Result struct {
+	Source   string        `json:"source"`
+	Time     time.Time     `json:"time"`
+	Bytes    int64         `json:"bytes"`
+	Duration time.Duration `json:"duration"`
+	// BitsPerSecond is the throughput measured.
+	BitsPerSecond float64 `json:"bits_per_second"`
+	Error         string  `json:"error,omitempty"`
+}
+
+// Tester performs the speed tests on the sources of its Store. Its
+// zero value is not ready to be used: Store must be set.
+type Tester struct {
+	Store Store
+	// URL is downloaded through the source being tested. It can
+	// point to the `/speedtest/download` endpoint of another booster.
+	URL string
+	// Token, if set, is sent as bearer token with each download, as
+	// required by the `/speedtest/download` endpoint of a booster
+	// whose API has tokens.
+	Token string
+	// Duration is the maximum duration of a test.
+	Duration time.Duration
+	// Interval between the scheduled tests. If 0, tests are only
+	// performed on demand.
+	Interval time.Duration
+	// History is the number of results kept for each source.
+	History int
+
+	mux     sync.Mutex
+	results map[string][]Result
+	running map[string]bool
+}
+
+func (t *Tester) url() string {
+	if t.URL == "" {
+		return DefaultURL
+	}
+	return t.URL
+}
+
+func (t *Tester) duration() time.Duration {
+	if t.Duration <= 0 {
+		return DefaultDuration
+	}
+	return t.Duration
+}
+
+func (t *Tester) history() int {
+	if t.History <= 0 {
+		return DefaultHistory
+	}
+	return t.History
+}
+
+// Run tests each source, one after the other, every Interval, until
+// the context is canceled. If Interval is 0, Run just waits for the
+// context to be canceled.
+func (t *Tester) Run(ctx context.Context) error {
+	for {
+		var wait <-chan time.Time
+		if t.Interval > 0 {
+			wait = time.After(t.Interval)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wait:
+		}
+
+		var sources []core.Source
+		t.Store.Do(func(src core.Source) {
+			sources = append(sources, src)
+		})
+		for _, v := range sources {
+			if _, err := t.Test(ctx, v); err != nil && ctx.Err() == nil {
+				log.Error.Printf("Speedtest: %v: %v", v.ID(), err)
+			}
+		}
+	}
+}
+
+// TestID tests the source identified by `id`.
+func (t *Tester) TestID(ctx context.Context, id string) (Result, error) {
+	var src core.Source
+	t.Store.Do(func(v core.Source) {
+		if v.ID() == id {
+			src = v
+		}
+	})
+	if src == nil {
+		return Result{}, ErrUnknownSource
+	}
+	return t.Test(ctx, src)
+}
+
+// Test measures the download throughput of `src`, saving the result
+// into its history, failed tests included.
+func (t *Tester) Test(ctx context.Context, src core.Source) (Result, error) {
+	t.mux.Lock()
+	if t.running == nil {
+		t.running = make(map[string]bool)
+	}
+	if t.running[src.ID()] {
+		t.mux.Unlock()
+		return Result{}, ErrRunning
+	}
+	t.running[src.ID()] = true
+	t.mux.Unlock()
+
+	res, err := t.test(ctx, src)
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	delete(t.running, src.ID())
+	if ctx.Err() == context.Canceled {
+		return res, err
+	}
+	if t.results == nil {
+		t.results = make(map[string][]Result)
+	}
+	acc := append(t.results[src.ID()], res)
+	if n := len(acc) - t.history(); n > 0 {
+		acc = acc[n:]
+	}
+	t.results[src.ID()] = acc
+
+	return res, err
+}
+
+func (t *Tester) test(ctx context.Context, src core.Source) (Result, error) {
+	res := Result{Source: src.ID(), Time: time.Now()}
+
+	ctx, cancel := context.WithTimeout(ctx, t.duration())
+	defer cancel()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext:       src.DialContext,
+			DisableKeepAlives: true,
+		},
+	}
+	req, err := http.NewRequest("GET", t.url(), nil)
+	if err != nil {
+		return res, err
+	}
+	if t.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.Token)
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return res, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return res, fmt.Errorf("speedtest: unexpected response: %s", resp.Status)
+	}
+
+	// Start measuring after the headers, excluding the connection
+	// setup time from the test.
+	start := time.Now()
+	n, err := io.Copy(ioutil.Discard, resp.Body)
+	res.Duration = time.Since(start)
+	res.Bytes = n
+	if res.Duration > 0 {
+		res.BitsPerSecond = float64(n*8) / res.Duration.Seconds()
+	}
+	if err != nil && ctx.Err() != context.DeadlineExceeded {
+		// Reaching the maximum duration is not an error.
+		return res, err
+	}
+	return res, nil
+}
+
+// Results returns the history of source `id`, oldest first.
+func (t *Tester) Results(id string) []Result {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	acc := make([]Result, len(t.results[id]))
+	copy(acc, t.results[id])
+	return acc
+}
+
+// Snapshot returns the history of each source tested.
+func (t *Tester) Snapshot() map[string][]Result {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	acc := make(map[string][]Result, len(t.results))
+	for id, v := range t.results {
+		acc[id] = make([]Result, len(v))
+		copy(acc[id], v)
+	}
+	return acc
+}
+
+// Capacity returns the throughput, in bits per second, measured
+// by the last successful test of source `id`.
+func (t *Tester) Capacity(id string) (float64, bool) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	acc := t.results[id]
+	for i := len(acc) - 1; i >= 0; i-- {
+		if acc[i].Error == "" {
+			return acc[i].BitsPerSecond, true
+		}
+	}
+	return 0, false
+}
+
+// Strategy is a core.Strategy that chooses the source with the highest
+// capacity, i.e. the highest throughput measured by its last
+// successful test. Sources never tested come last, and sources with
+// the same capacity are returned in round robin order.
+func (t *Tester) Strategy(ctx context.Context, r *core.Ring) (core.Source, error) {
+	var best core.Source
+	var bestCapacity float64
+	steps, i := 0, 0
+	// Start from the next position, so that ties rotate.
+	r.Next()
+	r.Do(func(src core.Source) {
+		defer func() { i++ }()
+		if src == nil || core.Blacklisted(ctx, src.ID()) {
+			return
+		}
+		if c, _ := t.Capacity(src.ID()); best == nil || c > bestCapacity {
+			best, bestCapacity, steps = src, c, i
+		}
+	})
+	if best == nil {
+		// Every source is blacklisted: let the balancer fail.
+		return r.Source(), nil
+	}
+	for ; steps > 0; steps-- {
+		r.Next()
+	}
+	return best, nil
+}
+
+// MaxDownload is the maximum number of bytes served by DownloadHandler.
+var MaxDownload int64 = 1 << 30
+
+var zeros = make([]byte, 32*1024)
+
+// DownloadHandler serves the number of bytes requested with the
+// `bytes` query parameter, allowing booster to act as a speed test peer.
+func DownloadHandler(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.ParseInt(r.URL.Query().Get("bytes"), 10, 64)
+	if err != nil || n < 0 || n > MaxDownload {
+		n = MaxDownload
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+	for n > 0 {
+		b := zeros
+		if n < int64(len(b)) {
+			b = b[:n]
+		}
+		m, err := w.Write(b)
+		if err != nil {
+			return
+		}
+		n -= int64(m)
+	}
+}
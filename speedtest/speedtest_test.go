@@ -0,0 +1,137 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package speedtest_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/speedtest"
+)
+
+type mock struct {
+	id string
+	net.Dialer
+}
+
+func (s *mock) ID() string {
+	return s.id
+}
+
+func (s *mock) Close() error {
+	return nil
+}
+
+type store []core.Source
+
+func (s store) Do(f func(core.Source)) {
+	for _, v := range s {
+		f(v)
+	}
+}
+
+func TestTest(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", speedtest.DownloadHandler)
+	mux.Handle("/missing", http.NotFoundHandler())
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	s0 := &mock{id: "s0"}
+	tester := &speedtest.Tester{
+		Store:    store{s0},
+		URL:      srv.URL + "?bytes=1000000",
+		Duration: time.Second,
+		History:  2,
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		res, err := tester.TestID(ctx, s0.ID())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Bytes != 1000000 || res.BitsPerSecond <= 0 {
+			t.Fatalf("Unexpected result: %+v", res)
+		}
+	}
+	if n := len(tester.Results(s0.ID())); n != 2 {
+		t.Fatalf("Unexpected history length: wanted 2, found %d", n)
+	}
+	if _, ok := tester.Capacity(s0.ID()); !ok {
+		t.Fatalf("Capacity of %v should be known", s0)
+	}
+
+	if _, err := tester.TestID(ctx, "foo"); err != speedtest.ErrUnknownSource {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Failed tests are recorded as well.
+	tester.URL = srv.URL + "/missing"
+	if _, err := tester.Test(ctx, s0); err == nil {
+		t.Fatal("Expected an error")
+	}
+	res := tester.Results(s0.ID())
+	if res[len(res)-1].Error == "" {
+		t.Fatalf("Failed test was not recorded: %+v", res)
+	}
+}
+
+func TestStrategy(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", speedtest.DownloadHandler)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	s0 := &mock{id: "s0"}
+	s1 := &mock{id: "s1"}
+	tester := &speedtest.Tester{
+		Store:    store{s0, s1},
+		URL:      srv.URL + "?bytes=100000",
+		Duration: time.Second,
+	}
+	ctx := context.Background()
+	if _, err := tester.TestID(ctx, s1.ID()); err != nil {
+		t.Fatal(err)
+	}
+
+	b := &core.Balancer{Strategy: tester.Strategy}
+	b.Put(s0, s1)
+	for i := 0; i < 3; i++ {
+		src, err := b.Get(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if src.ID() != s1.ID() {
+			t.Fatalf("Unexpected source: wanted %v, found %v", s1.ID(), src.ID())
+		}
+	}
+
+	// Sources never tested are still used, when the others are not
+	// available.
+	src, err := b.Get(ctx, s1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.ID() != s0.ID() {
+		t.Fatalf("Unexpected source: wanted %v, found %v", s0.ID(), src.ID())
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package bench provides a harness that stresses a `store.SourceStore`
+// backed by a `core.Balancer`, measuring how `Get`, `Put`/`Del` and policy
+// evaluation behave under a configurable amount of sources, policies
+// and concurrent callers.
+package bench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/store"
+)
+
+// Config describes the workload produced by Run.
+type Config struct {
+	// Sources is the number of synthetic sources stored.
+	Sources int
+	// Policies is the number of avoid policies appended to the store.
+	// Each policy avoids one source for one target.
+	Policies int
+	// Targets is the number of distinct addresses requested.
+	Targets int
+	// Concurrency is the number of goroutines calling Get concurrently.
+	Concurrency int
+	// Iterations is the number of Get calls performed by each goroutine.
+	Iterations int
+	// Churn, if true, makes an additional goroutine continuously remove
+	// and add sources while the Get calls are running.
+	Churn bool
+}
+
+// DefaultConfig is the configuration used when a zero value field is found.
+var DefaultConfig = Config{
+	Sources:     4,
+	Policies:    4,
+	Targets:     16,
+	Concurrency: 8,
+	Iterations:  10000,
+}
+
+func (c Config) withDefaults() Config {
+	if c.Sources <= 0 {
+		c.Sources = DefaultConfig.Sources
+	}
+	if c.Policies < 0 {
+		c.Policies = 0
+	}
+	if c.Targets <= 0 {
+		c.Targets = DefaultConfig.Targets
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = DefaultConfig.Concurrency
+	}
+	if c.Iterations <= 0 {
+		c.Iterations = DefaultConfig.Iterations
+	}
+	return c
+}
+
+// Stats contains the latency distribution of an operation.
+type Stats struct {
+	Ops    int           `json:"ops"`
+	Errors int           `json:"errors"`
+	Total  time.Duration `json:"total"`
+	Avg    time.Duration `json:"avg"`
+	P50    time.Duration `json:"p50"`
+	P99    time.Duration `json:"p99"`
+	Max    time.Duration `json:"max"`
+}
+
+// Result is the outcome of a Run.
+type Result struct {
+	Config    Config        `json:"config"`
+	Elapsed   time.Duration `json:"elapsed"`
+	Get       Stats         `json:"get"`
+	Blacklist Stats         `json:"blacklist"`
+	Churn     Stats         `json:"churn"`
+}
+
+// OpsPerSecond returns the Get throughput measured in the run.
+func (r *Result) OpsPerSecond() float64 {
+	if r.Elapsed == 0 {
+		return 0
+	}
+	return float64(r.Get.Ops) / r.Elapsed.Seconds()
+}
+
+// Fprint writes a human readable report of r into w.
+func (r *Result) Fprint(w io.Writer) {
+	c := r.Config
+	fmt.Fprintf(w, "sources=%d policies=%d targets=%d concurrency=%d iterations=%d churn=%v\n",
+		c.Sources, c.Policies, c.Targets, c.Concurrency, c.Iterations, c.Churn)
+	fmt.Fprintf(w, "elapsed=%v get/s=%.0f\n", r.Elapsed, r.OpsPerSecond())
+	FprintStats(w, "get", r.Get)
+	FprintStats(w, "blacklist", r.Blacklist)
+	if c.Churn {
+		FprintStats(w, "put/del", r.Churn)
+	}
+}
+
+// FprintStats writes a line describing `s`, the statistics of
+// operation `name`, into w.
+func FprintStats(w io.Writer, name string, s Stats) {
+	fmt.Fprintf(w, "%-10s ops=%-8d errors=%-6d avg=%-10v p50=%-10v p99=%-10v max=%v\n",
+		name, s.Ops, s.Errors, s.Avg, s.P50, s.P99, s.Max)
+}
+
+// Run builds a store as described by c and measures its performance.
+// It returns early with ctx's error if the context is canceled.
+func Run(ctx context.Context, c Config) (*Result, error) {
+	c = c.withDefaults()
+
+	// Ensure that policies do not trigger any actual DNS lookup.
+	resolver := store.Resolver
+	store.Resolver = nopResolver{}
+	defer func() { store.Resolver = resolver }()
+
+	sources := make([]core.Source, c.Sources)
+	for i := range sources {
+		sources[i] = &source{id: fmt.Sprintf("s%d", i)}
+	}
+	targets := make([]string, c.Targets)
+	for i := range targets {
+		targets[i] = fmt.Sprintf("10.0.%d.%d:443", i/256, i%256)
+	}
+
+	s := store.New(new(core.Balancer))
+	s.Put(sources...)
+	for i := 0; i < c.Policies; i++ {
+		src := sources[i%len(sources)]
+		// Avoid picking always the same target for the same source.
+		target := targets[(i/len(sources)+i)%len(targets)]
+		if err := s.AppendPolicy(store.NewAvoidPolicy("bench", src.ID(), target)); err != nil {
+			return nil, err
+		}
+	}
+
+	res := &Result{Config: c}
+	getc := make(chan []time.Duration, c.Concurrency)
+	var errs struct {
+		sync.Mutex
+		n int
+	}
+
+	done := make(chan struct{})
+	churnc := make(chan []time.Duration, 1)
+	if c.Churn {
+		go func() {
+			churnc <- churn(s, sources, done)
+		}()
+	}
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < c.Concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			acc := make([]time.Duration, 0, c.Iterations)
+			for j := 0; j < c.Iterations; j++ {
+				if ctx.Err() != nil {
+					break
+				}
+				target := targets[(i+j)%len(targets)]
+				t0 := time.Now()
+				_, err := s.Get(ctx, target)
+				acc = append(acc, time.Since(t0))
+				if err != nil {
+					errs.Lock()
+					errs.n++
+					errs.Unlock()
+				}
+			}
+			getc <- acc
+		}(i)
+	}
+	wg.Wait()
+	res.Elapsed = time.Since(start)
+	close(done)
+	close(getc)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	all := make([]time.Duration, 0, c.Concurrency*c.Iterations)
+	for v := range getc {
+		all = append(all, v...)
+	}
+	res.Get = MakeStats(all)
+	res.Get.Errors = errs.n
+
+	// Measure blacklist computation alone, without contention.
+	bl := make([]time.Duration, 0, c.Iterations)
+	for j := 0; j < c.Iterations; j++ {
+		t0 := time.Now()
+		s.MakeBlacklist(targets[j%len(targets)])
+		bl = append(bl, time.Since(t0))
+	}
+	res.Blacklist = MakeStats(bl)
+
+	if c.Churn {
+		res.Churn = MakeStats(<-churnc)
+	}
+
+	return res, nil
+}
+
+func churn(s *store.SourceStore, sources []core.Source, done <-chan struct{}) []time.Duration {
+	acc := []time.Duration{}
+	for i := 0; ; i++ {
+		select {
+		case <-done:
+			return acc
+		default:
+		}
+		// Never remove the last source, Get would fail otherwise.
+		src := sources[i%len(sources)]
+		if len(sources) == 1 {
+			src = &source{id: "churn"}
+		}
+
+		t0 := time.Now()
+		s.Del(src)
+		s.Put(src)
+		acc = append(acc, time.Since(t0))
+	}
+}
+
+// MakeStats computes the latency distribution of the operations that
+// took `d`. The slice is sorted in place.
+func MakeStats(d []time.Duration) Stats {
+	if len(d) == 0 {
+		return Stats{}
+	}
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+
+	var total time.Duration
+	for _, v := range d {
+		total += v
+	}
+	return Stats{
+		Ops:   len(d),
+		Total: total,
+		Avg:   total / time.Duration(len(d)),
+		P50:   d[len(d)/2],
+		P99:   d[len(d)*99/100],
+		Max:   d[len(d)-1],
+	}
+}
+
+// source is a core.Source that is not able to dial any connection.
+type source struct {
+	id string
+}
+
+func (s *source) ID() string {
+	return s.id
+}
+
+func (s *source) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return nil, errors.New("bench: synthetic sources cannot dial connections")
+}
+
+func (s *source) Close() error {
+	return nil
+}
+
+func (s *source) String() string {
+	return s.id
+}
+
+// nopResolver resolves each address to itself.
+type nopResolver struct{}
+
+func (nopResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return []string{host}, nil
+}
+
+func (nopResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	return []string{addr}, nil
+}
@@ -0,0 +1,74 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package bench_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/booster-proj/booster/store/bench"
+)
+
+func TestRun(t *testing.T) {
+	c := bench.Config{
+		Sources:     3,
+		Policies:    2,
+		Targets:     4,
+		Concurrency: 2,
+		Iterations:  100,
+		Churn:       true,
+	}
+	res, err := bench.Run(context.Background(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := c.Concurrency * c.Iterations
+	if res.Get.Ops != n {
+		t.Fatalf("Unexpected get ops: wanted %d, found %d", n, res.Get.Ops)
+	}
+	if res.Blacklist.Ops != c.Iterations {
+		t.Fatalf("Unexpected blacklist ops: wanted %d, found %d", c.Iterations, res.Blacklist.Ops)
+	}
+	if res.Get.P50 > res.Get.P99 || res.Get.P99 > res.Get.Max {
+		t.Fatalf("Unexpected latency distribution: %+v", res.Get)
+	}
+
+	var buf bytes.Buffer
+	res.Fprint(&buf)
+	if buf.Len() == 0 {
+		t.Fatal("Empty report")
+	}
+	t.Log(buf.String())
+}
+
+func TestRun_cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := bench.Run(ctx, bench.Config{}); err != ctx.Err() {
+		t.Fatalf("Unexpected error: wanted %v, found %v", ctx.Err(), err)
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := bench.Run(context.Background(), bench.Config{Iterations: 1000}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/booster-proj/booster/core"
+	"upspin.io/log"
+)
+
+// Default limits of the bind history.
+const (
+	DefaultBindHistorySize   = 1 << 16
+	DefaultBindHistoryMemory = 16 << 20
+)
+
+// ErrUnknownSource is returned when pinning a binding to a source that
+// is not stored.
+var ErrUnknownSource = errors.New("source store: no such source")
+
+// bindingOverhead is the estimated size in bytes of an entry of the
+// bind history, excluding its strings: map bucket, list element and
+// string headers.
+const bindingOverhead = 128
+
+type binding struct {
+	address, source string
+}
+
+func (b *binding) size() int64 {
+	return int64(len(b.address) + len(b.source) + bindingOverhead)
+}
+
+// bindHistory maps the addresses to the sources that received the
+// connections to them, evicting the least recently used entries once
+// its limits are reached.
+type bindHistory struct {
+	sync.Mutex
+	record  bool
+	entries map[string]*list.Element // of *binding
+	lru     list.List                // most recently used first
+	bytes   int64
+	// pins are the bindings set manually, which are kept apart from
+	// the entries and never evicted. pinned contains the addresses
+	// of each host pinned.
+	pins   map[string]string
+	pinned map[string][]string
+
+	hits, misses, evictions uint64
+}
+
+// reset discards the entries and the statistics, but not the pins.
+func (h *bindHistory) reset() {
+	h.entries = make(map[string]*list.Element)
+	h.lru.Init()
+	h.bytes = 0
+	h.hits, h.misses, h.evictions = 0, 0, 0
+}
+
+// put binds `address` to `source`, evicting the least recently used
+// entries beyond `maxEntries` and `maxBytes`, if not 0.
+func (h *bindHistory) put(address, source string, maxEntries int, maxBytes int64) {
+	address = bindingKey(address)
+	if _, ok := h.pins[address]; ok {
+		return
+	}
+	if e, ok := h.entries[address]; ok {
+		b := e.Value.(*binding)
+		h.bytes += int64(len(source) - len(b.source))
+		b.source = source
+		h.lru.MoveToFront(e)
+	} else {
+		b := &binding{address: address, source: source}
+		h.entries[address] = h.lru.PushFront(b)
+		h.bytes += b.size()
+	}
+
+	for h.lru.Len() > 1 && ((maxEntries > 0 && h.lru.Len() > maxEntries) || (maxBytes > 0 && h.bytes > maxBytes)) {
+		h.remove(h.lru.Back())
+		h.evictions++
+	}
+}
+
+func (h *bindHistory) remove(e *list.Element) {
+	b := h.lru.Remove(e).(*binding)
+	delete(h.entries, b.address)
+	h.bytes -= b.size()
+}
+
+// SaveBindHistory saves the association of an address with a source. It
+// performs the operation only if it is required, as this is a time
+// consuming operation (potentially, due to DNS lookup).
+func (ss *SourceStore) SaveBindHistory(ctx context.Context, id, address string) {
+	// Save bind history only if required.
+	ss.bindHistory.Lock()
+	record := ss.bindHistory.record
+	ss.bindHistory.Unlock()
+	if !record {
+		return
+	}
+
+	// Find all addresses associated with `address`. First check if
+	// is is an IP address or an hostname. In the former case
+	// find an hostname pointing to this ip.
+	host := address
+	if ip := net.ParseIP(address); ip != nil {
+		// It is an IP
+		hosts, err := ss.resolver().LookupAddr(ctx, address)
+		if err != nil {
+			log.Error.Printf("SourceStore: SaveBindHistory error: %v", err)
+			return
+		}
+		if len(hosts) == 0 {
+			log.Error.Printf("SourceStore: SaveBindHistory error: no hosts associated with %s found", address)
+			return
+		}
+		// we just need one host, no matter which one.
+		host = hosts[0]
+	}
+	// The sticky policy may apply only to some destinations: the
+	// others are not recorded.
+	if p := ss.stickyPolicy(); p != nil && !p.Covers(host) {
+		return
+	}
+
+	addrs, err := ss.resolver().LookupHost(ctx, host)
+	if err != nil {
+		log.Error.Printf("SourceStore: SaveBindHistory error: %v", err)
+		return
+	}
+
+	// The lookups are done without holding the lock, which could
+	// have been released in the meanwhile.
+	h := &ss.bindHistory
+	h.Lock()
+	defer h.Unlock()
+	if !h.record {
+		return
+	}
+	// The connection is a hit if its destination was already bound.
+	hit := false
+	for _, v := range addrs {
+		_, ok := h.entries[bindingKey(v)]
+		hit = hit || ok
+	}
+	if hit {
+		h.hits++
+	} else {
+		h.misses++
+	}
+	for _, v := range addrs {
+		h.put(v, id, ss.BindHistorySize, ss.BindHistoryMemory)
+	}
+}
+
+// RecordBindHistory makes the store keep track of which source is
+// assigned to which address.
+func (ss *SourceStore) RecordBindHistory() {
+	ss.bindHistory.Lock()
+	defer ss.bindHistory.Unlock()
+
+	ss.bindHistory.reset()
+	ss.bindHistory.record = true
+}
+
+// StopRecordingBindHistory makes the store stop tracking which source is
+// assigned to which address. The old history, if any, is discarded.
+func (ss *SourceStore) StopRecordingBindHistory() {
+	ss.bindHistory.Lock()
+	defer ss.bindHistory.Unlock()
+
+	ss.bindHistory.reset()
+	ss.bindHistory.record = false
+}
+
+// bindingKey returns the key of the bindings of `address`: the pinned
+// hosts are matched regardless of the port, the case and the trailing
+// dot.
+func bindingKey(address string) string {
+	return strings.TrimSuffix(strings.ToLower(TrimPort(address)), ".")
+}
+
+// QueryBindHistory queries the bindHistory for address.
+func (ss *SourceStore) QueryBindHistory(address string) (src string, ok bool) {
+	address = bindingKey(address)
+
+	ss.bindHistory.Lock()
+	defer ss.bindHistory.Unlock()
+
+	if src, ok := ss.bindHistory.pins[address]; ok {
+		return src, true
+	}
+	e, ok := ss.bindHistory.entries[address]
+	if !ok {
+		return "", false
+	}
+	ss.bindHistory.lru.MoveToFront(e)
+	return e.Value.(*binding).source, true
+}
+
+// BindHistoryStats describes the bind history, so that its limits can
+// be tuned.
+type BindHistoryStats struct {
+	// Recording is true when a sticky policy is applied.
+	Recording bool `json:"recording"`
+	Entries   int  `json:"entries"`
+	// Pinned is the number of hosts pinned, which are not part of
+	// the entries.
+	Pinned int `json:"pinned"`
+	// Bytes is the estimated size of the entries.
+	Bytes      int64 `json:"bytes"`
+	MaxEntries int   `json:"max_entries"`
+	MaxBytes   int64 `json:"max_bytes"`
+	// Hits are the connections whose destination was already bound
+	// to a source, Misses the other ones.
+	Hits      uint64  `json:"hits"`
+	Misses    uint64  `json:"misses"`
+	HitRate   float64 `json:"hit_rate"`
+	Evictions uint64  `json:"evictions"`
+	// Sources contains the number of addresses bound to each
+	// source.
+	Sources map[string]int `json:"sources"`
+}
+
+// BindHistoryStats returns the statistics of the bind history.
+func (ss *SourceStore) BindHistoryStats() BindHistoryStats {
+	h := &ss.bindHistory
+	h.Lock()
+	defer h.Unlock()
+
+	stats := BindHistoryStats{
+		Recording:  h.record,
+		Entries:    h.lru.Len(),
+		Pinned:     len(h.pinned),
+		Bytes:      h.bytes,
+		MaxEntries: ss.BindHistorySize,
+		MaxBytes:   ss.BindHistoryMemory,
+		Hits:       h.hits,
+		Misses:     h.misses,
+		Evictions:  h.evictions,
+		Sources:    make(map[string]int),
+	}
+	if n := h.hits + h.misses; n > 0 {
+		stats.HitRate = float64(h.hits) / float64(n)
+	}
+	for e := h.lru.Front(); e != nil; e = e.Next() {
+		stats.Sources[e.Value.(*binding).source]++
+	}
+	return stats
+}
+
+// Binding is an entry of the bind history.
+type Binding struct {
+	Address string `json:"address"`
+	Source  string `json:"source"`
+	// Pinned bindings are set with PinBinding, and never evicted.
+	Pinned bool `json:"pinned,omitempty"`
+	// Addresses are the addresses of the pinned hosts.
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// Bindings returns the pinned bindings, sorted by address, followed
+// by the ones recorded, the most recently used first.
+func (ss *SourceStore) Bindings() []Binding {
+	h := &ss.bindHistory
+	h.Lock()
+	defer h.Unlock()
+
+	acc := make([]Binding, 0, len(h.pinned)+h.lru.Len())
+	for host, addrs := range h.pinned {
+		acc = append(acc, Binding{Address: host, Source: h.pins[host], Pinned: true, Addresses: addrs})
+	}
+	sort.Slice(acc, func(i, j int) bool { return acc[i].Address < acc[j].Address })
+	for e := h.lru.Front(); e != nil; e = e.Next() {
+		b := e.Value.(*binding)
+		acc = append(acc, Binding{Address: b.address, Source: b.source})
+	}
+	return acc
+}
+
+// PinBinding binds `address`, and the addresses it resolves to, to
+// source `id` until DelBinding is called, e.g. to always use the same
+// source for a host. As the other bindings, the pinned ones are
+// enforced by the sticky policy. Returns ErrUnknownSource if source
+// `id` is not stored, as the sticky policy would refuse every source
+// for the host.
+func (ss *SourceStore) PinBinding(ctx context.Context, address, id string) (Binding, error) {
+	found := false
+	ss.Do(func(src core.Source) {
+		found = found || src.ID() == id
+	})
+	if !found {
+		return Binding{}, ErrUnknownSource
+	}
+
+	host := bindingKey(address)
+	addrs, err := ss.resolver().LookupHost(ctx, host)
+	if err != nil {
+		return Binding{}, fmt.Errorf("source store: unable to resolve %s: %v", host, err)
+	}
+
+	h := &ss.bindHistory
+	h.Lock()
+	defer h.Unlock()
+
+	h.unpin(host)
+	if h.pins == nil {
+		h.pins = make(map[string]string)
+		h.pinned = make(map[string][]string)
+	}
+	var acc []string
+	for _, v := range append([]string{host}, addrs...) {
+		v = bindingKey(v)
+		if e, ok := h.entries[v]; ok {
+			h.remove(e)
+		}
+		if _, ok := h.pins[v]; !ok || v == host {
+			h.pins[v] = id
+			if v != host {
+				acc = append(acc, v)
+			}
+		}
+	}
+	h.pinned[host] = acc
+	return Binding{Address: host, Source: id, Pinned: true, Addresses: acc}, nil
+}
+
+// DelBinding removes the binding of `address`, either pinned or
+// recorded. Removing a pinned host removes the bindings of its
+// addresses as well.
+func (ss *SourceStore) DelBinding(address string) error {
+	address = bindingKey(address)
+
+	h := &ss.bindHistory
+	h.Lock()
+	defer h.Unlock()
+
+	if h.unpin(address) {
+		return nil
+	}
+	if e, ok := h.entries[address]; ok {
+		h.remove(e)
+		return nil
+	}
+	return fmt.Errorf("source store: no binding of %s found", address)
+}
+
+// unpin removes the pinned `host` and its addresses, reporting whether
+// it was pinned.
+func (h *bindHistory) unpin(host string) bool {
+	addrs, ok := h.pinned[host]
+	if !ok {
+		return false
+	}
+	for _, v := range addrs {
+		delete(h.pins, v)
+	}
+	delete(h.pins, host)
+	delete(h.pinned, host)
+	return true
+}
@@ -0,0 +1,101 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"sync/atomic"
+
+	"github.com/booster-proj/booster/core"
+)
+
+// A StaticPolicy is a Policy whose decisions depend only on the source
+// and the address evaluated and on the state of the store, i.e. the
+// sources, policies, groups and metered tags. The store caches the
+// decisions of the static policies, which are evaluated again only when
+// that state changes.
+type StaticPolicy interface {
+	Policy
+	Static() bool
+}
+
+// maxBlacklists is the maximum number of addresses whose blacklist is
+// cached. When it is reached, the cache is emptied.
+const maxBlacklists = 4096
+
+// blacklistCache contains, for each address, the identifiers of the
+// sources refused by the static policies, each associated with the
+// identifier of the policy refusing it.
+type blacklistCache struct {
+	gen uint64
+	val map[string]map[string]string
+}
+
+func static(p Policy) bool {
+	sp, ok := p.(StaticPolicy)
+	return ok && sp.Static()
+}
+
+// invalidate discards the cached blacklists. Call it after each change
+// that may affect the decisions of the static policies.
+func (ss *SourceStore) invalidate() {
+	atomic.AddUint64(&ss.gen, 1)
+}
+
+// generation returns the current generation of the cached blacklists.
+// Load it before reading the state the blacklists are computed from,
+// so that a concurrent change is never cached as current.
+func (ss *SourceStore) generation() uint64 {
+	return atomic.LoadUint64(&ss.gen)
+}
+
+// staticBlacklist returns the identifiers of the sources in `sources`
+// that are refused by the static policies in `policies` for `address`,
+// each mapped to the identifier of the policy refusing it.
+// `gen` is the generation loaded before collecting `sources` and
+// `policies`.
+func (ss *SourceStore) staticBlacklist(gen uint64, address string, sources []core.Source, policies []Policy) map[string]string {
+	ss.blacklists.RLock()
+	bl, ok := ss.blacklists.val.val[address]
+	ok = ok && ss.blacklists.val.gen == gen
+	ss.blacklists.RUnlock()
+	if ok {
+		return bl
+	}
+
+	bl = make(map[string]string)
+	for _, src := range sources {
+		for _, p := range policies {
+			if static(p) && !ss.accept(p, src.ID(), address) {
+				bl[src.ID()] = p.ID()
+				break
+			}
+		}
+	}
+
+	ss.blacklists.Lock()
+	defer ss.blacklists.Unlock()
+	c := &ss.blacklists.val
+	if c.gen > gen {
+		// The state changed in the meanwhile.
+		return bl
+	}
+	if c.gen < gen || c.val == nil || len(c.val) >= maxBlacklists {
+		c.gen = gen
+		c.val = make(map[string]map[string]string)
+	}
+	c.val[address] = bl
+	return bl
+}
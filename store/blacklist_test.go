@@ -0,0 +1,161 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/store"
+)
+
+// staticPolicy refuses source `id` and counts its evaluations.
+type staticPolicy struct {
+	id    string
+	calls int
+}
+
+func (p *staticPolicy) ID() string   { return "static_" + p.id }
+func (p *staticPolicy) Static() bool { return true }
+
+func (p *staticPolicy) Accept(id, address string) bool {
+	p.calls++
+	return id != p.id
+}
+
+func TestMakeBlacklist_cache(t *testing.T) {
+	s0, s1 := &mock{id: "s0"}, &mock{id: "s1"}
+	s := store.New(&storage{data: []core.Source{s0, s1}})
+
+	p := &staticPolicy{id: "s0"}
+	s.AppendPolicy(p)
+	var dynamic int
+	s.AppendPolicy(&store.GenPolicy{
+		Name: "dynamic",
+		AcceptFunc: func(id, address string) bool {
+			dynamic++
+			return true
+		},
+	})
+
+	assert := func(i, calls int) {
+		bl := s.MakeBlacklist("host:443")
+		if len(bl) != 1 || bl[0].ID() != "s0" {
+			t.Fatalf("%d: Unexpected blacklist: %v", i, bl)
+		}
+		if p.calls != calls {
+			t.Fatalf("%d: Unexpected static policy evaluations: wanted %d, found %d", i, calls, p.calls)
+		}
+	}
+
+	assert(0, 2)
+	assert(1, 2)
+	if dynamic != 2 {
+		t.Fatalf("Unexpected dynamic policy evaluations: wanted 2, found %d", dynamic)
+	}
+
+	// Adding a source invalidates the cache.
+	s.Put(&mock{id: "s2"})
+	assert(2, 5)
+	assert(3, 5)
+
+	// So does changing the policies.
+	s.DelPolicy("dynamic")
+	assert(4, 8)
+
+	// Other addresses are computed on their own.
+	s.MakeBlacklist("other:443")
+	if p.calls != 11 {
+		t.Fatalf("Unexpected static policy evaluations: wanted 11, found %d", p.calls)
+	}
+}
+
+func TestMakeBlacklist_concurrentPut(t *testing.T) {
+	s0, s1 := &mock{id: "s0"}, &mock{id: "s1"}
+	data := &storage{data: []core.Source{s0, s1}}
+	s := store.New(data)
+	s.AppendPolicy(&staticPolicy{id: "s2"})
+
+	// s2 is added after the sources were collected, but before the
+	// blacklist is cached.
+	data.afterDo = func() {
+		s.Put(&mock{id: "s2"})
+	}
+	if bl := s.MakeBlacklist("host:443"); len(bl) != 0 {
+		t.Fatalf("Unexpected blacklist: %v", bl)
+	}
+	if bl := s.MakeBlacklist("host:443"); len(bl) != 1 || bl[0].ID() != "s2" {
+		t.Fatalf("Unexpected blacklist after the source was added: %v", bl)
+	}
+}
+
+func TestMakeBlacklist_concurrentAppendPolicy(t *testing.T) {
+	sources := make([]core.Source, 8)
+	for i := range sources {
+		sources[i] = &mock{id: fmt.Sprintf("s%d", i)}
+	}
+	s := store.New(&storage{data: sources})
+	s.AppendPolicy(store.NewBlockPolicy("T", "none"))
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				s.MakeBlacklist("host:443")
+			}
+		}
+	}()
+	for _, src := range sources {
+		s.AppendPolicy(store.NewBlockPolicy("T", src.ID()))
+	}
+	close(done)
+	wg.Wait()
+
+	if bl := s.MakeBlacklist("host:443"); len(bl) != len(sources) {
+		t.Fatalf("Unexpected blacklist: wanted %d sources, found %v", len(sources), bl)
+	}
+}
+
+func TestPolicyHits(t *testing.T) {
+	s0, s1 := &mock{id: "s0"}, &mock{id: "s1"}
+	s := store.New(&storage{index: 1, data: []core.Source{s0, s1}})
+	s.AppendPolicy(&staticPolicy{id: "s0"})
+
+	for i := 0; i < 3; i++ {
+		if src, err := s.Get(context.Background(), "host:443"); err != nil || src.ID() != "s1" {
+			t.Fatalf("%d: Unexpected source: %v, %v", i, src, err)
+		}
+	}
+	// Computing the blacklist is not a hit.
+	s.MakeBlacklist("host:443")
+	if hits := s.PolicyHits(); hits["static_s0"] != 3 {
+		t.Fatalf("Unexpected hits: %v", hits)
+	}
+
+	s.DelPolicy("static_s0")
+	if hits := s.PolicyHits(); len(hits) != 0 {
+		t.Fatalf("Unexpected hits: %v", hits)
+	}
+}
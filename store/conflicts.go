@@ -0,0 +1,144 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"fmt"
+)
+
+// Conflict kinds.
+const (
+	// ConflictContradiction is used when two policies, combined,
+	// make some connections impossible to satisfy.
+	ConflictContradiction = "contradiction"
+	// ConflictShadowing is used when a policy is made useless
+	// by another one.
+	ConflictShadowing = "shadowing"
+)
+
+// Conflict describes a problematic interaction between two policies.
+type Conflict struct {
+	Kind string `json:"kind"`
+	// PolicyID is the identifier of the policy being analyzed.
+	PolicyID string `json:"policy_id"`
+	// OtherID is the identifier of the policy that conflicts with it.
+	OtherID string `json:"other_id"`
+	Desc    string `json:"description"`
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s between %s and %s: %s", c.Kind, c.PolicyID, c.OtherID, c.Desc)
+}
+
+// FindConflicts analyzes `p` against the `existing` policies, returning
+// the contradictions and shadowings found. Only the policies whose
+// behaviour is known are inspected, i.e. GenPolicy is always ignored.
+func FindConflicts(p Policy, existing []Policy) []Conflict {
+	acc := []Conflict{}
+	for _, v := range existing {
+		if v.ID() == p.ID() {
+			continue
+		}
+		acc = append(acc, findConflicts(p, v)...)
+	}
+	return acc
+}
+
+func findConflicts(p, o Policy) []Conflict {
+	contradiction := func(format string, args ...interface{}) []Conflict {
+		return []Conflict{{
+			Kind:     ConflictContradiction,
+			PolicyID: p.ID(),
+			OtherID:  o.ID(),
+			Desc:     fmt.Sprintf(format, args...),
+		}}
+	}
+	shadowing := func(format string, args ...interface{}) []Conflict {
+		return []Conflict{{
+			Kind:     ConflictShadowing,
+			PolicyID: p.ID(),
+			OtherID:  o.ID(),
+			Desc:     fmt.Sprintf(format, args...),
+		}}
+	}
+
+	switch p := p.(type) {
+	case *BlockPolicy:
+		switch o := o.(type) {
+		case *ReservedPolicy:
+			if p.SourceID == o.SourceID {
+				return contradiction("source %s is blocked, but it is the only one allowed to connect to %v", p.SourceID, o.Addrs)
+			}
+		case *AvoidPolicy:
+			if p.SourceID == o.SourceID {
+				return shadowing("source %s is blocked, avoiding it for %s has no effect", p.SourceID, o.Address)
+			}
+		}
+	case *ReservedPolicy:
+		switch o := o.(type) {
+		case *BlockPolicy:
+			if p.SourceID == o.SourceID {
+				return contradiction("source %s is reserved for %v, but it is blocked", p.SourceID, p.Addrs)
+			}
+		case *ReservedPolicy:
+			if common := intersect(p.Addrs, o.Addrs); p.SourceID != o.SourceID && len(common) > 0 && p.Ports.overlaps(o.Ports) {
+				return contradiction("%v are reserved both to source %s and %s, no source will be able to connect to them", common, p.SourceID, o.SourceID)
+			}
+		case *AvoidPolicy:
+			common := intersect(p.Addrs, o.Addrs)
+			if len(common) == 0 || !p.Ports.overlaps(o.Ports) {
+				break
+			}
+			if p.SourceID == o.SourceID {
+				return contradiction("source %s is reserved for %v, but it also has to avoid them", p.SourceID, common)
+			}
+			return shadowing("%v are reserved to source %s, avoiding source %s for them has no effect", common, p.SourceID, o.SourceID)
+		}
+	case *AvoidPolicy:
+		switch o := o.(type) {
+		case *BlockPolicy:
+			if p.SourceID == o.SourceID {
+				return shadowing("source %s is already blocked, avoiding it for %s has no effect", p.SourceID, p.Address)
+			}
+		case *ReservedPolicy:
+			common := intersect(p.Addrs, o.Addrs)
+			if len(common) == 0 || !p.Ports.overlaps(o.Ports) {
+				break
+			}
+			if p.SourceID == o.SourceID {
+				return contradiction("source %s has to avoid %v, but it is reserved for them", p.SourceID, common)
+			}
+			return shadowing("%v are already reserved to source %s, avoiding source %s for them has no effect", common, o.SourceID, p.SourceID)
+		}
+	}
+
+	return []Conflict{}
+}
+
+func intersect(a, b []string) []string {
+	m := make(map[string]bool, len(a))
+	for _, v := range a {
+		m[v] = true
+	}
+	acc := []string{}
+	for _, v := range b {
+		if m[v] {
+			acc = append(acc, v)
+			delete(m, v) // avoid duplicates
+		}
+	}
+	return acc
+}
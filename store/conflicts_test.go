@@ -0,0 +1,90 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"testing"
+
+	"github.com/booster-proj/booster/events"
+	"github.com/booster-proj/booster/store"
+)
+
+func TestFindConflicts(t *testing.T) {
+	store.Resolver = resolver{}
+
+	block0 := store.NewBlockPolicy("T", "s0")
+	reserve0 := store.NewReservedPolicy("T", "s0", "host0", "host1")
+	reserve1 := store.NewReservedPolicy("T", "s1", "host1")
+	avoid0 := store.NewAvoidPolicy("T", "s0", "host0")
+	avoid1 := store.NewAvoidPolicy("T", "s1", "host0")
+	avoid2 := store.NewAvoidPolicy("T", "s1", "host2")
+	avoid3 := store.NewAvoidPolicy("T", "s0", "host0")
+	avoid3.OnPorts(store.Ports{{From: 22, To: 22}})
+	reserve2 := store.NewReservedPolicy("T", "s0", "host0")
+	reserve2.OnPorts(store.Ports{{From: 80, To: 443}})
+
+	tt := []struct {
+		p        store.Policy
+		existing []store.Policy
+		kinds    []string
+	}{
+		{p: block0, existing: []store.Policy{}, kinds: []string{}},
+		{p: block0, existing: []store.Policy{reserve0}, kinds: []string{store.ConflictContradiction}},
+		{p: block0, existing: []store.Policy{avoid0, avoid1}, kinds: []string{store.ConflictShadowing}},
+		{p: reserve0, existing: []store.Policy{block0}, kinds: []string{store.ConflictContradiction}},
+		{p: reserve0, existing: []store.Policy{reserve1}, kinds: []string{store.ConflictContradiction}},
+		{p: reserve0, existing: []store.Policy{avoid0, avoid1, avoid2}, kinds: []string{store.ConflictContradiction, store.ConflictShadowing}},
+		{p: avoid0, existing: []store.Policy{block0, reserve0}, kinds: []string{store.ConflictShadowing, store.ConflictContradiction}},
+		{p: avoid1, existing: []store.Policy{reserve0, reserve1}, kinds: []string{store.ConflictShadowing}},
+		{p: avoid2, existing: []store.Policy{block0, reserve0, reserve1}, kinds: []string{}},
+		{p: avoid3, existing: []store.Policy{reserve0, reserve2}, kinds: []string{store.ConflictContradiction}},
+	}
+
+	for i, v := range tt {
+		c := store.FindConflicts(v.p, v.existing)
+		if len(c) != len(v.kinds) {
+			t.Fatalf("%d: Unexpected conflicts: wanted %v, found %v", i, v.kinds, c)
+		}
+		for j, k := range v.kinds {
+			if c[j].Kind != k {
+				t.Fatalf("%d: Unexpected conflict kind: wanted %s, found %v", i, k, c[j])
+			}
+			if c[j].PolicyID != v.p.ID() {
+				t.Fatalf("%d: Unexpected conflict policy id: wanted %s, found %s", i, v.p.ID(), c[j].PolicyID)
+			}
+		}
+	}
+}
+
+func TestAppendPolicy_conflict(t *testing.T) {
+	store.Resolver = resolver{}
+	s := store.New(&storage{})
+	s.Events = new(events.Bus)
+
+	s.AppendPolicy(store.NewBlockPolicy("T", "s0"))
+	p := store.NewReservedPolicy("T", "s0", "host0")
+	if c := s.FindConflicts(p); len(c) != 1 {
+		t.Fatalf("Unexpected conflicts: wanted 1, found %v", c)
+	}
+	if err := s.AppendPolicy(p); err != nil {
+		t.Fatalf("Conflicting policies should still be accepted: %v", err)
+	}
+
+	e := s.Events.Recent()
+	if len(e) != 1 || e[0].Topic != events.TopicPolicyConflict {
+		t.Fatalf("Unexpected events: %+v", e)
+	}
+}
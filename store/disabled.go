@@ -0,0 +1,111 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/booster-proj/booster/core"
+)
+
+// LoadDisabled reads the sources disabled from DisabledFile, replacing
+// the ones stored. A missing file is not an error.
+func (ss *SourceStore) LoadDisabled() error {
+	if ss.DisabledFile == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(ss.DisabledFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var ids []string
+	if err := json.Unmarshal(b, &ids); err != nil {
+		return fmt.Errorf("source store: invalid disabled file %s: %v", ss.DisabledFile, err)
+	}
+
+	val := make(map[string]bool, len(ids))
+	for _, v := range ids {
+		val[v] = true
+	}
+	ss.disabled.Lock()
+	ss.disabled.val = val
+	ss.disabled.Unlock()
+	return nil
+}
+
+// SetDisabled disables or enables source `id`. Disabled sources are
+// kept by the store, but never returned by Get. Unlike a BlockPolicy,
+// disabling a source does not produce any policy, and the source
+// remains disabled until it is enabled again, even if it is removed
+// in the meanwhile. If DisabledFile is set, the sources disabled are
+// saved into it.
+func (ss *SourceStore) SetDisabled(id string, disabled bool) error {
+	ss.disabled.Lock()
+	defer ss.disabled.Unlock()
+
+	if ss.disabled.val == nil {
+		ss.disabled.val = make(map[string]bool)
+	}
+	if disabled {
+		ss.disabled.val[id] = true
+	} else {
+		delete(ss.disabled.val, id)
+	}
+
+	if ss.DisabledFile == "" {
+		return nil
+	}
+	ids := make([]string, 0, len(ss.disabled.val))
+	for k := range ss.disabled.val {
+		ids = append(ids, k)
+	}
+	sort.Strings(ids)
+	return saveJSON(ss.DisabledFile, ids)
+}
+
+// IsDisabled reports whether source `id` was disabled with
+// SetDisabled.
+func (ss *SourceStore) IsDisabled(id string) bool {
+	ss.disabled.RLock()
+	defer ss.disabled.RUnlock()
+
+	return ss.disabled.val[id]
+}
+
+// disabledBlacklist returns the sources that are disabled.
+func (ss *SourceStore) disabledBlacklist() []core.Source {
+	ss.disabled.RLock()
+	n := len(ss.disabled.val)
+	ss.disabled.RUnlock()
+	if n == 0 {
+		return nil
+	}
+
+	acc := make([]core.Source, 0, n)
+	for _, src := range ss.available(nil) {
+		if ss.IsDisabled(src.ID()) {
+			acc = append(acc, src)
+		}
+	}
+	return acc
+}
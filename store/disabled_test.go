@@ -0,0 +1,96 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/store"
+)
+
+func TestSetDisabled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "booster-disabled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "disabled.json")
+
+	st := &storage{data: []core.Source{&mock{id: "s0"}, &mock{id: "s1"}}}
+	s := store.New(st)
+	s.DisabledFile = file
+	if err := s.SetDisabled("s0", true); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if src, err := s.Get(ctx, "host:80"); err == nil {
+		t.Fatalf("Unexpected source %v: s0 is disabled", src)
+	}
+	st.index = 1
+	if src, err := s.Get(ctx, "host:80"); err != nil || src.ID() != "s1" {
+		t.Fatalf("Unexpected Get result: %v, %v", src, err)
+	}
+	if ok, _ := s.ShouldAccept("s0", "host"); !ok {
+		t.Fatalf("Disabling a source should not affect the policies")
+	}
+	if snap := s.GetSourcesSnapshot(); snap[0].State != store.StateDisabled {
+		t.Fatalf("Unexpected state of s0: %v", snap[0].State)
+	}
+
+	// The sources stay disabled after a restart.
+	s = store.New(&storage{})
+	s.DisabledFile = file
+	if err := s.LoadDisabled(); err != nil {
+		t.Fatal(err)
+	}
+	if !s.IsDisabled("s0") || s.IsDisabled("s1") {
+		t.Fatalf("Unexpected sources disabled after LoadDisabled")
+	}
+
+	if err := s.SetDisabled("s0", false); err != nil {
+		t.Fatal(err)
+	}
+	s = store.New(&storage{})
+	s.DisabledFile = file
+	if err := s.LoadDisabled(); err != nil {
+		t.Fatal(err)
+	}
+	if s.IsDisabled("s0") {
+		t.Fatalf("s0 should be enabled")
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	s0, s1, s2 := &mock{id: "s0"}, &mock{id: "s1"}, &mock{id: "s2"}
+	s := store.New(&storage{data: []core.Source{s0, s1, s2}})
+	s.AppendPolicy(store.NewBlockPolicy("T", "s2"))
+	if err := s.SetDisabled("s0", true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Disabled sources are refused as the ones blocked by the
+	// policies.
+	srcs := s.Candidates(context.Background(), "host:80")
+	if len(srcs) != 1 || srcs[0].ID() != "s1" {
+		t.Fatalf("Unexpected candidates: %v", srcs)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"sync"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+)
+
+// failback keeps track of the sources held back after coming back from
+// a failure.
+type failback struct {
+	sync.Mutex
+	since map[string]time.Time
+}
+
+// startFailback holds back `sources`, that came back after a failure.
+func (ss *SourceStore) startFailback(sources ...core.Source) {
+	if ss.FailbackDelay <= 0 && ss.FailbackConns <= 0 {
+		return
+	}
+	ss.failback.Lock()
+	defer ss.failback.Unlock()
+
+	if ss.failback.since == nil {
+		ss.failback.since = make(map[string]time.Time)
+	}
+	now := time.Now()
+	for _, v := range sources {
+		ss.failback.since[v.ID()] = now
+	}
+}
+
+// forgetFailback stops holding back `sources`, that were removed.
+func (ss *SourceStore) forgetFailback(sources ...core.Source) {
+	ss.failback.Lock()
+	defer ss.failback.Unlock()
+
+	for _, v := range sources {
+		delete(ss.failback.since, v.ID())
+	}
+}
+
+// HeldBack reports whether source `id` is held back after coming back
+// from a failure, i.e. the FailbackDelay did not elapse yet or too many
+// connections are open through the other sources.
+func (ss *SourceStore) HeldBack(id string) bool {
+	for _, v := range ss.failbackBlacklist(nil) {
+		if v.ID() == id {
+			return true
+		}
+	}
+	return false
+}
+
+// failbackBlacklist returns the sources, excluding `blacklisted`, that
+// are held back. The ones whose failback completed are forgotten.
+func (ss *SourceStore) failbackBlacklist(blacklisted []core.Source) []core.Source {
+	sources := ss.available(blacklisted)
+
+	ss.failback.Lock()
+	defer ss.failback.Unlock()
+
+	if len(ss.failback.since) == 0 {
+		return nil
+	}
+	now := time.Now()
+	var acc, pending []core.Source
+	conns := 0
+	for _, src := range sources {
+		since, ok := ss.failback.since[src.ID()]
+		switch {
+		case ok && now.Sub(since) < ss.FailbackDelay:
+			acc = append(acc, src)
+		case ok:
+			pending = append(pending, src)
+		default:
+			if l, ok := src.(interface{ Len() int }); ok {
+				conns += l.Len()
+			}
+		}
+	}
+	if ss.FailbackConns > 0 && conns >= ss.FailbackConns {
+		return append(acc, pending...)
+	}
+	for _, src := range pending {
+		delete(ss.failback.since, src.ID())
+	}
+	return acc
+}
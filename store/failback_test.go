@@ -0,0 +1,79 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/store"
+)
+
+func TestGet_failback(t *testing.T) {
+	s0 := &meteredMock{mock: mock{id: "s0"}}
+	s1 := &meteredMock{mock: mock{id: "s1"}}
+	s := store.New(new(core.Balancer))
+	s.FailbackDelay = 50 * time.Millisecond
+	s.FailbackConns = 2
+	s.SetTier(s1.ID(), store.TierSecondary)
+	s.Put(s0, s1)
+
+	get := func(want core.Source) {
+		for i := 0; i < 3; i++ {
+			src, err := s.Get(context.Background(), "host:443")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if src.ID() != want.ID() {
+				t.Fatalf("Unexpected source: wanted %v, found %v", want, src)
+			}
+		}
+	}
+
+	// Sources added for the first time are not held back.
+	get(s0)
+
+	s.Del(s0)
+	get(s1)
+	s.Put(s0)
+	if !s.HeldBack(s0.ID()) {
+		t.Fatalf("Source %v not held back after coming back", s0)
+	}
+	for _, v := range s.GetSourcesSnapshot() {
+		if v.ID == s0.ID() && v.State != store.StateHeldBack {
+			t.Fatalf("Unexpected state: %v", v.State)
+		}
+	}
+	get(s1)
+
+	// Once the delay elapsed, until the connections through the
+	// other sources drain.
+	time.Sleep(s.FailbackDelay)
+	s1.conns = 2
+	get(s1)
+	s1.conns = 1
+	get(s0)
+	s1.conns = 2
+	get(s0)
+
+	// Held back sources are used when no other is available.
+	s.Del(s0)
+	s.Put(s0)
+	s.Del(s1)
+	get(s0)
+}
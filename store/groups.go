@@ -0,0 +1,162 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strconv"
+
+	"github.com/booster-proj/booster/core"
+)
+
+// targeted is implemented by the policies that apply to a specific
+// source, or group of sources.
+type targeted interface {
+	Target() string
+}
+
+// PutGroup stores `g`, replacing the group with the same name, if any.
+// The name of the group can then be used in place of the identifiers
+// of its members, when creating policies or assigning tiers and
+// metered tags.
+func (ss *SourceStore) PutGroup(g core.SourceGroup) error {
+	if g.Name == "" {
+		return fmt.Errorf("source store: groups require a name")
+	}
+	if len(g.Patterns) == 0 {
+		return fmt.Errorf("source store: group %s has no patterns", g.Name)
+	}
+	for _, v := range g.Patterns {
+		if _, err := path.Match(v, ""); err != nil {
+			return fmt.Errorf("source store: group %s: invalid pattern %q: %v", g.Name, v, err)
+		}
+	}
+
+	ss.groups.Lock()
+	defer ss.groups.Unlock()
+
+	for i, v := range ss.groups.val {
+		if v.Name == g.Name {
+			ss.groups.val[i] = &g
+			ss.invalidate()
+			return nil
+		}
+	}
+	ss.groups.val = append(ss.groups.val, &g)
+	ss.invalidate()
+	return nil
+}
+
+// DelGroup removes the group named `name`.
+func (ss *SourceStore) DelGroup(name string) error {
+	ss.groups.Lock()
+	defer ss.groups.Unlock()
+
+	for i, v := range ss.groups.val {
+		if v.Name == name {
+			ss.groups.val = append(ss.groups.val[:i], ss.groups.val[i+1:]...)
+			ss.invalidate()
+			return nil
+		}
+	}
+	return fmt.Errorf("source store: no %s group found", name)
+}
+
+// GetGroupsSnapshot returns a copy of the groups stored.
+func (ss *SourceStore) GetGroupsSnapshot() []core.SourceGroup {
+	ss.groups.RLock()
+	defer ss.groups.RUnlock()
+
+	acc := make([]core.SourceGroup, 0, len(ss.groups.val))
+	for _, v := range ss.groups.val {
+		g := *v
+		g.Patterns = append([]string(nil), v.Patterns...)
+		acc = append(acc, g)
+	}
+	return acc
+}
+
+// GroupsOf returns the names of the groups source `id` is member of.
+func (ss *SourceStore) GroupsOf(id string) []string {
+	ss.groups.RLock()
+	defer ss.groups.RUnlock()
+
+	var acc []string
+	for _, v := range ss.groups.val {
+		if v.Contains(id) {
+			acc = append(acc, v.Name)
+		}
+	}
+	return acc
+}
+
+// inGroup reports whether source `id` is member of group `name`.
+func (ss *SourceStore) inGroup(id, name string) bool {
+	ss.groups.RLock()
+	defer ss.groups.RUnlock()
+
+	for _, v := range ss.groups.val {
+		if v.Name == name {
+			return v.Contains(id)
+		}
+	}
+	return false
+}
+
+// Weight returns the weight of source `id`, i.e. the highest weight
+// of the groups it belongs to, or 1. Use it with
+// core.WeightedRoundRobin.
+func (ss *SourceStore) Weight(id string) int {
+	ss.groups.RLock()
+	defer ss.groups.RUnlock()
+
+	w := 1
+	for _, v := range ss.groups.val {
+		if v.Contains(id) && v.Weight > w {
+			w = v.Weight
+		}
+	}
+	return w
+}
+
+// subject returns the identifier `p` should be evaluated with for
+// source `id`: if `p` targets a group `id` is member of, or a label
+// `id` has, the policy is evaluated as if `id` was the target.
+func (ss *SourceStore) subject(p Policy, id string) string {
+	t, ok := p.(targeted)
+	if !ok || t.Target() == id {
+		return id
+	}
+	if ss.inGroup(id, t.Target()) || ss.hasLabel(id, t.Target()) {
+		return t.Target()
+	}
+	return id
+}
+
+// accept evaluates `p` for source `id`. `address` may contain the
+// port, which is passed on only to the PortPolicy implementations.
+func (ss *SourceStore) accept(p Policy, id, address string) bool {
+	id = ss.subject(p, id)
+	if pp, ok := p.(PortPolicy); ok {
+		if host, port, err := net.SplitHostPort(address); err == nil {
+			n, _ := strconv.Atoi(port)
+			return pp.AcceptPort(id, host, n)
+		}
+	}
+	return p.Accept(id, TrimPort(address))
+}
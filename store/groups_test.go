@@ -0,0 +1,96 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/store"
+)
+
+func TestGroups(t *testing.T) {
+	s := store.New(new(core.Balancer))
+	if err := s.PutGroup(core.SourceGroup{Name: "lte", Patterns: []string{"wwan*"}, Weight: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutGroup(core.SourceGroup{Name: "bad", Patterns: []string{"["}}); err == nil {
+		t.Fatal("Invalid patterns should not be accepted")
+	}
+	s.Put(&mock{id: "wwan0"}, &mock{id: "wwan1"}, &mock{id: "en0"})
+
+	if g := s.GroupsOf("wwan1"); len(g) != 1 || g[0] != "lte" {
+		t.Fatalf("Unexpected groups: %v", g)
+	}
+	if w := s.Weight("wwan0"); w != 2 {
+		t.Fatalf("Unexpected weight: %d", w)
+	}
+	if w := s.Weight("en0"); w != 1 {
+		t.Fatalf("Unexpected weight: %d", w)
+	}
+
+	// Groups can be used in place of their members.
+	s.SetTier("lte", store.TierBackup)
+	s.SetTier("wwan1", store.TierPrimary)
+	if tier := s.SourceTier("wwan0"); tier != store.TierBackup {
+		t.Fatalf("Unexpected tier of wwan0: %v", tier)
+	}
+	if tier := s.SourceTier("wwan1"); tier != store.TierPrimary {
+		t.Fatalf("The tier of the source should take precedence, found %v", tier)
+	}
+	s.SetMetered("lte", true)
+	if !s.IsMetered("wwan0") || s.IsMetered("en0") {
+		t.Fatal("Group metered tag not applied")
+	}
+
+	s.AppendPolicy(store.NewBlockPolicy("test", "lte"))
+	for id, want := range map[string]bool{"wwan0": false, "wwan1": false, "en0": true} {
+		if ok, _ := s.ShouldAccept(id, "host:443"); ok != want {
+			t.Fatalf("ShouldAccept(%s): wanted %v, found %v", id, want, ok)
+		}
+	}
+
+	if err := s.DelGroup("lte"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := s.ShouldAccept("wwan0", "host:443"); !ok {
+		t.Fatal("Policy should no longer apply to former members")
+	}
+	if err := s.DelGroup("lte"); err == nil {
+		t.Fatal("Expected an error deleting an unknown group")
+	}
+}
+
+func TestGroups_reserve(t *testing.T) {
+	s := store.New(new(core.Balancer))
+	s.PutGroup(core.SourceGroup{Name: "lte", Patterns: []string{"wwan*"}})
+	s.Put(&mock{id: "wwan0"}, &mock{id: "en0"})
+	s.AppendPolicy(store.NewReservedPolicy("test", "lte", "192.0.2.1"))
+
+	for _, v := range []struct {
+		id, address string
+		want        bool
+	}{
+		{"wwan0", "192.0.2.1", true},
+		{"en0", "192.0.2.1", false},
+		{"wwan0", "192.0.2.2", false},
+		{"en0", "192.0.2.2", true},
+	} {
+		if ok, _ := s.ShouldAccept(v.id, v.address); ok != v.want {
+			t.Fatalf("ShouldAccept(%s, %s): wanted %v, found %v", v.id, v.address, v.want, ok)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import "sync"
+
+// hitCounter counts, for each policy, the sources it refused to the
+// connections.
+type hitCounter struct {
+	sync.Mutex
+	val map[string]uint64
+}
+
+func (ss *SourceStore) recordHits(policies []string) {
+	if len(policies) == 0 {
+		return
+	}
+
+	c := &ss.hits
+	c.Lock()
+	defer c.Unlock()
+	if c.val == nil {
+		c.val = make(map[string]uint64)
+	}
+	for _, id := range policies {
+		c.val[id]++
+	}
+}
+
+func (ss *SourceStore) resetHits(id string) {
+	c := &ss.hits
+	c.Lock()
+	defer c.Unlock()
+	delete(c.val, id)
+}
+
+// PolicyHits returns, for each policy stored, the number of times it
+// refused a source to a connection requested through Get.
+func (ss *SourceStore) PolicyHits() map[string]uint64 {
+	c := &ss.hits
+	c.Lock()
+	defer c.Unlock()
+
+	policies := ss.loadPolicies()
+	acc := make(map[string]uint64, len(policies))
+	for _, p := range policies {
+		acc[p.ID()] = c.val[p.ID()]
+	}
+	return acc
+}
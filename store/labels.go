@@ -0,0 +1,179 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LabelPrefix is the prefix of the targets that select the sources by
+// label, in the form `label:key=value`. They can be used in place of
+// a source identifier when creating policies.
+const LabelPrefix = "label:"
+
+// SourceLabels are the display name and the labels assigned by the
+// user to a source.
+type SourceLabels struct {
+	Name   string            `json:"name,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// LabelsExporter receives the labels of the sources each time they
+// change.
+type LabelsExporter interface {
+	SetSourceLabels(id, name string, labels map[string]string)
+}
+
+func (l SourceLabels) copy() SourceLabels {
+	acc := SourceLabels{Name: l.Name}
+	if len(l.Labels) > 0 {
+		acc.Labels = make(map[string]string, len(l.Labels))
+		for k, v := range l.Labels {
+			acc.Labels[k] = v
+		}
+	}
+	return acc
+}
+
+// LoadLabels reads the labels from LabelsFile, replacing the ones
+// stored. A missing file is not an error.
+func (ss *SourceStore) LoadLabels() error {
+	if ss.LabelsFile == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(ss.LabelsFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	val := make(map[string]SourceLabels)
+	if err := json.Unmarshal(b, &val); err != nil {
+		return fmt.Errorf("source store: invalid labels file %s: %v", ss.LabelsFile, err)
+	}
+
+	ss.labels.Lock()
+	ss.labels.val = val
+	ss.labels.Unlock()
+
+	for id, v := range val {
+		ss.exportLabels(id, v)
+	}
+	ss.invalidate()
+	return nil
+}
+
+// SetLabels assigns the display name and the labels `l` to source
+// `id`, replacing the previous ones. If LabelsFile is set, the labels
+// are saved into it.
+func (ss *SourceStore) SetLabels(id string, l SourceLabels) error {
+	for k := range l.Labels {
+		if k == "" || strings.Contains(k, "=") {
+			return fmt.Errorf("source store: invalid label key %q", k)
+		}
+	}
+	l = l.copy()
+
+	ss.labels.Lock()
+	defer ss.labels.Unlock()
+
+	if ss.labels.val == nil {
+		ss.labels.val = make(map[string]SourceLabels)
+	}
+	if l.Name == "" && len(l.Labels) == 0 {
+		delete(ss.labels.val, id)
+	} else {
+		ss.labels.val[id] = l
+	}
+	ss.exportLabels(id, l)
+	ss.invalidate()
+	if ss.LabelsFile == "" {
+		return nil
+	}
+	return saveJSON(ss.LabelsFile, ss.labels.val)
+}
+
+// Labels returns the display name and the labels of source `id`.
+func (ss *SourceStore) Labels(id string) SourceLabels {
+	ss.labels.RLock()
+	defer ss.labels.RUnlock()
+
+	return ss.labels.val[id].copy()
+}
+
+// GetLabelsSnapshot returns a copy of the labels of each source.
+func (ss *SourceStore) GetLabelsSnapshot() map[string]SourceLabels {
+	ss.labels.RLock()
+	defer ss.labels.RUnlock()
+
+	acc := make(map[string]SourceLabels, len(ss.labels.val))
+	for k, v := range ss.labels.val {
+		acc[k] = v.copy()
+	}
+	return acc
+}
+
+// hasLabel reports whether source `id` is selected by `target`, in the
+// form `label:key=value`.
+func (ss *SourceStore) hasLabel(id, target string) bool {
+	if !strings.HasPrefix(target, LabelPrefix) {
+		return false
+	}
+	kv := strings.SplitN(strings.TrimPrefix(target, LabelPrefix), "=", 2)
+	if len(kv) != 2 {
+		return false
+	}
+
+	ss.labels.RLock()
+	defer ss.labels.RUnlock()
+
+	v, ok := ss.labels.val[id].Labels[kv[0]]
+	return ok && v == kv[1]
+}
+
+func (ss *SourceStore) exportLabels(id string, l SourceLabels) {
+	if exp := ss.LabelsExporter; exp != nil {
+		exp.SetSourceLabels(id, l.Name, l.Labels)
+	}
+}
+
+// saveJSON writes the json encoding of `v` into `path`, replacing it
+// atomically.
+func saveJSON(path string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
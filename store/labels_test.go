@@ -0,0 +1,111 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/store"
+)
+
+type labelsExporter map[string]map[string]string
+
+func (e labelsExporter) SetSourceLabels(id, name string, labels map[string]string) {
+	e[id] = labels
+}
+
+func TestSetLabels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "booster-labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "labels.json")
+
+	exp := labelsExporter{}
+	s := store.New(&storage{data: []core.Source{&mock{id: "en8"}}})
+	s.LabelsFile = file
+	s.LabelsExporter = exp
+
+	l := store.SourceLabels{Name: "Office Wi-Fi", Labels: map[string]string{"metered": "false", "floor": "2"}}
+	if err := s.SetLabels("en8", l); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetLabels("en8", store.SourceLabels{Labels: map[string]string{"a=b": "c"}}); err == nil {
+		t.Fatalf("SetLabels accepted an invalid key")
+	}
+	if exp["en8"]["floor"] != "2" {
+		t.Fatalf("Labels were not exported: %v", exp)
+	}
+
+	snap := s.GetSourcesSnapshot()
+	if len(snap) != 1 || snap[0].DisplayName != "Office Wi-Fi" || snap[0].Labels["floor"] != "2" {
+		t.Fatalf("Unexpected sources snapshot: %+v", snap[0])
+	}
+
+	// The labels survive a restart.
+	s = store.New(&storage{})
+	s.LabelsFile = file
+	if err := s.LoadLabels(); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Labels("en8"); got.Name != l.Name || got.Labels["metered"] != "false" {
+		t.Fatalf("Unexpected labels loaded: %+v", got)
+	}
+
+	// Removing every label forgets the source.
+	if err := s.SetLabels("en8", store.SourceLabels{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s.GetLabelsSnapshot()); n != 0 {
+		t.Fatalf("Unexpected labels stored: %d", n)
+	}
+}
+
+func TestLoadLabels_missing(t *testing.T) {
+	s := store.New(&storage{})
+	s.LabelsFile = filepath.Join(os.TempDir(), "booster-labels-missing.json")
+	if err := s.LoadLabels(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestShouldAccept_label(t *testing.T) {
+	s := store.New(&storage{data: []core.Source{&mock{id: "en0"}, &mock{id: "wwan0"}}})
+	s.SetLabels("wwan0", store.SourceLabels{Labels: map[string]string{"metered": "true"}})
+	s.AppendPolicy(store.NewBlockPolicy("test", "label:metered=true"))
+
+	if ok, _ := s.ShouldAccept("en0", "host"); !ok {
+		t.Fatalf("en0 should be accepted")
+	}
+	if ok, _ := s.ShouldAccept("wwan0", "host"); ok {
+		t.Fatalf("wwan0 should be refused, as it is labeled metered=true")
+	}
+	bl := s.MakeBlacklist("host")
+	if len(bl) != 1 || bl[0].ID() != "wwan0" {
+		t.Fatalf("Unexpected blacklist: %v", bl)
+	}
+
+	// Changing the labels invalidates the cached blacklists.
+	s.SetLabels("wwan0", store.SourceLabels{})
+	if bl := s.MakeBlacklist("host"); len(bl) != 0 {
+		t.Fatalf("Unexpected blacklist: %v", bl)
+	}
+}
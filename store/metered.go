@@ -0,0 +1,126 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"github.com/booster-proj/booster/core"
+)
+
+// Metered is implemented by the sources that are able to tell
+// whether their connection is metered.
+type Metered interface {
+	Metered() bool
+}
+
+// SetMetered tags source, or group, `id` as metered or unmetered, overriding what
+// the source reports about itself. The tag is kept even if the source
+// is removed, so it applies again when it comes back.
+func (ss *SourceStore) SetMetered(id string, metered bool) {
+	ss.metered.Lock()
+	defer ss.metered.Unlock()
+
+	if ss.metered.tags == nil {
+		ss.metered.tags = make(map[string]bool)
+	}
+	ss.metered.tags[id] = metered
+	ss.invalidate()
+}
+
+// ResetMetered removes the tag of source `id`, if any.
+func (ss *SourceStore) ResetMetered(id string) {
+	ss.metered.Lock()
+	defer ss.metered.Unlock()
+
+	delete(ss.metered.tags, id)
+	ss.invalidate()
+}
+
+// IsMetered reports whether source `id` is metered. Tags set with
+// SetMetered take precedence over the value detected from the source,
+// and the tags of the source take precedence over the ones of its
+// groups.
+func (ss *SourceStore) IsMetered(id string) bool {
+	groups := ss.GroupsOf(id)
+
+	ss.metered.RLock()
+	defer ss.metered.RUnlock()
+
+	if v, ok := ss.metered.tags[id]; ok {
+		return v
+	}
+	for _, g := range groups {
+		if v, ok := ss.metered.tags[g]; ok {
+			return v
+		}
+	}
+	return ss.metered.detected[id]
+}
+
+func (ss *SourceStore) detectMetered(sources ...core.Source) {
+	ss.metered.Lock()
+	defer ss.metered.Unlock()
+
+	if ss.metered.detected == nil {
+		ss.metered.detected = make(map[string]bool)
+	}
+	for _, v := range sources {
+		if m, ok := v.(Metered); ok && m.Metered() {
+			ss.metered.detected[v.ID()] = true
+		}
+	}
+}
+
+func (ss *SourceStore) forgetMetered(sources ...core.Source) {
+	ss.metered.Lock()
+	defer ss.metered.Unlock()
+
+	for _, v := range sources {
+		delete(ss.metered.detected, v.ID())
+	}
+}
+
+// saturated reports whether `src` has reached the maximum number of
+// open connections allowed by SaturationConns.
+func (ss *SourceStore) saturated(src core.Source) bool {
+	if ss.SaturationConns <= 0 {
+		return false
+	}
+	l, ok := src.(interface{ Len() int })
+	return ok && l.Len() >= ss.SaturationConns
+}
+
+// meteredBlacklist returns the metered sources that should be avoided,
+// given that `blacklisted` cannot be used. If no unmetered source is
+// available, or all of them are saturated, the list is empty,
+// i.e. the metered sources become usable.
+func (ss *SourceStore) meteredBlacklist(blacklisted []core.Source) []core.Source {
+	sources := ss.available(blacklisted)
+	acc := make([]core.Source, 0, len(sources))
+	available := false
+	for _, src := range sources {
+		if ss.IsMetered(src.ID()) {
+			acc = append(acc, src)
+			continue
+		}
+		if !ss.saturated(src) {
+			available = true
+		}
+	}
+	if !available {
+		return nil
+	}
+	return acc
+}
@@ -0,0 +1,113 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/store"
+)
+
+type meteredMock struct {
+	mock
+	metered bool
+	conns   int
+}
+
+func (s *meteredMock) Metered() bool {
+	return s.metered
+}
+
+func (s *meteredMock) Len() int {
+	return s.conns
+}
+
+func TestIsMetered(t *testing.T) {
+	s0 := &meteredMock{mock: mock{id: "s0"}, metered: true}
+	s1 := &mock{id: "s1"}
+	s := store.New(new(core.Balancer))
+	s.Put(s0, s1)
+
+	if !s.IsMetered(s0.ID()) {
+		t.Fatalf("Source %v should be detected as metered", s0)
+	}
+	if s.IsMetered(s1.ID()) {
+		t.Fatalf("Source %v should not be metered", s1)
+	}
+
+	s.SetMetered(s0.ID(), false)
+	s.SetMetered(s1.ID(), true)
+	if s.IsMetered(s0.ID()) || !s.IsMetered(s1.ID()) {
+		t.Fatal("Tags should take precedence over detection")
+	}
+
+	s.ResetMetered(s0.ID())
+	if !s.IsMetered(s0.ID()) {
+		t.Fatalf("Source %v should be metered after tag removal", s0)
+	}
+
+	s.Del(s0)
+	if s.IsMetered(s0.ID()) {
+		t.Fatalf("Source %v is no longer stored", s0)
+	}
+}
+
+func TestGet_preferUnmetered(t *testing.T) {
+	s0 := &meteredMock{mock: mock{id: "s0"}, metered: true}
+	s1 := &meteredMock{mock: mock{id: "s1"}}
+	s := store.New(new(core.Balancer))
+	s.PreferUnmetered = true
+	s.SaturationConns = 2
+	s.Put(s0, s1)
+
+	ctx := context.Background()
+	for i := 0; i < 4; i++ {
+		src, err := s.Get(ctx, "host:443")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if src.ID() != s1.ID() {
+			t.Fatalf("%d: Unexpected source: wanted %v, found %v", i, s1, src)
+		}
+	}
+
+	// Metered sources are used when the unmetered ones are
+	// saturated...
+	s1.conns = 2
+	found := false
+	for i := 0; i < 2; i++ {
+		src, err := s.Get(ctx, "host:443")
+		if err != nil {
+			t.Fatal(err)
+		}
+		found = found || src.ID() == s0.ID()
+	}
+	if !found {
+		t.Fatalf("Metered source %v was never used with %v saturated", s0, s1)
+	}
+
+	// ...or unavailable.
+	s1.conns = 0
+	src, err := s.Get(ctx, "host:443", s1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.ID() != s0.ID() {
+		t.Fatalf("Unexpected source: wanted %v, found %v", s0, src)
+	}
+}
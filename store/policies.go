@@ -19,7 +19,13 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"strings"
 	"time"
+
+	"github.com/booster-proj/booster/expr"
+	"github.com/booster-proj/booster/geoip"
+	"github.com/booster-proj/booster/process"
+	"github.com/booster-proj/booster/protocol"
 )
 
 type HostResolver interface {
@@ -31,12 +37,30 @@ type HostResolver interface {
 
 var Resolver HostResolver = &net.Resolver{}
 
+// resolver returns the resolver used by the store: its own, if set,
+// or the package Resolver.
+func (ss *SourceStore) resolver() HostResolver {
+	if ss.Resolver != nil {
+		return ss.Resolver
+	}
+	return Resolver
+}
+
 // Policy codes, different for each `Policy` created.
 const (
 	PolicyCodeBlock int = iota + 1
 	PolicyCodeReserve
 	PolicyCodeStick
 	PolicyCodeAvoid
+	PolicyCodeMetered
+	PolicyCodeProcess
+	PolicyCodeGeo
+	PolicyCodeExpr
+	PolicyCodeWebhook
+	PolicyCodePlugin
+	PolicyCodeDSCP
+	PolicyCodeProtocol
+	PolicyCodeFWMark
 )
 
 type basePolicy struct {
@@ -58,12 +82,47 @@ type basePolicy struct {
 	// Addrs is the list of address address that the
 	// policy takes into consideration.
 	Addrs []string `json:"addresses"`
+
+	// Ports are the destination ports that the policy takes into
+	// consideration. If empty, it applies to any port.
+	Ports Ports `json:"ports,omitempty"`
 }
 
 func (p basePolicy) ID() string {
 	return p.Name
 }
 
+// OnPorts restricts the policy to the connections directed to
+// `ports`, e.g. "6881-6889" for BitTorrent. Only the policies that
+// implement PortPolicy take the ports into consideration. Call it
+// before adding the policy to the store.
+func (p *basePolicy) OnPorts(ports Ports) {
+	if len(ports) == 0 {
+		return
+	}
+	p.Ports = ports
+	p.Name = fmt.Sprintf("%s_on_%s", p.Name, ports.join("_"))
+	p.Desc = fmt.Sprintf("%s, on ports %v", p.Desc, ports)
+}
+
+// applies reports whether the policy takes into consideration the
+// connections to `address` on `port`. Empty Addrs or Ports match any
+// address or port.
+func (p basePolicy) applies(address string, port int) bool {
+	if !p.Ports.Contains(port) {
+		return false
+	}
+	if len(p.Addrs) == 0 {
+		return true
+	}
+	for _, v := range p.Addrs {
+		if address == v {
+			return true
+		}
+	}
+	return false
+}
+
 // GenPolicy is a general purpose policy that allows
 // to configure the behaviour of the Accept function
 // setting its AcceptFunc field.
@@ -106,6 +165,16 @@ func NewBlockPolicy(issuer, sourceID string) *BlockPolicy {
 	}
 }
 
+// Target returns the source, or group, blocked.
+func (p *BlockPolicy) Target() string {
+	return p.SourceID
+}
+
+// Static implements StaticPolicy.
+func (p *BlockPolicy) Static() bool {
+	return true
+}
+
 // Accept implements Policy.
 func (p *BlockPolicy) Accept(id, address string) bool {
 	return id != p.SourceID
@@ -137,15 +206,25 @@ func NewReservedPolicy(issuer, sourceID string, hosts ...string) *ReservedPolicy
 	}
 }
 
+// Target returns the source, or group, reserved.
+func (p *ReservedPolicy) Target() string {
+	return p.SourceID
+}
+
+// Static implements StaticPolicy.
+func (p *ReservedPolicy) Static() bool {
+	return true
+}
+
 // Accept implements Policy.
 func (p *ReservedPolicy) Accept(id, address string) bool {
-	isIn := false
-	for _, v := range p.Addrs {
-		if address == v {
-			isIn = true
-			break
-		}
-	}
+	return p.AcceptPort(id, address, 0)
+}
+
+// AcceptPort implements PortPolicy. A reserved policy without
+// addresses reserves the source for the connections to its ports.
+func (p *ReservedPolicy) AcceptPort(id, address string, port int) bool {
+	isIn := (len(p.Addrs) > 0 || len(p.Ports) > 0) && p.applies(address, port)
 	if isIn {
 		return id == p.SourceID
 	}
@@ -176,21 +255,494 @@ func NewAvoidPolicy(issuer, sourceID, address string) *AvoidPolicy {
 	}
 }
 
+// Target returns the source, or group, avoided.
+func (p *AvoidPolicy) Target() string {
+	return p.SourceID
+}
+
+// Static implements StaticPolicy.
+func (p *AvoidPolicy) Static() bool {
+	return true
+}
+
 // Accept implements Policy.
 func (p *AvoidPolicy) Accept(id, address string) bool {
-	isIn := false
-	for _, v := range p.Addrs {
-		if address == v {
-			isIn = true
-			break
+	return p.AcceptPort(id, address, 0)
+}
+
+// AcceptPort implements PortPolicy.
+func (p *AvoidPolicy) AcceptPort(id, address string, port int) bool {
+	if len(p.Addrs) > 0 && p.applies(address, port) {
+		return id != p.SourceID
+	}
+	return true
+}
+
+// MeteredQueryFunc describes the function that is used to know whether
+// the source with the identifier provided is metered.
+type MeteredQueryFunc func(string) bool
+
+// MeteredPolicy is a Policy implementation. It is used to assign the
+// connections to `Addrs` only to metered, or unmetered, sources. If
+// no address is provided, the policy applies to every connection.
+type MeteredPolicy struct {
+	basePolicy
+	Metered   bool             `json:"metered"`
+	IsMetered MeteredQueryFunc `json:"-"`
+}
+
+func NewMeteredPolicy(issuer string, metered bool, f MeteredQueryFunc, hosts ...string) *MeteredPolicy {
+	addrs := []string{}
+	for _, v := range hosts {
+		address := TrimPort(v)
+		addrs = append(addrs, LookupAddress(address)...)
+	}
+	name := fmt.Sprintf("metered_%v", metered)
+	desc := fmt.Sprintf("only sources with metered=%v will be used", metered)
+	if len(hosts) > 0 {
+		name = fmt.Sprintf("%s_for_%s", name, strings.Join(hosts, "_"))
+		desc = fmt.Sprintf("%s for connections to %v", desc, addrs)
+	}
+	return &MeteredPolicy{
+		basePolicy: basePolicy{
+			Name:   name,
+			Issuer: issuer,
+			Code:   PolicyCodeMetered,
+			Desc:   desc,
+			Addrs:  addrs,
+		},
+		Metered:   metered,
+		IsMetered: f,
+	}
+}
+
+// Static implements StaticPolicy.
+func (p *MeteredPolicy) Static() bool {
+	return true
+}
+
+// Accept implements Policy.
+func (p *MeteredPolicy) Accept(id, address string) bool {
+	return p.AcceptPort(id, address, 0)
+}
+
+// AcceptPort implements PortPolicy.
+func (p *MeteredPolicy) AcceptPort(id, address string, port int) bool {
+	if p.applies(address, port) {
+		return p.IsMetered(id) == p.Metered
+	}
+	return true
+}
+
+// ProcessPolicy is a Policy implementation. It is used to make the
+// connections of an application use only `SourceID`, e.g. "Spotify
+// only via Wi-Fi". As the policy depends on the process that opened
+// the connection, it is evaluated with AcceptProcess, only when the
+// owner of the connection is known.
+type ProcessPolicy struct {
+	basePolicy
+	Process  string `json:"process"`
+	SourceID string `json:"source_id"`
+}
+
+func NewProcessPolicy(issuer, process, sourceID string) *ProcessPolicy {
+	return &ProcessPolicy{
+		basePolicy: basePolicy{
+			Name:   fmt.Sprintf("process_%s_via_%s", process, sourceID),
+			Issuer: issuer,
+			Code:   PolicyCodeProcess,
+			Desc:   fmt.Sprintf("connections of process %s will only use source %v", process, sourceID),
+		},
+		Process:  process,
+		SourceID: sourceID,
+	}
+}
+
+// Target returns the source, or group, the process is allowed to use.
+func (p *ProcessPolicy) Target() string {
+	return p.SourceID
+}
+
+// Static implements StaticPolicy.
+func (p *ProcessPolicy) Static() bool {
+	return true
+}
+
+// Accept implements Policy. It accepts everything, as the process
+// is not known.
+func (p *ProcessPolicy) Accept(id, address string) bool {
+	return true
+}
+
+// AcceptProcess reports whether source `id` can be used by `proc`.
+func (p *ProcessPolicy) AcceptProcess(id string, proc process.Process) bool {
+	if !proc.Matches(p.Process) {
+		return true
+	}
+	return id == p.SourceID
+}
+
+// ProtocolPolicy is a Policy implementation. It is used to make the
+// connections of `Protocol` use only `SourceID`, e.g. "BitTorrent only
+// via the unmetered source". As the policy depends on the protocol
+// detected by the dialer, it is evaluated with AcceptProtocol, only
+// when the protocol of the connection is known.
+type ProtocolPolicy struct {
+	basePolicy
+	Protocol protocol.Protocol `json:"protocol"`
+	SourceID string            `json:"source_id"`
+}
+
+func NewProtocolPolicy(issuer string, proto protocol.Protocol, sourceID string) *ProtocolPolicy {
+	return &ProtocolPolicy{
+		basePolicy: basePolicy{
+			Name:   fmt.Sprintf("protocol_%s_via_%s", proto, sourceID),
+			Issuer: issuer,
+			Code:   PolicyCodeProtocol,
+			Desc:   fmt.Sprintf("%s connections will only use source %v", proto, sourceID),
+		},
+		Protocol: proto,
+		SourceID: sourceID,
+	}
+}
+
+// Target returns the source, or group, the protocol is allowed to use.
+func (p *ProtocolPolicy) Target() string {
+	return p.SourceID
+}
+
+// Static implements StaticPolicy.
+func (p *ProtocolPolicy) Static() bool {
+	return true
+}
+
+// Accept implements Policy. It accepts everything, as the protocol
+// is not known.
+func (p *ProtocolPolicy) Accept(id, address string) bool {
+	return true
+}
+
+// AcceptProtocol reports whether source `id` can be used by the
+// connections of `proto`.
+func (p *ProtocolPolicy) AcceptProtocol(id string, proto protocol.Protocol) bool {
+	if proto != p.Protocol {
+		return true
+	}
+	return id == p.SourceID
+}
+
+// LocationQueryFunc describes the function that is used to locate
+// the destination `host` of a connection.
+type LocationQueryFunc func(host string) []geoip.Location
+
+// GeoPolicy is a Policy implementation. It is used to make the
+// connections to destinations located in one of `Countries`,
+// `Continents` or autonomous systems `ASNs` use only `SourceID`,
+// e.g. "route EU destinations via the VPN source". Connections to
+// other destinations are not affected.
+type GeoPolicy struct {
+	basePolicy
+	SourceID   string   `json:"source_id"`
+	Countries  []string `json:"countries,omitempty"`
+	Continents []string `json:"continents,omitempty"`
+	ASNs       []uint   `json:"asns,omitempty"`
+
+	locate LocationQueryFunc
+}
+
+func NewGeoPolicy(issuer, sourceID string, f LocationQueryFunc, countries, continents []string, asns []uint) *GeoPolicy {
+	targets := make([]string, 0, len(countries)+len(continents)+len(asns))
+	targets = append(targets, countries...)
+	targets = append(targets, continents...)
+	for _, v := range asns {
+		targets = append(targets, fmt.Sprintf("AS%d", v))
+	}
+	return &GeoPolicy{
+		basePolicy: basePolicy{
+			Name:   fmt.Sprintf("geo_%s_for_%s", sourceID, strings.Join(targets, "_")),
+			Issuer: issuer,
+			Code:   PolicyCodeGeo,
+			Desc:   fmt.Sprintf("connections to destinations in %v will only use source %v", targets, sourceID),
+		},
+		SourceID:   sourceID,
+		Countries:  countries,
+		Continents: continents,
+		ASNs:       asns,
+		locate:     f,
+	}
+}
+
+// Target returns the source, or group, used for the destinations
+// matched.
+func (p *GeoPolicy) Target() string {
+	return p.SourceID
+}
+
+// Accept implements Policy.
+func (p *GeoPolicy) Accept(id, address string) bool {
+	if p.matches(address) {
+		return id == p.SourceID
+	}
+	return true
+}
+
+// matches reports whether `address` is located in one of the places
+// targeted by the policy.
+func (p *GeoPolicy) matches(address string) bool {
+	for _, loc := range p.locate(address) {
+		for _, v := range p.Countries {
+			if loc.Country != "" && strings.EqualFold(v, loc.Country) {
+				return true
+			}
+		}
+		for _, v := range p.Continents {
+			if loc.Continent != "" && strings.EqualFold(v, loc.Continent) {
+				return true
+			}
+		}
+		for _, v := range p.ASNs {
+			if loc.ASN != 0 && v == loc.ASN {
+				return true
+			}
 		}
 	}
-	if isIn {
-		return id != p.SourceID
+	return false
+}
+
+// ExprVars are the variables that can be used in the expressions of
+// the ExprPolicy instances.
+var ExprVars = map[string]expr.Type{
+	"source":  expr.String, // identifier of the source
+	"host":    expr.String, // destination host, as requested
+	"ip":      expr.String, // destination IP address, resolved if needed
+	"port":    expr.Number, // destination port, 0 if unknown
+	"metered": expr.Bool,   // whether the source is metered
+	"hour":    expr.Number, // local time, 0-23
+	"minute":  expr.Number, // local time, 0-59
+	"weekday": expr.String, // local day of the week, "mon" to "sun"
+}
+
+// ExprPolicy is a Policy implementation. Source `id` is accepted for
+// a connection only if the expression `Expr` evaluates to true, e.g.
+// `!(host matches "*.example.com" && metered)`. See package expr for the
+// syntax, and ExprVars for the variables that are available.
+type ExprPolicy struct {
+	basePolicy
+	Expr string `json:"expression"`
+
+	// Now returns the current time. If nil, time.Now is used.
+	Now func() time.Time `json:"-"`
+
+	prog      *expr.Program
+	isMetered MeteredQueryFunc
+}
+
+func NewExprPolicy(issuer, name, src string, f MeteredQueryFunc) (*ExprPolicy, error) {
+	prog, err := expr.Compile(src, ExprVars)
+	if err != nil {
+		return nil, err
+	}
+	return &ExprPolicy{
+		basePolicy: basePolicy{
+			Name:   fmt.Sprintf("expr_%s", name),
+			Issuer: issuer,
+			Code:   PolicyCodeExpr,
+			Desc:   fmt.Sprintf("sources will be used only when %s", src),
+		},
+		Expr:      src,
+		prog:      prog,
+		isMetered: f,
+	}, nil
+}
+
+// Accept implements Policy.
+func (p *ExprPolicy) Accept(id, address string) bool {
+	return p.AcceptPort(id, address, 0)
+}
+
+// AcceptPort implements PortPolicy.
+func (p *ExprPolicy) AcceptPort(id, host string, port int) bool {
+	now := time.Now
+	if p.Now != nil {
+		now = p.Now
+	}
+	return p.prog.Eval(func(name string) interface{} {
+		switch name {
+		case "source":
+			return id
+		case "host":
+			return host
+		case "ip":
+			if net.ParseIP(host) != nil {
+				return host
+			}
+			for _, v := range LookupAddress(host) {
+				if net.ParseIP(v) != nil {
+					return v
+				}
+			}
+			return ""
+		case "port":
+			return port
+		case "metered":
+			return p.isMetered != nil && p.isMetered(id)
+		case "hour":
+			return now().Hour()
+		case "minute":
+			return now().Minute()
+		case "weekday":
+			return strings.ToLower(now().Weekday().String()[:3])
+		}
+		return nil
+	})
+}
+
+// PluginPolicy is a Policy implementation whose Accept logic is
+// provided by the plugin `Plugin`.
+type PluginPolicy struct {
+	basePolicy
+	Plugin string `json:"plugin"`
+
+	accept func(id, address string) bool
+}
+
+func NewPluginPolicy(issuer, plugin string, f func(id, address string) bool) *PluginPolicy {
+	return &PluginPolicy{
+		basePolicy: basePolicy{
+			Name:   fmt.Sprintf("plugin_%s", plugin),
+			Issuer: issuer,
+			Code:   PolicyCodePlugin,
+			Desc:   fmt.Sprintf("sources will be used only if plugin %s accepts them", plugin),
+		},
+		Plugin: plugin,
+		accept: f,
+	}
+}
+
+// Accept implements Policy.
+func (p *PluginPolicy) Accept(id, address string) bool {
+	return p.accept(id, address)
+}
+
+// DSCPPolicy is a Policy implementation that accepts every connection,
+// marking the ones to `Addrs` and `Ports` with the `DSCP` value, e.g.
+// EF (46) for VoIP. If no address, or no port, is provided, the
+// policy applies to any address, or port.
+type DSCPPolicy struct {
+	basePolicy
+	DSCP int `json:"dscp"`
+}
+
+func NewDSCPPolicy(issuer, name string, dscp int, ports Ports, hosts ...string) *DSCPPolicy {
+	addrs := []string{}
+	for _, v := range hosts {
+		address := TrimPort(v)
+		addrs = append(addrs, address)
+		for _, a := range LookupAddress(address) {
+			if a != address {
+				addrs = append(addrs, a)
+			}
+		}
+	}
+	desc := fmt.Sprintf("connections will be marked with DSCP %d", dscp)
+	if len(addrs) > 0 {
+		desc = fmt.Sprintf("%s when directed to %v", desc, addrs)
+	}
+	if len(ports) > 0 {
+		desc = fmt.Sprintf("%s on ports %v", desc, ports)
+	}
+	return &DSCPPolicy{
+		basePolicy: basePolicy{
+			Name:   fmt.Sprintf("dscp_%s", name),
+			Issuer: issuer,
+			Code:   PolicyCodeDSCP,
+			Desc:   desc,
+			Addrs:  addrs,
+			Ports:  ports,
+		},
+		DSCP: dscp,
+	}
+}
+
+// Static implements StaticPolicy.
+func (p *DSCPPolicy) Static() bool {
+	return true
+}
+
+// Accept implements Policy. DSCPPolicy does not affect the choice of
+// the source.
+func (p *DSCPPolicy) Accept(id, address string) bool {
+	return true
+}
+
+// Mark implements Marker.
+func (p *DSCPPolicy) Mark(host string, port int) (int, bool) {
+	if p.applies(host, port) {
+		return p.DSCP, true
+	}
+	return 0, false
+}
+
+// FWMarkPolicy is a Policy implementation that accepts every
+// connection, setting the firewall mark `Mark` on the sockets of the
+// ones to `Addrs` and `Ports`, e.g. to route them with `ip rule` or to
+// account for them with nftables. If no address, or no port, is
+// provided, the policy applies to any address, or port.
+type FWMarkPolicy struct {
+	basePolicy
+	Mark uint32 `json:"mark"`
+}
+
+func NewFWMarkPolicy(issuer, name string, mark uint32, ports Ports, hosts ...string) *FWMarkPolicy {
+	addrs := []string{}
+	for _, v := range hosts {
+		address := TrimPort(v)
+		addrs = append(addrs, address)
+		for _, a := range LookupAddress(address) {
+			if a != address {
+				addrs = append(addrs, a)
+			}
+		}
 	}
+	desc := fmt.Sprintf("connections will be marked with fwmark %#x", mark)
+	if len(addrs) > 0 {
+		desc = fmt.Sprintf("%s when directed to %v", desc, addrs)
+	}
+	if len(ports) > 0 {
+		desc = fmt.Sprintf("%s on ports %v", desc, ports)
+	}
+	return &FWMarkPolicy{
+		basePolicy: basePolicy{
+			Name:   fmt.Sprintf("fwmark_%s", name),
+			Issuer: issuer,
+			Code:   PolicyCodeFWMark,
+			Desc:   desc,
+			Addrs:  addrs,
+			Ports:  ports,
+		},
+		Mark: mark,
+	}
+}
+
+// Static implements StaticPolicy.
+func (p *FWMarkPolicy) Static() bool {
 	return true
 }
 
+// Accept implements Policy. FWMarkPolicy does not affect the choice of
+// the source.
+func (p *FWMarkPolicy) Accept(id, address string) bool {
+	return true
+}
+
+// FWMark implements FWMarker.
+func (p *FWMarkPolicy) FWMark(host string, port int) (uint32, bool) {
+	if p.applies(host, port) {
+		return p.Mark, true
+	}
+	return 0, false
+}
+
 // HistoryQueryFunc describes the function that is used to query the bind
 // history of an entity. It is called passing the connection address in question,
 // and it returns the source identifier that is associated to it and true,
@@ -202,6 +754,11 @@ type HistoryQueryFunc func(string) (string, bool)
 type StickyPolicy struct {
 	basePolicy
 	BindHistory HistoryQueryFunc `json:"-"`
+	// Domains, if not empty, restrict the policy to the connections
+	// to these domains and to their subdomains. DomainSets are the
+	// names of the domain sets they were taken from, if any.
+	Domains    []string `json:"domains,omitempty"`
+	DomainSets []string `json:"domain_sets,omitempty"`
 }
 
 func NewStickyPolicy(issuer string, f HistoryQueryFunc) *StickyPolicy {
@@ -216,8 +773,41 @@ func NewStickyPolicy(issuer string, f HistoryQueryFunc) *StickyPolicy {
 	}
 }
 
+// ScopeTo restricts the policy to the connections to `domains`, and to
+// their subdomains. `sets` are the names of the domain sets `domains`
+// were taken from, if any. Call it before adding the policy to the
+// store, which then records only the bindings of these connections.
+func (p *StickyPolicy) ScopeTo(domains []string, sets ...string) {
+	if len(domains) == 0 {
+		return
+	}
+	for _, v := range domains {
+		p.Domains = append(p.Domains, strings.TrimSuffix(strings.ToLower(v), "."))
+	}
+	p.DomainSets = sets
+	p.Desc = fmt.Sprintf("%s, for the connections to %v", p.Desc, p.Domains)
+}
+
+// Covers reports whether the policy applies to the connections to
+// `host`.
+func (p *StickyPolicy) Covers(host string) bool {
+	if len(p.Domains) == 0 {
+		return true
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, v := range p.Domains {
+		if host == v || strings.HasSuffix(host, "."+v) {
+			return true
+		}
+	}
+	return false
+}
+
 // Accept implements Policy.
 func (p *StickyPolicy) Accept(id, address string) bool {
+	if net.ParseIP(address) == nil && !p.Covers(address) {
+		return true
+	}
 	if hid, ok := p.BindHistory(address); ok {
 		return id == hid
 	}
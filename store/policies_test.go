@@ -18,7 +18,12 @@ package store_test
 import (
 	"context"
 	"testing"
+	"time"
 
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/geoip"
+	"github.com/booster-proj/booster/process"
+	"github.com/booster-proj/booster/protocol"
 	"github.com/booster-proj/booster/store"
 )
 
@@ -124,6 +129,251 @@ func TestAvoidPolicy(t *testing.T) {
 	}
 }
 
+func TestMeteredPolicy(t *testing.T) {
+	store.Resolver = resolver{}
+	s0 := &mock{id: "foo"}
+	s1 := &mock{id: "bar"}
+	t0 := "host0"
+	t1 := "host1"
+
+	isMetered := func(id string) bool {
+		return id == s0.ID()
+	}
+	p := store.NewMeteredPolicy("T", false, isMetered, t0)
+	if ok := p.Accept(s0.ID(), t0); ok {
+		t.Fatalf("Policy %s accepted source %v for address %s", p.ID(), s0.ID(), t0)
+	}
+	if ok := p.Accept(s1.ID(), t0); !ok {
+		t.Fatalf("Policy %s did not accept source %v for address %s", p.ID(), s1.ID(), t0)
+	}
+	if ok := p.Accept(s0.ID(), t1); !ok {
+		t.Fatalf("Policy %s did not accept source %v for address %s", p.ID(), s0.ID(), t1)
+	}
+
+	// metered policy without addresses
+	p = store.NewMeteredPolicy("T", true, isMetered)
+	if ok := p.Accept(s0.ID(), t1); !ok {
+		t.Fatalf("Policy %s did not accept source %v for address %s", p.ID(), s0.ID(), t1)
+	}
+	if ok := p.Accept(s1.ID(), t1); ok {
+		t.Fatalf("Policy %s accepted source %v for address %s", p.ID(), s1.ID(), t1)
+	}
+}
+
+func TestDSCPPolicy(t *testing.T) {
+	store.Resolver = resolver{addrs: []string{"10.0.0.1"}}
+	s := store.New(&storage{data: []core.Source{&mock{id: "s0"}}})
+	s.AppendPolicy(store.NewDSCPPolicy("T", "voip", 46, store.Ports{{From: 5060, To: 5060}}, "sip.example.com"))
+	s.AppendPolicy(store.NewDSCPPolicy("T", "bulk", 8, store.Ports{{From: 873, To: 873}}))
+
+	tt := []struct {
+		address string
+		dscp    int
+		ok      bool
+	}{
+		{address: "sip.example.com:5060", dscp: 46, ok: true},
+		{address: "10.0.0.1:5060", dscp: 46, ok: true},
+		{address: "sip.example.com:443"},
+		{address: "rsync.example.com:873", dscp: 8, ok: true},
+		{address: "example.com:443"},
+	}
+	for _, v := range tt {
+		dscp, ok := s.DSCP(v.address)
+		if dscp != v.dscp || ok != v.ok {
+			t.Fatalf("%s: unexpected DSCP: wanted %d, %v; found %d, %v", v.address, v.dscp, v.ok, dscp, ok)
+		}
+	}
+	if ok, _ := s.ShouldAccept("s0", "sip.example.com:5060"); !ok {
+		t.Fatalf("DSCP policies should accept every connection")
+	}
+}
+
+func TestFWMarkPolicy(t *testing.T) {
+	store.Resolver = resolver{addrs: []string{"10.0.0.1"}}
+	s := store.New(&storage{data: []core.Source{&mock{id: "s0"}}})
+	s.AppendPolicy(store.NewFWMarkPolicy("T", "vpn", 0x10, nil, "intranet.example.com"))
+
+	tt := []struct {
+		address string
+		mark    uint32
+		ok      bool
+	}{
+		{address: "intranet.example.com:443", mark: 0x10, ok: true},
+		{address: "10.0.0.1:22", mark: 0x10, ok: true},
+		{address: "example.com:443"},
+	}
+	for _, v := range tt {
+		mark, ok := s.FWMark(v.address)
+		if mark != v.mark || ok != v.ok {
+			t.Fatalf("%s: unexpected mark: wanted %#x, %v; found %#x, %v", v.address, v.mark, v.ok, mark, ok)
+		}
+	}
+	if ok, _ := s.ShouldAccept("s0", "intranet.example.com:443"); !ok {
+		t.Fatalf("fwmark policies should accept every connection")
+	}
+}
+
+func TestProcessPolicy(t *testing.T) {
+	wifi := &mock{id: "wlan0"}
+	lte := &mock{id: "wwan0"}
+	spotify := process.Process{PID: 1, Name: "spotify"}
+	firefox := process.Process{PID: 2, Name: "firefox"}
+
+	p := store.NewProcessPolicy("T", "spotify", wifi.ID())
+	if ok := p.Accept(lte.ID(), "host"); !ok {
+		t.Fatalf("Policy %s should accept everything without a process", p.ID())
+	}
+	if ok := p.AcceptProcess(lte.ID(), spotify); ok {
+		t.Fatalf("Policy %s accepted source %v for process %v", p.ID(), lte.ID(), spotify)
+	}
+	if ok := p.AcceptProcess(wifi.ID(), spotify); !ok {
+		t.Fatalf("Policy %s did not accept source %v for process %v", p.ID(), wifi.ID(), spotify)
+	}
+	if ok := p.AcceptProcess(lte.ID(), firefox); !ok {
+		t.Fatalf("Policy %s did not accept source %v for process %v", p.ID(), lte.ID(), firefox)
+	}
+
+	s := store.New(new(core.Balancer))
+	s.Put(wifi, lte)
+	s.AppendPolicy(p)
+	ctx := process.NewContext(context.Background(), spotify)
+	for i := 0; i < 4; i++ {
+		src, err := s.Get(ctx, "host:443")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if src.ID() != wifi.ID() {
+			t.Fatalf("Unexpected source for %v: %v", spotify, src.ID())
+		}
+	}
+}
+
+func TestGeoPolicy(t *testing.T) {
+	vpn := "tun0"
+	locate := func(host string) []geoip.Location {
+		switch host {
+		case "eu.example.com":
+			return []geoip.Location{{Country: "IT", Continent: "EU"}}
+		case "us.example.com":
+			return []geoip.Location{{Country: "US", Continent: "NA", ASN: 64496}}
+		}
+		return nil
+	}
+
+	p := store.NewGeoPolicy("T", vpn, locate, nil, []string{"eu"}, nil)
+	if ok := p.Accept(vpn, "eu.example.com"); !ok {
+		t.Fatalf("Policy %s did not accept source %v for EU destinations", p.ID(), vpn)
+	}
+	if ok := p.Accept("en0", "eu.example.com"); ok {
+		t.Fatalf("Policy %s accepted source en0 for EU destinations", p.ID())
+	}
+	for _, id := range []string{vpn, "en0"} {
+		for _, host := range []string{"us.example.com", "unknown.example.com"} {
+			if ok := p.Accept(id, host); !ok {
+				t.Fatalf("Policy %s did not accept source %v for %s", p.ID(), id, host)
+			}
+		}
+	}
+
+	p = store.NewGeoPolicy("T", vpn, locate, []string{"FR"}, nil, []uint{64496})
+	if ok := p.Accept("en0", "us.example.com"); ok {
+		t.Fatalf("Policy %s accepted source en0 for AS64496", p.ID())
+	}
+	if ok := p.Accept("en0", "eu.example.com"); !ok {
+		t.Fatalf("Policy %s did not accept source en0 for IT destinations", p.ID())
+	}
+}
+
+func TestExprPolicy(t *testing.T) {
+	isMetered := func(id string) bool { return id == "wwan0" }
+	src := `!(metered && (host matches "*.video.com" || port == 22)) && !(weekday == "sat" && hour < 8)`
+	p, err := store.NewExprPolicy("T", "no_video", src, isMetered)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Monday.
+	p.Now = func() time.Time { return time.Date(2019, 4, 1, 12, 0, 0, 0, time.Local) }
+
+	if ok := p.Accept("wwan0", "cdn.video.com"); ok {
+		t.Fatalf("Policy %s accepted metered source for video", p.ID())
+	}
+	if ok := p.Accept("en0", "cdn.video.com"); !ok {
+		t.Fatalf("Policy %s did not accept unmetered source for video", p.ID())
+	}
+	if ok := p.AcceptPort("wwan0", "example.com", 443); !ok {
+		t.Fatalf("Policy %s did not accept metered source for port 443", p.ID())
+	}
+	if ok := p.AcceptPort("wwan0", "example.com", 22); ok {
+		t.Fatalf("Policy %s accepted metered source for port 22", p.ID())
+	}
+
+	// Saturday morning.
+	p.Now = func() time.Time { return time.Date(2019, 4, 6, 7, 0, 0, 0, time.Local) }
+	if ok := p.Accept("en0", "example.com"); ok {
+		t.Fatalf("Policy %s accepted source on saturday morning", p.ID())
+	}
+
+	if _, err := store.NewExprPolicy("T", "invalid", `port == "22"`, isMetered); err == nil {
+		t.Fatalf("Invalid expression was accepted")
+	}
+}
+
+func TestShouldAccept_port(t *testing.T) {
+	s := store.New(new(core.Balancer))
+	p, err := store.NewExprPolicy("T", "ssh", `port != 22 || source == "en0"`, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	s.AppendPolicy(p)
+
+	if ok, _ := s.ShouldAccept("wwan0", "host:22"); ok {
+		t.Fatalf("Policy %s accepted source wwan0 for port 22", p.ID())
+	}
+	if ok, _ := s.ShouldAccept("wwan0", "host:443"); !ok {
+		t.Fatalf("Policy %s did not accept source wwan0 for port 443", p.ID())
+	}
+}
+
+func TestShouldAccept_portRange(t *testing.T) {
+	store.Resolver = resolver{}
+	s := store.New(&storage{data: []core.Source{&mock{id: "en0"}, &mock{id: "wwan0"}, &mock{id: "vpn0"}}})
+	s.SetMetered("wwan0", true)
+	torrent, _ := store.ParsePorts("6881-6889")
+
+	// BitTorrent ports only on the unmetered source.
+	p := store.NewMeteredPolicy("T", false, s.IsMetered)
+	p.OnPorts(torrent)
+	s.AppendPolicy(p)
+	// Port 8443 of host0 only through vpn0.
+	r := store.NewReservedPolicy("T", "vpn0", "host0")
+	r.OnPorts(store.Ports{{From: 8443, To: 8443}})
+	s.AppendPolicy(r)
+
+	tt := []struct {
+		id      string
+		address string
+		ok      bool
+	}{
+		{id: "wwan0", address: "tracker:6881"},
+		{id: "wwan0", address: "tracker:6889"},
+		{id: "en0", address: "tracker:6885", ok: true},
+		{id: "wwan0", address: "tracker:6890", ok: true},
+		{id: "wwan0", address: "tracker", ok: true},
+		{id: "en0", address: "host0:8443"},
+		{id: "vpn0", address: "host0:8443", ok: true},
+		{id: "en0", address: "host0:443", ok: true},
+		{id: "vpn0", address: "host0:443"},
+	}
+	for _, v := range tt {
+		if ok, _ := s.ShouldAccept(v.id, v.address); ok != v.ok {
+			t.Fatalf("%s for %s: wanted %v, found %v", v.id, v.address, v.ok, ok)
+		}
+	}
+	if p.ID() != "metered_false_on_6881-6889" {
+		t.Fatalf("Unexpected policy id: %s", p.ID())
+	}
+}
+
 func TestStickyPolicy(t *testing.T) {
 	store.Resolver = resolver{}
 	s0 := &mock{id: "foo"}
@@ -164,3 +414,78 @@ func TestStickyPolicy(t *testing.T) {
 		t.Fatalf("Policy %s did not accept source %v for address %s", p.ID(), s1.ID(), t1)
 	}
 }
+
+func TestProtocolPolicy(t *testing.T) {
+	wifi := &mock{id: "wlan0"}
+	lte := &mock{id: "wwan0"}
+
+	p := store.NewProtocolPolicy("T", protocol.BitTorrent, wifi.ID())
+	if ok := p.Accept(lte.ID(), "host"); !ok {
+		t.Fatalf("Policy %s should accept everything without a protocol", p.ID())
+	}
+	if ok := p.AcceptProtocol(lte.ID(), protocol.BitTorrent); ok {
+		t.Fatalf("Policy %s accepted source %v for %v", p.ID(), lte.ID(), protocol.BitTorrent)
+	}
+	if ok := p.AcceptProtocol(wifi.ID(), protocol.BitTorrent); !ok {
+		t.Fatalf("Policy %s did not accept source %v for %v", p.ID(), wifi.ID(), protocol.BitTorrent)
+	}
+	if ok := p.AcceptProtocol(lte.ID(), protocol.HTTP); !ok {
+		t.Fatalf("Policy %s did not accept source %v for %v", p.ID(), lte.ID(), protocol.HTTP)
+	}
+
+	s := store.New(new(core.Balancer))
+	s.Put(wifi, lte)
+	s.AppendPolicy(p)
+	ctx := protocol.NewContext(context.Background(), protocol.BitTorrent)
+	for i := 0; i < 4; i++ {
+		src, err := s.Get(ctx, "host:6881")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if src.ID() != wifi.ID() {
+			t.Fatalf("Unexpected source for %v: %v", protocol.BitTorrent, src.ID())
+		}
+	}
+}
+
+func TestStickyPolicy_scope(t *testing.T) {
+	store.Resolver = resolver{}
+	s := store.New(&storage{})
+	s.DomainSets = map[string][]string{"banking": {"mybank.com"}}
+
+	if _, err := s.ExpandDomainSets("streaming"); err == nil {
+		t.Fatalf("Unknown domain set expanded")
+	}
+	domains, err := s.ExpandDomainSets("banking")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := store.NewStickyPolicy("T", s.QueryBindHistory)
+	p.ScopeTo(append(domains, "Pay.example."), "banking")
+	if err := s.AppendPolicy(p); err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		host   string
+		sticks bool
+	}{
+		{"mybank.com", true},
+		{"www.mybank.com", true},
+		{"notmybank.com", false},
+		{"pay.example", true},
+		{"news.com", false},
+	}
+	for i, v := range tt {
+		if p.Covers(v.host) != v.sticks {
+			t.Fatalf("%d: %s: wanted covered %v", i, v.host, v.sticks)
+		}
+		s.SaveBindHistory(context.TODO(), "s0", v.host)
+		if _, ok := s.QueryBindHistory(v.host); ok != v.sticks {
+			t.Fatalf("%d: %s: wanted recorded %v", i, v.host, v.sticks)
+		}
+		if ok := p.Accept("s1", v.host); ok == v.sticks {
+			t.Fatalf("%d: %s: wanted s1 accepted %v", i, v.host, !v.sticks)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PortRange is a range of destination ports, bounds included. It is
+// encoded in JSON either as a number, for a single port, or as a
+// string in the form "6881-6889".
+type PortRange struct {
+	From int
+	To   int
+}
+
+// ParsePortRange parses either a single port, e.g. "443", or a range
+// of ports, e.g. "6881-6889".
+func ParsePortRange(s string) (PortRange, error) {
+	from, to := s, s
+	if i := strings.Index(s, "-"); i >= 0 {
+		from, to = s[:i], s[i+1:]
+	}
+	var r PortRange
+	var err error
+	if r.From, err = parsePort(from); err != nil {
+		return r, err
+	}
+	if r.To, err = parsePort(to); err != nil {
+		return r, err
+	}
+	if r.From > r.To {
+		return r, fmt.Errorf("invalid port range %q: %d is greater than %d", s, r.From, r.To)
+	}
+	return r, nil
+}
+
+func parsePort(s string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n < 1 || n > 65535 {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return n, nil
+}
+
+// Contains reports whether `port` is part of the range.
+func (r PortRange) Contains(port int) bool {
+	return port >= r.From && port <= r.To
+}
+
+func (r PortRange) String() string {
+	if r.From == r.To {
+		return strconv.Itoa(r.From)
+	}
+	return fmt.Sprintf("%d-%d", r.From, r.To)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r PortRange) MarshalJSON() ([]byte, error) {
+	if r.From == r.To {
+		return json.Marshal(r.From)
+	}
+	return json.Marshal(r.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (r *PortRange) UnmarshalJSON(b []byte) error {
+	var n int
+	if err := json.Unmarshal(b, &n); err == nil {
+		*r, err = ParsePortRange(strconv.Itoa(n))
+		return err
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("invalid port range %s", b)
+	}
+	var err error
+	*r, err = ParsePortRange(s)
+	return err
+}
+
+// Ports is a list of port ranges. Policies with an empty list apply to
+// any port.
+type Ports []PortRange
+
+// ParsePorts parses the ports, or port ranges, in `s`. See
+// ParsePortRange.
+func ParsePorts(s ...string) (Ports, error) {
+	acc := make(Ports, 0, len(s))
+	for _, v := range s {
+		r, err := ParsePortRange(v)
+		if err != nil {
+			return nil, err
+		}
+		acc = append(acc, r)
+	}
+	return acc, nil
+}
+
+// Contains reports whether `port` is part of one of the ranges. An
+// empty list contains every port.
+func (p Ports) Contains(port int) bool {
+	if len(p) == 0 {
+		return true
+	}
+	for _, v := range p {
+		if v.Contains(port) {
+			return true
+		}
+	}
+	return false
+}
+
+// overlaps reports whether `p` and `o` have ports in common.
+func (p Ports) overlaps(o Ports) bool {
+	if len(p) == 0 || len(o) == 0 {
+		return true
+	}
+	for _, a := range p {
+		for _, b := range o {
+			if a.From <= b.To && b.From <= a.To {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p Ports) join(sep string) string {
+	acc := make([]string, 0, len(p))
+	for _, v := range p {
+		acc = append(acc, v.String())
+	}
+	return strings.Join(acc, sep)
+}
+
+func (p Ports) String() string {
+	return "[" + p.join(" ") + "]"
+}
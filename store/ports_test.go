@@ -0,0 +1,71 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/booster-proj/booster/store"
+)
+
+func TestParsePortRange(t *testing.T) {
+	tt := []struct {
+		in   string
+		want store.PortRange
+		ok   bool
+	}{
+		{in: "443", want: store.PortRange{From: 443, To: 443}, ok: true},
+		{in: "6881-6889", want: store.PortRange{From: 6881, To: 6889}, ok: true},
+		{in: "6889-6881"},
+		{in: "0"},
+		{in: "65536"},
+		{in: "http"},
+		{in: "1-"},
+	}
+	for _, v := range tt {
+		r, err := store.ParsePortRange(v.in)
+		if ok := err == nil; ok != v.ok {
+			t.Fatalf("%q: unexpected error: %v", v.in, err)
+		}
+		if v.ok && r != v.want {
+			t.Fatalf("%q: wanted %v, found %v", v.in, v.want, r)
+		}
+	}
+}
+
+func TestPorts_JSON(t *testing.T) {
+	var p store.Ports
+	if err := json.Unmarshal([]byte(`[443, "6881-6889", "22"]`), &p); err != nil {
+		t.Fatal(err)
+	}
+	if !p.Contains(443) || !p.Contains(6885) || !p.Contains(22) || p.Contains(80) {
+		t.Fatalf("Unexpected ports: %v", p)
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `[443,"6881-6889",22]` {
+		t.Fatalf("Unexpected encoding: %s", b)
+	}
+	if err := json.Unmarshal([]byte(`[true]`), &p); err == nil {
+		t.Fatalf("Unmarshal accepted an invalid port")
+	}
+	if !(store.Ports{}).Contains(80) {
+		t.Fatalf("An empty list should contain every port")
+	}
+}
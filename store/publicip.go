@@ -0,0 +1,71 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/booster-proj/booster/events"
+)
+
+// PublicIPChange is the data of the TopicPublicIP events.
+type PublicIPChange struct {
+	Source   string `json:"source"`
+	Previous string `json:"previous,omitempty"`
+	Current  string `json:"current"`
+}
+
+// SetPublicIP records `ip` as the public address of source `id`,
+// publishing a TopicPublicIP event when it differs from the one
+// recorded before, the first detection included. The address is kept
+// even if the source is removed, so that a source coming back with
+// another address is reported as changed.
+func (ss *SourceStore) SetPublicIP(id string, ip net.IP) {
+	current := ip.String()
+
+	ss.publicIPs.Lock()
+	previous, ok := ss.publicIPs.val[id]
+	if ok && previous == current {
+		ss.publicIPs.Unlock()
+		return
+	}
+	if ss.publicIPs.val == nil {
+		ss.publicIPs.val = make(map[string]string)
+	}
+	ss.publicIPs.val[id] = current
+	ss.publicIPs.Unlock()
+
+	msg := fmt.Sprintf("source %v public IP is %v", id, current)
+	if ok {
+		msg = fmt.Sprintf("source %v public IP changed from %v to %v", id, previous, current)
+	}
+	ss.Events.Publish(events.Event{
+		Topic:   events.TopicPublicIP,
+		Message: msg,
+		Data:    PublicIPChange{Source: id, Previous: previous, Current: current},
+	})
+}
+
+// PublicIP returns the public address of source `id` last recorded
+// with SetPublicIP.
+func (ss *SourceStore) PublicIP(id string) (string, bool) {
+	ss.publicIPs.RLock()
+	defer ss.publicIPs.RUnlock()
+
+	ip, ok := ss.publicIPs.val[id]
+	return ip, ok
+}
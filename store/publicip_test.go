@@ -0,0 +1,54 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/events"
+	"github.com/booster-proj/booster/store"
+)
+
+func TestSetPublicIP(t *testing.T) {
+	s := store.New(&storage{data: []core.Source{&mock{id: "en0"}}})
+	s.Events = new(events.Bus)
+
+	if _, ok := s.PublicIP("en0"); ok {
+		t.Fatalf("en0 should have no public IP yet")
+	}
+	s.SetPublicIP("en0", net.ParseIP("203.0.113.1"))
+	s.SetPublicIP("en0", net.ParseIP("203.0.113.1"))
+	s.SetPublicIP("en0", net.ParseIP("203.0.113.2"))
+
+	if ip, _ := s.PublicIP("en0"); ip != "203.0.113.2" {
+		t.Fatalf("Unexpected public IP: %v", ip)
+	}
+	if snap := s.GetSourcesSnapshot(); snap[0].PublicIP != "203.0.113.2" {
+		t.Fatalf("Unexpected public IP in the snapshot: %v", snap[0].PublicIP)
+	}
+
+	// Only the first detection and the change are published.
+	e := s.Events.Recent()
+	if len(e) != 2 {
+		t.Fatalf("Unexpected events: %+v", e)
+	}
+	want := store.PublicIPChange{Source: "en0", Previous: "203.0.113.1", Current: "203.0.113.2"}
+	if e[1].Topic != events.TopicPublicIP || e[1].Data != want {
+		t.Fatalf("Unexpected event: %+v", e[1])
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"context"
+
+	"github.com/booster-proj/booster/core"
+)
+
+// Scope is the policy set and strategy of a listener, e.g. an
+// additional proxy port forcing the VPN source, sharing the sources of
+// the store with the others. The connections dialed with a context
+// carrying its name, see WithScope, are subject to its policies in
+// place of the ones of the store, and are assigned a source with its
+// strategy.
+type Scope struct {
+	Name string `json:"name"`
+	// Strategy, if not nil, replaces the one of the store.
+	Strategy core.Strategy `json:"-"`
+	// Policies replace the ones of the store. The disabled sources
+	// are avoided anyway.
+	Policies []Policy `json:"policies"`
+}
+
+type scopeKey struct{}
+
+// WithScope returns a copy of `ctx` carrying the name of the Scope the
+// connection belongs to.
+func WithScope(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, scopeKey{}, name)
+}
+
+// ScopeFromContext returns the name of the scope stored in `ctx` by
+// WithScope, if any.
+func ScopeFromContext(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(scopeKey{}).(string)
+	return name, ok
+}
+
+// scope returns the Scope of the connection described by `ctx`, or nil
+// if it has none or it is unknown.
+func (ss *SourceStore) scope(ctx context.Context) *Scope {
+	name, ok := ScopeFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return ss.Scopes[name]
+}
+
+// scopeBlacklist returns the sources refused by the policies of
+// `scope` for the connections to `target`, with the identifier of the
+// policy refusing each of them.
+func (ss *SourceStore) scopeBlacklist(scope *Scope, target string) ([]core.Source, []string) {
+	if len(scope.Policies) == 0 {
+		return nil, nil
+	}
+	var acc []core.Source
+	var refusing []string
+	for _, src := range ss.available(nil) {
+		for _, p := range scope.Policies {
+			if !ss.accept(p, src.ID(), target) {
+				acc, refusing = append(acc, src), append(refusing, p.ID())
+				break
+			}
+		}
+	}
+	return acc, refusing
+}
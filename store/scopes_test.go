@@ -0,0 +1,75 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/store"
+)
+
+func TestGet_scope(t *testing.T) {
+	s0 := &mock{id: "s0"}
+	s1 := &mock{id: "s1"}
+
+	s := store.New(new(core.Balancer))
+	s.Put(s0, s1)
+	vpn, err := store.NewExprPolicy("listener vpn", "vpn_0", `source == "s1"`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var used bool
+	s.Scopes = map[string]*store.Scope{
+		"vpn": {Name: "vpn", Policies: []store.Policy{vpn}},
+		"first": {Name: "first", Strategy: func(ctx context.Context, r *core.Ring) (core.Source, error) {
+			used = true
+			return r.Value.(core.Source), nil
+		}},
+	}
+
+	ctx := store.WithScope(context.Background(), "vpn")
+	for i := 0; i < 4; i++ {
+		src, err := s.Get(ctx, "host:443")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if src.ID() != "s1" {
+			t.Fatalf("Unexpected source in scope: wanted s1, found %v", src)
+		}
+	}
+
+	// The connections without a scope are not subject to its policies.
+	seen := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		src, err := s.Get(context.Background(), "host:443")
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[src.ID()] = true
+	}
+	if len(seen) != 2 {
+		t.Fatalf("Unexpected sources without scope: %v", seen)
+	}
+
+	if _, err := s.Get(store.WithScope(context.Background(), "first"), "host:443"); err != nil {
+		t.Fatal(err)
+	}
+	if !used {
+		t.Fatal("Strategy of the scope not used")
+	}
+}
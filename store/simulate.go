@@ -0,0 +1,124 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+// Decision is a source selection performed by the store.
+type Decision struct {
+	Time   time.Time `json:"time"`
+	Target string    `json:"target"`
+	Source string    `json:"source"`
+}
+
+// decisionLog is a ring buffer containing the last decisions.
+type decisionLog struct {
+	sync.Mutex
+	val  []Decision
+	next int
+	full bool
+}
+
+func (ss *SourceStore) recordDecision(target, id string) {
+	n := ss.RecordDecisions
+	if n <= 0 {
+		return
+	}
+
+	l := &ss.decisions
+	l.Lock()
+	defer l.Unlock()
+	if len(l.val) != n {
+		// First use, or the size changed.
+		l.val, l.next, l.full = make([]Decision, n), 0, false
+	}
+	l.val[l.next] = Decision{Time: time.Now(), Target: target, Source: id}
+	l.next = (l.next + 1) % n
+	l.full = l.full || l.next == 0
+}
+
+// Decisions returns the decisions recorded, the oldest first. See
+// RecordDecisions.
+func (ss *SourceStore) Decisions() []Decision {
+	l := &ss.decisions
+	l.Lock()
+	defer l.Unlock()
+	if !l.full {
+		return append([]Decision{}, l.val[:l.next]...)
+	}
+	acc := make([]Decision, 0, len(l.val))
+	acc = append(acc, l.val[l.next:]...)
+	return append(acc, l.val[:l.next]...)
+}
+
+// Simulation reports how the decisions recorded would change under a
+// different set of policies.
+type Simulation struct {
+	// Decisions is the number of decisions evaluated.
+	Decisions int `json:"decisions"`
+	// Changes are the decisions whose source would be refused.
+	Changes []Change `json:"changes"`
+}
+
+// Change is a recorded decision that a proposed policy refuses.
+type Change struct {
+	Decision
+	// Policy is the identifier of the first policy refusing the
+	// source.
+	Policy string `json:"policy"`
+	// Alternatives are the sources currently stored that the
+	// policies accept, which the connection would use instead. If
+	// empty, the connection would fail.
+	Alternatives []string `json:"alternatives"`
+}
+
+// Simulate evaluates `policies`, which would replace the ones stored,
+// against the decisions recorded, reporting the ones that would
+// change. The process, protocol and non static policies are
+// evaluated as they would be now, which may differ from when the
+// decision was taken.
+func (ss *SourceStore) Simulate(policies []Policy) Simulation {
+	decisions := ss.Decisions()
+	sources := ss.available(ss.disabledBlacklist())
+
+	refused := func(id, target string) (Policy, bool) {
+		for _, p := range policies {
+			if !ss.accept(p, id, target) {
+				return p, true
+			}
+		}
+		return nil, false
+	}
+
+	sim := Simulation{Decisions: len(decisions), Changes: []Change{}}
+	for _, d := range decisions {
+		p, ok := refused(d.Source, d.Target)
+		if !ok {
+			continue
+		}
+		c := Change{Decision: d, Policy: p.ID(), Alternatives: []string{}}
+		for _, src := range sources {
+			if _, ok := refused(src.ID(), d.Target); !ok {
+				c.Alternatives = append(c.Alternatives, src.ID())
+			}
+		}
+		sim.Changes = append(sim.Changes, c)
+	}
+	return sim
+}
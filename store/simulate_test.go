@@ -0,0 +1,63 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/store"
+)
+
+func TestSimulate(t *testing.T) {
+	st := &storage{data: []core.Source{&mock{id: "s0"}, &mock{id: "s1"}}}
+	s := store.New(st)
+	s.RecordDecisions = 2
+
+	ctx := context.Background()
+	for _, v := range []string{"a.com:443", "b.com:443", "c.com:443"} {
+		if _, err := s.Get(ctx, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Only the last decisions are kept.
+	d := s.Decisions()
+	if len(d) != 2 || d[0].Target != "b.com:443" || d[1].Target != "c.com:443" || d[1].Source != "s0" {
+		t.Fatalf("Unexpected decisions: %+v", d)
+	}
+
+	sim := s.Simulate([]store.Policy{
+		store.NewReservedPolicy("T", "s1", "b.com"),
+	})
+	if sim.Decisions != 2 || len(sim.Changes) != 1 {
+		t.Fatalf("Unexpected simulation: %+v", sim)
+	}
+	c := sim.Changes[0]
+	if c.Target != "b.com:443" || c.Policy != "reserve_s1" || !reflect.DeepEqual(c.Alternatives, []string{"s1"}) {
+		t.Fatalf("Unexpected change: %+v", c)
+	}
+
+	// The simulation does not apply the policies.
+	if len(s.GetPoliciesSnapshot()) != 0 {
+		t.Fatalf("Simulate should not store the policies")
+	}
+	sim = s.Simulate([]store.Policy{store.NewBlockPolicy("T", "s0"), store.NewBlockPolicy("T", "s1")})
+	if len(sim.Changes) != 2 || len(sim.Changes[0].Alternatives) != 0 {
+		t.Fatalf("Unexpected simulation: %+v", sim)
+	}
+}
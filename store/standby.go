@@ -0,0 +1,157 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/events"
+	"upspin.io/log"
+)
+
+// DefaultStandbyWindow is the default amount of time the active source
+// has to fail for before the store switches over to a standby one.
+const DefaultStandbyWindow = 10 * time.Second
+
+// HealthChecker reports the sources that are failing, e.g. the prober
+// when their probes do not succeed.
+type HealthChecker interface {
+	// FailingSince returns when source `id` started failing, and
+	// false if it is not failing.
+	FailingSince(id string) (time.Time, bool)
+}
+
+// Switchover is the data of the TopicSwitchover events.
+type Switchover struct {
+	From   string `json:"from,omitempty"`
+	To     string `json:"to"`
+	Reason string `json:"reason"`
+}
+
+// standby keeps track of the active source when the store is in hot
+// standby mode.
+type standby struct {
+	sync.Mutex
+	active string
+}
+
+func (ss *SourceStore) standbyWindow() time.Duration {
+	if ss.StandbyWindow > 0 {
+		return ss.StandbyWindow
+	}
+	return DefaultStandbyWindow
+}
+
+// failing reports whether source `id` failed for longer than the
+// detection window at `now`.
+func (ss *SourceStore) failing(id string, now time.Time) bool {
+	if ss.Health == nil {
+		return false
+	}
+	since, ok := ss.Health.FailingSince(id)
+	return ok && now.Sub(since) >= ss.standbyWindow()
+}
+
+// ActiveSource returns the source carrying the traffic in hot standby
+// mode, electing it if needed: the active source stays so while it is
+// stored and does not fail for longer than StandbyWindow. Otherwise,
+// the healthy source of the highest tier is elected, the first in
+// lexical order among the ones of the same tier. Returns false if the
+// store is not in standby mode or it is empty.
+func (ss *SourceStore) ActiveSource() (string, bool) {
+	if !ss.Standby {
+		return "", false
+	}
+	now := time.Now()
+	sources := ss.available(nil)
+
+	ss.standby.Lock()
+	defer ss.standby.Unlock()
+
+	current := ss.standby.active
+	var stored bool
+	for _, v := range sources {
+		if v.ID() == current {
+			stored = true
+			break
+		}
+	}
+	if stored && !ss.failing(current, now) {
+		return current, true
+	}
+	if len(sources) == 0 {
+		return "", false
+	}
+
+	sort.Slice(sources, func(i, j int) bool {
+		fi, fj := ss.failing(sources[i].ID(), now), ss.failing(sources[j].ID(), now)
+		if fi != fj {
+			return !fi
+		}
+		ti, tj := ss.SourceTier(sources[i].ID()), ss.SourceTier(sources[j].ID())
+		if ti != tj {
+			return ti < tj
+		}
+		return sources[i].ID() < sources[j].ID()
+	})
+	next := sources[0].ID()
+	if next == current || (stored && ss.failing(next, now)) {
+		// Every source is failing: keep the current one.
+		return current, true
+	}
+	ss.standby.active = next
+
+	reason := "elected"
+	switch {
+	case current == "":
+	case !stored:
+		reason = fmt.Sprintf("source %v is down", current)
+	default:
+		reason = fmt.Sprintf("source %v is failing", current)
+	}
+	log.Info.Printf("SourceStore: switching over to source %v: %s", next, reason)
+	ss.Events.Publish(events.Event{
+		Topic:   events.TopicSwitchover,
+		Message: fmt.Sprintf("switched over to source %v: %s", next, reason),
+		Data:    Switchover{From: current, To: next, Reason: reason},
+	})
+	return next, true
+}
+
+// standbyBlacklist returns the sources that are not active, in hot
+// standby mode. Returns false if there is no active source or it is
+// blacklisted, in which case the standby sources are chosen as usual.
+func (ss *SourceStore) standbyBlacklist(blacklisted []core.Source) ([]core.Source, bool) {
+	active, ok := ss.ActiveSource()
+	if !ok {
+		return nil, false
+	}
+	sources := ss.available(blacklisted)
+	acc := make([]core.Source, 0, len(sources))
+	for _, v := range sources {
+		if v.ID() != active {
+			acc = append(acc, v)
+		}
+	}
+	if len(acc) == len(sources) {
+		return nil, false
+	}
+	return acc, true
+}
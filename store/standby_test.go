@@ -0,0 +1,118 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/events"
+	"github.com/booster-proj/booster/store"
+)
+
+type health map[string]time.Time
+
+func (h health) FailingSince(id string) (time.Time, bool) {
+	t, ok := h[id]
+	return t, ok
+}
+
+func TestGet_standby(t *testing.T) {
+	s0 := &mock{id: "s0"}
+	s1 := &mock{id: "s1"}
+	s2 := &mock{id: "s2"}
+	h := health{}
+	bus := new(events.Bus)
+	switchovers, cancel := bus.Subscribe(8)
+	defer cancel()
+
+	s := store.New(new(core.Balancer))
+	s.Events = bus
+	s.Standby = true
+	s.StandbyWindow = time.Minute
+	s.Health = h
+	s.SetTier(s0.ID(), store.TierSecondary)
+	s.Put(s0, s1, s2)
+
+	ctx := context.Background()
+	get := func(want core.Source, blacklisted ...core.Source) {
+		for i := 0; i < 3; i++ {
+			src, err := s.Get(ctx, "host:443", blacklisted...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if src.ID() != want.ID() {
+				t.Fatalf("Unexpected source: wanted %v, found %v", want, src)
+			}
+		}
+	}
+	switchover := func(from, to string) {
+		for {
+			select {
+			case e := <-switchovers:
+				if e.Topic != events.TopicSwitchover {
+					continue
+				}
+				if sw := e.Data.(store.Switchover); sw.From != from || sw.To != to {
+					t.Fatalf("Unexpected switchover: wanted %v -> %v, found %+v", from, to, sw)
+				}
+				return
+			default:
+				t.Fatalf("Switchover %v -> %v not published", from, to)
+			}
+		}
+	}
+
+	// The primary tier is elected first.
+	get(s1)
+	switchover("", "s1")
+	for _, v := range s.GetSourcesSnapshot() {
+		want := store.StateStandby
+		if v.ID == s1.ID() {
+			want = store.StateActive
+		}
+		if v.State != want {
+			t.Fatalf("Unexpected state of %v: wanted %v, found %v", v.ID, want, v.State)
+		}
+	}
+
+	// Standby sources are used only when the active one is unavailable.
+	get(s2, s1)
+
+	// Failures shorter than the window do not trigger a switchover.
+	h["s1"] = time.Now()
+	get(s1)
+	h["s1"] = time.Now().Add(-2 * time.Minute)
+	get(s2)
+	switchover("s1", "s2")
+
+	// The new active source stays so even when the old one recovers.
+	delete(h, "s1")
+	get(s2)
+
+	// When every source is failing, the active one is kept.
+	for _, v := range []string{"s0", "s1", "s2"} {
+		h[v] = time.Now().Add(-2 * time.Minute)
+	}
+	get(s2)
+
+	s.Del(s2)
+	delete(h, "s0")
+	get(s0)
+	switchover("s2", "s0")
+}
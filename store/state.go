@@ -0,0 +1,193 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/sockopt"
+)
+
+// SourceState is the configuration assigned at runtime to a source, or
+// group.
+type SourceState struct {
+	SourceLabels
+	Disabled bool             `json:"disabled,omitempty"`
+	Tier     *Tier            `json:"tier,omitempty"`
+	Metered  *bool            `json:"metered,omitempty"`
+	TCP      *sockopt.Options `json:"tcp,omitempty"`
+}
+
+// State is the configuration assigned at runtime to the store,
+// excluding its policies. It contains the sources that are not
+// available too.
+type State struct {
+	Sources map[string]SourceState `json:"sources"`
+	Groups  []core.SourceGroup     `json:"groups"`
+}
+
+// State returns a copy of the configuration of the store.
+func (ss *SourceStore) State() State {
+	acc := make(map[string]SourceState)
+	update := func(id string, f func(s *SourceState)) {
+		s := acc[id]
+		f(&s)
+		acc[id] = s
+	}
+
+	for id, l := range ss.GetLabelsSnapshot() {
+		update(id, func(s *SourceState) { s.SourceLabels = l })
+	}
+	ss.disabled.RLock()
+	for id := range ss.disabled.val {
+		update(id, func(s *SourceState) { s.Disabled = true })
+	}
+	ss.disabled.RUnlock()
+	ss.tiers.RLock()
+	for id, t := range ss.tiers.val {
+		t := t
+		update(id, func(s *SourceState) { s.Tier = &t })
+	}
+	ss.tiers.RUnlock()
+	ss.metered.RLock()
+	for id, m := range ss.metered.tags {
+		m := m
+		update(id, func(s *SourceState) { s.Metered = &m })
+	}
+	ss.metered.RUnlock()
+	ss.tcp.RLock()
+	for id, o := range ss.tcp.val {
+		o := o
+		update(id, func(s *SourceState) { s.TCP = &o })
+	}
+	ss.tcp.RUnlock()
+
+	return State{Sources: acc, Groups: ss.GetGroupsSnapshot()}
+}
+
+// Validate returns an error if `st` cannot be set with SetState.
+func (st State) Validate() error {
+	for id, s := range st.Sources {
+		for k := range s.Labels {
+			if k == "" || strings.Contains(k, "=") {
+				return fmt.Errorf("source store: %s: invalid label key %q", id, k)
+			}
+		}
+		if s.TCP != nil {
+			if err := s.TCP.Validate(); err != nil {
+				return fmt.Errorf("source store: %s: %v", id, err)
+			}
+		}
+	}
+	for _, g := range st.Groups {
+		if g.Name == "" || len(g.Patterns) == 0 {
+			return fmt.Errorf("source store: groups require a name and at least a pattern")
+		}
+		for _, v := range g.Patterns {
+			if _, err := path.Match(v, ""); err != nil {
+				return fmt.Errorf("source store: group %s: invalid pattern %q: %v", g.Name, v, err)
+			}
+		}
+	}
+	return nil
+}
+
+// SetState replaces the configuration of the store with `st`. Nothing
+// is changed if `st` is not valid. The labels and the sources
+// disabled are saved into LabelsFile and DisabledFile, if set.
+func (ss *SourceStore) SetState(st State) error {
+	if err := st.Validate(); err != nil {
+		return err
+	}
+	groups := make([]*core.SourceGroup, 0, len(st.Groups))
+	for _, g := range st.Groups {
+		g := g
+		g.Patterns = append([]string(nil), g.Patterns...)
+		groups = append(groups, &g)
+	}
+
+	labels := make(map[string]SourceLabels)
+	disabled := make(map[string]bool)
+	tiers := make(map[string]Tier)
+	metered := make(map[string]bool)
+	tcp := make(map[string]sockopt.Options)
+	for id, s := range st.Sources {
+		if s.Name != "" || len(s.Labels) > 0 {
+			labels[id] = s.SourceLabels.copy()
+		}
+		if s.Disabled {
+			disabled[id] = true
+		}
+		if s.Tier != nil {
+			tiers[id] = *s.Tier
+		}
+		if s.Metered != nil {
+			metered[id] = *s.Metered
+		}
+		if s.TCP != nil && !s.TCP.IsZero() {
+			tcp[id] = *s.TCP
+		}
+	}
+
+	ss.groups.Lock()
+	ss.groups.val = groups
+	ss.groups.Unlock()
+	ss.tiers.Lock()
+	ss.tiers.val = tiers
+	ss.tiers.Unlock()
+	ss.metered.Lock()
+	ss.metered.tags = metered
+	ss.metered.Unlock()
+	ss.tcp.Lock()
+	ss.tcp.val = tcp
+	ss.tcp.Unlock()
+
+	ss.labels.Lock()
+	old := ss.labels.val
+	ss.labels.val = labels
+	for id := range old {
+		if _, ok := labels[id]; !ok {
+			ss.exportLabels(id, SourceLabels{})
+		}
+	}
+	for id, l := range labels {
+		ss.exportLabels(id, l)
+	}
+	var err error
+	if ss.LabelsFile != "" {
+		err = saveJSON(ss.LabelsFile, labels)
+	}
+	ss.labels.Unlock()
+
+	ss.disabled.Lock()
+	ss.disabled.val = disabled
+	if ss.DisabledFile != "" && err == nil {
+		ids := make([]string, 0, len(disabled))
+		for k := range disabled {
+			ids = append(ids, k)
+		}
+		sort.Strings(ids)
+		err = saveJSON(ss.DisabledFile, ids)
+	}
+	ss.disabled.Unlock()
+
+	ss.invalidate()
+	return err
+}
@@ -0,0 +1,94 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/store"
+)
+
+func TestSetState(t *testing.T) {
+	s := store.New(new(core.Balancer))
+	s.SetTier("en0", store.TierBackup)
+	s.SetMetered("en0", true)
+	if err := s.SetLabels("en1", store.SourceLabels{Name: "fiber", Labels: map[string]string{"isp": "acme"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetDisabled("en2", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutGroup(core.SourceGroup{Name: "wifi", Patterns: []string{"wl*"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	st := s.State()
+	if len(st.Sources) != 3 || len(st.Groups) != 1 {
+		t.Fatalf("Unexpected state: %+v", st)
+	}
+	if v := st.Sources["en0"]; v.Tier == nil || *v.Tier != store.TierBackup || v.Metered == nil || !*v.Metered {
+		t.Fatalf("Unexpected en0 state: %+v", v)
+	}
+	if v := st.Sources["en2"]; !v.Disabled {
+		t.Fatalf("Unexpected en2 state: %+v", v)
+	}
+
+	s1 := store.New(new(core.Balancer))
+	s1.SetTier("en3", store.TierSecondary)
+	if err := s1.SetState(st); err != nil {
+		t.Fatal(err)
+	}
+	if found := s1.State(); !reflect.DeepEqual(found, st) {
+		t.Fatalf("Unexpected state: wanted %+v, found %+v", st, found)
+	}
+	if s1.Labels("en1").Name != "fiber" {
+		t.Fatalf("Labels were not applied")
+	}
+
+	// Invalid states are not applied.
+	invalid := store.State{Groups: []core.SourceGroup{{Name: "empty"}}}
+	if err := s1.SetState(invalid); err == nil {
+		t.Fatalf("The group should not be accepted")
+	}
+	if len(s1.State().Sources) != 3 {
+		t.Fatalf("The state should not be changed")
+	}
+}
+
+func TestSetPolicies(t *testing.T) {
+	s := store.New(new(core.Balancer))
+	if err := s.AppendPolicy(store.NewBlockPolicy("T", "en0")); err != nil {
+		t.Fatal(err)
+	}
+
+	policies := []store.Policy{store.NewBlockPolicy("T", "en1"), store.NewAvoidPolicy("T", "en0", "a.com")}
+	if err := s.SetPolicies(policies); err != nil {
+		t.Fatal(err)
+	}
+	p := s.GetPoliciesSnapshot()
+	if len(p) != 2 || p[0].ID() != "block_en1" {
+		t.Fatalf("Unexpected policies: %+v", p)
+	}
+
+	if err := s.SetPolicies([]store.Policy{store.NewBlockPolicy("T", "en0"), store.NewBlockPolicy("T", "en0")}); err == nil {
+		t.Fatalf("Duplicated policies should not be accepted")
+	}
+	if len(s.GetPoliciesSnapshot()) != 2 {
+		t.Fatalf("The policies should not be changed")
+	}
+}
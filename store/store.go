@@ -26,10 +26,16 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/events"
+	"github.com/booster-proj/booster/process"
+	"github.com/booster-proj/booster/protocol"
+	"github.com/booster-proj/booster/sockopt"
 	"upspin.io/log"
 )
 
@@ -51,31 +57,207 @@ type Policy interface {
 	Accept(id, address string) bool
 }
 
+// A PortPolicy is a Policy that takes into consideration the port of
+// the destination too. When the port is known, AcceptPort is used in
+// place of Accept.
+type PortPolicy interface {
+	Policy
+	AcceptPort(id, host string, port int) bool
+}
+
+// Marker is implemented by the policies that mark the connections
+// with a DSCP value, see DSCPPolicy.
+type Marker interface {
+	Mark(host string, port int) (int, bool)
+}
+
+// FWMarker is implemented by the policies that set the firewall mark
+// of the connections, see FWMarkPolicy.
+type FWMarker interface {
+	FWMark(host string, port int) (uint32, bool)
+}
+
 // A SourceStore is able to keep sources under a set of
 // policies, or rules. When it is asked to store a value,
 // it performs the policy checks on it, and eventually the
 // request is forwarded to the protected store.
 type SourceStore struct {
+	// gen is incremented each time the cached blacklists become
+	// invalid. Keep it first, so that it is 64-bit aligned.
+	gen uint64
+
 	protected Store
 
+	// If Events is not nil, it is used to publish the events
+	// produced by the store, e.g. policy conflicts.
+	Events *events.Bus
+
+	// PreferUnmetered, if true, makes the store use metered sources
+	// only when no unmetered source is available or all of them are
+	// saturated.
+	PreferUnmetered bool
+	// SaturationConns is the number of open connections after which
+	// a source is considered saturated. If 0, sources never are.
+	// Saturated sources make the store spill connections to lower
+	// tiers and, if PreferUnmetered is set, to metered sources.
+	SaturationConns int
+
+	// LabelsFile, if set, is the file where the labels of the
+	// sources are saved. See LoadLabels.
+	LabelsFile string
+	// If LabelsExporter is not nil, it receives the labels of the
+	// sources each time they change.
+	LabelsExporter LabelsExporter
+	// If StatusExporter is not nil, it is notified each time a
+	// source is added or removed.
+	StatusExporter StatusExporter
+	// DisabledFile, if set, is the file where the sources disabled
+	// are saved. See LoadDisabled.
+	DisabledFile string
+	// RecordDecisions, if not 0, is the number of the last sources
+	// selected by Get that are recorded, so that proposed policies
+	// can be evaluated against them. See Simulate.
+	RecordDecisions int
+	// BindHistorySize and BindHistoryMemory are the maximum number
+	// of entries of the bind history, recorded for the sticky
+	// policy, and their maximum estimated size in bytes. When one of
+	// them is reached, the least recently used entries are evicted.
+	// If 0, they are not limited.
+	BindHistorySize   int
+	BindHistoryMemory int64
+	// DomainSets are named sets of domains, e.g. "banking", which
+	// the sticky policy can be scoped to. See ExpandDomainSets.
+	DomainSets map[string][]string
+	// WarmUp is the duration of the warm-up of the sources that come
+	// back after being removed: their share of the new connections
+	// grows gradually from none to the full one during it, so that
+	// marginal links are not flooded as soon as they recover. If 0,
+	// sources are not warmed up.
+	WarmUp time.Duration
+	// FailbackDelay is the stabilization period of the sources that
+	// come back after being removed: the new connections are kept on
+	// the other sources during it, so that a flapping link does not
+	// make them ping-pong. Once it elapsed, if FailbackConns is set,
+	// the sources are held back until less than FailbackConns
+	// connections are open through the other ones. If 0, sources are
+	// used as soon as they come back.
+	FailbackDelay time.Duration
+	FailbackConns int
+	// Standby enables the hot standby mode: only the active source
+	// carries the traffic, while the others stay idle, and the store
+	// switches over to one of them when the active source is removed
+	// or, if Health is set, fails for longer than StandbyWindow. If 0,
+	// DefaultStandbyWindow is used. See ActiveSource.
+	Standby       bool
+	StandbyWindow time.Duration
+	Health        HealthChecker
+	// Resolver, if set, is used to look up the addresses recorded in
+	// the bind history, in place of the package Resolver, e.g. to
+	// cache the lookups.
+	Resolver HostResolver
+	// Scopes are the policy sets and strategies of the listeners,
+	// by name, see WithScope. Set them before using the store.
+	Scopes map[string]*Scope
+
+	// policies are copied on write: the slice stored in val is never
+	// modified, so readers load it without taking any lock, while
+	// the mutex serializes the writers.
 	policies struct {
 		sync.Mutex
-		val []Policy
+		val atomic.Value // []Policy
 	}
-	bindHistory struct {
-		sync.Mutex
-		record bool
-		val    map[string]string
+	// sources serializes Put and Del.
+	sources     sync.Mutex
+	bindHistory bindHistory
+	standby     standby
+	failback    failback
+
+	metered struct {
+		sync.RWMutex
+		tags     map[string]bool
+		detected map[string]bool
+	}
+	tiers struct {
+		sync.RWMutex
+		val map[string]Tier
+	}
+	tcp struct {
+		sync.RWMutex
+		val map[string]sockopt.Options
 	}
+	groups struct {
+		sync.RWMutex
+		val []*core.SourceGroup
+	}
+	labels struct {
+		sync.RWMutex
+		val map[string]SourceLabels
+	}
+	disabled struct {
+		sync.RWMutex
+		val map[string]bool
+	}
+	publicIPs struct {
+		sync.RWMutex
+		val map[string]string
+	}
+
+	blacklists struct {
+		sync.RWMutex
+		val blacklistCache
+	}
+	decisions decisionLog
+	hits      hitCounter
+	warmUp    warmUp
 }
 
 // DummySource is a representation of a source, suitable
 // when other components need information about the sources stored,
 // but should not be able to mess with it's actual content.
 type DummySource struct {
-	ID string `json:"name"`
+	ID          string            `json:"name"`
+	DisplayName string            `json:"display_name,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Addrs       []string          `json:"addresses,omitempty"`
+	DNS         []string          `json:"dns,omitempty"`
+	State       string            `json:"state,omitempty"`
+	Metered     bool              `json:"metered"`
+	Tier        Tier              `json:"tier"`
+	Groups      []string          `json:"groups,omitempty"`
+	TCP         *sockopt.Options  `json:"tcp,omitempty"`
+	// PublicIP is the address the source reaches the Internet
+	// from, if detected.
+	PublicIP string `json:"public_ip,omitempty"`
+
+	// Conns is the number of open connections, Sent and Received
+	// the amount of data transferred through the source.
+	Conns    int   `json:"conns"`
+	Sent     int64 `json:"sent_bytes"`
+	Received int64 `json:"received_bytes"`
 }
 
+// Source states, reported by the snapshots.
+const (
+	// StateActive sources receive connections.
+	StateActive = "active"
+	// StateDisabled sources were disabled with SetDisabled.
+	StateDisabled = "disabled"
+	// StateBlocked sources are refused by a BlockPolicy.
+	StateBlocked = "blocked"
+	// StateDraining sources are blocked, but some of their
+	// connections are still open.
+	StateDraining = "draining"
+	// StateWarmingUp sources came back after a failure and do not
+	// receive their full share of the connections yet.
+	StateWarmingUp = "warming-up"
+	// StateHeldBack sources came back after a failure and do not
+	// receive new connections until the FailbackDelay elapses.
+	StateHeldBack = "held-back"
+	// StateStandby sources are idle, ready to take over the active
+	// one in hot standby mode.
+	StateStandby = "standby"
+)
+
 // New creates a New instance of SourceStore, using interally `store`
 // as the protected storage.
 func New(store Store) *SourceStore {
@@ -90,19 +272,37 @@ func New(store Store) *SourceStore {
 // retriven from the protected storage.
 // If `bindHistory.record == true`, the source identifier returned for this address
 // is saved into `bindHistory.val`.
-func (ss *SourceStore) Get(ctx context.Context, address string, blacklisted ...core.Source) (core.Source, error) {
-	address = TrimPort(address)
+func (ss *SourceStore) Get(ctx context.Context, target string, blacklisted ...core.Source) (core.Source, error) {
+	address := TrimPort(target)
 
 	// Combine blacklist received with the one composed by
 	// the policies.
-	blacklisted = append(blacklisted, ss.MakeBlacklist(address)...)
+	bl, refusing := ss.blacklist(ctx, target)
+	blacklisted = append(blacklisted, bl...)
 	log.Debug.Printf("SourceStore: Blacklist for %s: %v", address, blacklisted)
 
-	src, err := ss.protected.Get(ctx, blacklisted...)
+	// The strategies may depend on the destination.
+	ctx = core.WithTarget(ctx, address)
+	if scope := ss.scope(ctx); scope != nil && scope.Strategy != nil {
+		ctx = core.WithStrategy(ctx, scope.Strategy)
+	}
+
+	// Try with the preferred sources first.
+	var src core.Source
+	var err error
+	if avoid := ss.avoidList(blacklisted); len(avoid) > 0 {
+		src, err = ss.protected.Get(ctx, append(avoid, blacklisted...)...)
+	}
+	if src == nil {
+		src, err = ss.protected.Get(ctx, blacklisted...)
+	}
 	if err != nil {
 		return src, err
 	}
 
+	ss.recordDecision(target, src.ID())
+	ss.recordHits(refusing)
+
 	ctx, cancel := context.WithTimeout(ctx, time.Second)
 	defer cancel()
 	ss.SaveBindHistory(ctx, src.ID(), address)
@@ -110,49 +310,44 @@ func (ss *SourceStore) Get(ctx context.Context, address string, blacklisted ...c
 	return src, nil
 }
 
-// SaveBindHistory saves the association of an address with a source. It
-// performs the operation only if it is required, as this is a time
-// consuming operation (potentially, due to DNS lookup).
-func (ss *SourceStore) SaveBindHistory(ctx context.Context, id, address string) {
-	// Save bind history only if required.
-	ss.bindHistory.Lock()
-	defer ss.bindHistory.Unlock()
-	if !ss.bindHistory.record {
-		return
-	}
+// Blacklist returns the sources that Get refuses to use for the
+// connection to `target` described by `ctx`: the ones refused by the
+// policies, including the process and protocol ones, and the disabled
+// ones.
+func (ss *SourceStore) Blacklist(ctx context.Context, target string) []core.Source {
+	acc, _ := ss.blacklist(ctx, target)
+	return acc
+}
 
-	if ss.bindHistory.val == nil {
-		ss.bindHistory.val = make(map[string]string)
+// blacklist is Blacklist, but it also returns the identifiers of the
+// policies refusing the sources, one for each source refused by a
+// policy.
+func (ss *SourceStore) blacklist(ctx context.Context, target string) ([]core.Source, []string) {
+	if scope := ss.scope(ctx); scope != nil {
+		acc, refusing := ss.scopeBlacklist(scope, target)
+		return append(acc, ss.disabledBlacklist()...), refusing
 	}
+	acc, refusing := ss.makeBlacklist(target)
+	bl, by := ss.processBlacklist(ctx)
+	acc, refusing = append(acc, bl...), append(refusing, by...)
+	bl, by = ss.protocolBlacklist(ctx)
+	acc, refusing = append(acc, bl...), append(refusing, by...)
+	return append(acc, ss.disabledBlacklist()...), refusing
+}
 
-	// Find all addresses associated with `address`. First check if
-	// is is an IP address or an hostname. In the former case
-	// find an hostname pointing to this ip.
-	host := address
-	if ip := net.ParseIP(address); ip != nil {
-		// It is an IP
-		hosts, err := Resolver.LookupAddr(ctx, address)
-		if err != nil {
-			log.Error.Printf("SourceStore: SaveBindHistory error: %v", err)
-			return
+// Candidates returns the sources that Get may return for the
+// connection to `target` described by `ctx`, i.e. the ones that are
+// not in its Blacklist. When some of them are preferred, because of
+// their tier or because they are not metered, only those are
+// returned.
+func (ss *SourceStore) Candidates(ctx context.Context, target string) []core.Source {
+	bl := ss.Blacklist(ctx, target)
+	if avoid := ss.avoidList(bl); len(avoid) > 0 {
+		if acc := ss.available(append(avoid, bl...)); len(acc) > 0 {
+			return acc
 		}
-		if len(hosts) == 0 {
-			log.Error.Printf("SourceStore: SaveBindHistory error: no hosts associated with %s found", address)
-			return
-		}
-		// we just need one host, no matter which one.
-		host = hosts[0]
-	}
-
-	addrs, err := Resolver.LookupHost(ctx, host)
-	if err != nil {
-		log.Error.Printf("SourceStore: SaveBindHistory error: %v", err)
-		return
-	}
-
-	for _, v := range addrs {
-		ss.bindHistory.val[v] = id
 	}
+	return ss.available(bl)
 }
 
 // ShouldAccept takes `id` and `address`, iterates through the list of policies
@@ -160,17 +355,10 @@ func (ss *SourceStore) SaveBindHistory(ctx context.Context, id, address string)
 // offending policy is also returned.
 // Returns true if no policy blocks `id` and `address`.
 func (ss *SourceStore) ShouldAccept(id, address string) (bool, Policy) {
-	ss.policies.Lock()
-	defer ss.policies.Unlock()
-
-	if ss.policies.val == nil {
-		return true, nil
-	}
-
-	// remove port from address if it is present
-	address = TrimPort(address)
-	for _, p := range ss.policies.val {
-		ok := p.Accept(id, address)
+	// The policies are evaluated without holding any lock, as some
+	// of them may take a while, e.g. the WebhookPolicy.
+	for _, p := range ss.loadPolicies() {
+		ok := ss.accept(p, id, address)
 		if !ok {
 			return ok, p
 		}
@@ -179,31 +367,166 @@ func (ss *SourceStore) ShouldAccept(id, address string) (bool, Policy) {
 	return true, nil
 }
 
+// DSCP returns the DSCP value the connections to `address`, in the
+// form host:port, should be marked with, i.e. the one of the first
+// Marker policy that applies to them. Returns false if no policy
+// does.
+func (ss *SourceStore) DSCP(address string) (int, bool) {
+	host, p, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	port, _ := strconv.Atoi(p)
+	for _, v := range ss.loadPolicies() {
+		if m, ok := v.(Marker); ok {
+			if dscp, ok := m.Mark(host, port); ok {
+				return dscp, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// FWMark returns the firewall mark of the connections to `address`, in
+// the form host:port, i.e. the one of the first FWMarker policy that
+// applies to them. Returns false if no policy does.
+func (ss *SourceStore) FWMark(address string) (uint32, bool) {
+	host, p, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	port, _ := strconv.Atoi(p)
+	for _, v := range ss.loadPolicies() {
+		if m, ok := v.(FWMarker); ok {
+			if mark, ok := m.FWMark(host, port); ok {
+				return mark, true
+			}
+		}
+	}
+	return 0, false
+}
+
 // MakeBlacklist computes the list of blacklisted sources for `address`, i.e. the
 // sources that should not be used to perform a request to `address`, because there
 // is one or more policies that do not accept them.
 func (ss *SourceStore) MakeBlacklist(address string) []core.Source {
+	acc, _ := ss.makeBlacklist(address)
+	return acc
+}
+
+// makeBlacklist is MakeBlacklist, but it also returns the identifier
+// of the policy refusing each source.
+func (ss *SourceStore) makeBlacklist(address string) ([]core.Source, []string) {
 	acc := make([]core.Source, 0, ss.Len())
 
 	// return immediately if there is no policy.
-	ss.policies.Lock()
-	l := len(ss.policies.val)
-	ss.policies.Unlock()
-
-	if l == 0 {
-		return acc
+	if len(ss.loadPolicies()) == 0 {
+		return acc, nil
 	}
 
-	address = TrimPort(address)
+	// Collect the sources before evaluating the policies, which
+	// may take a while: the protected storage lock must not be held
+	// in the meanwhile.
+	gen := ss.generation()
+	sources := make([]core.Source, 0, ss.Len())
 	ss.Do(func(src core.Source) {
-		if ok, _ := ss.ShouldAccept(src.ID(), address); !ok {
-			acc = append(acc, src)
-		}
+		sources = append(sources, src)
 	})
 
+	// The decisions of the static policies come from the cache, the
+	// other policies are evaluated every time.
+	policies := ss.loadPolicies()
+	bl := ss.staticBlacklist(gen, address, sources, policies)
+	var refusing []string
+	for _, src := range sources {
+		if id, ok := bl[src.ID()]; ok {
+			acc, refusing = append(acc, src), append(refusing, id)
+			continue
+		}
+		for _, p := range policies {
+			if !static(p) && !ss.accept(p, src.ID(), address) {
+				acc, refusing = append(acc, src), append(refusing, p.ID())
+				break
+			}
+		}
+	}
+
+	return acc, refusing
+}
+
+// ProcessBlacklist computes the list of sources that cannot be used
+// by the process stored in `ctx`, if any, because of a ProcessPolicy.
+func (ss *SourceStore) ProcessBlacklist(ctx context.Context) []core.Source {
+	acc, _ := ss.processBlacklist(ctx)
+	return acc
+}
+
+func (ss *SourceStore) processBlacklist(ctx context.Context) ([]core.Source, []string) {
+	proc, ok := process.FromContext(ctx)
+	if !ok {
+		return nil, nil
+	}
+
+	var policies []*ProcessPolicy
+	for _, v := range ss.loadPolicies() {
+		if p, ok := v.(*ProcessPolicy); ok {
+			policies = append(policies, p)
+		}
+	}
+	if len(policies) == 0 {
+		return nil, nil
+	}
+
+	acc := make([]core.Source, 0, ss.Len())
+	var refusing []string
+	for _, src := range ss.available(nil) {
+		for _, p := range policies {
+			if !p.AcceptProcess(ss.subject(p, src.ID()), proc) {
+				acc, refusing = append(acc, src), append(refusing, p.ID())
+				break
+			}
+		}
+	}
+	return acc, refusing
+}
+
+// ProtocolBlacklist computes the list of sources that cannot be used
+// by the connection of the protocol stored in `ctx`, if any, because
+// of a ProtocolPolicy.
+func (ss *SourceStore) ProtocolBlacklist(ctx context.Context) []core.Source {
+	acc, _ := ss.protocolBlacklist(ctx)
 	return acc
 }
 
+func (ss *SourceStore) protocolBlacklist(ctx context.Context) ([]core.Source, []string) {
+	proto, ok := protocol.FromContext(ctx)
+	if !ok {
+		return nil, nil
+	}
+
+	var policies []*ProtocolPolicy
+	for _, v := range ss.loadPolicies() {
+		if p, ok := v.(*ProtocolPolicy); ok {
+			policies = append(policies, p)
+		}
+	}
+	if len(policies) == 0 {
+		return nil, nil
+	}
+
+	acc := make([]core.Source, 0, ss.Len())
+	var refusing []string
+	for _, src := range ss.available(nil) {
+		for _, p := range policies {
+			if !p.AcceptProtocol(ss.subject(p, src.ID()), proto) {
+				acc, refusing = append(acc, src), append(refusing, p.ID())
+				break
+			}
+		}
+	}
+	return acc, refusing
+}
+
 // Len returns the number of sources available to the store.
 func (ss *SourceStore) Len() int {
 	return ss.protected.Len()
@@ -219,19 +542,30 @@ func (ss *SourceStore) AppendPolicy(p Policy) error {
 	ss.policies.Lock()
 	defer ss.policies.Unlock()
 
-	if ss.policies.val == nil {
-		ss.policies.val = make([]Policy, 0, 1)
-	}
+	policies := ss.loadPolicies()
 
 	// Ensure that this is not a duplicate.
-	for _, v := range ss.policies.val {
+	for _, v := range policies {
 		if v.ID() == p.ID() {
 			return fmt.Errorf("source store: a policy with identifier %v is already present", v.ID())
 		}
 	}
 
-	// Eventually append the new policy.
-	ss.policies.val = append(ss.policies.val, p)
+	// Warn about the policies that do not play well with the new one.
+	for _, v := range FindConflicts(p, policies) {
+		log.Info.Printf("SourceStore: policy %v", v)
+		ss.Events.Publish(events.Event{
+			Topic:   events.TopicPolicyConflict,
+			Message: v.String(),
+			Data:    v,
+		})
+	}
+
+	// Eventually append the new policy, to a copy of the list.
+	acc := make([]Policy, len(policies), len(policies)+1)
+	copy(acc, policies)
+	ss.policies.val.Store(append(acc, p))
+	ss.invalidate()
 	if p.ID() == "stick" {
 		ss.RecordBindHistory()
 	}
@@ -239,31 +573,77 @@ func (ss *SourceStore) AppendPolicy(p Policy) error {
 	return nil
 }
 
+// ValidatePolicies returns an error if `policies` cannot be set with
+// SetPolicies, i.e. if two of them have the same identifier.
+func ValidatePolicies(policies []Policy) error {
+	ids := make(map[string]bool, len(policies))
+	for _, p := range policies {
+		if ids[p.ID()] {
+			return fmt.Errorf("source store: more than one policy with identifier %v", p.ID())
+		}
+		ids[p.ID()] = true
+	}
+	return nil
+}
+
+// SetPolicies replaces the policies stored with `policies`. Nothing is
+// changed if two of them have the same identifier.
+func (ss *SourceStore) SetPolicies(policies []Policy) error {
+	if err := ValidatePolicies(policies); err != nil {
+		return err
+	}
+	ids := make(map[string]bool, len(policies))
+	for _, p := range policies {
+		ids[p.ID()] = true
+	}
+
+	ss.policies.Lock()
+	defer ss.policies.Unlock()
+
+	sticky := false
+	for _, p := range ss.loadPolicies() {
+		sticky = sticky || p.ID() == "stick"
+	}
+	ss.policies.val.Store(append([]Policy{}, policies...))
+	ss.invalidate()
+	switch {
+	case ids["stick"] && !sticky:
+		ss.RecordBindHistory()
+	case !ids["stick"] && sticky:
+		ss.StopRecordingBindHistory()
+	}
+	return nil
+}
+
+// FindConflicts returns the conflicts that `p` would introduce if
+// it was appended to the store's policies.
+func (ss *SourceStore) FindConflicts(p Policy) []Conflict {
+	return FindConflicts(p, ss.loadPolicies())
+}
+
 // DelPolicy removes the policy with identifier `id` from the storage.
 func (ss *SourceStore) DelPolicy(id string) error {
 	ss.policies.Lock()
 	defer ss.policies.Unlock()
 
-	if ss.policies.val == nil {
+	policies := ss.loadPolicies()
+	if len(policies) == 0 {
 		return fmt.Errorf("source store: no policies stored")
 	}
 
 	// Remove the policy from the storage.
-	var j int
-	var found bool
-	for i, v := range ss.policies.val {
-		if v.ID() == id {
-			found = true
-			j = i
-			break
+	acc := make([]Policy, 0, len(policies))
+	for _, v := range policies {
+		if v.ID() != id {
+			acc = append(acc, v)
 		}
 	}
-	if !found {
+	if len(acc) == len(policies) {
 		return fmt.Errorf("source store: no %s policy found", id)
 	}
-	// avoid any possible memory leak in the underlying array.
-	ss.policies.val[j] = nil
-	ss.policies.val = append(ss.policies.val[:j], ss.policies.val[j+1:]...)
+	ss.policies.val.Store(acc)
+	ss.invalidate()
+	ss.resetHits(id)
 	if id == "stick" {
 		ss.StopRecordingBindHistory()
 	}
@@ -271,76 +651,170 @@ func (ss *SourceStore) DelPolicy(id string) error {
 	return nil
 }
 
+// StatusExporter receives the transitions of the sources, up when they
+// are added to the store and down when they are removed.
+type StatusExporter interface {
+	SetSourceUp(id string, up bool)
+}
+
 // Put adds `sources` to the protected storage.
 func (ss *SourceStore) Put(sources ...core.Source) {
-	ss.policies.Lock()
-	defer ss.policies.Unlock()
+	ss.sources.Lock()
+	defer ss.sources.Unlock()
 
+	ss.detectMetered(sources...)
+	ss.startFailback(ss.startWarmUp(sources...)...)
 	ss.protected.Put(sources...)
+	ss.invalidate()
+	for _, v := range sources {
+		if exp := ss.StatusExporter; exp != nil {
+			exp.SetSourceUp(v.ID(), true)
+		}
+		ss.Events.Publish(events.Event{
+			Topic:   events.TopicSourceUp,
+			Message: fmt.Sprintf("source %v is up", v.ID()),
+			Data:    &DummySource{ID: v.ID()},
+		})
+	}
 }
 
 // Del removes `sources` from the protected storage.
 func (ss *SourceStore) Del(sources ...core.Source) {
-	ss.policies.Lock()
-	defer ss.policies.Unlock()
+	ss.sources.Lock()
+	defer ss.sources.Unlock()
 
 	ss.protected.Del(sources...)
+	ss.forgetMetered(sources...)
+	ss.markFailed(sources...)
+	ss.forgetFailback(sources...)
+	ss.invalidate()
+	for _, v := range sources {
+		if exp := ss.StatusExporter; exp != nil {
+			exp.SetSourceUp(v.ID(), false)
+		}
+		ss.Events.Publish(events.Event{
+			Topic:   events.TopicSourceDown,
+			Message: fmt.Sprintf("source %v is down", v.ID()),
+			Data:    &DummySource{ID: v.ID()},
+		})
+	}
 }
 
 // GetPoliciesSnapshot returns a copy of the current policies
 // active in the store.
 func (ss *SourceStore) GetPoliciesSnapshot() []Policy {
-	ss.policies.Lock()
-	defer ss.policies.Unlock()
-
-	acc := make([]Policy, len(ss.policies.val))
-	copy(acc, ss.policies.val)
+	policies := ss.loadPolicies()
+	acc := make([]Policy, len(policies))
+	copy(acc, policies)
 	return acc
 }
 
-// GetSourcesSnapshot returns nothing more then a copy of the
-// list of sources that the storage is holding.
+// loadPolicies returns the current policies. The slice returned is
+// shared and must not be modified.
+func (ss *SourceStore) loadPolicies() []Policy {
+	policies, _ := ss.policies.val.Load().([]Policy)
+	return policies
+}
+
+// GetSourcesSnapshot returns a description of each source that the
+// storage is holding: its configuration, state and usage.
 func (ss *SourceStore) GetSourcesSnapshot() []*DummySource {
 	acc := make([]*DummySource, 0, ss.protected.Len())
 
+	// Inspect the sources without holding the protected storage
+	// lock.
+	sources := make([]core.Source, 0, ss.protected.Len())
 	ss.protected.Do(func(src core.Source) {
-		acc = append(acc, &DummySource{
-			ID: src.ID(),
-		})
+		sources = append(sources, src)
 	})
+	for _, src := range sources {
+		v := &DummySource{ID: src.ID()}
+		if l, ok := src.(interface{ Len() int }); ok {
+			v.Conns = l.Len()
+		}
+		if t, ok := src.(interface{ Traffic() (int64, int64) }); ok {
+			v.Sent, v.Received = t.Traffic()
+		}
+		if a, ok := src.(interface{ Addrs() []string }); ok {
+			v.Addrs = a.Addrs()
+		}
+		if d, ok := src.(interface{ DNSServers() []string }); ok {
+			v.DNS = d.DNSServers()
+		}
+		v.Metered = ss.IsMetered(v.ID)
+		v.Tier = ss.SourceTier(v.ID)
+		v.Groups = ss.GroupsOf(v.ID)
+		if o, ok := ss.TCPOptions(v.ID); ok {
+			v.TCP = &o
+		}
+		l := ss.Labels(v.ID)
+		v.DisplayName, v.Labels = l.Name, l.Labels
+		v.PublicIP, _ = ss.PublicIP(v.ID)
+		v.State = ss.state(v.ID, v.Conns)
+		acc = append(acc, v)
+	}
 
 	return acc
 }
 
-// RecordBindHistory makes the store keep track of which source is
-// assigned to which address.
-func (ss *SourceStore) RecordBindHistory() {
-	ss.bindHistory.Lock()
-	defer ss.bindHistory.Unlock()
-
-	ss.bindHistory.val = make(map[string]string)
-	ss.bindHistory.record = true
+// state returns the state of source `id`, which has `conns` open
+// connections.
+func (ss *SourceStore) state(id string, conns int) string {
+	if ss.IsDisabled(id) {
+		return StateDisabled
+	}
+	for _, p := range ss.loadPolicies() {
+		if _, ok := p.(*BlockPolicy); ok && !ss.accept(p, id, "") {
+			if conns > 0 {
+				return StateDraining
+			}
+			return StateBlocked
+		}
+	}
+	if active, ok := ss.ActiveSource(); ok && active != id {
+		return StateStandby
+	}
+	if ss.HeldBack(id) {
+		return StateHeldBack
+	}
+	if ss.WarmUpShare(id) < 1 {
+		return StateWarmingUp
+	}
+	return StateActive
 }
 
-// StopRecordingBindHistory makes the store stop tracking which source is
-// assigned to which address. The old history, if any, is discarded.
-func (ss *SourceStore) StopRecordingBindHistory() {
-	ss.bindHistory.Lock()
-	defer ss.bindHistory.Unlock()
-
-	ss.bindHistory.val = nil
-	ss.bindHistory.record = false
+// Sticky reports whether the connections to `target` are bound to the
+// source that receives the first of them, i.e. if a StickyPolicy
+// applies to them.
+func (ss *SourceStore) Sticky(target string) bool {
+	p := ss.stickyPolicy()
+	if p == nil {
+		return false
+	}
+	host := TrimPort(target)
+	return net.ParseIP(host) != nil || p.Covers(host)
 }
 
-// QueryBindHistory queries the bindHistory for address.
-func (ss *SourceStore) QueryBindHistory(address string) (src string, ok bool) {
-	ss.bindHistory.Lock()
-	defer ss.bindHistory.Unlock()
-
-	if ss.bindHistory.val == nil {
-		return
+// stickyPolicy returns the sticky policy stored, if any.
+func (ss *SourceStore) stickyPolicy() *StickyPolicy {
+	for _, p := range ss.loadPolicies() {
+		if v, ok := p.(*StickyPolicy); ok {
+			return v
+		}
 	}
+	return nil
+}
 
-	src, ok = ss.bindHistory.val[address]
-	return
+// ExpandDomainSets returns the domains contained in the DomainSets
+// named `names`.
+func (ss *SourceStore) ExpandDomainSets(names ...string) ([]string, error) {
+	var acc []string
+	for _, v := range names {
+		domains, ok := ss.DomainSets[v]
+		if !ok {
+			return nil, fmt.Errorf("source store: no %s domain set found", v)
+		}
+		acc = append(acc, domains...)
+	}
+	return acc, nil
 }
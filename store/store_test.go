@@ -19,7 +19,9 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/booster-proj/booster/core"
 	"github.com/booster-proj/booster/store"
@@ -64,6 +66,134 @@ func TestSaveBindHistory(t *testing.T) {
 	}
 }
 
+func TestBindHistory_lru(t *testing.T) {
+	store.Resolver = resolver{}
+	s := store.New(&storage{})
+	s.BindHistorySize = 2
+	s.RecordBindHistory()
+
+	s.SaveBindHistory(context.TODO(), "s0", "a.com")
+	s.SaveBindHistory(context.TODO(), "s1", "b.com")
+	// a.com becomes the most recently used.
+	s.QueryBindHistory("a.com")
+	s.SaveBindHistory(context.TODO(), "s0", "a.com")
+	s.SaveBindHistory(context.TODO(), "s0", "c.com")
+
+	if _, ok := s.QueryBindHistory("b.com"); ok {
+		t.Fatalf("b.com should have been evicted")
+	}
+	stats := s.BindHistoryStats()
+	if stats.Entries != 2 || stats.Evictions != 1 || stats.Sources["s0"] != 2 {
+		t.Fatalf("Unexpected stats: %+v", stats)
+	}
+	if stats.Hits != 1 || stats.Misses != 3 || stats.HitRate != 0.25 {
+		t.Fatalf("Unexpected hit rate: %+v", stats)
+	}
+
+	// The memory limit evicts the entries as well.
+	s.BindHistoryMemory = stats.Bytes - 1
+	s.SaveBindHistory(context.TODO(), "s1", "d.com")
+	if stats := s.BindHistoryStats(); stats.Entries != 1 || stats.Bytes > s.BindHistoryMemory {
+		t.Fatalf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestPinBinding(t *testing.T) {
+	store.Resolver = resolver{addrs: []string{"10.0.0.1", "10.0.0.2"}}
+	s := store.New(&storage{data: []core.Source{&mock{id: "s0"}, &mock{id: "s1"}}})
+	s.RecordBindHistory()
+	s.SaveBindHistory(context.TODO(), "s1", "10.0.0.3")
+
+	if _, err := s.PinBinding(context.TODO(), "push.apple.com", "s2"); err != store.ErrUnknownSource {
+		t.Fatalf("Unexpected error pinning an unknown source: %v", err)
+	}
+	b, err := s.PinBinding(context.TODO(), "Push.apple.com:443", "s0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Address != "push.apple.com" || len(b.Addresses) != 2 {
+		t.Fatalf("Unexpected binding: %+v", b)
+	}
+	for _, v := range []string{"push.apple.com", "PUSH.Apple.com.", "10.0.0.1", "10.0.0.2"} {
+		if id, ok := s.QueryBindHistory(v); !ok || id != "s0" {
+			t.Fatalf("%s: unexpected binding: %v, %v", v, id, ok)
+		}
+	}
+	// The pins are not overwritten by the bindings recorded, and
+	// they are kept when the recording stops.
+	s.SaveBindHistory(context.TODO(), "s1", "10.0.0.1")
+	s.StopRecordingBindHistory()
+	if id, _ := s.QueryBindHistory("10.0.0.1"); id != "s0" {
+		t.Fatalf("Unexpected binding: %v", id)
+	}
+	if l := s.Bindings(); len(l) != 1 || !l[0].Pinned {
+		t.Fatalf("Unexpected bindings: %+v", l)
+	}
+
+	if err := s.DelBinding("push.apple.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.QueryBindHistory("10.0.0.1"); ok {
+		t.Fatalf("The pinned addresses should have been removed")
+	}
+	if err := s.DelBinding("push.apple.com"); err == nil {
+		t.Fatalf("Removed a missing binding")
+	}
+}
+
+// slowResolver blocks its lookups until release is closed.
+type slowResolver struct {
+	resolver
+	started chan struct{}
+	release chan struct{}
+}
+
+func (r slowResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	close(r.started)
+	<-r.release
+	return r.resolver.LookupHost(ctx, host)
+}
+
+func TestSaveBindHistory_slow(t *testing.T) {
+	r := slowResolver{
+		resolver: resolver{host: "some.host"},
+		started:  make(chan struct{}),
+		release:  make(chan struct{}),
+	}
+	store.Resolver = r
+
+	s := store.New(&storage{})
+	s.RecordBindHistory()
+
+	done := make(chan struct{})
+	go func() {
+		s.SaveBindHistory(context.TODO(), "s0", "some.host")
+		close(done)
+	}()
+	<-r.started
+
+	// The lookup in progress must not block the readers.
+	c := make(chan bool)
+	go func() {
+		_, ok := s.QueryBindHistory("some.host")
+		c <- ok
+	}()
+	select {
+	case ok := <-c:
+		if ok {
+			t.Fatalf("Bind history contains some.host before the lookup completed")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("QueryBindHistory blocked behind SaveBindHistory")
+	}
+
+	close(r.release)
+	<-done
+	if id, ok := s.QueryBindHistory("some.host"); !ok || id != "s0" {
+		t.Fatalf("Unexpected bind history for some.host: %s, %v", id, ok)
+	}
+}
+
 func TestGet(t *testing.T) {
 	s0 := &mock{id: "s0"}
 	s1 := &mock{id: "s1"}
@@ -314,6 +444,98 @@ func TestGetPoliciesSnapshot(t *testing.T) {
 	}
 }
 
+type usedMock struct {
+	mock
+	conns          int
+	sent, received int64
+}
+
+func (s *usedMock) Len() int                { return s.conns }
+func (s *usedMock) Traffic() (int64, int64) { return s.sent, s.received }
+func (s *usedMock) Addrs() []string         { return []string{"10.0.0.2/24"} }
+
+func TestGetSourcesSnapshot(t *testing.T) {
+	s0 := &usedMock{mock: mock{id: "s0"}, sent: 10, received: 20}
+	s1 := &usedMock{mock: mock{id: "s1"}, conns: 2}
+	s2 := &usedMock{mock: mock{id: "s2"}}
+	s := store.New(&storage{data: []core.Source{s0, s1, s2}})
+	s.AppendPolicy(store.NewBlockPolicy("test", "s1"))
+	s.AppendPolicy(store.NewBlockPolicy("test", "s2"))
+
+	states := map[string]string{
+		"s0": store.StateActive,
+		"s1": store.StateDraining,
+		"s2": store.StateBlocked,
+	}
+	snapshot := s.GetSourcesSnapshot()
+	if len(snapshot) != 3 {
+		t.Fatalf("Unexpected snapshot length: %d", len(snapshot))
+	}
+	for _, v := range snapshot {
+		if v.State != states[v.ID] {
+			t.Fatalf("Unexpected state of %v: wanted %v, found %v", v.ID, states[v.ID], v.State)
+		}
+		if len(v.Addrs) != 1 {
+			t.Fatalf("Unexpected addresses of %v: %v", v.ID, v.Addrs)
+		}
+	}
+	if v := snapshot[0]; v.Sent != 10 || v.Received != 20 {
+		t.Fatalf("Unexpected traffic of %v: %d, %d", v.ID, v.Sent, v.Received)
+	}
+	if v := snapshot[1]; v.Conns != 2 {
+		t.Fatalf("Unexpected conns of %v: %d", v.ID, v.Conns)
+	}
+}
+
+func TestShouldAccept_writes(t *testing.T) {
+	s := store.New(&storage{})
+	started, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	s.AppendPolicy(&store.GenPolicy{
+		Name: "slow",
+		AcceptFunc: func(id, address string) bool {
+			once.Do(func() { close(started) })
+			<-release
+			return true
+		},
+	})
+
+	done := make(chan bool)
+	go func() {
+		ok, _ := s.ShouldAccept("s0", "host")
+		done <- ok
+	}()
+	<-started
+
+	// Writers must not wait for the policies being evaluated.
+	c := make(chan struct{})
+	go func() {
+		s.AppendPolicy(&store.GenPolicy{
+			Name: "block",
+			AcceptFunc: func(id, address string) bool {
+				return false
+			},
+		})
+		s.Put(&mock{id: "s1"})
+		s.Del(&mock{id: "s1"})
+		close(c)
+	}()
+	select {
+	case <-c:
+	case <-time.After(time.Second):
+		t.Fatalf("Store writes blocked behind ShouldAccept")
+	}
+
+	// The evaluation in progress is not affected by the new policy.
+	close(release)
+	if ok := <-done; !ok {
+		t.Fatalf("ShouldAccept used a policy added after the evaluation started")
+	}
+	if ok, p := s.ShouldAccept("s0", "host"); ok || p.ID() != "block" {
+		t.Fatalf("Unexpected ShouldAccept result: %v, %v", ok, p)
+	}
+}
+
 type mock struct {
 	id     string
 	active bool
@@ -341,6 +563,8 @@ func (s *mock) String() string {
 type storage struct {
 	index int // tells which source should be returned
 	data  []core.Source
+	// afterDo, if not nil, is called once after the next Do.
+	afterDo func()
 }
 
 func (s *storage) Put(ss ...core.Source) {
@@ -374,6 +598,10 @@ func (s *storage) Do(f func(core.Source)) {
 	for _, v := range s.data {
 		f(v)
 	}
+	if hook := s.afterDo; hook != nil {
+		s.afterDo = nil
+		hook()
+	}
 }
 
 func (s *storage) Get(ctx context.Context, blacklisted ...core.Source) (core.Source, error) {
@@ -0,0 +1,61 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"github.com/booster-proj/booster/sockopt"
+)
+
+// SetTCPOptions tunes the sockets of the connections dialed through
+// source, or group, `id`. Zero options restore the system defaults.
+func (ss *SourceStore) SetTCPOptions(id string, o sockopt.Options) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	ss.tcp.Lock()
+	defer ss.tcp.Unlock()
+
+	if o.IsZero() {
+		delete(ss.tcp.val, id)
+		return nil
+	}
+	if ss.tcp.val == nil {
+		ss.tcp.val = make(map[string]sockopt.Options)
+	}
+	ss.tcp.val[id] = o
+	return nil
+}
+
+// TCPOptions returns the socket options of source `id`. If no options
+// were set on the source, the ones of the first group it belongs to,
+// if any, are used.
+func (ss *SourceStore) TCPOptions(id string) (sockopt.Options, bool) {
+	groups := ss.GroupsOf(id)
+
+	ss.tcp.RLock()
+	defer ss.tcp.RUnlock()
+
+	if o, ok := ss.tcp.val[id]; ok {
+		return o, true
+	}
+	for _, v := range groups {
+		if o, ok := ss.tcp.val[v]; ok {
+			return o, true
+		}
+	}
+	return sockopt.Options{}, false
+}
@@ -0,0 +1,55 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/sockopt"
+	"github.com/booster-proj/booster/store"
+)
+
+func TestTCPOptions(t *testing.T) {
+	s := store.New(&storage{data: []core.Source{&mock{id: "en0"}, &mock{id: "wwan0"}}})
+	s.PutGroup(core.SourceGroup{Name: "cellular", Patterns: []string{"wwan*"}})
+
+	if _, ok := s.TCPOptions("en0"); ok {
+		t.Fatalf("en0 should keep the system defaults")
+	}
+	if err := s.SetTCPOptions("cellular", sockopt.Options{Congestion: "cubic", KeepAlive: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	if o, ok := s.TCPOptions("wwan0"); !ok || o.KeepAlive != time.Minute {
+		t.Fatalf("wwan0 should inherit the options of its group: %+v", o)
+	}
+	if err := s.SetTCPOptions("wwan0", sockopt.Options{SendBuffer: 1 << 20}); err != nil {
+		t.Fatal(err)
+	}
+	if o, _ := s.TCPOptions("wwan0"); o.SendBuffer != 1<<20 || o.KeepAlive != 0 {
+		t.Fatalf("The options of the source should take precedence: %+v", o)
+	}
+	if err := s.SetTCPOptions("en0", sockopt.Options{SendBuffer: -1}); err == nil {
+		t.Fatalf("Invalid options were accepted")
+	}
+
+	// Zero options restore the defaults.
+	s.SetTCPOptions("wwan0", sockopt.Options{})
+	if o, _ := s.TCPOptions("wwan0"); o.Congestion != "cubic" {
+		t.Fatalf("Unexpected options: %+v", o)
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"fmt"
+
+	"github.com/booster-proj/booster/core"
+)
+
+// Tier is the priority level of a source. Connections are assigned
+// to lower tiers only when the higher ones are unavailable or
+// saturated.
+type Tier int
+
+// Tiers available, from the highest to the lowest priority. Sources
+// are primary unless told otherwise.
+const (
+	TierPrimary Tier = iota
+	TierSecondary
+	TierBackup
+)
+
+var tierNames = []string{"primary", "secondary", "backup"}
+
+func (t Tier) String() string {
+	if t < 0 || int(t) >= len(tierNames) {
+		return fmt.Sprintf("tier(%d)", int(t))
+	}
+	return tierNames[t]
+}
+
+// ParseTier returns the tier named `s`.
+func ParseTier(s string) (Tier, error) {
+	for i, v := range tierNames {
+		if v == s {
+			return Tier(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown tier %q, expected one of %v", s, tierNames)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (t Tier) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (t *Tier) UnmarshalText(b []byte) error {
+	v, err := ParseTier(string(b))
+	if err != nil {
+		return err
+	}
+	*t = v
+	return nil
+}
+
+// SetTier assigns source, or group, `id` to tier `t`.
+func (ss *SourceStore) SetTier(id string, t Tier) {
+	ss.tiers.Lock()
+	defer ss.tiers.Unlock()
+
+	if ss.tiers.val == nil {
+		ss.tiers.val = make(map[string]Tier)
+	}
+	ss.tiers.val[id] = t
+}
+
+// SourceTier returns the tier of source `id`. If no tier was
+// assigned to the source, the tier of the first group it belongs
+// to, if any, is used.
+func (ss *SourceStore) SourceTier(id string) Tier {
+	groups := ss.GroupsOf(id)
+
+	ss.tiers.RLock()
+	defer ss.tiers.RUnlock()
+
+	if t, ok := ss.tiers.val[id]; ok {
+		return t
+	}
+	for _, v := range groups {
+		if t, ok := ss.tiers.val[v]; ok {
+			return t
+		}
+	}
+	return TierPrimary
+}
+
+// tierBlacklist returns the sources that do not belong to the highest
+// tier containing at least one source that is neither `blacklisted`
+// nor saturated. The higher tiers are excluded as well, as all their
+// sources are saturated.
+func (ss *SourceStore) tierBlacklist(blacklisted []core.Source) []core.Source {
+	sources := ss.available(blacklisted)
+	best := Tier(-1)
+	for _, src := range sources {
+		if ss.saturated(src) {
+			continue
+		}
+		if t := ss.SourceTier(src.ID()); best < 0 || t < best {
+			best = t
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+
+	acc := make([]core.Source, 0, len(sources))
+	for _, src := range sources {
+		if ss.SourceTier(src.ID()) != best {
+			acc = append(acc, src)
+		}
+	}
+	return acc
+}
+
+// avoidList returns the sources that should not be used, if possible,
+// besides `blacklisted`: the ones held back after a failure, the ones
+// warming up that should not receive the next connection, the ones of
+// the lower tiers and, if PreferUnmetered is set, the metered ones. In
+// hot standby mode, they are every source but the active one.
+func (ss *SourceStore) avoidList(blacklisted []core.Source) []core.Source {
+	if ss.Standby {
+		if acc, ok := ss.standbyBlacklist(blacklisted); ok {
+			return acc
+		}
+	}
+	acc := ss.failbackBlacklist(blacklisted)
+	bl := make([]core.Source, 0, len(blacklisted)+len(acc))
+	bl = append(append(bl, blacklisted...), acc...)
+	acc = append(acc, ss.warmUpBlacklist(bl)...)
+	bl = make([]core.Source, 0, len(blacklisted)+len(acc))
+	bl = append(append(bl, blacklisted...), acc...)
+	acc = append(acc, ss.tierBlacklist(bl)...)
+	if ss.PreferUnmetered {
+		bl := make([]core.Source, 0, len(blacklisted)+len(acc))
+		bl = append(append(bl, blacklisted...), acc...)
+		acc = append(acc, ss.meteredBlacklist(bl)...)
+	}
+	return acc
+}
+
+// available returns the stored sources that are not `blacklisted`.
+func (ss *SourceStore) available(blacklisted []core.Source) []core.Source {
+	bl := make(map[string]bool, len(blacklisted))
+	for _, v := range blacklisted {
+		bl[v.ID()] = true
+	}
+
+	acc := make([]core.Source, 0, ss.Len())
+	ss.Do(func(src core.Source) {
+		if !bl[src.ID()] {
+			acc = append(acc, src)
+		}
+	})
+	return acc
+}
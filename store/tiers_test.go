@@ -0,0 +1,92 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/store"
+)
+
+func TestParseTier(t *testing.T) {
+	for _, v := range []store.Tier{store.TierPrimary, store.TierSecondary, store.TierBackup} {
+		tier, err := store.ParseTier(v.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tier != v {
+			t.Fatalf("Unexpected tier: wanted %v, found %v", v, tier)
+		}
+	}
+	if _, err := store.ParseTier("foo"); err == nil {
+		t.Fatal("Expected an error with unknown tier")
+	}
+
+	b, _ := json.Marshal(&store.DummySource{ID: "s0", Tier: store.TierBackup})
+	if string(b) != `{"name":"s0","metered":false,"tier":"backup","conns":0,"sent_bytes":0,"received_bytes":0}` {
+		t.Fatalf("Unexpected json: %s", b)
+	}
+}
+
+func TestGet_tiers(t *testing.T) {
+	s0 := &meteredMock{mock: mock{id: "s0"}}
+	s1 := &meteredMock{mock: mock{id: "s1"}}
+	s2 := &meteredMock{mock: mock{id: "s2"}}
+	s := store.New(new(core.Balancer))
+	s.SaturationConns = 1
+	s.SetTier(s1.ID(), store.TierSecondary)
+	s.SetTier(s2.ID(), store.TierBackup)
+	s.Put(s0, s1, s2)
+
+	ctx := context.Background()
+	get := func(want core.Source, blacklisted ...core.Source) {
+		for i := 0; i < 3; i++ {
+			src, err := s.Get(ctx, "host:443", blacklisted...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if src.ID() != want.ID() {
+				t.Fatalf("Unexpected source: wanted %v, found %v", want, src)
+			}
+		}
+	}
+
+	get(s0)
+	// Spill to the secondary tier when the primary is unavailable...
+	get(s1, s0)
+	// ...or saturated.
+	s0.conns = 1
+	get(s1)
+	s1.conns = 1
+	get(s2)
+
+	// When every source is saturated, the tiers are ignored.
+	s2.conns = 1
+	seen := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		src, err := s.Get(ctx, "host:443")
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[src.ID()] = true
+	}
+	if len(seen) != 3 {
+		t.Fatalf("Expected all sources to be used, found %v", seen)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+)
+
+// DefaultWarmUp is the default duration of the warm-up of the sources
+// that come back after a failure.
+const DefaultWarmUp = 30 * time.Second
+
+// warmUp keeps track of the sources that failed, i.e. were removed,
+// and of the ones warming up after coming back.
+type warmUp struct {
+	sync.Mutex
+	failed map[string]bool
+	since  map[string]time.Time
+}
+
+// markFailed records that `sources` were removed.
+func (ss *SourceStore) markFailed(sources ...core.Source) {
+	ss.warmUp.Lock()
+	defer ss.warmUp.Unlock()
+
+	if ss.warmUp.failed == nil {
+		ss.warmUp.failed = make(map[string]bool)
+	}
+	for _, v := range sources {
+		ss.warmUp.failed[v.ID()] = true
+		delete(ss.warmUp.since, v.ID())
+	}
+}
+
+// startWarmUp starts the warm-up of the sources in `sources` that
+// failed before, returning them. The ones added for the first time are
+// not warmed up. The warm-up starts after the FailbackDelay.
+func (ss *SourceStore) startWarmUp(sources ...core.Source) []core.Source {
+	ss.warmUp.Lock()
+	defer ss.warmUp.Unlock()
+
+	if ss.warmUp.since == nil {
+		ss.warmUp.since = make(map[string]time.Time)
+	}
+	start := time.Now().Add(ss.FailbackDelay)
+	var acc []core.Source
+	for _, v := range sources {
+		if !ss.warmUp.failed[v.ID()] {
+			continue
+		}
+		delete(ss.warmUp.failed, v.ID())
+		acc = append(acc, v)
+		if ss.WarmUp > 0 {
+			ss.warmUp.since[v.ID()] = start
+		}
+	}
+	return acc
+}
+
+// WarmUpShare returns the share of the new connections that source `id`
+// may receive, between 0 and 1. It grows linearly from 0 to 1 during
+// the WarmUp after the source comes back from a failure, and is 1
+// otherwise.
+func (ss *SourceStore) WarmUpShare(id string) float64 {
+	ss.warmUp.Lock()
+	defer ss.warmUp.Unlock()
+
+	return ss.warmUpShare(id, time.Now())
+}
+
+// warmUpShare is WarmUpShare, called with the warmUp lock held. The
+// sources that completed their warm-up are forgotten.
+func (ss *SourceStore) warmUpShare(id string, now time.Time) float64 {
+	since, ok := ss.warmUp.since[id]
+	if !ok {
+		return 1
+	}
+	elapsed := now.Sub(since)
+	if ss.WarmUp <= 0 || elapsed >= ss.WarmUp {
+		delete(ss.warmUp.since, id)
+		return 1
+	}
+	if elapsed < 0 {
+		return 0
+	}
+	return float64(elapsed) / float64(ss.WarmUp)
+}
+
+// warmUpBlacklist returns the sources, excluding `blacklisted`, that are
+// warming up and should not receive the next connection: each is
+// included with a probability equal to the share of the connections
+// it should not receive yet.
+func (ss *SourceStore) warmUpBlacklist(blacklisted []core.Source) []core.Source {
+	sources := ss.available(blacklisted)
+
+	ss.warmUp.Lock()
+	defer ss.warmUp.Unlock()
+
+	if len(ss.warmUp.since) == 0 {
+		return nil
+	}
+	now := time.Now()
+	var acc []core.Source
+	for _, src := range sources {
+		if share := ss.warmUpShare(src.ID(), now); share < 1 && rand.Float64() >= share {
+			acc = append(acc, src)
+		}
+	}
+	return acc
+}
@@ -0,0 +1,80 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/store"
+)
+
+func TestWarmUp(t *testing.T) {
+	s0 := &mock{id: "s0"}
+	s1 := &mock{id: "s1"}
+	s := store.New(new(core.Balancer))
+	s.WarmUp = time.Hour
+	s.Put(s0, s1)
+
+	count := func() int {
+		var n int
+		for i := 0; i < 100; i++ {
+			src, err := s.Get(context.Background(), "host:443")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if src.ID() == s1.ID() {
+				n++
+			}
+		}
+		return n
+	}
+
+	// Sources added for the first time receive their full share.
+	if n := count(); n != 50 {
+		t.Fatalf("Unexpected connections to s1: %d", n)
+	}
+	if share := s.WarmUpShare(s1.ID()); share != 1 {
+		t.Fatalf("Unexpected share: %v", share)
+	}
+
+	// The ones coming back after a failure are warmed up.
+	s.Del(s1)
+	s.Put(s1)
+	if n := count(); n > 5 {
+		t.Fatalf("Unexpected connections to s1 while warming up: %d", n)
+	}
+	if share := s.WarmUpShare(s1.ID()); share >= 0.01 {
+		t.Fatalf("Unexpected share: %v", share)
+	}
+	for _, v := range s.GetSourcesSnapshot() {
+		if v.ID == s1.ID() && v.State != store.StateWarmingUp {
+			t.Fatalf("Unexpected state: %v", v.State)
+		}
+	}
+
+	// Unless they are the only source available.
+	if src, err := s.Get(context.Background(), "host:443", s0); err != nil || src.ID() != s1.ID() {
+		t.Fatalf("Unexpected source: %v, %v", src, err)
+	}
+
+	s.WarmUp = 0
+	if n := count(); n != 50 {
+		t.Fatalf("Unexpected connections to s1 after the warm-up: %d", n)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"upspin.io/log"
+)
+
+// DefaultWebhookTimeout is the maximum amount of time the WebhookPolicy
+// waits for the endpoint to answer, when no Client is provided.
+const DefaultWebhookTimeout = time.Second
+
+// DefaultWebhookTTL is the suggested duration of the WebhookPolicy
+// decisions cache.
+const DefaultWebhookTTL = time.Minute
+
+// maxWebhookCache is the number of decisions after which the expired
+// ones are removed from the cache of a WebhookPolicy.
+const maxWebhookCache = 4096
+
+// WebhookPolicy is a Policy implementation that delegates the decision
+// to an external HTTP endpoint, e.g. an existing ACL system. For each
+// source and address, `URL` receives a POST request with body
+// `{"id": "<source>", "address": "<address>"}`, and it is expected to
+// respond with `{"allow": true|false}`.
+// The decisions are cached for `CacheTTL`. When the endpoint cannot be
+// reached, or its response is not valid, the connection is accepted
+// only if `FailOpen` is true.
+type WebhookPolicy struct {
+	basePolicy
+	URL      string        `json:"url"`
+	FailOpen bool          `json:"fail_open"`
+	CacheTTL time.Duration `json:"-"`
+
+	// Client is used to perform the requests. If nil, a client
+	// with DefaultWebhookTimeout is used.
+	Client *http.Client `json:"-"`
+
+	cache struct {
+		sync.Mutex
+		val map[string]webhookDecision
+	}
+}
+
+type webhookDecision struct {
+	allow   bool
+	expires time.Time
+}
+
+func NewWebhookPolicy(issuer, name, url string, failOpen bool, ttl time.Duration) *WebhookPolicy {
+	fail := "denied"
+	if failOpen {
+		fail = "accepted"
+	}
+	return &WebhookPolicy{
+		basePolicy: basePolicy{
+			Name:   fmt.Sprintf("webhook_%s", name),
+			Issuer: issuer,
+			Code:   PolicyCodeWebhook,
+			Desc:   fmt.Sprintf("sources will be used only if %s allows them (cached for %v), connections are %s when it is unavailable", url, ttl, fail),
+		},
+		URL:      url,
+		FailOpen: failOpen,
+		CacheTTL: ttl,
+	}
+}
+
+// Accept implements Policy.
+func (p *WebhookPolicy) Accept(id, address string) bool {
+	key := id + " " + address
+	now := time.Now()
+
+	p.cache.Lock()
+	d, ok := p.cache.val[key]
+	p.cache.Unlock()
+	if ok && now.Before(d.expires) {
+		return d.allow
+	}
+
+	allow, err := p.query(id, address)
+	if err != nil {
+		log.Error.Printf("WebhookPolicy %s: %v", p.ID(), err)
+		allow = p.FailOpen
+	}
+
+	// Failures are cached too, so that an unavailable endpoint
+	// does not slow down every connection.
+	if p.CacheTTL > 0 {
+		p.cache.Lock()
+		if p.cache.val == nil {
+			p.cache.val = make(map[string]webhookDecision)
+		}
+		if len(p.cache.val) >= maxWebhookCache {
+			for k, v := range p.cache.val {
+				if !now.Before(v.expires) {
+					delete(p.cache.val, k)
+				}
+			}
+		}
+		p.cache.val[key] = webhookDecision{allow: allow, expires: now.Add(p.CacheTTL)}
+		p.cache.Unlock()
+	}
+	return allow
+}
+
+func (p *WebhookPolicy) query(id, address string) (bool, error) {
+	body, err := json.Marshal(struct {
+		ID      string `json:"id"`
+		Address string `json:"address"`
+	}{
+		ID:      id,
+		Address: address,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: DefaultWebhookTimeout}
+	}
+	resp, err := client.Post(p.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status: %v", resp.Status)
+	}
+
+	var payload struct {
+		Allow *bool `json:"allow"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return false, fmt.Errorf("unable to decode response: %v", err)
+	}
+	if payload.Allow == nil {
+		return false, fmt.Errorf("response does not contain the allow field")
+	}
+	return *payload.Allow, nil
+}
@@ -0,0 +1,74 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/store"
+)
+
+func TestWebhookPolicy(t *testing.T) {
+	var n int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&n, 1)
+		var payload struct {
+			ID      string `json:"id"`
+			Address string `json:"address"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]bool{
+			"allow": !(payload.ID == "wwan0" && payload.Address == "video.com"),
+		})
+	}))
+	defer srv.Close()
+
+	p := store.NewWebhookPolicy("T", "acl", srv.URL, false, time.Minute)
+	if ok := p.Accept("wwan0", "video.com"); ok {
+		t.Fatalf("Policy %s accepted source wwan0 for video.com", p.ID())
+	}
+	if ok := p.Accept("en0", "video.com"); !ok {
+		t.Fatalf("Policy %s did not accept source en0 for video.com", p.ID())
+	}
+
+	// Decisions are cached.
+	p.Accept("wwan0", "video.com")
+	if n := atomic.LoadInt32(&n); n != 2 {
+		t.Fatalf("Unexpected number of requests: wanted 2, found %d", n)
+	}
+}
+
+func TestWebhookPolicy_fail(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	for _, failOpen := range []bool{true, false} {
+		p := store.NewWebhookPolicy("T", "acl", srv.URL, failOpen, 0)
+		if ok := p.Accept("en0", "example.com"); ok != failOpen {
+			t.Fatalf("Policy %s: wanted %v, found %v", p.ID(), failOpen, ok)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package systemd integrates booster with systemd: it collects the
+// listeners passed with socket activation and notifies the service
+// manager about booster's state, see sd_listen_fds(3) and sd_notify(3).
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// firstFD is the first file descriptor passed by systemd,
+// SD_LISTEN_FDS_START.
+const firstFD = 3
+
+// Listeners returns the listeners passed by systemd, mapped by their
+// name, i.e. the FileDescriptorName of the socket unit. Sockets without
+// a name are mapped to "unknown". The environment variables used are
+// unset, so that child processes do not inherit them.
+// Returns an empty map if booster was not socket activated.
+func Listeners() (map[string][]net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	acc := make(map[string][]net.Listener)
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		// The sockets, if any, were not meant for us.
+		return acc, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return acc, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	for i := 0; i < n; i++ {
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(firstFD+i), name)
+		// FileListener duplicates the descriptor, the original one is
+		// no longer needed.
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return acc, fmt.Errorf("systemd: socket %d (%s) is not a listener: %v", firstFD+i, name, err)
+		}
+		acc[name] = append(acc[name], ln)
+	}
+	return acc, nil
+}
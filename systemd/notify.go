@@ -0,0 +1,101 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package systemd
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"upspin.io/log"
+)
+
+// Notification states understood by systemd.
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+// Notify sends `state` to the service manager. Returns false if
+// booster is not running under systemd, i.e. $NOTIFY_SOCKET is not set.
+func Notify(state string) (bool, error) {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return false, nil
+	}
+	// Abstract socket.
+	if path[0] == '@' {
+		path = "\x00" + path[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Status returns a STATUS notification, shown by `systemctl status`.
+func Status(s string) string {
+	return "STATUS=" + s
+}
+
+// WatchdogInterval returns the interval within which systemd expects
+// a watchdog notification, or 0 if the watchdog is not enabled for
+// this process.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if s := os.Getenv("WATCHDOG_PID"); s != "" {
+		if pid, err := strconv.Atoi(s); err != nil || pid != os.Getpid() {
+			return 0
+		}
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// RunWatchdog sends a watchdog notification every half of the interval
+// required by systemd, until the context is canceled. It returns
+// immediately if the watchdog is not enabled.
+func RunWatchdog(ctx context.Context) error {
+	interval := WatchdogInterval()
+	if interval == 0 {
+		return nil
+	}
+
+	t := time.NewTicker(interval / 2)
+	defer t.Stop()
+	for {
+		if _, err := Notify(Watchdog); err != nil {
+			log.Error.Printf("systemd: watchdog notification failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
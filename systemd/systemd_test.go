@@ -0,0 +1,93 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package systemd_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/systemd"
+)
+
+func TestNotify(t *testing.T) {
+	os.Unsetenv("NOTIFY_SOCKET")
+	if ok, err := systemd.Notify(systemd.Ready); ok || err != nil {
+		t.Fatalf("Notify without systemd: ok %v, err %v", ok, err)
+	}
+
+	dir, err := ioutil.TempDir("", "booster-systemd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	os.Setenv("NOTIFY_SOCKET", path)
+	defer os.Unsetenv("NOTIFY_SOCKET")
+	if ok, err := systemd.Notify(systemd.Ready); !ok || err != nil {
+		t.Fatalf("Notify failed: ok %v, err %v", ok, err)
+	}
+
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(buf[:n]); s != systemd.Ready {
+		t.Fatalf("Unexpected notification: %q", s)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	defer os.Unsetenv("WATCHDOG_USEC")
+	defer os.Unsetenv("WATCHDOG_PID")
+
+	os.Setenv("WATCHDOG_USEC", "3000000")
+	if d := systemd.WatchdogInterval(); d != 3*time.Second {
+		t.Fatalf("Unexpected interval: %v", d)
+	}
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+	if d := systemd.WatchdogInterval(); d != 0 {
+		t.Fatalf("Watchdog of another process should be ignored, found %v", d)
+	}
+}
+
+func TestListeners(t *testing.T) {
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	os.Setenv("LISTEN_FDS", "1")
+	ls, err := systemd.Listeners()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 0 {
+		t.Fatalf("Sockets of another process should be ignored, found %v", ls)
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Fatal("Environment should be cleaned")
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package trace
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// conn ends its span when closed, recording the first byte
+// received and the amount of data transmitted.
+type conn struct {
+	net.Conn
+	span *Span
+
+	first     sync.Once
+	close     sync.Once
+	read, wrt int64
+}
+
+// Conn returns a net.Conn that ends `span` when it is closed. If span
+// is nil, `c` is returned.
+func Conn(c net.Conn, span *Span) net.Conn {
+	if span == nil {
+		return c
+	}
+	return &conn{Conn: c, span: span}
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.first.Do(func() { c.span.AddEvent("first_byte") })
+		atomic.AddInt64(&c.read, int64(n))
+	}
+	return n, err
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	atomic.AddInt64(&c.wrt, int64(n))
+	return n, err
+}
+
+func (c *conn) Unwrap() net.Conn {
+	return c.Conn
+}
+
+func (c *conn) Relayed(n int, write bool) {
+	if write {
+		atomic.AddInt64(&c.wrt, int64(n))
+		return
+	}
+	c.first.Do(func() { c.span.AddEvent("first_byte") })
+	atomic.AddInt64(&c.read, int64(n))
+}
+
+func (c *conn) Close() error {
+	err := c.Conn.Close()
+	c.close.Do(func() {
+		c.span.SetAttr("bytes_received", atomic.LoadInt64(&c.read))
+		c.span.SetAttr("bytes_sent", atomic.LoadInt64(&c.wrt))
+		c.span.End(nil)
+	})
+	return err
+}
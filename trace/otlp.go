@@ -0,0 +1,280 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"upspin.io/log"
+)
+
+// Defaults used when the Tracer fields are not set.
+const (
+	DefaultBatchSize     = 512
+	DefaultBatchInterval = time.Second * 5
+	DefaultQueueSize     = 4096
+)
+
+// Tracer collects the spans ended, and exports them in batches to an
+// OTLP/HTTP collector. Its zero value is not ready to be used: set
+// Endpoint, then call Run.
+type Tracer struct {
+	// Endpoint is the URL of the collector traces endpoint, e.g.
+	// http://localhost:4318/v1/traces.
+	Endpoint string
+	// Headers are added to each export request, e.g. authorization.
+	Headers map[string]string
+	// Service is reported as the `service.name` resource attribute.
+	Service string
+	// Ratio is the fraction of traces sampled, from 0 to 1.
+	Ratio float64
+
+	BatchSize     int
+	BatchInterval time.Duration
+
+	once  sync.Once
+	queue chan *Span
+}
+
+func (t *Tracer) init() {
+	t.once.Do(func() {
+		t.queue = make(chan *Span, DefaultQueueSize)
+	})
+}
+
+func (t *Tracer) sample() bool {
+	switch {
+	case t.Ratio >= 1:
+		return true
+	case t.Ratio <= 0:
+		return false
+	default:
+		return rand.Float64() < t.Ratio
+	}
+}
+
+func (t *Tracer) enqueue(s *Span) {
+	t.init()
+	select {
+	case t.queue <- s:
+	default:
+		// Never block the traced operations.
+		log.Debug.Printf("Tracer: queue full, dropping span %s", s.Name)
+	}
+}
+
+// Run exports the spans until the context is canceled. The spans
+// still queued are then exported.
+func (t *Tracer) Run(ctx context.Context) error {
+	t.init()
+	size, interval := t.BatchSize, t.BatchInterval
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	if interval <= 0 {
+		interval = DefaultBatchInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	batch := make([]*Span, 0, size)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.Export(ctx, batch); err != nil {
+			log.Error.Printf("Tracer: unable to export %d spans: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			for len(t.queue) > 0 && len(batch) < size {
+				batch = append(batch, <-t.queue)
+			}
+			_ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+			flush(_ctx)
+			cancel()
+			return ctx.Err()
+		case s := <-t.queue:
+			batch = append(batch, s)
+			if len(batch) >= size {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		}
+	}
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+func attr(k string, v interface{}) otlpAttr {
+	var val otlpValue
+	switch v := v.(type) {
+	case string:
+		val.StringValue = &v
+	case bool:
+		val.BoolValue = &v
+	case int:
+		s := strconv.FormatInt(int64(v), 10)
+		val.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		val.IntValue = &s
+	case float64:
+		val.DoubleValue = &v
+	default:
+		s := fmt.Sprint(v)
+		val.StringValue = &s
+	}
+	return otlpAttr{Key: k, Value: val}
+}
+
+type otlpEvent struct {
+	Time string `json:"timeUnixNano"`
+	Name string `json:"name"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID    string      `json:"traceId"`
+	SpanID     string      `json:"spanId"`
+	ParentID   string      `json:"parentSpanId,omitempty"`
+	Name       string      `json:"name"`
+	Kind       int         `json:"kind"`
+	Start      string      `json:"startTimeUnixNano"`
+	End        string      `json:"endTimeUnixNano"`
+	Attributes []otlpAttr  `json:"attributes,omitempty"`
+	Events     []otlpEvent `json:"events,omitempty"`
+	Status     otlpStatus  `json:"status"`
+}
+
+func nanos(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func (s *Span) otlp() otlpSpan {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	v := otlpSpan{
+		TraceID: hex.EncodeToString(s.TraceID[:]),
+		SpanID:  hex.EncodeToString(s.ID[:]),
+		Name:    s.Name,
+		Kind:    1, // internal
+		Start:   nanos(s.Start),
+		End:     nanos(s.end),
+		Status:  otlpStatus{Code: 1}, // ok
+	}
+	if s.Parent != [8]byte{} {
+		v.ParentID = hex.EncodeToString(s.Parent[:])
+	}
+	for k, a := range s.attrs {
+		v.Attributes = append(v.Attributes, attr(k, a))
+	}
+	for _, e := range s.events {
+		v.Events = append(v.Events, otlpEvent{Time: nanos(e.Time), Name: e.Name})
+	}
+	if s.err != nil {
+		v.Status = otlpStatus{Code: 2, Message: s.err.Error()}
+	}
+	return v
+}
+
+// Export sends `spans` to the collector.
+func (t *Tracer) Export(ctx context.Context, spans []*Span) error {
+	service := t.Service
+	if service == "" {
+		service = "booster"
+	}
+	acc := make([]otlpSpan, 0, len(spans))
+	for _, v := range spans {
+		acc = append(acc, v.otlp())
+	}
+
+	type scopeSpans struct {
+		Scope struct {
+			Name string `json:"name"`
+		} `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	type resourceSpans struct {
+		Resource struct {
+			Attributes []otlpAttr `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []scopeSpans `json:"scopeSpans"`
+	}
+	var rs resourceSpans
+	rs.Resource.Attributes = []otlpAttr{attr("service.name", service)}
+	ss := scopeSpans{Spans: acc}
+	ss.Scope.Name = "github.com/booster-proj/booster"
+	rs.ScopeSpans = []scopeSpans{ss}
+
+	b, err := json.Marshal(struct {
+		ResourceSpans []resourceSpans `json:"resourceSpans"`
+	}{
+		ResourceSpans: []resourceSpans{rs},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", t.Endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("collector responded %s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+	return nil
+}
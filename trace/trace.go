@@ -0,0 +1,173 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package trace records the spans of the operations performed while
+// proxying a connection, i.e. source selection, DNS resolution, TCP
+// connect and first byte received, and exports them using the
+// OpenTelemetry protocol (OTLP/HTTP, JSON encoding).
+//
+// Tracing is disabled until a Tracer is installed with SetTracer; in
+// that case every operation of this package is a no-op, and nil
+// spans are safe to use.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	mrand "math/rand"
+	"sync"
+	"time"
+)
+
+// Span describes an operation.
+type Span struct {
+	TraceID [16]byte
+	ID      [8]byte
+	Parent  [8]byte
+	Name    string
+	Start   time.Time
+
+	mux    sync.Mutex
+	end    time.Time
+	attrs  map[string]interface{}
+	events []Event
+	err    error
+
+	t *Tracer
+}
+
+// Event is something that happened at a point in time during a span.
+type Event struct {
+	Name string
+	Time time.Time
+}
+
+// SetAttr sets the attribute `key` of the span. Values should be
+// strings, bools, integers or floats.
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.attrs == nil {
+		s.attrs = make(map[string]interface{})
+	}
+	s.attrs[key] = value
+}
+
+// AddEvent records event `name` at the current time.
+func (s *Span) AddEvent(name string) {
+	if s == nil {
+		return
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.events = append(s.events, Event{Name: name, Time: time.Now()})
+}
+
+// End completes the span, marking it as failed if `err` is not nil.
+// Only the first call has effect.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mux.Lock()
+	if !s.end.IsZero() {
+		s.mux.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.err = err
+	s.mux.Unlock()
+
+	s.t.enqueue(s)
+}
+
+type spanKey struct{}
+
+// FromContext returns the span contained in `ctx`, if any.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+var tracer struct {
+	sync.Mutex
+	t *Tracer
+}
+
+// SetTracer installs `t` as the tracer used by Start. If `t` is nil,
+// tracing is disabled.
+func SetTracer(t *Tracer) {
+	tracer.Lock()
+	defer tracer.Unlock()
+	tracer.t = t
+}
+
+func getTracer() *Tracer {
+	tracer.Lock()
+	defer tracer.Unlock()
+	return tracer.t
+}
+
+// Start starts a span named `name`, child of the span contained
+// in `ctx`, if any. The returned context contains the new span.
+// If tracing is disabled, or the trace was not sampled, the span
+// returned is nil.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	var t *Tracer
+	if parent != nil {
+		t = parent.t
+	} else {
+		t = getTracer()
+		if t == nil || !t.sample() {
+			return ctx, nil
+		}
+	}
+
+	s := &Span{Name: name, Start: time.Now(), t: t}
+	if parent != nil {
+		s.TraceID = parent.TraceID
+		s.Parent = parent.ID
+	} else {
+		randomID(s.TraceID[:])
+	}
+	randomID(s.ID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func randomID(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		for i := 0; i < len(b); i += 8 {
+			var buf [8]byte
+			binary.LittleEndian.PutUint64(buf[:], mrand.Uint64())
+			copy(b[i:], buf[:])
+		}
+	}
+}
+
+// TraceIDString returns the hex representation of the trace ID.
+func (s *Span) TraceIDString() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.TraceID[:])
+}
@@ -0,0 +1,126 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package trace_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/trace"
+)
+
+func TestStart_disabled(t *testing.T) {
+	trace.SetTracer(nil)
+	ctx, span := trace.Start(context.Background(), "foo")
+	if span != nil {
+		t.Fatalf("Unexpected span: %v", span)
+	}
+	// nil spans must be safe to use.
+	span.SetAttr("foo", "bar")
+	span.AddEvent("foo")
+	span.End(nil)
+	if trace.FromContext(ctx) != nil {
+		t.Fatal("Context should not contain any span")
+	}
+}
+
+func TestExport(t *testing.T) {
+	type payload struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID  string `json:"traceId"`
+					SpanID   string `json:"spanId"`
+					ParentID string `json:"parentSpanId"`
+					Name     string `json:"name"`
+					Events   []struct {
+						Name string `json:"name"`
+					} `json:"events"`
+					Status struct {
+						Code    int    `json:"code"`
+						Message string `json:"message"`
+					} `json:"status"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	received := make(chan payload, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p payload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Error(err)
+		}
+		received <- p
+	}))
+	defer srv.Close()
+
+	tracer := &trace.Tracer{Endpoint: srv.URL, Ratio: 1, BatchSize: 3}
+	trace.SetTracer(tracer)
+	defer trace.SetTracer(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- tracer.Run(ctx) }()
+
+	ctx0, root := trace.Start(context.Background(), "root")
+	_, child := trace.Start(ctx0, "child")
+	child.End(errors.New("failed"))
+
+	c0, c1 := net.Pipe()
+	_, cspan := trace.Start(ctx0, "conn")
+	conn := trace.Conn(c0, cspan)
+	go c1.Write([]byte("hello"))
+	conn.Read(make([]byte, 5))
+	conn.Close()
+	root.End(nil)
+
+	var p payload
+	select {
+	case p = <-received:
+	case <-time.After(time.Second * 2):
+		t.Fatal("No spans exported")
+	}
+	cancel()
+	<-done
+
+	spans := p.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 3 {
+		t.Fatalf("Unexpected spans: %+v", spans)
+	}
+	byName := make(map[string]int)
+	for i, v := range spans {
+		byName[v.Name] = i
+		if v.TraceID != root.TraceIDString() {
+			t.Fatalf("Span %s has trace id %s, wanted %s", v.Name, v.TraceID, root.TraceIDString())
+		}
+	}
+	r, ch, cn := spans[byName["root"]], spans[byName["child"]], spans[byName["conn"]]
+	if r.ParentID != "" || ch.ParentID != r.SpanID || cn.ParentID != r.SpanID {
+		t.Fatalf("Unexpected span hierarchy: %+v", spans)
+	}
+	if ch.Status.Code != 2 || ch.Status.Message != "failed" {
+		t.Fatalf("Unexpected status: %+v", ch.Status)
+	}
+	if len(cn.Events) != 1 || cn.Events[0].Name != "first_byte" {
+		t.Fatalf("Unexpected events: %+v", cn.Events)
+	}
+}
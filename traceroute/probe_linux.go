@@ -0,0 +1,145 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package traceroute
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+	"golang.org/x/sys/unix"
+)
+
+// Origins and types of the errors queued by IP_RECVERR, see
+// linux/errqueue.h.
+const (
+	originICMP  = 2
+	originICMP6 = 3
+
+	icmpUnreachable   = 3
+	icmpPortClosed    = 3
+	icmpTimeExceeded  = 11
+	icmp6Unreachable  = 1
+	icmp6PortClosed   = 4
+	icmp6TimeExceeded = 3
+)
+
+// probe sends a probe with `ttl` to `address` through `src`, waiting
+// for the ICMP error it triggers for at most `timeout`.
+func probe(ctx context.Context, src core.Source, address string, ttl int, timeout time.Duration) hop {
+	h := hop{Hop: Hop{TTL: ttl}}
+	conn, err := src.DialContext(ctx, "udp", address)
+	if err != nil {
+		h.err = err
+		return h
+	}
+	defer conn.Close()
+	uc, ok := unwrap(conn).(*net.UDPConn)
+	if !ok {
+		h.err = ErrUnsupported
+		return h
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		h.err = err
+		return h
+	}
+
+	v6 := uc.RemoteAddr().(*net.UDPAddr).IP.To4() == nil
+	level, ttlOpt, errOpt := unix.IPPROTO_IP, unix.IP_TTL, unix.IP_RECVERR
+	if v6 {
+		level, ttlOpt, errOpt = unix.IPPROTO_IPV6, unix.IPV6_UNICAST_HOPS, unix.IPV6_RECVERR
+	}
+	var serr error
+	if err := raw.Control(func(fd uintptr) {
+		if serr = unix.SetsockoptInt(int(fd), level, ttlOpt, ttl); serr == nil {
+			serr = unix.SetsockoptInt(int(fd), level, errOpt, 1)
+		}
+	}); err != nil || serr != nil {
+		h.err = fmt.Errorf("traceroute: unable to set the TTL: %v", firstErr(err, serr))
+		return h
+	}
+
+	start := time.Now()
+	deadline := start.Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	uc.SetReadDeadline(deadline)
+	if _, err := uc.Write([]byte("booster")); err != nil {
+		h.err = err
+		return h
+	}
+
+	// The ICMP errors are queued on the socket, which is reported
+	// as readable.
+	b := make([]byte, 512)
+	oob := make([]byte, 512)
+	var oobn int
+	if err := raw.Read(func(fd uintptr) bool {
+		_, oobn, _, _, serr = unix.Recvmsg(int(fd), b, oob, unix.MSG_ERRQUEUE|unix.MSG_DONTWAIT)
+		return serr != unix.EAGAIN
+	}); err != nil || serr != nil {
+		// No reply in time: the hop is left blank.
+		return h
+	}
+	h.RTT = time.Since(start)
+
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		h.err = err
+		return h
+	}
+	for _, m := range msgs {
+		if m.Header.Level != int32(level) || m.Header.Type != int32(errOpt) || len(m.Data) < 16 {
+			continue
+		}
+		origin, typ, code := m.Data[4], m.Data[5], m.Data[6]
+		// The address of the router follows the error, in a
+		// sockaddr_in or sockaddr_in6.
+		switch {
+		case !v6 && len(m.Data) >= 24:
+			h.Address = net.IP(m.Data[20:24]).String()
+		case v6 && len(m.Data) >= 40:
+			h.Address = net.IP(m.Data[24:40]).String()
+		}
+		switch {
+		case origin == originICMP && typ == icmpTimeExceeded,
+			origin == originICMP6 && typ == icmp6TimeExceeded:
+		case origin == originICMP && typ == icmpUnreachable && code == icmpPortClosed,
+			origin == originICMP6 && typ == icmp6Unreachable && code == icmp6PortClosed:
+			h.reached = true
+		case origin == originICMP && typ == icmpUnreachable,
+			origin == originICMP6 && typ == icmp6Unreachable:
+			h.Error = fmt.Sprintf("destination unreachable, code %d", code)
+		default:
+			h.Error = fmt.Sprintf("unexpected error, origin %d, type %d, code %d", origin, typ, code)
+		}
+		return h
+	}
+	return h
+}
+
+func firstErr(errs ...error) error {
+	for _, v := range errs {
+		if v != nil {
+			return v
+		}
+	}
+	return nil
+}
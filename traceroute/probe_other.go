@@ -0,0 +1,31 @@
+//go:build !linux
+// +build !linux
+
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package traceroute
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+)
+
+func probe(ctx context.Context, src core.Source, address string, ttl int, timeout time.Duration) hop {
+	return hop{Hop: Hop{TTL: ttl}, err: errors.New("traceroute: only supported on linux")}
+}
@@ -0,0 +1,196 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package traceroute finds the routers on the path from a source to a
+// destination, telling the problems of the local link from the ones
+// of the upstream routing.
+package traceroute
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+)
+
+// Defaults used when the Tracer fields are not set.
+var (
+	DefaultMaxHops = 30
+	DefaultTimeout = time.Second * 2
+	// DefaultPort is the first destination port of the probes, the
+	// one of the classic traceroute, unlikely to be open.
+	DefaultPort = 33434
+)
+
+// ErrUnknownSource is returned when the source to trace through is not
+// stored.
+var ErrUnknownSource = errors.New("traceroute: no such source")
+
+// ErrUnsupported is returned when the source does not dial UDP
+// sockets of its own, e.g. the remote sources.
+var ErrUnsupported = errors.New("traceroute: the source does not support the traceroute")
+
+// Store describes the entity that contains the sources.
+type Store interface {
+	Do(func(core.Source))
+}
+
+// Hop is a step of the path to the destination.
+type Hop struct {
+	TTL int `json:"ttl"`
+	// Address is the one of the router that replied, empty if none
+	// did in time.
+	Address string        `json:"address,omitempty"`
+	RTT     time.Duration `json:"rtt,omitempty"`
+	// Error is set when the router reported the destination as
+	// unreachable.
+	Error string `json:"error,omitempty"`
+}
+
+// Result is the path from a source to a destination.
+type Result struct {
+	Source string    `json:"source"`
+	Host   string    `json:"host"`
+	Time   time.Time `json:"time"`
+	// Address is the one of the destination, which Host resolves
+	// to through the source.
+	Address string `json:"address"`
+	Hops    []Hop  `json:"hops"`
+	// Reached is set when the destination replied.
+	Reached bool `json:"reached"`
+}
+
+// Tracer runs the traceroutes through the sources of its Store, with
+// UDP probes whose TTL grows one hop at a time, as the traceroute
+// command does. The probes are sent from unprivileged sockets, whose
+// ICMP errors are read from their error queues: Linux only. Its zero
+// value is not ready to be used: Store must be set.
+type Tracer struct {
+	Store Store
+	// MaxHops is the maximum number of hops traced.
+	MaxHops int
+	// Timeout is the time each hop has to reply.
+	Timeout time.Duration
+	// Port is the destination port of the first probe, incremented
+	// by each of the following ones.
+	Port int
+}
+
+func (t *Tracer) maxHops() int {
+	if t.MaxHops <= 0 {
+		return DefaultMaxHops
+	}
+	return t.MaxHops
+}
+
+func (t *Tracer) timeout() time.Duration {
+	if t.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return t.Timeout
+}
+
+func (t *Tracer) port() int {
+	if t.Port <= 0 {
+		return DefaultPort
+	}
+	return t.Port
+}
+
+// TraceID traces the path to `host` through the source identified by
+// `id`.
+func (t *Tracer) TraceID(ctx context.Context, id, host string) (Result, error) {
+	var src core.Source
+	t.Store.Do(func(v core.Source) {
+		if v.ID() == id {
+			src = v
+		}
+	})
+	if src == nil {
+		return Result{}, ErrUnknownSource
+	}
+	return t.Trace(ctx, src, host)
+}
+
+// Trace traces the path to `host` through `src`. The probes of every
+// hop are sent at once, so that the trace takes about Timeout.
+func (t *Tracer) Trace(ctx context.Context, src core.Source, host string) (Result, error) {
+	res := Result{Source: src.ID(), Host: host, Time: time.Now()}
+
+	// Resolve the host through the source once, so that each probe
+	// goes to the same address.
+	conn, err := src.DialContext(ctx, "udp", net.JoinHostPort(host, strconv.Itoa(t.port())))
+	if err != nil {
+		return res, err
+	}
+	addr, ok := conn.RemoteAddr().(*net.UDPAddr)
+	conn.Close()
+	if !ok {
+		return res, ErrUnsupported
+	}
+	res.Address = addr.IP.String()
+
+	var wg sync.WaitGroup
+	hops := make([]hop, t.maxHops())
+	for i := range hops {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			address := net.JoinHostPort(res.Address, strconv.Itoa(t.port()+i))
+			hops[i] = probe(ctx, src, address, i+1, t.timeout())
+		}(i)
+	}
+	wg.Wait()
+
+	for _, v := range hops {
+		if v.err != nil {
+			return res, v.err
+		}
+		res.Hops = append(res.Hops, v.Hop)
+		if v.reached {
+			res.Reached = true
+			break
+		}
+		if v.Error != "" {
+			break
+		}
+	}
+	return res, nil
+}
+
+// hop is the outcome of a probe.
+type hop struct {
+	Hop
+	// reached is set when the destination replied.
+	reached bool
+	// err is set when the probe could not be sent.
+	err error
+}
+
+// unwrap returns the connection wrapped by `c`, e.g. to collect the
+// metrics of the sources.
+func unwrap(c net.Conn) net.Conn {
+	for {
+		w, ok := c.(interface{ Unwrap() net.Conn })
+		if !ok {
+			return c
+		}
+		c = w.Unwrap()
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package traceroute_test
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/traceroute"
+)
+
+type local struct {
+	net.Dialer
+}
+
+func (s *local) ID() string {
+	return "local"
+}
+
+func (s *local) Close() error {
+	return nil
+}
+
+// remote dials through a proxy, as the remote sources do.
+type remote struct {
+	local
+}
+
+func (s *remote) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	c0, c1 := net.Pipe()
+	c1.Close()
+	return c0, nil
+}
+
+type store []core.Source
+
+func (s store) Do(f func(core.Source)) {
+	for _, v := range s {
+		f(v)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("traceroute is only supported on linux")
+	}
+	tr := &traceroute.Tracer{Store: store{&local{}}, MaxHops: 3, Timeout: time.Second}
+	res, err := tr.TraceID(context.Background(), "local", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The destination is the first hop.
+	if !res.Reached || len(res.Hops) != 1 || res.Hops[0].Address != "127.0.0.1" {
+		t.Fatalf("Unexpected result: %+v", res)
+	}
+}
+
+func TestTrace_unsupported(t *testing.T) {
+	tr := &traceroute.Tracer{Store: store{&remote{}}}
+	if _, err := tr.TraceID(context.Background(), "local", "127.0.0.1"); err != traceroute.ErrUnsupported {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := tr.TraceID(context.Background(), "other", "127.0.0.1"); err != traceroute.ErrUnknownSource {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,600 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package turbo provides an HTTP proxy that is able to split large
+// downloads into multiple ranged requests, each one performed using
+// a different source. The segments are then reassembled and streamed
+// to the client in order, allowing a single download to use the
+// bandwidth of multiple sources.
+package turbo
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/booster-proj/booster/acl"
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/crash"
+	"github.com/booster-proj/booster/process"
+	"github.com/booster-proj/booster/proxyproto"
+	"github.com/booster-proj/booster/relay"
+	"github.com/booster-proj/booster/schedule"
+	"upspin.io/log"
+)
+
+// Store describes the entity that provides the sources used to
+// download the segments.
+type Store interface {
+	// Candidates returns the sources that can be used to connect
+	// to `address`, in order of preference.
+	Candidates(ctx context.Context, address string) []core.Source
+}
+
+// SourceDialer is implemented by the dialers that are able to dial
+// through a given source, e.g. the booster dialer. When Proxy.Dialer
+// implements it, the segments are dialed through it, otherwise
+// directly through their sources.
+type SourceDialer interface {
+	DialSource(ctx context.Context, src core.Source, network, address string) (net.Conn, error)
+}
+
+// Proxy is an HTTP proxy that downloads large files in segments. Requests
+// that do not qualify for segmentation are forwarded as they are using
+// Dialer. The zero value is not ready to use, fill at least Store and
+// Dialer before use.
+type Proxy struct {
+	// Store provides the sources used for the segments.
+	Store Store
+	// Dialer is used for every connection that is not a segment.
+	Dialer core.Dialer
+
+	// MinSize is the minimum size (in bytes) of a resource to
+	// be segmented.
+	MinSize int64
+	// ChunkSize is the size of each ranged request.
+	ChunkSize int64
+	// Segments is the maximum number of ranged requests in flight.
+	Segments int
+	// MatchProcesses makes the proxy find the local process that
+	// sent each request, so that process policies can be applied.
+	// Linux only.
+	MatchProcesses bool
+	// MetricsExporter, if not nil, receives the amount of data
+	// relayed by the tunnels.
+	MetricsExporter relay.MetricsExporter
+	// Buffers, if not nil, provides the buffers used to copy the
+	// data to the clients.
+	Buffers *relay.Pool
+	// ProxyProtocol are the networks of the load balancers allowed
+	// to send a PROXY protocol header, carrying the address of the
+	// client, before the requests. See the proxyproto package.
+	ProxyProtocol []*net.IPNet
+	// If TLS is not nil, the proxy is served over TLS, after the
+	// PROXY protocol header, if any: the clients use it as an HTTPS
+	// proxy.
+	TLS *tls.Config
+	// If ACL is not nil, the requests of the clients it does not
+	// allow are refused.
+	ACL *acl.List
+	// If Schedules is not nil, the requests of the clients it
+	// denies at the time are refused.
+	Schedules *schedule.Schedules
+	// Crashes reports the panics recovered while handling the
+	// requests.
+	Crashes *crash.Reporter
+}
+
+// Default configuration values, used when a Proxy field is zero.
+const (
+	DefaultMinSize   int64 = 8 << 20
+	DefaultChunkSize int64 = 2 << 20
+	DefaultSegments        = 4
+)
+
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+func removeHopHeaders(h http.Header) {
+	for _, v := range hopHeaders {
+		h.Del(v)
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer func() {
+		if v := recover(); v != nil && v != http.ErrAbortHandler {
+			p.Crashes.Handle(v, "turbo", map[string]string{"client": r.RemoteAddr, "method": r.Method, "url": r.URL.String()})
+			// Let the server close the connection, without
+			// reporting the panic again.
+			panic(http.ErrAbortHandler)
+		}
+	}()
+	// The clients of a Unix socket are local, allowed by the
+	// permissions of its file.
+	local := unixSocket(r)
+	if !local && p.ACL != nil && !p.ACL.AllowedAddr(r.RemoteAddr) {
+		log.Debug.Printf("Turbo: refusing request of client %v", r.RemoteAddr)
+		http.Error(w, "turbo: client not allowed", http.StatusForbidden)
+		return
+	}
+	if !local && p.Schedules != nil {
+		if rule, ok := p.Schedules.DeniedAddr(r.RemoteAddr, time.Now()); ok {
+			log.Debug.Printf("Turbo: refusing request of client %v, denied by schedule %v", r.RemoteAddr, rule.ID)
+			http.Error(w, fmt.Sprintf("turbo: client not allowed at this time (%v)", rule.ID), http.StatusForbidden)
+			return
+		}
+	}
+	r = withClient(r)
+	if p.MatchProcesses {
+		r = withProcess(r)
+	}
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "turbo: this is a proxy, absolute URIs are required", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodGet && r.Header.Get("Range") == "" {
+		if size, h, ok := p.probe(r); ok {
+			log.Debug.Printf("Turbo: segmenting %v (%d bytes)", r.URL, size)
+			p.segment(w, r, size, h)
+			return
+		}
+	}
+
+	p.forward(w, r)
+}
+
+// unixSocket reports whether `r` was received on a Unix socket.
+func unixSocket(r *http.Request) bool {
+	_, ok := r.Context().Value(http.LocalAddrContextKey).(*net.UnixAddr)
+	return ok
+}
+
+// withClient returns `r` with the address of the client that sent it,
+// and the one it was sent to, stored in its context for the sources
+// that forward them, see proxyproto.WithClient.
+func withClient(r *http.Request) *http.Request {
+	server, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return r
+	}
+	client, err := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+	if err != nil {
+		return r
+	}
+	return r.WithContext(proxyproto.WithClient(r.Context(), client, server))
+}
+
+// withProcess returns `r` with the local process that sent it stored
+// in its context, if it can be found.
+func withProcess(r *http.Request) *http.Request {
+	server, ok := r.Context().Value(http.LocalAddrContextKey).(*net.TCPAddr)
+	if !ok {
+		return r
+	}
+	client, err := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+	if err != nil {
+		return r
+	}
+	proc, err := process.Lookup(client, server)
+	if err != nil {
+		log.Debug.Printf("Turbo: unable to find the process of %v: %v", r.RemoteAddr, err)
+		return r
+	}
+	return r.WithContext(process.NewContext(r.Context(), proc))
+}
+
+func (p *Proxy) transport(dial func(ctx context.Context, network, address string) (net.Conn, error)) *http.Transport {
+	return &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dial,
+		DisableKeepAlives:     true,
+		ResponseHeaderTimeout: time.Second * 30,
+	}
+}
+
+// forward performs `r` using the booster dialer and copies the response
+// back to the client.
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request) {
+	req := r.WithContext(r.Context())
+	req.RequestURI = ""
+	req.Header = cloneHeader(r.Header)
+	removeHopHeaders(req.Header)
+
+	resp, err := p.transport(p.Dialer.DialContext).RoundTrip(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	removeHopHeaders(resp.Header)
+	copyHeader(w.Header(), resp.Header)
+	w.WriteHeader(resp.StatusCode)
+	if pool := p.Buffers; pool != nil {
+		b := pool.Get()
+		defer pool.Put(b)
+		io.CopyBuffer(w, resp.Body, *b)
+		return
+	}
+	io.Copy(w, resp.Body)
+}
+
+// tunnel handles CONNECT requests, which cannot be segmented.
+func (p *Proxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "turbo: hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+
+	upstream, err := p.Dialer.DialContext(r.Context(), "tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
+
+	conn, buf, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+
+	// Flush what was already buffered by the server.
+	if n := buf.Reader.Buffered(); n > 0 {
+		b, _ := buf.Reader.Peek(n)
+		if _, err := upstream.Write(b); err != nil {
+			return
+		}
+	}
+	p.pipe(r.Context(), conn, upstream)
+}
+
+// pipe relays the data between `conn` and `upstream` in both
+// directions, until either direction ends or `ctx` is canceled. Both
+// connections are closed in the latter case, interrupting the copies
+// in progress.
+func (p *Proxy) pipe(ctx context.Context, conn, upstream net.Conn) {
+	done := make(chan struct{}, 2)
+	cp := func(dst, src net.Conn) {
+		defer func() { done <- struct{}{} }()
+		defer p.Crashes.Recover("turbo", map[string]string{"client": conn.RemoteAddr().String(), "upstream": upstream.RemoteAddr().String()})
+		n, path, _ := relay.Copy(dst, src, p.Buffers)
+		if exp := p.MetricsExporter; exp != nil {
+			exp.CountRelayed(map[string]string{"path": path}, n)
+		}
+	}
+	go cp(upstream, conn)
+	go cp(conn, upstream)
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		conn.Close()
+		upstream.Close()
+	}
+}
+
+// probe performs a HEAD request to find out wether the resource
+// requested by `r` supports ranged requests and is big enough to be
+// segmented.
+func (p *Proxy) probe(r *http.Request) (int64, http.Header, bool) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*10)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodHead, r.URL.String(), nil)
+	if err != nil {
+		return 0, nil, false
+	}
+	req = req.WithContext(ctx)
+	req.Header = cloneHeader(r.Header)
+	removeHopHeaders(req.Header)
+
+	resp, err := p.transport(p.Dialer.DialContext).RoundTrip(req)
+	if err != nil {
+		return 0, nil, false
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK ||
+		resp.Header.Get("Accept-Ranges") != "bytes" ||
+		resp.Header.Get("Content-Encoding") != "" {
+		return 0, nil, false
+	}
+	if resp.ContentLength < p.minSize() {
+		return 0, nil, false
+	}
+	return resp.ContentLength, resp.Header, true
+}
+
+func (p *Proxy) minSize() int64 {
+	if p.MinSize > 0 {
+		return p.MinSize
+	}
+	return DefaultMinSize
+}
+
+func (p *Proxy) chunkSize() int64 {
+	if p.ChunkSize > 0 {
+		return p.ChunkSize
+	}
+	return DefaultChunkSize
+}
+
+func (p *Proxy) segments() int {
+	if p.Segments > 0 {
+		return p.Segments
+	}
+	return DefaultSegments
+}
+
+// sources returns the sources that can be used to contact `address`.
+func (p *Proxy) sources(ctx context.Context, address string) []core.Source {
+	return p.Store.Candidates(ctx, address)
+}
+
+type chunk struct {
+	index      int
+	start, end int64 // inclusive
+	data       chan []byte
+}
+
+func (p *Proxy) segment(w http.ResponseWriter, r *http.Request, size int64, h http.Header) {
+	address := r.URL.Host
+	if r.URL.Port() == "" {
+		address = net.JoinHostPort(r.URL.Hostname(), "80")
+	}
+	srcs := p.sources(r.Context(), address)
+	if len(srcs) == 0 {
+		http.Error(w, "turbo: no source available", http.StatusBadGateway)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	cs := p.chunkSize()
+	n := int((size + cs - 1) / cs)
+	chunks := make([]*chunk, n)
+	for i := range chunks {
+		end := int64(i+1)*cs - 1
+		if end >= size {
+			end = size - 1
+		}
+		chunks[i] = &chunk{index: i, start: int64(i) * cs, end: end, data: make(chan []byte, 1)}
+	}
+
+	// tokens limits the number of chunks downloaded but not yet written
+	// to the client, i.e. the memory used by the download.
+	tokens := make(chan struct{}, p.segments()*2)
+	queue := make(chan *chunk)
+	errc := make(chan error, p.segments())
+
+	go func() {
+		defer close(queue)
+		for _, c := range chunks {
+			select {
+			case tokens <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case queue <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < p.segments(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if v := recover(); v != nil {
+					errc <- p.Crashes.Handle(v, "turbo", map[string]string{"client": r.RemoteAddr, "url": r.URL.String()})
+					cancel()
+				}
+			}()
+			for c := range queue {
+				b, err := p.fetch(ctx, r, h, c, srcs)
+				if err != nil {
+					errc <- err
+					cancel()
+					return
+				}
+				c.data <- b
+			}
+		}()
+	}
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	hdr := w.Header()
+	copyHeader(hdr, h)
+	removeHopHeaders(hdr)
+	hdr.Set("Content-Length", strconv.FormatInt(size, 10))
+	w.WriteHeader(http.StatusOK)
+
+	for _, c := range chunks {
+		select {
+		case b := <-c.data:
+			if _, err := w.Write(b); err != nil {
+				cancel()
+				return
+			}
+			<-tokens
+		case <-ctx.Done():
+			if r.Context().Err() != nil {
+				// The client is gone.
+				return
+			}
+			// Headers are already gone, the only way to tell the client
+			// that something went wrong is to abort the response.
+			log.Error.Printf("Turbo: download of %v failed: %v", r.URL, <-errc)
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+// fetch downloads chunk `c`, trying each source at most once, starting
+// from the one associated with the chunk index.
+func (p *Proxy) fetch(ctx context.Context, r *http.Request, h http.Header, c *chunk, srcs []core.Source) ([]byte, error) {
+	var err error
+	for i := 0; i < len(srcs); i++ {
+		src := srcs[(c.index+i)%len(srcs)]
+		var b []byte
+		if b, err = p.fetchWith(ctx, r, h, c, src); err == nil {
+			return b, nil
+		}
+		log.Debug.Printf("Turbo: chunk %d of %v failed using source %s: %v", c.index, r.URL, src.ID(), err)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return nil, err
+}
+
+func (p *Proxy) fetchWith(ctx context.Context, r *http.Request, h http.Header, c *chunk, src core.Source) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, r.URL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header = cloneHeader(r.Header)
+	removeHopHeaders(req.Header)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", c.start, c.end))
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		// Make sure that the resource did not change in the meanwhile.
+		req.Header.Set("If-Range", etag)
+	}
+
+	dial := src.DialContext
+	if sd, ok := p.Dialer.(SourceDialer); ok {
+		dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+			return sd.DialSource(ctx, src, network, address)
+		}
+	}
+	resp, err := p.transport(dial).RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("unexpected status %v for ranged request", resp.Status)
+	}
+	want := fmt.Sprintf("bytes %d-%d/", c.start, c.end)
+	if cr := resp.Header.Get("Content-Range"); !strings.HasPrefix(cr, want) {
+		return nil, fmt.Errorf("unexpected content range %q, wanted %q", cr, want)
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, c.end-c.start+1))
+	if _, err := io.Copy(buf, resp.Body); err != nil {
+		return nil, err
+	}
+	if int64(buf.Len()) != c.end-c.start+1 {
+		return nil, errors.New("short ranged response")
+	}
+	return buf.Bytes(), nil
+}
+
+// ListenAndServe serves the proxy on `port`, until the context is
+// canceled.
+func (p *Proxy) ListenAndServe(ctx context.Context, port int) error {
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+	return p.Serve(ctx, ln)
+}
+
+// Serve serves the proxy on the connections accepted by `ln`, until
+// the context is canceled. The requests in progress, including the
+// tunnels, are canceled together with the context.
+func (p *Proxy) Serve(ctx context.Context, ln net.Listener) error {
+	if len(p.ProxyProtocol) > 0 {
+		ln = &proxyproto.Listener{Listener: ln, Trusted: p.ProxyProtocol}
+	}
+	if p.TLS != nil {
+		// The tunnels hijack the connections, which is not
+		// possible with HTTP/2.
+		conf := p.TLS.Clone()
+		conf.NextProtos = []string{"http/1.1"}
+		ln = tls.NewListener(ln, conf)
+	}
+	srv := &http.Server{
+		Handler:     p,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	c := make(chan error)
+	go func() {
+		c <- srv.Serve(ln)
+	}()
+
+	select {
+	case <-ctx.Done():
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		srv.Shutdown(ctx)
+		return <-c
+	case err := <-c:
+		return err
+	}
+}
+
+func cloneHeader(h http.Header) http.Header {
+	h2 := make(http.Header, len(h))
+	copyHeader(h2, h)
+	return h2
+}
+
+func copyHeader(dst, src http.Header) {
+	for k, vv := range src {
+		dst[k] = append([]string(nil), vv...)
+	}
+}
@@ -0,0 +1,301 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package turbo_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/acl"
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/dialer"
+	"github.com/booster-proj/booster/schedule"
+	"github.com/booster-proj/booster/turbo"
+)
+
+type mock struct {
+	id string
+
+	sync.Mutex
+	dials int
+}
+
+func (s *mock) ID() string {
+	return s.id
+}
+
+func (s *mock) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	s.Lock()
+	s.dials++
+	s.Unlock()
+
+	var d net.Dialer
+	return d.DialContext(ctx, network, address)
+}
+
+func (s *mock) Close() error {
+	return nil
+}
+
+func (s *mock) count() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.dials
+}
+
+type store struct {
+	sources []core.Source
+}
+
+func (s *store) Candidates(ctx context.Context, address string) []core.Source {
+	return s.sources
+}
+
+// balancer returns always the same source.
+type balancer struct {
+	src core.Source
+}
+
+func (b *balancer) Get(ctx context.Context, target string, blacklisted ...core.Source) (core.Source, error) {
+	return b.src, nil
+}
+
+func (b *balancer) Len() int {
+	return 1
+}
+
+// usage records the sources used.
+type usage struct {
+	sync.Mutex
+	received map[string]int64
+}
+
+func (u *usage) RecordUsage(source, target string, sent, received int64) {
+	u.Lock()
+	defer u.Unlock()
+	u.received[source] += received
+}
+
+func newServer(t *testing.T, data []byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(data))
+	}))
+}
+
+func get(t *testing.T, p *turbo.Proxy, target string) []byte {
+	proxy := httptest.NewServer(p)
+	defer proxy.Close()
+
+	u, _ := url.Parse(proxy.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(u)}}
+	resp, err := client.Get(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestServeHTTP_segment(t *testing.T) {
+	data := make([]byte, 1<<20+17)
+	rand.Read(data)
+	srv := newServer(t, data)
+	defer srv.Close()
+
+	s0, s1 := &mock{id: "s0"}, &mock{id: "s1"}
+	d := &mock{id: "dialer"}
+	p := &turbo.Proxy{
+		Store:     &store{sources: []core.Source{s0, s1}},
+		Dialer:    d,
+		MinSize:   1 << 10,
+		ChunkSize: 64 << 10,
+		Segments:  3,
+	}
+
+	b := get(t, p, srv.URL)
+	if !bytes.Equal(b, data) {
+		t.Fatalf("Unexpected content: wanted %d bytes, found %d", len(data), len(b))
+	}
+	if s0.count() == 0 || s1.count() == 0 {
+		t.Fatalf("Segments were not distributed: s0 %d, s1 %d", s0.count(), s1.count())
+	}
+	if d.count() != 1 {
+		t.Fatalf("Unexpected dialer usage: wanted only the probe, found %d dials", d.count())
+	}
+}
+
+func TestServeHTTP_segmentDialer(t *testing.T) {
+	data := make([]byte, 1<<20)
+	rand.Read(data)
+	srv := newServer(t, data)
+	defer srv.Close()
+
+	s0, s1 := &mock{id: "s0"}, &mock{id: "s1"}
+	u := &usage{received: make(map[string]int64)}
+	d := dialer.New(&balancer{src: s0})
+	d.Usage = u
+	p := &turbo.Proxy{
+		Store:     &store{sources: []core.Source{s0, s1}},
+		Dialer:    d,
+		MinSize:   1 << 10,
+		ChunkSize: 64 << 10,
+		Segments:  2,
+	}
+
+	b := get(t, p, srv.URL)
+	if !bytes.Equal(b, data) {
+		t.Fatalf("Unexpected content: wanted %d bytes, found %d", len(data), len(b))
+	}
+	d.Close()
+
+	// The segments are accounted for as the other connections.
+	u.Lock()
+	defer u.Unlock()
+	if u.received["s0"] == 0 || u.received["s1"] == 0 || u.received["s0"]+u.received["s1"] < int64(len(data)) {
+		t.Fatalf("Unexpected usage: %v", u.received)
+	}
+}
+
+func TestServeHTTP_small(t *testing.T) {
+	data := []byte("hello world")
+	srv := newServer(t, data)
+	defer srv.Close()
+
+	s0 := &mock{id: "s0"}
+	d := &mock{id: "dialer"}
+	p := &turbo.Proxy{
+		Store:  &store{sources: []core.Source{s0}},
+		Dialer: d,
+	}
+
+	b := get(t, p, srv.URL)
+	if !bytes.Equal(b, data) {
+		t.Fatalf("Unexpected content: wanted %s, found %s", data, b)
+	}
+	if s0.count() != 0 {
+		t.Fatalf("Small resources should not be segmented")
+	}
+}
+
+func TestServeHTTP_acl(t *testing.T) {
+	srv := newServer(t, []byte("hello world"))
+	defer srv.Close()
+
+	l, err := acl.New(acl.Rules{Deny: []string{"127.0.0.0/8"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &mock{id: "dialer"}
+	proxy := httptest.NewServer(&turbo.Proxy{Store: &store{}, Dialer: d, ACL: l})
+	defer proxy.Close()
+
+	u, _ := url.Parse(proxy.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(u)}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden || d.count() != 0 {
+		t.Fatalf("The client should have been refused: status %d, %d dials", resp.StatusCode, d.count())
+	}
+}
+
+func TestServe_unix(t *testing.T) {
+	data := []byte("hello world")
+	srv := newServer(t, data)
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "booster-turbo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "turbo.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The clients of the Unix sockets are not subject to the ACL.
+	l, err := acl.New(acl.Rules{Allow: []string{"10.0.0.0/8"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go (&turbo.Proxy{Store: &store{}, Dialer: &mock{id: "dialer"}, ACL: l}).Serve(ctx, ln)
+
+	var d net.Dialer
+	client := &http.Client{Transport: &http.Transport{
+		Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: "unix"}),
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(b, data) {
+		t.Fatalf("Unexpected reply: status %d, content %s", resp.StatusCode, b)
+	}
+}
+
+func TestServeHTTP_schedule(t *testing.T) {
+	srv := newServer(t, []byte("hello world"))
+	defer srv.Close()
+
+	s := &schedule.Schedules{}
+	if err := s.Put(schedule.Rule{ID: "always", Clients: []string{"127.0.0.0/8"}, Deny: []schedule.Window{{From: "00:00", To: "00:00"}}}); err != nil {
+		t.Fatal(err)
+	}
+	d := &mock{id: "dialer"}
+	proxy := httptest.NewServer(&turbo.Proxy{Store: &store{}, Dialer: d, Schedules: s})
+	defer proxy.Close()
+
+	u, _ := url.Parse(proxy.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(u)}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden || d.count() != 0 {
+		t.Fatalf("The client should have been refused: status %d, %d dials", resp.StatusCode, d.count())
+	}
+}
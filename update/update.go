@@ -0,0 +1,341 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package update replaces the booster binary with the one of the latest
+// GitHub release.
+//
+// The releases carry, next to the archives, the checksums file produced
+// by goreleaser and its ed25519 signature, base64 encoded, in a file
+// with the same name and the `.sig` extension: the archive downloaded
+// is installed only if the signature of the checksums is valid and its
+// checksum matches.
+package update
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Repository is the GitHub repository the releases are fetched from.
+const Repository = "booster-proj/booster"
+
+// DefaultAPI is the GitHub API endpoint.
+const DefaultAPI = "https://api.github.com"
+
+// PublicKey is the base64 encoded ed25519 key the releases are signed
+// with, set at build time, e.g. with
+// `-ldflags "-X github.com/booster-proj/booster/update.PublicKey=..."`.
+var PublicKey = ""
+
+// ErrNoPublicKey is returned when there is no key to verify the
+// releases with.
+var ErrNoPublicKey = errors.New("update: no public key to verify the releases with")
+
+// BinaryName is the name of the binary inside the release archives.
+const BinaryName = "booster"
+
+// Release is a GitHub release.
+type Release struct {
+	Tag    string  `json:"tag_name"`
+	Assets []Asset `json:"assets"`
+}
+
+// Asset is a file attached to a release.
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// ParsePublicKey decodes a base64 encoded ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	if s == "" {
+		return nil, ErrNoPublicKey
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("update: invalid public key %q", s)
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// Sign returns the signature of `data`, as found in the `.sig` files of
+// the releases.
+func Sign(key ed25519.PrivateKey, data []byte) []byte {
+	sig := ed25519.Sign(key, data)
+	return []byte(base64.StdEncoding.EncodeToString(sig) + "\n")
+}
+
+// Updater replaces Executable with the binary of a release.
+type Updater struct {
+	// API is the GitHub API endpoint. If empty, DefaultAPI is used.
+	API    string
+	Client *http.Client
+	// PublicKey verifies the signature of the releases.
+	PublicKey ed25519.PublicKey
+	// Executable is the path of the binary to replace. If empty, the
+	// one of the running process is replaced.
+	Executable string
+	// Check, if not nil, is the health check of the binary installed,
+	// with the release it belongs to: if it fails, the previous
+	// binary is restored. By default, the binary has to report the
+	// version of the release.
+	Check func(ctx context.Context, path string, rel Release) error
+}
+
+// Latest returns the latest release.
+func (u *Updater) Latest(ctx context.Context) (Release, error) {
+	var rel Release
+	api := u.API
+	if api == "" {
+		api = DefaultAPI
+	}
+	b, err := u.get(ctx, fmt.Sprintf("%s/repos/%s/releases/latest", strings.TrimSuffix(api, "/"), Repository))
+	if err != nil {
+		return rel, err
+	}
+	if err := json.Unmarshal(b, &rel); err != nil {
+		return rel, fmt.Errorf("update: unable to decode the release: %v", err)
+	}
+	return rel, nil
+}
+
+// ArchiveName returns whether `name` is the name of a release archive
+// for the running platform. On ARM, the ARMv6 archive is chosen, which
+// runs on every board.
+func ArchiveName(name string) bool {
+	arch := runtime.GOARCH
+	if arch == "arm" {
+		arch = "armv6"
+	}
+	return strings.HasSuffix(name, "_"+runtime.GOOS+"_"+arch+".tar.gz")
+}
+
+// Apply downloads the archive of `rel` for the running platform,
+// verifies it and replaces the Executable with the binary it contains.
+// If the health check of the new binary fails, the previous one is
+// restored. Otherwise it is kept next to the new one, with the `.old`
+// extension, see Rollback.
+func (u *Updater) Apply(ctx context.Context, rel Release) error {
+	if len(u.PublicKey) == 0 {
+		return ErrNoPublicKey
+	}
+	var archive, sums, sig *Asset
+	for i, v := range rel.Assets {
+		switch {
+		case ArchiveName(v.Name):
+			archive = &rel.Assets[i]
+		case strings.HasSuffix(v.Name, "checksums.txt"):
+			sums = &rel.Assets[i]
+		}
+	}
+	if archive == nil {
+		return fmt.Errorf("update: release %s has no archive for %s/%s", rel.Tag, runtime.GOOS, runtime.GOARCH)
+	}
+	if sums == nil {
+		return fmt.Errorf("update: release %s has no checksums", rel.Tag)
+	}
+	for i, v := range rel.Assets {
+		if v.Name == sums.Name+".sig" {
+			sig = &rel.Assets[i]
+		}
+	}
+	if sig == nil {
+		return fmt.Errorf("update: release %s is not signed", rel.Tag)
+	}
+
+	// Verify the checksums first, then the archive.
+	sumsData, err := u.get(ctx, sums.URL)
+	if err != nil {
+		return err
+	}
+	sigData, err := u.get(ctx, sig.URL)
+	if err != nil {
+		return err
+	}
+	s, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sigData)))
+	if err != nil || !ed25519.Verify(u.PublicKey, sumsData, s) {
+		return fmt.Errorf("update: invalid signature of release %s", rel.Tag)
+	}
+	want, err := checksum(sumsData, archive.Name)
+	if err != nil {
+		return err
+	}
+	data, err := u.get(ctx, archive.URL)
+	if err != nil {
+		return err
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != want {
+		return fmt.Errorf("update: checksum mismatch of %s", archive.Name)
+	}
+	bin, err := extract(data, BinaryName)
+	if err != nil {
+		return err
+	}
+
+	exe, err := u.executable()
+	if err != nil {
+		return err
+	}
+	if err := install(exe, bin); err != nil {
+		return err
+	}
+	check := u.Check
+	if check == nil {
+		check = ReportsVersion
+	}
+	if err := check(ctx, exe, rel); err != nil {
+		if rerr := u.Rollback(); rerr != nil {
+			return fmt.Errorf("update: health check failed: %v, and the rollback too: %v", err, rerr)
+		}
+		return fmt.Errorf("update: health check failed, previous binary restored: %v", err)
+	}
+	return nil
+}
+
+// Rollback restores the binary replaced by the last update.
+func (u *Updater) Rollback() error {
+	exe, err := u.executable()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(exe + ".old"); err != nil {
+		return fmt.Errorf("update: no previous binary to restore: %v", err)
+	}
+	return os.Rename(exe+".old", exe)
+}
+
+func (u *Updater) executable() (string, error) {
+	if u.Executable != "" {
+		return u.Executable, nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+func (u *Updater) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := u.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("update: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("update: unable to get %s: %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// checksum returns the checksum of `name` in the checksums file `data`,
+// in the `sha256sum` format.
+func checksum(data []byte, name string) (string, error) {
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 2 && fields[1] == name {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("update: no checksum of %s", name)
+}
+
+// extract returns the content of the file `name` of the gzipped tar
+// archive `data`.
+func extract(data []byte, name string) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("update: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("update: no %s in the archive", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("update: %v", err)
+		}
+		if h.Typeflag == tar.TypeReg && filepath.Base(h.Name) == name {
+			return ioutil.ReadAll(tr)
+		}
+	}
+}
+
+// install replaces `exe` with `bin`, keeping the previous binary with
+// the `.old` extension. The new binary is written next to `exe`, so
+// that the replacement is atomic.
+func install(exe string, bin []byte) error {
+	info, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	tmp := exe + ".new"
+	if err := ioutil.WriteFile(tmp, bin, info.Mode().Perm()|0100); err != nil {
+		return fmt.Errorf("update: %v", err)
+	}
+	if err := os.Rename(exe, exe+".old"); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("update: %v", err)
+	}
+	if err := os.Rename(tmp, exe); err != nil {
+		os.Rename(exe+".old", exe)
+		return fmt.Errorf("update: %v", err)
+	}
+	return nil
+}
+
+// ReportsVersion, the default Check of the Updater, checks that the
+// binary at `path` runs, reporting the version of `rel`.
+func ReportsVersion(ctx context.Context, path string, rel Release) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, path, "version").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s version: %v: %s", path, err, bytes.TrimSpace(out))
+	}
+	if !strings.Contains(string(out), rel.Tag) {
+		return fmt.Errorf("%s version does not report %s: %s", path, rel.Tag, bytes.TrimSpace(out))
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package update_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/booster-proj/booster/update"
+)
+
+const archiveName = "booster_1.0.0_" + runtime.GOOS + "_" + runtime.GOARCH + ".tar.gz"
+
+// release serves a fake GitHub release containing `bin`, whose
+// checksums are signed with `key`.
+func release(t *testing.T, key ed25519.PrivateKey, bin []byte) *httptest.Server {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "booster", Mode: 0755, Size: int64(len(bin)), Typeflag: tar.TypeReg})
+	tw.Write(bin)
+	tw.Close()
+	gz.Close()
+	archive := buf.Bytes()
+
+	sum := sha256.Sum256(archive)
+	sums := []byte(fmt.Sprintf("%x  %s\n", sum, archiveName))
+	files := map[string][]byte{
+		archiveName:           archive,
+		"checksums.txt":       sums,
+		"checksums.txt.sig":   update.Sign(key, sums),
+		"booster_1.0.0.other": nil,
+	}
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	mux.HandleFunc("/repos/"+update.Repository+"/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		rel := update.Release{Tag: "v1.0.0"}
+		for name := range files {
+			rel.Assets = append(rel.Assets, update.Asset{Name: name, URL: srv.URL + "/download/" + name})
+		}
+		json.NewEncoder(w).Encode(rel)
+	})
+	mux.HandleFunc("/download/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(files[filepath.Base(r.URL.Path)])
+	})
+	return srv
+}
+
+func setup(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "booster-update")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exe := filepath.Join(dir, "booster")
+	if err := ioutil.WriteFile(exe, []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return exe, func() { os.RemoveAll(dir) }
+}
+
+func read(t *testing.T, path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestApply(t *testing.T) {
+	if runtime.GOARCH == "arm" {
+		t.Skip("archive name differs on arm")
+	}
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	srv := release(t, priv, []byte("new"))
+	defer srv.Close()
+	exe, teardown := setup(t)
+	defer teardown()
+
+	var checked string
+	u := update.Updater{
+		API:        srv.URL,
+		PublicKey:  pub,
+		Executable: exe,
+		Check: func(ctx context.Context, path string, rel update.Release) error {
+			checked = rel.Tag
+			return nil
+		},
+	}
+	ctx := context.Background()
+	rel, err := u.Latest(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Apply(ctx, rel); err != nil {
+		t.Fatal(err)
+	}
+	if checked != "v1.0.0" {
+		t.Fatalf("Unexpected release checked: %q", checked)
+	}
+	if got := read(t, exe); got != "new" {
+		t.Fatalf("Unexpected binary installed: %q", got)
+	}
+	if got := read(t, exe+".old"); got != "old" {
+		t.Fatalf("Unexpected previous binary: %q", got)
+	}
+
+	if err := u.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, exe); got != "old" {
+		t.Fatalf("Unexpected binary after rollback: %q", got)
+	}
+}
+
+func TestApply_badSignature(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	srv := release(t, other, []byte("new"))
+	defer srv.Close()
+	exe, teardown := setup(t)
+	defer teardown()
+
+	u := update.Updater{API: srv.URL, PublicKey: pub, Executable: exe}
+	ctx := context.Background()
+	rel, err := u.Latest(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Apply(ctx, rel); err == nil {
+		t.Fatal("Expected an error with a release signed by another key")
+	}
+	if got := read(t, exe); got != "old" {
+		t.Fatalf("Binary replaced: %q", got)
+	}
+}
+
+func TestApply_rollback(t *testing.T) {
+	if runtime.GOARCH == "arm" {
+		t.Skip("archive name differs on arm")
+	}
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	srv := release(t, priv, []byte("new"))
+	defer srv.Close()
+	exe, teardown := setup(t)
+	defer teardown()
+
+	u := update.Updater{
+		API:        srv.URL,
+		PublicKey:  pub,
+		Executable: exe,
+		Check: func(ctx context.Context, path string, rel update.Release) error {
+			return errors.New("unhealthy")
+		},
+	}
+	ctx := context.Background()
+	rel, err := u.Latest(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Apply(ctx, rel); err == nil {
+		t.Fatal("Expected an error when the health check fails")
+	}
+	if got := read(t, exe); got != "old" {
+		t.Fatalf("Previous binary not restored: %q", got)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.3", "v1.2.3", 0},
+		{"v1.2.3", "1.2.3+build.5", 0},
+		{"v1.2.3", "v1.10.0", -1},
+		{"v2.0.0", "v1.10.0", 1},
+		{"v1.0.0-rc.1", "v1.0.0", -1},
+		{"v1.0.0-rc.2", "v1.0.0-rc.10", -1},
+		{"v1.0.0-alpha", "v1.0.0-alpha.1", -1},
+		{"v1.0.0-beta", "v1.0.0-alpha.1", 1},
+	}
+	for i, v := range tests {
+		c, err := update.CompareVersions(v.a, v.b)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if c != v.want {
+			t.Fatalf("%d: %s vs %s: wanted %d, found %d", i, v.a, v.b, v.want, c)
+		}
+	}
+	for _, v := range []string{"N/A", "v1.2", "v1.x.0"} {
+		if _, err := update.CompareVersions(v, "v1.0.0"); err == nil {
+			t.Fatalf("%q should not be accepted", v)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package update
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// version is a semantic version, without its build metadata.
+type version struct {
+	core [3]int
+	pre  []string
+}
+
+// parseVersion parses a semantic version, e.g. v1.2.3 or 1.2.3-rc.1.
+func parseVersion(s string) (version, error) {
+	var v version
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		v.pre = strings.Split(s[i+1:], ".")
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("update: %q is not a semantic version", s)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("update: %q is not a semantic version", s)
+		}
+		v.core[i] = n
+	}
+	return v, nil
+}
+
+// CompareVersions compares the semantic versions `a` and `b`, e.g. the
+// tags of two releases, returning -1 if `a` precedes `b`, 1 if it
+// follows it and 0 if they are the same version.
+func CompareVersions(a, b string) (int, error) {
+	va, err := parseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := parseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := range va.core {
+		if c := compareInts(va.core[i], vb.core[i]); c != 0 {
+			return c, nil
+		}
+	}
+	// A pre-release precedes the release.
+	switch {
+	case len(va.pre) == 0 && len(vb.pre) == 0:
+		return 0, nil
+	case len(va.pre) == 0:
+		return 1, nil
+	case len(vb.pre) == 0:
+		return -1, nil
+	}
+	for i := 0; i < len(va.pre) && i < len(vb.pre); i++ {
+		if c := comparePre(va.pre[i], vb.pre[i]); c != 0 {
+			return c, nil
+		}
+	}
+	return compareInts(len(va.pre), len(vb.pre)), nil
+}
+
+// comparePre compares two pre-release identifiers: the numeric ones
+// are compared as numbers, and precede the others.
+func comparePre(a, b string) int {
+	na, erra := strconv.Atoi(a)
+	nb, errb := strconv.Atoi(b)
+	switch {
+	case erra == nil && errb == nil:
+		return compareInts(na, nb)
+	case erra == nil:
+		return -1
+	case errb == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
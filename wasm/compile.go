@@ -0,0 +1,199 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package wasm
+
+import "fmt"
+
+// nullRef is the value of a null reference.
+const nullRef = ^uint64(0)
+
+// Opcodes of the instructions that need to be referenced by name.
+const (
+	opUnreachable  = 0x00
+	opNop          = 0x01
+	opBlock        = 0x02
+	opLoop         = 0x03
+	opIf           = 0x04
+	opElse         = 0x05
+	opEnd          = 0x0b
+	opBr           = 0x0c
+	opBrIf         = 0x0d
+	opBrTable      = 0x0e
+	opReturn       = 0x0f
+	opCall         = 0x10
+	opCallIndirect = 0x11
+	opDrop         = 0x1a
+	opSelect       = 0x1b
+	opSelectT      = 0x1c
+	opLocalGet     = 0x20
+	opLocalSet     = 0x21
+	opLocalTee     = 0x22
+	opGlobalGet    = 0x23
+	opGlobalSet    = 0x24
+	opTableGet     = 0x25
+	opTableSet     = 0x26
+	opMemorySize   = 0x3f
+	opMemoryGrow   = 0x40
+	opI32Const     = 0x41
+	opI64Const     = 0x42
+	opF32Const     = 0x43
+	opF64Const     = 0x44
+	opRefNull      = 0xd0
+	opRefIsNull    = 0xd1
+	opRefFunc      = 0xd2
+	// The instructions with the 0xfc prefix are mapped to
+	// opPrefixFC + their index.
+	opPrefixFC = 0x100
+)
+
+// Instructions with the 0xfc prefix.
+const (
+	opTruncSat     = opPrefixFC + 0
+	opMemoryInit   = opPrefixFC + 8
+	opDataDrop     = opPrefixFC + 9
+	opMemoryCopy   = opPrefixFC + 10
+	opMemoryFill   = opPrefixFC + 11
+	opTableGrow    = opPrefixFC + 15
+	opTableSize    = opPrefixFC + 16
+	opTableFill    = opPrefixFC + 17
+	opTruncSatLast = opPrefixFC + 7
+)
+
+// instr is a decoded instruction.
+type instr struct {
+	op uint16
+	// a is the main immediate: an index, a label depth, a constant
+	// or a memory offset. For blocks, it is the number of parameters
+	// and results, packed.
+	a uint64
+	// For blocks, else is the position of the matching else
+	// instruction, if any, end the one of the end instruction.
+	els, end uint32
+	// labels are the targets of br_table, the default one last.
+	labels []uint32
+}
+
+func (i instr) blockType() (params, results int) {
+	return int(i.a >> 32), int(uint32(i.a))
+}
+
+// compile decodes the body of a function, resolving the position of
+// the end of each block.
+func compile(m *Module, r *reader) []instr {
+	var body []instr
+	var blocks []int
+	for len(r.b) > 0 {
+		in := instr{op: uint16(r.byte())}
+		switch op := in.op; {
+		case op == opBlock || op == opLoop || op == opIf:
+			in.a = blockType(m, r)
+			blocks = append(blocks, len(body))
+		case op == opElse:
+			if len(blocks) == 0 {
+				r.fail("else outside of a block")
+			}
+			body[blocks[len(blocks)-1]].els = uint32(len(body))
+		case op == opEnd:
+			if len(blocks) > 0 {
+				body[blocks[len(blocks)-1]].end = uint32(len(body))
+				blocks = blocks[:len(blocks)-1]
+			} else if len(r.b) > 0 {
+				r.fail("unexpected end of function")
+			}
+		case op == opBr || op == opBrIf:
+			in.a = uint64(r.u32())
+		case op == opBrTable:
+			in.labels = make([]uint32, r.count()+1)
+			for i := range in.labels {
+				in.labels[i] = r.u32()
+			}
+		case op == opCall || op == opRefFunc || (op >= opLocalGet && op <= opTableSet):
+			in.a = uint64(r.u32())
+		case op == opCallIndirect:
+			in.a = uint64(r.u32())
+			in.end = r.u32() // table
+		case op == opSelectT:
+			r.valTypes()
+			in.op = opSelect
+		case op >= 0x28 && op <= 0x3e: // loads and stores
+			r.u32() // alignment
+			in.a = uint64(r.u32())
+		case op == opMemorySize || op == opMemoryGrow:
+			r.byte()
+		case op == opI32Const:
+			in.a = uint64(uint32(r.sleb(32)))
+		case op == opI64Const:
+			in.a = uint64(r.sleb(64))
+		case op == opF32Const:
+			in.a = uint64(le32(r.bytes(4)))
+		case op == opF64Const:
+			in.a = le64(r.bytes(8))
+		case op == opRefNull:
+			r.byte()
+		case op == 0xfc:
+			in.op = uint16(opPrefixFC + r.u32())
+			switch in.op {
+			case opMemoryInit:
+				in.a = uint64(r.u32())
+				r.byte()
+			case opDataDrop:
+				in.a = uint64(r.u32())
+			case opMemoryCopy:
+				r.byte()
+				r.byte()
+			case opMemoryFill:
+				r.byte()
+			case opTableGrow, opTableSize, opTableFill:
+				in.a = uint64(r.u32())
+			default:
+				if in.op > opTruncSatLast {
+					r.fail(fmt.Sprintf("unsupported instruction 0xfc %d", in.op-opPrefixFC))
+				}
+			}
+		case op == opUnreachable || op == opNop || op == opReturn || op == opDrop ||
+			op == opSelect || op == opRefIsNull || (op >= 0x45 && op <= 0xc4):
+		default:
+			r.fail(fmt.Sprintf("unsupported instruction %#x", op))
+		}
+		body = append(body, in)
+	}
+	if len(blocks) > 0 || len(body) == 0 || body[len(body)-1].op != opEnd {
+		r.fail("unterminated function")
+	}
+	return body
+}
+
+// blockType reads the type of a block, returning the number of its
+// parameters and results packed.
+func blockType(m *Module, r *reader) uint64 {
+	if len(r.b) == 0 {
+		r.fail("unexpected end")
+	}
+	if r.b[0] == 0x40 {
+		r.byte()
+		return 0
+	}
+	if t := ValType(r.b[0]); t == I32 || t == I64 || t == F32 || t == F64 || t == FuncRef || t == ExternRef {
+		r.byte()
+		return 1
+	}
+	idx := r.sleb(33)
+	if idx < 0 || int(idx) >= len(m.types) {
+		r.fail("invalid block type")
+	}
+	t := m.types[idx]
+	return uint64(len(t.Params))<<32 | uint64(len(t.Results))
+}
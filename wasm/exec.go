@@ -0,0 +1,567 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package wasm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// PageSize is the size of a page of linear memory.
+const PageSize = 65536
+
+// MaxPages is the maximum number of pages of memory an instance can
+// allocate, regardless of the limits declared by its module.
+const MaxPages = 4096
+
+// maxDepth is the maximum depth of the call stack.
+const maxDepth = 1024
+
+// HostFunc is a function provided by the host to the module.
+type HostFunc struct {
+	Type FuncType
+	// Func is called with the arguments of the call, and returns its
+	// results. If it returns an error, the execution is aborted.
+	Func func(in *Instance, args []uint64) ([]uint64, error)
+}
+
+// Imports are the host functions provided to a module, by module
+// name and function name.
+type Imports map[string]map[string]HostFunc
+
+// Trap is the error returned when the execution is aborted.
+type Trap struct {
+	Msg string
+	// Err is the error returned by the host function that caused
+	// the trap, if any.
+	Err error
+}
+
+func (t *Trap) Error() string {
+	if t.Err != nil {
+		return "wasm: trap: " + t.Err.Error()
+	}
+	return "wasm: trap: " + t.Msg
+}
+
+func (t *Trap) Unwrap() error {
+	return t.Err
+}
+
+func trap(format string, args ...interface{}) {
+	panic(&Trap{Msg: fmt.Sprintf(format, args...)})
+}
+
+// ErrFuelExhausted is the error of the trap raised when a call
+// executes more instructions than allowed by Fuel.
+var ErrFuelExhausted = errors.New("fuel exhausted")
+
+type function struct {
+	typ    FuncType
+	host   *HostFunc
+	locals int
+	body   []instr
+}
+
+// Instance is an instantiated module. It is not safe for concurrent
+// use.
+type Instance struct {
+	// Fuel is the maximum number of instructions executed by each
+	// call. If zero, the execution is not limited.
+	Fuel int64
+
+	module  *Module
+	funcs   []*function
+	mem     []byte
+	maxMem  uint32
+	globals []uint64
+	table   []uint64
+	maxTab  uint32
+	datas   [][]byte
+	elems   [][]uint64
+
+	fuel  int64
+	depth int
+}
+
+// Instantiate instantiates `m`, resolving its imports with `imports`,
+// and runs its start function, if any.
+func Instantiate(m *Module, imports Imports) (in *Instance, err error) {
+	in = &Instance{module: m}
+	for _, imp := range m.imports {
+		if imp.Kind != KindFunc {
+			return nil, fmt.Errorf("wasm: unsupported import %s.%s: only functions can be imported", imp.Module, imp.Name)
+		}
+		h, ok := imports[imp.Module][imp.Name]
+		if !ok {
+			return nil, fmt.Errorf("wasm: unresolved import %s.%s", imp.Module, imp.Name)
+		}
+		if t := m.types[imp.Type]; !t.Equal(h.Type) {
+			return nil, fmt.Errorf("wasm: import %s.%s has type %v, host function %v", imp.Module, imp.Name, t, h.Type)
+		}
+		host := h
+		in.funcs = append(in.funcs, &function{typ: h.Type, host: &host})
+	}
+	for i, t := range m.funcs {
+		in.funcs = append(in.funcs, &function{
+			typ:    m.types[t],
+			locals: len(m.codes[i].locals),
+			body:   m.codes[i].body,
+		})
+	}
+
+	if len(m.mems) > 1 || len(m.tables) > 1 {
+		return nil, fmt.Errorf("wasm: multiple memories or tables are not supported")
+	}
+	if len(m.mems) == 1 {
+		l := m.mems[0]
+		in.maxMem = MaxPages
+		if l.hasMax && l.max < in.maxMem {
+			in.maxMem = l.max
+		}
+		if l.min > in.maxMem {
+			return nil, fmt.Errorf("wasm: module requires %d pages of memory, limit is %d", l.min, in.maxMem)
+		}
+		in.mem = make([]byte, int(l.min)*PageSize)
+	}
+	if len(m.tables) == 1 {
+		l := m.tables[0]
+		in.maxTab = ^uint32(0)
+		if l.hasMax {
+			in.maxTab = l.max
+		}
+		in.table = make([]uint64, l.min)
+		for i := range in.table {
+			in.table[i] = nullRef
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			t, ok := r.(*Trap)
+			if !ok {
+				t = &Trap{Msg: fmt.Sprint(r)}
+			}
+			in, err = nil, t
+		}
+	}()
+
+	in.globals = make([]uint64, len(m.globals))
+	for i, g := range m.globals {
+		in.globals[i] = in.eval(g.init)
+	}
+	in.elems = make([][]uint64, len(m.elems))
+	for i, s := range m.elems {
+		if s.mode == modePassive {
+			in.elems[i] = s.funcs
+		}
+		if s.mode != modeActive {
+			continue
+		}
+		off := uint64(uint32(in.eval(s.offset)))
+		if s.table != 0 || off+uint64(len(s.funcs)) > uint64(len(in.table)) {
+			trap("element segment %d out of bounds", i)
+		}
+		copy(in.table[off:], s.funcs)
+	}
+	in.datas = make([][]byte, len(m.datas))
+	for i, s := range m.datas {
+		if s.mode == modePassive {
+			in.datas[i] = s.init
+			continue
+		}
+		off := uint64(uint32(in.eval(s.offset)))
+		if off+uint64(len(s.init)) > uint64(len(in.mem)) {
+			trap("data segment %d out of bounds", i)
+		}
+		copy(in.mem[off:], s.init)
+	}
+	if m.start >= 0 {
+		in.fuel = in.Fuel
+		in.call(in.function(uint32(m.start)), nil)
+	}
+	return in, nil
+}
+
+func (in *Instance) eval(e constExpr) uint64 {
+	if e.op == opGlobalGet {
+		if e.val >= uint64(len(in.globals)) {
+			trap("invalid global %d", e.val)
+		}
+		return in.globals[e.val]
+	}
+	return e.val
+}
+
+func (in *Instance) function(idx uint32) *function {
+	if int(idx) >= len(in.funcs) {
+		trap("invalid function %d", idx)
+	}
+	return in.funcs[idx]
+}
+
+// Memory returns the linear memory of the instance. The slice is no
+// longer valid after the memory grows.
+func (in *Instance) Memory() []byte {
+	return in.mem
+}
+
+// Call calls the function exported as `name` with `args`, returning
+// its results. The i32 and i64 values are passed as they are, the
+// floating point ones using their IEEE 754 binary representation.
+func (in *Instance) Call(name string, args ...uint64) (results []uint64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			t, ok := r.(*Trap)
+			if !ok {
+				// Invalid code, e.g. out of bounds accesses
+				// to the stack.
+				t = &Trap{Msg: fmt.Sprint(r)}
+			}
+			results, err = nil, t
+		}
+	}()
+
+	var f *function
+	for _, e := range in.module.exports {
+		if e.Name == name && e.Kind == KindFunc {
+			f = in.function(e.Index)
+		}
+	}
+	if f == nil {
+		return nil, fmt.Errorf("wasm: function %q is not exported", name)
+	}
+	if len(args) != len(f.typ.Params) {
+		return nil, fmt.Errorf("wasm: function %q requires %d arguments", name, len(f.typ.Params))
+	}
+
+	in.fuel = in.Fuel
+	return in.call(f, args), nil
+}
+
+// Exported reports whether the module exports a function named
+// `name`.
+func (in *Instance) Exported(name string) bool {
+	_, ok := in.module.FuncType(name)
+	return ok
+}
+
+type label struct {
+	height int
+	arity  int
+	cont   int
+	loop   bool
+}
+
+func (in *Instance) call(f *function, args []uint64) []uint64 {
+	if f.host != nil {
+		results, err := f.host.Func(in, args)
+		if err != nil {
+			panic(&Trap{Err: err})
+		}
+		if len(results) != len(f.typ.Results) {
+			trap("host function returned %d results, wanted %d", len(results), len(f.typ.Results))
+		}
+		return results
+	}
+
+	in.depth++
+	if in.depth > maxDepth {
+		trap("call stack exhausted")
+	}
+	defer func() { in.depth-- }()
+
+	locals := make([]uint64, len(f.typ.Params)+f.locals)
+	copy(locals, args)
+	st := make([]uint64, 0, 16)
+	labels := []label{{arity: len(f.typ.Results), cont: len(f.body)}}
+	body := f.body
+
+	pop := func() uint64 {
+		v := st[len(st)-1]
+		st = st[:len(st)-1]
+		return v
+	}
+	var pc int
+	branch := func(depth uint64) {
+		l := labels[len(labels)-1-int(depth)]
+		copy(st[l.height:], st[len(st)-l.arity:])
+		st = st[:l.height+l.arity]
+		if l.loop {
+			labels = labels[:len(labels)-int(depth)]
+		} else {
+			labels = labels[:len(labels)-1-int(depth)]
+		}
+		pc = l.cont
+	}
+
+	for pc < len(body) {
+		if in.Fuel > 0 {
+			if in.fuel--; in.fuel < 0 {
+				panic(&Trap{Err: ErrFuelExhausted})
+			}
+		}
+		ins := &body[pc]
+		switch ins.op {
+		case opUnreachable:
+			trap("unreachable")
+		case opNop:
+		case opBlock:
+			params, results := ins.blockType()
+			labels = append(labels, label{height: len(st) - params, arity: results, cont: int(ins.end) + 1})
+		case opLoop:
+			params, _ := ins.blockType()
+			labels = append(labels, label{height: len(st) - params, arity: params, cont: pc + 1, loop: true})
+		case opIf:
+			params, results := ins.blockType()
+			l := label{height: len(st) - params - 1, arity: results, cont: int(ins.end) + 1}
+			if pop() != 0 {
+				labels = append(labels, l)
+			} else if ins.els != 0 {
+				labels = append(labels, l)
+				pc = int(ins.els)
+			} else {
+				pc = int(ins.end) + 1
+				continue
+			}
+		case opElse:
+			// End of the then branch.
+			pc = labels[len(labels)-1].cont
+			labels = labels[:len(labels)-1]
+			continue
+		case opEnd:
+			labels = labels[:len(labels)-1]
+		case opBr:
+			branch(ins.a)
+			continue
+		case opBrIf:
+			if pop() != 0 {
+				branch(ins.a)
+				continue
+			}
+		case opBrTable:
+			i := uint32(pop())
+			if int(i) >= len(ins.labels)-1 {
+				i = uint32(len(ins.labels) - 1)
+			}
+			branch(uint64(ins.labels[i]))
+			continue
+		case opReturn:
+			branch(uint64(len(labels) - 1))
+			continue
+		case opCall:
+			g := in.function(uint32(ins.a))
+			n := len(g.typ.Params)
+			results := in.call(g, st[len(st)-n:])
+			st = append(st[:len(st)-n], results...)
+		case opCallIndirect:
+			i := uint32(pop())
+			if int(i) >= len(in.table) {
+				trap("undefined element %d", i)
+			}
+			ref := in.table[i]
+			if ref == nullRef {
+				trap("uninitialized element %d", i)
+			}
+			g := in.function(uint32(ref))
+			if !g.typ.Equal(in.module.types[ins.a]) {
+				trap("indirect call type mismatch")
+			}
+			n := len(g.typ.Params)
+			results := in.call(g, st[len(st)-n:])
+			st = append(st[:len(st)-n], results...)
+		case opDrop:
+			pop()
+		case opSelect:
+			c, b, a := pop(), pop(), pop()
+			if c != 0 {
+				st = append(st, a)
+			} else {
+				st = append(st, b)
+			}
+		case opLocalGet:
+			st = append(st, locals[ins.a])
+		case opLocalSet:
+			locals[ins.a] = pop()
+		case opLocalTee:
+			locals[ins.a] = st[len(st)-1]
+		case opGlobalGet:
+			st = append(st, in.globals[ins.a])
+		case opGlobalSet:
+			in.globals[ins.a] = pop()
+		case opTableGet:
+			i := uint32(pop())
+			if int(i) >= len(in.table) {
+				trap("table access out of bounds")
+			}
+			st = append(st, in.table[i])
+		case opTableSet:
+			v, i := pop(), uint32(pop())
+			if int(i) >= len(in.table) {
+				trap("table access out of bounds")
+			}
+			in.table[i] = v
+		case opMemorySize:
+			st = append(st, uint64(len(in.mem)/PageSize))
+		case opMemoryGrow:
+			st = append(st, uint64(in.grow(uint32(pop()))))
+		case opI32Const, opI64Const, opF32Const, opF64Const, opRefFunc:
+			st = append(st, ins.a)
+		case opRefNull:
+			st = append(st, nullRef)
+		case opRefIsNull:
+			st = append(st, b2u(pop() == nullRef))
+		case opMemoryInit:
+			n, src, dst := uint64(uint32(pop())), uint64(uint32(pop())), uint64(uint32(pop()))
+			data := in.datas[ins.a]
+			if src+n > uint64(len(data)) || dst+n > uint64(len(in.mem)) {
+				trap("memory access out of bounds")
+			}
+			copy(in.mem[dst:], data[src:src+n])
+		case opDataDrop:
+			in.datas[ins.a] = nil
+		case opMemoryCopy:
+			n, src, dst := uint64(uint32(pop())), uint64(uint32(pop())), uint64(uint32(pop()))
+			if src+n > uint64(len(in.mem)) || dst+n > uint64(len(in.mem)) {
+				trap("memory access out of bounds")
+			}
+			copy(in.mem[dst:], in.mem[src:src+n])
+		case opMemoryFill:
+			n, v, dst := uint64(uint32(pop())), byte(pop()), uint64(uint32(pop()))
+			if dst+n > uint64(len(in.mem)) {
+				trap("memory access out of bounds")
+			}
+			for i := dst; i < dst+n; i++ {
+				in.mem[i] = v
+			}
+		case opTableSize:
+			st = append(st, uint64(len(in.table)))
+		case opTableGrow:
+			n, v := uint32(pop()), pop()
+			old := len(in.table)
+			if uint64(old)+uint64(n) > uint64(in.maxTab) {
+				st = append(st, uint64(^uint32(0)))
+				break
+			}
+			for i := uint32(0); i < n; i++ {
+				in.table = append(in.table, v)
+			}
+			st = append(st, uint64(old))
+		case opTableFill:
+			n, v, i := uint64(uint32(pop())), pop(), uint64(uint32(pop()))
+			if i+n > uint64(len(in.table)) {
+				trap("table access out of bounds")
+			}
+			for j := i; j < i+n; j++ {
+				in.table[j] = v
+			}
+		default:
+			if ins.op >= 0x28 && ins.op <= 0x3e {
+				st = in.memory(ins, st)
+			} else {
+				st = numeric(ins.op, st)
+			}
+		}
+		pc++
+	}
+	return st[len(st)-len(f.typ.Results):]
+}
+
+// grow grows the memory by `n` pages, returning the previous size, or
+// -1 if it is not possible.
+func (in *Instance) grow(n uint32) uint32 {
+	old := uint32(len(in.mem) / PageSize)
+	if uint64(old)+uint64(n) > uint64(in.maxMem) {
+		return ^uint32(0)
+	}
+	mem := make([]byte, (int(old)+int(n))*PageSize)
+	copy(mem, in.mem)
+	in.mem = mem
+	return old
+}
+
+// memory executes the load or store instruction `ins`.
+func (in *Instance) memory(ins *instr, st []uint64) []uint64 {
+	var size uint64
+	switch ins.op {
+	case 0x29, 0x2b, 0x37, 0x39:
+		size = 8
+	case 0x28, 0x2a, 0x34, 0x35, 0x36, 0x38, 0x3e:
+		size = 4
+	case 0x2e, 0x2f, 0x32, 0x33, 0x3b, 0x3d:
+		size = 2
+	default:
+		size = 1
+	}
+
+	if ins.op >= 0x36 { // store
+		v := st[len(st)-1]
+		addr := uint64(uint32(st[len(st)-2])) + ins.a
+		st = st[:len(st)-2]
+		if addr+size > uint64(len(in.mem)) {
+			trap("memory access out of bounds")
+		}
+		b := in.mem[addr:]
+		switch size {
+		case 8:
+			binary.LittleEndian.PutUint64(b, v)
+		case 4:
+			binary.LittleEndian.PutUint32(b, uint32(v))
+		case 2:
+			binary.LittleEndian.PutUint16(b, uint16(v))
+		default:
+			b[0] = byte(v)
+		}
+		return st
+	}
+
+	addr := uint64(uint32(st[len(st)-1])) + ins.a
+	if addr+size > uint64(len(in.mem)) {
+		trap("memory access out of bounds")
+	}
+	b := in.mem[addr:]
+	var v uint64
+	switch ins.op {
+	case 0x28, 0x2a, 0x35: // i32.load, f32.load, i64.load32_u
+		v = uint64(binary.LittleEndian.Uint32(b))
+	case 0x29, 0x2b: // i64.load, f64.load
+		v = binary.LittleEndian.Uint64(b)
+	case 0x2c: // i32.load8_s
+		v = uint64(uint32(int32(int8(b[0]))))
+	case 0x2d, 0x31: // i32.load8_u, i64.load8_u
+		v = uint64(b[0])
+	case 0x2e: // i32.load16_s
+		v = uint64(uint32(int32(int16(binary.LittleEndian.Uint16(b)))))
+	case 0x2f, 0x33: // i32.load16_u, i64.load16_u
+		v = uint64(binary.LittleEndian.Uint16(b))
+	case 0x30: // i64.load8_s
+		v = uint64(int64(int8(b[0])))
+	case 0x32: // i64.load16_s
+		v = uint64(int64(int16(binary.LittleEndian.Uint16(b))))
+	case 0x34: // i64.load32_s
+		v = uint64(int64(int32(binary.LittleEndian.Uint32(b))))
+	}
+	st[len(st)-1] = v
+	return st
+}
+
+func b2u(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
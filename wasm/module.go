@@ -0,0 +1,545 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package wasm implements a small WebAssembly interpreter, enough to
+// run the plugins compiled by the common toolchains: it supports the
+// MVP instruction set together with the sign extension, non-trapping
+// conversion, multi value, bulk memory and reference types proposals.
+// Modules are not validated before being run: executing invalid code
+// results in a trap.
+package wasm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ValType is the type of a WebAssembly value.
+type ValType byte
+
+// Value types.
+const (
+	I32       ValType = 0x7f
+	I64       ValType = 0x7e
+	F32       ValType = 0x7d
+	F64       ValType = 0x7c
+	FuncRef   ValType = 0x70
+	ExternRef ValType = 0x6f
+)
+
+func (t ValType) String() string {
+	switch t {
+	case I32:
+		return "i32"
+	case I64:
+		return "i64"
+	case F32:
+		return "f32"
+	case F64:
+		return "f64"
+	case FuncRef:
+		return "funcref"
+	case ExternRef:
+		return "externref"
+	default:
+		return fmt.Sprintf("type(%#x)", byte(t))
+	}
+}
+
+// FuncType is the signature of a function.
+type FuncType struct {
+	Params  []ValType
+	Results []ValType
+}
+
+// Equal reports whether `t` and `o` are the same signature.
+func (t FuncType) Equal(o FuncType) bool {
+	return bytes.Equal(valTypes(t.Params), valTypes(o.Params)) && bytes.Equal(valTypes(t.Results), valTypes(o.Results))
+}
+
+func (t FuncType) String() string {
+	return fmt.Sprintf("%v -> %v", t.Params, t.Results)
+}
+
+func valTypes(l []ValType) []byte {
+	b := make([]byte, len(l))
+	for i, v := range l {
+		b[i] = byte(v)
+	}
+	return b
+}
+
+// External kinds, of imports and exports.
+const (
+	KindFunc   byte = 0
+	KindTable  byte = 1
+	KindMemory byte = 2
+	KindGlobal byte = 3
+)
+
+// Import is an entity that the module requires to be provided by
+// the host.
+type Import struct {
+	Module string
+	Name   string
+	Kind   byte
+	// Type is the index of the signature of imported functions.
+	Type uint32
+}
+
+// Export is an entity that the module provides to the host.
+type Export struct {
+	Name  string
+	Kind  byte
+	Index uint32
+}
+
+type limits struct {
+	min    uint32
+	max    uint32
+	hasMax bool
+}
+
+type global struct {
+	typ     ValType
+	mutable bool
+	init    constExpr
+}
+
+// constExpr is an initializer expression.
+type constExpr struct {
+	op  byte
+	val uint64
+}
+
+type elemSegment struct {
+	mode   byte
+	table  uint32
+	offset constExpr
+	// funcs are the function indices, or nullRef.
+	funcs []uint64
+}
+
+type dataSegment struct {
+	mode   byte
+	offset constExpr
+	init   []byte
+}
+
+// Segment modes.
+const (
+	modeActive byte = iota
+	modePassive
+	modeDeclarative
+)
+
+type code struct {
+	locals []ValType
+	body   []instr
+}
+
+// Module is a decoded WebAssembly module, ready to be instantiated.
+type Module struct {
+	types   []FuncType
+	imports []Import
+	funcs   []uint32
+	tables  []limits
+	mems    []limits
+	globals []global
+	exports []Export
+	start   int64
+	elems   []elemSegment
+	codes   []code
+	datas   []dataSegment
+}
+
+// Imports returns the entities imported by the module.
+func (m *Module) Imports() []Import {
+	return m.imports
+}
+
+// Exports returns the entities exported by the module.
+func (m *Module) Exports() []Export {
+	return m.exports
+}
+
+// FuncType returns the signature of the function exported as `name`.
+func (m *Module) FuncType(name string) (FuncType, bool) {
+	for _, e := range m.exports {
+		if e.Name != name || e.Kind != KindFunc {
+			continue
+		}
+		idx := e.Index
+		for _, imp := range m.imports {
+			if imp.Kind != KindFunc {
+				continue
+			}
+			if idx == 0 {
+				return m.types[imp.Type], true
+			}
+			idx--
+		}
+		if int(idx) < len(m.funcs) {
+			return m.types[m.funcs[idx]], true
+		}
+	}
+	return FuncType{}, false
+}
+
+// importedFuncs returns the number of functions imported.
+func (m *Module) importedFuncs() int {
+	n := 0
+	for _, imp := range m.imports {
+		if imp.Kind == KindFunc {
+			n++
+		}
+	}
+	return n
+}
+
+// ErrNotWasm is returned when decoding something that is not a
+// WebAssembly binary module.
+var ErrNotWasm = errors.New("wasm: not a WebAssembly module")
+
+// Decode decodes the binary module `b`.
+func Decode(b []byte) (m *Module, err error) {
+	if len(b) < 8 || string(b[:4]) != "\x00asm" {
+		return nil, ErrNotWasm
+	}
+	if v := b[4:8]; v[0] != 1 || v[1] != 0 || v[2] != 0 || v[3] != 0 {
+		return nil, fmt.Errorf("wasm: unsupported version %v", v)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(decodeError)
+			if !ok {
+				panic(r)
+			}
+			m, err = nil, e
+		}
+	}()
+
+	m = &Module{start: -1}
+	r := &reader{b: b[8:]}
+	for len(r.b) > 0 {
+		id := r.byte()
+		s := &reader{b: r.bytes(int(r.u32()))}
+		switch id {
+		case 0: // custom
+		case 1:
+			m.types = make([]FuncType, s.count())
+			for i := range m.types {
+				if s.byte() != 0x60 {
+					s.fail("invalid function type")
+				}
+				m.types[i] = FuncType{Params: s.valTypes(), Results: s.valTypes()}
+			}
+		case 2:
+			m.imports = make([]Import, s.count())
+			for i := range m.imports {
+				imp := Import{Module: s.name(), Name: s.name(), Kind: s.byte()}
+				switch imp.Kind {
+				case KindFunc:
+					imp.Type = s.u32()
+					if int(imp.Type) >= len(m.types) {
+						s.fail("invalid type index")
+					}
+				case KindTable:
+					s.byte()
+					s.limits()
+				case KindMemory:
+					s.limits()
+				case KindGlobal:
+					s.byte()
+					s.byte()
+				default:
+					s.fail("invalid import kind")
+				}
+				m.imports[i] = imp
+			}
+		case 3:
+			m.funcs = make([]uint32, s.count())
+			for i := range m.funcs {
+				m.funcs[i] = s.u32()
+				if int(m.funcs[i]) >= len(m.types) {
+					s.fail("invalid type index")
+				}
+			}
+		case 4:
+			m.tables = make([]limits, s.count())
+			for i := range m.tables {
+				s.byte()
+				m.tables[i] = s.limits()
+			}
+		case 5:
+			m.mems = make([]limits, s.count())
+			for i := range m.mems {
+				m.mems[i] = s.limits()
+			}
+		case 6:
+			m.globals = make([]global, s.count())
+			for i := range m.globals {
+				m.globals[i] = global{typ: ValType(s.byte()), mutable: s.byte() == 1, init: s.constExpr()}
+			}
+		case 7:
+			m.exports = make([]Export, s.count())
+			for i := range m.exports {
+				m.exports[i] = Export{Name: s.name(), Kind: s.byte(), Index: s.u32()}
+				// The function section precedes the export one.
+				if e := m.exports[i]; e.Kind == KindFunc && int(e.Index) >= m.importedFuncs()+len(m.funcs) {
+					s.fail("invalid function index")
+				}
+			}
+		case 8:
+			m.start = int64(s.u32())
+		case 9:
+			m.elems = make([]elemSegment, s.count())
+			for i := range m.elems {
+				m.elems[i] = s.elemSegment()
+			}
+		case 10:
+			m.codes = make([]code, s.count())
+			if len(m.codes) != len(m.funcs) {
+				s.fail("function and code sections have different lengths")
+			}
+			for i := range m.codes {
+				body := &reader{b: s.bytes(int(s.u32()))}
+				var locals []ValType
+				for n := body.u32(); n > 0; n-- {
+					count, typ := body.u32(), ValType(body.byte())
+					if uint64(len(locals))+uint64(count) > math.MaxUint16 {
+						body.fail("too many locals")
+					}
+					for j := uint32(0); j < count; j++ {
+						locals = append(locals, typ)
+					}
+				}
+				m.codes[i] = code{locals: locals, body: compile(m, body)}
+			}
+		case 11:
+			m.datas = make([]dataSegment, s.count())
+			for i := range m.datas {
+				m.datas[i] = s.dataSegment()
+			}
+		case 12: // data count
+		default:
+			r.fail(fmt.Sprintf("invalid section %d", id))
+		}
+	}
+	if len(m.codes) != len(m.funcs) {
+		return nil, fmt.Errorf("wasm: missing code section")
+	}
+	return m, nil
+}
+
+type decodeError string
+
+func (e decodeError) Error() string {
+	return "wasm: " + string(e)
+}
+
+// reader decodes the values of a binary module. It panics with a
+// decodeError when the data is not valid.
+type reader struct {
+	b []byte
+}
+
+func (r *reader) fail(msg string) {
+	panic(decodeError(msg))
+}
+
+func (r *reader) byte() byte {
+	if len(r.b) == 0 {
+		r.fail("unexpected end")
+	}
+	c := r.b[0]
+	r.b = r.b[1:]
+	return c
+}
+
+func (r *reader) bytes(n int) []byte {
+	if n < 0 || n > len(r.b) {
+		r.fail("unexpected end")
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+// uleb reads an unsigned LEB128 integer of at most `bits` bits.
+func (r *reader) uleb(bits uint) uint64 {
+	var v uint64
+	for shift := uint(0); ; shift += 7 {
+		if shift >= bits {
+			r.fail("integer too large")
+		}
+		c := r.byte()
+		v |= uint64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return v
+		}
+	}
+}
+
+// sleb reads a signed LEB128 integer of at most `bits` bits.
+func (r *reader) sleb(bits uint) int64 {
+	var v int64
+	var shift uint
+	for {
+		if shift >= bits {
+			r.fail("integer too large")
+		}
+		c := r.byte()
+		v |= int64(c&0x7f) << shift
+		shift += 7
+		if c&0x80 == 0 {
+			if shift < 64 && c&0x40 != 0 {
+				v |= -1 << shift
+			}
+			return v
+		}
+	}
+}
+
+func (r *reader) u32() uint32 {
+	return uint32(r.uleb(32))
+}
+
+// count reads the length of a vector. Every entry takes at least one
+// byte, so a length larger than what is left is rejected before the
+// vector is allocated.
+func (r *reader) count() int {
+	n := r.u32()
+	if uint64(n) > uint64(len(r.b)) {
+		r.fail("vector length out of bounds")
+	}
+	return int(n)
+}
+
+func (r *reader) name() string {
+	return string(r.bytes(int(r.u32())))
+}
+
+func (r *reader) valTypes() []ValType {
+	l := make([]ValType, r.count())
+	for i := range l {
+		l[i] = ValType(r.byte())
+	}
+	return l
+}
+
+func (r *reader) limits() limits {
+	switch r.byte() {
+	case 0:
+		return limits{min: r.u32()}
+	case 1:
+		return limits{min: r.u32(), max: r.u32(), hasMax: true}
+	default:
+		r.fail("invalid limits")
+		return limits{}
+	}
+}
+
+func (r *reader) constExpr() constExpr {
+	var e constExpr
+	e.op = r.byte()
+	switch e.op {
+	case 0x41: // i32.const
+		e.val = uint64(uint32(r.sleb(32)))
+	case 0x42: // i64.const
+		e.val = uint64(r.sleb(64))
+	case 0x43: // f32.const
+		e.val = uint64(le32(r.bytes(4)))
+	case 0x44: // f64.const
+		e.val = le64(r.bytes(8))
+	case 0x23: // global.get
+		e.val = uint64(r.u32())
+	case 0xd0: // ref.null
+		r.byte()
+		e.val = nullRef
+	case 0xd2: // ref.func
+		e.val = uint64(r.u32())
+	default:
+		r.fail(fmt.Sprintf("unsupported constant expression %#x", e.op))
+	}
+	if r.byte() != 0x0b {
+		r.fail("unsupported constant expression")
+	}
+	return e
+}
+
+func (r *reader) elemSegment() elemSegment {
+	var s elemSegment
+	flags := r.u32()
+	if flags > 7 {
+		r.fail("invalid element segment")
+	}
+	switch {
+	case flags&1 == 0:
+		s.mode = modeActive
+	case flags&2 == 0:
+		s.mode = modePassive
+	default:
+		s.mode = modeDeclarative
+	}
+	if flags&1 == 0 {
+		if flags&2 != 0 {
+			s.table = r.u32()
+		}
+		s.offset = r.constExpr()
+	}
+	if flags&3 != 0 {
+		r.byte() // element kind, or reference type
+	}
+	s.funcs = make([]uint64, r.count())
+	for i := range s.funcs {
+		if flags&4 == 0 {
+			s.funcs[i] = uint64(r.u32())
+		} else {
+			s.funcs[i] = r.constExpr().val
+		}
+	}
+	return s
+}
+
+func (r *reader) dataSegment() dataSegment {
+	var s dataSegment
+	switch r.u32() {
+	case 0:
+		s.offset = r.constExpr()
+	case 1:
+		s.mode = modePassive
+	case 2:
+		if r.u32() != 0 {
+			r.fail("invalid memory index")
+		}
+		s.offset = r.constExpr()
+	default:
+		r.fail("invalid data segment")
+	}
+	s.init = r.bytes(int(r.u32()))
+	return s
+}
+
+func le32(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
+
+func le64(b []byte) uint64 {
+	return uint64(le32(b)) | uint64(le32(b[4:]))<<32
+}
@@ -0,0 +1,475 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package wasm
+
+import (
+	"math"
+	"math/bits"
+)
+
+// numeric executes the numeric instruction `op` on the stack `st`.
+func numeric(op uint16, st []uint64) []uint64 {
+	switch {
+	case op == 0x45: // i32.eqz
+		st[len(st)-1] = b2u(uint32(st[len(st)-1]) == 0)
+		return st
+	case op == 0x50: // i64.eqz
+		st[len(st)-1] = b2u(st[len(st)-1] == 0)
+		return st
+	case op >= 0x46 && op <= 0x4f:
+		a, b := uint32(st[len(st)-2]), uint32(st[len(st)-1])
+		return append(st[:len(st)-2], b2u(cmpInt(op-0x46, uint64(a), uint64(b), int64(int32(a)), int64(int32(b)))))
+	case op >= 0x51 && op <= 0x5a:
+		a, b := st[len(st)-2], st[len(st)-1]
+		return append(st[:len(st)-2], b2u(cmpInt(op-0x51, a, b, int64(a), int64(b))))
+	case op >= 0x5b && op <= 0x60:
+		a, b := f32(st[len(st)-2]), f32(st[len(st)-1])
+		return append(st[:len(st)-2], b2u(cmpFloat(op-0x5b, float64(a), float64(b))))
+	case op >= 0x61 && op <= 0x66:
+		a, b := f64(st[len(st)-2]), f64(st[len(st)-1])
+		return append(st[:len(st)-2], b2u(cmpFloat(op-0x61, a, b)))
+	case op >= 0x67 && op <= 0x69:
+		a := uint32(st[len(st)-1])
+		var v int
+		switch op {
+		case 0x67:
+			v = bits.LeadingZeros32(a)
+		case 0x68:
+			v = bits.TrailingZeros32(a)
+		default:
+			v = bits.OnesCount32(a)
+		}
+		st[len(st)-1] = uint64(v)
+		return st
+	case op >= 0x6a && op <= 0x78:
+		a, b := uint32(st[len(st)-2]), uint32(st[len(st)-1])
+		return append(st[:len(st)-2], uint64(i32Binary(op, a, b)))
+	case op >= 0x79 && op <= 0x7b:
+		a := st[len(st)-1]
+		var v int
+		switch op {
+		case 0x79:
+			v = bits.LeadingZeros64(a)
+		case 0x7a:
+			v = bits.TrailingZeros64(a)
+		default:
+			v = bits.OnesCount64(a)
+		}
+		st[len(st)-1] = uint64(v)
+		return st
+	case op >= 0x7c && op <= 0x8a:
+		a, b := st[len(st)-2], st[len(st)-1]
+		return append(st[:len(st)-2], i64Binary(op, a, b))
+	case op == 0x8b: // f32.abs
+		st[len(st)-1] &^= 1 << 31
+		return st
+	case op == 0x8c: // f32.neg
+		st[len(st)-1] ^= 1 << 31
+		return st
+	case op == 0x98: // f32.copysign
+		a, b := st[len(st)-2], st[len(st)-1]
+		return append(st[:len(st)-2], a&^(1<<31)|b&(1<<31))
+	case op == 0x99: // f64.abs
+		st[len(st)-1] &^= 1 << 63
+		return st
+	case op == 0x9a: // f64.neg
+		st[len(st)-1] ^= 1 << 63
+		return st
+	case op == 0xa6: // f64.copysign
+		a, b := st[len(st)-2], st[len(st)-1]
+		return append(st[:len(st)-2], a&^(1<<63)|b&(1<<63))
+	case op >= 0x8b && op <= 0x91:
+		st[len(st)-1] = uint64(math.Float32bits(float32(floatUnary(op-0x8b, float64(f32(st[len(st)-1])), true))))
+		return st
+	case op >= 0x99 && op <= 0x9f:
+		st[len(st)-1] = math.Float64bits(floatUnary(op-0x99, f64(st[len(st)-1]), false))
+		return st
+	case op >= 0x92 && op <= 0x98:
+		a, b := f32(st[len(st)-2]), f32(st[len(st)-1])
+		return append(st[:len(st)-2], uint64(math.Float32bits(f32Binary(op-0x92, a, b))))
+	case op >= 0xa0 && op <= 0xa6:
+		a, b := f64(st[len(st)-2]), f64(st[len(st)-1])
+		return append(st[:len(st)-2], math.Float64bits(f64Binary(op-0xa0, a, b)))
+	case op >= 0xa7 && op <= 0xc4:
+		st[len(st)-1] = convert(op, st[len(st)-1])
+		return st
+	case op >= opTruncSat && op <= opTruncSatLast:
+		st[len(st)-1] = truncSat(op-opTruncSat, st[len(st)-1])
+		return st
+	}
+	trap("unsupported instruction %#x", op)
+	return nil
+}
+
+func f32(v uint64) float32 {
+	return math.Float32frombits(uint32(v))
+}
+
+func f64(v uint64) float64 {
+	return math.Float64frombits(v)
+}
+
+// cmpInt compares two integers: `i` is the index of the comparison
+// in the eq, ne, lt_s, lt_u, gt_s, gt_u, le_s, le_u, ge_s, ge_u
+// sequence.
+func cmpInt(i uint16, a, b uint64, sa, sb int64) bool {
+	switch i {
+	case 0:
+		return a == b
+	case 1:
+		return a != b
+	case 2:
+		return sa < sb
+	case 3:
+		return a < b
+	case 4:
+		return sa > sb
+	case 5:
+		return a > b
+	case 6:
+		return sa <= sb
+	case 7:
+		return a <= b
+	case 8:
+		return sa >= sb
+	default:
+		return a >= b
+	}
+}
+
+// cmpFloat compares two floats: `i` is the index of the comparison
+// in the eq, ne, lt, gt, le, ge sequence.
+func cmpFloat(i uint16, a, b float64) bool {
+	switch i {
+	case 0:
+		return a == b
+	case 1:
+		return a != b
+	case 2:
+		return a < b
+	case 3:
+		return a > b
+	case 4:
+		return a <= b
+	default:
+		return a >= b
+	}
+}
+
+func i32Binary(op uint16, a, b uint32) uint32 {
+	switch op {
+	case 0x6a:
+		return a + b
+	case 0x6b:
+		return a - b
+	case 0x6c:
+		return a * b
+	case 0x6d:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		if int32(a) == math.MinInt32 && int32(b) == -1 {
+			trap("integer overflow")
+		}
+		return uint32(int32(a) / int32(b))
+	case 0x6e:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		return a / b
+	case 0x6f:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		if int32(b) == -1 {
+			return 0
+		}
+		return uint32(int32(a) % int32(b))
+	case 0x70:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		return a % b
+	case 0x71:
+		return a & b
+	case 0x72:
+		return a | b
+	case 0x73:
+		return a ^ b
+	case 0x74:
+		return a << (b & 31)
+	case 0x75:
+		return uint32(int32(a) >> (b & 31))
+	case 0x76:
+		return a >> (b & 31)
+	case 0x77:
+		return bits.RotateLeft32(a, int(b&31))
+	default:
+		return bits.RotateLeft32(a, -int(b&31))
+	}
+}
+
+func i64Binary(op uint16, a, b uint64) uint64 {
+	switch op {
+	case 0x7c:
+		return a + b
+	case 0x7d:
+		return a - b
+	case 0x7e:
+		return a * b
+	case 0x7f:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		if int64(a) == math.MinInt64 && int64(b) == -1 {
+			trap("integer overflow")
+		}
+		return uint64(int64(a) / int64(b))
+	case 0x80:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		return a / b
+	case 0x81:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		if int64(b) == -1 {
+			return 0
+		}
+		return uint64(int64(a) % int64(b))
+	case 0x82:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		return a % b
+	case 0x83:
+		return a & b
+	case 0x84:
+		return a | b
+	case 0x85:
+		return a ^ b
+	case 0x86:
+		return a << (b & 63)
+	case 0x87:
+		return uint64(int64(a) >> (b & 63))
+	case 0x88:
+		return a >> (b & 63)
+	case 0x89:
+		return bits.RotateLeft64(a, int(b&63))
+	default:
+		return bits.RotateLeft64(a, -int(b&63))
+	}
+}
+
+// floatUnary computes a unary float operation: `i` is its index in
+// the abs, neg, ceil, floor, trunc, nearest, sqrt sequence.
+func floatUnary(i uint16, a float64, single bool) float64 {
+	switch i {
+	case 0:
+		return math.Abs(a)
+	case 1:
+		return -a
+	case 2:
+		return math.Ceil(a)
+	case 3:
+		return math.Floor(a)
+	case 4:
+		return math.Trunc(a)
+	case 5:
+		return math.RoundToEven(a)
+	default:
+		if single {
+			return float64(float32(math.Sqrt(a)))
+		}
+		return math.Sqrt(a)
+	}
+}
+
+// f32Binary computes a binary float operation: `i` is its index in
+// the add, sub, mul, div, min, max, copysign sequence.
+func f32Binary(i uint16, a, b float32) float32 {
+	switch i {
+	case 0:
+		return a + b
+	case 1:
+		return a - b
+	case 2:
+		return a * b
+	case 3:
+		return a / b
+	case 4:
+		return float32(math.Min(float64(a), float64(b)))
+	case 5:
+		return float32(math.Max(float64(a), float64(b)))
+	default:
+		return float32(math.Copysign(float64(a), float64(b)))
+	}
+}
+
+func f64Binary(i uint16, a, b float64) float64 {
+	switch i {
+	case 0:
+		return a + b
+	case 1:
+		return a - b
+	case 2:
+		return a * b
+	case 3:
+		return a / b
+	case 4:
+		return math.Min(a, b)
+	case 5:
+		return math.Max(a, b)
+	default:
+		return math.Copysign(a, b)
+	}
+}
+
+// Bounds of the float to integer conversions: the truncated value
+// must be greater than min and lower than max.
+const (
+	minI32 = -2147483649.0
+	maxI32 = 2147483648.0
+	maxU32 = 4294967296.0
+	minI64 = -9223372036854777856.0 // the first float64 below -2^63
+	maxI64 = 9223372036854775808.0
+	maxU64 = 18446744073709551616.0
+)
+
+// trunc converts `f` to an integer, trapping if it is not possible.
+func trunc(f, min, max float64) float64 {
+	if math.IsNaN(f) {
+		trap("invalid conversion to integer")
+	}
+	f = math.Trunc(f)
+	if f <= min || f >= max {
+		trap("integer overflow")
+	}
+	return f
+}
+
+func convert(op uint16, v uint64) uint64 {
+	switch op {
+	case 0xa7: // i32.wrap_i64
+		return uint64(uint32(v))
+	case 0xa8: // i32.trunc_f32_s
+		return uint64(uint32(int32(trunc(float64(f32(v)), minI32, maxI32))))
+	case 0xa9: // i32.trunc_f32_u
+		return uint64(uint32(trunc(float64(f32(v)), -1, maxU32)))
+	case 0xaa: // i32.trunc_f64_s
+		return uint64(uint32(int32(trunc(f64(v), minI32, maxI32))))
+	case 0xab: // i32.trunc_f64_u
+		return uint64(uint32(trunc(f64(v), -1, maxU32)))
+	case 0xac: // i64.extend_i32_s
+		return uint64(int64(int32(v)))
+	case 0xad: // i64.extend_i32_u
+		return uint64(uint32(v))
+	case 0xae: // i64.trunc_f32_s
+		return uint64(int64(trunc(float64(f32(v)), minI64, maxI64)))
+	case 0xaf: // i64.trunc_f32_u
+		return uint64(trunc(float64(f32(v)), -1, maxU64))
+	case 0xb0: // i64.trunc_f64_s
+		return uint64(int64(trunc(f64(v), minI64, maxI64)))
+	case 0xb1: // i64.trunc_f64_u
+		return uint64(trunc(f64(v), -1, maxU64))
+	case 0xb2: // f32.convert_i32_s
+		return uint64(math.Float32bits(float32(int32(v))))
+	case 0xb3: // f32.convert_i32_u
+		return uint64(math.Float32bits(float32(uint32(v))))
+	case 0xb4: // f32.convert_i64_s
+		return uint64(math.Float32bits(float32(int64(v))))
+	case 0xb5: // f32.convert_i64_u
+		return uint64(math.Float32bits(float32(v)))
+	case 0xb6: // f32.demote_f64
+		return uint64(math.Float32bits(float32(f64(v))))
+	case 0xb7: // f64.convert_i32_s
+		return math.Float64bits(float64(int32(v)))
+	case 0xb8: // f64.convert_i32_u
+		return math.Float64bits(float64(uint32(v)))
+	case 0xb9: // f64.convert_i64_s
+		return math.Float64bits(float64(int64(v)))
+	case 0xba: // f64.convert_i64_u
+		return math.Float64bits(float64(v))
+	case 0xbb: // f64.promote_f32
+		return math.Float64bits(float64(f32(v)))
+	case 0xbc, 0xbe: // i32.reinterpret_f32, f32.reinterpret_i32
+		return uint64(uint32(v))
+	case 0xbd, 0xbf: // i64.reinterpret_f64, f64.reinterpret_i64
+		return v
+	case 0xc0: // i32.extend8_s
+		return uint64(uint32(int32(int8(v))))
+	case 0xc1: // i32.extend16_s
+		return uint64(uint32(int32(int16(v))))
+	case 0xc2: // i64.extend8_s
+		return uint64(int64(int8(v)))
+	case 0xc3: // i64.extend16_s
+		return uint64(int64(int16(v)))
+	default: // i64.extend32_s
+		return uint64(int64(int32(v)))
+	}
+}
+
+// truncSat performs a saturating conversion: `i` is its index in the
+// i32.trunc_sat_f32_s, i32.trunc_sat_f32_u, i32.trunc_sat_f64_s,
+// i32.trunc_sat_f64_u sequence, followed by the i64 ones.
+func truncSat(i uint16, v uint64) uint64 {
+	var f float64
+	if i == 0 || i == 1 || i == 4 || i == 5 {
+		f = float64(f32(v))
+	} else {
+		f = f64(v)
+	}
+	signed := i%2 == 0
+	if math.IsNaN(f) {
+		return 0
+	}
+	f = math.Trunc(f)
+	if i < 4 {
+		if signed {
+			switch {
+			case f <= minI32:
+				return 1 << 31
+			case f >= maxI32:
+				return uint64(uint32(math.MaxInt32))
+			}
+			return uint64(uint32(int32(f)))
+		}
+		switch {
+		case f <= -1:
+			return 0
+		case f >= maxU32:
+			return uint64(math.MaxUint32)
+		}
+		return uint64(uint32(f))
+	}
+	if signed {
+		switch {
+		case f <= minI64:
+			return 1 << 63
+		case f >= maxI64:
+			return math.MaxInt64
+		}
+		return uint64(int64(f))
+	}
+	switch {
+	case f <= -1:
+		return 0
+	case f >= maxU64:
+		return math.MaxUint64
+	}
+	return uint64(f)
+}
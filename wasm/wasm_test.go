@@ -0,0 +1,299 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package wasm_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/booster-proj/booster/wasm"
+)
+
+// Helpers used to assemble binary modules.
+
+func uleb(v uint64) []byte {
+	var b []byte
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if v == 0 {
+			return b
+		}
+	}
+}
+
+func sleb(v int64) []byte {
+	var b []byte
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && c&0x40 == 0) || (v == -1 && c&0x40 != 0) {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+func cat(l ...[]byte) []byte {
+	return bytes.Join(l, nil)
+}
+
+func vec(items ...[]byte) []byte {
+	return cat(uleb(uint64(len(items))), cat(items...))
+}
+
+func str(s string) []byte {
+	return cat(uleb(uint64(len(s))), []byte(s))
+}
+
+func section(id byte, contents ...[]byte) []byte {
+	b := cat(contents...)
+	return cat([]byte{id}, uleb(uint64(len(b))), b)
+}
+
+func module(sections ...[]byte) []byte {
+	return cat([]byte("\x00asm\x01\x00\x00\x00"), cat(sections...))
+}
+
+func functype(params, results []byte) []byte {
+	return cat([]byte{0x60}, vec(split(params)...), vec(split(results)...))
+}
+
+func split(b []byte) [][]byte {
+	l := make([][]byte, len(b))
+	for i := range b {
+		l[i] = b[i : i+1]
+	}
+	return l
+}
+
+// body encodes a function body, with `locals` i32 locals.
+func body(locals int, code ...[]byte) []byte {
+	var decl []byte
+	if locals > 0 {
+		decl = vec(cat(uleb(uint64(locals)), []byte{0x7f}))
+	} else {
+		decl = vec()
+	}
+	b := cat(decl, cat(code...))
+	return cat(uleb(uint64(len(b))), b)
+}
+
+func export(name string, idx int) []byte {
+	return cat(str(name), []byte{0x00}, uleb(uint64(idx)))
+}
+
+var (
+	i32 = byte(0x7f)
+	i64 = byte(0x7e)
+)
+
+func instantiate(t *testing.T, b []byte, imports wasm.Imports) *wasm.Instance {
+	m, err := wasm.Decode(b)
+	if err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	in, err := wasm.Instantiate(m, imports)
+	if err != nil {
+		t.Fatalf("Unexpected instantiation error: %v", err)
+	}
+	return in
+}
+
+func call(t *testing.T, in *wasm.Instance, name string, args ...uint64) uint64 {
+	res, err := in.Call(name, args...)
+	if err != nil {
+		t.Fatalf("%s: unexpected error: %v", name, err)
+	}
+	if len(res) != 1 {
+		t.Fatalf("%s: unexpected results: %v", name, res)
+	}
+	return res[0]
+}
+
+func TestCall(t *testing.T) {
+	b := module(
+		section(1, vec(
+			functype([]byte{i64}, []byte{i64}),
+			functype([]byte{i32}, []byte{i32}),
+		)),
+		section(3, vec(uleb(0), uleb(1), uleb(1))),
+		section(7, vec(export("fact", 0), export("sum", 1), export("switch", 2))),
+		section(10, vec(
+			// Recursive factorial, using if and else.
+			body(0,
+				[]byte{0x20, 0, 0x50, 0x04, i64},         // local.get 0, i64.eqz, if (result i64)
+				[]byte{0x42, 1},                          // i64.const 1
+				[]byte{0x05, 0x20, 0, 0x20, 0, 0x42, 1},  // else, local.get 0, local.get 0, i64.const 1
+				[]byte{0x7d, 0x10, 0, 0x7e, 0x0b, 0x0b}), // i64.sub, call 0, i64.mul, end, end
+			// Sum of 1 to n, using a loop.
+			body(1,
+				[]byte{0x02, 0x40, 0x03, 0x40},       // block, loop
+				[]byte{0x20, 0, 0x45, 0x0d, 1},       // local.get 0, i32.eqz, br_if 1
+				[]byte{0x20, 1, 0x20, 0, 0x6a},       // local.get 1, local.get 0, i32.add
+				[]byte{0x21, 1},                      // local.set 1
+				[]byte{0x20, 0, 0x41, 1, 0x6b, 0x21}, // local.get 0, i32.const 1, i32.sub, local.set 0
+				[]byte{0, 0x0c, 0, 0x0b, 0x0b},       // br 0, end, end
+				[]byte{0x20, 1, 0x0b}),               // local.get 1, end
+			// Switch, using br_table.
+			body(0,
+				[]byte{0x02, 0x40, 0x02, 0x40, 0x02, 0x40}, // block, block, block
+				[]byte{0x20, 0, 0x0e, 2, 0, 1, 2, 0x0b},    // local.get 0, br_table 0 1 2, end
+				[]byte{0x41, 10, 0x0f, 0x0b},               // i32.const 10, return, end
+				[]byte{0x41, 20, 0x0f, 0x0b},               // i32.const 20, return, end
+				cat([]byte{0x41}, sleb(99), []byte{0x0b})), // i32.const 99, end
+		)),
+	)
+	in := instantiate(t, b, nil)
+
+	if v := call(t, in, "fact", 20); v != 2432902008176640000 {
+		t.Fatalf("fact(20): unexpected result %d", v)
+	}
+	if v := call(t, in, "sum", 100); v != 5050 {
+		t.Fatalf("sum(100): unexpected result %d", v)
+	}
+	for arg, want := range map[uint64]uint64{0: 10, 1: 20, 2: 99, 7: 99} {
+		if v := call(t, in, "switch", arg); v != want {
+			t.Fatalf("switch(%d): wanted %d, found %d", arg, want, v)
+		}
+	}
+}
+
+func TestCall_memory(t *testing.T) {
+	b := module(
+		section(1, vec(functype([]byte{i32}, []byte{i32}))),
+		section(3, vec(uleb(0), uleb(0))),
+		section(5, vec([]byte{0x00, 1})), // 1 page
+		section(7, vec(export("load", 0), export("swap", 1))),
+		section(10, vec(
+			body(0, []byte{0x20, 0, 0x2d, 0, 0, 0x0b}), // local.get 0, i32.load8_u, end
+			// Stores the argument at 0 and reads it back as big endian.
+			body(0,
+				[]byte{0x41, 0, 0x20, 0, 0x36, 2, 0},              // i32.const 0, local.get 0, i32.store
+				[]byte{0x41, 0, 0x2d, 0, 0, 0x41, 24, 0x74},       // byte 0 << 24
+				[]byte{0x41, 0, 0x2d, 0, 1, 0x41, 16, 0x74, 0x72}, // | byte 1 << 16
+				[]byte{0x41, 0, 0x2d, 0, 2, 0x41, 8, 0x74, 0x72},  // | byte 2 << 8
+				[]byte{0x41, 0, 0x2d, 0, 3, 0x72, 0x0b}),          // | byte 3
+		)),
+		section(11, vec(cat([]byte{0x00, 0x41, 16, 0x0b}, str("hello")))),
+	)
+	in := instantiate(t, b, nil)
+
+	if v := call(t, in, "load", 17); v != 'e' {
+		t.Fatalf("load(17): unexpected result %q", rune(v))
+	}
+	if v := call(t, in, "swap", 0x11223344); v != 0x44332211 {
+		t.Fatalf("swap: unexpected result %#x", v)
+	}
+	if _, err := in.Call("load", wasm.PageSize); err == nil {
+		t.Fatalf("Out of bounds access did not trap")
+	}
+	if string(in.Memory()[16:21]) != "hello" {
+		t.Fatalf("Data segment was not copied")
+	}
+}
+
+func TestCall_imports(t *testing.T) {
+	typ := wasm.FuncType{Params: []wasm.ValType{wasm.I32, wasm.I32}, Results: []wasm.ValType{wasm.I32}}
+	b := module(
+		section(1, vec(functype([]byte{i32, i32}, []byte{i32}), functype(nil, []byte{i32}))),
+		section(2, vec(cat(str("env"), str("add"), []byte{0x00, 0}))),
+		section(3, vec(uleb(1), uleb(1))),
+		section(4, vec([]byte{0x70, 0x00, 2})), // table of 2 funcref
+		section(7, vec(export("call", 1), export("indirect", 2))),
+		section(9, vec(cat([]byte{0x00, 0x41, 0, 0x0b}, vec(uleb(0), uleb(1))))),
+		section(10, vec(
+			body(0, []byte{0x41, 40, 0x41, 2, 0x10, 0, 0x0b}),            // add(40, 2)
+			body(0, []byte{0x41, 1, 0x41, 2, 0x41, 0, 0x11, 0, 0, 0x0b}), // table[0](1, 2)
+		)),
+	)
+
+	in := instantiate(t, b, wasm.Imports{"env": {"add": {
+		Type: typ,
+		Func: func(in *wasm.Instance, args []uint64) ([]uint64, error) {
+			return []uint64{uint64(uint32(args[0]) + uint32(args[1]))}, nil
+		},
+	}}})
+	if v := call(t, in, "call"); v != 42 {
+		t.Fatalf("call: unexpected result %d", v)
+	}
+	if v := call(t, in, "indirect"); v != 3 {
+		t.Fatalf("indirect: unexpected result %d", v)
+	}
+
+	m, _ := wasm.Decode(b)
+	if _, err := wasm.Instantiate(m, nil); err == nil {
+		t.Fatalf("Unresolved import was accepted")
+	}
+}
+
+func TestCall_trap(t *testing.T) {
+	hostErr := errors.New("host failure")
+	b := module(
+		section(1, vec(functype(nil, nil), functype([]byte{i32}, []byte{i32}))),
+		section(2, vec(cat(str("env"), str("fail"), []byte{0x00, 0}))),
+		section(3, vec(uleb(0), uleb(1), uleb(0))),
+		section(7, vec(export("unreachable", 1), export("div", 2), export("loop", 3), export("fail", 0))),
+		section(10, vec(
+			body(0, []byte{0x00, 0x0b}),                      // unreachable
+			body(0, []byte{0x41, 1, 0x20, 0, 0x6d, 0x0b}),    // 1 / n
+			body(0, []byte{0x03, 0x40, 0x0c, 0, 0x0b, 0x0b}), // loop, br 0
+		)),
+	)
+	in := instantiate(t, b, wasm.Imports{"env": {"fail": {
+		Type: wasm.FuncType{},
+		Func: func(in *wasm.Instance, args []uint64) ([]uint64, error) { return nil, hostErr },
+	}}})
+	in.Fuel = 1000
+
+	if _, err := in.Call("unreachable"); err == nil {
+		t.Fatalf("unreachable did not trap")
+	}
+	if _, err := in.Call("div", 0); err == nil {
+		t.Fatalf("Division by zero did not trap")
+	}
+	if _, err := in.Call("loop"); !errors.Is(err, wasm.ErrFuelExhausted) {
+		t.Fatalf("Unexpected error: wanted %v, found %v", wasm.ErrFuelExhausted, err)
+	}
+	if _, err := in.Call("fail"); !errors.Is(err, hostErr) {
+		t.Fatalf("Unexpected error: wanted %v, found %v", hostErr, err)
+	}
+	// The instance is still usable.
+	if v := call(t, in, "div", 1); v != 1 {
+		t.Fatalf("div(1): unexpected result %d", v)
+	}
+}
+
+func TestDecode_invalid(t *testing.T) {
+	for _, b := range [][]byte{
+		[]byte("not wasm"),
+		module(section(1, []byte{1, 0x60})),
+		module(section(1, vec(functype(nil, nil))), section(3, vec(uleb(0)))),
+		module(section(1, vec(functype(nil, nil))), section(3, vec(uleb(0))), section(10, vec(body(0, []byte{0xff, 0x0b})))),
+		module(section(1, vec(functype(nil, nil))), section(3, vec(uleb(0))), section(7, vec(export("f", 1))), section(10, vec(body(0, []byte{0x0b})))),
+		module(section(1, uleb(0xffffffff))),
+		module(section(1, vec(functype(nil, nil))), section(3, uleb(1<<30)), section(10, uleb(1<<30))),
+	} {
+		if _, err := wasm.Decode(b); err == nil {
+			t.Fatalf("Invalid module %x was decoded", b)
+		}
+	}
+}
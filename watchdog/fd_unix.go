@@ -0,0 +1,77 @@
+//go:build linux || darwin
+// +build linux darwin
+
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package watchdog
+
+import (
+	"os"
+	"strings"
+	"syscall"
+)
+
+// openFDs returns the number of file descriptors open by the process,
+// by kind: socket, pipe, file or other.
+func openFDs() (map[string]int, error) {
+	dir := "/proc/self/fd"
+	if _, err := os.Stat(dir); err != nil {
+		dir = "/dev/fd"
+	}
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	acc := make(map[string]int)
+	for _, v := range names {
+		link, err := os.Readlink(dir + "/" + v)
+		switch {
+		case err != nil:
+			// Either the descriptor of the directory itself, closed
+			// in the meantime, or a system without the links.
+			acc["other"]++
+		case strings.HasPrefix(link, "socket:"):
+			acc["socket"]++
+		case strings.HasPrefix(link, "pipe:"):
+			acc["pipe"]++
+		case strings.HasPrefix(link, "/"):
+			acc["file"]++
+		default:
+			acc["other"]++
+		}
+	}
+	// Do not count the descriptor used to read the directory.
+	if acc["other"] > 0 {
+		acc["other"]--
+	}
+	return acc, nil
+}
+
+// fdLimit returns the maximum number of file descriptors the process
+// can open, or 0 if unknown.
+func fdLimit() int {
+	var l syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &l); err != nil {
+		return 0
+	}
+	return int(l.Cur)
+}
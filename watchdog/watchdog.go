@@ -0,0 +1,285 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package watchdog tracks the goroutines and the file descriptors of
+// booster, warning when they grow past their thresholds, which in a
+// long-running daemon usually means that something is leaking.
+//
+// The goroutines are counted by subsystem: the ones started inside Do
+// are labeled with its name, and so are all the goroutines they
+// start in turn.
+package watchdog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/booster-proj/booster/events"
+	"upspin.io/log"
+)
+
+// LabelKey is the pprof label carrying the name of the subsystem a
+// goroutine belongs to.
+const LabelKey = "subsystem"
+
+// Unlabeled is the subsystem of the goroutines not started inside Do.
+const Unlabeled = "other"
+
+// Defaults of the watchdog.
+const (
+	DefaultInterval      = 30 * time.Second
+	DefaultMaxGoroutines = 10000
+	// DefaultFDRatio is the share of the file descriptors limit of
+	// the process used as threshold when MaxFDs is 0.
+	DefaultFDRatio = 0.8
+)
+
+// Do calls `f` with the goroutine labeled as belonging to `subsystem`,
+// together with the goroutines it starts.
+func Do(ctx context.Context, subsystem string, f func(ctx context.Context) error) error {
+	var err error
+	pprof.Do(ctx, pprof.Labels(LabelKey, subsystem), func(ctx context.Context) {
+		err = f(ctx)
+	})
+	return err
+}
+
+// Stats are the goroutines and the file descriptors counted by the
+// watchdog.
+type Stats struct {
+	Time       time.Time      `json:"time"`
+	Goroutines int            `json:"goroutines"`
+	Subsystems map[string]int `json:"subsystems"`
+	// FDs is the number of open file descriptors, by kind: socket,
+	// pipe, file or other. Empty if they cannot be counted on the
+	// platform.
+	FDs     map[string]int `json:"fds,omitempty"`
+	FDLimit int            `json:"fd_limit,omitempty"`
+}
+
+// TotalFDs returns the number of open file descriptors.
+func (s Stats) TotalFDs() int {
+	var n int
+	for _, v := range s.FDs {
+		n += v
+	}
+	return n
+}
+
+// Alert is the data of the TopicWatchdog events: the resource, i.e.
+// "goroutines", "goroutines:<subsystem>" or "fds", whose Count exceeded
+// its Threshold, and the file the diagnostic dump was written to, if
+// any.
+type Alert struct {
+	Resource  string `json:"resource"`
+	Count     int    `json:"count"`
+	Threshold int    `json:"threshold"`
+	Dump      string `json:"dump,omitempty"`
+}
+
+// Watchdog counts the goroutines and the file descriptors every
+// Interval, and warns when they exceed their thresholds: it logs the
+// counts and publishes a TopicWatchdog event. Each resource is
+// reported once, until its count goes back below the threshold.
+type Watchdog struct {
+	// Interval is the time between two counts. If 0,
+	// DefaultInterval is used.
+	Interval time.Duration
+	// MaxGoroutines is the threshold of the total number of
+	// goroutines. If 0, DefaultMaxGoroutines is used.
+	MaxGoroutines int
+	// Subsystems are the thresholds of the goroutines of each
+	// subsystem, if any.
+	Subsystems map[string]int
+	// MaxFDs is the threshold of the open file descriptors. If 0,
+	// DefaultFDRatio of the limit of the process is used.
+	MaxFDs int
+	// DumpDir, if set, is the directory where the stacks of the
+	// goroutines are dumped when a threshold is exceeded.
+	DumpDir string
+	Events  *events.Bus
+
+	mux      sync.Mutex
+	stats    Stats
+	exceeded map[string]bool
+}
+
+// Run counts the resources every Interval until `ctx` is canceled.
+func (w *Watchdog) Run(ctx context.Context) error {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	for {
+		w.Check()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Stats returns the last counts.
+func (w *Watchdog) Stats() Stats {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	return w.stats
+}
+
+// Check counts the resources, warning about the ones exceeding their
+// thresholds, and returns the counts.
+func (w *Watchdog) Check() Stats {
+	stats := Stats{
+		Time:       time.Now(),
+		Goroutines: runtime.NumGoroutine(),
+		Subsystems: countSubsystems(),
+		FDLimit:    fdLimit(),
+	}
+	if fds, err := openFDs(); err == nil {
+		stats.FDs = fds
+	}
+
+	type check struct {
+		resource         string
+		count, threshold int
+	}
+	checks := []check{{"goroutines", stats.Goroutines, w.maxGoroutines()}}
+	for name, max := range w.Subsystems {
+		checks = append(checks, check{"goroutines:" + name, stats.Subsystems[name], max})
+	}
+	if max := w.maxFDs(stats.FDLimit); max > 0 && stats.FDs != nil {
+		checks = append(checks, check{"fds", stats.TotalFDs(), max})
+	}
+
+	w.mux.Lock()
+	w.stats = stats
+	if w.exceeded == nil {
+		w.exceeded = make(map[string]bool)
+	}
+	var alerts []Alert
+	for _, v := range checks {
+		exceeded := v.threshold > 0 && v.count > v.threshold
+		if exceeded && !w.exceeded[v.resource] {
+			alerts = append(alerts, Alert{Resource: v.resource, Count: v.count, Threshold: v.threshold})
+		}
+		w.exceeded[v.resource] = exceeded
+	}
+	w.mux.Unlock()
+
+	if len(alerts) == 0 {
+		return stats
+	}
+	var dump string
+	if w.DumpDir != "" {
+		var err error
+		if dump, err = w.dump(stats.Time); err != nil {
+			log.Error.Printf("Watchdog: unable to dump the goroutines: %v", err)
+		}
+	}
+	for _, v := range alerts {
+		v.Dump = dump
+		log.Error.Printf("Watchdog: %d %s exceed the threshold of %d, possible leak (goroutines by subsystem: %v, fds: %v)", v.Count, v.Resource, v.Threshold, stats.Subsystems, stats.FDs)
+		w.Events.Publish(events.Event{
+			Topic:   events.TopicWatchdog,
+			Message: fmt.Sprintf("%d %s exceed the threshold of %d", v.Count, v.Resource, v.Threshold),
+			Data:    v,
+		})
+	}
+	return stats
+}
+
+func (w *Watchdog) maxGoroutines() int {
+	if w.MaxGoroutines > 0 {
+		return w.MaxGoroutines
+	}
+	return DefaultMaxGoroutines
+}
+
+func (w *Watchdog) maxFDs(limit int) int {
+	if w.MaxFDs > 0 {
+		return w.MaxFDs
+	}
+	return int(float64(limit) * DefaultFDRatio)
+}
+
+// dump writes the stacks of the goroutines, together with the counts,
+// into a new file of DumpDir, returning its path.
+func (w *Watchdog) dump(now time.Time) (string, error) {
+	if err := os.MkdirAll(w.DumpDir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(w.DumpDir, "goroutines-"+now.UTC().Format("20060102T150405Z")+".txt")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", err
+	}
+	stats, _ := json.Marshal(w.Stats())
+	fmt.Fprintf(f, "# %s\n\n", stats)
+	if err := pprof.Lookup("goroutine").WriteTo(f, 2); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
+
+// countSubsystems returns the number of goroutines of each subsystem,
+// parsing the goroutine profile aggregated by stack, where each stack
+// is followed by the labels of its goroutines.
+func countSubsystems() map[string]int {
+	var buf bytes.Buffer
+	pprof.Lookup("goroutine").WriteTo(&buf, 1)
+
+	acc := make(map[string]int)
+	var n int
+	flush := func(subsystem string) {
+		if n > 0 {
+			acc[subsystem] += n
+		}
+		n = 0
+	}
+	s := bufio.NewScanner(&buf)
+	s.Buffer(make([]byte, 64<<10), 1<<20)
+	for s.Scan() {
+		line := s.Text()
+		switch {
+		case strings.HasPrefix(line, "# labels: "):
+			var labels map[string]string
+			json.Unmarshal([]byte(strings.TrimPrefix(line, "# labels: ")), &labels)
+			if v, ok := labels[LabelKey]; ok {
+				flush(v)
+			}
+		case line == "":
+			flush(Unlabeled)
+		case !strings.HasPrefix(line, "#") && strings.Contains(line, " @ "):
+			// A new stack: "<count> @ <pcs>".
+			flush(Unlabeled)
+			n, _ = strconv.Atoi(strings.SplitN(line, " ", 2)[0])
+		}
+	}
+	flush(Unlabeled)
+	return acc
+}
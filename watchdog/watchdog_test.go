@@ -0,0 +1,100 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package watchdog_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/booster-proj/booster/events"
+	"github.com/booster-proj/booster/watchdog"
+)
+
+func TestWatchdog_Check(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watchdog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bus := new(events.Bus)
+	alerts, cancel := bus.Subscribe(8)
+	defer cancel()
+	w := &watchdog.Watchdog{
+		Subsystems: map[string]int{"leaky": 5},
+		DumpDir:    dir,
+		Events:     bus,
+	}
+
+	// The goroutines started by the subsystem, and the ones they
+	// start, are labeled.
+	stop := make(chan struct{})
+	defer close(stop)
+	leak := func(n int) {
+		started := make(chan struct{})
+		watchdog.Do(context.Background(), "leaky", func(ctx context.Context) error {
+			go func() {
+				for i := 0; i < n; i++ {
+					go func() { <-stop }()
+				}
+				close(started)
+				<-stop
+			}()
+			return nil
+		})
+		<-started
+	}
+
+	leak(2)
+	stats := w.Check()
+	if n := stats.Subsystems["leaky"]; n != 3 {
+		t.Fatalf("Unexpected goroutines of the subsystem: wanted 3, found %d (%v)", n, stats.Subsystems)
+	}
+	if stats.Subsystems[watchdog.Unlabeled] == 0 {
+		t.Fatalf("Unlabeled goroutines not counted: %v", stats.Subsystems)
+	}
+	select {
+	case e := <-alerts:
+		t.Fatalf("Unexpected event: %+v", e)
+	default:
+	}
+
+	leak(4)
+	w.Check()
+	e := <-alerts
+	a, ok := e.Data.(watchdog.Alert)
+	if e.Topic != events.TopicWatchdog || !ok || a.Resource != "goroutines:leaky" || a.Count != 8 || a.Threshold != 5 {
+		t.Fatalf("Unexpected event: %+v", e)
+	}
+	b, err := ioutil.ReadFile(a.Dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "goroutine ") {
+		t.Fatalf("Unexpected dump: %s", b)
+	}
+
+	// The alert is not repeated while the threshold is exceeded.
+	w.Check()
+	select {
+	case e := <-alerts:
+		t.Fatalf("Unexpected event: %+v", e)
+	default:
+	}
+}
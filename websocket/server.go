@@ -0,0 +1,89 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package websocket
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"upspin.io/log"
+)
+
+// Server accepts the WebSocket connections requested at Path, passing
+// them to Handle, and replies 404 to any other request, as an ordinary
+// web server would.
+type Server struct {
+	// Path is where the connections are accepted, e.g. a path hard
+	// to guess, as anyone reaching it is served.
+	Path string
+	// Handle is called with each connection accepted, which is
+	// closed once Handle returns. The context is canceled when the
+	// server is stopped.
+	Handle func(ctx context.Context, conn net.Conn)
+	// If TLS is not nil, the server is served over TLS.
+	TLS *tls.Config
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != s.Path {
+		http.NotFound(w, r)
+		return
+	}
+	conn, err := Upgrade(w, r)
+	if err != nil {
+		log.Debug.Printf("WebSocket: refusing request of client %v: %v", r.RemoteAddr, err)
+		return
+	}
+	defer conn.Close()
+	s.Handle(r.Context(), conn)
+}
+
+// Serve serves the WebSocket connections accepted by `ln`, until the
+// context is canceled.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	if s.TLS != nil {
+		// The connections are hijacked, which is not possible with
+		// HTTP/2.
+		conf := s.TLS.Clone()
+		conf.NextProtos = []string{"http/1.1"}
+		ln = tls.NewListener(ln, conf)
+	}
+	srv := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: time.Second * 15,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	c := make(chan error)
+	go func() {
+		c <- srv.Serve(ln)
+	}()
+
+	select {
+	case <-ctx.Done():
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		srv.Shutdown(ctx)
+		return <-c
+	case err := <-c:
+		return err
+	}
+}
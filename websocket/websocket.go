@@ -0,0 +1,319 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package websocket implements the WebSocket protocol (RFC 6455) as far
+// as needed to tunnel a stream of bytes, e.g. the connections of the
+// clients behind a firewall that only lets HTTPS through. The messages
+// are not preserved: the payloads of the data frames are read as a
+// stream, and each Write is sent as a binary frame.
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The opcodes of the frames.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// keyGUID is concatenated to the key of the handshake by the server to
+// prove that it understands the protocol.
+const keyGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// ErrBadHandshake is returned when the handshake does not follow the
+// protocol.
+var ErrBadHandshake = errors.New("websocket: bad handshake")
+
+// Conn is a WebSocket connection, used as a net.Conn.
+type Conn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	// client tells whether the frames sent are masked, as the
+	// clients must do, and the ones received are not.
+	client bool
+
+	// The state of the data frame being read.
+	remaining int64
+	mask      [4]byte
+	masked    bool
+	pos       int
+
+	wmux      sync.Mutex
+	closeOnce sync.Once
+}
+
+func accept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + keyGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range strings.Split(h.Get(name), ",") {
+		if strings.EqualFold(strings.TrimSpace(v), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// Upgrade performs the server side of the handshake of `r`, returning
+// the connection hijacked from `w`. If the request is not a valid
+// handshake, it is replied with an error.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || key == "" ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "websocket: bad handshake", http.StatusBadRequest)
+		return nil, ErrBadHandshake
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "websocket: unsupported version", http.StatusUpgradeRequired)
+		return nil, ErrBadHandshake
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket: hijacking not supported", http.StatusInternalServerError)
+		return nil, errors.New("websocket: hijacking not supported")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	// Clear the timeouts of the HTTP server.
+	conn.SetDeadline(time.Time{})
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + accept(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(resp)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Conn{conn: conn, br: rw.Reader}, nil
+}
+
+// Client performs the client side of the handshake on `conn`, e.g. a
+// TLS connection, requesting `path` of `host`.
+func Client(conn net.Conn, host, path string) (*Conn, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(b)
+	req := "GET " + path + " HTTP/1.1\r\n" +
+		"Host: " + host + "\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + key + "\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := conn.Write([]byte(req)); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("websocket: unexpected status %v", resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != accept(key) {
+		return nil, ErrBadHandshake
+	}
+	return &Conn{conn: conn, br: br, client: true}, nil
+}
+
+// Read reads the payload of the data frames, answering the control
+// frames received in between. It returns io.EOF once the peer closes
+// the connection.
+func (c *Conn) Read(p []byte) (int, error) {
+	for c.remaining == 0 {
+		if err := c.next(); err != nil {
+			return 0, err
+		}
+	}
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.br.Read(p)
+	if c.masked {
+		for i := 0; i < n; i++ {
+			p[i] ^= c.mask[(c.pos+i)%4]
+		}
+		c.pos += n
+	}
+	c.remaining -= int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// next reads the header of the next data frame, handling the control
+// frames preceding it.
+func (c *Conn) next() error {
+	for {
+		var h [2]byte
+		if _, err := io.ReadFull(c.br, h[:]); err != nil {
+			return err
+		}
+		op := h[0] & 0x0f
+		masked := h[1]&0x80 != 0
+		if masked == c.client {
+			return errors.New("websocket: unexpected masking of the frame")
+		}
+		n := int64(h[1] & 0x7f)
+		switch n {
+		case 126:
+			var b [2]byte
+			if _, err := io.ReadFull(c.br, b[:]); err != nil {
+				return err
+			}
+			n = int64(binary.BigEndian.Uint16(b[:]))
+		case 127:
+			var b [8]byte
+			if _, err := io.ReadFull(c.br, b[:]); err != nil {
+				return err
+			}
+			n = int64(binary.BigEndian.Uint64(b[:]))
+			if n < 0 {
+				return errors.New("websocket: invalid frame length")
+			}
+		}
+		var mask [4]byte
+		if masked {
+			if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+				return err
+			}
+		}
+
+		switch op {
+		case opContinuation, opText, opBinary:
+			c.remaining, c.mask, c.masked, c.pos = n, mask, masked, 0
+			return nil
+		case opClose, opPing, opPong:
+			if n > 125 {
+				return errors.New("websocket: control frame too long")
+			}
+			payload := make([]byte, n)
+			if _, err := io.ReadFull(c.br, payload); err != nil {
+				return err
+			}
+			if masked {
+				for i := range payload {
+					payload[i] ^= mask[i%4]
+				}
+			}
+			switch op {
+			case opClose:
+				c.sendClose()
+				return io.EOF
+			case opPing:
+				if err := c.writeFrame(opPong, payload); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("websocket: unknown opcode %#x", op)
+		}
+	}
+}
+
+// Write sends `p` as a binary frame.
+func (c *Conn) Write(p []byte) (int, error) {
+	if err := c.writeFrame(opBinary, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *Conn) writeFrame(op byte, payload []byte) error {
+	b := make([]byte, 0, 14+len(payload))
+	b = append(b, 0x80|op)
+	var flag byte
+	if c.client {
+		flag = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		b = append(b, flag|byte(n))
+	case n <= 0xffff:
+		b = append(b, flag|126, byte(n>>8), byte(n))
+	default:
+		b = append(b, flag|127)
+		b = append(b, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(b[len(b)-8:], uint64(n))
+	}
+	if c.client {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		b = append(b, mask[:]...)
+		for i, v := range payload {
+			b = append(b, v^mask[i%4])
+		}
+	} else {
+		b = append(b, payload...)
+	}
+
+	c.wmux.Lock()
+	defer c.wmux.Unlock()
+	_, err := c.conn.Write(b)
+	return err
+}
+
+// sendClose sends the close frame, once.
+func (c *Conn) sendClose() {
+	c.closeOnce.Do(func() {
+		// 1000, normal closure.
+		c.writeFrame(opClose, []byte{0x03, 0xe8})
+	})
+}
+
+// Close sends the close frame, if it was not already, and closes the
+// underlying connection.
+func (c *Conn) Close() error {
+	c.sendClose()
+	return c.conn.Close()
+}
+
+func (c *Conn) LocalAddr() net.Addr                { return c.conn.LocalAddr() }
+func (c *Conn) RemoteAddr() net.Addr               { return c.conn.RemoteAddr() }
+func (c *Conn) SetDeadline(t time.Time) error      { return c.conn.SetDeadline(t) }
+func (c *Conn) SetReadDeadline(t time.Time) error  { return c.conn.SetReadDeadline(t) }
+func (c *Conn) SetWriteDeadline(t time.Time) error { return c.conn.SetWriteDeadline(t) }
@@ -0,0 +1,97 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package websocket_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/booster-proj/booster/websocket"
+)
+
+// serve starts a Server echoing the data received at /secret.
+func serve(t *testing.T) (string, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &websocket.Server{
+		Path: "/secret",
+		Handle: func(ctx context.Context, conn net.Conn) {
+			io.Copy(conn, conn)
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Serve(ctx, ln)
+	return ln.Addr().String(), cancel
+}
+
+func TestServer(t *testing.T) {
+	addr, stop := serve(t)
+	defer stop()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws, err := websocket.Client(conn, addr, "/secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	// Larger than a frame with a 16 bit length.
+	data := bytes.Repeat([]byte("booster"), 10000)
+	go ws.Write(data)
+	b := make([]byte, len(data))
+	if _, err := io.ReadFull(ws, b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Fatal("Unexpected data echoed")
+	}
+}
+
+func TestServer_notFound(t *testing.T) {
+	addr, stop := serve(t)
+	defer stop()
+
+	resp, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Unexpected status: %v", resp.Status)
+	}
+
+	// The plain requests to the path are not upgraded.
+	resp, err = http.Get("http://" + addr + "/secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(b), "handshake") {
+		t.Fatalf("Unexpected reply: %v %s", resp.Status, b)
+	}
+}